@@ -0,0 +1,866 @@
+package admin
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cloudfoundry-incubator/garden/api"
+
+	"github.com/cloudfoundry-incubator/garden-linux/old/linux_backend"
+	"github.com/cloudfoundry-incubator/garden-linux/old/linux_backend/network_pool"
+	"github.com/cloudfoundry-incubator/garden-linux/old/linux_backend/port_pool"
+	"github.com/pivotal-golang/lager"
+)
+
+type PoolGrower interface {
+	GrowPortPool(size uint32) error
+	GrowNetworkPool(*net.IPNet) error
+}
+
+type UsageReporter interface {
+	UsageHistory(handle string) ([]linux_backend.UsageSample, error)
+}
+
+type CapabilityReporter interface {
+	Capabilities() linux_backend.Capabilities
+}
+
+type CapacityReporter interface {
+	CommittedCapacity() (linux_backend.CommittedCapacity, error)
+}
+
+type PoolUtilizationReporter interface {
+	PoolUtilization() []linux_backend.PoolUtilization
+}
+
+type ContainerDestroyer interface {
+	Containers(api.Properties) ([]api.Container, error)
+	Destroy(handle string) error
+}
+
+type PortReserver interface {
+	ReservePort(port uint32) (uint32, error)
+	ReleasePort(port uint32) error
+}
+
+type NetOutRuler interface {
+	AddNetOutRule(handle string, rule linux_backend.NetOutRule) error
+	BulkNetOut(handle string, rules []linux_backend.NetOutRule) error
+}
+
+type NetInMapper interface {
+	NetInProtocol(handle string, protocol linux_backend.Protocol, hostPort uint32, containerPort uint32) (uint32, uint32, error)
+}
+
+type NetInRanger interface {
+	NetInRange(handle string, protocol linux_backend.Protocol, hostPortStart uint32, containerPortStart uint32, count uint32) (linux_backend.NetInSpec, error)
+}
+
+type PacketCapturer interface {
+	StartCapture(handle string, limits linux_backend.CaptureLimits) (string, error)
+	StopCapture(handle string) error
+}
+
+type Backend interface {
+	PoolGrower
+	UsageReporter
+	CapabilityReporter
+	CapacityReporter
+	PoolUtilizationReporter
+	ContainerDestroyer
+	PortReserver
+	NetOutRuler
+	NetInMapper
+	NetInRanger
+	PacketCapturer
+}
+
+// DefaultDestroyParallelism is how many containers POST /containers/destroy
+// destroys at once, unless told otherwise.
+const DefaultDestroyParallelism = 4
+
+// DestroyProgress is written by POST /containers/destroy, as a line of JSON,
+// as each container is destroyed or fails to be.
+type DestroyProgress struct {
+	Handle string
+	Error  string `json:",omitempty"`
+
+	// containers destroyed or failed so far, of the total to destroy
+	Done  int
+	Total int
+}
+
+// PortReservation is returned by POST /ports/reserve.
+type PortReservation struct {
+	Port uint32
+}
+
+// NetOutRuleSpec is a net out rule as POST /containers/net_out/bulk takes
+// them, with the same fields, and defaults, as POST /containers/net_out's
+// parameters.
+type NetOutRuleSpec struct {
+	Protocol string   `json:",omitempty"`
+	Networks []string `json:",omitempty"`
+	Ports    []string `json:",omitempty"`
+	ICMPType *uint8   `json:",omitempty"`
+	ICMPCode *uint8   `json:",omitempty"`
+	Log      bool     `json:",omitempty"`
+}
+
+// NetInMapped is returned by POST /containers/net_in.
+type NetInMapped struct {
+	HostPort      uint32
+	ContainerPort uint32
+}
+
+// NetInRangeMapped is returned by POST /containers/net_in_range.
+type NetInRangeMapped struct {
+	HostPortStart      uint32
+	ContainerPortStart uint32
+	Count              uint32
+}
+
+// CaptureStarted is returned by POST /containers/capture/start.
+type CaptureStarted struct {
+	// in the container, for streaming out
+	Path string
+}
+
+// NewHandler serves operator calls that are not part of the garden API:
+// POST /pools/port?size=N grows the port pool to N ports,
+// POST /pools/network?network=CIDR grows the network pool to CIDR,
+// GET /containers/usage?handle=H returns the container's recent CPU and
+// memory usage as JSON, oldest first, GET /capabilities returns what the
+// host's kernel lets the backend enforce as JSON, GET /capacity returns the
+// host's capacity and how much of it containers' limits commit as JSON, and
+// GET /pools returns how much of each pool that containers draw resources
+// from is free as JSON, as the pool.* metrics report it.
+//
+// POST /containers/destroy destroys every container, or only those with all
+// of the given property=NAME:VALUE properties, for evacuating the host. At
+// most parallelism=N are destroyed at once. Progress is streamed as a line of
+// DestroyProgress JSON per container.
+//
+// POST /ports/reserve?port=N reserves host port N, or any free port if none
+// is given, before a container exists to map it, returning PortReservation
+// JSON. The first container to NetIn the port takes the reservation over.
+// POST /ports/release?port=N releases a reservation that no container took.
+//
+// POST /containers/net_out?handle=H whitelists outbound traffic from the
+// container by a rule the garden API cannot express: protocol=P (tcp, udp,
+// icmp or all, the default) to any of network=N, a CIDR, IP or range of IPs
+// as A-B, and port=R, a port or range of ports as A-B, each of which may be
+// repeated, and logged if log=true. With protocol=icmp, icmp_type=T and
+// icmp_code=C allow only that type, e.g. 8 for ping, and code of message.
+// POST /containers/net_out/bulk?handle=H applies a JSON list of
+// NetOutRuleSpecs at once: either all of them, or, if any is invalid or
+// applying them fails, none.
+//
+// POST /containers/net_in?handle=H&protocol=P maps a host port to a port of
+// the container for protocol P, tcp, the default, or udp, which the garden
+// API's NetIn can only do for tcp, returning NetInMapped JSON. host_port and
+// container_port, like NetIn's, are acquired from the port pool, or the
+// same as the host port, if not given.
+//
+// POST /containers/net_in_range?handle=H&count=N maps N contiguous host
+// ports, from host_port_start=P or a block acquired from the port pool, to
+// the same ports of the container for protocol=P (tcp, the default, or udp)
+// with a single rule, returning NetInRangeMapped JSON. container_port_start,
+// if given, must be the same as host_port_start.
+//
+// POST /containers/capture/start?handle=H captures the packets of the
+// container's network, from inside its network namespace, returning
+// CaptureStarted JSON. The capture stops after duration=D (a Go duration),
+// packets=N, of which snap_length=N bytes each are kept, or at
+// POST /containers/capture/stop?handle=H. Limits not given are defaulted, and
+// all are bounded.
+//
+// It has no authentication, so should only be listened for locally.
+func NewHandler(backend Backend, logger lager.Logger) http.Handler {
+	handler := &handler{
+		grower:       backend,
+		reporter:     backend,
+		capabilities: backend,
+		capacity:     backend,
+		pools:        backend,
+		destroyer:    backend,
+		ports:        backend,
+		netOuts:      backend,
+		netIns:       backend,
+		netInRanges:  backend,
+		capturer:     backend,
+		logger:       logger.Session("admin"),
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/pools/port", handler.growPortPool)
+	mux.HandleFunc("/pools/network", handler.growNetworkPool)
+	mux.HandleFunc("/containers/usage", handler.usageHistory)
+	mux.HandleFunc("/capabilities", handler.reportCapabilities)
+	mux.HandleFunc("/capacity", handler.reportCapacity)
+	mux.HandleFunc("/pools", handler.reportPoolUtilization)
+	mux.HandleFunc("/containers/destroy", handler.destroyContainers)
+	mux.HandleFunc("/ports/reserve", handler.reservePort)
+	mux.HandleFunc("/ports/release", handler.releasePort)
+	mux.HandleFunc("/containers/net_out", handler.addNetOutRule)
+	mux.HandleFunc("/containers/net_out/bulk", handler.bulkNetOut)
+	mux.HandleFunc("/containers/net_in", handler.netIn)
+	mux.HandleFunc("/containers/net_in_range", handler.netInRange)
+	mux.HandleFunc("/containers/capture/start", handler.startCapture)
+	mux.HandleFunc("/containers/capture/stop", handler.stopCapture)
+
+	return mux
+}
+
+type handler struct {
+	grower       PoolGrower
+	reporter     UsageReporter
+	capabilities CapabilityReporter
+	capacity     CapacityReporter
+	pools        PoolUtilizationReporter
+	destroyer    ContainerDestroyer
+	ports        PortReserver
+	netOuts      NetOutRuler
+	netIns       NetInMapper
+	netInRanges  NetInRanger
+	capturer     PacketCapturer
+	logger       lager.Logger
+}
+
+func (h *handler) growPortPool(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	size, err := strconv.ParseUint(r.FormValue("size"), 10, 32)
+	if err != nil {
+		http.Error(w, "malformed size: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	err = h.grower.GrowPortPool(uint32(size))
+	if err != nil {
+		h.logger.Error("failed-to-grow-port-pool", err, lager.Data{"size": size})
+		http.Error(w, err.Error(), statusFor(err))
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *handler) growNetworkPool(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	_, ipNet, err := net.ParseCIDR(r.FormValue("network"))
+	if err != nil {
+		http.Error(w, "malformed network: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	err = h.grower.GrowNetworkPool(ipNet)
+	if err != nil {
+		h.logger.Error("failed-to-grow-network-pool", err, lager.Data{"network": ipNet.String()})
+		http.Error(w, err.Error(), statusFor(err))
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *handler) usageHistory(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	handle := r.FormValue("handle")
+
+	samples, err := h.reporter.UsageHistory(handle)
+	if err != nil {
+		h.logger.Error("failed-to-get-usage-history", err, lager.Data{"handle": handle})
+		http.Error(w, err.Error(), statusFor(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	err = json.NewEncoder(w).Encode(samples)
+	if err != nil {
+		h.logger.Error("failed-to-write-usage-history", err, lager.Data{"handle": handle})
+	}
+}
+
+func (h *handler) reportCapabilities(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	err := json.NewEncoder(w).Encode(h.capabilities.Capabilities())
+	if err != nil {
+		h.logger.Error("failed-to-write-capabilities", err)
+	}
+}
+
+func (h *handler) reportCapacity(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	capacity, err := h.capacity.CommittedCapacity()
+	if err != nil {
+		h.logger.Error("failed-to-get-capacity", err)
+		http.Error(w, err.Error(), statusFor(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	err = json.NewEncoder(w).Encode(capacity)
+	if err != nil {
+		h.logger.Error("failed-to-write-capacity", err)
+	}
+}
+
+func (h *handler) reportPoolUtilization(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	err := json.NewEncoder(w).Encode(h.pools.PoolUtilization())
+	if err != nil {
+		h.logger.Error("failed-to-write-pool-utilization", err)
+	}
+}
+
+func (h *handler) destroyContainers(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	r.ParseForm()
+
+	filter := api.Properties{}
+	for _, property := range r.Form["property"] {
+		segs := strings.SplitN(property, ":", 2)
+		if len(segs) != 2 {
+			http.Error(w, "malformed property: "+property, http.StatusBadRequest)
+			return
+		}
+
+		filter[segs[0]] = segs[1]
+	}
+
+	parallelism := DefaultDestroyParallelism
+	if r.FormValue("parallelism") != "" {
+		n, err := strconv.ParseUint(r.FormValue("parallelism"), 10, 32)
+		if err != nil || n == 0 {
+			http.Error(w, "malformed parallelism: "+r.FormValue("parallelism"), http.StatusBadRequest)
+			return
+		}
+
+		parallelism = int(n)
+	}
+
+	containers, err := h.destroyer.Containers(filter)
+	if err != nil {
+		h.logger.Error("failed-to-list-containers", err)
+		http.Error(w, err.Error(), statusFor(err))
+		return
+	}
+
+	dLog := h.logger.Session("destroy-containers", lager.Data{
+		"filter":      filter,
+		"total":       len(containers),
+		"parallelism": parallelism,
+	})
+
+	dLog.Info("started")
+
+	handles := make(chan string)
+	go func() {
+		for _, container := range containers {
+			handles <- container.Handle()
+		}
+
+		close(handles)
+	}()
+
+	progress := make(chan DestroyProgress)
+
+	wg := new(sync.WaitGroup)
+	for i := 0; i < parallelism; i++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			for handle := range handles {
+				p := DestroyProgress{Handle: handle}
+
+				err := h.destroyer.Destroy(handle)
+				if err != nil {
+					dLog.Error("failed-to-destroy", err, lager.Data{"handle": handle})
+					p.Error = err.Error()
+				}
+
+				progress <- p
+			}
+		}()
+	}
+
+	go func() {
+		wg.Wait()
+		close(progress)
+	}()
+
+	w.Header().Set("Content-Type", "application/json")
+
+	flusher, _ := w.(http.Flusher)
+	encoder := json.NewEncoder(w)
+
+	done := 0
+	for p := range progress {
+		done++
+
+		p.Done = done
+		p.Total = len(containers)
+
+		// keep going if the operator goes away; the containers are destroyed
+		// either way
+		encoder.Encode(p)
+
+		if flusher != nil {
+			flusher.Flush()
+		}
+	}
+
+	dLog.Info("finished")
+}
+
+func (h *handler) reservePort(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var port uint64
+	if r.FormValue("port") != "" {
+		var err error
+
+		port, err = strconv.ParseUint(r.FormValue("port"), 10, 32)
+		if err != nil {
+			http.Error(w, "malformed port: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	reserved, err := h.ports.ReservePort(uint32(port))
+	if err != nil {
+		h.logger.Error("failed-to-reserve-port", err, lager.Data{"port": port})
+		http.Error(w, err.Error(), statusFor(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	err = json.NewEncoder(w).Encode(PortReservation{Port: reserved})
+	if err != nil {
+		h.logger.Error("failed-to-write-port-reservation", err, lager.Data{"port": reserved})
+	}
+}
+
+func (h *handler) releasePort(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	port, err := strconv.ParseUint(r.FormValue("port"), 10, 32)
+	if err != nil {
+		http.Error(w, "malformed port: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	err = h.ports.ReleasePort(uint32(port))
+	if err != nil {
+		h.logger.Error("failed-to-release-port", err, lager.Data{"port": port})
+		http.Error(w, err.Error(), statusFor(err))
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *handler) addNetOutRule(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	r.ParseForm()
+
+	handle := r.FormValue("handle")
+
+	spec := NetOutRuleSpec{
+		Protocol: r.FormValue("protocol"),
+		Networks: r.Form["network"],
+		Ports:    r.Form["port"],
+		Log:      r.FormValue("log") == "true",
+	}
+
+	if r.FormValue("icmp_type") != "" {
+		icmpType, err := strconv.ParseUint(r.FormValue("icmp_type"), 10, 8)
+		if err != nil {
+			http.Error(w, "malformed icmp_type: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		t := uint8(icmpType)
+		spec.ICMPType = &t
+	}
+
+	if r.FormValue("icmp_code") != "" {
+		icmpCode, err := strconv.ParseUint(r.FormValue("icmp_code"), 10, 8)
+		if err != nil {
+			http.Error(w, "malformed icmp_code: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		c := uint8(icmpCode)
+		spec.ICMPCode = &c
+	}
+
+	rule, err := spec.rule()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	err = h.netOuts.AddNetOutRule(handle, rule)
+	if err != nil {
+		h.logger.Error("failed-to-add-net-out-rule", err, lager.Data{"handle": handle})
+		http.Error(w, err.Error(), statusFor(err))
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *handler) bulkNetOut(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	handle := r.FormValue("handle")
+
+	var specs []NetOutRuleSpec
+
+	err := json.NewDecoder(r.Body).Decode(&specs)
+	if err != nil {
+		http.Error(w, "malformed rules: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	rules := make([]linux_backend.NetOutRule, len(specs))
+	for i, spec := range specs {
+		rules[i], err = spec.rule()
+		if err != nil {
+			http.Error(w, fmt.Sprintf("rule %d: %s", i, err), http.StatusBadRequest)
+			return
+		}
+	}
+
+	err = h.netOuts.BulkNetOut(handle, rules)
+	if err != nil {
+		h.logger.Error("failed-to-apply-net-out-rules", err, lager.Data{
+			"handle": handle,
+			"rules":  len(rules),
+		})
+
+		http.Error(w, err.Error(), statusFor(err))
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// rule parses the spec; it may still be invalid, e.g. with ports for icmp.
+func (spec NetOutRuleSpec) rule() (linux_backend.NetOutRule, error) {
+	rule := linux_backend.NetOutRule{
+		Protocol: linux_backend.ProtocolAll,
+		Log:      spec.Log,
+	}
+
+	if spec.Protocol != "" {
+		protocol, err := linux_backend.ParseProtocol(spec.Protocol)
+		if err != nil {
+			return linux_backend.NetOutRule{}, err
+		}
+
+		rule.Protocol = protocol
+	}
+
+	for _, network := range spec.Networks {
+		ipRange, err := linux_backend.ParseIPRange(network)
+		if err != nil {
+			return linux_backend.NetOutRule{}, err
+		}
+
+		rule.Networks = append(rule.Networks, ipRange)
+	}
+
+	for _, port := range spec.Ports {
+		portRange, err := linux_backend.ParsePortRange(port)
+		if err != nil {
+			return linux_backend.NetOutRule{}, err
+		}
+
+		rule.Ports = append(rule.Ports, portRange)
+	}
+
+	if spec.ICMPType != nil {
+		rule.ICMPs = &linux_backend.ICMPControl{Type: linux_backend.ICMPType(*spec.ICMPType)}
+
+		if spec.ICMPCode != nil {
+			code := linux_backend.ICMPCode(*spec.ICMPCode)
+			rule.ICMPs.Code = &code
+		}
+	} else if spec.ICMPCode != nil {
+		return linux_backend.NetOutRule{}, errors.New("icmp_code requires icmp_type")
+	}
+
+	return rule, nil
+}
+
+func (h *handler) netIn(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	handle := r.FormValue("handle")
+
+	protocol, err := netInProtocol(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	ports, err := netInPorts(r, "host_port", "container_port")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	hostPort, containerPort, err := h.netIns.NetInProtocol(
+		handle,
+		protocol,
+		uint32(ports["host_port"]),
+		uint32(ports["container_port"]),
+	)
+	if err != nil {
+		h.logger.Error("failed-to-map-net-in", err, lager.Data{"handle": handle})
+		http.Error(w, err.Error(), statusFor(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	err = json.NewEncoder(w).Encode(NetInMapped{
+		HostPort:      hostPort,
+		ContainerPort: containerPort,
+	})
+	if err != nil {
+		h.logger.Error("failed-to-write-net-in", err, lager.Data{"handle": handle})
+	}
+}
+
+func (h *handler) netInRange(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	handle := r.FormValue("handle")
+
+	protocol, err := netInProtocol(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	ports, err := netInPorts(r, "host_port_start", "container_port_start", "count")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if ports["count"] == 0 {
+		http.Error(w, "count is required", http.StatusBadRequest)
+		return
+	}
+
+	spec, err := h.netInRanges.NetInRange(
+		handle,
+		protocol,
+		uint32(ports["host_port_start"]),
+		uint32(ports["container_port_start"]),
+		uint32(ports["count"]),
+	)
+	if err != nil {
+		h.logger.Error("failed-to-map-net-in-range", err, lager.Data{"handle": handle})
+		http.Error(w, err.Error(), statusFor(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	err = json.NewEncoder(w).Encode(NetInRangeMapped{
+		HostPortStart:      spec.HostPort,
+		ContainerPortStart: spec.ContainerPort,
+		Count:              spec.Count,
+	})
+	if err != nil {
+		h.logger.Error("failed-to-write-net-in-range", err, lager.Data{"handle": handle})
+	}
+}
+
+func (h *handler) startCapture(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	handle := r.FormValue("handle")
+
+	limits := linux_backend.CaptureLimits{}
+
+	if r.FormValue("duration") != "" {
+		duration, err := time.ParseDuration(r.FormValue("duration"))
+		if err != nil {
+			http.Error(w, "malformed duration: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		limits.Duration = duration
+	}
+
+	if r.FormValue("packets") != "" {
+		packets, err := strconv.ParseUint(r.FormValue("packets"), 10, 64)
+		if err != nil {
+			http.Error(w, "malformed packets: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		limits.Packets = packets
+	}
+
+	if r.FormValue("snap_length") != "" {
+		snapLength, err := strconv.ParseUint(r.FormValue("snap_length"), 10, 32)
+		if err != nil {
+			http.Error(w, "malformed snap_length: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		limits.SnapLength = uint32(snapLength)
+	}
+
+	capturePath, err := h.capturer.StartCapture(handle, limits)
+	if err != nil {
+		h.logger.Error("failed-to-start-capture", err, lager.Data{"handle": handle})
+		http.Error(w, err.Error(), statusFor(err))
+		return
+	}
+
+	h.logger.Info("started-capture", lager.Data{"handle": handle, "capture": capturePath})
+
+	w.Header().Set("Content-Type", "application/json")
+
+	err = json.NewEncoder(w).Encode(CaptureStarted{Path: capturePath})
+	if err != nil {
+		h.logger.Error("failed-to-write-capture", err, lager.Data{"handle": handle})
+	}
+}
+
+func (h *handler) stopCapture(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	handle := r.FormValue("handle")
+
+	err := h.capturer.StopCapture(handle)
+	if err != nil {
+		h.logger.Error("failed-to-stop-capture", err, lager.Data{"handle": handle})
+		http.Error(w, err.Error(), statusFor(err))
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// netInProtocol returns the protocol parameter, tcp if it is not given.
+func netInProtocol(r *http.Request) (linux_backend.Protocol, error) {
+	if r.FormValue("protocol") == "" {
+		return linux_backend.ProtocolTCP, nil
+	}
+
+	return linux_backend.ParseProtocol(r.FormValue("protocol"))
+}
+
+// netInPorts returns the given port parameters, leaving out those not given.
+func netInPorts(r *http.Request, params ...string) (map[string]uint64, error) {
+	ports := map[string]uint64{}
+	for _, param := range params {
+		if r.FormValue(param) == "" {
+			continue
+		}
+
+		port, err := strconv.ParseUint(r.FormValue(param), 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("malformed %s: %s", param, err)
+		}
+
+		ports[param] = port
+	}
+
+	return ports, nil
+}
+
+func statusFor(err error) int {
+	switch err.(type) {
+	case linux_backend.UnknownHandleError, linux_backend.UnreservedPortError, linux_backend.NoCaptureError:
+		return http.StatusNotFound
+	case port_pool.PortTakenError, linux_backend.CaptureInProgressError:
+		return http.StatusConflict
+	case port_pool.CannotShrinkError, network_pool.CannotShrinkError,
+		linux_backend.CaptureLimitsExceededError, linux_backend.InvalidNetOutRuleError,
+		linux_backend.InvalidNetInRangeError, linux_backend.UnsupportedNetInProtocolError:
+		return http.StatusBadRequest
+	case linux_backend.LinksNotOwnedError:
+		return http.StatusNotImplemented
+	default:
+		return http.StatusInternalServerError
+	}
+}
@@ -0,0 +1,1113 @@
+package admin_test
+
+import (
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cloudfoundry-incubator/garden/api"
+	"github.com/cloudfoundry-incubator/garden/api/fakes"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/pivotal-golang/lager/lagertest"
+
+	"github.com/cloudfoundry-incubator/garden-linux/old/admin"
+	"github.com/cloudfoundry-incubator/garden-linux/old/linux_backend"
+	"github.com/cloudfoundry-incubator/garden-linux/old/linux_backend/port_pool"
+)
+
+type fakeBackend struct {
+	grownPortPool    uint32
+	grownNetworkPool *net.IPNet
+
+	growError error
+
+	usage      []linux_backend.UsageSample
+	usageError error
+
+	capabilities linux_backend.Capabilities
+
+	capacity      linux_backend.CommittedCapacity
+	capacityError error
+
+	poolUtilization []linux_backend.PoolUtilization
+
+	containers      []api.Container
+	containersError error
+	listedFilter    api.Properties
+
+	destroyErrors map[string]error
+	destroyDelay  time.Duration
+
+	destroyMutex  sync.Mutex
+	destroyed     []string
+	destroying    int
+	maxDestroying int
+
+	reservedPort uint32
+	reserveError error
+	releasedPort uint32
+	releaseError error
+
+	netOutRules      []linux_backend.NetOutRule
+	addNetOutRuleErr error
+	bulkNetOutErr    error
+
+	netIns   []linux_backend.NetInSpec
+	netInErr error
+
+	netInRanges   []linux_backend.NetInSpec
+	netInRangeErr error
+
+	captureLimits     *linux_backend.CaptureLimits
+	startCaptureError error
+	captureStopped    string
+	stopCaptureError  error
+}
+
+func (b *fakeBackend) AddNetOutRule(handle string, rule linux_backend.NetOutRule) error {
+	if b.addNetOutRuleErr != nil {
+		return b.addNetOutRuleErr
+	}
+
+	b.netOutRules = append(b.netOutRules, rule)
+
+	return nil
+}
+
+func (b *fakeBackend) BulkNetOut(handle string, rules []linux_backend.NetOutRule) error {
+	if b.bulkNetOutErr != nil {
+		return b.bulkNetOutErr
+	}
+
+	b.netOutRules = append(b.netOutRules, rules...)
+
+	return nil
+}
+
+func (b *fakeBackend) NetInProtocol(handle string, protocol linux_backend.Protocol, hostPort uint32, containerPort uint32) (uint32, uint32, error) {
+	if b.netInErr != nil {
+		return 0, 0, b.netInErr
+	}
+
+	b.netIns = append(b.netIns, linux_backend.NetInSpec{
+		HostPort:      hostPort,
+		ContainerPort: containerPort,
+		Protocol:      protocol,
+	})
+
+	if hostPort == 0 {
+		hostPort = 61000
+	}
+
+	if containerPort == 0 {
+		containerPort = hostPort
+	}
+
+	return hostPort, containerPort, nil
+}
+
+func (b *fakeBackend) NetInRange(handle string, protocol linux_backend.Protocol, hostPortStart uint32, containerPortStart uint32, count uint32) (linux_backend.NetInSpec, error) {
+	if b.netInRangeErr != nil {
+		return linux_backend.NetInSpec{}, b.netInRangeErr
+	}
+
+	spec := linux_backend.NetInSpec{
+		HostPort:      hostPortStart,
+		ContainerPort: containerPortStart,
+		Protocol:      protocol,
+		Count:         count,
+	}
+
+	b.netInRanges = append(b.netInRanges, spec)
+
+	if spec.HostPort == 0 {
+		spec.HostPort = 61000
+	}
+
+	if spec.ContainerPort == 0 {
+		spec.ContainerPort = spec.HostPort
+	}
+
+	return spec, nil
+}
+
+func (b *fakeBackend) StartCapture(handle string, limits linux_backend.CaptureLimits) (string, error) {
+	if b.startCaptureError != nil {
+		return "", b.startCaptureError
+	}
+
+	b.captureLimits = &limits
+
+	return "/var/garden/captures/some.pcap", nil
+}
+
+func (b *fakeBackend) StopCapture(handle string) error {
+	if b.stopCaptureError != nil {
+		return b.stopCaptureError
+	}
+
+	b.captureStopped = handle
+
+	return nil
+}
+
+func (b *fakeBackend) ReservePort(port uint32) (uint32, error) {
+	if b.reserveError != nil {
+		return 0, b.reserveError
+	}
+
+	if port == 0 {
+		port = 61001
+	}
+
+	b.reservedPort = port
+
+	return port, nil
+}
+
+func (b *fakeBackend) ReleasePort(port uint32) error {
+	b.releasedPort = port
+	return b.releaseError
+}
+
+func (b *fakeBackend) Containers(filter api.Properties) ([]api.Container, error) {
+	b.listedFilter = filter
+	return b.containers, b.containersError
+}
+
+func (b *fakeBackend) Destroy(handle string) error {
+	b.destroyMutex.Lock()
+	b.destroying++
+	if b.destroying > b.maxDestroying {
+		b.maxDestroying = b.destroying
+	}
+	b.destroyMutex.Unlock()
+
+	time.Sleep(b.destroyDelay)
+
+	b.destroyMutex.Lock()
+	defer b.destroyMutex.Unlock()
+
+	b.destroying--
+	b.destroyed = append(b.destroyed, handle)
+
+	return b.destroyErrors[handle]
+}
+
+func (b *fakeBackend) CommittedCapacity() (linux_backend.CommittedCapacity, error) {
+	return b.capacity, b.capacityError
+}
+
+func (b *fakeBackend) Capabilities() linux_backend.Capabilities {
+	return b.capabilities
+}
+
+func (b *fakeBackend) PoolUtilization() []linux_backend.PoolUtilization {
+	return b.poolUtilization
+}
+
+func (b *fakeBackend) GrowPortPool(size uint32) error {
+	b.grownPortPool = size
+	return b.growError
+}
+
+func (b *fakeBackend) GrowNetworkPool(ipNet *net.IPNet) error {
+	b.grownNetworkPool = ipNet
+	return b.growError
+}
+
+func (b *fakeBackend) UsageHistory(handle string) ([]linux_backend.UsageSample, error) {
+	if handle != "some-handle" {
+		return nil, linux_backend.UnknownHandleError{Handle: handle}
+	}
+
+	return b.usage, b.usageError
+}
+
+var _ = Describe("Admin handler", func() {
+	var backend *fakeBackend
+	var handler http.Handler
+
+	request := func(method, url string) *httptest.ResponseRecorder {
+		req, err := http.NewRequest(method, url, nil)
+		Ω(err).ShouldNot(HaveOccurred())
+
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, req)
+
+		return recorder
+	}
+
+	requestWithBody := func(method, url string, body string) *httptest.ResponseRecorder {
+		req, err := http.NewRequest(method, url, strings.NewReader(body))
+		Ω(err).ShouldNot(HaveOccurred())
+
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, req)
+
+		return recorder
+	}
+
+	BeforeEach(func() {
+		backend = &fakeBackend{}
+		handler = admin.NewHandler(backend, lagertest.NewTestLogger("test"))
+	})
+
+	Describe("POST /pools/port", func() {
+		It("grows the port pool", func() {
+			response := request("POST", "/pools/port?size=6000")
+			Ω(response.Code).Should(Equal(http.StatusNoContent))
+
+			Ω(backend.grownPortPool).Should(Equal(uint32(6000)))
+		})
+
+		Context("when the size is malformed", func() {
+			It("responds with 400", func() {
+				response := request("POST", "/pools/port?size=lots")
+				Ω(response.Code).Should(Equal(http.StatusBadRequest))
+
+				Ω(backend.grownPortPool).Should(BeZero())
+			})
+		})
+
+		Context("when the pool would shrink", func() {
+			BeforeEach(func() {
+				backend.growError = port_pool.CannotShrinkError{Size: 5000, NewSize: 10}
+			})
+
+			It("responds with 400", func() {
+				response := request("POST", "/pools/port?size=10")
+				Ω(response.Code).Should(Equal(http.StatusBadRequest))
+				Ω(response.Body.String()).Should(ContainSubstring("cannot shrink"))
+			})
+		})
+
+		Context("when not a POST", func() {
+			It("responds with 405", func() {
+				response := request("GET", "/pools/port?size=6000")
+				Ω(response.Code).Should(Equal(http.StatusMethodNotAllowed))
+
+				Ω(backend.grownPortPool).Should(BeZero())
+			})
+		})
+	})
+
+	Describe("POST /pools/network", func() {
+		It("grows the network pool", func() {
+			response := request("POST", "/pools/network?network=10.254.0.0/21")
+			Ω(response.Code).Should(Equal(http.StatusNoContent))
+
+			Ω(backend.grownNetworkPool.String()).Should(Equal("10.254.0.0/21"))
+		})
+
+		Context("when the network is malformed", func() {
+			It("responds with 400", func() {
+				response := request("POST", "/pools/network?network=10.254.0.0")
+				Ω(response.Code).Should(Equal(http.StatusBadRequest))
+
+				Ω(backend.grownNetworkPool).Should(BeNil())
+			})
+		})
+
+		Context("when growing fails", func() {
+			BeforeEach(func() {
+				backend.growError = errors.New("oh no!")
+			})
+
+			It("responds with 500", func() {
+				response := request("POST", "/pools/network?network=10.254.0.0/21")
+				Ω(response.Code).Should(Equal(http.StatusInternalServerError))
+			})
+		})
+	})
+	Describe("GET /containers/usage", func() {
+		It("responds with the container's usage history as JSON", func() {
+			sampledAt := time.Unix(1234567890, 0).UTC()
+
+			backend.usage = []linux_backend.UsageSample{
+				{
+					Time:   sampledAt,
+					Memory: api.ContainerMemoryStat{Rss: 1024},
+					CPU:    api.ContainerCPUStat{Usage: 42},
+				},
+			}
+
+			response := request("GET", "/containers/usage?handle=some-handle")
+			Ω(response.Code).Should(Equal(http.StatusOK))
+			Ω(response.Header().Get("Content-Type")).Should(Equal("application/json"))
+
+			var samples []linux_backend.UsageSample
+			err := json.NewDecoder(response.Body).Decode(&samples)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(samples).Should(HaveLen(1))
+			Ω(samples[0].Time.Equal(sampledAt)).Should(BeTrue())
+			Ω(samples[0].Memory.Rss).Should(Equal(uint64(1024)))
+			Ω(samples[0].CPU.Usage).Should(Equal(uint64(42)))
+		})
+
+		Context("when the handle is unknown", func() {
+			It("responds with 404", func() {
+				response := request("GET", "/containers/usage?handle=bogus")
+				Ω(response.Code).Should(Equal(http.StatusNotFound))
+			})
+		})
+
+		Context("when not a GET", func() {
+			It("responds with 405", func() {
+				response := request("POST", "/containers/usage?handle=some-handle")
+				Ω(response.Code).Should(Equal(http.StatusMethodNotAllowed))
+			})
+		})
+	})
+	Describe("GET /capabilities", func() {
+		It("responds with the host's capabilities as JSON", func() {
+			backend.capabilities = linux_backend.Capabilities{SwapAccounting: true}
+
+			response := request("GET", "/capabilities")
+			Ω(response.Code).Should(Equal(http.StatusOK))
+			Ω(response.Body.String()).Should(MatchJSON(`{"SwapAccounting":true}`))
+		})
+	})
+
+	Describe("GET /capacity", func() {
+		It("responds with the host's capacity and how much of it is committed as JSON", func() {
+			backend.capacity = linux_backend.CommittedCapacity{
+				Capacity: api.Capacity{
+					MemoryInBytes: 1024,
+					DiskInBytes:   2048,
+					MaxContainers: 10,
+				},
+				CommittedMemoryInBytes: 512,
+				CommittedDiskInBytes:   256,
+				Containers:             2,
+			}
+
+			response := request("GET", "/capacity")
+			Ω(response.Code).Should(Equal(http.StatusOK))
+			Ω(response.Body.String()).Should(MatchJSON(`{
+				"MemoryInBytes": 1024,
+				"DiskInBytes": 2048,
+				"MaxContainers": 10,
+				"CommittedMemoryInBytes": 512,
+				"CommittedDiskInBytes": 256,
+				"Containers": 2
+			}`))
+		})
+
+		Context("when getting the capacity fails", func() {
+			BeforeEach(func() {
+				backend.capacityError = errors.New("oh no!")
+			})
+
+			It("responds with an internal server error", func() {
+				response := request("GET", "/capacity")
+				Ω(response.Code).Should(Equal(http.StatusInternalServerError))
+			})
+		})
+
+		It("rejects other methods", func() {
+			response := request("POST", "/capacity")
+			Ω(response.Code).Should(Equal(http.StatusMethodNotAllowed))
+		})
+	})
+
+	Describe("GET /pools", func() {
+		It("responds with how much of each pool is free as JSON", func() {
+			backend.poolUtilization = []linux_backend.PoolUtilization{
+				{Pool: "uid", Free: 200, Total: 256},
+				{Pool: "network", Free: 10, Total: 1024},
+			}
+
+			response := request("GET", "/pools")
+			Ω(response.Code).Should(Equal(http.StatusOK))
+			Ω(response.Body.String()).Should(MatchJSON(`[
+				{"Pool": "uid", "Free": 200, "Total": 256},
+				{"Pool": "network", "Free": 10, "Total": 1024}
+			]`))
+		})
+
+		It("rejects other methods", func() {
+			response := request("POST", "/pools")
+			Ω(response.Code).Should(Equal(http.StatusMethodNotAllowed))
+		})
+	})
+
+	Describe("POST /containers/destroy", func() {
+		containerWithHandle := func(handle string) api.Container {
+			container := new(fakes.FakeContainer)
+			container.HandleReturns(handle)
+			return container
+		}
+
+		progressIn := func(response *httptest.ResponseRecorder) []admin.DestroyProgress {
+			progress := []admin.DestroyProgress{}
+
+			decoder := json.NewDecoder(strings.NewReader(response.Body.String()))
+			for decoder.More() {
+				var p admin.DestroyProgress
+
+				err := decoder.Decode(&p)
+				Ω(err).ShouldNot(HaveOccurred())
+
+				progress = append(progress, p)
+			}
+
+			return progress
+		}
+
+		BeforeEach(func() {
+			backend.containers = []api.Container{
+				containerWithHandle("handle-a"),
+				containerWithHandle("handle-b"),
+				containerWithHandle("handle-c"),
+			}
+		})
+
+		It("destroys every container, reporting progress as lines of JSON", func() {
+			response := request("POST", "/containers/destroy")
+			Ω(response.Code).Should(Equal(http.StatusOK))
+
+			Ω(backend.listedFilter).Should(BeEmpty())
+			Ω(backend.destroyed).Should(ConsistOf("handle-a", "handle-b", "handle-c"))
+
+			progress := progressIn(response)
+			Ω(progress).Should(HaveLen(3))
+
+			handles := []string{}
+			for i, p := range progress {
+				Ω(p.Done).Should(Equal(i + 1))
+				Ω(p.Total).Should(Equal(3))
+				Ω(p.Error).Should(BeEmpty())
+
+				handles = append(handles, p.Handle)
+			}
+
+			Ω(handles).Should(ConsistOf("handle-a", "handle-b", "handle-c"))
+		})
+
+		It("destroys only the containers with the given properties", func() {
+			response := request("POST", "/containers/destroy?property=owner:some-owner&property=purpose:a:b")
+			Ω(response.Code).Should(Equal(http.StatusOK))
+
+			Ω(backend.listedFilter).Should(Equal(api.Properties{
+				"owner":   "some-owner",
+				"purpose": "a:b",
+			}))
+		})
+
+		It("destroys a bounded number of containers at once", func() {
+			backend.destroyDelay = 50 * time.Millisecond
+
+			response := request("POST", "/containers/destroy?parallelism=2")
+			Ω(response.Code).Should(Equal(http.StatusOK))
+
+			Ω(backend.destroyed).Should(HaveLen(3))
+			Ω(backend.maxDestroying).Should(Equal(2))
+		})
+
+		Context("when destroying a container fails", func() {
+			BeforeEach(func() {
+				backend.destroyErrors = map[string]error{
+					"handle-b": errors.New("oh no!"),
+				}
+			})
+
+			It("reports the error and carries on", func() {
+				response := request("POST", "/containers/destroy")
+				Ω(response.Code).Should(Equal(http.StatusOK))
+
+				Ω(backend.destroyed).Should(HaveLen(3))
+
+				errs := map[string]string{}
+				for _, p := range progressIn(response) {
+					errs[p.Handle] = p.Error
+				}
+
+				Ω(errs).Should(Equal(map[string]string{
+					"handle-a": "",
+					"handle-b": "oh no!",
+					"handle-c": "",
+				}))
+			})
+		})
+
+		Context("when a property is malformed", func() {
+			It("responds with 400 without destroying anything", func() {
+				response := request("POST", "/containers/destroy?property=owner")
+				Ω(response.Code).Should(Equal(http.StatusBadRequest))
+
+				Ω(backend.destroyed).Should(BeEmpty())
+			})
+		})
+
+		Context("when the parallelism is malformed", func() {
+			It("responds with 400 without destroying anything", func() {
+				response := request("POST", "/containers/destroy?parallelism=0")
+				Ω(response.Code).Should(Equal(http.StatusBadRequest))
+
+				Ω(backend.destroyed).Should(BeEmpty())
+			})
+		})
+
+		Context("when listing the containers fails", func() {
+			BeforeEach(func() {
+				backend.containersError = errors.New("oh no!")
+			})
+
+			It("responds with an internal server error", func() {
+				response := request("POST", "/containers/destroy")
+				Ω(response.Code).Should(Equal(http.StatusInternalServerError))
+			})
+		})
+
+		It("rejects other methods", func() {
+			response := request("GET", "/containers/destroy")
+			Ω(response.Code).Should(Equal(http.StatusMethodNotAllowed))
+		})
+	})
+
+	Describe("POST /ports/reserve", func() {
+		It("reserves the port", func() {
+			response := request("POST", "/ports/reserve?port=61005")
+			Ω(response.Code).Should(Equal(http.StatusOK))
+
+			var reservation admin.PortReservation
+			err := json.NewDecoder(response.Body).Decode(&reservation)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(reservation).Should(Equal(admin.PortReservation{Port: 61005}))
+			Ω(backend.reservedPort).Should(Equal(uint32(61005)))
+		})
+
+		Context("when no port is given", func() {
+			It("reserves any port, and returns it", func() {
+				response := request("POST", "/ports/reserve")
+				Ω(response.Code).Should(Equal(http.StatusOK))
+
+				var reservation admin.PortReservation
+				err := json.NewDecoder(response.Body).Decode(&reservation)
+				Ω(err).ShouldNot(HaveOccurred())
+
+				Ω(reservation).Should(Equal(admin.PortReservation{Port: 61001}))
+			})
+		})
+
+		Context("when the port is malformed", func() {
+			It("responds with 400", func() {
+				response := request("POST", "/ports/reserve?port=http")
+				Ω(response.Code).Should(Equal(http.StatusBadRequest))
+
+				Ω(backend.reservedPort).Should(BeZero())
+			})
+		})
+
+		Context("when the port is taken", func() {
+			BeforeEach(func() {
+				backend.reserveError = port_pool.PortTakenError{Port: 61005}
+			})
+
+			It("responds with 409", func() {
+				response := request("POST", "/ports/reserve?port=61005")
+				Ω(response.Code).Should(Equal(http.StatusConflict))
+				Ω(response.Body.String()).Should(ContainSubstring("already acquired"))
+			})
+		})
+
+		Context("when not a POST", func() {
+			It("responds with 405", func() {
+				response := request("GET", "/ports/reserve?port=61005")
+				Ω(response.Code).Should(Equal(http.StatusMethodNotAllowed))
+
+				Ω(backend.reservedPort).Should(BeZero())
+			})
+		})
+	})
+
+	Describe("POST /ports/release", func() {
+		It("releases the port", func() {
+			response := request("POST", "/ports/release?port=61005")
+			Ω(response.Code).Should(Equal(http.StatusNoContent))
+
+			Ω(backend.releasedPort).Should(Equal(uint32(61005)))
+		})
+
+		Context("when the port is malformed", func() {
+			It("responds with 400", func() {
+				response := request("POST", "/ports/release")
+				Ω(response.Code).Should(Equal(http.StatusBadRequest))
+
+				Ω(backend.releasedPort).Should(BeZero())
+			})
+		})
+
+		Context("when the port is not reserved", func() {
+			BeforeEach(func() {
+				backend.releaseError = linux_backend.UnreservedPortError{Port: 61005}
+			})
+
+			It("responds with 404", func() {
+				response := request("POST", "/ports/release?port=61005")
+				Ω(response.Code).Should(Equal(http.StatusNotFound))
+			})
+		})
+	})
+
+	Describe("POST /containers/net_out", func() {
+		It("adds the rule to the container", func() {
+			response := request("POST", "/containers/net_out?handle=some-handle&protocol=udp&network=10.0.0.0/8&network=192.168.0.1-192.168.0.9&port=53&port=8000-9000&log=true")
+			Ω(response.Code).Should(Equal(http.StatusNoContent))
+
+			Ω(backend.netOutRules).Should(HaveLen(1))
+
+			rule := backend.netOutRules[0]
+			Ω(rule.Protocol).Should(Equal(linux_backend.ProtocolUDP))
+			Ω(rule.Log).Should(BeTrue())
+
+			Ω(rule.Networks).Should(HaveLen(2))
+			Ω(rule.Networks[0].String()).Should(Equal("10.0.0.0-10.255.255.255"))
+			Ω(rule.Networks[1].String()).Should(Equal("192.168.0.1-192.168.0.9"))
+
+			Ω(rule.Ports).Should(Equal([]linux_backend.PortRange{
+				{Start: 53, End: 53},
+				{Start: 8000, End: 9000},
+			}))
+		})
+
+		Context("when an icmp type and code are given", func() {
+			It("allows only those icmp messages", func() {
+				response := request("POST", "/containers/net_out?handle=some-handle&protocol=icmp&icmp_type=3&icmp_code=4")
+				Ω(response.Code).Should(Equal(http.StatusNoContent))
+
+				code := linux_backend.ICMPCode(4)
+				Ω(backend.netOutRules).Should(Equal([]linux_backend.NetOutRule{
+					{
+						Protocol: linux_backend.ProtocolICMP,
+						ICMPs:    &linux_backend.ICMPControl{Type: 3, Code: &code},
+					},
+				}))
+			})
+
+			Context("when only the type is given", func() {
+				It("allows every code of that type", func() {
+					response := request("POST", "/containers/net_out?handle=some-handle&protocol=icmp&icmp_type=8")
+					Ω(response.Code).Should(Equal(http.StatusNoContent))
+
+					Ω(backend.netOutRules[0].ICMPs).Should(Equal(&linux_backend.ICMPControl{Type: 8}))
+				})
+			})
+		})
+
+		Context("when no protocol is given", func() {
+			It("allows all protocols", func() {
+				response := request("POST", "/containers/net_out?handle=some-handle&network=10.0.0.1")
+				Ω(response.Code).Should(Equal(http.StatusNoContent))
+
+				Ω(backend.netOutRules[0].Protocol).Should(Equal(linux_backend.ProtocolAll))
+			})
+		})
+
+		Context("when the rule is malformed", func() {
+			It("responds with 400", func() {
+				for _, query := range []string{
+					"protocol=sctp",
+					"network=bogus",
+					"port=8000-",
+					"protocol=icmp&icmp_type=256",
+					"protocol=icmp&icmp_type=8&icmp_code=x",
+					"protocol=icmp&icmp_code=0",
+				} {
+					response := request("POST", "/containers/net_out?handle=some-handle&"+query)
+					Ω(response.Code).Should(Equal(http.StatusBadRequest))
+				}
+
+				Ω(backend.netOutRules).Should(BeEmpty())
+			})
+		})
+
+		Context("when the rule is invalid", func() {
+			BeforeEach(func() {
+				backend.addNetOutRuleErr = linux_backend.InvalidNetOutRuleError{Reason: "ports may only be given for tcp or udp"}
+			})
+
+			It("responds with 400", func() {
+				response := request("POST", "/containers/net_out?handle=some-handle&port=80")
+				Ω(response.Code).Should(Equal(http.StatusBadRequest))
+				Ω(response.Body.String()).Should(ContainSubstring("ports may only be given for tcp or udp"))
+			})
+		})
+
+		Context("when the container's links are built by the network plugin", func() {
+			BeforeEach(func() {
+				backend.addNetOutRuleErr = linux_backend.LinksNotOwnedError{Operation: "net out"}
+			})
+
+			It("responds with 501", func() {
+				response := request("POST", "/containers/net_out?handle=some-handle&network=10.0.0.1")
+				Ω(response.Code).Should(Equal(http.StatusNotImplemented))
+			})
+		})
+
+		Context("when the handle is unknown", func() {
+			BeforeEach(func() {
+				backend.addNetOutRuleErr = linux_backend.UnknownHandleError{Handle: "bogus"}
+			})
+
+			It("responds with 404", func() {
+				response := request("POST", "/containers/net_out?handle=bogus&network=10.0.0.1")
+				Ω(response.Code).Should(Equal(http.StatusNotFound))
+			})
+		})
+
+		Context("when not a POST", func() {
+			It("responds with 405", func() {
+				response := request("GET", "/containers/net_out?handle=some-handle&network=10.0.0.1")
+				Ω(response.Code).Should(Equal(http.StatusMethodNotAllowed))
+			})
+		})
+	})
+
+	Describe("POST /containers/net_out/bulk", func() {
+		It("applies the rules to the container at once", func() {
+			response := requestWithBody("POST", "/containers/net_out/bulk?handle=some-handle", `[
+				{"Protocol": "udp", "Networks": ["10.0.0.0/8"], "Ports": ["53"], "Log": true},
+				{"Protocol": "icmp", "ICMPType": 8},
+				{"Networks": ["192.168.0.1-192.168.0.9"]}
+			]`)
+			Ω(response.Code).Should(Equal(http.StatusNoContent))
+
+			Ω(backend.netOutRules).Should(HaveLen(3))
+
+			Ω(backend.netOutRules[0].Protocol).Should(Equal(linux_backend.ProtocolUDP))
+			Ω(backend.netOutRules[0].Networks[0].String()).Should(Equal("10.0.0.0-10.255.255.255"))
+			Ω(backend.netOutRules[0].Ports).Should(Equal([]linux_backend.PortRange{{Start: 53, End: 53}}))
+			Ω(backend.netOutRules[0].Log).Should(BeTrue())
+
+			Ω(backend.netOutRules[1]).Should(Equal(linux_backend.NetOutRule{
+				Protocol: linux_backend.ProtocolICMP,
+				ICMPs:    &linux_backend.ICMPControl{Type: 8},
+			}))
+
+			Ω(backend.netOutRules[2].Protocol).Should(Equal(linux_backend.ProtocolAll))
+		})
+
+		Context("when any rule is malformed", func() {
+			It("responds with 400, applying none of them", func() {
+				for _, body := range []string{
+					`{"Protocol": "udp"}`,
+					`[{"Protocol": "udp"}, {"Protocol": "sctp"}]`,
+					`[{"Networks": ["bogus"]}]`,
+					`[{"Ports": ["8000-"]}]`,
+					`[{"Protocol": "icmp", "ICMPCode": 0}]`,
+				} {
+					response := requestWithBody("POST", "/containers/net_out/bulk?handle=some-handle", body)
+					Ω(response.Code).Should(Equal(http.StatusBadRequest))
+				}
+
+				Ω(backend.netOutRules).Should(BeEmpty())
+			})
+		})
+
+		Context("when any rule is invalid", func() {
+			BeforeEach(func() {
+				backend.bulkNetOutErr = linux_backend.InvalidNetOutRuleError{Reason: "ports may only be given for tcp or udp"}
+			})
+
+			It("responds with 400", func() {
+				response := requestWithBody("POST", "/containers/net_out/bulk?handle=some-handle", `[{"Protocol": "icmp", "Ports": ["80"]}]`)
+				Ω(response.Code).Should(Equal(http.StatusBadRequest))
+				Ω(response.Body.String()).Should(ContainSubstring("ports may only be given for tcp or udp"))
+			})
+		})
+
+		Context("when the handle is unknown", func() {
+			BeforeEach(func() {
+				backend.bulkNetOutErr = linux_backend.UnknownHandleError{Handle: "bogus"}
+			})
+
+			It("responds with 404", func() {
+				response := requestWithBody("POST", "/containers/net_out/bulk?handle=bogus", `[]`)
+				Ω(response.Code).Should(Equal(http.StatusNotFound))
+			})
+		})
+
+		Context("when not a POST", func() {
+			It("responds with 405", func() {
+				response := request("GET", "/containers/net_out/bulk?handle=some-handle")
+				Ω(response.Code).Should(Equal(http.StatusMethodNotAllowed))
+			})
+		})
+	})
+
+	Describe("POST /containers/net_in", func() {
+		It("maps the port for the protocol, and returns it", func() {
+			response := request("POST", "/containers/net_in?handle=some-handle&protocol=udp&host_port=5353&container_port=53")
+			Ω(response.Code).Should(Equal(http.StatusOK))
+
+			var mapped admin.NetInMapped
+			err := json.NewDecoder(response.Body).Decode(&mapped)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(mapped).Should(Equal(admin.NetInMapped{HostPort: 5353, ContainerPort: 53}))
+
+			Ω(backend.netIns).Should(Equal([]linux_backend.NetInSpec{
+				{HostPort: 5353, ContainerPort: 53, Protocol: linux_backend.ProtocolUDP},
+			}))
+		})
+
+		Context("when nothing but the handle is given", func() {
+			It("maps any tcp port", func() {
+				response := request("POST", "/containers/net_in?handle=some-handle")
+				Ω(response.Code).Should(Equal(http.StatusOK))
+
+				var mapped admin.NetInMapped
+				err := json.NewDecoder(response.Body).Decode(&mapped)
+				Ω(err).ShouldNot(HaveOccurred())
+
+				Ω(mapped).Should(Equal(admin.NetInMapped{HostPort: 61000, ContainerPort: 61000}))
+
+				Ω(backend.netIns).Should(Equal([]linux_backend.NetInSpec{
+					{Protocol: linux_backend.ProtocolTCP},
+				}))
+			})
+		})
+
+		Context("when the protocol or a port is malformed", func() {
+			It("responds with 400", func() {
+				response := request("POST", "/containers/net_in?handle=some-handle&protocol=sctp")
+				Ω(response.Code).Should(Equal(http.StatusBadRequest))
+
+				response = request("POST", "/containers/net_in?handle=some-handle&host_port=http")
+				Ω(response.Code).Should(Equal(http.StatusBadRequest))
+
+				Ω(backend.netIns).Should(BeEmpty())
+			})
+		})
+
+		Context("when the protocol cannot be mapped in", func() {
+			BeforeEach(func() {
+				backend.netInErr = linux_backend.UnsupportedNetInProtocolError{Protocol: linux_backend.ProtocolICMP}
+			})
+
+			It("responds with 400", func() {
+				response := request("POST", "/containers/net_in?handle=some-handle&protocol=icmp")
+				Ω(response.Code).Should(Equal(http.StatusBadRequest))
+			})
+		})
+
+		Context("when the handle is unknown", func() {
+			BeforeEach(func() {
+				backend.netInErr = linux_backend.UnknownHandleError{Handle: "bogus"}
+			})
+
+			It("responds with 404", func() {
+				response := request("POST", "/containers/net_in?handle=bogus")
+				Ω(response.Code).Should(Equal(http.StatusNotFound))
+			})
+		})
+
+		Context("when not a POST", func() {
+			It("responds with 405", func() {
+				response := request("GET", "/containers/net_in?handle=some-handle")
+				Ω(response.Code).Should(Equal(http.StatusMethodNotAllowed))
+			})
+		})
+	})
+
+	Describe("POST /containers/net_in_range", func() {
+		It("maps the range, and returns it", func() {
+			response := request("POST", "/containers/net_in_range?handle=some-handle&protocol=udp&host_port_start=6000&container_port_start=6000&count=100")
+			Ω(response.Code).Should(Equal(http.StatusOK))
+
+			var mapped admin.NetInRangeMapped
+			err := json.NewDecoder(response.Body).Decode(&mapped)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(mapped).Should(Equal(admin.NetInRangeMapped{
+				HostPortStart:      6000,
+				ContainerPortStart: 6000,
+				Count:              100,
+			}))
+
+			Ω(backend.netInRanges).Should(Equal([]linux_backend.NetInSpec{
+				{HostPort: 6000, ContainerPort: 6000, Protocol: linux_backend.ProtocolUDP, Count: 100},
+			}))
+		})
+
+		Context("when only a count is given", func() {
+			It("maps any range of tcp ports", func() {
+				response := request("POST", "/containers/net_in_range?handle=some-handle&count=10")
+				Ω(response.Code).Should(Equal(http.StatusOK))
+
+				var mapped admin.NetInRangeMapped
+				err := json.NewDecoder(response.Body).Decode(&mapped)
+				Ω(err).ShouldNot(HaveOccurred())
+
+				Ω(mapped).Should(Equal(admin.NetInRangeMapped{
+					HostPortStart:      61000,
+					ContainerPortStart: 61000,
+					Count:              10,
+				}))
+
+				Ω(backend.netInRanges).Should(Equal([]linux_backend.NetInSpec{
+					{Protocol: linux_backend.ProtocolTCP, Count: 10},
+				}))
+			})
+		})
+
+		Context("when no count is given", func() {
+			It("responds with 400", func() {
+				response := request("POST", "/containers/net_in_range?handle=some-handle&host_port_start=6000")
+				Ω(response.Code).Should(Equal(http.StatusBadRequest))
+
+				Ω(backend.netInRanges).Should(BeEmpty())
+			})
+		})
+
+		Context("when a port is malformed", func() {
+			It("responds with 400", func() {
+				response := request("POST", "/containers/net_in_range?handle=some-handle&host_port_start=http&count=10")
+				Ω(response.Code).Should(Equal(http.StatusBadRequest))
+
+				Ω(backend.netInRanges).Should(BeEmpty())
+			})
+		})
+
+		Context("when the range is invalid", func() {
+			BeforeEach(func() {
+				backend.netInRangeErr = linux_backend.InvalidNetInRangeError{Reason: "container ports must be the same as the host ports"}
+			})
+
+			It("responds with 400", func() {
+				response := request("POST", "/containers/net_in_range?handle=some-handle&host_port_start=6000&container_port_start=7000&count=10")
+				Ω(response.Code).Should(Equal(http.StatusBadRequest))
+				Ω(response.Body.String()).Should(ContainSubstring("container ports must be the same"))
+			})
+		})
+
+		Context("when the handle is unknown", func() {
+			BeforeEach(func() {
+				backend.netInRangeErr = linux_backend.UnknownHandleError{Handle: "bogus"}
+			})
+
+			It("responds with 404", func() {
+				response := request("POST", "/containers/net_in_range?handle=bogus&count=10")
+				Ω(response.Code).Should(Equal(http.StatusNotFound))
+			})
+		})
+
+		Context("when not a POST", func() {
+			It("responds with 405", func() {
+				response := request("GET", "/containers/net_in_range?handle=some-handle&count=10")
+				Ω(response.Code).Should(Equal(http.StatusMethodNotAllowed))
+			})
+		})
+	})
+
+	Describe("POST /containers/capture/start", func() {
+		It("starts capturing the container within the limits, returning where to", func() {
+			response := request("POST", "/containers/capture/start?handle=some-handle&duration=30s&packets=100&snap_length=1500")
+			Ω(response.Code).Should(Equal(http.StatusOK))
+
+			var started admin.CaptureStarted
+			err := json.NewDecoder(response.Body).Decode(&started)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(started).Should(Equal(admin.CaptureStarted{Path: "/var/garden/captures/some.pcap"}))
+
+			Ω(backend.captureLimits).Should(Equal(&linux_backend.CaptureLimits{
+				Duration:   30 * time.Second,
+				Packets:    100,
+				SnapLength: 1500,
+			}))
+		})
+
+		Context("when no limits are given", func() {
+			It("leaves them to be defaulted", func() {
+				response := request("POST", "/containers/capture/start?handle=some-handle")
+				Ω(response.Code).Should(Equal(http.StatusOK))
+
+				Ω(backend.captureLimits).Should(Equal(&linux_backend.CaptureLimits{}))
+			})
+		})
+
+		Context("when a limit is malformed", func() {
+			It("responds with 400", func() {
+				for _, query := range []string{"duration=soon", "packets=many", "snap_length=-1"} {
+					response := request("POST", "/containers/capture/start?handle=some-handle&"+query)
+					Ω(response.Code).Should(Equal(http.StatusBadRequest))
+				}
+
+				Ω(backend.captureLimits).Should(BeNil())
+			})
+		})
+
+		Context("when the limits exceed the maximum", func() {
+			BeforeEach(func() {
+				backend.startCaptureError = linux_backend.CaptureLimitsExceededError{}
+			})
+
+			It("responds with 400", func() {
+				response := request("POST", "/containers/capture/start?handle=some-handle&duration=24h")
+				Ω(response.Code).Should(Equal(http.StatusBadRequest))
+			})
+		})
+
+		Context("when the container is already being captured", func() {
+			BeforeEach(func() {
+				backend.startCaptureError = linux_backend.CaptureInProgressError{Handle: "some-handle"}
+			})
+
+			It("responds with 409", func() {
+				response := request("POST", "/containers/capture/start?handle=some-handle")
+				Ω(response.Code).Should(Equal(http.StatusConflict))
+			})
+		})
+
+		Context("when the handle is unknown", func() {
+			BeforeEach(func() {
+				backend.startCaptureError = linux_backend.UnknownHandleError{Handle: "bogus"}
+			})
+
+			It("responds with 404", func() {
+				response := request("POST", "/containers/capture/start?handle=bogus")
+				Ω(response.Code).Should(Equal(http.StatusNotFound))
+			})
+		})
+
+		Context("when not a POST", func() {
+			It("responds with 405", func() {
+				response := request("GET", "/containers/capture/start?handle=some-handle")
+				Ω(response.Code).Should(Equal(http.StatusMethodNotAllowed))
+
+				Ω(backend.captureLimits).Should(BeNil())
+			})
+		})
+	})
+
+	Describe("POST /containers/capture/stop", func() {
+		It("stops capturing the container", func() {
+			response := request("POST", "/containers/capture/stop?handle=some-handle")
+			Ω(response.Code).Should(Equal(http.StatusNoContent))
+
+			Ω(backend.captureStopped).Should(Equal("some-handle"))
+		})
+
+		Context("when the container is not being captured", func() {
+			BeforeEach(func() {
+				backend.stopCaptureError = linux_backend.NoCaptureError{Handle: "some-handle"}
+			})
+
+			It("responds with 404", func() {
+				response := request("POST", "/containers/capture/stop?handle=some-handle")
+				Ω(response.Code).Should(Equal(http.StatusNotFound))
+			})
+		})
+	})
+})
@@ -0,0 +1,50 @@
+package lifecycle_test
+
+import (
+	"os/exec"
+
+	"github.com/cloudfoundry-incubator/garden/api"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Destroying a container", func() {
+	var container api.Container
+	var containerIP string
+
+	BeforeEach(func() {
+		client = startGarden()
+
+		var err error
+
+		container, err = client.Create(api.ContainerSpec{})
+		Ω(err).ShouldNot(HaveOccurred())
+
+		info, err := container.Info()
+		Ω(err).ShouldNot(HaveOccurred())
+
+		containerIP = info.ContainerIP
+
+		// talk to the host, so that it learns the container's address
+		process, err := container.Run(api.ProcessSpec{
+			Path: "ping",
+			Args: []string{"-c", "1", info.HostIP},
+		}, api.ProcessIO{
+			Stdout: GinkgoWriter,
+			Stderr: GinkgoWriter,
+		})
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(process.Wait()).Should(Equal(0))
+	})
+
+	It("leaves no neighbour entries for its address on the host", func() {
+		err := client.Destroy(container.Handle())
+		Ω(err).ShouldNot(HaveOccurred())
+
+		neighbours, err := exec.Command("ip", "neigh", "show", "to", containerIP).CombinedOutput()
+		Ω(err).ShouldNot(HaveOccurred())
+
+		Ω(string(neighbours)).Should(BeEmpty())
+	})
+})
@@ -1,8 +1,11 @@
 package main_test
 
 import (
+	"encoding/gob"
+	"net"
 	"os"
 	"os/exec"
+	"syscall"
 
 	linkpkg "github.com/cloudfoundry-incubator/garden-linux/old/iodaemon/link"
 	. "github.com/onsi/ginkgo"
@@ -67,4 +70,134 @@ var _ = Describe("Iodaemon", func() {
 			Ω(err).ShouldNot(HaveOccurred())
 		}
 	})
+
+	Describe("protocol versions", func() {
+		var listener net.Listener
+
+		// serveAnnouncing stands in for a daemon, passing pipes to the first
+		// link alongside the given announcement, and returns the connection
+		serveAnnouncing := func(announcement []byte) <-chan net.Conn {
+			var err error
+			listener, err = net.Listen("unix", socketPath)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			conns := make(chan net.Conn, 1)
+
+			go func() {
+				defer GinkgoRecover()
+
+				conn, err := listener.Accept()
+				Ω(err).ShouldNot(HaveOccurred())
+
+				stdoutR, stdoutW, err := os.Pipe()
+				Ω(err).ShouldNot(HaveOccurred())
+
+				stderrR, stderrW, err := os.Pipe()
+				Ω(err).ShouldNot(HaveOccurred())
+
+				statusR, statusW, err := os.Pipe()
+				Ω(err).ShouldNot(HaveOccurred())
+
+				rights := syscall.UnixRights(int(stdoutR.Fd()), int(stderrR.Fd()), int(statusR.Fd()))
+
+				_, _, err = conn.(*net.UnixConn).WriteMsgUnix(announcement, rights, nil)
+				Ω(err).ShouldNot(HaveOccurred())
+
+				stdoutW.Close()
+				stderrW.Close()
+				statusW.Close()
+
+				conns <- conn
+			}()
+
+			return conns
+		}
+
+		AfterEach(func() {
+			if listener != nil {
+				listener.Close()
+				listener = nil
+			}
+		})
+
+		It("tells the daemon which version the link speaks", func() {
+			conns := serveAnnouncing(linkpkg.Announcement())
+
+			link, err := linkpkg.Create(socketPath, gbytes.NewBuffer(), gbytes.NewBuffer())
+			Ω(err).ShouldNot(HaveOccurred())
+
+			link.Write([]byte("hello"))
+
+			decoder := gob.NewDecoder(<-conns)
+
+			var input linkpkg.Input
+			err = decoder.Decode(&input)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(input).Should(Equal(linkpkg.Input{Version: linkpkg.ProtocolVersion}))
+
+			err = decoder.Decode(&input)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(input.Data).Should(Equal([]byte("hello")))
+		})
+
+		Context("when the daemon predates versioning", func() {
+			It("links without announcing a version", func() {
+				conns := serveAnnouncing([]byte{})
+
+				link, err := linkpkg.Create(socketPath, gbytes.NewBuffer(), gbytes.NewBuffer())
+				Ω(err).ShouldNot(HaveOccurred())
+
+				link.Write([]byte("hello"))
+
+				var input linkpkg.Input
+				err = gob.NewDecoder(<-conns).Decode(&input)
+				Ω(err).ShouldNot(HaveOccurred())
+				Ω(input).Should(Equal(linkpkg.Input{Data: []byte("hello")}))
+			})
+		})
+
+		Context("when the daemon speaks no version the link does", func() {
+			It("refuses to link", func() {
+				serveAnnouncing([]byte("98 99"))
+
+				_, err := linkpkg.Create(socketPath, gbytes.NewBuffer(), gbytes.NewBuffer())
+				Ω(err).Should(Equal(linkpkg.VersionMismatchError{
+					DaemonMinVersion: 98,
+					DaemonVersion:    99,
+				}))
+			})
+		})
+
+		Context("when a link speaks a version the daemon does not", func() {
+			It("is disconnected", func() {
+				spawnS, err := gexec.Start(exec.Command(
+					iodaemon,
+					"spawn",
+					socketPath,
+					"bash", "-c", "cat <&0",
+				), GinkgoWriter, GinkgoWriter)
+				Ω(err).ShouldNot(HaveOccurred())
+
+				defer spawnS.Kill()
+
+				Eventually(spawnS).Should(gbytes.Say("ready\n"))
+
+				conn, err := net.Dial("unix", socketPath)
+				Ω(err).ShouldNot(HaveOccurred())
+
+				var b [2048]byte
+				var oob [2048]byte
+
+				n, _, _, _, err := conn.(*net.UnixConn).ReadMsgUnix(b[:], oob[:])
+				Ω(err).ShouldNot(HaveOccurred())
+				Ω(b[:n]).Should(Equal(linkpkg.Announcement()))
+
+				err = gob.NewEncoder(conn).Encode(linkpkg.Input{Version: 99})
+				Ω(err).ShouldNot(HaveOccurred())
+
+				_, err = conn.Read(b[:])
+				Ω(err).Should(HaveOccurred())
+			})
+		})
+	})
 })
@@ -50,6 +50,17 @@ func Create(socketPath string, stdout io.Writer, stderr io.Writer) (*Link, error
 		return nil, fmt.Errorf("invalid number of fds; need 3, got %d", len(fds))
 	}
 
+	version, err := negotiateVersion(b[:n])
+	if err != nil {
+		for _, fd := range fds {
+			syscall.Close(fd)
+		}
+
+		conn.Close()
+
+		return nil, err
+	}
+
 	lstdout := os.NewFile(uintptr(fds[0]), "stdout")
 	lstderr := os.NewFile(uintptr(fds[1]), "stderr")
 	lstatus := os.NewFile(uintptr(fds[2]), "status")
@@ -58,6 +69,14 @@ func Create(socketPath string, stdout io.Writer, stderr io.Writer) (*Link, error
 
 	linkWriter := NewWriter(conn)
 
+	// daemons from before versioning would take this as empty input
+	if !isLegacyAnnouncement(b[:n]) {
+		err := linkWriter.setVersion(version)
+		if err != nil {
+			return nil, fmt.Errorf("failed to send protocol version: %s", err)
+		}
+	}
+
 	streaming.Add(1)
 	go func() {
 		io.Copy(stdout, lstdout)
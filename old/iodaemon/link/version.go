@@ -0,0 +1,71 @@
+package link
+
+import (
+	"bytes"
+	"fmt"
+)
+
+// An i/o daemon announces the protocol versions it speaks alongside the
+// descriptors it passes to each link. The link picks the newest version
+// both speak, and tells the daemon in its first input.
+//
+// Daemons from before versioning announce nothing, and speak version 1.
+const (
+	ProtocolVersion    = 1
+	MinProtocolVersion = 1
+)
+
+type VersionMismatchError struct {
+	DaemonMinVersion int
+	DaemonVersion    int
+}
+
+func (e VersionMismatchError) Error() string {
+	return fmt.Sprintf(
+		"i/o daemon speaks protocol versions %d to %d, but this link speaks %d to %d",
+		e.DaemonMinVersion,
+		e.DaemonVersion,
+		MinProtocolVersion,
+		ProtocolVersion,
+	)
+}
+
+// Announcement is sent by daemons with their descriptors.
+func Announcement() []byte {
+	return []byte(fmt.Sprintf("%d %d", MinProtocolVersion, ProtocolVersion))
+}
+
+func SupportsVersion(version int) bool {
+	return version >= MinProtocolVersion && version <= ProtocolVersion
+}
+
+func negotiateVersion(announcement []byte) (int, error) {
+	daemonMin, daemonMax := 1, 1
+
+	if !isLegacyAnnouncement(announcement) {
+		_, err := fmt.Sscanf(string(announcement), "%d %d", &daemonMin, &daemonMax)
+		if err != nil {
+			return 0, fmt.Errorf("invalid protocol announcement %q: %s", announcement, err)
+		}
+	}
+
+	version := ProtocolVersion
+	if daemonMax < version {
+		version = daemonMax
+	}
+
+	if version < MinProtocolVersion || version < daemonMin {
+		return 0, VersionMismatchError{
+			DaemonMinVersion: daemonMin,
+			DaemonVersion:    daemonMax,
+		}
+	}
+
+	return version, nil
+}
+
+// Passing descriptors without data sends a single zero byte, which is what
+// daemons from before versioning announce.
+func isLegacyAnnouncement(announcement []byte) bool {
+	return len(announcement) == 0 || bytes.Equal(announcement, []byte{0})
+}
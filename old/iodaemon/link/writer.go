@@ -9,6 +9,10 @@ type Input struct {
 	Data       []byte
 	EOF        bool
 	WindowSize *WindowSize
+
+	// Version is the protocol version the link speaks; only set on the
+	// link's first input
+	Version int
 }
 
 type WindowSize struct {
@@ -45,3 +49,7 @@ func (w *Writer) SetWindowSize(cols, rows int) error {
 		},
 	})
 }
+
+func (w *Writer) setVersion(version int) error {
+	return w.enc.Encode(Input{Version: version})
+}
@@ -120,7 +120,7 @@ func spawn(socketPath string, argv []string, timeout time.Duration, withTty bool
 			int(statusR.Fd()),
 		)
 
-		_, _, err = conn.(*net.UnixConn).WriteMsgUnix([]byte{}, rights, nil)
+		_, _, err = conn.(*net.UnixConn).WriteMsgUnix(linkpkg.Announcement(), rights, nil)
 		if err != nil {
 			break
 		}
@@ -166,6 +166,15 @@ func spawn(socketPath string, argv []string, timeout time.Duration, withTty bool
 				break
 			}
 
+			if input.Version != 0 {
+				if !linkpkg.SupportsVersion(input.Version) {
+					conn.Close()
+					break
+				}
+
+				continue
+			}
+
 			if input.WindowSize != nil {
 				ptyutil.SetWinSize(stdinW, input.WindowSize.Columns, input.WindowSize.Rows)
 				cmd.Process.Signal(syscall.SIGWINCH)
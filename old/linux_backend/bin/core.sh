@@ -0,0 +1,64 @@
+#!/bin/bash
+
+# Run by the kernel, as root, for each process that dumps core, with the core
+# on stdin. Installed with a core_pattern of
+#
+#   |core.sh <depot_path> <max_bytes> <max_count> <host_cores_path> %P %u %g %t %e
+#
+# Cores of container processes are kept, truncated to max_bytes, in their
+# container's depot directory, readable only by the user whose process dumped
+# them, up to max_count per container. Cores of host processes are kept in
+# host_cores_path, readable only by root, with the same caps. Either are kept
+# whether or not the server is still running.
+
+set -o nounset
+shopt -s nullglob
+
+if [ $# -lt 9 ]
+then
+  echo "Usage: $0 <depot_path> <max_bytes> <max_count> <host_cores_path> <host_pid> <uid> <gid> <time> <executable>"
+  exit 1
+fi
+
+depot_path=$1
+max_bytes=$2
+max_count=$3
+host_cores_path=$4
+host_pid=$5
+uid=$6
+gid=$7
+time=$8
+
+# the executable's name may have been split on its spaces
+executable=$(echo "${@:9}" | tr ' /' '__')
+
+# The process is in its container's cgroups, e.g. 4:cpu:/instance-<id>
+id=$(sed -n 's/.*\/instance-\([^/]*\)$/\1/p' /proc/$host_pid/cgroup | head -n 1)
+
+if [ -z "$id" ] || [ ! -d $depot_path/$id ]
+then
+  # not a container's; kept for the host, as root's
+  cores_path=$host_cores_path
+  uid=0
+  gid=0
+else
+  cores_path=$depot_path/$id/cores
+fi
+
+mkdir -p $cores_path
+
+# a process crashing in a loop would otherwise fill the disk
+kept=($cores_path/core.*)
+if [ ${#kept[@]} -ge $max_count ]
+then
+  exit 0
+fi
+
+# Written under a temporary name so that it is only seen once complete
+core=core.$executable.$host_pid.$time
+
+umask 077
+
+head -c $max_bytes > $cores_path/.$core
+chown $uid:$gid $cores_path/.$core
+mv $cores_path/.$core $cores_path/$core
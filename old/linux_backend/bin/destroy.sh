@@ -5,14 +5,18 @@ set -o nounset
 set -o errexit
 shopt -s nullglob
 
-if [ $# -ne 1  ]
+if [ $# -lt 1 ] || [ $# -gt 2 ]
 then
-  echo "Usage: $0 <instance_path>"
+  echo "Usage: $0 <instance_path> [graveyard_path]"
   exit 1
 fi
 
 target=$1
 
+# If given, the instance is moved here to be removed later, rather than
+# being removed now
+graveyard=${2:-}
+
 # Ignore tmp directory
 if [ $(basename $target) == "tmp" ]
 then
@@ -26,5 +30,11 @@ then
     $target/destroy.sh
   fi
 
-  rm -rf $target
+  if [ -n "$graveyard" ]
+  then
+    mkdir -p $graveyard
+    mv $target $graveyard/
+  else
+    rm -rf $target
+  fi
 fi
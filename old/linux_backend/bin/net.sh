@@ -73,6 +73,31 @@ function teardown_filter() {
   iptables -w -F ${filter_default_chain} 2> /dev/null || true
 }
 
+# Replaces the default chain's rules in one iptables-restore, so that when
+# the allowed and denied networks change, containers' traffic never passes
+# through the chain half-filled
+function fill_filter_default() {
+  (
+    echo "*filter"
+
+    # declaring the chain flushes it, and only it, with --noflush
+    echo ":${filter_default_chain} - [0:0]"
+
+    # Always allow established connections to containers
+    echo "-A ${filter_default_chain} -m conntrack --ctstate ESTABLISHED,RELATED -j ACCEPT"
+
+    for n in ${ALLOW_NETWORKS}; do
+      echo "-A ${filter_default_chain} --destination $n --jump RETURN"
+    done
+
+    for n in ${DENY_NETWORKS}; do
+      echo "-A ${filter_default_chain} --destination $n --jump DROP"
+    done
+
+    echo "COMMIT"
+  ) | iptables-restore --noflush
+}
+
 function setup_filter() {
   teardown_filter
 
@@ -80,29 +105,10 @@ function setup_filter() {
   iptables -w -N ${filter_forward_chain} 2> /dev/null || iptables -w -F ${filter_forward_chain}
   iptables -w -A ${filter_forward_chain} -j DROP
 
-  # Create or flush default chain
-  iptables -w -N ${filter_default_chain} 2> /dev/null || iptables -w -F ${filter_default_chain}
-
-  # Always allow established connections to containers
-  iptables -w -A ${filter_default_chain} -m conntrack --ctstate ESTABLISHED,RELATED -j ACCEPT
-
-  for n in ${ALLOW_NETWORKS}; do
-    if [ "$n" == "" ]
-    then
-      break
-    fi
-
-    iptables -w -A ${filter_default_chain} --destination "$n" --jump RETURN
-  done
-
-  for n in ${DENY_NETWORKS}; do
-    if [ "$n" == "" ]
-    then
-      break
-    fi
+  # Create default chain
+  iptables -w -N ${filter_default_chain} 2> /dev/null || true
 
-    iptables -w -A ${filter_default_chain} --destination "$n" --jump DROP
-  done
+  fill_filter_default
 
   # Forward outbound traffic via ${filter_forward_chain}
   iptables -w -A FORWARD -i ${GARDEN_NETWORK_INTERFACE_PREFIX}+ --jump ${filter_forward_chain}
@@ -171,7 +177,28 @@ function setup_nat() {
       --to $(external_ip)
 }
 
+# Moves the pool's SNAT from OLD_POOL_NETWORK to the larger POOL_NETWORK,
+# adding the new rule first so that containers' traffic is NATed throughout
+function grow_pool_nat() {
+  (iptables -w -t nat -S ${nat_postrouting_chain} | grep -q "\-s ${POOL_NETWORK} -j SNAT\b") ||
+    iptables -w -t nat -A ${nat_postrouting_chain} \
+      --source ${POOL_NETWORK} \
+      --jump SNAT \
+      --to $(external_ip)
+
+  iptables -w -t nat -S ${nat_postrouting_chain} 2> /dev/null |
+    grep "\-s ${OLD_POOL_NETWORK} -j SNAT\b" |
+    sed -e "s/-A/-D/" -e "s/\s\+\$//" |
+    xargs --no-run-if-empty --max-lines=1 iptables -w -t nat
+}
+
 case "${1}" in
+  grow_pool)
+    grow_pool_nat
+    ;;
+  filter_default)
+    fill_filter_default
+    ;;
   setup)
     setup_filter
     setup_nat
@@ -8,6 +8,9 @@ overlay_path=$2/overlay
 rootfs_path=$2/rootfs
 base_path=$3
 
+# SELinux context every file in the rootfs is labelled with, if any
+mount_label=${4:-}
+
 function overlay_directory_in_rootfs() {
   # Skip if exists
   if [ ! -d $overlay_path/$1 ]
@@ -39,6 +42,12 @@ function setup_fs_other() {
   mkdir -p $overlay_path/tmp
   chmod 777 $overlay_path/tmp
   overlay_directory_in_rootfs /tmp rw
+
+  # bind mounts cannot be given a context, so only the container's own
+  # copies are labelled; the base must be readable by every container
+  if [ -n "$mount_label" ]; then
+    chcon -R "$mount_label" $overlay_path
+  fi
 }
 
 function get_mountpoint() {
@@ -102,10 +111,16 @@ function setup_fs() {
   mkdir -p $overlay_path
   mkdir -p $rootfs_path
 
+  # the label contains commas, so is quoted
+  local context_opt=""
+  if [ -n "$mount_label" ]; then
+    context_opt=",context=\"$mount_label\""
+  fi
+
   if should_use_aufs; then
-    mount -n -t aufs -o br:$overlay_path=rw:$base_path=ro+wh none $rootfs_path
+    mount -n -t aufs -o br:$overlay_path=rw:$base_path=ro+wh$context_opt none $rootfs_path
   elif should_use_overlayfs; then
-    mount -n -t overlayfs -o rw,upperdir=$overlay_path,lowerdir=$base_path none $rootfs_path
+    mount -n -t overlayfs -o rw,upperdir=$overlay_path,lowerdir=$base_path$context_opt none $rootfs_path
   else
     setup_fs_other
   fi
@@ -115,9 +130,29 @@ function rootfs_mountpoints() {
   cat /proc/mounts | grep $rootfs_path | awk '{print $2}'
 }
 
+# after a host reboot the overlay branch survives but its mounts do not
+function remount_fs() {
+  if [ -n "$(rootfs_mountpoints)" ]; then
+    return 0
+  fi
+
+  if [ -z "$base_path" ]; then
+    echo "cannot remount $rootfs_path: its base rootfs is not known" >&2
+    return 1
+  fi
+
+  setup_fs
+}
+
+# everything mounted under the container, including its writable branch
+# when that is a volume of its own, innermost first
+function container_mountpoints() {
+  cat /proc/mounts | grep $container_path | awk '{print $2}' | tac
+}
+
 function teardown_fs() {
   for i in $(seq 10); do
-    local mountpoints=$(rootfs_mountpoints)
+    local mountpoints=$(container_mountpoints)
     if [ -z "$mountpoints" ] || umount $mountpoints; then
       if rm -rf $container_path; then
         return 0
@@ -132,6 +167,8 @@ function teardown_fs() {
 
 if [ "$action" = "create" ]; then
   setup_fs
+elif [ "$action" = "remount" ]; then
+  remount_fs
 else
   teardown_fs
 fi
@@ -55,8 +55,15 @@ fi
 
 ./net.sh setup
 
-# Disable AppArmor if possible
-if [ -x /etc/init.d/apparmor ]; then
+# Unless containers are to be confined by AppArmor, in which case the
+# shipped profiles are loaded, if the host has it, disable AppArmor if possible
+if [ -n "${APPARMOR_PROFILE:-}" ]; then
+  if [ "$(cat /sys/module/apparmor/parameters/enabled 2> /dev/null)" == "Y" ]; then
+    for profile in apparmor/*; do
+      apparmor_parser --replace $profile
+    done
+  fi
+elif [ -x /etc/init.d/apparmor ]; then
   /etc/init.d/apparmor teardown
 fi
 
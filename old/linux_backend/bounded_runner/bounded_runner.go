@@ -0,0 +1,212 @@
+// Package bounded_runner bounds how long the commands that the backend runs
+// to completion may take, and how much of their output is kept, so that a
+// script wedged on a hung mount or a runaway command cannot hang or bloat
+// the server.
+package bounded_runner
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path"
+	"syscall"
+	"time"
+
+	"github.com/cloudfoundry/gunk/command_runner"
+	"github.com/pivotal-golang/lager"
+)
+
+type Config struct {
+	// how long a command may run before it is killed; zero is forever
+	Timeout time.Duration
+
+	// overrides of Timeout, by the command's base name, e.g. "net.sh"
+	Timeouts map[string]time.Duration
+
+	// the most of each of a command's stdout and stderr kept when captured
+	// into memory; zero keeps all of it. The rest of what commands write is
+	// discarded, and logged as having been, without failing them.
+	MaxOutput int
+}
+
+// TimeoutError is returned when a command is killed for running past its
+// timeout.
+type TimeoutError struct {
+	Path    string
+	Args    []string
+	Timeout time.Duration
+}
+
+func (e TimeoutError) Error() string {
+	return fmt.Sprintf("%s did not finish within %s (args: %v)", e.Path, e.Timeout, e.Args)
+}
+
+// IsTimeout reports whether err is from a command timing out.
+func IsTimeout(err error) bool {
+	_, ok := err.(TimeoutError)
+	return ok
+}
+
+type runner struct {
+	command_runner.CommandRunner
+
+	config Config
+	logger lager.Logger
+}
+
+// New returns a command runner that kills commands run with Run once they
+// reach their timeout, and keeps no more than MaxOutput bytes of what they
+// write to buffers, returning their own result whether or not they write
+// more. Commands that are started rather than run are left to their callers
+// to wait for.
+func New(logger lager.Logger, commandRunner command_runner.CommandRunner, config Config) command_runner.CommandRunner {
+	return &runner{
+		CommandRunner: commandRunner,
+
+		config: config,
+		logger: logger,
+	}
+}
+
+func (runner *runner) Run(cmd *exec.Cmd) error {
+	var bounded []*boundedWriter
+
+	if runner.config.MaxOutput > 0 {
+		sameOutput := SameWriter(cmd.Stdout, cmd.Stderr)
+
+		cmd.Stdout = runner.bound(cmd.Stdout, &bounded)
+
+		// exec copies output written to one destination on one goroutine;
+		// bounding each separately would have two writing to it at once
+		if sameOutput {
+			cmd.Stderr = cmd.Stdout
+		} else {
+			cmd.Stderr = runner.bound(cmd.Stderr, &bounded)
+		}
+	}
+
+	err := runner.run(cmd)
+
+	for _, w := range bounded {
+		if w.truncated {
+			runner.logger.Info("output-truncated", lager.Data{
+				"path":      cmd.Path,
+				"args":      args(cmd),
+				"max-bytes": runner.config.MaxOutput,
+			})
+
+			break
+		}
+	}
+
+	return err
+}
+
+func (runner *runner) run(cmd *exec.Cmd) error {
+	timeout := runner.timeoutFor(cmd)
+	if timeout == 0 {
+		return runner.CommandRunner.Run(cmd)
+	}
+
+	err := runner.CommandRunner.Start(cmd)
+	if err != nil {
+		return err
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- runner.CommandRunner.Wait(cmd)
+	}()
+
+	select {
+	case err := <-done:
+		return err
+
+	case <-time.After(timeout):
+		runner.kill(cmd)
+		return TimeoutError{Path: cmd.Path, Args: args(cmd), Timeout: timeout}
+	}
+}
+
+func args(cmd *exec.Cmd) []string {
+	if len(cmd.Args) < 2 {
+		return nil
+	}
+
+	return cmd.Args[1:]
+}
+
+func (runner *runner) timeoutFor(cmd *exec.Cmd) time.Duration {
+	if timeout, found := runner.config.Timeouts[path.Base(cmd.Path)]; found {
+		return timeout
+	}
+
+	return runner.config.Timeout
+}
+
+// kill kills the command's whole process group if it has one, so that
+// children holding its output open do not outlive it.
+func (runner *runner) kill(cmd *exec.Cmd) {
+	if cmd.Process != nil && cmd.SysProcAttr != nil && cmd.SysProcAttr.Setpgid {
+		syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+		return
+	}
+
+	runner.CommandRunner.Kill(cmd)
+}
+
+// bound limits what is written to in-memory destinations, adding the
+// writers it bounds them with to bounded; files and pipes are left to drain
+// as they would.
+func (runner *runner) bound(w io.Writer, bounded *[]*boundedWriter) io.Writer {
+	switch w.(type) {
+	case nil, *os.File, *boundedWriter:
+		return w
+	}
+
+	bw := &boundedWriter{w: w, remaining: runner.config.MaxOutput}
+	*bounded = append(*bounded, bw)
+
+	return bw
+}
+
+// SameWriter reports whether a command's stdout and stderr are the same
+// destination, comparing them as exec does, without panicking on writers
+// that cannot be compared.
+func SameWriter(a, b io.Writer) (same bool) {
+	defer func() {
+		if recover() != nil {
+			same = false
+		}
+	}()
+
+	return a != nil && a == b
+}
+
+// boundedWriter passes on writes until its limit, and then discards the
+// rest, still reporting them written so that the command is not killed by
+// a broken pipe, but noting that they were.
+type boundedWriter struct {
+	w         io.Writer
+	remaining int
+	truncated bool
+}
+
+func (w *boundedWriter) Write(p []byte) (int, error) {
+	kept := p
+	if len(kept) > w.remaining {
+		kept = kept[:w.remaining]
+		w.truncated = true
+	}
+
+	if len(kept) > 0 {
+		n, err := w.w.Write(kept)
+		w.remaining -= n
+		if err != nil {
+			return n, err
+		}
+	}
+
+	return len(p), nil
+}
@@ -0,0 +1,13 @@
+package bounded_runner_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"testing"
+)
+
+func TestBoundedRunner(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Bounded Runner Suite")
+}
@@ -0,0 +1,246 @@
+package bounded_runner_test
+
+import (
+	"bytes"
+	"errors"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/cloudfoundry/gunk/command_runner"
+	"github.com/cloudfoundry/gunk/command_runner/fake_command_runner"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/pivotal-golang/lager"
+	"github.com/pivotal-golang/lager/lagertest"
+
+	"github.com/cloudfoundry-incubator/garden-linux/old/linux_backend/bounded_runner"
+)
+
+var _ = Describe("Bounded runner", func() {
+	var fakeRunner *fake_command_runner.FakeCommandRunner
+	var config bounded_runner.Config
+	var runner command_runner.CommandRunner
+	var logger *lagertest.TestLogger
+
+	var finishWaiting chan struct{}
+
+	BeforeEach(func() {
+		fakeRunner = fake_command_runner.New()
+		config = bounded_runner.Config{}
+		logger = lagertest.NewTestLogger("test")
+
+		finishWaiting = make(chan struct{})
+
+		fakeRunner.WhenWaitingFor(
+			fake_command_runner.CommandSpec{
+				Path: "/depot/some-id/stop.sh",
+			},
+			func(*exec.Cmd) error {
+				<-finishWaiting
+				return nil
+			},
+		)
+	})
+
+	JustBeforeEach(func() {
+		runner = bounded_runner.New(logger, fakeRunner, config)
+	})
+
+	AfterEach(func() {
+		close(finishWaiting)
+	})
+
+	Context("with no timeout", func() {
+		It("runs commands as usual", func() {
+			err := runner.Run(exec.Command("/depot/some-id/stop.sh"))
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(fakeRunner.ExecutedCommands()).Should(HaveLen(1))
+		})
+	})
+
+	Context("with a timeout", func() {
+		BeforeEach(func() {
+			config.Timeout = 100 * time.Millisecond
+		})
+
+		It("returns the command's result when it finishes in time", func() {
+			disaster := errors.New("oh no!")
+
+			fakeRunner.WhenWaitingFor(
+				fake_command_runner.CommandSpec{
+					Path: "/depot/some-id/net.sh",
+				},
+				func(*exec.Cmd) error {
+					return disaster
+				},
+			)
+
+			err := runner.Run(exec.Command("/depot/some-id/net.sh", "setup"))
+			Ω(err).Should(Equal(disaster))
+
+			Ω(fakeRunner.StartedCommands()).Should(HaveLen(1))
+			Ω(fakeRunner.KilledCommands()).Should(BeEmpty())
+		})
+
+		It("kills commands that run past it, returning a TimeoutError", func() {
+			stop := exec.Command("/depot/some-id/stop.sh", "-w", "0")
+
+			err := runner.Run(stop)
+			Ω(err).Should(Equal(bounded_runner.TimeoutError{
+				Path:    "/depot/some-id/stop.sh",
+				Args:    []string{"-w", "0"},
+				Timeout: 100 * time.Millisecond,
+			}))
+
+			Ω(bounded_runner.IsTimeout(err)).Should(BeTrue())
+			Ω(fakeRunner.KilledCommands()).Should(ContainElement(stop))
+		})
+
+		Context("and a timeout for the command", func() {
+			BeforeEach(func() {
+				config.Timeouts = map[string]time.Duration{
+					"stop.sh": 200 * time.Millisecond,
+				}
+			})
+
+			It("uses the command's timeout", func() {
+				err := runner.Run(exec.Command("/depot/some-id/stop.sh"))
+				Ω(err).Should(Equal(bounded_runner.TimeoutError{
+					Path:    "/depot/some-id/stop.sh",
+					Timeout: 200 * time.Millisecond,
+				}))
+			})
+		})
+
+		Context("but no timeout for the command", func() {
+			BeforeEach(func() {
+				config.Timeouts = map[string]time.Duration{
+					"stop.sh": 0,
+				}
+			})
+
+			It("runs it as usual", func() {
+				err := runner.Run(exec.Command("/depot/some-id/stop.sh"))
+				Ω(err).ShouldNot(HaveOccurred())
+
+				Ω(fakeRunner.ExecutedCommands()).Should(HaveLen(1))
+				Ω(fakeRunner.StartedCommands()).Should(BeEmpty())
+			})
+		})
+	})
+
+	Context("with a limit on output", func() {
+		BeforeEach(func() {
+			config.MaxOutput = 10
+
+			fakeRunner.WhenRunning(
+				fake_command_runner.CommandSpec{
+					Path: "/bin/df",
+				},
+				func(cmd *exec.Cmd) error {
+					n, err := cmd.Stdout.Write([]byte(strings.Repeat("o", 8)))
+					Ω(err).ShouldNot(HaveOccurred())
+					Ω(n).Should(Equal(8))
+
+					n, err = cmd.Stdout.Write([]byte(strings.Repeat("o", 8)))
+					Ω(err).ShouldNot(HaveOccurred())
+					Ω(n).Should(Equal(8))
+
+					_, err = cmd.Stderr.Write([]byte(strings.Repeat("e", 20)))
+					Ω(err).ShouldNot(HaveOccurred())
+
+					return nil
+				},
+			)
+		})
+
+		It("keeps only that much of each of stdout and stderr, returning the command's result", func() {
+			stdout := new(bytes.Buffer)
+			stderr := new(bytes.Buffer)
+
+			df := exec.Command("/bin/df", "-h")
+			df.Stdout = stdout
+			df.Stderr = stderr
+
+			err := runner.Run(df)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(stdout.String()).Should(Equal(strings.Repeat("o", 10)))
+			Ω(stderr.String()).Should(Equal(strings.Repeat("e", 10)))
+		})
+
+		It("logs that the output was truncated, once", func() {
+			df := exec.Command("/bin/df", "-h")
+			df.Stdout = new(bytes.Buffer)
+			df.Stderr = new(bytes.Buffer)
+
+			err := runner.Run(df)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			logs := logger.Logs()
+			Ω(logs).Should(HaveLen(1))
+			Ω(logs[0].Message).Should(Equal("test.output-truncated"))
+			Ω(logs[0].Data).Should(Equal(lager.Data{
+				"path":      "/bin/df",
+				"args":      []interface{}{"-h"},
+				"max-bytes": float64(10),
+			}))
+		})
+
+		It("keeps only that much in all when both go to the same place", func() {
+			output := new(bytes.Buffer)
+
+			df := exec.Command("/bin/df")
+			df.Stdout = output
+			df.Stderr = output
+
+			err := runner.Run(df)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(df.Stdout == df.Stderr).Should(BeTrue())
+			Ω(output.String()).Should(Equal(strings.Repeat("o", 10)))
+		})
+
+		Context("when the output is within it", func() {
+			It("returns the command's result, logging nothing", func() {
+				ls := exec.Command("/bin/ls")
+				ls.Stdout = new(bytes.Buffer)
+
+				err := runner.Run(ls)
+				Ω(err).ShouldNot(HaveOccurred())
+
+				Ω(logger.Logs()).Should(BeEmpty())
+			})
+		})
+
+		Context("when the command also fails", func() {
+			disaster := errors.New("oh no!")
+
+			BeforeEach(func() {
+				fakeRunner.WhenRunning(
+					fake_command_runner.CommandSpec{
+						Path: "/bin/du",
+					},
+					func(cmd *exec.Cmd) error {
+						cmd.Stdout.Write([]byte(strings.Repeat("o", 20)))
+						return disaster
+					},
+				)
+			})
+
+			It("returns the command's error, with what output was kept", func() {
+				output := new(bytes.Buffer)
+
+				du := exec.Command("/bin/du")
+				du.Stdout = output
+
+				err := runner.Run(du)
+				Ω(err).Should(Equal(disaster))
+
+				Ω(output.String()).Should(Equal(strings.Repeat("o", 10)))
+			})
+		})
+	})
+})
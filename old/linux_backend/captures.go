@@ -0,0 +1,209 @@
+package linux_backend
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path"
+	"time"
+
+	"github.com/pivotal-golang/lager"
+)
+
+// CapturesPath is where, in the container, packet captures of its network
+// can be streamed out from. They are written to the container's depot
+// directory by tcpdump, run in its network namespace by net.sh.
+const CapturesPath = "/var/garden/captures"
+
+// CapturesPathProperty reports CapturesPath in Info, for containers started
+// with it mounted.
+const CapturesPathProperty = "captures.path"
+
+// CaptureLimits bound a packet capture, which stops at whichever is reached
+// first, or when stopped. Zero values are taken from DefaultCaptureLimits.
+type CaptureLimits struct {
+	Duration time.Duration
+
+	Packets uint64
+
+	// bytes kept of each packet
+	SnapLength uint32
+}
+
+// DefaultCaptureLimits capture at most 64MB.
+var DefaultCaptureLimits = CaptureLimits{
+	Duration:   time.Minute,
+	Packets:    1000,
+	SnapLength: 65535,
+}
+
+// MaxCaptureDuration and MaxCaptureBytes, which bounds the packets times
+// the bytes kept of each, keep captures from filling the depot.
+const (
+	MaxCaptureDuration = time.Hour
+	MaxCaptureBytes    = 1 << 30
+)
+
+type CaptureLimitsExceededError struct {
+	Limits CaptureLimits
+}
+
+func (e CaptureLimitsExceededError) Error() string {
+	return fmt.Sprintf(
+		"capture of %d packets of %d bytes for %s exceeds the maximum of %d bytes for %s",
+		e.Limits.Packets,
+		e.Limits.SnapLength,
+		e.Limits.Duration,
+		MaxCaptureBytes,
+		MaxCaptureDuration,
+	)
+}
+
+type CaptureInProgressError struct {
+	Handle string
+}
+
+func (e CaptureInProgressError) Error() string {
+	return fmt.Sprintf("container %s is already being captured", e.Handle)
+}
+
+type NoCaptureError struct {
+	Handle string
+}
+
+func (e NoCaptureError) Error() string {
+	return fmt.Sprintf("container %s is not being captured", e.Handle)
+}
+
+// StartCapture starts capturing packets on all of the container's
+// interfaces, returning the path of the capture in the container. Only one
+// capture runs at once. Broken containers are not captured, as their wshd,
+// whose network namespace is entered, may be gone and its pid reused.
+func (c *LinuxContainer) StartCapture(limits CaptureLimits) (string, error) {
+	if c.State() == StateBroken {
+		return "", BrokenContainerError{c.handle}
+	}
+
+	limits, err := limits.withDefaults()
+	if err != nil {
+		return "", err
+	}
+
+	c.captureMutex.Lock()
+	defer c.captureMutex.Unlock()
+
+	if c.capture != nil {
+		return "", CaptureInProgressError{c.handle}
+	}
+
+	err = os.MkdirAll(c.capturesDir(), 0755)
+	if err != nil {
+		return "", err
+	}
+
+	name := time.Now().UTC().Format("20060102T150405.000Z") + ".pcap"
+
+	capture := exec.Command(path.Join(c.path, "net.sh"), "capture")
+	capture.Env = []string{
+		"CAPTURE_PATH=" + path.Join(c.capturesDir(), name),
+		fmt.Sprintf("PACKETS=%d", limits.Packets),
+		fmt.Sprintf("SNAP_LENGTH=%d", limits.SnapLength),
+		"PATH=" + os.Getenv("PATH"),
+	}
+
+	err = c.runner.Start(capture)
+	if err != nil {
+		return "", err
+	}
+
+	c.capture = capture
+
+	capturePath := path.Join(CapturesPath, name)
+
+	go c.watchCapture(capture, capturePath, limits.Duration)
+
+	return capturePath, nil
+}
+
+// StopCapture stops the container's capture, keeping what it has captured.
+func (c *LinuxContainer) StopCapture() error {
+	c.captureMutex.Lock()
+	defer c.captureMutex.Unlock()
+
+	if c.capture == nil {
+		return NoCaptureError{c.handle}
+	}
+
+	err := c.runner.Kill(c.capture)
+	if err != nil {
+		return err
+	}
+
+	c.capture = nil
+
+	return nil
+}
+
+// stopCapture stops the container's capture, if any, as tcpdump runs
+// outside of the container's cgroups and would outlive it.
+func (c *LinuxContainer) stopCapture() {
+	err := c.StopCapture()
+	if _, none := err.(NoCaptureError); err != nil && !none {
+		c.logger.Error("failed-to-stop-capture", err)
+	}
+}
+
+func (c *LinuxContainer) watchCapture(capture *exec.Cmd, capturePath string, duration time.Duration) {
+	timeout := time.AfterFunc(duration, func() {
+		c.captureMutex.Lock()
+		defer c.captureMutex.Unlock()
+
+		if c.capture == capture {
+			c.runner.Kill(capture)
+			c.capture = nil
+		}
+	})
+
+	err := c.runner.Wait(capture)
+
+	timeout.Stop()
+
+	c.captureMutex.Lock()
+
+	if c.capture == capture {
+		c.capture = nil
+	}
+
+	c.captureMutex.Unlock()
+
+	if err != nil {
+		c.logger.Error("capture-failed", err, lager.Data{"capture": capturePath})
+		return
+	}
+
+	c.logger.Info("capture-finished", lager.Data{"capture": capturePath})
+}
+
+func (c *LinuxContainer) capturesDir() string {
+	return path.Join(c.path, "captures")
+}
+
+func (limits CaptureLimits) withDefaults() (CaptureLimits, error) {
+	if limits.Duration <= 0 {
+		limits.Duration = DefaultCaptureLimits.Duration
+	}
+
+	if limits.Packets == 0 {
+		limits.Packets = DefaultCaptureLimits.Packets
+	}
+
+	if limits.SnapLength == 0 {
+		limits.SnapLength = DefaultCaptureLimits.SnapLength
+	}
+
+	if limits.Duration > MaxCaptureDuration || limits.Packets > MaxCaptureBytes/uint64(limits.SnapLength) {
+		return CaptureLimits{}, CaptureLimitsExceededError{limits}
+	}
+
+	return limits, nil
+}
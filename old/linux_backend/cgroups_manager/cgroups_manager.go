@@ -1,7 +1,20 @@
 package cgroups_manager
 
+import (
+	"os"
+	"path"
+)
+
 type CgroupsManager interface {
 	Set(subsystem, name, value string) error
 	Get(subsystem, name string) (string, error)
 	SubsystemPath(subsystem string) string
 }
+
+// SwapAccountingEnabled says whether the memory cgroup mounted under
+// cgroupsPath can limit memory and swap together, which needs the kernel to
+// be booted with swapaccount=1.
+func SwapAccountingEnabled(cgroupsPath string) bool {
+	_, err := os.Stat(path.Join(cgroupsPath, "memory", "memory.memsw.limit_in_bytes"))
+	return err == nil
+}
@@ -0,0 +1,41 @@
+package cgroups_manager_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/cloudfoundry-incubator/garden-linux/old/linux_backend/cgroups_manager"
+)
+
+var _ = Describe("Detecting swap accounting", func() {
+	var cgroupsPath string
+
+	BeforeEach(func() {
+		tmpdir, err := ioutil.TempDir(os.TempDir(), "some-cgroups")
+		Ω(err).ShouldNot(HaveOccurred())
+
+		cgroupsPath = tmpdir
+
+		err = os.MkdirAll(path.Join(cgroupsPath, "memory"), 0755)
+		Ω(err).ShouldNot(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(cgroupsPath)
+	})
+
+	It("is enabled when the memory cgroup can limit swap", func() {
+		err := ioutil.WriteFile(path.Join(cgroupsPath, "memory", "memory.memsw.limit_in_bytes"), []byte("-1\n"), 0644)
+		Ω(err).ShouldNot(HaveOccurred())
+
+		Ω(cgroups_manager.SwapAccountingEnabled(cgroupsPath)).Should(BeTrue())
+	})
+
+	It("is disabled when the memory cgroup cannot limit swap", func() {
+		Ω(cgroups_manager.SwapAccountingEnabled(cgroupsPath)).Should(BeFalse())
+	})
+})
@@ -0,0 +1,165 @@
+package cgroups_manager
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// DeviceRule is an entry in a container's devices cgroup whitelist, e.g.
+// "c 1:3 rwm": a type (a for all, b for block or c for character), a
+// major:minor pair in which either may be *, and the access allowed (some
+// of r, w and m).
+type DeviceRule struct {
+	Type   string
+	Major  string
+	Minor  string
+	Access string
+}
+
+type MalformedDeviceRuleError struct {
+	Rule   string
+	Reason string
+}
+
+func (e MalformedDeviceRuleError) Error() string {
+	return fmt.Sprintf("malformed device rule %q: %s", e.Rule, e.Reason)
+}
+
+// DefaultDeviceRules are the devices a container may use unless configured
+// otherwise.
+var DefaultDeviceRules = []DeviceRule{
+	// mknod for everything
+	{"c", "*", "*", "m"},
+	{"b", "*", "*", "m"},
+
+	{"c", "1", "3", "rwm"},   // /dev/null
+	{"c", "1", "5", "rwm"},   // /dev/zero
+	{"c", "1", "7", "rwm"},   // /dev/full
+	{"c", "1", "8", "rwm"},   // /dev/random
+	{"c", "1", "9", "rwm"},   // /dev/urandom
+	{"c", "4", "0", "rwm"},   // /dev/tty0
+	{"c", "4", "1", "rwm"},   // /dev/tty1
+	{"c", "5", "0", "rwm"},   // /dev/tty
+	{"c", "5", "1", "rwm"},   // /dev/console
+	{"c", "5", "2", "rwm"},   // /dev/ptmx
+	{"c", "136", "*", "rwm"}, // /dev/pts/*
+}
+
+// TunDeviceRule and FuseDeviceRule allow /dev/net/tun and /dev/fuse, which
+// containers must opt in to.
+var (
+	TunDeviceRule  = DeviceRule{"c", "10", "200", "rwm"}
+	FuseDeviceRule = DeviceRule{"c", "10", "229", "rwm"}
+)
+
+func ParseDeviceRule(rule string) (DeviceRule, error) {
+	fields := strings.Fields(rule)
+
+	if len(fields) == 1 && fields[0] == "a" {
+		return DeviceRule{Type: "a", Major: "*", Minor: "*", Access: "rwm"}, nil
+	}
+
+	if len(fields) != 3 {
+		return DeviceRule{}, MalformedDeviceRuleError{rule, "expected type, major:minor and access"}
+	}
+
+	switch fields[0] {
+	case "a", "b", "c":
+	default:
+		return DeviceRule{}, MalformedDeviceRuleError{rule, "type must be a, b or c"}
+	}
+
+	numbers := strings.Split(fields[1], ":")
+	if len(numbers) != 2 || !validDeviceNumber(numbers[0]) || !validDeviceNumber(numbers[1]) {
+		return DeviceRule{}, MalformedDeviceRuleError{rule, "major:minor must be numbers or *"}
+	}
+
+	access := fields[2]
+	if access == "" || strings.Trim(access, "rwm") != "" {
+		return DeviceRule{}, MalformedDeviceRuleError{rule, "access must be some of r, w and m"}
+	}
+
+	return DeviceRule{
+		Type:   fields[0],
+		Major:  numbers[0],
+		Minor:  numbers[1],
+		Access: access,
+	}, nil
+}
+
+// ParseDeviceRules parses a comma-separated list of device rules.
+func ParseDeviceRules(rules string) ([]DeviceRule, error) {
+	parsed := []DeviceRule{}
+
+	if strings.TrimSpace(rules) == "" {
+		return parsed, nil
+	}
+
+	for _, rule := range strings.Split(rules, ",") {
+		deviceRule, err := ParseDeviceRule(rule)
+		if err != nil {
+			return nil, err
+		}
+
+		parsed = append(parsed, deviceRule)
+	}
+
+	return parsed, nil
+}
+
+// FormatDeviceRules is the inverse of ParseDeviceRules.
+func FormatDeviceRules(rules []DeviceRule) string {
+	formatted := make([]string, len(rules))
+	for i, rule := range rules {
+		formatted[i] = rule.String()
+	}
+
+	return strings.Join(formatted, ",")
+}
+
+func (r DeviceRule) String() string {
+	return fmt.Sprintf("%s %s:%s %s", r.Type, r.Major, r.Minor, r.Access)
+}
+
+// ApplyDeviceRules creates the container's devices cgroup, denies it all
+// devices, and then allows those in rules. It must be done before the
+// container's processes join the cgroup.
+func ApplyDeviceRules(manager CgroupsManager, rules []DeviceRule) error {
+	err := os.MkdirAll(manager.SubsystemPath("devices"), 0755)
+	if err != nil {
+		return err
+	}
+
+	err = manager.Set("devices", "devices.deny", "a")
+	if err != nil {
+		return err
+	}
+
+	for _, rule := range rules {
+		err := manager.Set("devices", "devices.allow", rule.String())
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func validDeviceNumber(number string) bool {
+	if number == "*" {
+		return true
+	}
+
+	if number == "" {
+		return false
+	}
+
+	for _, digit := range number {
+		if digit < '0' || digit > '9' {
+			return false
+		}
+	}
+
+	return true
+}
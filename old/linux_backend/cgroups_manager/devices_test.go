@@ -0,0 +1,144 @@
+package cgroups_manager_test
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/cloudfoundry-incubator/garden-linux/old/linux_backend/cgroups_manager"
+	"github.com/cloudfoundry-incubator/garden-linux/old/linux_backend/cgroups_manager/fake_cgroups_manager"
+)
+
+var _ = Describe("Device rules", func() {
+	Describe("parsing", func() {
+		It("parses a type, major:minor and access", func() {
+			rule, err := cgroups_manager.ParseDeviceRule("c 10:200 rwm")
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(rule).Should(Equal(cgroups_manager.DeviceRule{
+				Type:   "c",
+				Major:  "10",
+				Minor:  "200",
+				Access: "rwm",
+			}))
+		})
+
+		It("allows wildcard device numbers", func() {
+			rule, err := cgroups_manager.ParseDeviceRule("b *:* m")
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(rule.Major).Should(Equal("*"))
+			Ω(rule.Minor).Should(Equal("*"))
+		})
+
+		It("treats a lone a as all devices", func() {
+			rule, err := cgroups_manager.ParseDeviceRule("a")
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(rule.String()).Should(Equal("a *:* rwm"))
+		})
+
+		It("ignores surrounding whitespace", func() {
+			rule, err := cgroups_manager.ParseDeviceRule("  c 1:3 rwm ")
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(rule.String()).Should(Equal("c 1:3 rwm"))
+		})
+
+		for _, malformed := range []string{
+			"",
+			"c 1:3",
+			"x 1:3 rwm",
+			"c 1 rwm",
+			"c 1:three rwm",
+			"c 1:3 rwx",
+			"c 1:3 rwm extra",
+		} {
+			malformed := malformed
+
+			It("rejects "+malformed, func() {
+				_, err := cgroups_manager.ParseDeviceRule(malformed)
+				Ω(err).Should(BeAssignableToTypeOf(cgroups_manager.MalformedDeviceRuleError{}))
+			})
+		}
+
+		It("parses a comma-separated list", func() {
+			rules, err := cgroups_manager.ParseDeviceRules("c 1:3 rwm,c 10:200 rwm")
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(rules).Should(HaveLen(2))
+			Ω(rules[1].Minor).Should(Equal("200"))
+		})
+
+		It("parses an empty list as no rules", func() {
+			rules, err := cgroups_manager.ParseDeviceRules("")
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(rules).Should(BeEmpty())
+		})
+
+		It("fails if any rule in a list is malformed", func() {
+			_, err := cgroups_manager.ParseDeviceRules("c 1:3 rwm,bogus")
+			Ω(err).Should(HaveOccurred())
+		})
+
+		It("round-trips the default rules", func() {
+			rules, err := cgroups_manager.ParseDeviceRules(cgroups_manager.FormatDeviceRules(cgroups_manager.DefaultDeviceRules))
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(rules).Should(Equal(cgroups_manager.DefaultDeviceRules))
+		})
+	})
+
+	Describe("applying", func() {
+		var cgroupsPath string
+		var fakeCgroups *fake_cgroups_manager.FakeCgroupsManager
+
+		BeforeEach(func() {
+			tmpdir, err := ioutil.TempDir(os.TempDir(), "some-cgroups")
+			Ω(err).ShouldNot(HaveOccurred())
+
+			cgroupsPath = tmpdir
+
+			fakeCgroups = fake_cgroups_manager.New(cgroupsPath, "some-id")
+		})
+
+		AfterEach(func() {
+			os.RemoveAll(cgroupsPath)
+		})
+
+		It("creates the devices cgroup", func() {
+			err := cgroups_manager.ApplyDeviceRules(fakeCgroups, nil)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			info, err := os.Stat(path.Join(cgroupsPath, "devices", "instance-some-id"))
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(info.IsDir()).Should(BeTrue())
+		})
+
+		It("denies everything and then allows each rule in order", func() {
+			err := cgroups_manager.ApplyDeviceRules(fakeCgroups, []cgroups_manager.DeviceRule{
+				{Type: "c", Major: "1", Minor: "3", Access: "rwm"},
+				{Type: "c", Major: "10", Minor: "200", Access: "rwm"},
+			})
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(fakeCgroups.SetValues()).Should(Equal([]fake_cgroups_manager.SetValue{
+				{Subsystem: "devices", Name: "devices.deny", Value: "a"},
+				{Subsystem: "devices", Name: "devices.allow", Value: "c 1:3 rwm"},
+				{Subsystem: "devices", Name: "devices.allow", Value: "c 10:200 rwm"},
+			}))
+		})
+
+		It("returns an error if the whitelist cannot be written", func() {
+			disaster := errors.New("oh no!")
+			fakeCgroups.SetError = disaster
+
+			err := cgroups_manager.ApplyDeviceRules(fakeCgroups, cgroups_manager.DefaultDeviceRules)
+			Ω(err).Should(Equal(disaster))
+		})
+	})
+})
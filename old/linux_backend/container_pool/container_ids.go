@@ -0,0 +1,180 @@
+package container_pool
+
+import (
+	"crypto/rand"
+	"fmt"
+	"regexp"
+	"strconv"
+
+	"github.com/pivotal-golang/lager"
+)
+
+// IDScheme decides what the IDs of new containers look like.
+type IDScheme string
+
+const (
+	// TimestampIDs are 11 base32 digits counting up from when the pool was
+	// made; short, but only unique for the life of the process
+	TimestampIDs IDScheme = "timestamp"
+
+	// RandomIDs are 20 random base32 digits
+	RandomIDs IDScheme = "random"
+)
+
+type UnknownIDSchemeError struct {
+	Scheme string
+}
+
+func (e UnknownIDSchemeError) Error() string {
+	return fmt.Sprintf("unknown container ID scheme: %s", e.Scheme)
+}
+
+type InvalidIDPrefixError struct {
+	Prefix string
+}
+
+func (e InvalidIDPrefixError) Error() string {
+	return fmt.Sprintf("invalid container ID prefix %q: must be lowercase letters, digits and dashes", e.Prefix)
+}
+
+type InterfaceNameCollisionError struct {
+	Name    string
+	TakenBy string
+}
+
+func (e InterfaceNameCollisionError) Error() string {
+	return fmt.Sprintf("interface name %s is taken by container %s", e.Name, e.TakenBy)
+}
+
+func ParseIDScheme(scheme string) (IDScheme, error) {
+	switch IDScheme(scheme) {
+	case TimestampIDs, RandomIDs:
+		return IDScheme(scheme), nil
+	default:
+		return "", UnknownIDSchemeError{scheme}
+	}
+}
+
+// IDs name depot directories, cgroups and iptables chains
+var validIDPrefix = regexp.MustCompile(`^[a-z0-9-]*$`)
+
+// GenerateIDs has the pool give new containers IDs of the given scheme,
+// starting with the prefix, so that they can be told apart from other
+// hosts' containers. Interface and iptables chain names are made from the
+// tail of IDs, so prefixes do not make them longer. It must be called
+// before the pool is used.
+func (p *LinuxContainerPool) GenerateIDs(scheme IDScheme, prefix string) error {
+	if !validIDPrefix.MatchString(prefix) {
+		return InvalidIDPrefixError{prefix}
+	}
+
+	p.idScheme = scheme
+	p.idPrefix = prefix
+
+	return nil
+}
+
+// generateContainerID returns an ID for a new container, whose interface
+// name is not that of any other container. The name is claimed until
+// released.
+func (p *LinuxContainerPool) generateContainerID() string {
+	p.idMutex.Lock()
+	defer p.idMutex.Unlock()
+
+	for {
+		id := p.idPrefix + p.nextID()
+
+		name := p.interfaceName(id)
+		if owner, taken := p.interfaceNames[name]; taken {
+			p.logger.Info("skipped-id-with-colliding-interface-name", lager.Data{
+				"id":       id,
+				"name":     name,
+				"taken-by": owner,
+			})
+
+			continue
+		}
+
+		p.interfaceNames[name] = id
+
+		return id
+	}
+}
+
+// interfaceName is the part of a container's network interfaces' names
+// that comes from its ID, as given to setup.sh. Interface names are limited
+// to 15 characters, which must leave room for the host's prefix and a "-N"
+// suffix, so only the tail of long IDs is used, and different IDs can have
+// the same name.
+func (p *LinuxContainerPool) interfaceName(id string) string {
+	maxLen := 15 - len(p.sysconfig.NetworkInterfacePrefix) - 2
+	if maxLen < 1 || len(id) <= maxLen {
+		return id
+	}
+
+	return id[len(id)-maxLen:]
+}
+
+// claimInterfaceName records that a restored container has its interface
+// name. Containers restored with the same name as another are only logged,
+// as they exist already.
+func (p *LinuxContainerPool) claimInterfaceName(logger lager.Logger, id string) {
+	p.idMutex.Lock()
+	defer p.idMutex.Unlock()
+
+	name := p.interfaceName(id)
+	if owner, taken := p.interfaceNames[name]; taken && owner != id {
+		logger.Error("colliding-interface-name", InterfaceNameCollisionError{name, owner})
+		return
+	}
+
+	p.interfaceNames[name] = id
+}
+
+func (p *LinuxContainerPool) releaseInterfaceName(id string) {
+	p.idMutex.Lock()
+	defer p.idMutex.Unlock()
+
+	name := p.interfaceName(id)
+	if p.interfaceNames[name] == id {
+		delete(p.interfaceNames, name)
+	}
+}
+
+func (p *LinuxContainerPool) nextID() string {
+	if p.idScheme == RandomIDs {
+		return randomID()
+	}
+
+	containerNum := p.nextContainerNum
+	p.nextContainerNum++
+
+	containerID := []byte{}
+
+	var i uint
+	for i = 0; i < 11; i++ {
+		containerID = strconv.AppendInt(
+			containerID,
+			(containerNum>>(55-(i+1)*5))&31,
+			32,
+		)
+	}
+
+	return string(containerID)
+}
+
+func randomID() string {
+	random := make([]byte, 20)
+
+	_, err := rand.Read(random)
+	if err != nil {
+		panic("cannot read random bytes: " + err.Error())
+	}
+
+	containerID := []byte{}
+	for _, b := range random {
+		containerID = strconv.AppendInt(containerID, int64(b&31), 32)
+	}
+
+	return string(containerID)
+}
@@ -6,12 +6,15 @@ import (
 	"fmt"
 	"io"
 	"io/ioutil"
+	"net"
 	"net/url"
 	"os"
 	"os/exec"
 	"path"
+	"regexp"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/cloudfoundry-incubator/garden/api"
@@ -22,16 +25,64 @@ import (
 	"github.com/cloudfoundry-incubator/garden-linux/old/linux_backend/bandwidth_manager"
 	"github.com/cloudfoundry-incubator/garden-linux/old/linux_backend/cgroups_manager"
 	"github.com/cloudfoundry-incubator/garden-linux/old/linux_backend/container_pool/rootfs_provider"
+	"github.com/cloudfoundry-incubator/garden-linux/old/linux_backend/env"
+	"github.com/cloudfoundry-incubator/garden-linux/old/linux_backend/external_ip_pool"
+	"github.com/cloudfoundry-incubator/garden-linux/old/linux_backend/iptables_manager"
+	"github.com/cloudfoundry-incubator/garden-linux/old/linux_backend/network"
+	"github.com/cloudfoundry-incubator/garden-linux/old/linux_backend/network_plugin"
 	"github.com/cloudfoundry-incubator/garden-linux/old/linux_backend/network_pool"
+	"github.com/cloudfoundry-incubator/garden-linux/old/linux_backend/numa_placer"
 	"github.com/cloudfoundry-incubator/garden-linux/old/linux_backend/process_tracker"
 	"github.com/cloudfoundry-incubator/garden-linux/old/linux_backend/quota_manager"
+	"github.com/cloudfoundry-incubator/garden-linux/old/linux_backend/selinux_labeler"
 	"github.com/cloudfoundry-incubator/garden-linux/old/linux_backend/uid_pool"
+	"github.com/cloudfoundry-incubator/garden-linux/old/linux_backend/volume_manager"
 	"github.com/cloudfoundry-incubator/garden-linux/old/logging"
 	"github.com/cloudfoundry-incubator/garden-linux/old/sysconfig"
 )
 
 var ErrUnknownRootFSProvider = errors.New("unknown rootfs provider")
 
+type InvalidExternalIPError struct {
+	IP string
+}
+
+func (e InvalidExternalIPError) Error() string {
+	return "invalid external ip: " + e.IP
+}
+
+type ReservedPropertyError struct {
+	Name string
+}
+
+func (e ReservedPropertyError) Error() string {
+	return fmt.Sprintf("property %s is reserved for annotations, which are set by the server", e.Name)
+}
+
+type InvalidBoolPropertyError struct {
+	Property string
+	Value    string
+}
+
+func (e InvalidBoolPropertyError) Error() string {
+	return "invalid value for " + e.Property + ": " + e.Value
+}
+
+// ResourceConflictsError reports every pool's conflicts found while
+// preclaiming the resources of containers to restore.
+type ResourceConflictsError struct {
+	Conflicts []error
+}
+
+func (e ResourceConflictsError) Error() string {
+	conflicts := []string{}
+	for _, conflict := range e.Conflicts {
+		conflicts = append(conflicts, conflict.Error())
+	}
+
+	return "conflicting resources in snapshots: " + strings.Join(conflicts, "; ")
+}
+
 type LinuxContainerPool struct {
 	logger lager.Logger
 
@@ -49,11 +100,78 @@ type LinuxContainerPool struct {
 	networkPool network_pool.NetworkPool
 	portPool    linux_backend.PortPool
 
+	additionalNetworkPools []network_pool.NetworkPool
+	externalIPPool         external_ip_pool.ExternalIPPool
+
 	runner command_runner.CommandRunner
 
 	quotaManager quota_manager.QuotaManager
 
-	containerIDs chan string
+	// volumeManager is optional; with it, containers whose rootfs is an
+	// overlay have a volume of their own as its writable branch
+	volumeManager volume_manager.VolumeManager
+
+	// networkPlugin is optional
+	networkPlugin network_plugin.NetworkPlugin
+
+	// if set, containers have no veth pairs; the network plugin builds their
+	// links instead
+	networkPluginBuildsLinks bool
+
+	// whether containers' /proc and /sys are hardened, and the AppArmor
+	// profile, if any, that their processes are confined with, unless their
+	// properties say otherwise
+	hardenProcSys   bool
+	appArmorProfile string
+
+	// see ConfigureDNS
+	dns dnsOptions
+
+	// selinuxLabeler is optional; without it containers are not labelled
+	selinuxLabeler *selinux_labeler.Labeler
+
+	// whitelisted in each container's devices cgroup
+	deviceRules []cgroups_manager.DeviceRule
+
+	// numaPlacer is optional; without it containers may use every node
+	numaPlacer numa_placer.Placer
+
+	// applied to containers' processes that do not set their own
+	defaultRLimits api.ResourceLimits
+
+	// guards the networks and limits above, which can be changed while
+	// running
+	settingsMutex *sync.RWMutex
+
+	validateRestoredNetworks bool
+
+	// annotated on the containers it creates
+	gardenVersion string
+
+	// containers whose pool resources were removed by Preclaim
+	preclaimed      map[string]bool
+	preclaimedMutex *sync.Mutex
+
+	growNetworkMutex *sync.Mutex
+
+	// detected by Setup
+	swapAccounting bool
+
+	// see SkipHostSetup
+	skipHostSetup bool
+
+	// set by ReapInBackground; without it, containers' files are removed
+	// as they are destroyed
+	reapQueue chan reapJob
+
+	// see GenerateIDs
+	idScheme         IDScheme
+	idPrefix         string
+	nextContainerNum int64
+	idMutex          *sync.Mutex
+
+	// the container each claimed interface name belongs to
+	interfaceNames map[string]string
 }
 
 func New(
@@ -63,10 +181,19 @@ func New(
 	rootfsProviders map[string]rootfs_provider.RootFSProvider,
 	uidPool uid_pool.UIDPool,
 	networkPool network_pool.NetworkPool,
+	additionalNetworkPools []network_pool.NetworkPool,
+	externalIPPool external_ip_pool.ExternalIPPool,
 	portPool linux_backend.PortPool,
 	denyNetworks, allowNetworks []string,
 	runner command_runner.CommandRunner,
 	quotaManager quota_manager.QuotaManager,
+	volumeManager volume_manager.VolumeManager,
+	networkPlugin network_plugin.NetworkPlugin,
+	deviceRules []cgroups_manager.DeviceRule,
+	numaPlacer numa_placer.Placer,
+	defaultRLimits api.ResourceLimits,
+	validateRestoredNetworks bool,
+	gardenVersion string,
 ) *LinuxContainerPool {
 	pool := &LinuxContainerPool{
 		logger: logger.Session("pool"),
@@ -85,20 +212,50 @@ func New(
 		networkPool: networkPool,
 		portPool:    portPool,
 
+		additionalNetworkPools: additionalNetworkPools,
+		externalIPPool:         externalIPPool,
+
 		runner: runner,
 
-		quotaManager: quotaManager,
+		quotaManager:  quotaManager,
+		volumeManager: volumeManager,
 
-		containerIDs: make(chan string),
-	}
+		networkPlugin: networkPlugin,
+
+		deviceRules: deviceRules,
+
+		numaPlacer: numaPlacer,
 
-	go pool.generateContainerIDs()
+		defaultRLimits: defaultRLimits,
+
+		validateRestoredNetworks: validateRestoredNetworks,
+
+		gardenVersion: gardenVersion,
+
+		preclaimed:      map[string]bool{},
+		preclaimedMutex: new(sync.Mutex),
+
+		growNetworkMutex: new(sync.Mutex),
+		settingsMutex:    new(sync.RWMutex),
+
+		idScheme:         TimestampIDs,
+		nextContainerNum: time.Now().UnixNano(),
+		idMutex:          new(sync.Mutex),
+
+		interfaceNames: map[string]string{},
+	}
 
 	return pool
 }
 
 func (p *LinuxContainerPool) MaxContainers() int {
 	maxNet := p.networkPool.InitialSize()
+	for _, pool := range p.additionalNetworkPools {
+		if pool.InitialSize() < maxNet {
+			maxNet = pool.InitialSize()
+		}
+	}
+
 	maxUid := p.uidPool.InitialSize()
 	if maxNet < maxUid {
 		return maxNet
@@ -106,30 +263,299 @@ func (p *LinuxContainerPool) MaxContainers() int {
 	return maxUid
 }
 
+// Utilization reports how much of each of the pools that containers draw
+// from is free. Additional network pools are named after their network.
+func (p *LinuxContainerPool) Utilization() []linux_backend.PoolUtilization {
+	utilization := []linux_backend.PoolUtilization{
+		{Pool: "uid", Free: p.uidPool.Available(), Total: p.uidPool.InitialSize()},
+		{Pool: "network", Free: p.networkPool.Available(), Total: p.networkPool.InitialSize()},
+		{Pool: "port", Free: p.portPool.Available(), Total: p.portPool.InitialSize()},
+	}
+
+	for _, pool := range p.additionalNetworkPools {
+		utilization = append(utilization, linux_backend.PoolUtilization{
+			Pool:  "network:" + pool.Network().String(),
+			Free:  pool.Available(),
+			Total: pool.InitialSize(),
+		})
+	}
+
+	if p.numaPlacer != nil {
+		utilization = append(utilization, p.numaUtilization()...)
+	}
+
+	return utilization
+}
+
+// numaUtilization reports each NUMA node as a pool of an even share of the
+// maximum containers.
+func (p *LinuxContainerPool) numaUtilization() []linux_backend.PoolUtilization {
+	nodes := p.numaPlacer.Utilization()
+	if len(nodes) == 0 {
+		return nil
+	}
+
+	share := (p.MaxContainers() + len(nodes) - 1) / len(nodes)
+
+	utilization := []linux_backend.PoolUtilization{}
+	for _, node := range nodes {
+		free := share - node.Containers
+		if free < 0 {
+			free = 0
+		}
+
+		utilization = append(utilization, linux_backend.PoolUtilization{
+			Pool:  fmt.Sprintf("numa:node%d", node.Node.ID),
+			Free:  free,
+			Total: share,
+		})
+	}
+
+	return utilization
+}
+
+// HostNotSetUpError is returned by Setup when the host was to have been set
+// up separately, but was not.
+type HostNotSetUpError struct {
+	Reason string
+}
+
+func (e HostNotSetUpError) Error() string {
+	return "host has not been set up: " + e.Reason
+}
+
+// SkipHostSetup has Setup leave the host as it is, assuming SetUpHost has
+// been run already, e.g. at boot, by a separate garden-linux setup.
+func (p *LinuxContainerPool) SkipHostSetup() {
+	p.skipHostSetup = true
+}
+
+// DelegateLinksToNetworkPlugin has the network plugin build each
+// container's links once it has started, rather than the container's hooks
+// making veth pairs to it from the host. It must be called before the pool
+// is used, with a network plugin, and must not change while containers
+// exist.
+func (p *LinuxContainerPool) DelegateLinksToNetworkPlugin() {
+	p.networkPluginBuildsLinks = true
+}
+
+// HardenProcSys has the pool harden containers' /proc and /sys unless they
+// opt out with linux_backend.HardenProcSysProperty. It must be called before
+// the pool is used.
+func (p *LinuxContainerPool) HardenProcSys() {
+	p.hardenProcSys = true
+}
+
+// ConfineWithAppArmor has the pool confine containers' processes with the
+// AppArmor profile, on hosts with AppArmor, unless they select another with
+// linux_backend.AppArmorProfileProperty. Setting up the host then loads the
+// profiles shipped in the bin path, rather than disabling AppArmor. It must
+// be called before the pool is used.
+func (p *LinuxContainerPool) ConfineWithAppArmor(profile string) {
+	p.appArmorProfile = profile
+}
+
+// LabelWithSELinux has the pool label each container's rootfs and
+// processes with MCS categories of its own, derived from its UID. It must
+// be called before the pool is used, on a host with SELinux enabled, and the
+// labeler's contexts must not change while containers exist.
+func (p *LinuxContainerPool) LabelWithSELinux(labeler *selinux_labeler.Labeler) {
+	p.selinuxLabeler = labeler
+}
+
+// ConfigureDNS has the pool write the nameservers and search domains to new
+// containers' /etc/resolv.conf, unless they request their own with
+// linux_backend.DNSServersProperty and DNSSearchDomainsProperty, rather than
+// copying the host's. Either may be empty, leaving the host's in place. It
+// must be called before the pool is used.
+func (p *LinuxContainerPool) ConfigureDNS(servers, searchDomains []string) error {
+	parsedServers, err := parseDNSServers(strings.Join(servers, ","))
+	if err != nil {
+		return err
+	}
+
+	parsedDomains, err := parseSearchDomains(strings.Join(searchDomains, ","))
+	if err != nil {
+		return err
+	}
+
+	p.dns = dnsOptions{
+		servers:       parsedServers,
+		searchDomains: parsedDomains,
+	}
+
+	return nil
+}
+
+// Setup prepares the pool for creating containers, setting up the host
+// first unless SkipHostSetup was called.
 func (p *LinuxContainerPool) Setup() error {
+	if p.skipHostSetup {
+		if _, err := os.Stat(p.sysconfig.CgroupPath); err != nil {
+			return HostNotSetUpError{"no cgroups at " + p.sysconfig.CgroupPath}
+		}
+	} else {
+		err := p.SetUpHost()
+		if err != nil {
+			return err
+		}
+	}
+
+	p.swapAccounting = cgroups_manager.SwapAccountingEnabled(p.sysconfig.CgroupPath)
+
+	return nil
+}
+
+// SetUpHost makes the host-wide changes that containers need: mounting
+// cgroups, creating the server's iptables chains, and enabling disk quotas.
+// It is idempotent, and needs root.
+func (p *LinuxContainerPool) SetUpHost() error {
+	p.settingsMutex.RLock()
+	denyNetworks, allowNetworks := p.denyNetworks, p.allowNetworks
+	p.settingsMutex.RUnlock()
+
 	setup := exec.Command(path.Join(p.binPath, "setup.sh"))
 	setup.Env = []string{
 		"POOL_NETWORK=" + p.networkPool.Network().String(),
-		"DENY_NETWORKS=" + formatNetworks(p.denyNetworks),
-		"ALLOW_NETWORKS=" + formatNetworks(p.allowNetworks),
+		"DENY_NETWORKS=" + formatNetworks(denyNetworks),
+		"ALLOW_NETWORKS=" + formatNetworks(allowNetworks),
 		"CONTAINER_DEPOT_PATH=" + p.depotPath,
 		"CONTAINER_DEPOT_MOUNT_POINT_PATH=" + p.quotaManager.MountPoint(),
 		fmt.Sprintf("DISK_QUOTA_ENABLED=%v", p.quotaManager.IsEnabled()),
+		"APPARMOR_PROFILE=" + p.appArmorProfile,
+		"PATH=" + os.Getenv("PATH"),
+	}
+
+	return p.runner.Run(setup)
+}
+
+// SwapAccounting says whether containers' memory limits also limit swap.
+func (p *LinuxContainerPool) SwapAccounting() bool {
+	return p.swapAccounting
+}
+
+// GrowPortPool extends the port pool to size ports.
+func (p *LinuxContainerPool) GrowPortPool(size uint32) error {
+	return p.portPool.Grow(size)
+}
+
+// AcquirePort takes a host port from the port pool without giving it to a
+// container: the given port, or any free one if it is 0.
+func (p *LinuxContainerPool) AcquirePort(port uint32) (uint32, error) {
+	if port == 0 {
+		return p.portPool.Acquire()
+	}
+
+	err := p.portPool.Remove(port)
+	if err != nil {
+		return 0, err
+	}
+
+	return port, nil
+}
+
+// ReleasePort returns a port taken by AcquirePort to the port pool.
+func (p *LinuxContainerPool) ReleasePort(port uint32) {
+	p.portPool.Release(port)
+}
+
+// GrowNetworkPool extends the network pool to ipNet, which must contain its
+// current network. The pool's NAT is moved over first, so that containers on
+// the new networks can reach out as soon as they are handed out.
+func (p *LinuxContainerPool) GrowNetworkPool(ipNet *net.IPNet) error {
+	p.growNetworkMutex.Lock()
+	defer p.growNetworkMutex.Unlock()
+
+	oldNet := p.networkPool.Network()
+
+	// checked up front, as the NAT would otherwise be moved to a network the
+	// pool then refuses
+	ones, _ := oldNet.Mask.Size()
+	newOnes, _ := ipNet.Mask.Size()
+	if newOnes > ones || !ipNet.Contains(oldNet.IP) {
+		return network_pool.CannotShrinkError{Network: oldNet, NewNetwork: ipNet}
+	}
+
+	grow := exec.Command(path.Join(p.binPath, "net.sh"), "grow_pool")
+	grow.Env = []string{
+		"POOL_NETWORK=" + ipNet.String(),
+		"OLD_POOL_NETWORK=" + oldNet.String(),
 		"PATH=" + os.Getenv("PATH"),
 	}
 
-	err := p.runner.Run(setup)
+	err := p.runner.Run(grow)
 	if err != nil {
 		return err
 	}
 
+	return p.networkPool.Grow(ipNet)
+}
+
+// SetNetworkFilters replaces the networks that containers are denied and
+// allowed by default, as when the server's configuration is reloaded. The
+// host's rules are replaced at once; containers' own net out rules are
+// left as they are.
+func (p *LinuxContainerPool) SetNetworkFilters(denyNetworks, allowNetworks []string) error {
+	p.settingsMutex.Lock()
+	defer p.settingsMutex.Unlock()
+
+	filter := exec.Command(path.Join(p.binPath, "net.sh"), "filter_default")
+	filter.Env = []string{
+		"DENY_NETWORKS=" + formatNetworks(denyNetworks),
+		"ALLOW_NETWORKS=" + formatNetworks(allowNetworks),
+		"PATH=" + os.Getenv("PATH"),
+	}
+
+	err := p.runner.Run(filter)
+	if err != nil {
+		return err
+	}
+
+	p.denyNetworks = denyNetworks
+	p.allowNetworks = allowNetworks
+
 	return nil
 }
 
+// SetDefaultRLimits replaces the rlimits applied to the processes of
+// containers created or restored from now on that do not set their own.
+func (p *LinuxContainerPool) SetDefaultRLimits(limits api.ResourceLimits) {
+	p.settingsMutex.Lock()
+	defer p.settingsMutex.Unlock()
+
+	p.defaultRLimits = limits
+}
+
+func (p *LinuxContainerPool) currentDefaultRLimits() api.ResourceLimits {
+	p.settingsMutex.RLock()
+	defer p.settingsMutex.RUnlock()
+
+	return p.defaultRLimits
+}
+
 func formatNetworks(networks []string) string {
 	return strings.Join(networks, " ")
 }
 
+func formatIP(ip net.IP) string {
+	if ip == nil {
+		return ""
+	}
+
+	return ip.String()
+}
+
+// formatAttachments renders networks as space-separated host_ip,container_ip
+// pairs, as understood by create.sh
+func formatAttachments(networks []*network.Network) string {
+	attachments := []string{}
+	for _, network := range networks {
+		attachments = append(attachments, fmt.Sprintf("%s,%s", network.HostIP(), network.ContainerIP()))
+	}
+
+	return strings.Join(attachments, " ")
+}
+
 func (p *LinuxContainerPool) Prune(keep map[string]bool) error {
 	entries, err := ioutil.ReadDir(p.depotPath)
 	if err != nil {
@@ -153,17 +579,42 @@ func (p *LinuxContainerPool) Prune(keep map[string]bool) error {
 
 		pLog.Info("pruning")
 
-		err = p.releaseSystemResources(pLog, id)
+		if p.reapQueue != nil {
+			err = p.bury(pLog, id, 0)
+		} else {
+			err = p.releaseSystemResources(pLog, id)
+		}
+
 		if err != nil {
 			return err
 		}
+
+		p.releaseInterfaceName(id)
 	}
 
 	return nil
 }
 
 func (p *LinuxContainerPool) Create(spec api.ContainerSpec) (c linux_backend.Container, err error) {
-	id := <-p.containerIDs
+	err = validateSpec(spec)
+	if err != nil {
+		p.logger.Error("invalid-spec", err, lager.Data{"handle": spec.Handle})
+		return nil, err
+	}
+
+	// validated with the rest of the spec
+	devices, _ := parseOptionalDevices(spec.Properties)
+	security, _ := parseSecurityOptions(spec.Properties, devices, securityOptions{
+		hardenProcSys:   p.hardenProcSys,
+		appArmorProfile: p.appArmorProfile,
+	})
+	dns, _ := parseDNSOptions(spec.Properties, p.dns)
+
+	id := p.generateContainerID()
+	defer cleanup(&err, func() {
+		p.releaseInterfaceName(id)
+	})
+
 	containerPath := path.Join(p.depotPath, id)
 	pLog := p.logger.Session(id)
 
@@ -177,31 +628,134 @@ func (p *LinuxContainerPool) Create(spec api.ContainerSpec) (c linux_backend.Con
 		p.releasePoolResources(resources)
 	})
 
-	rootFSEnvVars, err := p.aquireSystemResources(id, containerPath, spec.RootFSPath, resources, spec.BindMounts, pLog)
+	if requested, found := spec.Properties[linux_backend.ExternalIPProperty]; found {
+		externalIP := net.ParseIP(requested)
+
+		err = p.externalIPPool.Remove(externalIP)
+		if err != nil {
+			pLog.Error("external-ip-acquire-failed", err)
+			return nil, err
+		}
+
+		resources.ExternalIP = externalIP
+	}
+
+	rootFSEnvVars, rootFSProvenance, err := p.aquireSystemResources(id, containerPath, spec.RootFSPath, resources, spec.BindMounts, devices, security, dns, pLog)
+	if err != nil {
+		return nil, err
+	}
+
+	containerEnv, err := env.Merge(rootFSEnvVars, spec.Env)
 	if err != nil {
+		pLog.Error("invalid-rootfs-env", err)
+		p.tryReleaseSystemResources(pLog, id)
 		return nil, err
 	}
 
+	cgroupsManager := cgroups_manager.New(p.sysconfig.CgroupPath, id)
+
+	err = cgroups_manager.ApplyDeviceRules(cgroupsManager, devices.rules(p.deviceRules))
+	if err != nil {
+		pLog.Error("apply-device-rules-failed", err)
+		p.tryReleaseSystemResources(pLog, id)
+		return nil, err
+	}
+
+	if p.numaPlacer != nil {
+		err = p.placeOnNUMANode(pLog, id, cgroupsManager)
+		if err != nil {
+			pLog.Error("numa-placement-failed", err)
+			p.tryReleaseSystemResources(pLog, id)
+			return nil, err
+		}
+	}
+
+	handle := getHandle(spec.Handle, id)
+
+	if p.networkPlugin != nil {
+		request := pluginRequest(id, handle, resources)
+
+		err = p.networkPlugin.Erect(pLog.Session("erect-network"), request)
+		if err != nil {
+			pLog.Error("network-plugin-erect-failed", err)
+
+			// undoes whatever the plugin did before failing
+			dismantleErr := p.networkPlugin.Dismantle(pLog.Session("dismantle-network"), request)
+			if dismantleErr != nil {
+				pLog.Error("network-plugin-dismantle-failed", dismantleErr)
+			}
+
+			p.tryReleaseSystemResources(pLog, id)
+			return nil, err
+		}
+	}
+
 	pLog.Info("created")
 
-	return linux_backend.NewLinuxContainer(
+	container := linux_backend.NewLinuxContainer(
 		pLog,
 		id,
-		getHandle(spec.Handle, id),
+		handle,
 		containerPath,
 		spec.Properties,
 		spec.GraceTime,
 		resources,
 		p.portPool,
 		p.runner,
-		cgroups_manager.New(p.sysconfig.CgroupPath, id),
+		cgroupsManager,
 		p.quotaManager,
+		p.volumeManagerFor(id),
 		bandwidth_manager.New(containerPath, id, p.runner),
+		p.iptablesManagerFor(id, resources),
 		process_tracker.New(containerPath, p.runner),
-		mergeEnv(spec.Env, rootFSEnvVars),
-	), nil
+		containerEnv,
+		rootFSProvenance,
+		linux_backend.Annotations{
+			CreatedAt:     time.Now(),
+			GardenVersion: p.gardenVersion,
+		},
+		p.currentDefaultRLimits(),
+	)
+
+	p.delegateLinks(container, handle)
+
+	for _, warning := range p.createWarnings(id) {
+		container.Warn(warning)
+	}
+
+	return container, nil
+}
+
+// iptablesManagerFor manages the rules in the chains net.sh sets up for the
+// container.
+func (p *LinuxContainerPool) iptablesManagerFor(id string, resources *linux_backend.Resources) *iptables_manager.ContainerIPTablesManager {
+	return iptables_manager.New(
+		iptables_manager.InstanceChains(p.sysconfig.IPTables, id),
+		resources.Network.ContainerIP(),
+		iptables_manager.ExternalIP,
+		p.runner,
+	)
 }
 
+// createWarnings are the guarantees the host cannot give a new container.
+// Disk limits on a container with its own volume do not need quotas.
+func (p *LinuxContainerPool) createWarnings(id string) []string {
+	warnings := []string{}
+
+	if p.volumeManagerFor(id) == nil && !p.quotaManager.IsEnabled() {
+		warnings = append(warnings, "disk quotas are disabled, so disk limits are not enforced")
+	}
+
+	if !p.swapAccounting {
+		warnings = append(warnings, "swap accounting is disabled, so memory limits do not include swap")
+	}
+
+	return warnings
+}
+
+// Restore rebuilds a container from its snapshot. If it fails once the
+// container has its resources, the container is returned with the error, so
+// that it can be kept, broken, until destroyed.
 func (p *LinuxContainerPool) Restore(snapshot io.Reader) (linux_backend.Container, error) {
 	var containerSnapshot linux_backend.ContainerSnapshot
 
@@ -220,66 +774,268 @@ func (p *LinuxContainerPool) Restore(snapshot io.Reader) (linux_backend.Containe
 
 	resources := containerSnapshot.Resources
 
-	err = p.uidPool.Remove(resources.UID)
+	if p.takePreclaimed(id) {
+		if resources.ExternalIP != nil {
+			err = p.externalIPPool.Remove(resources.ExternalIP)
+			if err != nil {
+				p.releaseSnapshotResources(resources)
+				return nil, err
+			}
+		}
+	} else {
+		err = p.removeSnapshotResources(resources)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	p.claimInterfaceName(rLog, id)
+
+	containerPath := path.Join(p.depotPath, id)
+
+	containerResources := linux_backend.NewResources(
+		resources.UID,
+		resources.Network,
+		resources.AdditionalNetworks,
+		resources.Ports,
+	)
+
+	containerResources.ExternalIP = resources.ExternalIP
+
+	cgroupsManager := cgroups_manager.New(p.sysconfig.CgroupPath, id)
+
+	if p.numaPlacer != nil {
+		mems, err := cgroupsManager.Get("cpuset", "cpuset.mems")
+		if err == nil && !p.numaPlacer.Claim(id, mems) {
+			rLog.Info("not-on-a-numa-node", lager.Data{"mems": mems})
+		}
+	}
+
+	bandwidthManager := bandwidth_manager.New(containerPath, id, p.runner)
+
+	container := linux_backend.NewLinuxContainer(
+		p.logger.Session(id),
+		id,
+		containerSnapshot.Handle,
+		containerPath,
+		containerSnapshot.Properties,
+		containerSnapshot.GraceTime,
+		containerResources,
+		p.portPool,
+		p.runner,
+		cgroupsManager,
+		p.quotaManager,
+		p.volumeManagerFor(id),
+		bandwidthManager,
+		p.iptablesManagerFor(id, containerResources),
+		process_tracker.New(containerPath, p.runner),
+		containerSnapshot.EnvVars,
+		containerSnapshot.RootFSProvenance,
+		containerSnapshot.Annotations,
+		p.currentDefaultRLimits(),
+	)
+
+	p.delegateLinks(container, containerSnapshot.Handle)
+
+	err = container.Restore(containerSnapshot)
 	if err != nil {
-		return nil, err
+		return container, err
+	}
+
+	err = p.restoreRootFS(rLog, id, containerSnapshot.RootFSProvenance, p.selinuxLabels(resources.UID).File)
+	if err != nil {
+		return container, err
+	}
+
+	if p.networkPlugin != nil {
+		err = p.networkPlugin.Rebuild(rLog.Session("rebuild-network"), pluginRequest(id, containerSnapshot.Handle, container.Resources()))
+		if err != nil {
+			rLog.Error("network-plugin-rebuild-failed", err)
+			return container, err
+		}
+	}
+
+	if p.validateRestoredNetworks {
+		// the container is kept, flagged, so that it can be inspected and
+		// destroyed as usual
+		err = container.ValidateNetwork()
+		if err != nil {
+			rLog.Error("invalid-network", err)
+		}
+	}
+
+	rLog.Info("restored")
+
+	return container, nil
+}
+
+func (p *LinuxContainerPool) removeSnapshotResources(resources linux_backend.ResourcesSnapshot) error {
+	err := p.uidPool.Remove(resources.UID)
+	if err != nil {
+		return err
+	}
+
+	err = p.networkPool.Remove(resources.Network)
+	if err != nil {
+		p.uidPool.Release(resources.UID)
+		return err
+	}
+
+	err = p.removeAdditionalNetworks(resources.AdditionalNetworks)
+	if err != nil {
+		p.uidPool.Release(resources.UID)
+		p.networkPool.Release(resources.Network)
+		return err
+	}
+
+	if resources.ExternalIP != nil {
+		err = p.externalIPPool.Remove(resources.ExternalIP)
+		if err != nil {
+			p.uidPool.Release(resources.UID)
+			p.networkPool.Release(resources.Network)
+			p.releaseAdditionalNetworks(resources.AdditionalNetworks)
+			return err
+		}
+	}
+
+	for _, port := range resources.Ports {
+		err = p.portPool.Remove(port)
+		if err != nil {
+			p.uidPool.Release(resources.UID)
+			p.networkPool.Release(resources.Network)
+			p.releaseAdditionalNetworks(resources.AdditionalNetworks)
+
+			if resources.ExternalIP != nil {
+				p.externalIPPool.Release(resources.ExternalIP)
+			}
+
+			for _, port := range resources.Ports {
+				p.portPool.Release(port)
+			}
+
+			return err
+		}
+	}
+
+	return nil
+}
+
+// releaseSnapshotResources returns the resources Preclaim removes
+func (p *LinuxContainerPool) releaseSnapshotResources(resources linux_backend.ResourcesSnapshot) {
+	p.uidPool.Release(resources.UID)
+	p.networkPool.Release(resources.Network)
+	p.releaseAdditionalNetworks(resources.AdditionalNetworks)
+
+	for _, port := range resources.Ports {
+		p.portPool.Release(port)
+	}
+}
+
+// Preclaim removes the uids, networks and ports of all the snapshots'
+// containers from their pools up front, in one pass per pool, rather than
+// searching each pool once per resource as they are restored. If any
+// conflict, nothing is claimed, and every pool's conflicts are reported
+// together; restoring then removes each container's resources as usual.
+func (p *LinuxContainerPool) Preclaim(snapshots []linux_backend.ContainerSnapshot) error {
+	uids := []uint32{}
+	networks := []*network.Network{}
+	additionalNetworks := make([][]*network.Network, len(p.additionalNetworkPools))
+	ports := []uint32{}
+
+	for _, snapshot := range snapshots {
+		resources := snapshot.Resources
+
+		uids = append(uids, resources.UID)
+		networks = append(networks, resources.Network)
+		ports = append(ports, resources.Ports...)
+
+		for _, network := range resources.AdditionalNetworks {
+			for i, pool := range p.additionalNetworkPools {
+				if pool.Network().Contains(network.IP()) {
+					additionalNetworks[i] = append(additionalNetworks[i], network)
+				}
+			}
+		}
+	}
+
+	conflicts := []error{}
+	undo := []func(){}
+
+	err := p.uidPool.RemoveAll(uids)
+	if err != nil {
+		conflicts = append(conflicts, err)
+	} else {
+		undo = append(undo, func() {
+			for _, uid := range uids {
+				p.uidPool.Release(uid)
+			}
+		})
 	}
 
-	err = p.networkPool.Remove(resources.Network)
+	err = p.networkPool.RemoveAll(networks)
 	if err != nil {
-		p.uidPool.Release(resources.UID)
-		return nil, err
+		conflicts = append(conflicts, err)
+	} else {
+		undo = append(undo, func() {
+			for _, network := range networks {
+				p.networkPool.Release(network)
+			}
+		})
 	}
 
-	for _, port := range resources.Ports {
-		err = p.portPool.Remove(port)
+	for i, pool := range p.additionalNetworkPools {
+		pool := pool
+		poolNetworks := additionalNetworks[i]
+
+		err = pool.RemoveAll(poolNetworks)
 		if err != nil {
-			p.uidPool.Release(resources.UID)
-			p.networkPool.Release(resources.Network)
+			conflicts = append(conflicts, err)
+		} else {
+			undo = append(undo, func() {
+				for _, network := range poolNetworks {
+					pool.Release(network)
+				}
+			})
+		}
+	}
 
-			for _, port := range resources.Ports {
+	err = p.portPool.RemoveAll(ports)
+	if err != nil {
+		conflicts = append(conflicts, err)
+	} else {
+		undo = append(undo, func() {
+			for _, port := range ports {
 				p.portPool.Release(port)
 			}
+		})
+	}
 
-			return nil, err
+	if len(conflicts) > 0 {
+		for _, release := range undo {
+			release()
 		}
-	}
 
-	containerPath := path.Join(p.depotPath, id)
+		return ResourceConflictsError{conflicts}
+	}
 
-	cgroupsManager := cgroups_manager.New(p.sysconfig.CgroupPath, id)
+	p.preclaimedMutex.Lock()
+	defer p.preclaimedMutex.Unlock()
 
-	bandwidthManager := bandwidth_manager.New(containerPath, id, p.runner)
+	for _, snapshot := range snapshots {
+		p.preclaimed[snapshot.ID] = true
+	}
 
-	container := linux_backend.NewLinuxContainer(
-		p.logger.Session(id),
-		id,
-		containerSnapshot.Handle,
-		containerPath,
-		containerSnapshot.Properties,
-		containerSnapshot.GraceTime,
-		linux_backend.NewResources(
-			resources.UID,
-			resources.Network,
-			resources.Ports,
-		),
-		p.portPool,
-		p.runner,
-		cgroupsManager,
-		p.quotaManager,
-		bandwidthManager,
-		process_tracker.New(containerPath, p.runner),
-		containerSnapshot.EnvVars,
-	)
+	return nil
+}
 
-	err = container.Restore(containerSnapshot)
-	if err != nil {
-		return nil, err
-	}
+func (p *LinuxContainerPool) takePreclaimed(id string) bool {
+	p.preclaimedMutex.Lock()
+	defer p.preclaimedMutex.Unlock()
 
-	rLog.Info("restored")
+	preclaimed := p.preclaimed[id]
+	delete(p.preclaimed, id)
 
-	return container, nil
+	return preclaimed
 }
 
 func (p *LinuxContainerPool) Destroy(container linux_backend.Container) error {
@@ -289,34 +1045,39 @@ func (p *LinuxContainerPool) Destroy(container linux_backend.Container) error {
 
 	pLog.Info("destroying")
 
-	err := p.releaseSystemResources(pLog, container.ID())
-	if err != nil {
-		return err
-	}
-
 	linuxContainer := container.(*linux_backend.LinuxContainer)
-	p.releasePoolResources(linuxContainer.Resources())
 
-	pLog.Info("destroyed")
+	if p.networkPlugin != nil {
+		// a failing plugin must not keep the container from being destroyed
+		err := p.networkPlugin.Dismantle(pLog.Session("dismantle-network"), pluginRequest(container.ID(), container.Handle(), linuxContainer.Resources()))
+		if err != nil {
+			pLog.Error("network-plugin-dismantle-failed", err)
+		}
+	}
 
-	return nil
-}
+	resources := linuxContainer.Resources()
 
-func (p *LinuxContainerPool) generateContainerIDs() string {
-	for containerNum := time.Now().UnixNano(); ; containerNum++ {
-		containerID := []byte{}
+	if p.reapQueue != nil {
+		err := p.bury(pLog, container.ID(), resources.UID)
+		if err != nil {
+			return err
+		}
 
-		var i uint
-		for i = 0; i < 11; i++ {
-			containerID = strconv.AppendInt(
-				containerID,
-				(containerNum>>(55-(i+1)*5))&31,
-				32,
-			)
+		p.releasePoolResources(withoutUID(resources))
+	} else {
+		err := p.releaseSystemResources(pLog, container.ID())
+		if err != nil {
+			return err
 		}
 
-		p.containerIDs <- string(containerID)
+		p.releasePoolResources(resources)
 	}
+
+	p.releaseInterfaceName(container.ID())
+
+	pLog.Info("destroyed")
+
+	return nil
 }
 
 func (p *LinuxContainerPool) writeBindMounts(containerPath string,
@@ -343,10 +1104,18 @@ func (p *LinuxContainerPool) writeBindMounts(containerPath string,
 			return err
 		}
 
-		mkdir := exec.Command("bash", "-c", "echo mkdir -p "+dstMount+" >> "+hook)
-		err = p.runner.Run(mkdir)
-		if err != nil {
-			return err
+		// files, e.g. host services' unix sockets, are mounted over files
+		mountPoint := []string{"mkdir -p " + dstMount}
+		if info, err := os.Stat(srcPath); err == nil && !info.IsDir() {
+			mountPoint = []string{"mkdir -p " + path.Dir(dstMount), "touch " + dstMount}
+		}
+
+		for _, line := range mountPoint {
+			mkdir := exec.Command("bash", "-c", "echo "+line+" >> "+hook)
+			err = p.runner.Run(mkdir)
+			if err != nil {
+				return err
+			}
 		}
 
 		mount := exec.Command("bash", "-c", "echo mount -n --bind "+srcPath+" "+dstMount+" >> "+hook)
@@ -365,6 +1134,27 @@ func (p *LinuxContainerPool) writeBindMounts(containerPath string,
 	return nil
 }
 
+// rootfsProviderOf returns the name of the provider of the container's
+// rootfs; containers predating its being saved used the default.
+func (p *LinuxContainerPool) rootfsProviderOf(id string) string {
+	provider, err := ioutil.ReadFile(path.Join(p.depotPath, id, "rootfs-provider"))
+	if err != nil {
+		return ""
+	}
+
+	return string(provider)
+}
+
+// volumeManagerFor returns the volume manager if the container has a volume,
+// which only overlays, from the default provider, do.
+func (p *LinuxContainerPool) volumeManagerFor(id string) volume_manager.VolumeManager {
+	if p.volumeManager == nil || p.rootfsProviderOf(id) != "" {
+		return nil
+	}
+
+	return p.volumeManager
+}
+
 func (p *LinuxContainerPool) saveRootFSProvider(id string, provider string) error {
 	providerFile := path.Join(p.depotPath, id, "rootfs-provider")
 
@@ -376,9 +1166,39 @@ func (p *LinuxContainerPool) saveRootFSProvider(id string, provider string) erro
 	return ioutil.WriteFile(providerFile, []byte(provider), 0644)
 }
 
+// restoreRootFS checks, with the provider that created it, that a restored
+// container's rootfs survived the restart, and re-assembles its mounts if
+// the host rebooted.
+func (p *LinuxContainerPool) restoreRootFS(logger lager.Logger, id string, provenance linux_backend.RootFSProvenance, mountLabel string) error {
+	provider, found := p.rootfsProviders[p.rootfsProviderOf(id)]
+	if !found {
+		return ErrUnknownRootFSProvider
+	}
+
+	providerProvenance := rootfs_provider.Provenance{
+		Image:   provenance.Image,
+		ImageID: provenance.ImageID,
+		Layers:  provenance.Layers,
+	}
+
+	err := provider.VerifyRootFS(logger, id, providerProvenance)
+	if err != nil {
+		logger.Error("rootfs-not-intact", err)
+		return err
+	}
+
+	err = provider.RemountRootFS(logger, id, providerProvenance, mountLabel)
+	if err != nil {
+		logger.Error("remount-rootfs-failed", err)
+		return err
+	}
+
+	return nil
+}
+
 func (p *LinuxContainerPool) aquirePoolResources() (*linux_backend.Resources, error) {
 	var err error
-	resources := linux_backend.NewResources(0, nil, nil)
+	resources := linux_backend.NewResources(0, nil, nil, nil)
 
 	resources.UID, err = p.uidPool.Acquire()
 	if err != nil {
@@ -386,6 +1206,9 @@ func (p *LinuxContainerPool) aquirePoolResources() (*linux_backend.Resources, er
 		return nil, err
 	}
 
+	// the uid's last container may have left its usage cached
+	p.quotaManager.InvalidateUsage(resources.UID)
+
 	resources.Network, err = p.networkPool.Acquire()
 	if err != nil {
 		p.logger.Error("network-acquire-failed", err)
@@ -393,6 +1216,19 @@ func (p *LinuxContainerPool) aquirePoolResources() (*linux_backend.Resources, er
 		return nil, err
 	}
 
+	for _, pool := range p.additionalNetworkPools {
+		network, err := pool.Acquire()
+		if err != nil {
+			p.logger.Error("additional-network-acquire-failed", err, lager.Data{
+				"pool": pool.Network().String(),
+			})
+			p.releasePoolResources(resources)
+			return nil, err
+		}
+
+		resources.AdditionalNetworks = append(resources.AdditionalNetworks, network)
+	}
+
 	return resources, nil
 }
 
@@ -408,15 +1244,53 @@ func (p *LinuxContainerPool) releasePoolResources(resources *linux_backend.Resou
 	if resources.Network != nil {
 		p.networkPool.Release(resources.Network)
 	}
+
+	p.releaseAdditionalNetworks(resources.AdditionalNetworks)
+
+	if resources.ExternalIP != nil {
+		p.externalIPPool.Release(resources.ExternalIP)
+	}
+}
+
+// removeAdditionalNetworks takes restored networks out of whichever pools
+// they belong to, putting them all back if any is already taken
+func (p *LinuxContainerPool) removeAdditionalNetworks(networks []*network.Network) error {
+	for i, network := range networks {
+		for _, pool := range p.additionalNetworkPools {
+			if !pool.Network().Contains(network.IP()) {
+				continue
+			}
+
+			err := pool.Remove(network)
+			if err != nil {
+				p.releaseAdditionalNetworks(networks[:i])
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// releaseAdditionalNetworks returns networks to whichever pools they belong
+// to; networks from pools no longer configured are dropped
+func (p *LinuxContainerPool) releaseAdditionalNetworks(networks []*network.Network) {
+	for _, network := range networks {
+		for _, pool := range p.additionalNetworkPools {
+			if pool.Network().Contains(network.IP()) {
+				pool.Release(network)
+			}
+		}
+	}
 }
 
-func (p *LinuxContainerPool) aquireSystemResources(id, containerPath, rootFSPath string, resources *linux_backend.Resources, bindMounts []api.BindMount, pLog lager.Logger) ([]string, error) {
+func (p *LinuxContainerPool) aquireSystemResources(id, containerPath, rootFSPath string, resources *linux_backend.Resources, bindMounts []api.BindMount, devices optionalDevices, security securityOptions, dns dnsOptions, pLog lager.Logger) ([]string, linux_backend.RootFSProvenance, error) {
 	rootfsURL, err := url.Parse(rootFSPath)
 	if err != nil {
 		pLog.Error("parse-rootfs-path-failed", err, lager.Data{
 			"RootFSPath": rootFSPath,
 		})
-		return nil, err
+		return nil, linux_backend.RootFSProvenance{}, err
 	}
 
 	provider, found := p.rootfsProviders[rootfsURL.Scheme]
@@ -424,23 +1298,37 @@ func (p *LinuxContainerPool) aquireSystemResources(id, containerPath, rootFSPath
 		pLog.Error("unknown-rootfs-provider", nil, lager.Data{
 			"provider": rootfsURL.Scheme,
 		})
-		return nil, ErrUnknownRootFSProvider
+		return nil, linux_backend.RootFSProvenance{}, ErrUnknownRootFSProvider
 	}
 
-	rootfsPath, rootFSEnvVars, err := provider.ProvideRootFS(pLog.Session("create-rootfs"), id, rootfsURL)
+	labels := p.selinuxLabels(resources.UID)
+
+	rootfsPath, rootFSEnvVars, provenance, err := provider.ProvideRootFS(pLog.Session("create-rootfs"), id, rootfsURL, labels.File)
 	if err != nil {
 		pLog.Error("provide-rootfs-failed", err)
-		return nil, err
+		return nil, linux_backend.RootFSProvenance{}, err
 	}
 
 	createCmd := path.Join(p.binPath, "create.sh")
 	create := exec.Command(createCmd, containerPath)
 	create.Env = []string{
 		"id=" + id,
+		"iface_name=" + p.interfaceName(id),
 		"rootfs_path=" + rootfsPath,
 		fmt.Sprintf("user_uid=%d", resources.UID),
 		fmt.Sprintf("network_host_ip=%s", resources.Network.HostIP()),
 		fmt.Sprintf("network_container_ip=%s", resources.Network.ContainerIP()),
+		"network_attachments=" + formatAttachments(resources.AdditionalNetworks),
+		"container_external_ip=" + formatIP(resources.ExternalIP),
+		"network_tun=" + strconv.FormatBool(devices.tun),
+		"filesystem_fuse=" + strconv.FormatBool(devices.fuse),
+		"security_no_new_privs=" + strconv.FormatBool(security.noNewPrivs),
+		"security_harden_proc_sys=" + strconv.FormatBool(security.hardenProcSys),
+		"security_apparmor_profile=" + security.appArmorProfile,
+		"security_selinux_label=" + labels.Process,
+		"network_plugin_links=" + strconv.FormatBool(p.networkPluginBuildsLinks),
+		"network_dns_servers=" + strings.Join(dns.servers, " "),
+		"network_dns_search=" + strings.Join(dns.searchDomains, " "),
 		"PATH=" + os.Getenv("PATH"),
 	}
 
@@ -459,7 +1347,7 @@ func (p *LinuxContainerPool) aquireSystemResources(id, containerPath, rootFSPath
 			"CreateCmd": createCmd,
 			"Env":       create.Env,
 		})
-		return nil, err
+		return nil, linux_backend.RootFSProvenance{}, err
 	}
 
 	err = p.saveRootFSProvider(id, rootfsURL.Scheme)
@@ -468,16 +1356,58 @@ func (p *LinuxContainerPool) aquireSystemResources(id, containerPath, rootFSPath
 			"Id":     id,
 			"rootfs": rootfsURL.String(),
 		})
-		return nil, err
+		return nil, linux_backend.RootFSProvenance{}, err
 	}
 
 	err = p.writeBindMounts(containerPath, rootfsPath, bindMounts)
 	if err != nil {
 		p.logger.Error("bind-mounts-failed", err)
-		return nil, err
+		return nil, linux_backend.RootFSProvenance{}, err
 	}
 
-	return rootFSEnvVars, nil
+	rootFSProvenance := linux_backend.RootFSProvenance{
+		Provider: rootfsURL.Scheme,
+		Image:    provenance.Image,
+		ImageID:  provenance.ImageID,
+		Layers:   provenance.Layers,
+	}
+
+	return rootFSEnvVars, rootFSProvenance, nil
+}
+
+// selinuxLabels are the container's SELinux labels, which are empty unless
+// the pool labels containers.
+func (p *LinuxContainerPool) selinuxLabels(uid uint32) selinux_labeler.Labels {
+	if p.selinuxLabeler == nil {
+		return selinux_labeler.Labels{}
+	}
+
+	return p.selinuxLabeler.Labels(uid)
+}
+
+// placeOnNUMANode confines the container's cpuset cgroup to a node's CPUs and
+// memory. It must be done before the container's processes join the cgroup.
+func (p *LinuxContainerPool) placeOnNUMANode(pLog lager.Logger, id string, cgroupsManager cgroups_manager.CgroupsManager) error {
+	node := p.numaPlacer.Place(id)
+
+	err := os.MkdirAll(cgroupsManager.SubsystemPath("cpuset"), 0755)
+	if err != nil {
+		return err
+	}
+
+	err = cgroupsManager.Set("cpuset", "cpuset.cpus", node.CPUs)
+	if err != nil {
+		return err
+	}
+
+	err = cgroupsManager.Set("cpuset", "cpuset.mems", node.Mems())
+	if err != nil {
+		return err
+	}
+
+	pLog.Info("placed-on-numa-node", lager.Data{"node": node.ID})
+
+	return nil
 }
 
 func (p *LinuxContainerPool) tryReleaseSystemResources(logger lager.Logger, id string) {
@@ -488,31 +1418,65 @@ func (p *LinuxContainerPool) tryReleaseSystemResources(logger lager.Logger, id s
 }
 
 func (p *LinuxContainerPool) releaseSystemResources(logger lager.Logger, id string) error {
-	rootfsProvider, err := ioutil.ReadFile(path.Join(p.depotPath, id, "rootfs-provider"))
-	if err != nil {
-		rootfsProvider = []byte("")
-	}
-
 	pRunner := logging.Runner{
 		CommandRunner: p.runner,
 		Logger:        logger,
 	}
 
-	provider, found := p.rootfsProviders[string(rootfsProvider)]
+	provider, found := p.rootfsProviders[p.rootfsProviderOf(id)]
 	if !found {
 		return ErrUnknownRootFSProvider
 	}
 
 	destroy := exec.Command(path.Join(p.binPath, "destroy.sh"), path.Join(p.depotPath, id))
 
-	err = pRunner.Run(destroy)
+	err := pRunner.Run(destroy)
 	if err != nil {
 		return err
 	}
 
+	if p.numaPlacer != nil {
+		p.numaPlacer.Release(id)
+	}
+
 	return provider.CleanupRootFS(logger, id)
 }
 
+func pluginRequest(id, handle string, resources *linux_backend.Resources) network_plugin.Request {
+	return network_plugin.Request{
+		ContainerID:     id,
+		ContainerHandle: handle,
+
+		Network:            resources.Network,
+		AdditionalNetworks: resources.AdditionalNetworks,
+	}
+}
+
+// delegateLinks has the network plugin build the container's links, if it
+// is to.
+func (p *LinuxContainerPool) delegateLinks(container *linux_backend.LinuxContainer, handle string) {
+	if !p.networkPluginBuildsLinks {
+		return
+	}
+
+	container.SetLinkBuilder(pluginLinkBuilder{
+		plugin:  p.networkPlugin,
+		request: pluginRequest(container.ID(), handle, container.Resources()),
+	})
+}
+
+type pluginLinkBuilder struct {
+	plugin  network_plugin.NetworkPlugin
+	request network_plugin.Request
+}
+
+func (b pluginLinkBuilder) BuildLinks(logger lager.Logger, pid int) error {
+	request := b.request
+	request.PID = pid
+
+	return b.plugin.Build(logger, request)
+}
+
 func getHandle(handle, id string) string {
 	if handle != "" {
 		return handle
@@ -520,15 +1484,200 @@ func getHandle(handle, id string) string {
 	return id
 }
 
-func mergeEnv(env1, env2 []string) []string {
-	for _, entry := range env2 {
-		env1 = append(env1, entry)
-	}
-	return env1
-}
-
 func cleanup(err *error, undo func()) {
 	if *err != nil {
 		undo()
 	}
 }
+
+// optionalDevices are those a container must opt in to when it is created.
+type optionalDevices struct {
+	tun  bool
+	fuse bool
+}
+
+// validateProperties keeps clients from passing off properties as the
+// server's annotations.
+func parseOptionalDevices(properties api.Properties) (optionalDevices, error) {
+	tun, err := boolProperty(properties, linux_backend.TunProperty)
+	if err != nil {
+		return optionalDevices{}, err
+	}
+
+	fuse, err := boolProperty(properties, linux_backend.FuseProperty)
+	if err != nil {
+		return optionalDevices{}, err
+	}
+
+	return optionalDevices{tun: tun, fuse: fuse}, nil
+}
+
+// rules adds the opted-in devices to the configured whitelist.
+func (d optionalDevices) rules(whitelist []cgroups_manager.DeviceRule) []cgroups_manager.DeviceRule {
+	rules := append([]cgroups_manager.DeviceRule{}, whitelist...)
+
+	if d.tun {
+		rules = append(rules, cgroups_manager.TunDeviceRule)
+	}
+
+	if d.fuse {
+		rules = append(rules, cgroups_manager.FuseDeviceRule)
+	}
+
+	return rules
+}
+
+// securityOptions are how a container's processes are confined.
+type securityOptions struct {
+	// unprivileged processes are kept from gaining privileges
+	noNewPrivs bool
+
+	hardenProcSys bool
+
+	// empty if processes are not confined by AppArmor
+	appArmorProfile string
+}
+
+// AppArmor profile names are written into the container's config and
+// start.sh's arguments
+var validAppArmorProfile = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.-]*$`)
+
+// parseSecurityOptions applies the container's properties to the defaults.
+// Unprivileged processes are kept from gaining privileges unless the
+// container opted out.
+func parseSecurityOptions(properties api.Properties, devices optionalDevices, defaults securityOptions) (securityOptions, error) {
+	options := defaults
+
+	allowSetuid, err := boolProperty(properties, linux_backend.AllowSetuidProperty)
+	if err != nil {
+		return securityOptions{}, err
+	}
+
+	options.noNewPrivs = !allowSetuid && !devices.fuse
+
+	if _, found := properties[linux_backend.HardenProcSysProperty]; found {
+		options.hardenProcSys, err = boolProperty(properties, linux_backend.HardenProcSysProperty)
+		if err != nil {
+			return securityOptions{}, err
+		}
+	}
+
+	if profile, found := properties[linux_backend.AppArmorProfileProperty]; found {
+		switch {
+		case profile == linux_backend.AppArmorUnconfined:
+			options.appArmorProfile = ""
+		case validAppArmorProfile.MatchString(profile):
+			options.appArmorProfile = profile
+		default:
+			return securityOptions{}, InvalidSpecError{
+				Field:  "Properties[" + linux_backend.AppArmorProfileProperty + "]",
+				Value:  profile,
+				Reason: "must be a profile name of letters, digits, '_', '.' and '-'",
+			}
+		}
+	}
+
+	return options, nil
+}
+
+// dnsOptions are what is written to a container's /etc/resolv.conf. Either
+// may be empty, leaving the host's in place.
+type dnsOptions struct {
+	servers       []string
+	searchDomains []string
+}
+
+// search domains are written into the container's /etc/resolv.conf by
+// create.sh, so are limited to hostname characters
+var validSearchDomain = regexp.MustCompile(`^[A-Za-z0-9_]([A-Za-z0-9_.-]*[A-Za-z0-9])?$`)
+
+// parseDNSOptions applies the container's properties to the defaults. Each
+// property, if set, replaces its default, even when empty.
+func parseDNSOptions(properties api.Properties, defaults dnsOptions) (dnsOptions, error) {
+	options := defaults
+
+	if value, found := properties[linux_backend.DNSServersProperty]; found {
+		servers, err := parseDNSServers(value)
+		if err != nil {
+			return dnsOptions{}, InvalidSpecError{
+				Field:  "Properties[" + linux_backend.DNSServersProperty + "]",
+				Value:  value,
+				Reason: err.Error(),
+			}
+		}
+
+		options.servers = servers
+	}
+
+	if value, found := properties[linux_backend.DNSSearchDomainsProperty]; found {
+		domains, err := parseSearchDomains(value)
+		if err != nil {
+			return dnsOptions{}, InvalidSpecError{
+				Field:  "Properties[" + linux_backend.DNSSearchDomainsProperty + "]",
+				Value:  value,
+				Reason: err.Error(),
+			}
+		}
+
+		options.searchDomains = domains
+	}
+
+	return options, nil
+}
+
+func parseDNSServers(list string) ([]string, error) {
+	servers := splitList(list)
+
+	for _, server := range servers {
+		if net.ParseIP(server) == nil {
+			return nil, fmt.Errorf("nameserver %q is not an IP", server)
+		}
+	}
+
+	if len(servers) > linux_backend.MaxDNSServers {
+		return nil, fmt.Errorf("at most %d nameservers are used, got %d", linux_backend.MaxDNSServers, len(servers))
+	}
+
+	return servers, nil
+}
+
+func parseSearchDomains(list string) ([]string, error) {
+	domains := splitList(list)
+
+	for _, domain := range domains {
+		if !validSearchDomain.MatchString(domain) {
+			return nil, fmt.Errorf("search domain %q is not a domain", domain)
+		}
+	}
+
+	return domains, nil
+}
+
+// splitList splits a comma-separated list, ignoring space around its
+// elements. An empty list has no elements.
+func splitList(list string) []string {
+	elements := []string{}
+
+	for _, element := range strings.Split(list, ",") {
+		element = strings.TrimSpace(element)
+		if element != "" {
+			elements = append(elements, element)
+		}
+	}
+
+	return elements
+}
+
+func boolProperty(properties api.Properties, name string) (bool, error) {
+	value, found := properties[name]
+	if !found {
+		return false, nil
+	}
+
+	parsed, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, InvalidBoolPropertyError{Property: name, Value: value}
+	}
+
+	return parsed, nil
+}
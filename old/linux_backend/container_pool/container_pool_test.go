@@ -12,6 +12,8 @@ import (
 	"os/exec"
 	"path"
 	"path/filepath"
+	"strconv"
+	"strings"
 	"time"
 
 	. "github.com/onsi/ginkgo"
@@ -19,14 +21,24 @@ import (
 	"github.com/pivotal-golang/lager/lagertest"
 
 	"github.com/cloudfoundry-incubator/garden-linux/old/linux_backend"
+	"github.com/cloudfoundry-incubator/garden-linux/old/linux_backend/cgroups_manager"
 	"github.com/cloudfoundry-incubator/garden-linux/old/linux_backend/container_pool"
 	"github.com/cloudfoundry-incubator/garden-linux/old/linux_backend/container_pool/rootfs_provider"
 	"github.com/cloudfoundry-incubator/garden-linux/old/linux_backend/container_pool/rootfs_provider/fake_rootfs_provider"
+	"github.com/cloudfoundry-incubator/garden-linux/old/linux_backend/env"
+	"github.com/cloudfoundry-incubator/garden-linux/old/linux_backend/external_ip_pool/fake_external_ip_pool"
 	"github.com/cloudfoundry-incubator/garden-linux/old/linux_backend/network"
+	"github.com/cloudfoundry-incubator/garden-linux/old/linux_backend/network_plugin/fake_network_plugin"
+	"github.com/cloudfoundry-incubator/garden-linux/old/linux_backend/network_pool"
 	"github.com/cloudfoundry-incubator/garden-linux/old/linux_backend/network_pool/fake_network_pool"
+	"github.com/cloudfoundry-incubator/garden-linux/old/linux_backend/numa_placer"
+	"github.com/cloudfoundry-incubator/garden-linux/old/linux_backend/port_pool"
 	"github.com/cloudfoundry-incubator/garden-linux/old/linux_backend/port_pool/fake_port_pool"
 	"github.com/cloudfoundry-incubator/garden-linux/old/linux_backend/quota_manager/fake_quota_manager"
+	"github.com/cloudfoundry-incubator/garden-linux/old/linux_backend/selinux_labeler"
+	"github.com/cloudfoundry-incubator/garden-linux/old/linux_backend/uid_pool"
 	"github.com/cloudfoundry-incubator/garden-linux/old/linux_backend/uid_pool/fake_uid_pool"
+	"github.com/cloudfoundry-incubator/garden-linux/old/linux_backend/volume_manager/fake_volume_manager"
 	"github.com/cloudfoundry-incubator/garden-linux/old/sysconfig"
 	"github.com/cloudfoundry-incubator/garden/api"
 	"github.com/cloudfoundry/gunk/command_runner/fake_command_runner"
@@ -35,10 +47,16 @@ import (
 
 var _ = Describe("Container pool", func() {
 	var depotPath string
+	var cgroupsPath string
+	var numaPlacer *numa_placer.RealPlacer
 	var fakeRunner *fake_command_runner.FakeCommandRunner
 	var fakeUIDPool *fake_uid_pool.FakeUIDPool
 	var fakeNetworkPool *fake_network_pool.FakeNetworkPool
+	var fakeAdditionalNetworkPool *fake_network_pool.FakeNetworkPool
+	var fakeExternalIPPool *fake_external_ip_pool.FakeExternalIPPool
 	var fakeQuotaManager *fake_quota_manager.FakeQuotaManager
+	var fakeVolumeManager *fake_volume_manager.FakeVolumeManager
+	var fakeNetworkPlugin *fake_network_plugin.FakeNetworkPlugin
 	var fakePortPool *fake_port_pool.FakePortPool
 	var defaultFakeRootFSProvider *fake_rootfs_provider.FakeRootFSProvider
 	var fakeRootFSProvider *fake_rootfs_provider.FakeRootFSProvider
@@ -50,38 +68,72 @@ var _ = Describe("Container pool", func() {
 
 		fakeUIDPool = fake_uid_pool.New(10000)
 		fakeNetworkPool = fake_network_pool.New(ipNet)
+
+		_, additionalIPNet, err := net.ParseCIDR("1.3.0.0/20")
+		Ω(err).ShouldNot(HaveOccurred())
+
+		fakeAdditionalNetworkPool = fake_network_pool.New(additionalIPNet)
+		fakeAdditionalNetworkPool.InitialPoolSize = 1000
+
+		fakeExternalIPPool = fake_external_ip_pool.New()
 		fakeRunner = fake_command_runner.New()
 		fakeQuotaManager = fake_quota_manager.New()
+		fakeVolumeManager = fake_volume_manager.New()
+		fakeNetworkPlugin = fake_network_plugin.New()
 		fakePortPool = fake_port_pool.New(1000)
 		defaultFakeRootFSProvider = new(fake_rootfs_provider.FakeRootFSProvider)
 		fakeRootFSProvider = new(fake_rootfs_provider.FakeRootFSProvider)
 
-		defaultFakeRootFSProvider.ProvideRootFSReturns("/provided/rootfs/path", nil, nil)
+		defaultFakeRootFSProvider.ProvideRootFSReturns("/provided/rootfs/path", nil, rootfs_provider.Provenance{}, nil)
 
 		depotPath, err = ioutil.TempDir("", "depot-path")
 		Ω(err).ShouldNot(HaveOccurred())
 
+		cgroupsPath, err = ioutil.TempDir("", "cgroups-path")
+		Ω(err).ShouldNot(HaveOccurred())
+
+		config := sysconfig.NewConfig("0")
+		config.CgroupPath = cgroupsPath
+
+		numaPlacer = numa_placer.New([]numa_placer.Node{
+			{ID: 0, CPUs: "0-3"},
+			{ID: 1, CPUs: "4-7"},
+		}, numa_placer.Spread)
+
 		pool = container_pool.New(
 			lagertest.NewTestLogger("test"),
 			"/root/path",
 			depotPath,
-			sysconfig.NewConfig("0"),
+			config,
 			map[string]rootfs_provider.RootFSProvider{
 				"":     defaultFakeRootFSProvider,
 				"fake": fakeRootFSProvider,
 			},
 			fakeUIDPool,
 			fakeNetworkPool,
+			[]network_pool.NetworkPool{fakeAdditionalNetworkPool},
+			fakeExternalIPPool,
 			fakePortPool,
 			[]string{"1.1.0.0/16", "2.2.0.0/16"},
 			[]string{"1.1.1.1/32", "2.2.2.2/32"},
 			fakeRunner,
 			fakeQuotaManager,
+			fakeVolumeManager,
+			fakeNetworkPlugin,
+			[]cgroups_manager.DeviceRule{
+				{Type: "c", Major: "1", Minor: "3", Access: "rwm"},
+				{Type: "c", Major: "1", Minor: "5", Access: "rwm"},
+			},
+			numaPlacer,
+			api.ResourceLimits{},
+			true,
+			"some-version",
 		)
 	})
 
 	AfterEach(func() {
 		os.RemoveAll(depotPath)
+		os.RemoveAll(cgroupsPath)
 	})
 
 	Describe("MaxContainer", func() {
@@ -105,6 +157,52 @@ var _ = Describe("Container pool", func() {
 				Ω(pool.MaxContainers()).Should(Equal(42))
 			})
 		})
+
+		Context("when constrained by an additional network pool's size", func() {
+			BeforeEach(func() {
+				fakeNetworkPool.InitialPoolSize = 666
+				fakeUIDPool.InitialPoolSize = 3000
+				fakeAdditionalNetworkPool.InitialPoolSize = 7
+			})
+
+			It("returns the additional network pool's size", func() {
+				Ω(pool.MaxContainers()).Should(Equal(7))
+			})
+		})
+	})
+
+	Describe("Utilization", func() {
+		BeforeEach(func() {
+			fakeUIDPool.InitialPoolSize = 256
+			fakeUIDPool.AvailablePoolSize = 200
+
+			fakeNetworkPool.InitialPoolSize = 1024
+			fakeNetworkPool.AvailablePoolSize = 1000
+
+			fakePortPool.InitialPoolSize = 5000
+			fakePortPool.AvailablePoolSize = 4990
+
+			fakeAdditionalNetworkPool.AvailablePoolSize = 900
+		})
+
+		It("reports how much of each pool is free", func() {
+			Ω(pool.Utilization()).Should(Equal([]linux_backend.PoolUtilization{
+				{Pool: "uid", Free: 200, Total: 256},
+				{Pool: "network", Free: 1000, Total: 1024},
+				{Pool: "port", Free: 4990, Total: 5000},
+				{Pool: "network:1.3.0.0/20", Free: 900, Total: 1000},
+				{Pool: "numa:node0", Free: 128, Total: 128},
+				{Pool: "numa:node1", Free: 128, Total: 128},
+			}))
+		})
+
+		It("reports each NUMA node's share of the containers as a pool", func() {
+			numaPlacer.Place("some-container")
+
+			utilization := pool.Utilization()
+			Ω(utilization).Should(ContainElement(linux_backend.PoolUtilization{Pool: "numa:node0", Free: 127, Total: 128}))
+			Ω(utilization).Should(ContainElement(linux_backend.PoolUtilization{Pool: "numa:node1", Free: 128, Total: 128}))
+		})
 	})
 
 	Describe("setup", func() {
@@ -124,6 +222,7 @@ var _ = Describe("Container pool", func() {
 						"CONTAINER_DEPOT_PATH=" + depotPath,
 						"CONTAINER_DEPOT_MOUNT_POINT_PATH=/depot/mount/point",
 						"DISK_QUOTA_ENABLED=true",
+						"APPARMOR_PROFILE=",
 
 						"PATH=" + os.Getenv("PATH"),
 					},
@@ -132,6 +231,14 @@ var _ = Describe("Container pool", func() {
 
 		})
 
+		It("detects whether the host has swap accounting", func() {
+			err := pool.Setup()
+			Ω(err).ShouldNot(HaveOccurred())
+
+			// the test config's cgroups are not mounted
+			Ω(pool.SwapAccounting()).Should(BeFalse())
+		})
+
 		Context("when setup.sh fails", func() {
 			nastyError := errors.New("oh no!")
 
@@ -150,6 +257,223 @@ var _ = Describe("Container pool", func() {
 				Ω(err).Should(Equal(nastyError))
 			})
 		})
+
+		Context("when containers are confined with AppArmor", func() {
+			BeforeEach(func() {
+				pool.ConfineWithAppArmor("garden-default")
+			})
+
+			It("tells setup.sh to load the profiles rather than disable AppArmor", func() {
+				err := pool.Setup()
+				Ω(err).ShouldNot(HaveOccurred())
+
+				setup := fakeRunner.ExecutedCommands()[0]
+				Ω(setup.Path).Should(Equal("/root/path/setup.sh"))
+				Ω(setup.Env).Should(ContainElement("APPARMOR_PROFILE=garden-default"))
+			})
+		})
+
+		Context("when the host is set up separately", func() {
+			BeforeEach(func() {
+				pool.SkipHostSetup()
+			})
+
+			It("does not execute setup.sh", func() {
+				err := pool.Setup()
+				Ω(err).ShouldNot(HaveOccurred())
+
+				Ω(fakeRunner.ExecutedCommands()).Should(BeEmpty())
+			})
+
+			Context("but it has not been", func() {
+				It("returns a HostNotSetUpError", func() {
+					err := os.RemoveAll(cgroupsPath)
+					Ω(err).ShouldNot(HaveOccurred())
+
+					err = pool.Setup()
+					Ω(err).Should(Equal(container_pool.HostNotSetUpError{Reason: "no cgroups at " + cgroupsPath}))
+				})
+			})
+		})
+	})
+
+	Describe("setting up the host", func() {
+		It("executes setup.sh", func() {
+			err := pool.SetUpHost()
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(fakeRunner).Should(HaveExecutedSerially(
+				fake_command_runner.CommandSpec{
+					Path: "/root/path/setup.sh",
+				},
+			))
+		})
+	})
+
+	Describe("growing the port pool", func() {
+		It("grows the port pool", func() {
+			err := pool.GrowPortPool(6000)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(fakePortPool.InitialSize()).Should(Equal(6000))
+		})
+	})
+
+	Describe("acquiring a port", func() {
+		It("acquires any port from the port pool", func() {
+			port, err := pool.AcquirePort(0)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(port).Should(Equal(uint32(1000)))
+		})
+
+		Context("when a port is given", func() {
+			It("removes it from the port pool", func() {
+				port, err := pool.AcquirePort(1005)
+				Ω(err).ShouldNot(HaveOccurred())
+				Ω(port).Should(Equal(uint32(1005)))
+
+				Ω(fakePortPool.Removed).Should(ContainElement(uint32(1005)))
+			})
+
+			Context("and it is taken", func() {
+				disaster := errors.New("oh no!")
+
+				BeforeEach(func() {
+					fakePortPool.RemoveError = disaster
+				})
+
+				It("returns the error", func() {
+					_, err := pool.AcquirePort(1005)
+					Ω(err).Should(Equal(disaster))
+				})
+			})
+		})
+	})
+
+	Describe("releasing a port", func() {
+		It("releases it to the port pool", func() {
+			pool.ReleasePort(1005)
+			Ω(fakePortPool.Released).Should(ContainElement(uint32(1005)))
+		})
+	})
+
+	Describe("setting the network filters", func() {
+		It("replaces the host's default filter with net.sh", func() {
+			err := pool.SetNetworkFilters([]string{"3.3.0.0/16"}, []string{"3.3.3.3/32", "4.4.4.4/32"})
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(fakeRunner).Should(HaveExecutedSerially(
+				fake_command_runner.CommandSpec{
+					Path: "/root/path/net.sh",
+					Args: []string{"filter_default"},
+					Env: []string{
+						"DENY_NETWORKS=3.3.0.0/16",
+						"ALLOW_NETWORKS=3.3.3.3/32 4.4.4.4/32",
+						"PATH=" + os.Getenv("PATH"),
+					},
+				},
+			))
+		})
+
+		It("sets up with them from then on", func() {
+			err := pool.SetNetworkFilters([]string{"3.3.0.0/16"}, nil)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			err = pool.Setup()
+			Ω(err).ShouldNot(HaveOccurred())
+
+			setup := fakeRunner.ExecutedCommands()[1]
+			Ω(setup.Env).Should(ContainElement("DENY_NETWORKS=3.3.0.0/16"))
+			Ω(setup.Env).Should(ContainElement("ALLOW_NETWORKS="))
+		})
+
+		Context("when net.sh fails", func() {
+			disaster := errors.New("oh no!")
+
+			BeforeEach(func() {
+				fakeRunner.WhenRunning(
+					fake_command_runner.CommandSpec{
+						Path: "/root/path/net.sh",
+					}, func(*exec.Cmd) error {
+						return disaster
+					},
+				)
+			})
+
+			It("returns the error, keeping the old networks", func() {
+				err := pool.SetNetworkFilters([]string{"3.3.0.0/16"}, nil)
+				Ω(err).Should(Equal(disaster))
+
+				err = pool.Setup()
+				Ω(err).ShouldNot(HaveOccurred())
+
+				setup := fakeRunner.ExecutedCommands()[1]
+				Ω(setup.Env).Should(ContainElement("DENY_NETWORKS=1.1.0.0/16 2.2.0.0/16"))
+			})
+		})
+	})
+
+	Describe("growing the network pool", func() {
+		var grown *net.IPNet
+
+		BeforeEach(func() {
+			var err error
+
+			_, grown, err = net.ParseCIDR("1.2.0.0/19")
+			Ω(err).ShouldNot(HaveOccurred())
+		})
+
+		It("moves the pool's NAT to the new network, then grows the pool", func() {
+			err := pool.GrowNetworkPool(grown)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(fakeRunner).Should(HaveExecutedSerially(
+				fake_command_runner.CommandSpec{
+					Path: "/root/path/net.sh",
+					Args: []string{"grow_pool"},
+					Env: []string{
+						"POOL_NETWORK=1.2.0.0/19",
+						"OLD_POOL_NETWORK=1.2.0.0/20",
+						"PATH=" + os.Getenv("PATH"),
+					},
+				},
+			))
+
+			Ω(fakeNetworkPool.Network()).Should(Equal(grown))
+		})
+
+		Context("when net.sh fails", func() {
+			nastyError := errors.New("oh no!")
+
+			BeforeEach(func() {
+				fakeRunner.WhenRunning(
+					fake_command_runner.CommandSpec{
+						Path: "/root/path/net.sh",
+					}, func(*exec.Cmd) error {
+						return nastyError
+					},
+				)
+			})
+
+			It("returns the error and does not grow the pool", func() {
+				err := pool.GrowNetworkPool(grown)
+				Ω(err).Should(Equal(nastyError))
+
+				Ω(fakeNetworkPool.Network().String()).Should(Equal("1.2.0.0/20"))
+			})
+		})
+
+		Context("when the new network does not contain the pool's", func() {
+			It("returns a CannotShrinkError without touching the NAT", func() {
+				_, other, err := net.ParseCIDR("1.4.0.0/16")
+				Ω(err).ShouldNot(HaveOccurred())
+
+				err = pool.GrowNetworkPool(other)
+				Ω(err).Should(BeAssignableToTypeOf(network_pool.CannotShrinkError{}))
+
+				Ω(fakeRunner.ExecutedCommands()).Should(BeEmpty())
+			})
+		})
 	})
 
 	Describe("creating", func() {
@@ -182,7 +506,7 @@ var _ = Describe("Container pool", func() {
 		itCleansUpTheRootfs := func() {
 			It("cleans up the rootfs for the container", func() {
 				Ω(defaultFakeRootFSProvider.CleanupRootFSCallCount()).Should(Equal(1))
-				_, providedID, _ := defaultFakeRootFSProvider.ProvideRootFSArgsForCall(0)
+				_, providedID, _, _ := defaultFakeRootFSProvider.ProvideRootFSArgsForCall(0)
 				_, cleanedUpID := defaultFakeRootFSProvider.CleanupRootFSArgsForCall(0)
 				Ω(cleanedUpID).Should(Equal(providedID))
 			})
@@ -198,6 +522,84 @@ var _ = Describe("Container pool", func() {
 			Ω(container1.ID()).ShouldNot(Equal(container2.ID()))
 		})
 
+		It("gives containers 11 digit timestamp IDs by default", func() {
+			container, err := pool.Create(api.ContainerSpec{})
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(container.ID()).Should(MatchRegexp(`^[0-9a-v]{11}$`))
+		})
+
+		Context("when generating random IDs with a prefix", func() {
+			BeforeEach(func() {
+				err := pool.GenerateIDs(container_pool.RandomIDs, "cell-7-")
+				Ω(err).ShouldNot(HaveOccurred())
+			})
+
+			It("gives containers prefixed 20 digit random IDs", func() {
+				container1, err := pool.Create(api.ContainerSpec{})
+				Ω(err).ShouldNot(HaveOccurred())
+
+				container2, err := pool.Create(api.ContainerSpec{})
+				Ω(err).ShouldNot(HaveOccurred())
+
+				Ω(container1.ID()).Should(MatchRegexp(`^cell-7-[0-9a-v]{20}$`))
+				Ω(container2.ID()).Should(MatchRegexp(`^cell-7-[0-9a-v]{20}$`))
+				Ω(container1.ID()).ShouldNot(Equal(container2.ID()))
+			})
+		})
+
+		Context("when the next ID's interface name is taken by a restored container", func() {
+			It("skips it, and gives the interface name to setup.sh", func() {
+				container1, err := pool.Create(api.ContainerSpec{})
+				Ω(err).ShouldNot(HaveOccurred())
+
+				num, err := strconv.ParseInt(container1.ID(), 32, 64)
+				Ω(err).ShouldNot(HaveOccurred())
+
+				nextID := strconv.FormatInt(num+1, 32)
+				nextID = strings.Repeat("0", 11-len(nextID)) + nextID
+
+				_, ipNet, err := net.ParseCIDR("10.244.0.8/30")
+				Ω(err).ShouldNot(HaveOccurred())
+
+				snapshot := new(bytes.Buffer)
+				err = json.NewEncoder(snapshot).Encode(linux_backend.ContainerSnapshot{
+					ID:     "restored-" + nextID,
+					Handle: "some-restored-handle",
+					Resources: linux_backend.ResourcesSnapshot{
+						UID:     10001,
+						Network: network.New(ipNet),
+					},
+				})
+				Ω(err).ShouldNot(HaveOccurred())
+
+				_, err = pool.Restore(snapshot)
+				Ω(err).ShouldNot(HaveOccurred())
+
+				container2, err := pool.Create(api.ContainerSpec{})
+				Ω(err).ShouldNot(HaveOccurred())
+
+				Ω(container2.ID()).ShouldNot(Equal(nextID))
+
+				creates := []*exec.Cmd{}
+				for _, cmd := range fakeRunner.ExecutedCommands() {
+					if cmd.Path == "/root/path/create.sh" {
+						creates = append(creates, cmd)
+					}
+				}
+
+				Ω(creates).Should(HaveLen(2))
+				Ω(creates[1].Env).Should(ContainElement("iface_name=" + container2.ID()))
+			})
+		})
+
+		Context("when the ID prefix is not safe for paths and chain names", func() {
+			It("returns an error", func() {
+				err := pool.GenerateIDs(container_pool.TimestampIDs, "cell/7")
+				Ω(err).Should(Equal(container_pool.InvalidIDPrefixError{Prefix: "cell/7"}))
+			})
+		})
+
 		It("creates containers with the correct grace time", func() {
 			container, err := pool.Create(api.ContainerSpec{
 				GraceTime: 1 * time.Second,
@@ -220,6 +622,70 @@ var _ = Describe("Container pool", func() {
 			Ω(container.Properties()).Should(Equal(properties))
 		})
 
+		Describe("warnings", func() {
+			It("warns that memory limits do not include swap when the host has no swap accounting", func() {
+				container, err := pool.Create(api.ContainerSpec{})
+				Ω(err).ShouldNot(HaveOccurred())
+
+				Ω(container.(*linux_backend.LinuxContainer).Warnings()).Should(Equal([]string{
+					"swap accounting is disabled, so memory limits do not include swap",
+				}))
+			})
+
+			Context("when the host has swap accounting", func() {
+				BeforeEach(func() {
+					err := os.MkdirAll(path.Join(cgroupsPath, "memory"), 0755)
+					Ω(err).ShouldNot(HaveOccurred())
+
+					err = ioutil.WriteFile(path.Join(cgroupsPath, "memory", "memory.memsw.limit_in_bytes"), []byte("0\n"), 0644)
+					Ω(err).ShouldNot(HaveOccurred())
+
+					err = pool.Setup()
+					Ω(err).ShouldNot(HaveOccurred())
+				})
+
+				It("does not warn", func() {
+					container, err := pool.Create(api.ContainerSpec{})
+					Ω(err).ShouldNot(HaveOccurred())
+
+					Ω(container.(*linux_backend.LinuxContainer).Warnings()).Should(BeEmpty())
+				})
+
+				Context("but disk quotas are disabled", func() {
+					BeforeEach(func() {
+						fakeQuotaManager.Disable()
+					})
+
+					It("warns that disk limits are not enforced", func() {
+						container, err := pool.Create(api.ContainerSpec{
+							RootFSPath: "fake:///path/to/custom-rootfs",
+						})
+						Ω(err).ShouldNot(HaveOccurred())
+
+						Ω(container.(*linux_backend.LinuxContainer).Warnings()).Should(Equal([]string{
+							"disk quotas are disabled, so disk limits are not enforced",
+						}))
+					})
+
+					Context("and the container has its own volume", func() {
+						It("does not warn", func() {
+							container, err := pool.Create(api.ContainerSpec{})
+							Ω(err).ShouldNot(HaveOccurred())
+
+							Ω(container.(*linux_backend.LinuxContainer).Warnings()).Should(BeEmpty())
+						})
+					})
+				})
+			})
+		})
+
+		It("invalidates any disk usage cached for the uid by its last container", func() {
+			_, err := pool.Create(api.ContainerSpec{})
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(fakeQuotaManager.Invalidated).Should(Equal([]uint32{10000}))
+		})
+
 		It("executes create.sh with the correct args and environment", func() {
 			container, err := pool.Create(api.ContainerSpec{})
 			Ω(err).ShouldNot(HaveOccurred())
@@ -230,15 +696,948 @@ var _ = Describe("Container pool", func() {
 					Args: []string{path.Join(depotPath, container.ID())},
 					Env: []string{
 						"id=" + container.ID(),
+						"iface_name=" + container.ID(),
 						"rootfs_path=/provided/rootfs/path",
 						"user_uid=10000",
 						"network_host_ip=1.2.0.1",
 						"network_container_ip=1.2.0.2",
+						"network_attachments=1.3.0.1,1.3.0.2",
+						"container_external_ip=",
+						"network_tun=false",
+						"filesystem_fuse=false",
+						"security_no_new_privs=true",
+						"security_harden_proc_sys=false",
+						"security_apparmor_profile=",
+						"security_selinux_label=",
+						"network_plugin_links=false",
+						"network_dns_servers=",
+						"network_dns_search=",
+
+						"PATH=" + os.Getenv("PATH"),
+					},
+				},
+			))
+		})
+
+		It("erects the container's network with the network plugin", func() {
+			container, err := pool.Create(api.ContainerSpec{
+				Handle: "some-handle",
+			})
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(fakeNetworkPlugin.Erected).Should(HaveLen(1))
+
+			request := fakeNetworkPlugin.Erected[0]
+			Ω(request.ContainerID).Should(Equal(container.ID()))
+			Ω(request.ContainerHandle).Should(Equal("some-handle"))
+			Ω(request.Network.String()).Should(Equal("1.2.0.0/30"))
+			Ω(request.AdditionalNetworks).Should(HaveLen(1))
+			Ω(request.AdditionalNetworks[0].String()).Should(Equal("1.3.0.0/30"))
+		})
+
+		It("whitelists the configured devices in the container's devices cgroup", func() {
+			container, err := pool.Create(api.ContainerSpec{})
+			Ω(err).ShouldNot(HaveOccurred())
+
+			devicesPath := path.Join(cgroupsPath, "devices", "instance-"+container.ID())
+
+			deny, err := ioutil.ReadFile(path.Join(devicesPath, "devices.deny"))
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(string(deny)).Should(Equal("a"))
+
+			// each rule is written to devices.allow in turn; the kernel
+			// appends them, the file keeps the last
+			allow, err := ioutil.ReadFile(path.Join(devicesPath, "devices.allow"))
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(string(allow)).Should(Equal("c 1:5 rwm"))
+		})
+
+		It("places containers on NUMA nodes before they are started", func() {
+			container1, err := pool.Create(api.ContainerSpec{})
+			Ω(err).ShouldNot(HaveOccurred())
+
+			container2, err := pool.Create(api.ContainerSpec{})
+			Ω(err).ShouldNot(HaveOccurred())
+
+			for i, container := range []linux_backend.Container{container1, container2} {
+				cpusetPath := path.Join(cgroupsPath, "cpuset", "instance-"+container.ID())
+
+				cpus, err := ioutil.ReadFile(path.Join(cpusetPath, "cpuset.cpus"))
+				Ω(err).ShouldNot(HaveOccurred())
+
+				mems, err := ioutil.ReadFile(path.Join(cpusetPath, "cpuset.mems"))
+				Ω(err).ShouldNot(HaveOccurred())
+
+				Ω(string(cpus)).Should(Equal([]string{"0-3", "4-7"}[i]))
+				Ω(string(mems)).Should(Equal([]string{"0", "1"}[i]))
+			}
+		})
+
+		Context("when the container cannot be placed on a NUMA node", func() {
+			var err error
+
+			BeforeEach(func() {
+				// a file where the cpuset hierarchy should be
+				writeErr := ioutil.WriteFile(path.Join(cgroupsPath, "cpuset"), []byte{}, 0644)
+				Ω(writeErr).ShouldNot(HaveOccurred())
+
+				_, err = pool.Create(api.ContainerSpec{})
+			})
+
+			It("returns the error", func() {
+				Ω(err).Should(HaveOccurred())
+			})
+
+			It("frees its place on the node", func() {
+				Ω(numaPlacer.Utilization()[0].Containers).Should(BeZero())
+			})
+
+			itReleasesTheUserID()
+			itReleasesTheIPBlock()
+			itCleansUpTheRootfs()
+			itDeletesTheContainerDirectory()
+		})
+
+		Context("when the device whitelist cannot be applied", func() {
+			var err error
+
+			BeforeEach(func() {
+				// a file where the devices hierarchy should be
+				writeErr := ioutil.WriteFile(path.Join(cgroupsPath, "devices"), []byte{}, 0644)
+				Ω(writeErr).ShouldNot(HaveOccurred())
+
+				_, err = pool.Create(api.ContainerSpec{})
+			})
+
+			It("returns the error", func() {
+				Ω(err).Should(HaveOccurred())
+			})
+
+			It("does not erect the container's network", func() {
+				Ω(fakeNetworkPlugin.Erected).Should(BeEmpty())
+			})
+
+			itReleasesTheUserID()
+			itReleasesTheIPBlock()
+			itCleansUpTheRootfs()
+			itDeletesTheContainerDirectory()
+		})
+
+		Context("when the network plugin fails to erect the network", func() {
+			var err error
+
+			BeforeEach(func() {
+				fakeNetworkPlugin.ErectError = errors.New("oh no!")
+
+				_, err = pool.Create(api.ContainerSpec{})
+			})
+
+			It("returns the error", func() {
+				Ω(err).Should(Equal(fakeNetworkPlugin.ErectError))
+			})
+
+			It("dismantles whatever the plugin erected before failing", func() {
+				Ω(fakeNetworkPlugin.Dismantled).Should(HaveLen(1))
+				Ω(fakeNetworkPlugin.Dismantled[0].ContainerID).ShouldNot(BeEmpty())
+			})
+
+			itReleasesTheUserID()
+			itReleasesTheIPBlock()
+			itCleansUpTheRootfs()
+			itDeletesTheContainerDirectory()
+		})
+
+		Context("when links are delegated to the network plugin", func() {
+			BeforeEach(func() {
+				pool.DelegateLinksToNetworkPlugin()
+			})
+
+			It("tells create.sh to leave the container's links to the plugin", func() {
+				_, err := pool.Create(api.ContainerSpec{})
+				Ω(err).ShouldNot(HaveOccurred())
+
+				create := fakeRunner.ExecutedCommands()[0]
+				Ω(create.Path).Should(Equal("/root/path/create.sh"))
+				Ω(create.Env).Should(ContainElement("network_plugin_links=true"))
+			})
+
+			It("has the plugin build the container's links once it has started", func() {
+				container, err := pool.Create(api.ContainerSpec{
+					Handle: "some-handle",
+				})
+				Ω(err).ShouldNot(HaveOccurred())
+
+				runPath := path.Join(depotPath, container.ID(), "run")
+
+				err = os.MkdirAll(runPath, 0755)
+				Ω(err).ShouldNot(HaveOccurred())
+
+				err = ioutil.WriteFile(path.Join(runPath, "wshd.pid"), []byte("1234\n"), 0644)
+				Ω(err).ShouldNot(HaveOccurred())
+
+				Ω(fakeNetworkPlugin.Built).Should(BeEmpty())
+
+				err = container.Start(1500)
+				Ω(err).ShouldNot(HaveOccurred())
+
+				Ω(fakeNetworkPlugin.Built).Should(HaveLen(1))
+
+				request := fakeNetworkPlugin.Built[0]
+				Ω(request.ContainerID).Should(Equal(container.ID()))
+				Ω(request.ContainerHandle).Should(Equal("some-handle"))
+				Ω(request.Network.String()).Should(Equal("1.2.0.0/30"))
+				Ω(request.PID).Should(Equal(1234))
+			})
+		})
+
+		Context("when an external IP is requested", func() {
+			var spec api.ContainerSpec
+
+			BeforeEach(func() {
+				spec = api.ContainerSpec{
+					Properties: api.Properties{
+						linux_backend.ExternalIPProperty: "203.0.113.1",
+					},
+				}
+			})
+
+			It("takes it from the pool and passes it to create.sh", func() {
+				container, err := pool.Create(spec)
+				Ω(err).ShouldNot(HaveOccurred())
+
+				Ω(fakeExternalIPPool.Removed).Should(Equal([]string{"203.0.113.1"}))
+
+				resources := container.(*linux_backend.LinuxContainer).Resources()
+				Ω(resources.ExternalIP.String()).Should(Equal("203.0.113.1"))
+
+				Ω(fakeRunner).Should(HaveExecutedSerially(
+					fake_command_runner.CommandSpec{
+						Path: "/root/path/create.sh",
+						Args: []string{path.Join(depotPath, container.ID())},
+						Env: []string{
+							"id=" + container.ID(),
+							"iface_name=" + container.ID(),
+							"rootfs_path=/provided/rootfs/path",
+							"user_uid=10000",
+							"network_host_ip=1.2.0.1",
+							"network_container_ip=1.2.0.2",
+							"network_attachments=1.3.0.1,1.3.0.2",
+							"container_external_ip=203.0.113.1",
+							"network_tun=false",
+							"filesystem_fuse=false",
+							"security_no_new_privs=true",
+							"security_harden_proc_sys=false",
+							"security_apparmor_profile=",
+							"security_selinux_label=",
+							"network_plugin_links=false",
+							"network_dns_servers=",
+							"network_dns_search=",
+
+							"PATH=" + os.Getenv("PATH"),
+						},
+					},
+				))
+			})
+
+			Context("and it is malformed", func() {
+				BeforeEach(func() {
+					spec.Properties[linux_backend.ExternalIPProperty] = "not-an-ip"
+				})
+
+				It("returns an InvalidExternalIPError without acquiring anything", func() {
+					_, err := pool.Create(spec)
+					Ω(err).Should(Equal(container_pool.InvalidExternalIPError{IP: "not-an-ip"}))
+
+					Ω(fakeUIDPool.Acquired).Should(BeEmpty())
+					Ω(fakeExternalIPPool.Removed).Should(BeEmpty())
+				})
+			})
+
+			Context("and it cannot be taken from the pool", func() {
+				disaster := errors.New("oh no!")
+
+				BeforeEach(func() {
+					fakeExternalIPPool.RemoveError = disaster
+				})
+
+				It("returns the error and releases the uid and network", func() {
+					_, err := pool.Create(spec)
+					Ω(err).Should(Equal(disaster))
+
+					Ω(fakeUIDPool.Released).Should(ContainElement(uint32(10000)))
+					Ω(fakeNetworkPool.Released).Should(ContainElement("1.2.0.0/30"))
+				})
+			})
+
+			Context("and creating the container fails", func() {
+				BeforeEach(func() {
+					fakeRunner.WhenRunning(
+						fake_command_runner.CommandSpec{
+							Path: "/root/path/create.sh",
+						}, func(*exec.Cmd) error {
+							return errors.New("oh no!")
+						},
+					)
+				})
+
+				It("releases the external IP", func() {
+					_, err := pool.Create(spec)
+					Ω(err).Should(HaveOccurred())
+
+					Ω(fakeExternalIPPool.Released).Should(Equal([]string{"203.0.113.1"}))
+				})
+			})
+		})
+
+		Context("when /dev/net/tun is requested", func() {
+			var spec api.ContainerSpec
+
+			BeforeEach(func() {
+				spec = api.ContainerSpec{
+					Properties: api.Properties{
+						linux_backend.TunProperty: "true",
+					},
+				}
+			})
+
+			It("tells create.sh to make the device", func() {
+				container, err := pool.Create(spec)
+				Ω(err).ShouldNot(HaveOccurred())
+
+				Ω(fakeRunner).Should(HaveExecutedSerially(
+					fake_command_runner.CommandSpec{
+						Path: "/root/path/create.sh",
+						Args: []string{path.Join(depotPath, container.ID())},
+						Env: []string{
+							"id=" + container.ID(),
+							"iface_name=" + container.ID(),
+							"rootfs_path=/provided/rootfs/path",
+							"user_uid=10000",
+							"network_host_ip=1.2.0.1",
+							"network_container_ip=1.2.0.2",
+							"network_attachments=1.3.0.1,1.3.0.2",
+							"container_external_ip=",
+							"network_tun=true",
+							"filesystem_fuse=false",
+							"security_no_new_privs=true",
+							"security_harden_proc_sys=false",
+							"security_apparmor_profile=",
+							"security_selinux_label=",
+							"network_plugin_links=false",
+							"network_dns_servers=",
+							"network_dns_search=",
+
+							"PATH=" + os.Getenv("PATH"),
+						},
+					},
+				))
+			})
+
+			It("whitelists it after the configured devices", func() {
+				container, err := pool.Create(spec)
+				Ω(err).ShouldNot(HaveOccurred())
+
+				allow, err := ioutil.ReadFile(path.Join(cgroupsPath, "devices", "instance-"+container.ID(), "devices.allow"))
+				Ω(err).ShouldNot(HaveOccurred())
+				Ω(string(allow)).Should(Equal("c 10:200 rwm"))
+			})
+
+			It("does not whitelist it for other containers", func() {
+				_, err := pool.Create(spec)
+				Ω(err).ShouldNot(HaveOccurred())
+
+				container, err := pool.Create(api.ContainerSpec{})
+				Ω(err).ShouldNot(HaveOccurred())
+
+				allow, err := ioutil.ReadFile(path.Join(cgroupsPath, "devices", "instance-"+container.ID(), "devices.allow"))
+				Ω(err).ShouldNot(HaveOccurred())
+				Ω(string(allow)).Should(Equal("c 1:5 rwm"))
+			})
+
+			Context("and the property is not a boolean", func() {
+				BeforeEach(func() {
+					spec.Properties[linux_backend.TunProperty] = "please"
+				})
+
+				It("returns an InvalidBoolPropertyError without creating the container", func() {
+					_, err := pool.Create(spec)
+					Ω(err).Should(Equal(container_pool.InvalidBoolPropertyError{
+						Property: linux_backend.TunProperty,
+						Value:    "please",
+					}))
+
+					Ω(fakeRunner.ExecutedCommands()).Should(BeEmpty())
+				})
+			})
+		})
+
+		It("annotates the container with its creation time and the garden version", func() {
+			before := time.Now()
+
+			container, err := pool.Create(api.ContainerSpec{})
+			Ω(err).ShouldNot(HaveOccurred())
+
+			annotations := container.(*linux_backend.LinuxContainer).Annotations()
+			Ω(annotations.CreatedAt).Should(BeTemporally(">=", before))
+			Ω(annotations.CreatedAt).Should(BeTemporally("<=", time.Now()))
+			Ω(annotations.GardenVersion).Should(Equal("some-version"))
+		})
+
+		Context("when a property is reserved for annotations", func() {
+			It("returns a ReservedPropertyError without creating the container", func() {
+				_, err := pool.Create(api.ContainerSpec{
+					Properties: api.Properties{
+						"annotation.created_at": "yesterday",
+					},
+				})
+				Ω(err).Should(Equal(container_pool.ReservedPropertyError{
+					Name: "annotation.created_at",
+				}))
+
+				Ω(fakeRunner.ExecutedCommands()).Should(BeEmpty())
+			})
+		})
+
+		Context("when the spec is invalid", func() {
+			itRejectsTheSpec := func(spec api.ContainerSpec, expected error) {
+				_, err := pool.Create(spec)
+				Ω(err).Should(Equal(expected))
+
+				Ω(fakeUIDPool.Acquired).Should(BeEmpty())
+				Ω(fakeRunner.ExecutedCommands()).Should(BeEmpty())
+			}
+
+			It("rejects a negative grace time", func() {
+				itRejectsTheSpec(api.ContainerSpec{GraceTime: -time.Second}, container_pool.InvalidSpecError{
+					Field:  "GraceTime",
+					Value:  "-1s",
+					Reason: "must not be negative",
+				})
+			})
+
+			It("rejects a malformed network", func() {
+				itRejectsTheSpec(api.ContainerSpec{Network: "bogus"}, container_pool.InvalidSpecError{
+					Field:  "Network",
+					Value:  "bogus",
+					Reason: `malformed network spec "bogus": expected key:value, a CIDR or an IP`,
+				})
+			})
+
+			It("rejects a relative bind mount path", func() {
+				itRejectsTheSpec(api.ContainerSpec{
+					BindMounts: []api.BindMount{
+						{SrcPath: "/src", DstPath: "/dst"},
+						{SrcPath: "/src", DstPath: "dst"},
+					},
+				}, container_pool.InvalidSpecError{
+					Field:  "BindMounts[1].DstPath",
+					Value:  "dst",
+					Reason: "must be absolute",
+				})
+			})
+
+			It("rejects a bind mount path that leaves the rootfs", func() {
+				itRejectsTheSpec(api.ContainerSpec{
+					BindMounts: []api.BindMount{
+						{SrcPath: "/src", DstPath: "/../etc"},
+					},
+				}, container_pool.InvalidSpecError{
+					Field:  "BindMounts[0].DstPath",
+					Value:  "/../etc",
+					Reason: "must not contain ..",
+				})
+			})
+
+			It("rejects a bind mount path that the hook would not run as given", func() {
+				itRejectsTheSpec(api.ContainerSpec{
+					BindMounts: []api.BindMount{
+						{SrcPath: "/src; reboot", DstPath: "/dst"},
+					},
+				}, container_pool.InvalidSpecError{
+					Field:  "BindMounts[0].SrcPath",
+					Value:  "/src; reboot",
+					Reason: "must not contain whitespace or shell metacharacters",
+				})
+			})
+
+			It("rejects an unknown bind mount mode", func() {
+				itRejectsTheSpec(api.ContainerSpec{
+					BindMounts: []api.BindMount{
+						{SrcPath: "/src", DstPath: "/dst", Mode: 7},
+					},
+				}, container_pool.InvalidSpecError{
+					Field:  "BindMounts[0].Mode",
+					Value:  "7",
+					Reason: "must be read-only or read-write",
+				})
+			})
+
+			It("rejects a huge pages limit that is not a number of bytes", func() {
+				itRejectsTheSpec(api.ContainerSpec{
+					Properties: api.Properties{
+						"hugetlb.2MB.limit_in_bytes": "-1",
+					},
+				}, linux_backend.InvalidHugePagesPropertyError{
+					Property: "hugetlb.2MB.limit_in_bytes",
+					Value:    "-1",
+				})
+			})
+
+			It("rejects a malformed shutdown hook timeout", func() {
+				itRejectsTheSpec(api.ContainerSpec{
+					Properties: api.Properties{
+						linux_backend.ShutdownHookTimeoutProperty: "soon",
+					},
+				}, container_pool.InvalidSpecError{
+					Field:  "Properties[lifecycle.shutdown_hook_timeout]",
+					Value:  "soon",
+					Reason: "must be a non-negative duration",
+				})
+			})
+		})
+
+		Context("when /dev/fuse is requested", func() {
+			var spec api.ContainerSpec
+
+			BeforeEach(func() {
+				spec = api.ContainerSpec{
+					Properties: api.Properties{
+						linux_backend.FuseProperty: "true",
+					},
+				}
+			})
+
+			It("tells create.sh to make the device", func() {
+				container, err := pool.Create(spec)
+				Ω(err).ShouldNot(HaveOccurred())
+
+				Ω(fakeRunner).Should(HaveExecutedSerially(
+					fake_command_runner.CommandSpec{
+						Path: "/root/path/create.sh",
+						Args: []string{path.Join(depotPath, container.ID())},
+						Env: []string{
+							"id=" + container.ID(),
+							"iface_name=" + container.ID(),
+							"rootfs_path=/provided/rootfs/path",
+							"user_uid=10000",
+							"network_host_ip=1.2.0.1",
+							"network_container_ip=1.2.0.2",
+							"network_attachments=1.3.0.1,1.3.0.2",
+							"container_external_ip=",
+							"network_tun=false",
+							"filesystem_fuse=true",
+							"security_no_new_privs=false",
+							"security_harden_proc_sys=false",
+							"security_apparmor_profile=",
+							"security_selinux_label=",
+							"network_plugin_links=false",
+							"network_dns_servers=",
+							"network_dns_search=",
+
+							"PATH=" + os.Getenv("PATH"),
+						},
+					},
+				))
+			})
+
+			It("whitelists it after the configured devices", func() {
+				container, err := pool.Create(spec)
+				Ω(err).ShouldNot(HaveOccurred())
+
+				allow, err := ioutil.ReadFile(path.Join(cgroupsPath, "devices", "instance-"+container.ID(), "devices.allow"))
+				Ω(err).ShouldNot(HaveOccurred())
+				Ω(string(allow)).Should(Equal("c 10:229 rwm"))
+			})
+
+			Context("and the property is not a boolean", func() {
+				BeforeEach(func() {
+					spec.Properties[linux_backend.FuseProperty] = "maybe"
+				})
+
+				It("returns an InvalidBoolPropertyError without creating the container", func() {
+					_, err := pool.Create(spec)
+					Ω(err).Should(Equal(container_pool.InvalidBoolPropertyError{
+						Property: linux_backend.FuseProperty,
+						Value:    "maybe",
+					}))
+
+					Ω(fakeRunner.ExecutedCommands()).Should(BeEmpty())
+				})
+			})
+		})
+
+		Context("when setuid binaries are allowed", func() {
+			var spec api.ContainerSpec
+
+			BeforeEach(func() {
+				spec = api.ContainerSpec{
+					Properties: api.Properties{
+						linux_backend.AllowSetuidProperty: "true",
+					},
+				}
+			})
+
+			It("tells create.sh not to run processes with no_new_privs", func() {
+				container, err := pool.Create(spec)
+				Ω(err).ShouldNot(HaveOccurred())
+
+				Ω(fakeRunner).Should(HaveExecutedSerially(
+					fake_command_runner.CommandSpec{
+						Path: "/root/path/create.sh",
+						Args: []string{path.Join(depotPath, container.ID())},
+						Env: []string{
+							"id=" + container.ID(),
+							"iface_name=" + container.ID(),
+							"rootfs_path=/provided/rootfs/path",
+							"user_uid=10000",
+							"network_host_ip=1.2.0.1",
+							"network_container_ip=1.2.0.2",
+							"network_attachments=1.3.0.1,1.3.0.2",
+							"container_external_ip=",
+							"network_tun=false",
+							"filesystem_fuse=false",
+							"security_no_new_privs=false",
+							"security_harden_proc_sys=false",
+							"security_apparmor_profile=",
+							"security_selinux_label=",
+							"network_plugin_links=false",
+							"network_dns_servers=",
+							"network_dns_search=",
+
+							"PATH=" + os.Getenv("PATH"),
+						},
+					},
+				))
+			})
+
+			Context("and the property is not a boolean", func() {
+				BeforeEach(func() {
+					spec.Properties[linux_backend.AllowSetuidProperty] = "sometimes"
+				})
+
+				It("returns an InvalidBoolPropertyError without creating the container", func() {
+					_, err := pool.Create(spec)
+					Ω(err).Should(Equal(container_pool.InvalidBoolPropertyError{
+						Property: linux_backend.AllowSetuidProperty,
+						Value:    "sometimes",
+					}))
+
+					Ω(fakeRunner.ExecutedCommands()).Should(BeEmpty())
+				})
+			})
+		})
+
+		Context("when a container asks for its /proc and /sys to be hardened", func() {
+			var spec api.ContainerSpec
+
+			BeforeEach(func() {
+				spec = api.ContainerSpec{
+					Properties: api.Properties{
+						linux_backend.HardenProcSysProperty: "true",
+					},
+				}
+			})
+
+			It("tells create.sh to harden them", func() {
+				_, err := pool.Create(spec)
+				Ω(err).ShouldNot(HaveOccurred())
+
+				create := fakeRunner.ExecutedCommands()[0]
+				Ω(create.Path).Should(Equal("/root/path/create.sh"))
+				Ω(create.Env).Should(ContainElement("security_harden_proc_sys=true"))
+			})
+
+			Context("and the property is not a boolean", func() {
+				BeforeEach(func() {
+					spec.Properties[linux_backend.HardenProcSysProperty] = "mostly"
+				})
+
+				It("returns an InvalidBoolPropertyError without creating the container", func() {
+					_, err := pool.Create(spec)
+					Ω(err).Should(Equal(container_pool.InvalidBoolPropertyError{
+						Property: linux_backend.HardenProcSysProperty,
+						Value:    "mostly",
+					}))
+
+					Ω(fakeRunner.ExecutedCommands()).Should(BeEmpty())
+				})
+			})
+		})
+
+		Context("when the pool hardens /proc and /sys by default", func() {
+			BeforeEach(func() {
+				pool.HardenProcSys()
+			})
+
+			It("tells create.sh to harden them", func() {
+				_, err := pool.Create(api.ContainerSpec{})
+				Ω(err).ShouldNot(HaveOccurred())
+
+				create := fakeRunner.ExecutedCommands()[0]
+				Ω(create.Env).Should(ContainElement("security_harden_proc_sys=true"))
+			})
+
+			Context("but the container opts out", func() {
+				It("tells create.sh not to harden them", func() {
+					_, err := pool.Create(api.ContainerSpec{
+						Properties: api.Properties{
+							linux_backend.HardenProcSysProperty: "false",
+						},
+					})
+					Ω(err).ShouldNot(HaveOccurred())
+
+					create := fakeRunner.ExecutedCommands()[0]
+					Ω(create.Env).Should(ContainElement("security_harden_proc_sys=false"))
+				})
+			})
+		})
+
+		Context("when containers are confined with AppArmor", func() {
+			BeforeEach(func() {
+				pool.ConfineWithAppArmor("garden-default")
+			})
+
+			It("tells create.sh to confine the container with the profile", func() {
+				_, err := pool.Create(api.ContainerSpec{})
+				Ω(err).ShouldNot(HaveOccurred())
+
+				create := fakeRunner.ExecutedCommands()[0]
+				Ω(create.Path).Should(Equal("/root/path/create.sh"))
+				Ω(create.Env).Should(ContainElement("security_apparmor_profile=garden-default"))
+			})
+
+			Context("and the container selects another profile", func() {
+				It("tells create.sh to confine the container with that profile", func() {
+					_, err := pool.Create(api.ContainerSpec{
+						Properties: api.Properties{
+							linux_backend.AppArmorProfileProperty: "some-profile",
+						},
+					})
+					Ω(err).ShouldNot(HaveOccurred())
+
+					create := fakeRunner.ExecutedCommands()[0]
+					Ω(create.Env).Should(ContainElement("security_apparmor_profile=some-profile"))
+				})
+			})
+
+			Context("and the container opts out", func() {
+				It("tells create.sh not to confine the container", func() {
+					_, err := pool.Create(api.ContainerSpec{
+						Properties: api.Properties{
+							linux_backend.AppArmorProfileProperty: linux_backend.AppArmorUnconfined,
+						},
+					})
+					Ω(err).ShouldNot(HaveOccurred())
+
+					create := fakeRunner.ExecutedCommands()[0]
+					Ω(create.Env).Should(ContainElement("security_apparmor_profile="))
+				})
+			})
+
+			Context("and the container's profile is not a valid name", func() {
+				It("returns an InvalidSpecError without creating the container", func() {
+					_, err := pool.Create(api.ContainerSpec{
+						Properties: api.Properties{
+							linux_backend.AppArmorProfileProperty: "some-profile; reboot",
+						},
+					})
+					Ω(err).Should(BeAssignableToTypeOf(container_pool.InvalidSpecError{}))
+					Ω(err.(container_pool.InvalidSpecError).Field).Should(Equal("Properties[security.apparmor_profile]"))
+
+					Ω(fakeRunner.ExecutedCommands()).Should(BeEmpty())
+				})
+			})
+		})
+
+		Context("when containers are labelled with SELinux", func() {
+			var labeler *selinux_labeler.Labeler
+
+			BeforeEach(func() {
+				var err error
+
+				labeler, err = selinux_labeler.New(selinux_labeler.DefaultProcessContext, selinux_labeler.DefaultFileContext)
+				Ω(err).ShouldNot(HaveOccurred())
+
+				pool.LabelWithSELinux(labeler)
+			})
+
+			It("mounts the container's rootfs with its file label", func() {
+				container, err := pool.Create(api.ContainerSpec{})
+				Ω(err).ShouldNot(HaveOccurred())
+
+				labels := labeler.Labels(container.(*linux_backend.LinuxContainer).Resources().UID)
+				Ω(labels.File).Should(HavePrefix(selinux_labeler.DefaultFileContext + ":c"))
+
+				_, _, _, mountLabel := defaultFakeRootFSProvider.ProvideRootFSArgsForCall(0)
+				Ω(mountLabel).Should(Equal(labels.File))
+			})
+
+			It("tells create.sh to run the container's processes with its process label", func() {
+				container, err := pool.Create(api.ContainerSpec{})
+				Ω(err).ShouldNot(HaveOccurred())
+
+				labels := labeler.Labels(container.(*linux_backend.LinuxContainer).Resources().UID)
+
+				create := fakeRunner.ExecutedCommands()[0]
+				Ω(create.Env).Should(ContainElement("security_selinux_label=" + labels.Process))
+			})
+
+			It("labels each container with its own categories", func() {
+				_, err := pool.Create(api.ContainerSpec{})
+				Ω(err).ShouldNot(HaveOccurred())
+
+				_, err = pool.Create(api.ContainerSpec{})
+				Ω(err).ShouldNot(HaveOccurred())
+
+				_, _, _, firstLabel := defaultFakeRootFSProvider.ProvideRootFSArgsForCall(0)
+				_, _, _, secondLabel := defaultFakeRootFSProvider.ProvideRootFSArgsForCall(1)
+				Ω(firstLabel).ShouldNot(Equal(secondLabel))
+			})
+		})
+
+		Context("when containers are not labelled with SELinux", func() {
+			It("mounts the container's rootfs without a label", func() {
+				_, err := pool.Create(api.ContainerSpec{})
+				Ω(err).ShouldNot(HaveOccurred())
+
+				_, _, _, mountLabel := defaultFakeRootFSProvider.ProvideRootFSArgsForCall(0)
+				Ω(mountLabel).Should(BeEmpty())
+			})
+		})
+
+		Describe("DNS", func() {
+			It("tells create.sh to leave the host's resolv.conf in place", func() {
+				_, err := pool.Create(api.ContainerSpec{})
+				Ω(err).ShouldNot(HaveOccurred())
+
+				create := fakeRunner.ExecutedCommands()[0]
+				Ω(create.Env).Should(ContainElement("network_dns_servers="))
+				Ω(create.Env).Should(ContainElement("network_dns_search="))
+			})
+
+			Context("when the container requests nameservers and search domains", func() {
+				It("tells create.sh to write them", func() {
+					_, err := pool.Create(api.ContainerSpec{
+						Properties: api.Properties{
+							linux_backend.DNSServersProperty:       "10.0.0.53, 10.0.1.53",
+							linux_backend.DNSSearchDomainsProperty: "service.internal,example.com",
+						},
+					})
+					Ω(err).ShouldNot(HaveOccurred())
+
+					create := fakeRunner.ExecutedCommands()[0]
+					Ω(create.Env).Should(ContainElement("network_dns_servers=10.0.0.53 10.0.1.53"))
+					Ω(create.Env).Should(ContainElement("network_dns_search=service.internal example.com"))
+				})
+			})
+
+			Context("when the pool is configured with DNS", func() {
+				BeforeEach(func() {
+					err := pool.ConfigureDNS([]string{"8.8.8.8", "8.8.4.4"}, []string{"example.com"})
+					Ω(err).ShouldNot(HaveOccurred())
+				})
+
+				It("tells create.sh to write the pool's", func() {
+					_, err := pool.Create(api.ContainerSpec{})
+					Ω(err).ShouldNot(HaveOccurred())
+
+					create := fakeRunner.ExecutedCommands()[0]
+					Ω(create.Env).Should(ContainElement("network_dns_servers=8.8.8.8 8.8.4.4"))
+					Ω(create.Env).Should(ContainElement("network_dns_search=example.com"))
+				})
+
+				Context("and the container requests its own nameservers", func() {
+					It("tells create.sh to write the container's nameservers, with the pool's search domains", func() {
+						_, err := pool.Create(api.ContainerSpec{
+							Properties: api.Properties{
+								linux_backend.DNSServersProperty: "10.0.0.53",
+							},
+						})
+						Ω(err).ShouldNot(HaveOccurred())
+
+						create := fakeRunner.ExecutedCommands()[0]
+						Ω(create.Env).Should(ContainElement("network_dns_servers=10.0.0.53"))
+						Ω(create.Env).Should(ContainElement("network_dns_search=example.com"))
+					})
+				})
+
+				Context("and the container requests no search domains", func() {
+					It("tells create.sh to write none", func() {
+						_, err := pool.Create(api.ContainerSpec{
+							Properties: api.Properties{
+								linux_backend.DNSSearchDomainsProperty: "",
+							},
+						})
+						Ω(err).ShouldNot(HaveOccurred())
+
+						create := fakeRunner.ExecutedCommands()[0]
+						Ω(create.Env).Should(ContainElement("network_dns_search="))
+					})
+				})
+			})
+
+			Context("when the pool is configured with a malformed nameserver", func() {
+				It("returns an error", func() {
+					err := pool.ConfigureDNS([]string{"dns.example.com"}, nil)
+					Ω(err).Should(HaveOccurred())
+				})
+			})
+
+			Context("when the pool is configured with a malformed search domain", func() {
+				It("returns an error", func() {
+					err := pool.ConfigureDNS(nil, []string{"example.com; reboot"})
+					Ω(err).Should(HaveOccurred())
+				})
+			})
+
+			Context("when the container requests a nameserver that is not an IP", func() {
+				It("returns an InvalidSpecError without creating the container", func() {
+					_, err := pool.Create(api.ContainerSpec{
+						Properties: api.Properties{
+							linux_backend.DNSServersProperty: "dns.example.com",
+						},
+					})
+					Ω(err).Should(BeAssignableToTypeOf(container_pool.InvalidSpecError{}))
+					Ω(err.(container_pool.InvalidSpecError).Field).Should(Equal("Properties[network.dns_servers]"))
+
+					Ω(fakeRunner.ExecutedCommands()).Should(BeEmpty())
+				})
+			})
+
+			Context("when the container requests more nameservers than the resolver uses", func() {
+				It("returns an InvalidSpecError without creating the container", func() {
+					_, err := pool.Create(api.ContainerSpec{
+						Properties: api.Properties{
+							linux_backend.DNSServersProperty: "10.0.0.1,10.0.0.2,10.0.0.3,10.0.0.4",
+						},
+					})
+					Ω(err).Should(BeAssignableToTypeOf(container_pool.InvalidSpecError{}))
+					Ω(err.(container_pool.InvalidSpecError).Field).Should(Equal("Properties[network.dns_servers]"))
+				})
+			})
+
+			Context("when the container requests a search domain with shell metacharacters", func() {
+				It("returns an InvalidSpecError without creating the container", func() {
+					_, err := pool.Create(api.ContainerSpec{
+						Properties: api.Properties{
+							linux_backend.DNSSearchDomainsProperty: "example.com,$(reboot)",
+						},
+					})
+					Ω(err).Should(BeAssignableToTypeOf(container_pool.InvalidSpecError{}))
+					Ω(err.(container_pool.InvalidSpecError).Field).Should(Equal("Properties[network.dns_search_domains]"))
 
-						"PATH=" + os.Getenv("PATH"),
-					},
-				},
-			))
+					Ω(fakeRunner.ExecutedCommands()).Should(BeEmpty())
+				})
+			})
+		})
+
+		It("gives the container a network from each additional pool", func() {
+			container, err := pool.Create(api.ContainerSpec{})
+			Ω(err).ShouldNot(HaveOccurred())
+
+			resources := container.(*linux_backend.LinuxContainer).Resources()
+			Ω(resources.AdditionalNetworks).Should(HaveLen(1))
+			Ω(resources.AdditionalNetworks[0].String()).Should(Equal("1.3.0.0/30"))
 		})
 
 		It("saves the determined rootfs provider to the depot", func() {
@@ -251,14 +1650,38 @@ var _ = Describe("Container pool", func() {
 			Ω(string(body)).Should(Equal(""))
 		})
 
+		It("gives the container its own volume, resized by disk limits", func() {
+			container, err := pool.Create(api.ContainerSpec{})
+			Ω(err).ShouldNot(HaveOccurred())
+
+			err = container.LimitDisk(api.DiskLimits{ByteHard: 1024 * 1024})
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(fakeVolumeManager.Resized).Should(Equal(map[string]uint64{
+				container.ID(): 1024 * 1024,
+			}))
+		})
+
 		Context("when a rootfs is specified", func() {
+			It("does not give the container its own volume", func() {
+				container, err := pool.Create(api.ContainerSpec{
+					RootFSPath: "fake:///path/to/custom-rootfs",
+				})
+				Ω(err).ShouldNot(HaveOccurred())
+
+				err = container.LimitDisk(api.DiskLimits{ByteHard: 1024 * 1024})
+				Ω(err).ShouldNot(HaveOccurred())
+
+				Ω(fakeVolumeManager.Resized).Should(BeEmpty())
+			})
+
 			It("is used to provide a rootfs", func() {
 				container, err := pool.Create(api.ContainerSpec{
 					RootFSPath: "fake:///path/to/custom-rootfs",
 				})
 				Ω(err).ShouldNot(HaveOccurred())
 
-				_, id, uri := fakeRootFSProvider.ProvideRootFSArgsForCall(0)
+				_, id, uri, _ := fakeRootFSProvider.ProvideRootFSArgsForCall(0)
 				Ω(id).Should(Equal(container.ID()))
 				Ω(uri).Should(Equal(&url.URL{
 					Scheme: "fake",
@@ -268,7 +1691,7 @@ var _ = Describe("Container pool", func() {
 			})
 
 			It("passes the provided rootfs as $rootfs_path to create.sh", func() {
-				fakeRootFSProvider.ProvideRootFSReturns("/var/some/mount/point", nil, nil)
+				fakeRootFSProvider.ProvideRootFSReturns("/var/some/mount/point", nil, rootfs_provider.Provenance{}, nil)
 
 				container, err := pool.Create(api.ContainerSpec{
 					RootFSPath: "fake:///path/to/custom-rootfs",
@@ -281,10 +1704,22 @@ var _ = Describe("Container pool", func() {
 						Args: []string{path.Join(depotPath, container.ID())},
 						Env: []string{
 							"id=" + container.ID(),
+							"iface_name=" + container.ID(),
 							"rootfs_path=/var/some/mount/point",
 							"user_uid=10000",
 							"network_host_ip=1.2.0.1",
 							"network_container_ip=1.2.0.2",
+							"network_attachments=1.3.0.1,1.3.0.2",
+							"container_external_ip=",
+							"network_tun=false",
+							"filesystem_fuse=false",
+							"security_no_new_privs=true",
+							"security_harden_proc_sys=false",
+							"security_apparmor_profile=",
+							"security_selinux_label=",
+							"network_plugin_links=false",
+							"network_dns_servers=",
+							"network_dns_search=",
 
 							"PATH=" + os.Getenv("PATH"),
 						},
@@ -304,11 +1739,31 @@ var _ = Describe("Container pool", func() {
 				Ω(string(body)).Should(Equal("fake"))
 			})
 
-			It("merges the env vars associated with the rootfs with those in the spec", func() {
+			It("records the provenance of the rootfs", func() {
+				fakeRootFSProvider.ProvideRootFSReturns("/provided/rootfs/path", nil, rootfs_provider.Provenance{
+					Image:   "some-image",
+					ImageID: "some-image-id",
+					Layers:  []string{"some-image-id", "some-parent-id"},
+				}, nil)
+
+				container, err := pool.Create(api.ContainerSpec{
+					RootFSPath: "fake:///path/to/custom-rootfs",
+				})
+				Ω(err).ShouldNot(HaveOccurred())
+
+				Ω(container.(*linux_backend.LinuxContainer).RootFSProvenance()).Should(Equal(linux_backend.RootFSProvenance{
+					Provider: "fake",
+					Image:    "some-image",
+					ImageID:  "some-image-id",
+					Layers:   []string{"some-image-id", "some-parent-id"},
+				}))
+			})
+
+			It("merges the env vars associated with the rootfs with those in the spec, giving the spec precedence", func() {
 				fakeRootFSProvider.ProvideRootFSReturns("/provided/rootfs/path", []string{
 					"var2=rootfs-value-2",
 					"var3=rootfs-value-3",
-				}, nil)
+				}, rootfs_provider.Provenance{}, nil)
 
 				container, err := pool.Create(api.ContainerSpec{
 					RootFSPath: "fake:///path/to/custom-rootfs",
@@ -320,13 +1775,25 @@ var _ = Describe("Container pool", func() {
 
 				Ω(err).ShouldNot(HaveOccurred())
 				Ω(container.(*linux_backend.LinuxContainer).CurrentEnvVars()).Should(Equal([]string{
-					"var1=spec-value1",
 					"var2=spec-value2",
-					"var2=rootfs-value-2",
 					"var3=rootfs-value-3",
+					"var1=spec-value1",
 				}))
 			})
 
+			Context("when the spec contains a malformed env var", func() {
+				It("returns an error before providing a rootfs or creating the container", func() {
+					_, err := pool.Create(api.ContainerSpec{
+						RootFSPath: "fake:///path/to/custom-rootfs",
+						Env:        []string{"var1=spec-value1", "bogus"},
+					})
+					Ω(err).Should(Equal(env.MalformedEnvironmentVariableError{Var: "bogus"}))
+
+					Ω(fakeRootFSProvider.ProvideRootFSCallCount()).Should(Equal(0))
+					Ω(fakeRunner.ExecutedCommands()).Should(BeEmpty())
+				})
+			})
+
 			Context("when the rootfs URL is not valid", func() {
 				var err error
 
@@ -336,12 +1803,16 @@ var _ = Describe("Container pool", func() {
 					})
 				})
 
-				It("returns an error", func() {
-					Ω(err).Should(BeAssignableToTypeOf(&url.Error{}))
-				})
+				It("returns an InvalidSpecError without acquiring anything", func() {
+					Ω(err).Should(Equal(container_pool.InvalidSpecError{
+						Field:  "RootFSPath",
+						Value:  "::::::",
+						Reason: "must be a URL",
+					}))
 
-				itReleasesTheUserID()
-				itReleasesTheIPBlock()
+					Ω(fakeUIDPool.Acquired).Should(BeEmpty())
+					Ω(fakeRunner.ExecutedCommands()).Should(BeEmpty())
+				})
 			})
 
 			Context("when its scheme is unknown", func() {
@@ -366,7 +1837,7 @@ var _ = Describe("Container pool", func() {
 				providerErr := errors.New("oh no!")
 
 				BeforeEach(func() {
-					fakeRootFSProvider.ProvideRootFSReturns("", nil, providerErr)
+					fakeRootFSProvider.ProvideRootFSReturns("", nil, rootfs_provider.Provenance{}, providerErr)
 
 					_, err = pool.Create(api.ContainerSpec{
 						RootFSPath: "fake:///path/to/custom-rootfs",
@@ -508,6 +1979,59 @@ var _ = Describe("Container pool", func() {
 				))
 			})
 
+			Context("when the source is a file, e.g. a host service's socket", func() {
+				var socketDir string
+				var listener net.Listener
+
+				BeforeEach(func() {
+					var err error
+
+					socketDir, err = ioutil.TempDir("", "host-socket")
+					Ω(err).ShouldNot(HaveOccurred())
+
+					listener, err = net.Listen("unix", path.Join(socketDir, "metrics.sock"))
+					Ω(err).ShouldNot(HaveOccurred())
+				})
+
+				AfterEach(func() {
+					listener.Close()
+					os.RemoveAll(socketDir)
+				})
+
+				It("mounts it over a file in the container", func() {
+					srcPath := path.Join(socketDir, "metrics.sock")
+
+					container, err := pool.Create(api.ContainerSpec{
+						BindMounts: []api.BindMount{
+							{
+								SrcPath: srcPath,
+								DstPath: "/var/run/metrics.sock",
+								Mode:    api.BindMountModeRW,
+							},
+						},
+					})
+					Ω(err).ShouldNot(HaveOccurred())
+
+					hook := path.Join(depotPath, container.ID(), "lib", "hook-child-before-pivot.sh")
+					rootfsPath := "/provided/rootfs/path"
+
+					Ω(fakeRunner).Should(HaveExecutedSerially(
+						fake_command_runner.CommandSpec{
+							Path: "bash",
+							Args: []string{"-c", "echo mkdir -p " + rootfsPath + "/var/run >> " + hook},
+						},
+						fake_command_runner.CommandSpec{
+							Path: "bash",
+							Args: []string{"-c", "echo touch " + rootfsPath + "/var/run/metrics.sock >> " + hook},
+						},
+						fake_command_runner.CommandSpec{
+							Path: "bash",
+							Args: []string{"-c", "echo mount -n --bind " + srcPath + " " + rootfsPath + "/var/run/metrics.sock >> " + hook},
+						},
+					))
+				})
+			})
+
 			Context("when appending to hook-child-before-pivot.sh fails", func() {
 				var err error
 				disaster := errors.New("oh no!")
@@ -574,6 +2098,22 @@ var _ = Describe("Container pool", func() {
 			})
 		})
 
+		Context("when acquiring an additional network fails", func() {
+			nastyError := errors.New("oh no!")
+
+			JustBeforeEach(func() {
+				fakeAdditionalNetworkPool.AcquireError = nastyError
+			})
+
+			It("returns the error and releases the uid and network", func() {
+				_, err := pool.Create(api.ContainerSpec{})
+				Ω(err).Should(Equal(nastyError))
+
+				Ω(fakeUIDPool.Released).Should(ContainElement(uint32(10000)))
+				Ω(fakeNetworkPool.Released).Should(ContainElement("1.2.0.0/30"))
+			})
+		})
+
 		Context("when executing create.sh fails", func() {
 			var containerPath string
 			nastyError := errors.New("oh no!")
@@ -591,12 +2131,13 @@ var _ = Describe("Container pool", func() {
 				pool.Create(api.ContainerSpec{})
 			})
 
-			It("returns the error and releases the uid and network", func() {
+			It("returns the error and releases the uid and networks", func() {
 				_, err := pool.Create(api.ContainerSpec{})
 				Ω(err).Should(Equal(nastyError))
 
 				Ω(fakeUIDPool.Released).Should(ContainElement(uint32(10000)))
 				Ω(fakeNetworkPool.Released).Should(ContainElement("1.2.0.0/30"))
+				Ω(fakeAdditionalNetworkPool.Released).Should(ContainElement("1.3.0.0/30"))
 			})
 
 			itReleasesTheUserID()
@@ -643,6 +2184,7 @@ var _ = Describe("Container pool", func() {
 		var snapshot io.Reader
 
 		var restoredNetwork *network.Network
+		var restoredAdditionalNetwork *network.Network
 
 		BeforeEach(func() {
 			buf := new(bytes.Buffer)
@@ -654,6 +2196,11 @@ var _ = Describe("Container pool", func() {
 
 			restoredNetwork = network.New(ipNet)
 
+			_, additionalIPNet, err := net.ParseCIDR("1.3.0.4/30")
+			Ω(err).ShouldNot(HaveOccurred())
+
+			restoredAdditionalNetwork = network.New(additionalIPNet)
+
 			err = json.NewEncoder(buf).Encode(
 				linux_backend.ContainerSnapshot{
 					ID:     "some-restored-id",
@@ -668,38 +2215,278 @@ var _ = Describe("Container pool", func() {
 					},
 
 					Resources: linux_backend.ResourcesSnapshot{
-						UID:     10000,
-						Network: restoredNetwork,
-						Ports:   []uint32{61001, 61002, 61003},
+						UID:                10000,
+						Network:            restoredNetwork,
+						AdditionalNetworks: []*network.Network{restoredAdditionalNetwork},
+						ExternalIP:         net.ParseIP("203.0.113.1"),
+						Ports:              []uint32{61001, 61002, 61003},
+					},
+
+					Properties: map[string]string{
+						"foo": "bar",
+					},
+
+					Annotations: linux_backend.Annotations{
+						CreatedAt:     time.Date(2015, time.March, 4, 5, 6, 7, 0, time.UTC),
+						GardenVersion: "some-old-version",
+					},
+				},
+			)
+			Ω(err).ShouldNot(HaveOccurred())
+		})
+
+		It("constructs a container from the snapshot", func() {
+			container, err := pool.Restore(snapshot)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(container.ID()).Should(Equal("some-restored-id"))
+			Ω(container.Handle()).Should(Equal("some-restored-handle"))
+			Ω(container.GraceTime()).Should(Equal(1 * time.Second))
+			Ω(container.Properties()).Should(Equal(api.Properties(map[string]string{
+				"foo": "bar",
+			})))
+
+			linuxContainer := container.(*linux_backend.LinuxContainer)
+
+			Ω(linuxContainer.State()).Should(Equal(linux_backend.State("some-restored-state")))
+			Ω(linuxContainer.Events()).Should(Equal([]string{
+				"some-restored-event",
+				"some-other-restored-event",
+			}))
+
+			Ω(linuxContainer.Annotations()).Should(Equal(linux_backend.Annotations{
+				CreatedAt:     time.Date(2015, time.March, 4, 5, 6, 7, 0, time.UTC),
+				GardenVersion: "some-old-version",
+			}))
+		})
+
+		It("counts it on the NUMA node it was placed on", func() {
+			cpusetPath := path.Join(cgroupsPath, "cpuset", "instance-some-restored-id")
+
+			err := os.MkdirAll(cpusetPath, 0755)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			err = ioutil.WriteFile(path.Join(cpusetPath, "cpuset.mems"), []byte("1\n"), 0644)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			_, err = pool.Restore(snapshot)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(numaPlacer.Utilization()[1].Containers).Should(Equal(1))
+		})
+
+		It("validates its network", func() {
+			container, err := pool.Restore(snapshot)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(fakeRunner).Should(HaveExecutedSerially(
+				fake_command_runner.CommandSpec{
+					Path: path.Join(depotPath, container.ID(), "net.sh"),
+					Args: []string{"check_links"},
+				},
+			))
+		})
+
+		Context("when its network is no longer intact", func() {
+			BeforeEach(func() {
+				fakeRunner.WhenRunning(
+					fake_command_runner.CommandSpec{
+						Args: []string{"check_links"},
+					}, func(*exec.Cmd) error {
+						return errors.New("oh no!")
 					},
+				)
+			})
+
+			It("restores the container, flagged with an event", func() {
+				container, err := pool.Restore(snapshot)
+				Ω(err).ShouldNot(HaveOccurred())
+
+				linuxContainer := container.(*linux_backend.LinuxContainer)
+				Ω(linuxContainer.Events()).Should(ContainElement("network must be re-erected"))
+			})
+		})
+
+		It("rebuilds its network with the network plugin", func() {
+			_, err := pool.Restore(snapshot)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(fakeNetworkPlugin.Rebuilt).Should(HaveLen(1))
+
+			request := fakeNetworkPlugin.Rebuilt[0]
+			Ω(request.ContainerID).Should(Equal("some-restored-id"))
+			Ω(request.ContainerHandle).Should(Equal("some-restored-handle"))
+			Ω(request.Network.String()).Should(Equal(restoredNetwork.String()))
+		})
+
+		Context("when the network plugin fails to rebuild the network", func() {
+			disaster := errors.New("oh no!")
+
+			BeforeEach(func() {
+				fakeNetworkPlugin.RebuildError = disaster
+			})
+
+			It("returns the error", func() {
+				_, err := pool.Restore(snapshot)
+				Ω(err).Should(Equal(disaster))
+			})
+
+			It("returns the container too, holding its resources", func() {
+				container, _ := pool.Restore(snapshot)
+				Ω(container).ShouldNot(BeNil())
+				Ω(container.ID()).Should(Equal("some-restored-id"))
+
+				Ω(fakeUIDPool.Released).Should(BeEmpty())
+				Ω(fakeNetworkPool.Released).Should(BeEmpty())
+			})
+		})
+
+		It("verifies its rootfs with the provider that created it", func() {
+			err := os.MkdirAll(path.Join(depotPath, "some-restored-id"), 0755)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			err = ioutil.WriteFile(path.Join(depotPath, "some-restored-id", "rootfs-provider"), []byte("fake"), 0644)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			_, err = pool.Restore(snapshot)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(defaultFakeRootFSProvider.VerifyRootFSCallCount()).Should(Equal(0))
+			Ω(fakeRootFSProvider.VerifyRootFSCallCount()).Should(Equal(1))
+
+			_, id, _ := fakeRootFSProvider.VerifyRootFSArgsForCall(0)
+			Ω(id).Should(Equal("some-restored-id"))
+		})
+
+		It("remounts its rootfs, in case the host rebooted", func() {
+			_, err := pool.Restore(snapshot)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(defaultFakeRootFSProvider.RemountRootFSCallCount()).Should(Equal(1))
+
+			_, id, _, _ := defaultFakeRootFSProvider.RemountRootFSArgsForCall(0)
+			Ω(id).Should(Equal("some-restored-id"))
+		})
+
+		Context("when containers are labelled with SELinux", func() {
+			var labeler *selinux_labeler.Labeler
+
+			BeforeEach(func() {
+				var err error
+
+				labeler, err = selinux_labeler.New(selinux_labeler.DefaultProcessContext, selinux_labeler.DefaultFileContext)
+				Ω(err).ShouldNot(HaveOccurred())
+
+				pool.LabelWithSELinux(labeler)
+			})
+
+			It("remounts its rootfs with the label it was created with", func() {
+				container, err := pool.Restore(snapshot)
+				Ω(err).ShouldNot(HaveOccurred())
+
+				_, _, _, mountLabel := defaultFakeRootFSProvider.RemountRootFSArgsForCall(0)
+				Ω(mountLabel).Should(Equal(labeler.Labels(container.(*linux_backend.LinuxContainer).Resources().UID).File))
+			})
+		})
+
+		Context("when remounting its rootfs fails", func() {
+			disaster := errors.New("oh no!")
+
+			BeforeEach(func() {
+				defaultFakeRootFSProvider.RemountRootFSReturns(disaster)
+			})
+
+			It("returns the error, and the container too", func() {
+				container, err := pool.Restore(snapshot)
+				Ω(err).Should(Equal(disaster))
+				Ω(container).ShouldNot(BeNil())
+			})
+		})
+
+		Context("when its rootfs is no longer intact", func() {
+			disaster := rootfs_provider.MissingRootFSError{Missing: "overlay branch /some/overlay"}
+
+			BeforeEach(func() {
+				defaultFakeRootFSProvider.VerifyRootFSReturns(disaster)
+			})
+
+			It("returns the error", func() {
+				_, err := pool.Restore(snapshot)
+				Ω(err).Should(Equal(disaster))
+			})
+
+			It("does not try to remount it", func() {
+				pool.Restore(snapshot)
+				Ω(defaultFakeRootFSProvider.RemountRootFSCallCount()).Should(Equal(0))
+			})
+
+			It("returns the container too, holding its resources", func() {
+				container, _ := pool.Restore(snapshot)
+				Ω(container).ShouldNot(BeNil())
+				Ω(container.ID()).Should(Equal("some-restored-id"))
+
+				Ω(fakeUIDPool.Released).Should(BeEmpty())
+				Ω(fakeNetworkPool.Released).Should(BeEmpty())
+			})
+		})
+
+		Context("when its resources were preclaimed", func() {
+			BeforeEach(func() {
+				var preclaimed linux_backend.ContainerSnapshot
+
+				err := json.Unmarshal(snapshot.(*bytes.Buffer).Bytes(), &preclaimed)
+				Ω(err).ShouldNot(HaveOccurred())
+
+				err = pool.Preclaim([]linux_backend.ContainerSnapshot{preclaimed})
+				Ω(err).ShouldNot(HaveOccurred())
+			})
+
+			It("removes them from the pools once", func() {
+				Ω(fakeUIDPool.Removed).Should(Equal([]uint32{10000}))
+				Ω(fakeNetworkPool.Removed).Should(Equal([]string{restoredNetwork.String()}))
+				Ω(fakeAdditionalNetworkPool.Removed).Should(Equal([]string{restoredAdditionalNetwork.String()}))
+				Ω(fakePortPool.Removed).Should(Equal([]uint32{61001, 61002, 61003}))
+
+				_, err := pool.Restore(snapshot)
+				Ω(err).ShouldNot(HaveOccurred())
+
+				Ω(fakeUIDPool.Removed).Should(Equal([]uint32{10000}))
+				Ω(fakeNetworkPool.Removed).Should(Equal([]string{restoredNetwork.String()}))
+				Ω(fakeAdditionalNetworkPool.Removed).Should(Equal([]string{restoredAdditionalNetwork.String()}))
+				Ω(fakePortPool.Removed).Should(Equal([]uint32{61001, 61002, 61003}))
+			})
+
+			It("still removes its external IP", func() {
+				_, err := pool.Restore(snapshot)
+				Ω(err).ShouldNot(HaveOccurred())
 
-					Properties: map[string]string{
-						"foo": "bar",
-					},
-				},
-			)
-			Ω(err).ShouldNot(HaveOccurred())
+				Ω(fakeExternalIPPool.Removed).Should(ContainElement("203.0.113.1"))
+			})
 		})
 
-		It("constructs a container from the snapshot", func() {
-			container, err := pool.Restore(snapshot)
-			Ω(err).ShouldNot(HaveOccurred())
+		Context("when preclaiming its resources conflicts", func() {
+			uidsTaken := uid_pool.UIDsTakenError{UIDs: []uint32{10000}}
+			portsTaken := port_pool.PortsTakenError{Ports: []uint32{61001}}
 
-			Ω(container.ID()).Should(Equal("some-restored-id"))
-			Ω(container.Handle()).Should(Equal("some-restored-handle"))
-			Ω(container.GraceTime()).Should(Equal(1 * time.Second))
-			Ω(container.Properties()).Should(Equal(api.Properties(map[string]string{
-				"foo": "bar",
-			})))
+			BeforeEach(func() {
+				fakeUIDPool.RemoveError = uidsTaken
+				fakePortPool.RemoveError = portsTaken
+			})
 
-			linuxContainer := container.(*linux_backend.LinuxContainer)
+			It("reports every conflict and releases what it claimed", func() {
+				var preclaimed linux_backend.ContainerSnapshot
 
-			Ω(linuxContainer.State()).Should(Equal(linux_backend.State("some-restored-state")))
-			Ω(linuxContainer.Events()).Should(Equal([]string{
-				"some-restored-event",
-				"some-other-restored-event",
-			}))
+				err := json.Unmarshal(snapshot.(*bytes.Buffer).Bytes(), &preclaimed)
+				Ω(err).ShouldNot(HaveOccurred())
+
+				err = pool.Preclaim([]linux_backend.ContainerSnapshot{preclaimed})
+				Ω(err).Should(Equal(container_pool.ResourceConflictsError{
+					Conflicts: []error{uidsTaken, portsTaken},
+				}))
 
+				Ω(fakeNetworkPool.Released).Should(ContainElement(restoredNetwork.String()))
+				Ω(fakeAdditionalNetworkPool.Released).Should(ContainElement(restoredAdditionalNetwork.String()))
+			})
 		})
 
 		It("removes its UID from the pool", func() {
@@ -716,6 +2503,17 @@ var _ = Describe("Container pool", func() {
 			Ω(fakeNetworkPool.Removed).Should(ContainElement(restoredNetwork.String()))
 		})
 
+		It("removes its additional networks from their pools", func() {
+			container, err := pool.Restore(snapshot)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(fakeAdditionalNetworkPool.Removed).Should(ContainElement(restoredAdditionalNetwork.String()))
+
+			resources := container.(*linux_backend.LinuxContainer).Resources()
+			Ω(resources.AdditionalNetworks).Should(HaveLen(1))
+			Ω(resources.AdditionalNetworks[0].String()).Should(Equal("1.3.0.4/30"))
+		})
+
 		It("removes its ports from the pool", func() {
 			_, err := pool.Restore(snapshot)
 			Ω(err).ShouldNot(HaveOccurred())
@@ -764,6 +2562,49 @@ var _ = Describe("Container pool", func() {
 			})
 		})
 
+		Context("when removing an additional network from its pool fails", func() {
+			disaster := errors.New("oh no!")
+
+			JustBeforeEach(func() {
+				fakeAdditionalNetworkPool.RemoveError = disaster
+			})
+
+			It("returns the error and releases the uid and network", func() {
+				_, err := pool.Restore(snapshot)
+				Ω(err).Should(Equal(disaster))
+
+				Ω(fakeUIDPool.Released).Should(ContainElement(uint32(10000)))
+				Ω(fakeNetworkPool.Released).Should(ContainElement(restoredNetwork.String()))
+			})
+		})
+
+		It("removes its external IP from the pool", func() {
+			container, err := pool.Restore(snapshot)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(fakeExternalIPPool.Removed).Should(Equal([]string{"203.0.113.1"}))
+
+			resources := container.(*linux_backend.LinuxContainer).Resources()
+			Ω(resources.ExternalIP.String()).Should(Equal("203.0.113.1"))
+		})
+
+		Context("when removing the external IP from the pool fails", func() {
+			disaster := errors.New("oh no!")
+
+			JustBeforeEach(func() {
+				fakeExternalIPPool.RemoveError = disaster
+			})
+
+			It("returns the error and releases the uid and networks", func() {
+				_, err := pool.Restore(snapshot)
+				Ω(err).Should(Equal(disaster))
+
+				Ω(fakeUIDPool.Released).Should(ContainElement(uint32(10000)))
+				Ω(fakeNetworkPool.Released).Should(ContainElement(restoredNetwork.String()))
+				Ω(fakeAdditionalNetworkPool.Released).Should(ContainElement(restoredAdditionalNetwork.String()))
+			})
+		})
+
 		Context("when removing a port from the pool fails", func() {
 			disaster := errors.New("oh no!")
 
@@ -777,6 +2618,8 @@ var _ = Describe("Container pool", func() {
 
 				Ω(fakeUIDPool.Released).Should(ContainElement(uint32(10000)))
 				Ω(fakeNetworkPool.Released).Should(ContainElement(restoredNetwork.String()))
+				Ω(fakeAdditionalNetworkPool.Released).Should(ContainElement(restoredAdditionalNetwork.String()))
+				Ω(fakeExternalIPPool.Released).Should(ContainElement("203.0.113.1"))
 				Ω(fakePortPool.Released).Should(ContainElement(uint32(61001)))
 				Ω(fakePortPool.Released).Should(ContainElement(uint32(61002)))
 				Ω(fakePortPool.Released).Should(ContainElement(uint32(61003)))
@@ -977,7 +2820,42 @@ var _ = Describe("Container pool", func() {
 			))
 		})
 
-		It("releases the container's ports, uid, and network", func() {
+		It("frees the container's place on its NUMA node", func() {
+			Ω(numaPlacer.Utilization()[0].Containers).Should(Equal(1))
+
+			err := pool.Destroy(createdContainer)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(numaPlacer.Utilization()[0].Containers).Should(BeZero())
+		})
+
+		It("dismantles the container's network with the network plugin", func() {
+			err := pool.Destroy(createdContainer)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(fakeNetworkPlugin.Dismantled).Should(HaveLen(1))
+			Ω(fakeNetworkPlugin.Dismantled[0].ContainerID).Should(Equal(createdContainer.ID()))
+		})
+
+		Context("when the network plugin fails to dismantle the network", func() {
+			BeforeEach(func() {
+				fakeNetworkPlugin.DismantleError = errors.New("oh no!")
+			})
+
+			It("destroys the container anyway", func() {
+				err := pool.Destroy(createdContainer)
+				Ω(err).ShouldNot(HaveOccurred())
+
+				Ω(fakeRunner).Should(HaveExecutedSerially(
+					fake_command_runner.CommandSpec{
+						Path: "/root/path/destroy.sh",
+						Args: []string{path.Join(depotPath, createdContainer.ID())},
+					},
+				))
+			})
+		})
+
+		It("releases the container's ports, uid, and networks", func() {
 			err := pool.Destroy(createdContainer)
 			Ω(err).ShouldNot(HaveOccurred())
 
@@ -987,6 +2865,7 @@ var _ = Describe("Container pool", func() {
 			Ω(fakeUIDPool.Released).Should(ContainElement(uint32(10000)))
 
 			Ω(fakeNetworkPool.Released).Should(ContainElement("1.2.0.0/30"))
+			Ω(fakeAdditionalNetworkPool.Released).Should(ContainElement("1.3.0.0/30"))
 		})
 
 		Context("when the container has a rootfs provider defined", func() {
@@ -1070,4 +2949,273 @@ var _ = Describe("Container pool", func() {
 			})
 		})
 	})
+
+	Describe("reaping in the background", func() {
+		var graveyardPath string
+
+		BeforeEach(func() {
+			graveyardPath = path.Join(depotPath, "tmp", "reaping")
+
+			fakeRunner.WhenRunning(
+				fake_command_runner.CommandSpec{
+					Path: "/root/path/destroy.sh",
+				}, func(cmd *exec.Cmd) error {
+					if len(cmd.Args) < 3 {
+						return nil
+					}
+
+					err := os.MkdirAll(cmd.Args[2], 0755)
+					if err != nil {
+						return err
+					}
+
+					return os.Rename(cmd.Args[1], path.Join(cmd.Args[2], path.Base(cmd.Args[1])))
+				},
+			)
+		})
+
+		Context("when destroying a container", func() {
+			var createdContainer *linux_backend.LinuxContainer
+
+			BeforeEach(func() {
+				container, err := pool.Create(api.ContainerSpec{})
+				Ω(err).ShouldNot(HaveOccurred())
+
+				createdContainer = container.(*linux_backend.LinuxContainer)
+				createdContainer.Resources().AddPort(123)
+
+				err = os.MkdirAll(path.Join(depotPath, createdContainer.ID()), 0755)
+				Ω(err).ShouldNot(HaveOccurred())
+
+				err = ioutil.WriteFile(path.Join(depotPath, createdContainer.ID(), "rootfs-provider"), []byte("fake"), 0644)
+				Ω(err).ShouldNot(HaveOccurred())
+
+				pool.ReapInBackground(0)
+			})
+
+			It("moves the container's depot directory to be reaped, rather than removing it", func() {
+				err := pool.Destroy(createdContainer)
+				Ω(err).ShouldNot(HaveOccurred())
+
+				Ω(fakeRunner).Should(HaveExecutedSerially(
+					fake_command_runner.CommandSpec{
+						Path: "/root/path/destroy.sh",
+						Args: []string{path.Join(depotPath, createdContainer.ID()), graveyardPath},
+					},
+				))
+			})
+
+			It("releases the container's ports and networks immediately", func() {
+				err := pool.Destroy(createdContainer)
+				Ω(err).ShouldNot(HaveOccurred())
+
+				Ω(fakePortPool.Released).Should(ContainElement(uint32(123)))
+				Ω(fakeNetworkPool.Released).Should(ContainElement("1.2.0.0/30"))
+				Ω(fakeAdditionalNetworkPool.Released).Should(ContainElement("1.3.0.0/30"))
+			})
+
+			It("removes the container's files and rootfs, and then releases its uid", func() {
+				err := pool.Destroy(createdContainer)
+				Ω(err).ShouldNot(HaveOccurred())
+
+				Eventually(fakeRunner).Should(HaveExecutedSerially(
+					fake_command_runner.CommandSpec{
+						Path: "rm",
+						Args: []string{"-rf", path.Join(graveyardPath, createdContainer.ID())},
+					},
+				))
+
+				Eventually(fakeRootFSProvider.CleanupRootFSCallCount).Should(Equal(1))
+				_, id := fakeRootFSProvider.CleanupRootFSArgsForCall(0)
+				Ω(id).Should(Equal(createdContainer.ID()))
+
+				Eventually(func() []uint32 {
+					return fakeUIDPool.Released
+				}).Should(ContainElement(uint32(10000)))
+			})
+
+			Context("when removing the container's files fails", func() {
+				BeforeEach(func() {
+					fakeRunner.WhenRunning(
+						fake_command_runner.CommandSpec{
+							Path: "rm",
+						}, func(*exec.Cmd) error {
+							return errors.New("oh no!")
+						},
+					)
+				})
+
+				It("keeps its uid", func() {
+					err := pool.Destroy(createdContainer)
+					Ω(err).ShouldNot(HaveOccurred())
+
+					Consistently(func() []uint32 {
+						return fakeUIDPool.Released
+					}).ShouldNot(ContainElement(uint32(10000)))
+
+					Ω(fakeRootFSProvider.CleanupRootFSCallCount()).Should(BeZero())
+				})
+			})
+		})
+
+		It("reaps containers left to be reaped by a previous run", func() {
+			err := os.MkdirAll(path.Join(graveyardPath, "some-buried-id"), 0755)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			err = ioutil.WriteFile(path.Join(graveyardPath, "some-buried-id", "rootfs-provider"), []byte("fake"), 0644)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			pool.ReapInBackground(0)
+
+			Eventually(fakeRootFSProvider.CleanupRootFSCallCount).Should(Equal(1))
+			_, id := fakeRootFSProvider.CleanupRootFSArgsForCall(0)
+			Ω(id).Should(Equal("some-buried-id"))
+		})
+
+		It("moves pruned containers' depot directories to be reaped", func() {
+			err := os.MkdirAll(path.Join(depotPath, "container-1"), 0755)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			pool.ReapInBackground(0)
+
+			err = pool.Prune(map[string]bool{})
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(fakeRunner).Should(HaveExecutedSerially(
+				fake_command_runner.CommandSpec{
+					Path: "/root/path/destroy.sh",
+					Args: []string{path.Join(depotPath, "container-1"), graveyardPath},
+				},
+			))
+
+			Eventually(defaultFakeRootFSProvider.CleanupRootFSCallCount).Should(Equal(1))
+		})
+	})
+
+	Describe("reaping during maintenance", func() {
+		var graveyardPath string
+
+		BeforeEach(func() {
+			graveyardPath = path.Join(depotPath, "tmp", "reaping")
+
+			fakeRunner.WhenRunning(
+				fake_command_runner.CommandSpec{
+					Path: "/root/path/destroy.sh",
+				}, func(cmd *exec.Cmd) error {
+					if len(cmd.Args) < 3 {
+						return nil
+					}
+
+					err := os.MkdirAll(cmd.Args[2], 0755)
+					if err != nil {
+						return err
+					}
+
+					return os.Rename(cmd.Args[1], path.Join(cmd.Args[2], path.Base(cmd.Args[1])))
+				},
+			)
+		})
+
+		Context("when destroying a container", func() {
+			var createdContainer *linux_backend.LinuxContainer
+
+			BeforeEach(func() {
+				container, err := pool.Create(api.ContainerSpec{})
+				Ω(err).ShouldNot(HaveOccurred())
+
+				createdContainer = container.(*linux_backend.LinuxContainer)
+
+				err = os.MkdirAll(path.Join(depotPath, createdContainer.ID()), 0755)
+				Ω(err).ShouldNot(HaveOccurred())
+
+				err = ioutil.WriteFile(path.Join(depotPath, createdContainer.ID(), "rootfs-provider"), []byte("fake"), 0644)
+				Ω(err).ShouldNot(HaveOccurred())
+
+				pool.ReapDuringMaintenance()
+			})
+
+			It("moves the container's depot directory to be reaped, but does not reap it", func() {
+				err := pool.Destroy(createdContainer)
+				Ω(err).ShouldNot(HaveOccurred())
+
+				Ω(fakeRunner).Should(HaveExecutedSerially(
+					fake_command_runner.CommandSpec{
+						Path: "/root/path/destroy.sh",
+						Args: []string{path.Join(depotPath, createdContainer.ID()), graveyardPath},
+					},
+				))
+
+				Consistently(fakeRootFSProvider.CleanupRootFSCallCount).Should(BeZero())
+				Ω(fakeUIDPool.Released).ShouldNot(ContainElement(uint32(10000)))
+			})
+
+			It("removes the container's files and rootfs, and releases its uid, when reaped", func() {
+				err := pool.Destroy(createdContainer)
+				Ω(err).ShouldNot(HaveOccurred())
+
+				Eventually(func() int {
+					err := pool.ReapBuried(lagertest.NewTestLogger("test"), time.Now().Add(time.Minute))
+					Ω(err).ShouldNot(HaveOccurred())
+
+					return fakeRootFSProvider.CleanupRootFSCallCount()
+				}).Should(Equal(1))
+
+				Ω(fakeRunner).Should(HaveExecutedSerially(
+					fake_command_runner.CommandSpec{
+						Path: "rm",
+						Args: []string{"-rf", path.Join(graveyardPath, createdContainer.ID())},
+					},
+				))
+
+				Ω(fakeUIDPool.Released).Should(ContainElement(uint32(10000)))
+			})
+
+			It("reaps nothing once the window has closed", func() {
+				err := pool.Destroy(createdContainer)
+				Ω(err).ShouldNot(HaveOccurred())
+
+				Consistently(func() int {
+					err := pool.ReapBuried(lagertest.NewTestLogger("test"), time.Now())
+					Ω(err).ShouldNot(HaveOccurred())
+
+					return fakeRootFSProvider.CleanupRootFSCallCount()
+				}).Should(BeZero())
+			})
+		})
+
+		It("reaps containers left to be reaped by a previous run", func() {
+			err := os.MkdirAll(path.Join(graveyardPath, "some-buried-id"), 0755)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			err = ioutil.WriteFile(path.Join(graveyardPath, "some-buried-id", "rootfs-provider"), []byte("fake"), 0644)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			pool.ReapDuringMaintenance()
+
+			Eventually(func() int {
+				pool.ReapBuried(lagertest.NewTestLogger("test"), time.Now().Add(time.Minute))
+				return fakeRootFSProvider.CleanupRootFSCallCount()
+			}).Should(Equal(1))
+
+			_, id := fakeRootFSProvider.CleanupRootFSArgsForCall(0)
+			Ω(id).Should(Equal("some-buried-id"))
+		})
+	})
+
+	Describe("parsing an ID scheme", func() {
+		It("accepts timestamp and random", func() {
+			scheme, err := container_pool.ParseIDScheme("timestamp")
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(scheme).Should(Equal(container_pool.TimestampIDs))
+
+			scheme, err = container_pool.ParseIDScheme("random")
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(scheme).Should(Equal(container_pool.RandomIDs))
+		})
+
+		It("rejects anything else", func() {
+			_, err := container_pool.ParseIDScheme("uuid")
+			Ω(err).Should(Equal(container_pool.UnknownIDSchemeError{Scheme: "uuid"}))
+		})
+	})
 })
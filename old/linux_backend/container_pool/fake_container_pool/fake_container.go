@@ -5,6 +5,7 @@ import (
 	"sync"
 	"time"
 
+	"github.com/cloudfoundry-incubator/garden-linux/old/linux_backend"
 	"github.com/cloudfoundry-incubator/garden/api"
 	"github.com/cloudfoundry-incubator/garden/api/fakes"
 )
@@ -15,6 +16,7 @@ type FakeContainer struct {
 	Spec api.ContainerSpec
 
 	SnapshotError  error
+	SnapshotData   []byte
 	SavedSnapshots []io.Writer
 	snapshotMutex  *sync.RWMutex
 
@@ -23,6 +25,51 @@ type FakeContainer struct {
 	Mtu        uint32
 
 	CleanedUp bool
+
+	ReconcileNetworkError error
+	NetworkReconciled     bool
+
+	MarkedDestroying bool
+
+	Provenance linux_backend.RootFSProvenance
+
+	BrokenReason string
+
+	CheckDaemonError error
+
+	// returned by each VerifyStart in turn, then nil
+	VerifyStartErrors []error
+	VerifyStartCalls  int
+
+	SampleUsageError error
+	SampledUsageKeep int
+	Usage            []linux_backend.UsageSample
+
+	UsageSummaryError error
+	FinalUsage        linux_backend.UsageSummary
+
+	Committed        linux_backend.CommittedResources
+	LimitAdmitter    linux_backend.LimitAdmitter
+	PortReservations linux_backend.PortReservations
+
+	CheckCoreDumpsError error
+	CheckedCoreDumps    bool
+
+	AddNetOutRuleError error
+	BulkNetOutError    error
+	NetOutRules        []linux_backend.NetOutRule
+
+	NetInProtocolError error
+	NetIns             []linux_backend.NetInSpec
+
+	NetInRangeError error
+	NetInRanges     []linux_backend.NetInSpec
+
+	StartCaptureError error
+	CapturePath       string
+	CaptureLimits     *linux_backend.CaptureLimits
+	StopCaptureError  error
+	CaptureStopped    bool
 }
 
 func NewFakeContainer(spec api.ContainerSpec) *FakeContainer {
@@ -47,12 +94,147 @@ func (c *FakeContainer) Properties() api.Properties {
 	return c.Spec.Properties
 }
 
+func (c *FakeContainer) RootFSProvenance() linux_backend.RootFSProvenance {
+	return c.Provenance
+}
+
 func (c *FakeContainer) Start(mtu uint32) error {
 	c.Started = true
 	c.Mtu = mtu
 	return c.StartError
 }
 
+func (c *FakeContainer) ReconcileNetwork() error {
+	c.NetworkReconciled = true
+	return c.ReconcileNetworkError
+}
+
+func (c *FakeContainer) MarkDestroying() {
+	c.MarkedDestroying = true
+}
+
+func (c *FakeContainer) Break(reason string) {
+	c.BrokenReason = reason
+}
+
+func (c *FakeContainer) VerifyStart() error {
+	c.VerifyStartCalls++
+
+	if len(c.VerifyStartErrors) == 0 {
+		return nil
+	}
+
+	err := c.VerifyStartErrors[0]
+	c.VerifyStartErrors = c.VerifyStartErrors[1:]
+
+	return err
+}
+
+func (c *FakeContainer) CheckDaemon() error {
+	return c.CheckDaemonError
+}
+
+func (c *FakeContainer) SampleUsage(keep int) error {
+	c.SampledUsageKeep = keep
+	return c.SampleUsageError
+}
+
+func (c *FakeContainer) UsageHistory() []linux_backend.UsageSample {
+	return c.Usage
+}
+
+func (c *FakeContainer) UsageSummary() (linux_backend.UsageSummary, error) {
+	return c.FinalUsage, c.UsageSummaryError
+}
+
+func (c *FakeContainer) CommittedResources() linux_backend.CommittedResources {
+	return c.Committed
+}
+
+func (c *FakeContainer) SetLimitAdmitter(admitter linux_backend.LimitAdmitter) {
+	c.LimitAdmitter = admitter
+}
+
+func (c *FakeContainer) SetPortReservations(reservations linux_backend.PortReservations) {
+	c.PortReservations = reservations
+}
+
+func (c *FakeContainer) CheckCoreDumps() error {
+	c.CheckedCoreDumps = true
+	return c.CheckCoreDumpsError
+}
+
+func (c *FakeContainer) AddNetOutRule(rule linux_backend.NetOutRule) error {
+	if c.AddNetOutRuleError != nil {
+		return c.AddNetOutRuleError
+	}
+
+	c.NetOutRules = append(c.NetOutRules, rule)
+
+	return nil
+}
+
+func (c *FakeContainer) BulkNetOut(rules []linux_backend.NetOutRule) error {
+	if c.BulkNetOutError != nil {
+		return c.BulkNetOutError
+	}
+
+	c.NetOutRules = append(c.NetOutRules, rules...)
+
+	return nil
+}
+
+func (c *FakeContainer) NetInProtocol(protocol linux_backend.Protocol, hostPort uint32, containerPort uint32) (uint32, uint32, error) {
+	if c.NetInProtocolError != nil {
+		return 0, 0, c.NetInProtocolError
+	}
+
+	c.NetIns = append(c.NetIns, linux_backend.NetInSpec{
+		HostPort:      hostPort,
+		ContainerPort: containerPort,
+		Protocol:      protocol,
+	})
+
+	return hostPort, containerPort, nil
+}
+
+func (c *FakeContainer) NetInRange(protocol linux_backend.Protocol, hostPortStart uint32, containerPortStart uint32, count uint32) (linux_backend.NetInSpec, error) {
+	if c.NetInRangeError != nil {
+		return linux_backend.NetInSpec{}, c.NetInRangeError
+	}
+
+	spec := linux_backend.NetInSpec{
+		HostPort:      hostPortStart,
+		ContainerPort: containerPortStart,
+		Protocol:      protocol,
+		Count:         count,
+	}
+
+	c.NetInRanges = append(c.NetInRanges, spec)
+
+	return spec, nil
+}
+
+func (c *FakeContainer) StartCapture(limits linux_backend.CaptureLimits) (string, error) {
+	if c.StartCaptureError != nil {
+		return "", c.StartCaptureError
+	}
+
+	c.CaptureLimits = &limits
+
+	return c.CapturePath, nil
+}
+
+func (c *FakeContainer) StopCapture() error {
+	if c.StopCaptureError != nil {
+		return c.StopCaptureError
+	}
+
+	c.CaptureStopped = true
+
+	return nil
+}
+
 func (c *FakeContainer) Cleanup() {
 	c.CleanedUp = true
 }
@@ -71,5 +253,7 @@ func (c *FakeContainer) Snapshot(snapshot io.Writer) error {
 
 	c.SavedSnapshots = append(c.SavedSnapshots, snapshot)
 
-	return nil
+	_, err := snapshot.Write(c.SnapshotData)
+
+	return err
 }
@@ -1,8 +1,12 @@
 package fake_container_pool
 
 import (
+	"bytes"
+	"encoding/json"
 	"fmt"
 	"io"
+	"io/ioutil"
+	"net"
 
 	"github.com/cloudfoundry-incubator/garden-linux/old/linux_backend"
 	"github.com/cloudfoundry-incubator/garden/api"
@@ -12,21 +16,39 @@ import (
 type FakeContainerPool struct {
 	DidSetup bool
 
-	MaxContainersValue int
+	MaxContainersValue  int
+	UtilizationValue    []linux_backend.PoolUtilization
+	SwapAccountingValue bool
 
 	Pruned         bool
 	PruneError     error
 	KeptContainers map[string]bool
 
+	GrowPortPoolError    error
+	GrowNetworkPoolError error
+	GrownPortPoolSize    uint32
+	GrownNetworkPool     *net.IPNet
+
+	AcquirePortError error
+	NextPort         uint32
+	AcquiredPorts    []uint32
+	ReleasedPorts    []uint32
+
 	CreateError  error
 	RestoreError error
-	DestroyError error
+
+	// returned along with the restored container, as when it is broken
+	RestoreBrokenError error
+
+	PreclaimError error
+	DestroyError  error
 
 	ContainerSetup func(*FakeContainer)
 
 	CreatedContainers   []linux_backend.Container
 	DestroyedContainers []linux_backend.Container
 	RestoredSnapshots   []io.Reader
+	PreclaimedSnapshots []linux_backend.ContainerSnapshot
 }
 
 func New() *FakeContainerPool {
@@ -37,6 +59,53 @@ func (p *FakeContainerPool) MaxContainers() int {
 	return p.MaxContainersValue
 }
 
+func (p *FakeContainerPool) SwapAccounting() bool {
+	return p.SwapAccountingValue
+}
+
+func (p *FakeContainerPool) Utilization() []linux_backend.PoolUtilization {
+	return p.UtilizationValue
+}
+
+func (p *FakeContainerPool) GrowPortPool(size uint32) error {
+	if p.GrowPortPoolError != nil {
+		return p.GrowPortPoolError
+	}
+
+	p.GrownPortPoolSize = size
+
+	return nil
+}
+
+func (p *FakeContainerPool) GrowNetworkPool(ipNet *net.IPNet) error {
+	if p.GrowNetworkPoolError != nil {
+		return p.GrowNetworkPoolError
+	}
+
+	p.GrownNetworkPool = ipNet
+
+	return nil
+}
+
+func (p *FakeContainerPool) AcquirePort(port uint32) (uint32, error) {
+	if p.AcquirePortError != nil {
+		return 0, p.AcquirePortError
+	}
+
+	if port == 0 {
+		port = p.NextPort
+		p.NextPort++
+	}
+
+	p.AcquiredPorts = append(p.AcquiredPorts, port)
+
+	return port, nil
+}
+
+func (p *FakeContainerPool) ReleasePort(port uint32) {
+	p.ReleasedPorts = append(p.ReleasedPorts, port)
+}
+
 func (p *FakeContainerPool) Setup() error {
 	p.DidSetup = true
 
@@ -86,11 +155,22 @@ func (p *FakeContainerPool) Restore(snapshot io.Reader) (linux_backend.Container
 		return nil, p.RestoreError
 	}
 
+	contents, err := ioutil.ReadAll(snapshot)
+	if err != nil {
+		return nil, err
+	}
+
+	// snapshots are either real ones, or just the handle
 	var handle string
 
-	_, err := fmt.Fscanf(snapshot, "%s", &handle)
-	if err != nil && err != io.EOF {
-		return nil, err
+	var containerSnapshot linux_backend.ContainerSnapshot
+	if json.Unmarshal(contents, &containerSnapshot) == nil {
+		handle = containerSnapshot.Handle
+	} else {
+		_, err = fmt.Sscanf(string(contents), "%s", &handle)
+		if err != nil && err != io.EOF {
+			return nil, err
+		}
 	}
 
 	container := NewFakeContainer(
@@ -99,9 +179,19 @@ func (p *FakeContainerPool) Restore(snapshot io.Reader) (linux_backend.Container
 		},
 	)
 
-	p.RestoredSnapshots = append(p.RestoredSnapshots, snapshot)
+	p.RestoredSnapshots = append(p.RestoredSnapshots, bytes.NewReader(contents))
 
-	return container, nil
+	return container, p.RestoreBrokenError
+}
+
+func (p *FakeContainerPool) Preclaim(snapshots []linux_backend.ContainerSnapshot) error {
+	if p.PreclaimError != nil {
+		return p.PreclaimError
+	}
+
+	p.PreclaimedSnapshots = append(p.PreclaimedSnapshots, snapshots...)
+
+	return nil
 }
 
 func (p *FakeContainerPool) Destroy(container linux_backend.Container) error {
@@ -13,8 +13,10 @@ type FakeGraphDriver struct {
 	removed     []string
 	RemoveError error
 
-	GetResult string
-	GetError  error
+	gotten      []string
+	mountLabels []string
+	GetResult   string
+	GetError    error
 
 	putted []string
 
@@ -101,9 +103,39 @@ func (graph *FakeGraphDriver) Get(id string, mountLabel string) (string, error)
 		return "", graph.GetError
 	}
 
+	graph.Lock()
+
+	graph.gotten = append(graph.gotten, id)
+	graph.mountLabels = append(graph.mountLabels, mountLabel)
+
+	graph.Unlock()
+
 	return graph.GetResult, nil
 }
 
+func (graph *FakeGraphDriver) Gotten() []string {
+	graph.RLock()
+
+	gotten := make([]string, len(graph.gotten))
+	copy(gotten, graph.gotten)
+
+	graph.RUnlock()
+
+	return gotten
+}
+
+// MountLabels are the mount labels each Get was given, in order.
+func (graph *FakeGraphDriver) MountLabels() []string {
+	graph.RLock()
+
+	mountLabels := make([]string, len(graph.mountLabels))
+	copy(mountLabels, graph.mountLabels)
+
+	graph.RUnlock()
+
+	return mountLabels
+}
+
 func (graph *FakeGraphDriver) Put(id string) {
 	graph.Lock()
 
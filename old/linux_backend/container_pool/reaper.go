@@ -0,0 +1,189 @@
+package container_pool
+
+import (
+	"io/ioutil"
+	"os/exec"
+	"path"
+	"runtime"
+	"time"
+
+	"github.com/pivotal-golang/lager"
+
+	"github.com/cloudfoundry-incubator/garden-linux/old/linux_backend"
+	"github.com/cloudfoundry-incubator/garden-linux/old/logging"
+	"github.com/cloudfoundry-incubator/garden-linux/old/maintenance"
+)
+
+type reapJob struct {
+	id string
+
+	// released once the container's files, which count towards its quota,
+	// are gone; zero for containers buried without their resources
+	uid uint32
+}
+
+// ReapInBackground has Destroy and Prune leave removing containers' depot
+// directories and rootfses to a reaper, so that destroying large containers
+// does not cause IO storms that hurt their neighbours. Destroyed containers
+// are torn down and their network resources released immediately; their
+// uids are released once their files are gone.
+//
+// The reaper removes one container at a time, at idle IO priority, and at
+// most one per interval. Containers left unreaped by a previous run are
+// reaped too. It must be called before the pool is used.
+func (p *LinuxContainerPool) ReapInBackground(interval time.Duration) {
+	p.reapQueue = make(chan reapJob)
+
+	go p.reapBuried(interval)
+
+	p.queueGraveyard()
+}
+
+// ReapDuringMaintenance is ReapInBackground, but leaves reaping to
+// ReapBuried, run as a maintenance task, so that containers' files are only
+// removed during maintenance windows. Their uids are held until then.
+func (p *LinuxContainerPool) ReapDuringMaintenance() {
+	p.reapQueue = make(chan reapJob)
+
+	p.queueGraveyard()
+}
+
+// ReapBuried reaps buried containers, one at a time, until none are left or
+// until has passed.
+func (p *LinuxContainerPool) ReapBuried(logger lager.Logger, until time.Time) error {
+	for time.Now().Before(until) {
+		select {
+		case job := <-p.reapQueue:
+			p.reap(logger.Session("reap", lager.Data{"id": job.id}), job)
+		default:
+			return nil
+		}
+	}
+
+	return nil
+}
+
+// queueGraveyard queues containers left to be reaped by a previous run.
+func (p *LinuxContainerPool) queueGraveyard() {
+	buried, err := ioutil.ReadDir(p.graveyardPath())
+	if err != nil {
+		return
+	}
+
+	for _, entry := range buried {
+		p.queueReap(reapJob{id: entry.Name()})
+	}
+}
+
+// graveyardPath is where buried containers' depot directories wait to be
+// reaped. Prune and destroy.sh skip the depot's tmp directory.
+func (p *LinuxContainerPool) graveyardPath() string {
+	return path.Join(p.depotPath, "tmp", "reaping")
+}
+
+// bury tears the container down, as releaseSystemResources does, but moves
+// its depot directory to the graveyard for the reaper rather than removing
+// it.
+func (p *LinuxContainerPool) bury(logger lager.Logger, id string, uid uint32) error {
+	pRunner := logging.Runner{
+		CommandRunner: p.runner,
+		Logger:        logger,
+	}
+
+	_, found := p.rootfsProviders[p.rootfsProviderOf(id)]
+	if !found {
+		return ErrUnknownRootFSProvider
+	}
+
+	destroy := exec.Command(path.Join(p.binPath, "destroy.sh"), path.Join(p.depotPath, id), p.graveyardPath())
+
+	err := pRunner.Run(destroy)
+	if err != nil {
+		return err
+	}
+
+	if p.numaPlacer != nil {
+		p.numaPlacer.Release(id)
+	}
+
+	p.queueReap(reapJob{id: id, uid: uid})
+
+	return nil
+}
+
+func (p *LinuxContainerPool) queueReap(job reapJob) {
+	go func() {
+		p.reapQueue <- job
+	}()
+}
+
+func (p *LinuxContainerPool) reapBuried(interval time.Duration) {
+	rLog := p.logger.Session("reaper")
+
+	// the reaper keeps its thread, whose IO priority is inherited by the
+	// commands it runs
+	runtime.LockOSThread()
+
+	err := maintenance.LowerIOPriority()
+	if err != nil {
+		rLog.Error("failed-to-lower-io-priority", err)
+	}
+
+	for job := range p.reapQueue {
+		started := time.Now()
+
+		p.reap(rLog.Session("reap", lager.Data{"id": job.id}), job)
+
+		time.Sleep(interval - time.Since(started))
+	}
+}
+
+// reap removes a buried container's depot directory and rootfs, and then
+// releases its uid. Containers that fail to be reaped keep their uids, as
+// their files may still count towards its quota.
+func (p *LinuxContainerPool) reap(logger lager.Logger, job reapJob) {
+	pRunner := logging.Runner{
+		CommandRunner: p.runner,
+		Logger:        logger,
+	}
+
+	buriedPath := path.Join(p.graveyardPath(), job.id)
+
+	providerName := ""
+	if contents, err := ioutil.ReadFile(path.Join(buriedPath, "rootfs-provider")); err == nil {
+		providerName = string(contents)
+	}
+
+	err := pRunner.Run(exec.Command("rm", "-rf", buriedPath))
+	if err != nil {
+		logger.Error("failed-to-remove-depot-directory", err)
+		return
+	}
+
+	provider, found := p.rootfsProviders[providerName]
+	if !found {
+		logger.Error("failed-to-clean-up-rootfs", ErrUnknownRootFSProvider)
+		return
+	}
+
+	err = provider.CleanupRootFS(logger, job.id)
+	if err != nil {
+		logger.Error("failed-to-clean-up-rootfs", err)
+		return
+	}
+
+	if job.uid != 0 {
+		p.uidPool.Release(job.uid)
+	}
+
+	logger.Info("reaped")
+}
+
+// withoutUID is the container's resources that can be released as soon as
+// it is buried.
+func withoutUID(resources *linux_backend.Resources) *linux_backend.Resources {
+	released := linux_backend.NewResources(0, resources.Network, resources.AdditionalNetworks, resources.Ports)
+	released.ExternalIP = resources.ExternalIP
+
+	return released
+}
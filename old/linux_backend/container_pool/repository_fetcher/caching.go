@@ -0,0 +1,179 @@
+package repository_fetcher
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"net/url"
+	"os"
+	"path"
+	"sync"
+
+	"github.com/pivotal-golang/lager"
+)
+
+// Caching remembers which image each repository tag resolved to, so that
+// creates for images already in the graph can survive registry outages.
+//
+// In cache-first mode a tag that has been fetched before is not looked up
+// again. Otherwise the tag is always fetched, falling back to the image it
+// last resolved to if the registry cannot be reached, unless failOnStalePull
+// is set. Anything the registry answers with, e.g. that the tag is unknown,
+// is returned rather than hidden by a stale image.
+type Caching struct {
+	RepositoryFetcher
+
+	graph Graph
+
+	cachePath       string
+	cacheFirst      bool
+	failOnStalePull bool
+
+	cache      map[string]CachedImage
+	cacheMutex *sync.Mutex
+}
+
+type CachedImage struct {
+	ImageID string
+	EnvVars []string
+}
+
+// NewCaching loads the cache from cachePath. A corrupt cache is ignored,
+// and replaced when the next tag is fetched, as every tag can be fetched
+// again.
+func NewCaching(
+	logger lager.Logger,
+	fetcher RepositoryFetcher,
+	graph Graph,
+	cachePath string,
+	cacheFirst, failOnStalePull bool,
+) (*Caching, error) {
+	cache := map[string]CachedImage{}
+
+	contents, err := ioutil.ReadFile(cachePath)
+	if err == nil {
+		err = json.Unmarshal(contents, &cache)
+		if err != nil {
+			logger.Error("ignoring-corrupt-tag-cache", err, lager.Data{"path": cachePath})
+			cache = map[string]CachedImage{}
+		}
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	return &Caching{
+		RepositoryFetcher: fetcher,
+
+		graph: graph,
+
+		cachePath:       cachePath,
+		cacheFirst:      cacheFirst,
+		failOnStalePull: failOnStalePull,
+
+		cache:      cache,
+		cacheMutex: new(sync.Mutex),
+	}, nil
+}
+
+func (caching *Caching) Fetch(logger lager.Logger, repoName string, tag string) (string, []string, error) {
+	key := repoName + ":" + tag
+
+	cached, found := caching.cached(key)
+
+	if found && caching.cacheFirst {
+		logger.Info("using-cached-tag", lager.Data{
+			"repo":  repoName,
+			"tag":   tag,
+			"image": cached.ImageID,
+		})
+
+		return cached.ImageID, cached.EnvVars, nil
+	}
+
+	imageID, envvars, err := caching.RepositoryFetcher.Fetch(logger, repoName, tag)
+	if err != nil {
+		if found && !caching.failOnStalePull && isConnectionError(err) {
+			logger.Error("using-stale-tag", err, lager.Data{
+				"repo":  repoName,
+				"tag":   tag,
+				"image": cached.ImageID,
+			})
+
+			return cached.ImageID, cached.EnvVars, nil
+		}
+
+		return "", nil, err
+	}
+
+	err = caching.store(key, CachedImage{ImageID: imageID, EnvVars: envvars})
+	if err != nil {
+		// the image was fetched; only its survival of an outage is affected
+		logger.Error("failed-to-cache-tag", err)
+	}
+
+	return imageID, envvars, nil
+}
+
+// cached returns the image the key last resolved to, if its layers are still
+// in the graph
+func (caching *Caching) cached(key string) (CachedImage, bool) {
+	caching.cacheMutex.Lock()
+	cached, found := caching.cache[key]
+	caching.cacheMutex.Unlock()
+
+	if !found || !caching.graph.Exists(cached.ImageID) {
+		return CachedImage{}, false
+	}
+
+	return cached, true
+}
+
+func (caching *Caching) store(key string, image CachedImage) error {
+	caching.cacheMutex.Lock()
+	defer caching.cacheMutex.Unlock()
+
+	caching.cache[key] = image
+
+	contents, err := json.Marshal(caching.cache)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := ioutil.TempFile(path.Dir(caching.cachePath), path.Base(caching.cachePath))
+	if err != nil {
+		return err
+	}
+
+	_, err = tmp.Write(contents)
+	if err == nil {
+		err = tmp.Chmod(0644)
+	}
+
+	if err == nil {
+		err = tmp.Sync()
+	}
+
+	tmp.Close()
+
+	if err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	return os.Rename(tmp.Name(), caching.cachePath)
+}
+
+// isConnectionError is whether the fetch failed because the registry could
+// not be reached, rather than because of what it answered.
+func isConnectionError(err error) bool {
+	switch e := err.(type) {
+	case FetchError:
+		return isConnectionError(e.Err)
+	case EndpointsFailedError:
+		return isConnectionError(e.Err)
+	case *url.Error, net.Error:
+		return true
+	default:
+		return false
+	}
+}
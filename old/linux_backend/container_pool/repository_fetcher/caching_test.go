@@ -0,0 +1,238 @@
+package repository_fetcher_test
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+
+	"github.com/pivotal-golang/lager/lagertest"
+
+	"github.com/cloudfoundry-incubator/garden-linux/old/linux_backend/container_pool/fake_graph"
+	. "github.com/cloudfoundry-incubator/garden-linux/old/linux_backend/container_pool/repository_fetcher"
+	"github.com/cloudfoundry-incubator/garden-linux/old/linux_backend/container_pool/repository_fetcher/fake_repository_fetcher"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Caching", func() {
+	var graph *fake_graph.FakeGraph
+	var fakeFetcher *fake_repository_fetcher.FakeRepositoryFetcher
+
+	var cacheDir string
+	var cachePath string
+
+	var cacheFirst bool
+	var failOnStalePull bool
+
+	var logger *lagertest.TestLogger
+
+	newCaching := func() *Caching {
+		caching, err := NewCaching(logger, fakeFetcher, graph, cachePath, cacheFirst, failOnStalePull)
+		Ω(err).ShouldNot(HaveOccurred())
+
+		return caching
+	}
+
+	BeforeEach(func() {
+		graph = fake_graph.New()
+
+		fakeFetcher = fake_repository_fetcher.New()
+		fakeFetcher.FetchResult = "some-image-id"
+
+		var err error
+		cacheDir, err = ioutil.TempDir("", "repository-fetcher-cache")
+		Ω(err).ShouldNot(HaveOccurred())
+
+		cachePath = filepath.Join(cacheDir, "tags.json")
+
+		cacheFirst = false
+		failOnStalePull = false
+
+		logger = lagertest.NewTestLogger("test")
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(cacheDir)
+	})
+
+	Context("when the tag has not been fetched before", func() {
+		It("fetches it", func() {
+			imageID, _, err := newCaching().Fetch(logger, "some-repo", "some-tag")
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(imageID).Should(Equal("some-image-id"))
+
+			Ω(fakeFetcher.Fetched()).Should(Equal([]fake_repository_fetcher.FetchSpec{
+				{
+					Repository: "some-repo",
+					Tag:        "some-tag",
+				},
+			}))
+		})
+
+		It("caches it, replacing the cache file", func() {
+			_, _, err := newCaching().Fetch(logger, "some-repo", "some-tag")
+			Ω(err).ShouldNot(HaveOccurred())
+
+			contents, err := ioutil.ReadFile(cachePath)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			var cache map[string]CachedImage
+			err = json.Unmarshal(contents, &cache)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(cache).Should(HaveKey("some-repo:some-tag"))
+
+			files, err := ioutil.ReadDir(cacheDir)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(files).Should(HaveLen(1))
+		})
+
+		Context("and fetching fails", func() {
+			disaster := errors.New("oh no!")
+
+			BeforeEach(func() {
+				fakeFetcher.FetchError = disaster
+			})
+
+			It("returns the error", func() {
+				_, _, err := newCaching().Fetch(logger, "some-repo", "some-tag")
+				Ω(err).Should(Equal(disaster))
+			})
+		})
+	})
+
+	Context("when the tag has been fetched before", func() {
+		BeforeEach(func() {
+			_, _, err := newCaching().Fetch(logger, "some-repo", "some-tag")
+			Ω(err).ShouldNot(HaveOccurred())
+
+			graph.SetExists("some-image-id", []byte(`{"id":"some-image-id"}`))
+
+			fakeFetcher.FetchResult = "some-newer-image-id"
+		})
+
+		It("fetches it again", func() {
+			imageID, _, err := newCaching().Fetch(logger, "some-repo", "some-tag")
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(imageID).Should(Equal("some-newer-image-id"))
+
+			Ω(fakeFetcher.Fetched()).Should(HaveLen(2))
+		})
+
+		Context("and the registry answers with an error", func() {
+			disaster := errors.New("unknown tag: some-repo:some-tag")
+
+			BeforeEach(func() {
+				fakeFetcher.FetchError = disaster
+			})
+
+			It("returns the error rather than the image it was last fetched as", func() {
+				_, _, err := newCaching().Fetch(logger, "some-repo", "some-tag")
+				Ω(err).Should(Equal(disaster))
+			})
+		})
+
+		Context("and the registry cannot be reached", func() {
+			var disaster error
+
+			BeforeEach(func() {
+				disaster = &url.Error{
+					Op:  "Get",
+					URL: "https://registry.example.com/v1/repositories/some-repo/images",
+					Err: errors.New("connection refused"),
+				}
+
+				fakeFetcher.FetchError = disaster
+			})
+
+			It("returns the image it was last fetched as", func() {
+				imageID, envvars, err := newCaching().Fetch(logger, "some-repo", "some-tag")
+				Ω(err).ShouldNot(HaveOccurred())
+				Ω(imageID).Should(Equal("some-image-id"))
+				Ω(envvars).Should(Equal([]string{"env1", "env1Value", "env2", "env2Value"}))
+			})
+
+			Context("after retrying", func() {
+				BeforeEach(func() {
+					fakeFetcher.FetchError = FetchError{
+						Repository: "some-repo",
+						Tag:        "some-tag",
+						Attempts:   3,
+						Err:        disaster,
+					}
+				})
+
+				It("returns the image it was last fetched as", func() {
+					imageID, _, err := newCaching().Fetch(logger, "some-repo", "some-tag")
+					Ω(err).ShouldNot(HaveOccurred())
+					Ω(imageID).Should(Equal("some-image-id"))
+				})
+			})
+
+			Context("but the image is no longer in the graph", func() {
+				BeforeEach(func() {
+					graph = fake_graph.New()
+				})
+
+				It("returns the error", func() {
+					_, _, err := newCaching().Fetch(logger, "some-repo", "some-tag")
+					Ω(err).Should(Equal(disaster))
+				})
+			})
+
+			Context("when failing on stale pulls", func() {
+				BeforeEach(func() {
+					failOnStalePull = true
+				})
+
+				It("returns the error", func() {
+					_, _, err := newCaching().Fetch(logger, "some-repo", "some-tag")
+					Ω(err).Should(Equal(disaster))
+				})
+			})
+		})
+
+		Context("in cache-first mode", func() {
+			BeforeEach(func() {
+				cacheFirst = true
+			})
+
+			It("returns the image it was last fetched as without fetching", func() {
+				imageID, _, err := newCaching().Fetch(logger, "some-repo", "some-tag")
+				Ω(err).ShouldNot(HaveOccurred())
+				Ω(imageID).Should(Equal("some-image-id"))
+
+				Ω(fakeFetcher.Fetched()).Should(HaveLen(1))
+			})
+		})
+	})
+
+	Context("when the cache file is malformed", func() {
+		BeforeEach(func() {
+			err := ioutil.WriteFile(cachePath, []byte("{"), 0644)
+			Ω(err).ShouldNot(HaveOccurred())
+		})
+
+		It("ignores it, replacing it once a tag is fetched", func() {
+			caching := newCaching()
+
+			Ω(logger.TestSink.Logs()).Should(HaveLen(1))
+			Ω(logger.TestSink.Logs()[0].Message).Should(Equal("test.ignoring-corrupt-tag-cache"))
+
+			_, _, err := caching.Fetch(logger, "some-repo", "some-tag")
+			Ω(err).ShouldNot(HaveOccurred())
+
+			reloaded, err := NewCaching(logger, fakeFetcher, graph, cachePath, true, failOnStalePull)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			graph.SetExists("some-image-id", []byte(`{"id":"some-image-id"}`))
+
+			_, _, err = reloaded.Fetch(logger, "some-repo", "some-tag")
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(fakeFetcher.Fetched()).Should(HaveLen(1))
+		})
+	})
+})
@@ -0,0 +1,131 @@
+package repository_fetcher
+
+import (
+	"bytes"
+	"encoding/json"
+	"os/exec"
+	"strings"
+	"sync"
+
+	"github.com/cloudfoundry/gunk/command_runner"
+	"github.com/docker/docker/registry"
+	"github.com/docker/docker/utils"
+	"github.com/pivotal-golang/lager"
+)
+
+// CredentialHelper asks a docker-credential-* compatible executable for
+// the credentials of a registry, by running
+//
+//   <path> get
+//
+// with the registry's address on stdin.
+type CredentialHelper struct {
+	path      string
+	pathMutex sync.RWMutex
+
+	runner command_runner.CommandRunner
+}
+
+type CredentialHelperError struct {
+	ServerURL string
+	Message   string
+}
+
+func (e CredentialHelperError) Error() string {
+	return "credential helper failed for " + e.ServerURL + ": " + e.Message
+}
+
+// what helpers print when they have nothing for the registry
+const credentialsNotFound = "credentials not found in native keychain"
+
+type credentials struct {
+	Username string
+	Secret   string
+}
+
+func NewCredentialHelper(path string, runner command_runner.CommandRunner) *CredentialHelper {
+	return &CredentialHelper{
+		path: path,
+
+		runner: runner,
+	}
+}
+
+// SetPath replaces the helper executable, as when the server's
+// configuration is reloaded. With no path, no credentials are given.
+func (helper *CredentialHelper) SetPath(path string) {
+	helper.pathMutex.Lock()
+	defer helper.pathMutex.Unlock()
+
+	helper.path = path
+}
+
+// Get returns the credentials for the registry, or nil if the helper has
+// none.
+func (helper *CredentialHelper) Get(logger lager.Logger, serverURL string) (*registry.AuthConfig, error) {
+	helper.pathMutex.RLock()
+	path := helper.path
+	helper.pathMutex.RUnlock()
+
+	if path == "" {
+		return nil, nil
+	}
+
+	stdout := new(bytes.Buffer)
+
+	get := exec.Command(path, "get")
+	get.Stdin = strings.NewReader(serverURL)
+	get.Stdout = stdout
+
+	// not logged through logging.Runner, as its output is secret
+	err := helper.runner.Run(get)
+	if err != nil {
+		if strings.TrimSpace(stdout.String()) == credentialsNotFound {
+			logger.Info("no-credentials", lager.Data{"server": serverURL})
+			return nil, nil
+		}
+
+		return nil, CredentialHelperError{serverURL, err.Error()}
+	}
+
+	var creds credentials
+
+	err = json.Unmarshal(stdout.Bytes(), &creds)
+	if err != nil {
+		return nil, CredentialHelperError{serverURL, "malformed response: " + err.Error()}
+	}
+
+	return &registry.AuthConfig{
+		Username:      creds.Username,
+		Password:      creds.Secret,
+		ServerAddress: serverURL,
+	}, nil
+}
+
+// CredentialHelperRegistryProvider builds a session for each fetch with
+// the credentials the helper currently gives, so that they can be rotated
+// without restarting.
+type CredentialHelperRegistryProvider struct {
+	endpoint *registry.Endpoint
+	helper   *CredentialHelper
+}
+
+func NewCredentialHelperRegistryProvider(endpoint *registry.Endpoint, helper *CredentialHelper) *CredentialHelperRegistryProvider {
+	return &CredentialHelperRegistryProvider{
+		endpoint: endpoint,
+		helper:   helper,
+	}
+}
+
+func (provider *CredentialHelperRegistryProvider) ProvideRegistry(logger lager.Logger) (Registry, error) {
+	authConfig, err := provider.helper.Get(logger, provider.endpoint.String())
+	if err != nil {
+		return nil, err
+	}
+
+	if authConfig == nil {
+		authConfig = &registry.AuthConfig{}
+	}
+
+	return NewSession(authConfig, utils.NewHTTPRequestFactory(), provider.endpoint)
+}
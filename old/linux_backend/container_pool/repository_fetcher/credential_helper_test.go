@@ -0,0 +1,169 @@
+package repository_fetcher_test
+
+import (
+	"errors"
+	"io/ioutil"
+	"os/exec"
+
+	"github.com/cloudfoundry/gunk/command_runner/fake_command_runner"
+	. "github.com/cloudfoundry/gunk/command_runner/fake_command_runner/matchers"
+	"github.com/docker/docker/registry"
+	"github.com/pivotal-golang/lager/lagertest"
+
+	. "github.com/cloudfoundry-incubator/garden-linux/old/linux_backend/container_pool/repository_fetcher"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("CredentialHelper", func() {
+	var fakeRunner *fake_command_runner.FakeCommandRunner
+	var helper *CredentialHelper
+
+	var logger *lagertest.TestLogger
+
+	BeforeEach(func() {
+		fakeRunner = fake_command_runner.New()
+		helper = NewCredentialHelper("/path/to/docker-credential-some", fakeRunner)
+
+		logger = lagertest.NewTestLogger("test")
+	})
+
+	It("asks the helper for the registry's credentials", func() {
+		var serverURL []byte
+
+		fakeRunner.WhenRunning(
+			fake_command_runner.CommandSpec{
+				Path: "/path/to/docker-credential-some",
+				Args: []string{"get"},
+			}, func(cmd *exec.Cmd) error {
+				var err error
+				serverURL, err = ioutil.ReadAll(cmd.Stdin)
+				if err != nil {
+					return err
+				}
+
+				_, err = cmd.Stdout.Write([]byte(`{"ServerURL":"https://registry.example.com/v1/","Username":"some-user","Secret":"some-secret"}`))
+				return err
+			},
+		)
+
+		authConfig, err := helper.Get(logger, "https://registry.example.com/v1/")
+		Ω(err).ShouldNot(HaveOccurred())
+
+		Ω(fakeRunner).Should(HaveExecutedSerially(
+			fake_command_runner.CommandSpec{
+				Path: "/path/to/docker-credential-some",
+				Args: []string{"get"},
+			},
+		))
+
+		Ω(string(serverURL)).Should(Equal("https://registry.example.com/v1/"))
+
+		Ω(authConfig).Should(Equal(&registry.AuthConfig{
+			Username:      "some-user",
+			Password:      "some-secret",
+			ServerAddress: "https://registry.example.com/v1/",
+		}))
+	})
+
+	It("does not log the credentials", func() {
+		fakeRunner.WhenRunning(
+			fake_command_runner.CommandSpec{
+				Path: "/path/to/docker-credential-some",
+			}, func(cmd *exec.Cmd) error {
+				_, err := cmd.Stdout.Write([]byte(`{"Username":"some-user","Secret":"some-secret"}`))
+				return err
+			},
+		)
+
+		_, err := helper.Get(logger, "https://registry.example.com/v1/")
+		Ω(err).ShouldNot(HaveOccurred())
+
+		Ω(string(logger.Buffer.Contents())).ShouldNot(ContainSubstring("some-secret"))
+	})
+
+	Context("when the helper has no credentials for the registry", func() {
+		BeforeEach(func() {
+			fakeRunner.WhenRunning(
+				fake_command_runner.CommandSpec{
+					Path: "/path/to/docker-credential-some",
+				}, func(cmd *exec.Cmd) error {
+					cmd.Stdout.Write([]byte("credentials not found in native keychain\n"))
+					return errors.New("exit status 1")
+				},
+			)
+		})
+
+		It("returns no credentials", func() {
+			authConfig, err := helper.Get(logger, "https://registry.example.com/v1/")
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(authConfig).Should(BeNil())
+		})
+	})
+
+	Context("when the helper is replaced", func() {
+		It("asks the new helper", func() {
+			helper.SetPath("/path/to/docker-credential-other")
+
+			_, err := helper.Get(logger, "https://registry.example.com/v1/")
+			Ω(err).Should(HaveOccurred())
+
+			Ω(fakeRunner).Should(HaveExecutedSerially(
+				fake_command_runner.CommandSpec{
+					Path: "/path/to/docker-credential-other",
+					Args: []string{"get"},
+				},
+			))
+		})
+
+		Context("with none", func() {
+			It("returns no credentials without running anything", func() {
+				helper.SetPath("")
+
+				authConfig, err := helper.Get(logger, "https://registry.example.com/v1/")
+				Ω(err).ShouldNot(HaveOccurred())
+				Ω(authConfig).Should(BeNil())
+
+				Ω(fakeRunner.ExecutedCommands()).Should(BeEmpty())
+			})
+		})
+	})
+
+	Context("when the helper fails", func() {
+		BeforeEach(func() {
+			fakeRunner.WhenRunning(
+				fake_command_runner.CommandSpec{
+					Path: "/path/to/docker-credential-some",
+				}, func(cmd *exec.Cmd) error {
+					return errors.New("exit status 2")
+				},
+			)
+		})
+
+		It("returns a CredentialHelperError", func() {
+			_, err := helper.Get(logger, "https://registry.example.com/v1/")
+			Ω(err).Should(Equal(CredentialHelperError{
+				ServerURL: "https://registry.example.com/v1/",
+				Message:   "exit status 2",
+			}))
+		})
+	})
+
+	Context("when the helper's response is malformed", func() {
+		BeforeEach(func() {
+			fakeRunner.WhenRunning(
+				fake_command_runner.CommandSpec{
+					Path: "/path/to/docker-credential-some",
+				}, func(cmd *exec.Cmd) error {
+					_, err := cmd.Stdout.Write([]byte("{"))
+					return err
+				},
+			)
+		})
+
+		It("returns a CredentialHelperError", func() {
+			_, err := helper.Get(logger, "https://registry.example.com/v1/")
+			Ω(err).Should(BeAssignableToTypeOf(CredentialHelperError{}))
+		})
+	})
+})
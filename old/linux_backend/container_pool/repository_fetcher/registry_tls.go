@@ -0,0 +1,126 @@
+package repository_fetcher
+
+import (
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// DockerCertsDir is where registry sessions look for the CA certificates
+// (*.crt) and client certificate/key pairs (*.cert, *.key) to use when
+// talking to a registry, in a subdirectory named after its host.
+const DockerCertsDir = "/etc/docker/certs.d"
+
+// RegistryTLS names the files to install for a registry. Any may be empty,
+// but the client certificate and key must be given together.
+type RegistryTLS struct {
+	CACert     string
+	ClientCert string
+	ClientKey  string
+}
+
+type IncompleteClientCertificateError struct {
+	Host string
+}
+
+func (e IncompleteClientCertificateError) Error() string {
+	return "client certificate and key must both be given for registry " + e.Host
+}
+
+// RegistryHost returns the host (and port, if any) of a registry address,
+// which is what its certificates are keyed by.
+func RegistryHost(address string) (string, error) {
+	if !strings.Contains(address, "://") {
+		address = "https://" + address
+	}
+
+	registryURL, err := url.Parse(address)
+	if err != nil {
+		return "", err
+	}
+
+	return registryURL.Host, nil
+}
+
+// InstallRegistryTLS copies the given files into certsDir for the host.
+func InstallRegistryTLS(certsDir string, host string, registryTLS RegistryTLS) error {
+	if (registryTLS.ClientCert == "") != (registryTLS.ClientKey == "") {
+		return IncompleteClientCertificateError{host}
+	}
+
+	hostDir := filepath.Join(certsDir, host)
+
+	err := os.MkdirAll(hostDir, 0755)
+	if err != nil {
+		return err
+	}
+
+	if registryTLS.CACert != "" {
+		err := copyFile(registryTLS.CACert, filepath.Join(hostDir, "garden-ca.crt"), 0644)
+		if err != nil {
+			return err
+		}
+	}
+
+	if registryTLS.ClientCert != "" {
+		err := copyFile(registryTLS.ClientCert, filepath.Join(hostDir, "garden-client.cert"), 0644)
+		if err != nil {
+			return err
+		}
+
+		err = copyFile(registryTLS.ClientKey, filepath.Join(hostDir, "garden-client.key"), 0600)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// InstallRegistryTLSOverrides installs the files found in each subdirectory
+// of overridesDir for the host the subdirectory is named after. Each may
+// contain ca.crt, and client.cert with client.key.
+func InstallRegistryTLSOverrides(certsDir string, overridesDir string) error {
+	hosts, err := ioutil.ReadDir(overridesDir)
+	if err != nil {
+		return err
+	}
+
+	for _, host := range hosts {
+		if !host.IsDir() {
+			continue
+		}
+
+		hostDir := filepath.Join(overridesDir, host.Name())
+
+		err := InstallRegistryTLS(certsDir, host.Name(), RegistryTLS{
+			CACert:     existingFile(filepath.Join(hostDir, "ca.crt")),
+			ClientCert: existingFile(filepath.Join(hostDir, "client.cert")),
+			ClientKey:  existingFile(filepath.Join(hostDir, "client.key")),
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func existingFile(path string) string {
+	if _, err := os.Stat(path); err != nil {
+		return ""
+	}
+
+	return path
+}
+
+func copyFile(src string, dst string, mode os.FileMode) error {
+	contents, err := ioutil.ReadFile(src)
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(dst, contents, mode)
+}
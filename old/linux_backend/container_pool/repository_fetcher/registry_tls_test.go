@@ -0,0 +1,108 @@
+package repository_fetcher_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	. "github.com/cloudfoundry-incubator/garden-linux/old/linux_backend/container_pool/repository_fetcher"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Registry TLS", func() {
+	var certsDir string
+	var sourceDir string
+
+	writeSource := func(name, contents string) string {
+		path := filepath.Join(sourceDir, name)
+
+		err := os.MkdirAll(filepath.Dir(path), 0755)
+		Ω(err).ShouldNot(HaveOccurred())
+
+		err = ioutil.WriteFile(path, []byte(contents), 0644)
+		Ω(err).ShouldNot(HaveOccurred())
+
+		return path
+	}
+
+	installed := func(host, name string) string {
+		contents, err := ioutil.ReadFile(filepath.Join(certsDir, host, name))
+		Ω(err).ShouldNot(HaveOccurred())
+
+		return string(contents)
+	}
+
+	BeforeEach(func() {
+		var err error
+
+		certsDir, err = ioutil.TempDir("", "certs-dir")
+		Ω(err).ShouldNot(HaveOccurred())
+
+		sourceDir, err = ioutil.TempDir("", "source-dir")
+		Ω(err).ShouldNot(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(certsDir)
+		os.RemoveAll(sourceDir)
+	})
+
+	Describe("RegistryHost", func() {
+		It("returns the host and port of an address", func() {
+			Ω(RegistryHost("https://registry.example.com:5000/v1/")).Should(Equal("registry.example.com:5000"))
+		})
+
+		It("treats addresses without a scheme as hosts", func() {
+			Ω(RegistryHost("registry.example.com")).Should(Equal("registry.example.com"))
+		})
+	})
+
+	Describe("InstallRegistryTLS", func() {
+		It("installs the CA certificate and client certificate for the host", func() {
+			err := InstallRegistryTLS(certsDir, "registry.example.com", RegistryTLS{
+				CACert:     writeSource("ca.pem", "some-ca"),
+				ClientCert: writeSource("cert.pem", "some-cert"),
+				ClientKey:  writeSource("key.pem", "some-key"),
+			})
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(installed("registry.example.com", "garden-ca.crt")).Should(Equal("some-ca"))
+			Ω(installed("registry.example.com", "garden-client.cert")).Should(Equal("some-cert"))
+			Ω(installed("registry.example.com", "garden-client.key")).Should(Equal("some-key"))
+		})
+
+		Context("when a client certificate is given without a key", func() {
+			It("returns an IncompleteClientCertificateError", func() {
+				err := InstallRegistryTLS(certsDir, "registry.example.com", RegistryTLS{
+					ClientCert: writeSource("cert.pem", "some-cert"),
+				})
+				Ω(err).Should(Equal(IncompleteClientCertificateError{Host: "registry.example.com"}))
+			})
+		})
+
+		Context("when a file does not exist", func() {
+			It("returns an error", func() {
+				err := InstallRegistryTLS(certsDir, "registry.example.com", RegistryTLS{
+					CACert: filepath.Join(sourceDir, "bogus"),
+				})
+				Ω(err).Should(HaveOccurred())
+			})
+		})
+	})
+
+	Describe("InstallRegistryTLSOverrides", func() {
+		It("installs the files for each host", func() {
+			writeSource("one.example.com/ca.crt", "ca-one")
+			writeSource("two.example.com:5000/client.cert", "cert-two")
+			writeSource("two.example.com:5000/client.key", "key-two")
+
+			err := InstallRegistryTLSOverrides(certsDir, sourceDir)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(installed("one.example.com", "garden-ca.crt")).Should(Equal("ca-one"))
+			Ω(installed("two.example.com:5000", "garden-client.cert")).Should(Equal("cert-two"))
+			Ω(installed("two.example.com:5000", "garden-client.key")).Should(Equal("key-two"))
+		})
+	})
+})
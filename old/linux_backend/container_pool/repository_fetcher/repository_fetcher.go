@@ -17,7 +17,8 @@ type RepositoryFetcher interface {
 	Fetch(logger lager.Logger, repoName string, tag string) (imageID string, envvars []string, err error)
 }
 
-// apes docker's *registry.Registry
+// apes docker's *registry.Session; see Session for one whose image JSON
+// reads are bounded
 type Registry interface {
 	GetRepositoryData(repoName string) (*registry.RepositoryData, error)
 	GetRemoteTags(registries []string, repository string, token []string) (map[string]string, error)
@@ -27,6 +28,20 @@ type Registry interface {
 	GetRemoteImageLayer(imageID string, registry string, token []string, size int64) (io.ReadCloser, error)
 }
 
+// RegistryProvider gives the registry session to use for a fetch, so that
+// sessions can be built with credentials that change while running.
+type RegistryProvider interface {
+	ProvideRegistry(logger lager.Logger) (Registry, error)
+}
+
+type staticRegistryProvider struct {
+	registry Registry
+}
+
+func (provider staticRegistryProvider) ProvideRegistry(lager.Logger) (Registry, error) {
+	return provider.registry, nil
+}
+
 // apes docker's *graph.Graph
 type Graph interface {
 	Get(name string) (*image.Image, error)
@@ -34,24 +49,104 @@ type Graph interface {
 	Register(image *image.Image, imageJSON []byte, layer archive.ArchiveReader) error
 }
 
+// bounds on registry metadata, so that malformed images cannot hang or
+// exhaust the fetcher
+const (
+	MaxAncestryDepth = 127
+	MaxImageJSONSize = 1024 * 1024
+)
+
+type BadImageMetadataError struct {
+	ImageID string
+	Reason  string
+}
+
+func (e BadImageMetadataError) Error() string {
+	return "bad image metadata for " + e.ImageID + ": " + e.Reason
+}
+
+// EndpointsFailedError is returned when an image could not be fetched from
+// any of its repository's endpoints. Err is the last endpoint's error, so
+// that whether and how the registry responded is kept.
+type EndpointsFailedError struct {
+	Repository string
+	Tag        string
+	Err        error
+}
+
+func (e EndpointsFailedError) Error() string {
+	return fmt.Sprintf("all endpoints failed for %s:%s: %s", e.Repository, e.Tag, e.Err)
+}
+
 type DockerRepositoryFetcher struct {
-	registry Registry
-	graph    Graph
+	registries RegistryProvider
+	graph      Graph
 
+	fetchingImages map[string]*imageFetch
 	fetchingLayers map[string]chan struct{}
 	fetchingMutex  *sync.Mutex
 }
 
+// imageFetch is shared by concurrent fetches of the same tag, which wait
+// for done and take its result rather than fetching again
+type imageFetch struct {
+	done chan struct{}
+
+	imageID string
+	envvars []string
+	err     error
+}
+
 func New(registry Registry, graph Graph) RepositoryFetcher {
+	return NewWithProvider(staticRegistryProvider{registry}, graph)
+}
+
+func NewWithProvider(registries RegistryProvider, graph Graph) RepositoryFetcher {
 	return &DockerRepositoryFetcher{
-		registry:       registry,
+		registries:     registries,
 		graph:          graph,
+		fetchingImages: map[string]*imageFetch{},
 		fetchingLayers: map[string]chan struct{}{},
 		fetchingMutex:  new(sync.Mutex),
 	}
 }
 
 func (fetcher *DockerRepositoryFetcher) Fetch(logger lager.Logger, repoName string, tag string) (string, []string, error) {
+	key := repoName + ":" + tag
+
+	fetcher.fetchingMutex.Lock()
+
+	inFlight, found := fetcher.fetchingImages[key]
+	if found {
+		fetcher.fetchingMutex.Unlock()
+
+		logger.Info("awaiting-concurrent-fetch", lager.Data{
+			"repo": repoName,
+			"tag":  tag,
+		})
+
+		<-inFlight.done
+
+		return inFlight.imageID, inFlight.envvars, inFlight.err
+	}
+
+	inFlight = &imageFetch{done: make(chan struct{})}
+	fetcher.fetchingImages[key] = inFlight
+
+	fetcher.fetchingMutex.Unlock()
+
+	inFlight.imageID, inFlight.envvars, inFlight.err = fetcher.fetch(logger, repoName, tag)
+
+	fetcher.fetchingMutex.Lock()
+	delete(fetcher.fetchingImages, key)
+	fetcher.fetchingMutex.Unlock()
+
+	close(inFlight.done)
+
+	return inFlight.imageID, inFlight.envvars, inFlight.err
+}
+
+func (fetcher *DockerRepositoryFetcher) fetch(logger lager.Logger, repoName string, tag string) (string, []string, error) {
 	fLog := logger.Session("fetch", lager.Data{
 		"repo": repoName,
 		"tag":  tag,
@@ -59,12 +154,17 @@ func (fetcher *DockerRepositoryFetcher) Fetch(logger lager.Logger, repoName stri
 
 	fLog.Debug("fetching")
 
-	repoData, err := fetcher.registry.GetRepositoryData(repoName)
+	session, err := fetcher.registries.ProvideRegistry(fLog)
 	if err != nil {
 		return "", nil, err
 	}
 
-	tagsList, err := fetcher.registry.GetRemoteTags(repoData.Endpoints, repoName, repoData.Tokens)
+	repoData, err := session.GetRepositoryData(repoName)
+	if err != nil {
+		return "", nil, err
+	}
+
+	tagsList, err := session.GetRemoteTags(repoData.Endpoints, repoName, repoData.Tokens)
 	if err != nil {
 		return "", nil, err
 	}
@@ -76,30 +176,43 @@ func (fetcher *DockerRepositoryFetcher) Fetch(logger lager.Logger, repoName stri
 
 	token := repoData.Tokens
 
+	lastErr := fmt.Errorf("no endpoints for %s", repoName)
+
 	for _, endpoint := range repoData.Endpoints {
 		fLog.Debug("trying", lager.Data{
 			"endpoint": endpoint,
 			"image":    imgID,
 		})
 
-		env, err := fetcher.fetchFromEndpoint(fLog, endpoint, imgID, token)
+		env, err := fetcher.fetchFromEndpoint(fLog, session, endpoint, imgID, token)
 		if err == nil {
 			return imgID, filterEnv(env, logger), nil
 		}
+
+		if _, ok := err.(BadImageMetadataError); ok {
+			return "", nil, err
+		}
+
+		lastErr = err
 	}
 
-	return "", nil, fmt.Errorf("all endpoints failed: %s", err)
+	return "", nil, EndpointsFailedError{repoName, tag, lastErr}
 }
 
-func (fetcher *DockerRepositoryFetcher) fetchFromEndpoint(logger lager.Logger, endpoint string, imgID string, token []string) ([]string, error) {
-	history, err := fetcher.registry.GetRemoteHistory(imgID, endpoint, token)
+func (fetcher *DockerRepositoryFetcher) fetchFromEndpoint(logger lager.Logger, session Registry, endpoint string, imgID string, token []string) ([]string, error) {
+	history, err := session.GetRemoteHistory(imgID, endpoint, token)
+	if err != nil {
+		return nil, err
+	}
+
+	err = validateHistory(imgID, history)
 	if err != nil {
 		return nil, err
 	}
 
 	var allEnv []string
 	for i := len(history) - 1; i >= 0; i-- {
-		env, err := fetcher.fetchLayer(logger, endpoint, history[i], token)
+		env, err := fetcher.fetchLayer(logger, session, endpoint, history[i], token)
 		if err != nil {
 			return nil, err
 		}
@@ -110,7 +223,24 @@ func (fetcher *DockerRepositoryFetcher) fetchFromEndpoint(logger lager.Logger, e
 	return allEnv, nil
 }
 
-func (fetcher *DockerRepositoryFetcher) fetchLayer(logger lager.Logger, endpoint string, layerID string, token []string) ([]string, error) {
+func validateHistory(imgID string, history []string) error {
+	if len(history) > MaxAncestryDepth {
+		return BadImageMetadataError{imgID, fmt.Sprintf("ancestry of %d layers exceeds maximum of %d", len(history), MaxAncestryDepth)}
+	}
+
+	seen := map[string]bool{}
+	for _, layerID := range history {
+		if seen[layerID] {
+			return BadImageMetadataError{imgID, "ancestry contains a cycle at layer " + layerID}
+		}
+
+		seen[layerID] = true
+	}
+
+	return nil
+}
+
+func (fetcher *DockerRepositoryFetcher) fetchLayer(logger lager.Logger, session Registry, endpoint string, layerID string, token []string) ([]string, error) {
 	for acquired := false; !acquired; acquired = fetcher.fetching(layerID) {
 	}
 
@@ -125,17 +255,25 @@ func (fetcher *DockerRepositoryFetcher) fetchLayer(logger lager.Logger, endpoint
 		return imgEnv(img), nil
 	}
 
-	imgJSON, imgSize, err := fetcher.registry.GetRemoteImageJSON(layerID, endpoint, token)
+	imgJSON, imgSize, err := session.GetRemoteImageJSON(layerID, endpoint, token)
 	if err != nil {
 		return nil, err
 	}
 
+	if len(imgJSON) > MaxImageJSONSize {
+		return nil, BadImageMetadataError{layerID, fmt.Sprintf("json exceeds maximum of %d bytes", MaxImageJSONSize)}
+	}
+
 	img, err = image.NewImgJSON(imgJSON)
 	if err != nil {
 		return nil, err
 	}
 
-	layer, err := fetcher.registry.GetRemoteImageLayer(img.ID, endpoint, token, int64(imgSize))
+	if img.ID != layerID {
+		return nil, BadImageMetadataError{layerID, "json is for layer " + img.ID}
+	}
+
+	layer, err := session.GetRemoteImageLayer(img.ID, endpoint, token, int64(imgSize))
 	if err != nil {
 		return nil, err
 	}
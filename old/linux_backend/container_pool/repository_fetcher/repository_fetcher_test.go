@@ -4,16 +4,20 @@ import (
 	"fmt"
 	"io/ioutil"
 	"net/http"
+	"strings"
+	"sync"
 
 	"github.com/docker/docker/image"
 	"github.com/docker/docker/pkg/archive"
 	"github.com/docker/docker/registry"
+	"github.com/docker/docker/utils"
 	"github.com/pivotal-golang/lager/lagertest"
 
 	"github.com/cloudfoundry-incubator/garden-linux/old/linux_backend/container_pool/fake_graph"
 	. "github.com/cloudfoundry-incubator/garden-linux/old/linux_backend/container_pool/repository_fetcher"
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gbytes"
 	"github.com/onsi/gomega/ghttp"
 )
 
@@ -48,10 +52,10 @@ var _ = Describe("RepositoryFetcher", func() {
 		endpoint, err := registry.NewEndpoint(server.URL() + "/v1/")
 		Ω(err).ShouldNot(HaveOccurred())
 
-		registry, err := registry.NewSession(nil, nil, endpoint, true)
+		session, err := NewSession(nil, nil, endpoint)
 		Ω(err).ShouldNot(HaveOccurred())
 
-		fetcher = New(registry, graph)
+		fetcher = New(session, graph)
 
 		logger = lagertest.NewTestLogger("test")
 	})
@@ -184,6 +188,153 @@ var _ = Describe("RepositoryFetcher", func() {
 				Ω(imageID).Should(Equal("id-1"))
 			})
 
+			Context("when the ancestry is deeper than the maximum", func() {
+				BeforeEach(func() {
+					endpoint1.SetHandler(1, http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+						ancestry := []string{}
+						for i := 0; i <= MaxAncestryDepth; i++ {
+							ancestry = append(ancestry, fmt.Sprintf(`"layer-%d"`, i))
+						}
+
+						w.Write([]byte("[" + strings.Join(ancestry, ",") + "]"))
+					}))
+				})
+
+				It("returns a BadImageMetadataError without trying other endpoints", func() {
+					_, _, err := fetcher.Fetch(logger, "some-repo", "some-tag")
+					Ω(err).Should(Equal(BadImageMetadataError{
+						ImageID: "id-1",
+						Reason:  fmt.Sprintf("ancestry of %d layers exceeds maximum of %d", MaxAncestryDepth+1, MaxAncestryDepth),
+					}))
+
+					Ω(endpoint2.ReceivedRequests()).Should(BeEmpty())
+				})
+			})
+
+			Context("when the ancestry contains a cycle", func() {
+				BeforeEach(func() {
+					endpoint1.SetHandler(1, http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+						w.Write([]byte(`["layer-1", "layer-2", "layer-1"]`))
+					}))
+				})
+
+				It("returns a BadImageMetadataError", func() {
+					_, _, err := fetcher.Fetch(logger, "some-repo", "some-tag")
+					Ω(err).Should(Equal(BadImageMetadataError{
+						ImageID: "id-1",
+						Reason:  "ancestry contains a cycle at layer layer-1",
+					}))
+				})
+			})
+
+			Context("when a layer's json is for a different layer", func() {
+				BeforeEach(func() {
+					endpoint1.SetHandler(2, http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+						w.Header().Add("X-Docker-Size", "123")
+						w.Write([]byte(`{"id":"layer-4","parent":"parent-4"}`))
+					}))
+				})
+
+				It("returns a BadImageMetadataError", func() {
+					_, _, err := fetcher.Fetch(logger, "some-repo", "some-tag")
+					Ω(err).Should(Equal(BadImageMetadataError{
+						ImageID: "layer-3",
+						Reason:  "json is for layer layer-4",
+					}))
+				})
+			})
+
+			Context("when a layer's json exceeds the maximum", func() {
+				BeforeEach(func() {
+					endpoint1.SetHandler(2, http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+						w.Header().Add("X-Docker-Size", "123")
+						w.Write([]byte(`{"id":"layer-3","padding":"`))
+
+						// never ends, so that only a bounded read returns
+						padding := []byte(strings.Repeat("x", 4096))
+						for {
+							_, err := w.Write(padding)
+							if err != nil {
+								return
+							}
+						}
+					}))
+				})
+
+				It("returns a BadImageMetadataError without reading the rest of it", func() {
+					_, _, err := fetcher.Fetch(logger, "some-repo", "some-tag")
+					Ω(err).Should(Equal(BadImageMetadataError{
+						ImageID: "layer-3",
+						Reason:  fmt.Sprintf("json exceeds maximum of %d bytes", MaxImageJSONSize),
+					}))
+				})
+			})
+
+			Context("when the same tag is fetched concurrently", func() {
+				It("fetches it once, sharing the result", func() {
+					registering := make(chan struct{})
+					release := make(chan struct{})
+
+					var once sync.Once
+					graph.WhenRegistering = func(image *image.Image, imageJSON []byte, layer archive.ArchiveReader) error {
+						once.Do(func() { close(registering) })
+						<-release
+						return nil
+					}
+
+					fetched := make(chan string, 2)
+
+					fetch := func() {
+						defer GinkgoRecover()
+
+						imageID, _, err := fetcher.Fetch(logger, "some-repo", "some-tag")
+						Ω(err).ShouldNot(HaveOccurred())
+
+						fetched <- imageID
+					}
+
+					go fetch()
+
+					<-registering
+
+					go fetch()
+
+					Eventually(logger.Buffer).Should(gbytes.Say("awaiting-concurrent-fetch"))
+
+					close(release)
+
+					Eventually(fetched).Should(Receive(Equal("id-1")))
+					Eventually(fetched).Should(Receive(Equal("id-1")))
+				})
+			})
+
+			Context("when every endpoint fails", func() {
+				BeforeEach(func() {
+					endpoint1.SetHandler(1, http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+						w.WriteHeader(500)
+					}))
+
+					endpoint2.AppendHandlers(
+						ghttp.CombineHandlers(
+							ghttp.VerifyRequest("GET", "/v1/images/id-1/ancestry"),
+							ghttp.RespondWith(503, "unavailable"),
+						),
+					)
+				})
+
+				It("returns an EndpointsFailedError with the last endpoint's error", func() {
+					_, _, err := fetcher.Fetch(logger, "some-repo", "some-tag")
+					Ω(err).Should(BeAssignableToTypeOf(EndpointsFailedError{}))
+
+					failed := err.(EndpointsFailedError)
+					Ω(failed.Repository).Should(Equal("some-repo"))
+					Ω(failed.Tag).Should(Equal("some-tag"))
+
+					Ω(failed.Err).Should(BeAssignableToTypeOf(&utils.JSONError{}))
+					Ω(failed.Err.(*utils.JSONError).Code).Should(Equal(503))
+				})
+			})
+
 			Context("when the first endpoint fails", func() {
 				BeforeEach(func() {
 					endpoint1.SetHandler(1, http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
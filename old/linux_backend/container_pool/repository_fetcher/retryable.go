@@ -1,29 +1,142 @@
 package repository_fetcher
 
 import (
+	"fmt"
+	"time"
+
+	"github.com/cloudfoundry/dropsonde/metric_sender"
+	"github.com/docker/docker/utils"
 	"github.com/pivotal-golang/lager"
 )
 
+const DefaultAttempts = 3
+
 type Retryable struct {
 	RepositoryFetcher
+
+	// number of attempts to make; DefaultAttempts if zero
+	Attempts int
+
+	// how long to wait after each failed attempt; the last entry is reused
+	// for any later attempts, and no entries means no waiting
+	Backoff []time.Duration
+
+	// whether a failed attempt is worth retrying; every error is if nil
+	ShouldRetry func(error) bool
+
+	// where to send metrics of each attempt; none are sent if nil
+	MetricSender metric_sender.MetricSender
+}
+
+// FetchError is returned once a Retryable gives up on fetching a tag.
+// StatusCode is the registry's response to the last attempt, or zero if
+// the registry did not respond.
+type FetchError struct {
+	Repository string
+	Tag        string
+	Attempts   int
+	StatusCode int
+	Err        error
+}
+
+func (e FetchError) Error() string {
+	return fmt.Sprintf("failed to fetch %s:%s after %d attempt(s): %s", e.Repository, e.Tag, e.Attempts, e.Err)
+}
+
+// RetryServerErrors retries everything but registry responses in the 4xx
+// range and bad image metadata, which will not change by asking again.
+func RetryServerErrors(err error) bool {
+	if _, ok := err.(BadImageMetadataError); ok {
+		return false
+	}
+
+	code := statusCode(err)
+	return code < 400 || code >= 500
 }
 
 func (retryable Retryable) Fetch(logger lager.Logger, repoName string, tag string) (string, []string, error) {
-	var res string
+	attempts := retryable.Attempts
+	if attempts == 0 {
+		attempts = DefaultAttempts
+	}
+
 	var err error
-	var envvars []string
 
-	for attempt := 1; attempt <= 3; attempt++ {
+	for attempt := 1; attempt <= attempts; attempt++ {
+		started := time.Now()
+
+		var res string
+		var envvars []string
+
 		res, envvars, err = retryable.RepositoryFetcher.Fetch(logger, repoName, tag)
+
+		logger.Info("fetch-attempt", lager.Data{
+			"repo":     repoName,
+			"tag":      tag,
+			"attempt":  attempt,
+			"of":       attempts,
+			"duration": time.Since(started).String(),
+			"success":  err == nil,
+		})
+
+		retryable.sendAttempt(time.Since(started), err)
+
 		if err == nil {
-			break
+			return res, envvars, nil
 		}
 
 		logger.Error("failed-to-fetch", err, lager.Data{
 			"attempt": attempt,
-			"of":      3,
+			"of":      attempts,
 		})
+
+		if retryable.ShouldRetry != nil && !retryable.ShouldRetry(err) {
+			return "", nil, FetchError{repoName, tag, attempt, statusCode(err), err}
+		}
+
+		if attempt < attempts {
+			time.Sleep(retryable.backoff(attempt))
+		}
 	}
 
-	return res, envvars, err
+	return "", nil, FetchError{repoName, tag, attempts, statusCode(err), err}
+}
+
+// sendAttempt counts an attempt, and whether it failed, and sends how long
+// it took, so that a flaky registry shows before fetches start failing.
+func (retryable Retryable) sendAttempt(took time.Duration, err error) {
+	if retryable.MetricSender == nil {
+		return
+	}
+
+	retryable.MetricSender.IncrementCounter("registry.fetch.attempts")
+
+	if err != nil {
+		retryable.MetricSender.IncrementCounter("registry.fetch.failed_attempts")
+	}
+
+	retryable.MetricSender.SendValue("registry.fetch.attempt_duration", float64(took/time.Millisecond), "ms")
+}
+
+func (retryable Retryable) backoff(attempt int) time.Duration {
+	if len(retryable.Backoff) == 0 {
+		return 0
+	}
+
+	if attempt > len(retryable.Backoff) {
+		return retryable.Backoff[len(retryable.Backoff)-1]
+	}
+
+	return retryable.Backoff[attempt-1]
+}
+
+func statusCode(err error) int {
+	switch e := err.(type) {
+	case *utils.JSONError:
+		return e.Code
+	case EndpointsFailedError:
+		return statusCode(e.Err)
+	default:
+		return 0
+	}
 }
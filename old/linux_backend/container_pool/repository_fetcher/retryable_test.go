@@ -0,0 +1,215 @@
+package repository_fetcher_test
+
+import (
+	"errors"
+	"time"
+
+	"github.com/cloudfoundry/dropsonde/metric_sender/fake"
+	"github.com/docker/docker/utils"
+	"github.com/pivotal-golang/lager"
+	"github.com/pivotal-golang/lager/lagertest"
+
+	. "github.com/cloudfoundry-incubator/garden-linux/old/linux_backend/container_pool/repository_fetcher"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+type failingFetcher struct {
+	errs    []error
+	fetches int
+}
+
+func (f *failingFetcher) Fetch(logger lager.Logger, repoName string, tag string) (string, []string, error) {
+	f.fetches++
+
+	if len(f.errs) > 0 {
+		err := f.errs[0]
+		f.errs = f.errs[1:]
+		return "", nil, err
+	}
+
+	return "some-image-id", nil, nil
+}
+
+var _ = Describe("Retryable", func() {
+	var fetcher *failingFetcher
+	var retryable Retryable
+
+	var logger *lagertest.TestLogger
+
+	BeforeEach(func() {
+		fetcher = &failingFetcher{}
+
+		retryable = Retryable{RepositoryFetcher: fetcher}
+
+		logger = lagertest.NewTestLogger("test")
+	})
+
+	Context("when fetching fails a few times before succeeding", func() {
+		BeforeEach(func() {
+			fetcher.errs = []error{errors.New("oh no!"), errors.New("oh no!")}
+		})
+
+		It("retries until it succeeds", func() {
+			imageID, _, err := retryable.Fetch(logger, "some-repo", "some-tag")
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(imageID).Should(Equal("some-image-id"))
+
+			Ω(fetcher.fetches).Should(Equal(3))
+		})
+
+		It("logs each attempt", func() {
+			_, _, err := retryable.Fetch(logger, "some-repo", "some-tag")
+			Ω(err).ShouldNot(HaveOccurred())
+
+			attempts := 0
+			for _, log := range logger.Logs() {
+				if log.Message == "test.fetch-attempt" {
+					attempts++
+				}
+			}
+
+			Ω(attempts).Should(Equal(3))
+		})
+
+		Context("with a metric sender", func() {
+			var fakeMetricSender *fake.FakeMetricSender
+
+			BeforeEach(func() {
+				fakeMetricSender = fake.NewFakeMetricSender()
+				retryable.MetricSender = fakeMetricSender
+			})
+
+			It("sends metrics of each attempt", func() {
+				_, _, err := retryable.Fetch(logger, "some-repo", "some-tag")
+				Ω(err).ShouldNot(HaveOccurred())
+
+				Ω(fakeMetricSender.GetCounter("registry.fetch.attempts")).Should(Equal(uint64(3)))
+				Ω(fakeMetricSender.GetCounter("registry.fetch.failed_attempts")).Should(Equal(uint64(2)))
+				Ω(fakeMetricSender.GetValue("registry.fetch.attempt_duration").Unit).Should(Equal("ms"))
+			})
+		})
+
+		Context("with a backoff", func() {
+			BeforeEach(func() {
+				retryable.Backoff = []time.Duration{10 * time.Millisecond, 20 * time.Millisecond}
+			})
+
+			It("waits between attempts", func() {
+				started := time.Now()
+
+				_, _, err := retryable.Fetch(logger, "some-repo", "some-tag")
+				Ω(err).ShouldNot(HaveOccurred())
+
+				Ω(time.Since(started)).Should(BeNumerically(">=", 30*time.Millisecond))
+			})
+		})
+	})
+
+	Context("when fetching keeps failing", func() {
+		disaster := &utils.JSONError{Code: 503, Message: "unavailable"}
+
+		BeforeEach(func() {
+			fetcher.errs = []error{disaster, disaster, disaster, disaster, disaster}
+		})
+
+		It("gives up after three attempts with a FetchError", func() {
+			_, _, err := retryable.Fetch(logger, "some-repo", "some-tag")
+			Ω(err).Should(Equal(FetchError{
+				Repository: "some-repo",
+				Tag:        "some-tag",
+				Attempts:   3,
+				StatusCode: 503,
+				Err:        disaster,
+			}))
+
+			Ω(fetcher.fetches).Should(Equal(3))
+		})
+
+		Context("when configured with a number of attempts", func() {
+			BeforeEach(func() {
+				retryable.Attempts = 5
+			})
+
+			It("makes that many", func() {
+				_, _, err := retryable.Fetch(logger, "some-repo", "some-tag")
+				Ω(err).Should(HaveOccurred())
+
+				Ω(fetcher.fetches).Should(Equal(5))
+			})
+		})
+	})
+
+	Context("when only retrying server errors", func() {
+		BeforeEach(func() {
+			retryable.ShouldRetry = RetryServerErrors
+		})
+
+		Context("and the registry rejects the request", func() {
+			disaster := &utils.JSONError{Code: 404, Message: "not found"}
+
+			BeforeEach(func() {
+				fetcher.errs = []error{disaster}
+			})
+
+			It("gives up immediately", func() {
+				_, _, err := retryable.Fetch(logger, "some-repo", "some-tag")
+				Ω(err).Should(Equal(FetchError{
+					Repository: "some-repo",
+					Tag:        "some-tag",
+					Attempts:   1,
+					StatusCode: 404,
+					Err:        disaster,
+				}))
+			})
+		})
+
+		Context("and the registry rejects the request at every endpoint", func() {
+			rejection := &utils.JSONError{Code: 404, Message: "not found"}
+			disaster := EndpointsFailedError{Repository: "some-repo", Tag: "some-tag", Err: rejection}
+
+			BeforeEach(func() {
+				fetcher.errs = []error{disaster}
+			})
+
+			It("gives up immediately, with the status code", func() {
+				_, _, err := retryable.Fetch(logger, "some-repo", "some-tag")
+				Ω(err).Should(Equal(FetchError{
+					Repository: "some-repo",
+					Tag:        "some-tag",
+					Attempts:   1,
+					StatusCode: 404,
+					Err:        disaster,
+				}))
+			})
+		})
+
+		Context("and the image metadata is bad", func() {
+			disaster := BadImageMetadataError{ImageID: "some-image-id", Reason: "too deep"}
+
+			BeforeEach(func() {
+				fetcher.errs = []error{disaster}
+			})
+
+			It("gives up immediately", func() {
+				_, _, err := retryable.Fetch(logger, "some-repo", "some-tag")
+				Ω(err).Should(HaveOccurred())
+
+				Ω(fetcher.fetches).Should(Equal(1))
+			})
+		})
+
+		Context("and the registry cannot be reached", func() {
+			BeforeEach(func() {
+				fetcher.errs = []error{errors.New("connection refused")}
+			})
+
+			It("retries", func() {
+				_, _, err := retryable.Fetch(logger, "some-repo", "some-tag")
+				Ω(err).ShouldNot(HaveOccurred())
+
+				Ω(fetcher.fetches).Should(Equal(2))
+			})
+		})
+	})
+})
@@ -0,0 +1,175 @@
+package repository_fetcher
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/cookiejar"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/registry"
+	"github.com/docker/docker/utils"
+)
+
+// Session is a docker registry session that reads no more of an image's
+// JSON than MaxImageJSONSize (and a byte, to tell that it is too large),
+// where docker's reads the whole response before it can be checked.
+type Session struct {
+	*registry.Session
+
+	factory *utils.HTTPRequestFactory
+	jar     http.CookieJar
+}
+
+func NewSession(authConfig *registry.AuthConfig, factory *utils.HTTPRequestFactory, endpoint *registry.Endpoint) (*Session, error) {
+	if factory == nil {
+		factory = utils.NewHTTPRequestFactory()
+	}
+
+	// docker's session adds any authentication it needs to the factory
+	session, err := registry.NewSession(authConfig, factory, endpoint, true)
+	if err != nil {
+		return nil, err
+	}
+
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Session{
+		Session: session,
+		factory: factory,
+		jar:     jar,
+	}, nil
+}
+
+func (session *Session) GetRemoteImageJSON(imageID string, registry string, token []string) ([]byte, int, error) {
+	req, err := session.factory.NewRequest("GET", registry+"images/"+imageID+"/json", nil)
+	if err != nil {
+		return nil, -1, fmt.Errorf("Failed to download json: %s", err)
+	}
+
+	if req.Header.Get("Authorization") == "" {
+		req.Header.Set("Authorization", "Token "+strings.Join(token, ","))
+	}
+
+	res, err := session.do(req)
+	if err != nil {
+		return nil, -1, fmt.Errorf("Failed to download json: %s", err)
+	}
+
+	defer res.Body.Close()
+
+	if res.StatusCode != 200 {
+		return nil, -1, utils.NewHTTPRequestError(fmt.Sprintf("HTTP code %d", res.StatusCode), res)
+	}
+
+	imageSize := -1
+	if header := res.Header.Get("X-Docker-Size"); header != "" {
+		imageSize, err = strconv.Atoi(header)
+		if err != nil {
+			return nil, -1, err
+		}
+	}
+
+	imageJSON, err := ioutil.ReadAll(io.LimitReader(res.Body, MaxImageJSONSize+1))
+	if err != nil {
+		return nil, -1, fmt.Errorf("Failed to parse downloaded json: %s", err)
+	}
+
+	return imageJSON, imageSize, nil
+}
+
+// do makes the request as docker's session does, with the certificates
+// installed in DockerCertsDir for the registry's host, trying each client
+// certificate until one is not refused.
+func (session *Session) do(req *http.Request) (*http.Response, error) {
+	hostDir := filepath.Join(DockerCertsDir, req.URL.Host)
+
+	files, err := ioutil.ReadDir(hostDir)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	var roots *x509.CertPool
+	var certs []*tls.Certificate
+
+	for _, file := range files {
+		name := file.Name()
+
+		switch {
+		case strings.HasSuffix(name, ".crt"):
+			if roots == nil {
+				roots = x509.NewCertPool()
+			}
+
+			data, err := ioutil.ReadFile(filepath.Join(hostDir, name))
+			if err != nil {
+				return nil, err
+			}
+
+			roots.AppendCertsFromPEM(data)
+
+		case strings.HasSuffix(name, ".cert"):
+			keyName := strings.TrimSuffix(name, ".cert") + ".key"
+
+			cert, err := tls.LoadX509KeyPair(filepath.Join(hostDir, name), filepath.Join(hostDir, keyName))
+			if err != nil {
+				return nil, err
+			}
+
+			certs = append(certs, &cert)
+		}
+	}
+
+	if len(certs) == 0 {
+		return session.client(roots, nil).Do(req)
+	}
+
+	for i, cert := range certs {
+		res, err := session.client(roots, cert).Do(req)
+		if i == len(certs)-1 || err == nil && res.StatusCode != 403 && res.StatusCode < 500 {
+			return res, err
+		}
+
+		if err == nil {
+			res.Body.Close()
+		}
+	}
+
+	return nil, nil
+}
+
+func (session *Session) client(roots *x509.CertPool, cert *tls.Certificate) *http.Client {
+	tlsConfig := &tls.Config{RootCAs: roots}
+	if cert != nil {
+		tlsConfig.Certificates = []tls.Certificate{*cert}
+	}
+
+	return &http.Client{
+		Transport: &http.Transport{
+			DisableKeepAlives: true,
+			Proxy:             http.ProxyFromEnvironment,
+			TLSClientConfig:   tlsConfig,
+			Dial: func(network string, addr string) (net.Conn, error) {
+				conn, err := net.Dial(network, addr)
+				if err != nil {
+					return nil, err
+				}
+
+				return utils.NewTimeoutConn(conn, time.Minute), nil
+			},
+		},
+		CheckRedirect: registry.AddRequiredHeadersToRedirectedRequests,
+		Jar:           session.jar,
+	}
+}
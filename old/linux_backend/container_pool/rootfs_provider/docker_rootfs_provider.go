@@ -12,6 +12,7 @@ import (
 
 type dockerRootFSProvider struct {
 	repoFetcher repository_fetcher.RepositoryFetcher
+	graph       repository_fetcher.Graph
 	graphDriver graphdriver.Driver
 
 	fallback RootFSProvider
@@ -21,17 +22,25 @@ var ErrInvalidDockerURL = errors.New("invalid docker url; must provide path")
 
 func NewDocker(
 	repoFetcher repository_fetcher.RepositoryFetcher,
+	graph repository_fetcher.Graph,
 	graphDriver graphdriver.Driver,
 ) RootFSProvider {
 	return &dockerRootFSProvider{
 		repoFetcher: repoFetcher,
+		graph:       graph,
 		graphDriver: graphDriver,
 	}
 }
 
-func (provider *dockerRootFSProvider) ProvideRootFS(logger lager.Logger, id string, url *url.URL) (string, []string, error) {
+func (provider *dockerRootFSProvider) ProvideRootFS(logger lager.Logger, id string, url *url.URL, mountLabel string) (string, []string, Provenance, error) {
 	if len(url.Path) == 0 {
-		return "", nil, ErrInvalidDockerURL
+		return "", nil, Provenance{}, ErrInvalidDockerURL
+	}
+
+	// the vendored graph drivers only apply mount labels when built with
+	// SELinux support, which this build is not
+	if mountLabel != "" {
+		return "", nil, Provenance{}, UnlabelledRootFSError{"docker"}
 	}
 
 	repoName := url.Path[1:]
@@ -43,20 +52,50 @@ func (provider *dockerRootFSProvider) ProvideRootFS(logger lager.Logger, id stri
 
 	imageID, envvars, err := provider.repoFetcher.Fetch(logger, repoName, tag)
 	if err != nil {
-		return "", nil, err
+		return "", nil, Provenance{}, err
 	}
 
 	err = provider.graphDriver.Create(id, imageID)
 	if err != nil {
-		return "", nil, err
+		return "", nil, Provenance{}, err
 	}
 
 	rootID, err := provider.graphDriver.Get(id, "")
 	if err != nil {
-		return "", nil, err
+		return "", nil, Provenance{}, err
+	}
+
+	provenance := Provenance{
+		Image:   repoName + ":" + tag,
+		ImageID: imageID,
+		Layers:  provider.layers(logger, imageID),
+	}
+
+	return rootID, envvars, provenance, nil
+}
+
+// layers walks the image's parents in the graph; as they are only recorded
+// for provenance, an incomplete walk is logged rather than failing
+func (provider *dockerRootFSProvider) layers(logger lager.Logger, imageID string) []string {
+	layers := []string{}
+
+	for layerID := imageID; layerID != ""; {
+		if len(layers) == repository_fetcher.MaxAncestryDepth {
+			logger.Info("layers-truncated", lager.Data{"image": imageID})
+			break
+		}
+
+		img, err := provider.graph.Get(layerID)
+		if err != nil {
+			logger.Error("failed-to-get-layer", err, lager.Data{"layer": layerID})
+			break
+		}
+
+		layers = append(layers, layerID)
+		layerID = img.Parent
 	}
 
-	return rootID, envvars, nil
+	return layers
 }
 
 func (provider *dockerRootFSProvider) CleanupRootFS(logger lager.Logger, id string) error {
@@ -64,3 +103,27 @@ func (provider *dockerRootFSProvider) CleanupRootFS(logger lager.Logger, id stri
 
 	return provider.graphDriver.Remove(id)
 }
+
+// VerifyRootFS checks that the container's layer and every layer of the
+// image it was created from are still in the graph.
+func (provider *dockerRootFSProvider) VerifyRootFS(logger lager.Logger, id string, provenance Provenance) error {
+	if !provider.graphDriver.Exists(id) {
+		return MissingRootFSError{"container layer " + id}
+	}
+
+	for _, layer := range provenance.Layers {
+		if !provider.graph.Exists(layer) {
+			return MissingRootFSError{"image layer " + layer}
+		}
+	}
+
+	return nil
+}
+
+// RemountRootFS takes the container's layer from the graph driver again,
+// which mounts it unless it is still mounted. Containers with docker
+// rootfses are only created without labels, so none is given.
+func (provider *dockerRootFSProvider) RemountRootFS(logger lager.Logger, id string, provenance Provenance, mountLabel string) error {
+	_, err := provider.graphDriver.Get(id, "")
+	return err
+}
@@ -3,6 +3,7 @@ package rootfs_provider_test
 import (
 	"errors"
 
+	"github.com/cloudfoundry-incubator/garden-linux/old/linux_backend/container_pool/fake_graph"
 	"github.com/cloudfoundry-incubator/garden-linux/old/linux_backend/container_pool/fake_graph_driver"
 	"github.com/cloudfoundry-incubator/garden-linux/old/linux_backend/container_pool/repository_fetcher/fake_repository_fetcher"
 	. "github.com/cloudfoundry-incubator/garden-linux/old/linux_backend/container_pool/rootfs_provider"
@@ -15,6 +16,7 @@ import (
 var _ = Describe("DockerRootFSProvider", func() {
 	var (
 		fakeRepositoryFetcher *fake_repository_fetcher.FakeRepositoryFetcher
+		fakeGraph             *fake_graph.FakeGraph
 		fakeGraphDriver       *fake_graph_driver.FakeGraphDriver
 
 		provider RootFSProvider
@@ -24,9 +26,10 @@ var _ = Describe("DockerRootFSProvider", func() {
 
 	BeforeEach(func() {
 		fakeRepositoryFetcher = fake_repository_fetcher.New()
+		fakeGraph = fake_graph.New()
 		fakeGraphDriver = fake_graph_driver.New()
 
-		provider = NewDocker(fakeRepositoryFetcher, fakeGraphDriver)
+		provider = NewDocker(fakeRepositoryFetcher, fakeGraph, fakeGraphDriver)
 
 		logger = lagertest.NewTestLogger("test")
 	})
@@ -36,7 +39,7 @@ var _ = Describe("DockerRootFSProvider", func() {
 			fakeRepositoryFetcher.FetchResult = "some-image-id"
 			fakeGraphDriver.GetResult = "/some/graph/driver/mount/point"
 
-			mountpoint, envvars, err := provider.ProvideRootFS(logger, "some-id", parseURL("docker:///some-repository-name"))
+			mountpoint, envvars, _, err := provider.ProvideRootFS(logger, "some-id", parseURL("docker:///some-repository-name"), "")
 			Ω(err).ShouldNot(HaveOccurred())
 
 			Ω(fakeGraphDriver.Created()).Should(ContainElement(
@@ -57,16 +60,42 @@ var _ = Describe("DockerRootFSProvider", func() {
 			Ω(envvars).Should(Equal([]string{"env1", "env1Value", "env2", "env2Value"}))
 		})
 
+		It("returns the image and layers it was created from", func() {
+			fakeRepositoryFetcher.FetchResult = "some-image-id"
+
+			fakeGraph.SetExists("some-image-id", []byte(`{"id":"some-image-id","parent":"some-parent-id"}`))
+			fakeGraph.SetExists("some-parent-id", []byte(`{"id":"some-parent-id"}`))
+
+			_, _, provenance, err := provider.ProvideRootFS(logger, "some-id", parseURL("docker:///some-repository-name#some-tag"), "")
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(provenance).Should(Equal(Provenance{
+				Image:   "some-repository-name:some-tag",
+				ImageID: "some-image-id",
+				Layers:  []string{"some-image-id", "some-parent-id"},
+			}))
+		})
+
+		Context("when given a mount label", func() {
+			It("refuses to provide a rootfs it cannot label", func() {
+				_, _, _, err := provider.ProvideRootFS(logger, "some-id", parseURL("docker:///some-repository-name"), "some:mount:label:s0:c1,c2")
+				Ω(err).Should(Equal(UnlabelledRootFSError{"docker"}))
+
+				Ω(fakeRepositoryFetcher.Fetched()).Should(BeEmpty())
+				Ω(fakeGraphDriver.Gotten()).Should(BeEmpty())
+			})
+		})
+
 		Context("when the url is missing a path", func() {
 			It("returns an error", func() {
-				_, _, err := provider.ProvideRootFS(logger, "some-id", parseURL("docker://"))
+				_, _, _, err := provider.ProvideRootFS(logger, "some-id", parseURL("docker://"), "")
 				Ω(err).Should(Equal(ErrInvalidDockerURL))
 			})
 		})
 
 		Context("and a tag is specified via a fragment", func() {
 			It("uses it when fetching the repository", func() {
-				_, _, err := provider.ProvideRootFS(logger, "some-id", parseURL("docker:///some-repository-name#some-tag"))
+				_, _, _, err := provider.ProvideRootFS(logger, "some-id", parseURL("docker:///some-repository-name#some-tag"), "")
 				Ω(err).ShouldNot(HaveOccurred())
 
 				Ω(fakeRepositoryFetcher.Fetched()).Should(ContainElement(
@@ -86,7 +115,7 @@ var _ = Describe("DockerRootFSProvider", func() {
 			})
 
 			It("returns the error", func() {
-				_, _, err := provider.ProvideRootFS(logger, "some-id", parseURL("docker:///some-repository-name"))
+				_, _, _, err := provider.ProvideRootFS(logger, "some-id", parseURL("docker:///some-repository-name"), "")
 				Ω(err).Should(Equal(disaster))
 			})
 		})
@@ -99,7 +128,7 @@ var _ = Describe("DockerRootFSProvider", func() {
 			})
 
 			It("returns the error", func() {
-				_, _, err := provider.ProvideRootFS(logger, "some-id", parseURL("docker:///some-repository-name#some-tag"))
+				_, _, _, err := provider.ProvideRootFS(logger, "some-id", parseURL("docker:///some-repository-name#some-tag"), "")
 				Ω(err).Should(Equal(disaster))
 			})
 		})
@@ -112,7 +141,7 @@ var _ = Describe("DockerRootFSProvider", func() {
 			})
 
 			It("returns the error", func() {
-				_, _, err := provider.ProvideRootFS(logger, "some-id", parseURL("docker:///some-repository-name#some-tag"))
+				_, _, _, err := provider.ProvideRootFS(logger, "some-id", parseURL("docker:///some-repository-name#some-tag"), "")
 				Ω(err).Should(Equal(disaster))
 			})
 		})
@@ -140,4 +169,72 @@ var _ = Describe("DockerRootFSProvider", func() {
 			})
 		})
 	})
+
+	Describe("VerifyRootFS", func() {
+		provenance := Provenance{
+			Image:   "some/image:latest",
+			ImageID: "some-image-id",
+			Layers:  []string{"some-image-id", "some-parent-id"},
+		}
+
+		BeforeEach(func() {
+			fakeGraphDriver.SetExists("some-id", true)
+			fakeGraph.SetExists("some-image-id", []byte("{}"))
+			fakeGraph.SetExists("some-parent-id", []byte("{}"))
+		})
+
+		It("succeeds when the container's layer and the image's layers exist", func() {
+			err := provider.VerifyRootFS(logger, "some-id", provenance)
+			Ω(err).ShouldNot(HaveOccurred())
+		})
+
+		Context("when the container's layer is gone", func() {
+			BeforeEach(func() {
+				fakeGraphDriver.SetExists("some-id", false)
+			})
+
+			It("returns an error naming it", func() {
+				err := provider.VerifyRootFS(logger, "some-id", provenance)
+				Ω(err).Should(Equal(MissingRootFSError{"container layer some-id"}))
+			})
+		})
+
+		Context("when one of the image's layers is gone", func() {
+			It("returns an error naming it", func() {
+				provenance := Provenance{Layers: []string{"some-image-id", "some-missing-id"}}
+
+				err := provider.VerifyRootFS(logger, "some-id", provenance)
+				Ω(err).Should(Equal(MissingRootFSError{"image layer some-missing-id"}))
+			})
+		})
+	})
+
+	Describe("RemountRootFS", func() {
+		It("gets the container's layer from the graph driver, mounting it", func() {
+			err := provider.RemountRootFS(logger, "some-id", Provenance{}, "")
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(fakeGraphDriver.Gotten()).Should(Equal([]string{"some-id"}))
+		})
+
+		It("does not give the graph driver a mount label, which it cannot apply", func() {
+			err := provider.RemountRootFS(logger, "some-id", Provenance{}, "some:mount:label:s0:c1,c2")
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(fakeGraphDriver.MountLabels()).Should(Equal([]string{""}))
+		})
+
+		Context("when getting the layer fails", func() {
+			disaster := errors.New("oh no!")
+
+			BeforeEach(func() {
+				fakeGraphDriver.GetError = disaster
+			})
+
+			It("returns the error", func() {
+				err := provider.RemountRootFS(logger, "some-id", Provenance{}, "")
+				Ω(err).Should(Equal(disaster))
+			})
+		})
+	})
 })
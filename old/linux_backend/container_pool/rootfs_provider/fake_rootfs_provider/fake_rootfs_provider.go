@@ -10,17 +10,19 @@ import (
 )
 
 type FakeRootFSProvider struct {
-	ProvideRootFSStub        func(logger lager.Logger, id string, rootfs *url.URL) (mountpoint string, envvar []string, err error)
+	ProvideRootFSStub        func(logger lager.Logger, id string, rootfs *url.URL, mountLabel string) (mountpoint string, envvar []string, provenance rootfs_provider.Provenance, err error)
 	provideRootFSMutex       sync.RWMutex
 	provideRootFSArgsForCall []struct {
-		logger lager.Logger
-		id     string
-		rootfs *url.URL
+		logger     lager.Logger
+		id         string
+		rootfs     *url.URL
+		mountLabel string
 	}
 	provideRootFSReturns struct {
 		result1 string
 		result2 []string
-		result3 error
+		result3 rootfs_provider.Provenance
+		result4 error
 	}
 	CleanupRootFSStub        func(logger lager.Logger, id string) error
 	cleanupRootFSMutex       sync.RWMutex
@@ -31,20 +33,42 @@ type FakeRootFSProvider struct {
 	cleanupRootFSReturns struct {
 		result1 error
 	}
+	VerifyRootFSStub        func(logger lager.Logger, id string, provenance rootfs_provider.Provenance) error
+	verifyRootFSMutex       sync.RWMutex
+	verifyRootFSArgsForCall []struct {
+		logger     lager.Logger
+		id         string
+		provenance rootfs_provider.Provenance
+	}
+	verifyRootFSReturns struct {
+		result1 error
+	}
+	RemountRootFSStub        func(logger lager.Logger, id string, provenance rootfs_provider.Provenance, mountLabel string) error
+	remountRootFSMutex       sync.RWMutex
+	remountRootFSArgsForCall []struct {
+		logger     lager.Logger
+		id         string
+		provenance rootfs_provider.Provenance
+		mountLabel string
+	}
+	remountRootFSReturns struct {
+		result1 error
+	}
 }
 
-func (fake *FakeRootFSProvider) ProvideRootFS(logger lager.Logger, id string, rootfs *url.URL) (mountpoint string, envvar []string, err error) {
+func (fake *FakeRootFSProvider) ProvideRootFS(logger lager.Logger, id string, rootfs *url.URL, mountLabel string) (mountpoint string, envvar []string, provenance rootfs_provider.Provenance, err error) {
 	fake.provideRootFSMutex.Lock()
 	fake.provideRootFSArgsForCall = append(fake.provideRootFSArgsForCall, struct {
-		logger lager.Logger
-		id     string
-		rootfs *url.URL
-	}{logger, id, rootfs})
+		logger     lager.Logger
+		id         string
+		rootfs     *url.URL
+		mountLabel string
+	}{logger, id, rootfs, mountLabel})
 	fake.provideRootFSMutex.Unlock()
 	if fake.ProvideRootFSStub != nil {
-		return fake.ProvideRootFSStub(logger, id, rootfs)
+		return fake.ProvideRootFSStub(logger, id, rootfs, mountLabel)
 	} else {
-		return fake.provideRootFSReturns.result1, fake.provideRootFSReturns.result2, fake.provideRootFSReturns.result3
+		return fake.provideRootFSReturns.result1, fake.provideRootFSReturns.result2, fake.provideRootFSReturns.result3, fake.provideRootFSReturns.result4
 	}
 }
 
@@ -54,19 +78,20 @@ func (fake *FakeRootFSProvider) ProvideRootFSCallCount() int {
 	return len(fake.provideRootFSArgsForCall)
 }
 
-func (fake *FakeRootFSProvider) ProvideRootFSArgsForCall(i int) (lager.Logger, string, *url.URL) {
+func (fake *FakeRootFSProvider) ProvideRootFSArgsForCall(i int) (lager.Logger, string, *url.URL, string) {
 	fake.provideRootFSMutex.RLock()
 	defer fake.provideRootFSMutex.RUnlock()
-	return fake.provideRootFSArgsForCall[i].logger, fake.provideRootFSArgsForCall[i].id, fake.provideRootFSArgsForCall[i].rootfs
+	return fake.provideRootFSArgsForCall[i].logger, fake.provideRootFSArgsForCall[i].id, fake.provideRootFSArgsForCall[i].rootfs, fake.provideRootFSArgsForCall[i].mountLabel
 }
 
-func (fake *FakeRootFSProvider) ProvideRootFSReturns(result1 string, result2 []string, result3 error) {
+func (fake *FakeRootFSProvider) ProvideRootFSReturns(result1 string, result2 []string, result3 rootfs_provider.Provenance, result4 error) {
 	fake.ProvideRootFSStub = nil
 	fake.provideRootFSReturns = struct {
 		result1 string
 		result2 []string
-		result3 error
-	}{result1, result2, result3}
+		result3 rootfs_provider.Provenance
+		result4 error
+	}{result1, result2, result3, result4}
 }
 
 func (fake *FakeRootFSProvider) CleanupRootFS(logger lager.Logger, id string) error {
@@ -102,4 +127,73 @@ func (fake *FakeRootFSProvider) CleanupRootFSReturns(result1 error) {
 	}{result1}
 }
 
+func (fake *FakeRootFSProvider) VerifyRootFS(logger lager.Logger, id string, provenance rootfs_provider.Provenance) error {
+	fake.verifyRootFSMutex.Lock()
+	fake.verifyRootFSArgsForCall = append(fake.verifyRootFSArgsForCall, struct {
+		logger     lager.Logger
+		id         string
+		provenance rootfs_provider.Provenance
+	}{logger, id, provenance})
+	fake.verifyRootFSMutex.Unlock()
+	if fake.VerifyRootFSStub != nil {
+		return fake.VerifyRootFSStub(logger, id, provenance)
+	} else {
+		return fake.verifyRootFSReturns.result1
+	}
+}
+
+func (fake *FakeRootFSProvider) VerifyRootFSCallCount() int {
+	fake.verifyRootFSMutex.RLock()
+	defer fake.verifyRootFSMutex.RUnlock()
+	return len(fake.verifyRootFSArgsForCall)
+}
+
+func (fake *FakeRootFSProvider) VerifyRootFSArgsForCall(i int) (lager.Logger, string, rootfs_provider.Provenance) {
+	fake.verifyRootFSMutex.RLock()
+	defer fake.verifyRootFSMutex.RUnlock()
+	return fake.verifyRootFSArgsForCall[i].logger, fake.verifyRootFSArgsForCall[i].id, fake.verifyRootFSArgsForCall[i].provenance
+}
+
+func (fake *FakeRootFSProvider) VerifyRootFSReturns(result1 error) {
+	fake.VerifyRootFSStub = nil
+	fake.verifyRootFSReturns = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeRootFSProvider) RemountRootFS(logger lager.Logger, id string, provenance rootfs_provider.Provenance, mountLabel string) error {
+	fake.remountRootFSMutex.Lock()
+	fake.remountRootFSArgsForCall = append(fake.remountRootFSArgsForCall, struct {
+		logger     lager.Logger
+		id         string
+		provenance rootfs_provider.Provenance
+		mountLabel string
+	}{logger, id, provenance, mountLabel})
+	fake.remountRootFSMutex.Unlock()
+	if fake.RemountRootFSStub != nil {
+		return fake.RemountRootFSStub(logger, id, provenance, mountLabel)
+	} else {
+		return fake.remountRootFSReturns.result1
+	}
+}
+
+func (fake *FakeRootFSProvider) RemountRootFSCallCount() int {
+	fake.remountRootFSMutex.RLock()
+	defer fake.remountRootFSMutex.RUnlock()
+	return len(fake.remountRootFSArgsForCall)
+}
+
+func (fake *FakeRootFSProvider) RemountRootFSArgsForCall(i int) (lager.Logger, string, rootfs_provider.Provenance, string) {
+	fake.remountRootFSMutex.RLock()
+	defer fake.remountRootFSMutex.RUnlock()
+	return fake.remountRootFSArgsForCall[i].logger, fake.remountRootFSArgsForCall[i].id, fake.remountRootFSArgsForCall[i].provenance, fake.remountRootFSArgsForCall[i].mountLabel
+}
+
+func (fake *FakeRootFSProvider) RemountRootFSReturns(result1 error) {
+	fake.RemountRootFSStub = nil
+	fake.remountRootFSReturns = struct {
+		result1 error
+	}{result1}
+}
+
 var _ rootfs_provider.RootFSProvider = new(FakeRootFSProvider)
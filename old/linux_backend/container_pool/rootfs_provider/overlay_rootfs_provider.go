@@ -2,9 +2,11 @@ package rootfs_provider
 
 import (
 	"net/url"
+	"os"
 	"os/exec"
 	"path"
 
+	"github.com/cloudfoundry-incubator/garden-linux/old/linux_backend/volume_manager"
 	"github.com/cloudfoundry-incubator/garden-linux/old/logging"
 	"github.com/cloudfoundry/gunk/command_runner"
 	"github.com/pivotal-golang/lager"
@@ -14,24 +16,30 @@ type overlayRootFSProvider struct {
 	binPath       string
 	overlaysPath  string
 	defaultRootFS string
-	runner        command_runner.CommandRunner
+
+	// if non-nil, each overlay's writable branch is a volume of its own
+	volumes volume_manager.VolumeManager
+
+	runner command_runner.CommandRunner
 }
 
 func NewOverlay(
 	binPath string,
 	overlaysPath string,
 	defaultRootFS string,
+	volumes volume_manager.VolumeManager,
 	runner command_runner.CommandRunner,
 ) RootFSProvider {
 	return &overlayRootFSProvider{
 		binPath:       binPath,
 		overlaysPath:  overlaysPath,
 		defaultRootFS: defaultRootFS,
+		volumes:       volumes,
 		runner:        runner,
 	}
 }
 
-func (provider *overlayRootFSProvider) ProvideRootFS(logger lager.Logger, id string, rootfs *url.URL) (string, []string, error) {
+func (provider *overlayRootFSProvider) ProvideRootFS(logger lager.Logger, id string, rootfs *url.URL, mountLabel string) (string, []string, Provenance, error) {
 	rootFSPath := provider.defaultRootFS
 	if rootfs.Path != "" {
 		rootFSPath = rootfs.Path
@@ -42,17 +50,31 @@ func (provider *overlayRootFSProvider) ProvideRootFS(logger lager.Logger, id str
 		Logger:        logger,
 	}
 
+	if provider.volumes != nil {
+		err := provider.volumes.Create(logger, id, path.Join(provider.overlaysPath, id, "overlay"))
+		if err != nil {
+			return "", nil, Provenance{}, err
+		}
+	}
+
 	createOverlay := exec.Command(
 		path.Join(provider.binPath, "overlay.sh"),
-		"create", path.Join(provider.overlaysPath, id), rootFSPath,
+		withMountLabel([]string{"create", path.Join(provider.overlaysPath, id), rootFSPath}, mountLabel)...,
 	)
 
 	err := pRunner.Run(createOverlay)
 	if err != nil {
-		return "", nil, err
+		// the pool only cleans up rootfses it was given, so what overlay.sh
+		// mounted before failing, and the volume, are undone here
+		cleanupErr := provider.CleanupRootFS(logger, id)
+		if cleanupErr != nil {
+			logger.Error("failed-to-clean-up-failed-overlay", cleanupErr)
+		}
+
+		return "", nil, Provenance{}, err
 	}
 
-	return path.Join(provider.overlaysPath, id, "rootfs"), nil, nil
+	return path.Join(provider.overlaysPath, id, "rootfs"), nil, Provenance{Image: rootFSPath}, nil
 }
 
 func (provider *overlayRootFSProvider) CleanupRootFS(logger lager.Logger, id string) error {
@@ -66,5 +88,70 @@ func (provider *overlayRootFSProvider) CleanupRootFS(logger lager.Logger, id str
 		"cleanup", path.Join(provider.overlaysPath, id),
 	)
 
-	return pRunner.Run(destroyOverlay)
+	// overlay.sh unmounts the volume along with the rootfs
+	err := pRunner.Run(destroyOverlay)
+	if err != nil {
+		return err
+	}
+
+	if provider.volumes != nil {
+		return provider.volumes.Destroy(logger, id)
+	}
+
+	return nil
+}
+
+// VerifyRootFS checks that the container's overlay still has its writable
+// branch and that the rootfs it was created from is still there.
+func (provider *overlayRootFSProvider) VerifyRootFS(logger lager.Logger, id string, provenance Provenance) error {
+	overlayPath := path.Join(provider.overlaysPath, id, "overlay")
+
+	_, err := os.Stat(overlayPath)
+	if err != nil {
+		return MissingRootFSError{"overlay branch " + overlayPath}
+	}
+
+	// snapshots predating provenance do not record the base
+	if provenance.Image != "" {
+		_, err = os.Stat(provenance.Image)
+		if err != nil {
+			return MissingRootFSError{"base rootfs " + provenance.Image}
+		}
+	}
+
+	return nil
+}
+
+// RemountRootFS mounts the container's overlay branch over its base again,
+// unless its rootfs is still mounted. Without a recorded base, as with
+// snapshots predating provenance, a lost mount cannot be re-assembled.
+func (provider *overlayRootFSProvider) RemountRootFS(logger lager.Logger, id string, provenance Provenance, mountLabel string) error {
+	pRunner := logging.Runner{
+		CommandRunner: provider.runner,
+		Logger:        logger,
+	}
+
+	if provider.volumes != nil {
+		err := provider.volumes.Mount(logger, id, path.Join(provider.overlaysPath, id, "overlay"))
+		if err != nil {
+			return err
+		}
+	}
+
+	remountOverlay := exec.Command(
+		path.Join(provider.binPath, "overlay.sh"),
+		withMountLabel([]string{"remount", path.Join(provider.overlaysPath, id), provenance.Image}, mountLabel)...,
+	)
+
+	return pRunner.Run(remountOverlay)
+}
+
+// withMountLabel passes overlay.sh the mount label, if any, as its last
+// argument.
+func withMountLabel(args []string, mountLabel string) []string {
+	if mountLabel == "" {
+		return args
+	}
+
+	return append(args, mountLabel)
 }
@@ -2,7 +2,10 @@ package rootfs_provider_test
 
 import (
 	"errors"
+	"io/ioutil"
+	"os"
 	"os/exec"
+	"path"
 
 	"github.com/cloudfoundry/gunk/command_runner/fake_command_runner"
 	. "github.com/cloudfoundry/gunk/command_runner/fake_command_runner/matchers"
@@ -11,6 +14,7 @@ import (
 	"github.com/pivotal-golang/lager/lagertest"
 
 	. "github.com/cloudfoundry-incubator/garden-linux/old/linux_backend/container_pool/rootfs_provider"
+	"github.com/cloudfoundry-incubator/garden-linux/old/linux_backend/volume_manager/fake_volume_manager"
 )
 
 var _ = Describe("OverlayRootfsProvider", func() {
@@ -25,7 +29,7 @@ var _ = Describe("OverlayRootfsProvider", func() {
 	BeforeEach(func() {
 		fakeRunner = fake_command_runner.New()
 
-		provider = NewOverlay("/some/bin/path", "/some/overlays/path", "/some/default/rootfs", fakeRunner)
+		provider = NewOverlay("/some/bin/path", "/some/overlays/path", "/some/default/rootfs", nil, fakeRunner)
 
 		logger = lagertest.NewTestLogger("test")
 	})
@@ -33,9 +37,10 @@ var _ = Describe("OverlayRootfsProvider", func() {
 	Describe("ProvideRootFS", func() {
 		Context("with no path given", func() {
 			It("executes overlay.sh create with the default rootfs", func() {
-				rootfs, _, err := provider.ProvideRootFS(logger, "some-id", parseURL(""))
+				rootfs, _, provenance, err := provider.ProvideRootFS(logger, "some-id", parseURL(""), "")
 				Ω(err).ShouldNot(HaveOccurred())
 				Ω(rootfs).Should(Equal("/some/overlays/path/some-id/rootfs"))
+				Ω(provenance).Should(Equal(Provenance{Image: "/some/default/rootfs"}))
 
 				Ω(fakeRunner).Should(HaveExecutedSerially(
 					fake_command_runner.CommandSpec{
@@ -49,9 +54,10 @@ var _ = Describe("OverlayRootfsProvider", func() {
 
 		Context("with a path given", func() {
 			It("executes overlay.sh create with the given rootfs", func() {
-				rootfs, _, err := provider.ProvideRootFS(logger, "some-id", parseURL("/some/given/rootfs"))
+				rootfs, _, provenance, err := provider.ProvideRootFS(logger, "some-id", parseURL("/some/given/rootfs"), "")
 				Ω(err).ShouldNot(HaveOccurred())
 				Ω(rootfs).Should(Equal("/some/overlays/path/some-id/rootfs"))
+				Ω(provenance).Should(Equal(Provenance{Image: "/some/given/rootfs"}))
 
 				Ω(fakeRunner).Should(HaveExecutedSerially(
 					fake_command_runner.CommandSpec{
@@ -62,6 +68,20 @@ var _ = Describe("OverlayRootfsProvider", func() {
 			})
 		})
 
+		Context("with a mount label", func() {
+			It("executes overlay.sh create with the label", func() {
+				_, _, _, err := provider.ProvideRootFS(logger, "some-id", parseURL("/some/given/rootfs"), "some:mount:label:s0:c1,c2")
+				Ω(err).ShouldNot(HaveOccurred())
+
+				Ω(fakeRunner).Should(HaveExecutedSerially(
+					fake_command_runner.CommandSpec{
+						Path: "/some/bin/path/overlay.sh",
+						Args: []string{"create", "/some/overlays/path/some-id", "/some/given/rootfs", "some:mount:label:s0:c1,c2"},
+					},
+				))
+			})
+		})
+
 		Context("when overlay.sh fails", func() {
 			disaster := errors.New("oh no!")
 
@@ -78,9 +98,24 @@ var _ = Describe("OverlayRootfsProvider", func() {
 			})
 
 			It("returns the error", func() {
-				_, _, err := provider.ProvideRootFS(logger, "some-id", parseURL("/some/given/rootfs"))
+				_, _, _, err := provider.ProvideRootFS(logger, "some-id", parseURL("/some/given/rootfs"), "")
 				Ω(err).Should(Equal(disaster))
 			})
+
+			It("cleans up what overlay.sh mounted before failing", func() {
+				provider.ProvideRootFS(logger, "some-id", parseURL("/some/given/rootfs"), "")
+
+				Ω(fakeRunner).Should(HaveExecutedSerially(
+					fake_command_runner.CommandSpec{
+						Path: "/some/bin/path/overlay.sh",
+						Args: []string{"create", "/some/overlays/path/some-id", "/some/given/rootfs"},
+					},
+					fake_command_runner.CommandSpec{
+						Path: "/some/bin/path/overlay.sh",
+						Args: []string{"cleanup", "/some/overlays/path/some-id"},
+					},
+				))
+			})
 		})
 	})
 
@@ -119,4 +154,247 @@ var _ = Describe("OverlayRootfsProvider", func() {
 			})
 		})
 	})
+
+	Describe("VerifyRootFS", func() {
+		var overlaysPath string
+		var baseRootFS string
+
+		BeforeEach(func() {
+			var err error
+
+			overlaysPath, err = ioutil.TempDir("", "overlays")
+			Ω(err).ShouldNot(HaveOccurred())
+
+			baseRootFS, err = ioutil.TempDir("", "base-rootfs")
+			Ω(err).ShouldNot(HaveOccurred())
+
+			err = os.MkdirAll(path.Join(overlaysPath, "some-id", "overlay"), 0755)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			provider = NewOverlay("/some/bin/path", overlaysPath, "/some/default/rootfs", nil, fakeRunner)
+		})
+
+		AfterEach(func() {
+			os.RemoveAll(overlaysPath)
+			os.RemoveAll(baseRootFS)
+		})
+
+		It("succeeds when the overlay branch and base are intact", func() {
+			err := provider.VerifyRootFS(logger, "some-id", Provenance{Image: baseRootFS})
+			Ω(err).ShouldNot(HaveOccurred())
+		})
+
+		It("does not check the base when it was not recorded", func() {
+			err := provider.VerifyRootFS(logger, "some-id", Provenance{})
+			Ω(err).ShouldNot(HaveOccurred())
+		})
+
+		Context("when the overlay branch is gone", func() {
+			It("returns an error naming it", func() {
+				err := os.RemoveAll(path.Join(overlaysPath, "some-id", "overlay"))
+				Ω(err).ShouldNot(HaveOccurred())
+
+				err = provider.VerifyRootFS(logger, "some-id", Provenance{Image: baseRootFS})
+				Ω(err).Should(Equal(MissingRootFSError{"overlay branch " + path.Join(overlaysPath, "some-id", "overlay")}))
+			})
+		})
+
+		Context("when the base rootfs is gone", func() {
+			It("returns an error naming it", func() {
+				err := os.RemoveAll(baseRootFS)
+				Ω(err).ShouldNot(HaveOccurred())
+
+				err = provider.VerifyRootFS(logger, "some-id", Provenance{Image: baseRootFS})
+				Ω(err).Should(Equal(MissingRootFSError{"base rootfs " + baseRootFS}))
+			})
+		})
+	})
+
+	Describe("RemountRootFS", func() {
+		It("executes overlay.sh remount for the id's path and its base", func() {
+			err := provider.RemountRootFS(logger, "some-id", Provenance{Image: "/some/base/rootfs"}, "")
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(fakeRunner).Should(HaveExecutedSerially(
+				fake_command_runner.CommandSpec{
+					Path: "/some/bin/path/overlay.sh",
+					Args: []string{"remount", "/some/overlays/path/some-id", "/some/base/rootfs"},
+				},
+			))
+		})
+
+		It("executes overlay.sh remount with the mount label, if any", func() {
+			err := provider.RemountRootFS(logger, "some-id", Provenance{Image: "/some/base/rootfs"}, "some:mount:label:s0:c1,c2")
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(fakeRunner).Should(HaveExecutedSerially(
+				fake_command_runner.CommandSpec{
+					Path: "/some/bin/path/overlay.sh",
+					Args: []string{"remount", "/some/overlays/path/some-id", "/some/base/rootfs", "some:mount:label:s0:c1,c2"},
+				},
+			))
+		})
+
+		Context("when overlay.sh fails", func() {
+			nastyError := errors.New("oh no!")
+
+			BeforeEach(func() {
+				fakeRunner.WhenRunning(
+					fake_command_runner.CommandSpec{
+						Path: "/some/bin/path/overlay.sh",
+					}, func(*exec.Cmd) error {
+						return nastyError
+					},
+				)
+			})
+
+			It("returns the error", func() {
+				err := provider.RemountRootFS(logger, "some-id", Provenance{Image: "/some/base/rootfs"}, "")
+				Ω(err).Should(Equal(nastyError))
+			})
+		})
+	})
+
+	Context("with a volume per container", func() {
+		var fakeVolumeManager *fake_volume_manager.FakeVolumeManager
+
+		BeforeEach(func() {
+			fakeVolumeManager = fake_volume_manager.New()
+
+			provider = NewOverlay("/some/bin/path", "/some/overlays/path", "/some/default/rootfs", fakeVolumeManager, fakeRunner)
+		})
+
+		It("creates the overlay's writable branch on a new volume", func() {
+			fakeRunner.WhenRunning(
+				fake_command_runner.CommandSpec{
+					Path: "/some/bin/path/overlay.sh",
+				}, func(*exec.Cmd) error {
+					Ω(fakeVolumeManager.Created).Should(HaveKeyWithValue("some-id", "/some/overlays/path/some-id/overlay"))
+					return nil
+				},
+			)
+
+			_, _, _, err := provider.ProvideRootFS(logger, "some-id", parseURL("/some/given/rootfs"), "")
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(fakeVolumeManager.Created).Should(HaveLen(1))
+		})
+
+		Context("when creating the volume fails", func() {
+			disaster := errors.New("oh no!")
+
+			BeforeEach(func() {
+				fakeVolumeManager.CreateError = disaster
+			})
+
+			It("returns the error, without creating the overlay", func() {
+				_, _, _, err := provider.ProvideRootFS(logger, "some-id", parseURL("/some/given/rootfs"), "")
+				Ω(err).Should(Equal(disaster))
+
+				Ω(fakeRunner).ShouldNot(HaveExecutedSerially(
+					fake_command_runner.CommandSpec{
+						Path: "/some/bin/path/overlay.sh",
+					},
+				))
+			})
+		})
+
+		Context("when creating the overlay fails", func() {
+			disaster := errors.New("oh no!")
+
+			BeforeEach(func() {
+				fakeRunner.WhenRunning(
+					fake_command_runner.CommandSpec{
+						Path: "/some/bin/path/overlay.sh",
+						Args: []string{"create", "/some/overlays/path/some-id", "/some/given/rootfs"},
+					}, func(*exec.Cmd) error {
+						return disaster
+					},
+				)
+			})
+
+			It("unmounts the volume with the overlay, then destroys it", func() {
+				_, _, _, err := provider.ProvideRootFS(logger, "some-id", parseURL("/some/given/rootfs"), "")
+				Ω(err).Should(Equal(disaster))
+
+				Ω(fakeRunner).Should(HaveExecutedSerially(
+					fake_command_runner.CommandSpec{
+						Path: "/some/bin/path/overlay.sh",
+						Args: []string{"cleanup", "/some/overlays/path/some-id"},
+					},
+				))
+
+				Ω(fakeVolumeManager.Destroyed).Should(Equal([]string{"some-id"}))
+			})
+
+			Context("and unmounting it fails", func() {
+				BeforeEach(func() {
+					fakeRunner.WhenRunning(
+						fake_command_runner.CommandSpec{
+							Path: "/some/bin/path/overlay.sh",
+							Args: []string{"cleanup", "/some/overlays/path/some-id"},
+						}, func(*exec.Cmd) error {
+							return errors.New("busy")
+						},
+					)
+				})
+
+				It("keeps the volume, returning the original error", func() {
+					_, _, _, err := provider.ProvideRootFS(logger, "some-id", parseURL("/some/given/rootfs"), "")
+					Ω(err).Should(Equal(disaster))
+
+					Ω(fakeVolumeManager.Destroyed).Should(BeEmpty())
+				})
+			})
+		})
+
+		It("destroys the volume once the overlay is cleaned up", func() {
+			err := provider.CleanupRootFS(logger, "some-id")
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(fakeRunner).Should(HaveExecutedSerially(
+				fake_command_runner.CommandSpec{
+					Path: "/some/bin/path/overlay.sh",
+					Args: []string{"cleanup", "/some/overlays/path/some-id"},
+				},
+			))
+
+			Ω(fakeVolumeManager.Destroyed).Should(Equal([]string{"some-id"}))
+		})
+
+		Context("when cleaning up the overlay fails", func() {
+			BeforeEach(func() {
+				fakeRunner.WhenRunning(
+					fake_command_runner.CommandSpec{
+						Path: "/some/bin/path/overlay.sh",
+					}, func(*exec.Cmd) error {
+						return errors.New("oh no!")
+					},
+				)
+			})
+
+			It("keeps the volume", func() {
+				err := provider.CleanupRootFS(logger, "some-id")
+				Ω(err).Should(HaveOccurred())
+
+				Ω(fakeVolumeManager.Destroyed).Should(BeEmpty())
+			})
+		})
+
+		It("mounts the volume again before remounting the overlay", func() {
+			fakeRunner.WhenRunning(
+				fake_command_runner.CommandSpec{
+					Path: "/some/bin/path/overlay.sh",
+				}, func(*exec.Cmd) error {
+					Ω(fakeVolumeManager.Mounted).Should(HaveKeyWithValue("some-id", "/some/overlays/path/some-id/overlay"))
+					return nil
+				},
+			)
+
+			err := provider.RemountRootFS(logger, "some-id", Provenance{Image: "/some/base/rootfs"}, "")
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(fakeVolumeManager.Mounted).Should(HaveLen(1))
+		})
+	})
 })
@@ -6,7 +6,46 @@ import (
 	"github.com/pivotal-golang/lager"
 )
 
+// RootFSProviders mount rootfses with the SELinux mount label they are
+// given, if any, so that every file in them is labelled with it.
 type RootFSProvider interface {
-	ProvideRootFS(logger lager.Logger, id string, rootfs *url.URL) (mountpoint string, envvar []string, err error)
+	ProvideRootFS(logger lager.Logger, id string, rootfs *url.URL, mountLabel string) (mountpoint string, envvar []string, provenance Provenance, err error)
 	CleanupRootFS(logger lager.Logger, id string) error
+
+	// VerifyRootFS checks that what a rootfs provided before a restart is
+	// made of is still there, so that a restored container whose rootfs is
+	// not can be marked broken rather than failing on its first run.
+	VerifyRootFS(logger lager.Logger, id string, provenance Provenance) error
+
+	// RemountRootFS re-assembles the mounts of a verified rootfs, which are
+	// lost when the host reboots; mounts that are still in place are left
+	// alone.
+	RemountRootFS(logger lager.Logger, id string, provenance Provenance, mountLabel string) error
+}
+
+// UnlabelledRootFSError is returned by providers that cannot label the
+// rootfses they provide with a mount label. Processes given the container's
+// SELinux label could not exec anything in them.
+type UnlabelledRootFSError struct {
+	Provider string
+}
+
+func (e UnlabelledRootFSError) Error() string {
+	return "rootfses from the " + e.Provider + " provider cannot be labelled for SELinux"
+}
+
+type MissingRootFSError struct {
+	Missing string
+}
+
+func (e MissingRootFSError) Error() string {
+	return "rootfs is no longer intact: missing " + e.Missing
+}
+
+// Provenance records what a provided rootfs was created from. ImageID and
+// Layers are only known for images from a graph.
+type Provenance struct {
+	Image   string
+	ImageID string
+	Layers  []string
 }
@@ -0,0 +1,153 @@
+package container_pool
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cloudfoundry-incubator/garden/api"
+
+	"github.com/cloudfoundry-incubator/garden-linux/old/linux_backend"
+	"github.com/cloudfoundry-incubator/garden-linux/old/linux_backend/env"
+	"github.com/cloudfoundry-incubator/garden-linux/old/linux_backend/network"
+)
+
+// InvalidSpecError is returned by Create for a field of the spec that would
+// otherwise only fail once the container's resources were acquired, or
+// not at all.
+type InvalidSpecError struct {
+	// e.g. BindMounts[1].DstPath or Properties[lifecycle.shutdown_hook_timeout]
+	Field  string
+	Value  string
+	Reason string
+}
+
+func (e InvalidSpecError) Error() string {
+	return fmt.Sprintf("invalid %s %q: %s", e.Field, e.Value, e.Reason)
+}
+
+// bind mount paths are written into a shell script run in the container
+const shellMetacharacters = " \t\n\"'`$\\;&|<>(){}[]*?#~!"
+
+// validateSpec checks everything in the spec that can be checked without
+// acquiring anything for the container.
+func validateSpec(spec api.ContainerSpec) error {
+	if spec.GraceTime < 0 {
+		return InvalidSpecError{"GraceTime", spec.GraceTime.String(), "must not be negative"}
+	}
+
+	_, err := url.Parse(spec.RootFSPath)
+	if err != nil {
+		return InvalidSpecError{"RootFSPath", spec.RootFSPath, "must be a URL"}
+	}
+
+	_, err = network.ParseSpec(spec.Network)
+	if err != nil {
+		return InvalidSpecError{"Network", spec.Network, err.Error()}
+	}
+
+	for i, bindMount := range spec.BindMounts {
+		err := validateBindMount(fmt.Sprintf("BindMounts[%d]", i), bindMount)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = env.Validate(spec.Env)
+	if err != nil {
+		return err
+	}
+
+	return validateProperties(spec.Properties)
+}
+
+func validateBindMount(field string, bindMount api.BindMount) error {
+	err := validateMountPath(field+".SrcPath", bindMount.SrcPath)
+	if err != nil {
+		return err
+	}
+
+	err = validateMountPath(field+".DstPath", bindMount.DstPath)
+	if err != nil {
+		return err
+	}
+
+	if bindMount.Mode != api.BindMountModeRO && bindMount.Mode != api.BindMountModeRW {
+		return InvalidSpecError{field + ".Mode", strconv.Itoa(int(bindMount.Mode)), "must be read-only or read-write"}
+	}
+
+	if bindMount.Origin != api.BindMountOriginHost && bindMount.Origin != api.BindMountOriginContainer {
+		return InvalidSpecError{field + ".Origin", strconv.Itoa(int(bindMount.Origin)), "must be the host or the container"}
+	}
+
+	return nil
+}
+
+// validateMountPath rejects paths that would not stay within the rootfs
+// they are joined to, or that the hook script would not run as given.
+func validateMountPath(field, mountPath string) error {
+	if !path.IsAbs(mountPath) {
+		return InvalidSpecError{field, mountPath, "must be absolute"}
+	}
+
+	for _, segment := range strings.Split(mountPath, "/") {
+		if segment == ".." {
+			return InvalidSpecError{field, mountPath, "must not contain .."}
+		}
+	}
+
+	if strings.ContainsAny(mountPath, shellMetacharacters) {
+		return InvalidSpecError{field, mountPath, "must not contain whitespace or shell metacharacters"}
+	}
+
+	return nil
+}
+
+func validateProperties(properties api.Properties) error {
+	for name, value := range properties {
+		if strings.HasPrefix(name, linux_backend.AnnotationPropertyPrefix) {
+			return ReservedPropertyError{name}
+		}
+
+		if strings.HasPrefix(name, linux_backend.HugePagesPropertyPrefix) && strings.HasSuffix(name, ".limit_in_bytes") {
+			_, err := strconv.ParseUint(value, 10, 64)
+			if err != nil {
+				return linux_backend.InvalidHugePagesPropertyError{Property: name, Value: value}
+			}
+		}
+	}
+
+	if requested, found := properties[linux_backend.ExternalIPProperty]; found {
+		if net.ParseIP(requested) == nil {
+			return InvalidExternalIPError{requested}
+		}
+	}
+
+	if value, found := properties[linux_backend.ShutdownHookTimeoutProperty]; found {
+		timeout, err := time.ParseDuration(value)
+		if err != nil || timeout < 0 {
+			return InvalidSpecError{
+				Field:  "Properties[" + linux_backend.ShutdownHookTimeoutProperty + "]",
+				Value:  value,
+				Reason: "must be a non-negative duration",
+			}
+		}
+	}
+
+	devices, err := parseOptionalDevices(properties)
+	if err != nil {
+		return err
+	}
+
+	_, err = parseSecurityOptions(properties, devices, securityOptions{})
+	if err != nil {
+		return err
+	}
+
+	_, err = parseDNSOptions(properties, dnsOptions{})
+	return err
+}
@@ -0,0 +1,243 @@
+package linux_backend
+
+import (
+	"sync"
+
+	"github.com/cloudfoundry-incubator/garden/api"
+)
+
+// containerRegistry holds the backend's containers, indexed by handle, ID,
+// property and image, so that lookups and filters do not scan every
+// container. Containers' properties and rootfs provenance never change, so
+// they are indexed once, on registration.
+type containerRegistry struct {
+	mutex sync.RWMutex
+
+	byHandle    map[string]Container
+	handlesByID map[string]string
+
+	// property key -> value -> handle
+	byProperty map[string]map[string]map[string]Container
+
+	// image name, image ID or layer -> handle
+	byImage map[string]map[string]Container
+
+	// handles of containers still being created
+	reserved map[string]bool
+}
+
+func newContainerRegistry() *containerRegistry {
+	return &containerRegistry{
+		byHandle:    map[string]Container{},
+		handlesByID: map[string]string{},
+
+		byProperty: map[string]map[string]map[string]Container{},
+		byImage:    map[string]map[string]Container{},
+
+		reserved: map[string]bool{},
+	}
+}
+
+// reserve claims a handle for a container being created, so that concurrent
+// creates cannot both take it.
+func (r *containerRegistry) reserve(handle string) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	_, exists := r.byHandle[handle]
+	if exists || r.reserved[handle] {
+		return HandleExistsError{Handle: handle}
+	}
+
+	r.reserved[handle] = true
+
+	return nil
+}
+
+func (r *containerRegistry) unreserve(handle string) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	delete(r.reserved, handle)
+}
+
+func (r *containerRegistry) register(container Container) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	handle := container.Handle()
+
+	if existing, found := r.byHandle[handle]; found {
+		r.removeIndexes(existing)
+	}
+
+	r.byHandle[handle] = container
+	r.handlesByID[container.ID()] = handle
+
+	for key, value := range container.Properties() {
+		values, found := r.byProperty[key]
+		if !found {
+			values = map[string]map[string]Container{}
+			r.byProperty[key] = values
+		}
+
+		addToIndex(values, value, handle, container)
+	}
+
+	for _, image := range containerImages(container) {
+		addToIndex(r.byImage, image, handle, container)
+	}
+}
+
+func (r *containerRegistry) unregister(container Container) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	// a container registered since under the same handle stays
+	if r.byHandle[container.Handle()] != container {
+		return
+	}
+
+	r.removeIndexes(container)
+}
+
+func (r *containerRegistry) lookup(handle string) (Container, bool) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	container, found := r.byHandle[handle]
+	return container, found
+}
+
+func (r *containerRegistry) lookupByID(id string) (Container, bool) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	handle, found := r.handlesByID[id]
+	if !found {
+		return nil, false
+	}
+
+	return r.byHandle[handle], true
+}
+
+// all returns the registered containers, so that they can be worked on
+// without holding the registry's lock.
+func (r *containerRegistry) all() []Container {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	containers := make([]Container, 0, len(r.byHandle))
+	for _, container := range r.byHandle {
+		containers = append(containers, container)
+	}
+
+	return containers
+}
+
+// withProperties returns the containers that have all of the properties,
+// starting from the property shared by the fewest containers.
+func (r *containerRegistry) withProperties(properties api.Properties) []Container {
+	if len(properties) == 0 {
+		return r.all()
+	}
+
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	var candidates map[string]Container
+
+	for key, value := range properties {
+		matching := r.byProperty[key][value]
+		if len(matching) == 0 {
+			return []Container{}
+		}
+
+		if candidates == nil || len(matching) < len(candidates) {
+			candidates = matching
+		}
+	}
+
+	containers := []Container{}
+	for _, container := range candidates {
+		if containerHasProperties(container, properties) {
+			containers = append(containers, container)
+		}
+	}
+
+	return containers
+}
+
+func (r *containerRegistry) fromImage(image string) []Container {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	containers := []Container{}
+	for _, container := range r.byImage[image] {
+		containers = append(containers, container)
+	}
+
+	return containers
+}
+
+// removeIndexes must be called with the registry locked.
+func (r *containerRegistry) removeIndexes(container Container) {
+	handle := container.Handle()
+
+	delete(r.byHandle, handle)
+
+	if r.handlesByID[container.ID()] == handle {
+		delete(r.handlesByID, container.ID())
+	}
+
+	for key, value := range container.Properties() {
+		removeFromIndex(r.byProperty[key], value, handle)
+
+		if len(r.byProperty[key]) == 0 {
+			delete(r.byProperty, key)
+		}
+	}
+
+	for _, image := range containerImages(container) {
+		removeFromIndex(r.byImage, image, handle)
+	}
+}
+
+func addToIndex(index map[string]map[string]Container, key, handle string, container Container) {
+	containers, found := index[key]
+	if !found {
+		containers = map[string]Container{}
+		index[key] = containers
+	}
+
+	containers[handle] = container
+}
+
+func removeFromIndex(index map[string]map[string]Container, key, handle string) {
+	delete(index[key], handle)
+
+	if len(index[key]) == 0 {
+		delete(index, key)
+	}
+}
+
+// containerImages are the names a container can be found from with
+// ContainersFromImage: its image as requested, its image ID, and every
+// layer in its chain.
+func containerImages(container Container) []string {
+	provenance := container.RootFSProvenance()
+
+	images := []string{}
+
+	if provenance.Image != "" {
+		images = append(images, provenance.Image)
+	}
+
+	if provenance.ImageID != "" {
+		images = append(images, provenance.ImageID)
+	}
+
+	images = append(images, provenance.Layers...)
+
+	return images
+}
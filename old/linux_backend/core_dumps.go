@@ -0,0 +1,157 @@
+package linux_backend
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/pivotal-golang/lager"
+)
+
+// CoreDumpsPath is where, in the container, the core dumps of its processes
+// can be streamed out from. They are kept in the container's depot directory
+// by the host's core handler, bin/core.sh.
+const CoreDumpsPath = "/var/garden/cores"
+
+// CoreDumpsPathProperty reports CoreDumpsPath in Info.
+const CoreDumpsPathProperty = "core_dumps.path"
+
+const coreDumpedEventPrefix = "core dumped: "
+
+// the kernel truncates longer core patterns
+const maxCorePatternLength = 127
+
+type CorePatternTooLongError struct {
+	Pattern string
+}
+
+func (e CorePatternTooLongError) Error() string {
+	return fmt.Sprintf("core pattern is longer than %d bytes: %s", maxCorePatternLength, e.Pattern)
+}
+
+// the kernel's own, for when the pattern replaced by an earlier server was
+// not saved
+const defaultCorePattern = "core"
+
+// the pattern EnableCoreDumps replaced is saved in the host cores directory,
+// so that it is not lost if the server exits without restoring it
+const savedCorePatternName = ".core_pattern"
+
+// EnableCoreDumps sets the host's core pattern, at corePatternPath (usually
+// /proc/sys/kernel/core_pattern), to pipe cores to the core handler in
+// binPath, which keeps those of container processes, truncated to maxBytes,
+// in their container's depot directory, up to maxCount per container, and
+// those of host processes in hostCoresPath, with the same caps.
+//
+// It returns the pattern it replaced, for RestoreCorePattern, and saves it
+// in hostCoresPath. When the handler is already installed, by a server that
+// exited without restoring the pattern, the saved one is returned instead.
+func EnableCoreDumps(corePatternPath, binPath, depotPath, hostCoresPath string, maxBytes uint64, maxCount uint) (string, error) {
+	handler := path.Join(binPath, "core.sh")
+
+	pattern := fmt.Sprintf("|%s %s %d %d %s %%P %%u %%g %%t %%e", handler, depotPath, maxBytes, maxCount, hostCoresPath)
+	if len(pattern) > maxCorePatternLength {
+		return "", CorePatternTooLongError{pattern}
+	}
+
+	err := os.MkdirAll(hostCoresPath, 0700)
+	if err != nil {
+		return "", err
+	}
+
+	current, err := ioutil.ReadFile(corePatternPath)
+	if err != nil && !os.IsNotExist(err) {
+		return "", err
+	}
+
+	previous := strings.TrimSpace(string(current))
+	savedPath := path.Join(hostCoresPath, savedCorePatternName)
+
+	if strings.HasPrefix(previous, "|"+handler+" ") {
+		saved, err := ioutil.ReadFile(savedPath)
+		if err != nil && !os.IsNotExist(err) {
+			return "", err
+		}
+
+		previous = strings.TrimSpace(string(saved))
+		if previous == "" {
+			previous = defaultCorePattern
+		}
+	} else {
+		err = ioutil.WriteFile(savedPath, []byte(previous), 0600)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	err = ioutil.WriteFile(corePatternPath, []byte(pattern), 0644)
+	if err != nil {
+		return "", err
+	}
+
+	return previous, nil
+}
+
+// RestoreCorePattern puts back the host's core pattern as it was before
+// EnableCoreDumps, so that cores are not piped to a handler that is no longer
+// looking after them, and removes the saved copy.
+func RestoreCorePattern(corePatternPath, hostCoresPath, previous string) error {
+	err := ioutil.WriteFile(corePatternPath, []byte(previous), 0644)
+	if err != nil {
+		return err
+	}
+
+	err = os.Remove(path.Join(hostCoresPath, savedCorePatternName))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	return nil
+}
+
+// CheckCoreDumps registers a "core dumped" event, naming the core's path in
+// the container, for each core dump kept since the last check.
+func (c *LinuxContainer) CheckCoreDumps() error {
+	entries, err := ioutil.ReadDir(c.coreDumpsDir())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+
+		return err
+	}
+
+	reported := map[string]bool{}
+	for _, event := range c.Events() {
+		if strings.HasPrefix(event, coreDumpedEventPrefix) {
+			reported[strings.TrimPrefix(event, coreDumpedEventPrefix)] = true
+		}
+	}
+
+	for _, entry := range entries {
+		// still being written
+		if strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+
+		core := path.Join(CoreDumpsPath, entry.Name())
+		if reported[core] {
+			continue
+		}
+
+		c.logger.Info("core-dumped", lager.Data{
+			"core": core,
+			"size": entry.Size(),
+		})
+
+		c.registerEvent(coreDumpedEventPrefix + core)
+	}
+
+	return nil
+}
+
+func (c *LinuxContainer) coreDumpsDir() string {
+	return path.Join(c.path, "cores")
+}
@@ -0,0 +1,107 @@
+package env
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+type MalformedEnvironmentVariableError struct {
+	Var string
+}
+
+func (e MalformedEnvironmentVariableError) Error() string {
+	return fmt.Sprintf("malformed environment variable (must be KEY=VALUE): %q", e.Var)
+}
+
+type InvalidEnvironmentVariableNameError struct {
+	Name string
+}
+
+func (e InvalidEnvironmentVariableNameError) Error() string {
+	return fmt.Sprintf("invalid environment variable name (must be letters, digits and underscores, not starting with a digit): %q", e.Name)
+}
+
+// names are exported to login shells by Exports, so must be names to the
+// shell, and nothing more
+var validName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// Validate returns an error for the first variable that is not of the form
+// KEY=VALUE with KEY a shell variable name.
+func Validate(vars []string) error {
+	for _, v := range vars {
+		key, _, err := split(v)
+		if err != nil {
+			return err
+		}
+
+		if !validName.MatchString(key) {
+			return InvalidEnvironmentVariableNameError{key}
+		}
+	}
+
+	return nil
+}
+
+// Merge combines layers of environment variables, lowest precedence first.
+//
+// The backend layers them as: image < container spec < process spec, with
+// wshd's own defaults (HOME, USER, PATH) beneath all of them.
+//
+// A variable set in a later layer replaces the value from an earlier one but
+// keeps the position at which it first appeared, so that the result is
+// deterministic.
+func Merge(layers ...[]string) ([]string, error) {
+	keys := []string{}
+	values := map[string]string{}
+
+	for _, layer := range layers {
+		for _, v := range layer {
+			key, value, err := split(v)
+			if err != nil {
+				return nil, err
+			}
+
+			if _, seen := values[key]; !seen {
+				keys = append(keys, key)
+			}
+
+			values[key] = value
+		}
+	}
+
+	merged := make([]string, len(keys))
+	for i, key := range keys {
+		merged[i] = key + "=" + values[key]
+	}
+
+	return merged, nil
+}
+
+func split(v string) (string, string, error) {
+	segs := strings.SplitN(v, "=", 2)
+	if len(segs) != 2 || segs[0] == "" {
+		return "", "", MalformedEnvironmentVariableError{v}
+	}
+
+	return segs[0], segs[1], nil
+}
+
+// Exports renders variables as a shell script of export statements, suitable
+// for sourcing from a login shell. Variables whose names are not shell
+// variable names, as from images or containers predating validation, are
+// left out.
+func Exports(vars []string) string {
+	script := ""
+
+	for _, v := range vars {
+		key, value, err := split(v)
+		if err != nil || !validName.MatchString(key) {
+			continue
+		}
+
+		script += "export " + key + "='" + strings.Replace(value, "'", `'"'"'`, -1) + "'\n"
+	}
+
+	return script
+}
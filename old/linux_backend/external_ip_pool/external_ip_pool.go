@@ -0,0 +1,73 @@
+package external_ip_pool
+
+import (
+	"fmt"
+	"net"
+	"sync"
+)
+
+// ExternalIPPool hands out the external IPs that operators have routed to
+// this host, each to at most one container.
+type ExternalIPPool interface {
+	Remove(net.IP) error
+	Release(net.IP)
+}
+
+type RealExternalIPPool struct {
+	available map[string]bool
+	taken     map[string]bool
+	poolMutex *sync.Mutex
+}
+
+type UnknownIPError struct {
+	IP net.IP
+}
+
+func (e UnknownIPError) Error() string {
+	return fmt.Sprintf("not an available external ip: %s", e.IP)
+}
+
+type IPTakenError struct {
+	IP net.IP
+}
+
+func (e IPTakenError) Error() string {
+	return fmt.Sprintf("external ip already acquired: %s", e.IP)
+}
+
+func New(ips []net.IP) *RealExternalIPPool {
+	available := map[string]bool{}
+	for _, ip := range ips {
+		available[ip.String()] = true
+	}
+
+	return &RealExternalIPPool{
+		available: available,
+		taken:     map[string]bool{},
+		poolMutex: new(sync.Mutex),
+	}
+}
+
+func (p *RealExternalIPPool) Remove(ip net.IP) error {
+	p.poolMutex.Lock()
+	defer p.poolMutex.Unlock()
+
+	if !p.available[ip.String()] {
+		return UnknownIPError{ip}
+	}
+
+	if p.taken[ip.String()] {
+		return IPTakenError{ip}
+	}
+
+	p.taken[ip.String()] = true
+
+	return nil
+}
+
+func (p *RealExternalIPPool) Release(ip net.IP) {
+	p.poolMutex.Lock()
+	defer p.poolMutex.Unlock()
+
+	delete(p.taken, ip.String())
+}
@@ -0,0 +1,13 @@
+package external_ip_pool_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"testing"
+)
+
+func TestExternal_ip_pool(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "External IP Pool Suite")
+}
@@ -0,0 +1,66 @@
+package external_ip_pool_test
+
+import (
+	"net"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/cloudfoundry-incubator/garden-linux/old/linux_backend/external_ip_pool"
+)
+
+var _ = Describe("External IP Pool", func() {
+	var pool *external_ip_pool.RealExternalIPPool
+
+	BeforeEach(func() {
+		pool = external_ip_pool.New([]net.IP{
+			net.ParseIP("203.0.113.1"),
+			net.ParseIP("203.0.113.2"),
+		})
+	})
+
+	Describe("removing", func() {
+		It("takes the IP from the pool", func() {
+			err := pool.Remove(net.ParseIP("203.0.113.1"))
+			Ω(err).ShouldNot(HaveOccurred())
+
+			err = pool.Remove(net.ParseIP("203.0.113.2"))
+			Ω(err).ShouldNot(HaveOccurred())
+		})
+
+		Context("when the IP is already taken", func() {
+			It("returns an IPTakenError", func() {
+				ip := net.ParseIP("203.0.113.1")
+
+				err := pool.Remove(ip)
+				Ω(err).ShouldNot(HaveOccurred())
+
+				err = pool.Remove(ip)
+				Ω(err).Should(Equal(external_ip_pool.IPTakenError{IP: ip}))
+			})
+		})
+
+		Context("when the IP is not in the pool", func() {
+			It("returns an UnknownIPError", func() {
+				ip := net.ParseIP("198.51.100.1")
+
+				err := pool.Remove(ip)
+				Ω(err).Should(Equal(external_ip_pool.UnknownIPError{IP: ip}))
+			})
+		})
+	})
+
+	Describe("releasing", func() {
+		It("makes the IP available again", func() {
+			ip := net.ParseIP("203.0.113.1")
+
+			err := pool.Remove(ip)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			pool.Release(ip)
+
+			err = pool.Remove(ip)
+			Ω(err).ShouldNot(HaveOccurred())
+		})
+	})
+})
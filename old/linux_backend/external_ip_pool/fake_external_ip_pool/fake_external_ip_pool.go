@@ -0,0 +1,28 @@
+package fake_external_ip_pool
+
+import "net"
+
+type FakeExternalIPPool struct {
+	RemoveError error
+
+	Removed  []string
+	Released []string
+}
+
+func New() *FakeExternalIPPool {
+	return &FakeExternalIPPool{}
+}
+
+func (p *FakeExternalIPPool) Remove(ip net.IP) error {
+	if p.RemoveError != nil {
+		return p.RemoveError
+	}
+
+	p.Removed = append(p.Removed, ip.String())
+
+	return nil
+}
+
+func (p *FakeExternalIPPool) Release(ip net.IP) {
+	p.Released = append(p.Released, ip.String())
+}
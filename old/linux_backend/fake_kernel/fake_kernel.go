@@ -0,0 +1,738 @@
+// +build fake_kernel
+
+// Package fake_kernel stands in for the scripts and tools through which the
+// backend changes the kernel: cgroups, iptables, mounts and network links.
+// With it the pool, the backend and the server can be run end to end
+// without root, as in CI containers, by building with -tags fake_kernel.
+//
+// Running processes in containers is not faked; that still needs wshd and
+// iodaemon, and so root.
+package fake_kernel
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"os/exec"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/cloudfoundry/gunk/command_runner"
+
+	"github.com/cloudfoundry-incubator/garden-linux/old/linux_backend/iptables_manager"
+	"github.com/cloudfoundry-incubator/garden-linux/old/sysconfig"
+)
+
+// Kernel is a command runner that does in process, on a directory of its
+// own, what the backend's scripts would do to the host. Commands it does
+// not know, e.g. tar and rm, are run as they would be.
+type Kernel struct {
+	cgroupPath string
+
+	// names the containers' chains, as the server's config does
+	iptables sysconfig.IPTablesConfig
+
+	passthrough command_runner.CommandRunner
+
+	mutex sync.Mutex
+
+	filter     Filter
+	containers map[string]*container
+
+	// started oom notifiers and packet captures, which run until killed
+	notifiers map[*exec.Cmd]chan struct{}
+}
+
+// Filter is what the host's default filter chain was last set up with.
+type Filter struct {
+	DenyNetworks  []string
+	AllowNetworks []string
+}
+
+// Container is the host's state for a container, as its scripts left it.
+type Container struct {
+	ID   string
+	Path string
+
+	HostIP      string
+	ContainerIP string
+	ExternalIP  string
+
+	Running bool
+
+	// whether the container's chains are in place; they are flushed by
+	// FlushRules, as by a host firewall manager
+	ChainsInstalled bool
+
+	NetIns  []NetIn
+	NetOuts []NetOut
+}
+
+type NetIn struct {
+	HostPort      uint32
+	ContainerPort uint32
+	Protocol      string
+}
+
+type NetOut struct {
+	Protocol string
+	Network  string
+	Port     string
+	ICMPType string
+	ICMPCode string
+	Log      bool
+}
+
+type container struct {
+	Container
+
+	// wshd's socket, which start.sh listens on for start verification
+	wshd net.Listener
+}
+
+type UnknownContainerError struct {
+	Path string
+}
+
+func (e UnknownContainerError) Error() string {
+	return fmt.Sprintf("no container at %s", e.Path)
+}
+
+type RuleDriftError struct {
+	Path string
+}
+
+func (e RuleDriftError) Error() string {
+	return fmt.Sprintf("rules for the container at %s have drifted", e.Path)
+}
+
+// New returns a kernel whose cgroups are under cgroupPath, and whose
+// containers' chains are named by iptables, passing commands it does not
+// know to passthrough.
+func New(cgroupPath string, iptables sysconfig.IPTablesConfig, passthrough command_runner.CommandRunner) *Kernel {
+	return &Kernel{
+		cgroupPath: cgroupPath,
+
+		iptables: iptables,
+
+		passthrough: passthrough,
+
+		containers: map[string]*container{},
+		notifiers:  map[*exec.Cmd]chan struct{}{},
+	}
+}
+
+// Filter returns what the host's default filter chain is set up with.
+func (k *Kernel) Filter() Filter {
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+
+	return k.filter
+}
+
+// Containers returns the containers that have been created and not yet
+// destroyed, by their paths.
+func (k *Kernel) Containers() map[string]Container {
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+
+	containers := map[string]Container{}
+	for containerPath, c := range k.containers {
+		containers[containerPath] = c.Container
+	}
+
+	return containers
+}
+
+// FlushRules drops the container's chains and rules, as a host firewall
+// manager flushing iptables would.
+func (k *Kernel) FlushRules(containerPath string) error {
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+
+	c, found := k.containers[containerPath]
+	if !found {
+		return UnknownContainerError{containerPath}
+	}
+
+	c.ChainsInstalled = false
+	c.NetIns = nil
+	c.NetOuts = nil
+
+	return nil
+}
+
+// KillDaemon kills the container's wshd, as an OOM killer might.
+func (k *Kernel) KillDaemon(containerPath string) error {
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+
+	c, found := k.containers[containerPath]
+	if !found {
+		return UnknownContainerError{containerPath}
+	}
+
+	return k.stopDaemon(c)
+}
+
+func (k *Kernel) Run(cmd *exec.Cmd) error {
+	containerPath := path.Dir(cmd.Path)
+
+	switch path.Base(cmd.Path) {
+	case "setup.sh":
+		return k.setUp(cmd)
+	case "create.sh":
+		return k.create(cmd)
+	case "destroy.sh":
+		return k.destroy(cmd)
+	case "overlay.sh":
+		return k.overlay(cmd)
+	case "start.sh":
+		return k.start(containerPath)
+	case "stop.sh":
+		return k.stop(containerPath)
+	case "net.sh":
+		if k.isContainer(containerPath) {
+			return k.containerNet(containerPath, cmd)
+		}
+
+		return k.hostNet(cmd)
+	case "iptables-restore":
+		return k.restore(cmd)
+	case "repquota", "setquota":
+		return nil
+	}
+
+	return k.passthrough.Run(cmd)
+}
+
+func (k *Kernel) Start(cmd *exec.Cmd) error {
+	capture := path.Base(cmd.Path) == "net.sh" && len(cmd.Args) > 1 && cmd.Args[1] == "capture"
+
+	if capture {
+		// nothing is ever captured
+		err := ioutil.WriteFile(env(cmd, "CAPTURE_PATH"), nil, 0644)
+		if err != nil {
+			return err
+		}
+	}
+
+	if path.Base(cmd.Path) == "oom" || capture {
+		k.mutex.Lock()
+		k.notifiers[cmd] = make(chan struct{})
+		k.mutex.Unlock()
+
+		return nil
+	}
+
+	return k.passthrough.Start(cmd)
+}
+
+func (k *Kernel) Background(cmd *exec.Cmd) error {
+	return k.passthrough.Background(cmd)
+}
+
+func (k *Kernel) Wait(cmd *exec.Cmd) error {
+	k.mutex.Lock()
+	killed, found := k.notifiers[cmd]
+	k.mutex.Unlock()
+
+	if found {
+		<-killed
+		return nil
+	}
+
+	return k.passthrough.Wait(cmd)
+}
+
+func (k *Kernel) Kill(cmd *exec.Cmd) error {
+	k.mutex.Lock()
+	killed, found := k.notifiers[cmd]
+	delete(k.notifiers, cmd)
+	k.mutex.Unlock()
+
+	if found {
+		close(killed)
+		return nil
+	}
+
+	return k.passthrough.Kill(cmd)
+}
+
+func (k *Kernel) Signal(cmd *exec.Cmd, signal os.Signal) error {
+	return k.passthrough.Signal(cmd, signal)
+}
+
+func (k *Kernel) isContainer(containerPath string) bool {
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+
+	_, found := k.containers[containerPath]
+	return found
+}
+
+func (k *Kernel) setUp(cmd *exec.Cmd) error {
+	for _, subsystem := range []string{"blkio", "cpu", "cpuacct", "cpuset", "devices", "memory"} {
+		err := os.MkdirAll(path.Join(k.cgroupPath, subsystem), 0755)
+		if err != nil {
+			return err
+		}
+	}
+
+	k.setFilter(cmd)
+
+	return nil
+}
+
+func (k *Kernel) hostNet(cmd *exec.Cmd) error {
+	switch action(cmd) {
+	case "filter_default":
+		k.setFilter(cmd)
+	}
+
+	return nil
+}
+
+func (k *Kernel) setFilter(cmd *exec.Cmd) {
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+
+	k.filter = Filter{
+		DenyNetworks:  strings.Fields(env(cmd, "DENY_NETWORKS")),
+		AllowNetworks: strings.Fields(env(cmd, "ALLOW_NETWORKS")),
+	}
+}
+
+func (k *Kernel) create(cmd *exec.Cmd) error {
+	if len(cmd.Args) != 2 {
+		return fmt.Errorf("usage: %s <instance_path>", cmd.Path)
+	}
+
+	containerPath := cmd.Args[1]
+
+	_, err := os.Stat(containerPath)
+	if err == nil {
+		return fmt.Errorf("%q already exists, aborting", containerPath)
+	}
+
+	for _, dir := range []string{"bin", "run", "processes", "tmp"} {
+		err := os.MkdirAll(path.Join(containerPath, dir), 0755)
+		if err != nil {
+			return err
+		}
+	}
+
+	id := env(cmd, "id")
+
+	err = k.createCgroups(id)
+	if err != nil {
+		return err
+	}
+
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+
+	k.containers[containerPath] = &container{
+		Container: Container{
+			ID:   id,
+			Path: containerPath,
+
+			HostIP:      env(cmd, "network_host_ip"),
+			ContainerIP: env(cmd, "network_container_ip"),
+			ExternalIP:  env(cmd, "container_external_ip"),
+		},
+	}
+
+	return nil
+}
+
+// createCgroups creates the container's cgroups, with what the backend
+// reads from them as a fresh kernel would report it.
+func (k *Kernel) createCgroups(id string) error {
+	files := map[string]map[string]string{
+		"blkio": {
+			"blkio.throttle.io_service_bytes": "Total 0\n",
+		},
+		"cpu": {
+			"cpu.shares": "1024\n",
+		},
+		"cpuacct": {
+			"cpuacct.usage": "0\n",
+			"cpuacct.stat":  "user 0\nsystem 0\n",
+		},
+		"cpuset":  {},
+		"devices": {},
+		"memory": {
+			"memory.limit_in_bytes":     "9223372036854771712\n",
+			"memory.max_usage_in_bytes": "0\n",
+			"memory.stat":               "cache 0\nrss 0\n",
+		},
+	}
+
+	for subsystem, contents := range files {
+		instancePath := path.Join(k.cgroupPath, subsystem, "instance-"+id)
+
+		err := os.MkdirAll(instancePath, 0755)
+		if err != nil {
+			return err
+		}
+
+		for name, content := range contents {
+			err := ioutil.WriteFile(path.Join(instancePath, name), []byte(content), 0644)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func (k *Kernel) destroy(cmd *exec.Cmd) error {
+	if len(cmd.Args) < 2 || len(cmd.Args) > 3 {
+		return fmt.Errorf("usage: %s <instance_path> [graveyard_path]", cmd.Path)
+	}
+
+	containerPath := cmd.Args[1]
+
+	if path.Base(containerPath) == "tmp" {
+		return nil
+	}
+
+	k.mutex.Lock()
+	c, found := k.containers[containerPath]
+	if found {
+		k.stopDaemon(c)
+		delete(k.containers, containerPath)
+	}
+	k.mutex.Unlock()
+
+	if found {
+		for _, subsystem := range []string{"blkio", "cpu", "cpuacct", "cpuset", "devices", "memory"} {
+			err := os.RemoveAll(path.Join(k.cgroupPath, subsystem, "instance-"+c.ID))
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	_, err := os.Stat(containerPath)
+	if err != nil {
+		return nil
+	}
+
+	if len(cmd.Args) == 3 {
+		graveyard := cmd.Args[2]
+
+		err := os.MkdirAll(graveyard, 0755)
+		if err != nil {
+			return err
+		}
+
+		return os.Rename(containerPath, path.Join(graveyard, path.Base(containerPath)))
+	}
+
+	return os.RemoveAll(containerPath)
+}
+
+func (k *Kernel) overlay(cmd *exec.Cmd) error {
+	if len(cmd.Args) < 3 {
+		return fmt.Errorf("usage: %s <action> <overlay_path> [rootfs_path]", cmd.Path)
+	}
+
+	overlayPath := cmd.Args[2]
+
+	switch cmd.Args[1] {
+	case "create", "remount":
+		for _, dir := range []string{"rootfs", "overlay", "workdir"} {
+			err := os.MkdirAll(path.Join(overlayPath, dir), 0755)
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	case "cleanup":
+		return os.RemoveAll(overlayPath)
+	}
+
+	return fmt.Errorf("unknown overlay action: %s", cmd.Args[1])
+}
+
+func (k *Kernel) start(containerPath string) error {
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+
+	c, found := k.containers[containerPath]
+	if !found {
+		return UnknownContainerError{containerPath}
+	}
+
+	if c.Running {
+		return nil
+	}
+
+	sockPath := path.Join(containerPath, "run", "wshd.sock")
+	os.Remove(sockPath)
+
+	listener, err := net.Listen("unix", sockPath)
+	if err != nil {
+		return err
+	}
+
+	go acceptAndClose(listener)
+
+	// wshd is checked for by its pid, which this process stands in for
+	pid := strconv.Itoa(os.Getpid()) + "\n"
+
+	err = ioutil.WriteFile(path.Join(containerPath, "run", "wshd.pid"), []byte(pid), 0644)
+	if err != nil {
+		listener.Close()
+		return err
+	}
+
+	c.wshd = listener
+	c.Running = true
+
+	return nil
+}
+
+func (k *Kernel) stop(containerPath string) error {
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+
+	c, found := k.containers[containerPath]
+	if !found {
+		return UnknownContainerError{containerPath}
+	}
+
+	return k.stopDaemon(c)
+}
+
+func (k *Kernel) stopDaemon(c *container) error {
+	if !c.Running {
+		return nil
+	}
+
+	c.wshd.Close()
+	c.wshd = nil
+	c.Running = false
+
+	return os.Remove(path.Join(c.Path, "run", "wshd.pid"))
+}
+
+func (k *Kernel) containerNet(containerPath string, cmd *exec.Cmd) error {
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+
+	c := k.containers[containerPath]
+
+	switch action(cmd) {
+	case "setup":
+		c.ChainsInstalled = true
+		c.NetIns = nil
+		c.NetOuts = nil
+
+	case "check":
+		if !c.ChainsInstalled ||
+			env(cmd, "FILTER_RULES") != strconv.Itoa(filterRules(c.Container)) ||
+			env(cmd, "NAT_RULES") != strconv.Itoa(natRules(c.Container)) {
+			return RuleDriftError{containerPath}
+		}
+
+	case "check_links", "check_gateway":
+		if !c.ChainsInstalled {
+			return RuleDriftError{containerPath}
+		}
+
+	case "usage":
+		if cmd.Stdout != nil {
+			fmt.Fprintf(cmd.Stdout, "0 0\n")
+		}
+	}
+
+	return nil
+}
+
+// restore applies the rules that the iptables manager restores to the
+// containers' chains, all of them or, if any is malformed, none.
+func (k *Kernel) restore(cmd *exec.Cmd) error {
+	k.mutex.Lock()
+	defer k.mutex.Unlock()
+
+	if cmd.Stdin == nil {
+		return nil
+	}
+
+	input, err := ioutil.ReadAll(cmd.Stdin)
+	if err != nil {
+		return err
+	}
+
+	netIns := map[*container][]NetIn{}
+	netOuts := map[*container][]NetOut{}
+
+	for _, line := range strings.Split(string(input), "\n") {
+		if line == "" || line == "COMMIT" || strings.HasPrefix(line, "*") {
+			continue
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) < 2 || (fields[0] != "-A" && fields[0] != "-I") {
+			return fmt.Errorf("malformed rule: %q", line)
+		}
+
+		c := k.containerWithChain(fields[1])
+		if c == nil {
+			return fmt.Errorf("no chain %s", fields[1])
+		}
+
+		opts := map[string]string{}
+		for i := 2; i < len(fields)-1; i++ {
+			if strings.HasPrefix(fields[i], "--") {
+				opts[fields[i]] = fields[i+1]
+			}
+		}
+
+		switch opts["--jump"] {
+		case "DNAT":
+			hostPort, err := strconv.ParseUint(opts["--destination-port"], 10, 32)
+			if err != nil {
+				return err
+			}
+
+			to := strings.SplitN(opts["--to-destination"], ":", 2)
+			if len(to) != 2 {
+				return fmt.Errorf("malformed rule: %q", line)
+			}
+
+			containerPort, err := strconv.ParseUint(to[1], 10, 32)
+			if err != nil {
+				return err
+			}
+
+			netIns[c] = append(netIns[c], NetIn{
+				HostPort:      uint32(hostPort),
+				ContainerPort: uint32(containerPort),
+				Protocol:      opts["--protocol"],
+			})
+
+		case "RETURN":
+			out := NetOut{
+				Protocol: opts["--protocol"],
+				Network:  opts["--dst-range"],
+				Port:     opts["--destination-port"],
+			}
+
+			if out.Protocol == "" {
+				out.Protocol = "all"
+			}
+
+			if out.Network == "" {
+				out.Network = opts["--destination"]
+			}
+
+			icmp := strings.SplitN(opts["--icmp-type"], "/", 2)
+			out.ICMPType = icmp[0]
+			if len(icmp) == 2 {
+				out.ICMPCode = icmp[1]
+			}
+
+			netOuts[c] = append(netOuts[c], out)
+
+		case "LOG":
+			// follows the RETURN rule it logs for
+			outs := netOuts[c]
+			if len(outs) == 0 {
+				return fmt.Errorf("malformed rule: %q", line)
+			}
+
+			outs[len(outs)-1].Log = true
+
+		default:
+			return fmt.Errorf("malformed rule: %q", line)
+		}
+	}
+
+	for c, ins := range netIns {
+		c.NetIns = append(c.NetIns, ins...)
+	}
+
+	for c, outs := range netOuts {
+		c.NetOuts = append(c.NetOuts, outs...)
+	}
+
+	return nil
+}
+
+func (k *Kernel) containerWithChain(chain string) *container {
+	for _, c := range k.containers {
+		chains := iptables_manager.InstanceChains(k.iptables, c.ID)
+		if chains.Filter == chain || chains.NAT == chain {
+			return c
+		}
+	}
+
+	return nil
+}
+
+// filterRules counts the rules in the container's filter chain as net.sh
+// would install them: one per net out, two if logged, and the jump to the
+// default chain.
+func filterRules(c Container) int {
+	rules := 1
+	for _, out := range c.NetOuts {
+		rules++
+
+		if out.Log {
+			rules++
+		}
+	}
+
+	return rules
+}
+
+// natRules counts the DNATs for the container's net ins and external IP.
+func natRules(c Container) int {
+	rules := len(c.NetIns)
+	if c.ExternalIP != "" {
+		rules++
+	}
+
+	return rules
+}
+
+func acceptAndClose(listener net.Listener) {
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+
+		conn.Close()
+	}
+}
+
+func action(cmd *exec.Cmd) string {
+	if len(cmd.Args) < 2 {
+		return ""
+	}
+
+	return cmd.Args[1]
+}
+
+// env returns the last value given for name in the command's environment,
+// as the script would see it.
+func env(cmd *exec.Cmd, name string) string {
+	value := ""
+	for _, kv := range cmd.Env {
+		if strings.HasPrefix(kv, name+"=") {
+			value = kv[len(name)+1:]
+		}
+	}
+
+	return value
+}
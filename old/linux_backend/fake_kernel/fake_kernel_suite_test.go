@@ -0,0 +1,15 @@
+// +build fake_kernel
+
+package fake_kernel_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"testing"
+)
+
+func TestFakeKernel(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Fake Kernel Suite")
+}
@@ -0,0 +1,207 @@
+// +build fake_kernel
+
+package fake_kernel_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+
+	"github.com/cloudfoundry-incubator/garden/api"
+	"github.com/cloudfoundry-incubator/garden/client"
+	"github.com/cloudfoundry-incubator/garden/client/connection"
+	"github.com/cloudfoundry-incubator/garden/server"
+	"github.com/pivotal-golang/lager/lagertest"
+
+	"github.com/cloudfoundry-incubator/garden-linux/old/linux_backend"
+	. "github.com/cloudfoundry-incubator/garden-linux/old/linux_backend/fake_kernel"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Running the server on a fake kernel", func() {
+	var root string
+	var logger *lagertest.TestLogger
+
+	var stack *Stack
+	var gardenServer *server.GardenServer
+	var gardenClient client.Client
+
+	startServer := func() {
+		socketPath := path.Join(root, "garden.sock")
+
+		gardenServer = server.New("unix", socketPath, 0, stack.Backend, logger)
+
+		err := gardenServer.Start()
+		Ω(err).ShouldNot(HaveOccurred())
+
+		gardenClient = client.New(connection.New("unix", socketPath))
+	}
+
+	containerPath := func(container api.Container) string {
+		info, err := container.Info()
+		Ω(err).ShouldNot(HaveOccurred())
+
+		return info.ContainerPath
+	}
+
+	BeforeEach(func() {
+		var err error
+
+		root, err = ioutil.TempDir("", "fake-kernel")
+		Ω(err).ShouldNot(HaveOccurred())
+
+		logger = lagertest.NewTestLogger("test")
+
+		stack, err = NewStack(logger, root)
+		Ω(err).ShouldNot(HaveOccurred())
+
+		startServer()
+	})
+
+	AfterEach(func() {
+		gardenServer.Stop()
+		os.RemoveAll(root)
+	})
+
+	It("creates a running container with its network set up", func() {
+		container, err := gardenClient.Create(api.ContainerSpec{})
+		Ω(err).ShouldNot(HaveOccurred())
+
+		info, err := container.Info()
+		Ω(err).ShouldNot(HaveOccurred())
+
+		Ω(info.State).Should(Equal("active"))
+
+		kernelContainer, found := stack.Kernel.Containers()[info.ContainerPath]
+		Ω(found).Should(BeTrue())
+
+		Ω(kernelContainer.Running).Should(BeTrue())
+		Ω(kernelContainer.ChainsInstalled).Should(BeTrue())
+		Ω(kernelContainer.HostIP).Should(Equal(info.HostIP))
+		Ω(kernelContainer.ContainerIP).Should(Equal(info.ContainerIP))
+	})
+
+	It("maps ports and allows traffic out", func() {
+		container, err := gardenClient.Create(api.ContainerSpec{})
+		Ω(err).ShouldNot(HaveOccurred())
+
+		hostPort, containerPort, err := container.NetIn(0, 8080)
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(containerPort).Should(Equal(uint32(8080)))
+
+		err = container.NetOut("10.0.0.0/8", 53)
+		Ω(err).ShouldNot(HaveOccurred())
+
+		kernelContainer := stack.Kernel.Containers()[containerPath(container)]
+
+		Ω(kernelContainer.NetIns).Should(Equal([]NetIn{
+			{HostPort: hostPort, ContainerPort: 8080, Protocol: "tcp"},
+		}))
+
+		Ω(kernelContainer.NetOuts).Should(HaveLen(1))
+		Ω(kernelContainer.NetOuts[0].Network).Should(Equal("10.0.0.0-10.255.255.255"))
+		Ω(kernelContainer.NetOuts[0].Port).Should(Equal("53"))
+	})
+
+	It("limits memory through the container's cgroup", func() {
+		container, err := gardenClient.Create(api.ContainerSpec{})
+		Ω(err).ShouldNot(HaveOccurred())
+
+		err = container.LimitMemory(api.MemoryLimits{LimitInBytes: 64 * 1024 * 1024})
+		Ω(err).ShouldNot(HaveOccurred())
+
+		limits, err := container.CurrentMemoryLimits()
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(limits.LimitInBytes).Should(Equal(uint64(64 * 1024 * 1024)))
+	})
+
+	It("captures packets to the depot until stopped", func() {
+		container, err := gardenClient.Create(api.ContainerSpec{})
+		Ω(err).ShouldNot(HaveOccurred())
+
+		capturePath, err := stack.Backend.StartCapture(container.Handle(), linux_backend.CaptureLimits{})
+		Ω(err).ShouldNot(HaveOccurred())
+
+		_, err = os.Stat(path.Join(containerPath(container), "captures", path.Base(capturePath)))
+		Ω(err).ShouldNot(HaveOccurred())
+
+		err = stack.Backend.StopCapture(container.Handle())
+		Ω(err).ShouldNot(HaveOccurred())
+	})
+
+	It("reinstalls rules that the host lost", func() {
+		container, err := gardenClient.Create(api.ContainerSpec{})
+		Ω(err).ShouldNot(HaveOccurred())
+
+		hostPort, _, err := container.NetIn(0, 8080)
+		Ω(err).ShouldNot(HaveOccurred())
+
+		err = stack.Kernel.FlushRules(containerPath(container))
+		Ω(err).ShouldNot(HaveOccurred())
+
+		stack.Backend.ReconcileNetworks()
+
+		kernelContainer := stack.Kernel.Containers()[containerPath(container)]
+
+		Ω(kernelContainer.ChainsInstalled).Should(BeTrue())
+		Ω(kernelContainer.NetIns).Should(Equal([]NetIn{
+			{HostPort: hostPort, ContainerPort: 8080, Protocol: "tcp"},
+		}))
+	})
+
+	It("replaces the default network filters", func() {
+		err := stack.Pool.SetNetworkFilters([]string{"10.0.0.0/8"}, []string{"10.1.0.0/16"})
+		Ω(err).ShouldNot(HaveOccurred())
+
+		Ω(stack.Kernel.Filter()).Should(Equal(Filter{
+			DenyNetworks:  []string{"10.0.0.0/8"},
+			AllowNetworks: []string{"10.1.0.0/16"},
+		}))
+	})
+
+	It("destroys containers", func() {
+		container, err := gardenClient.Create(api.ContainerSpec{})
+		Ω(err).ShouldNot(HaveOccurred())
+
+		cPath := containerPath(container)
+
+		err = gardenClient.Destroy(container.Handle())
+		Ω(err).ShouldNot(HaveOccurred())
+
+		Ω(stack.Kernel.Containers()).Should(BeEmpty())
+
+		_, err = os.Stat(cPath)
+		Ω(os.IsNotExist(err)).Should(BeTrue())
+	})
+
+	Context("when the server restarts", func() {
+		It("restores its containers, with their rules", func() {
+			container, err := gardenClient.Create(api.ContainerSpec{Handle: "some-handle"})
+			Ω(err).ShouldNot(HaveOccurred())
+
+			hostPort, _, err := container.NetIn(0, 8080)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			gardenServer.Stop()
+
+			err = stack.Restart()
+			Ω(err).ShouldNot(HaveOccurred())
+
+			startServer()
+
+			restored, err := gardenClient.Lookup("some-handle")
+			Ω(err).ShouldNot(HaveOccurred())
+
+			info, err := restored.Info()
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(info.MappedPorts).Should(ContainElement(api.PortMapping{HostPort: hostPort, ContainerPort: 8080}))
+
+			kernelContainer := stack.Kernel.Containers()[info.ContainerPath]
+			Ω(kernelContainer.NetIns).Should(Equal([]NetIn{
+				{HostPort: hostPort, ContainerPort: 8080, Protocol: "tcp"},
+			}))
+		})
+	})
+})
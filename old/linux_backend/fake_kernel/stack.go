@@ -0,0 +1,135 @@
+// +build fake_kernel
+
+package fake_kernel
+
+import (
+	"net"
+	"os"
+	"path"
+
+	"github.com/cloudfoundry/gunk/command_runner/linux_command_runner"
+	"github.com/pivotal-golang/lager"
+
+	"github.com/cloudfoundry-incubator/garden-linux/old/linux_backend"
+	"github.com/cloudfoundry-incubator/garden-linux/old/linux_backend/container_pool"
+	"github.com/cloudfoundry-incubator/garden-linux/old/linux_backend/container_pool/rootfs_provider"
+	"github.com/cloudfoundry-incubator/garden-linux/old/linux_backend/external_ip_pool"
+	"github.com/cloudfoundry-incubator/garden-linux/old/linux_backend/network_pool"
+	"github.com/cloudfoundry-incubator/garden-linux/old/linux_backend/port_pool"
+	"github.com/cloudfoundry-incubator/garden-linux/old/linux_backend/quota_manager"
+	"github.com/cloudfoundry-incubator/garden-linux/old/linux_backend/snapshot_store"
+	"github.com/cloudfoundry-incubator/garden-linux/old/linux_backend/uid_pool"
+	"github.com/cloudfoundry-incubator/garden-linux/old/sysconfig"
+	"github.com/cloudfoundry-incubator/garden-linux/old/system_info"
+	"github.com/cloudfoundry-incubator/garden/api"
+)
+
+// fakeTag is the stack's server's tag
+const fakeTag = "fake"
+
+// Stack is a pool and a backend wired as the server wires them, but on a
+// fake kernel, with everything they keep under one directory.
+type Stack struct {
+	Root string
+
+	Kernel  *Kernel
+	Pool    *container_pool.LinuxContainerPool
+	Backend *linux_backend.LinuxBackend
+
+	logger lager.Logger
+}
+
+// NewStack sets up a stack under root, which is created if need be. The
+// backend is set up but not started, as the server starts it.
+func NewStack(logger lager.Logger, root string) (*Stack, error) {
+	for _, dir := range []string{"bin", "depot", "overlays", "rootfs", "snapshots", "cgroup"} {
+		err := os.MkdirAll(path.Join(root, dir), 0755)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	stack := &Stack{
+		Root: root,
+
+		Kernel: New(path.Join(root, "cgroup"), sysconfig.NewConfig(fakeTag).IPTables, linux_command_runner.New()),
+
+		logger: logger,
+	}
+
+	err := stack.build()
+	if err != nil {
+		return nil, err
+	}
+
+	return stack, nil
+}
+
+// Restart sets up a new pool and backend on the same kernel, as when the
+// server restarts on a host that has not rebooted. The backend must have
+// been stopped, e.g. by stopping its server, for its containers' snapshots
+// to have been saved. The new backend is not yet started.
+func (stack *Stack) Restart() error {
+	return stack.build()
+}
+
+func (stack *Stack) build() error {
+	binPath := path.Join(stack.Root, "bin")
+	depotPath := path.Join(stack.Root, "depot")
+
+	config := sysconfig.NewConfig(fakeTag)
+	config.CgroupPath = path.Join(stack.Root, "cgroup")
+
+	_, poolNetwork, err := net.ParseCIDR("10.254.0.0/22")
+	if err != nil {
+		return err
+	}
+
+	quotaManager := quota_manager.New(stack.Kernel, stack.Root, binPath)
+	quotaManager.Disable()
+
+	rootFSProviders := map[string]rootfs_provider.RootFSProvider{
+		"": rootfs_provider.NewOverlay(
+			binPath,
+			path.Join(stack.Root, "overlays"),
+			path.Join(stack.Root, "rootfs"),
+			nil,
+			stack.Kernel,
+		),
+	}
+
+	stack.Pool = container_pool.New(
+		stack.logger,
+		binPath,
+		depotPath,
+		config,
+		rootFSProviders,
+		uid_pool.New(10000, 256),
+		network_pool.New(poolNetwork),
+		nil,
+		external_ip_pool.New(nil),
+		port_pool.New(61001, 100),
+		nil,
+		nil,
+		stack.Kernel,
+		quotaManager,
+		nil,
+		nil,
+		nil,
+		nil,
+		api.ResourceLimits{},
+		false,
+		"fake",
+	)
+
+	stack.Backend = linux_backend.New(
+		stack.logger,
+		stack.Pool,
+		system_info.NewProvider(depotPath),
+		snapshot_store.NewFileStore(path.Join(stack.Root, "snapshots")),
+		1500,
+		linux_backend.StartVerification{Attempts: 1},
+	)
+
+	return stack.Backend.Setup()
+}
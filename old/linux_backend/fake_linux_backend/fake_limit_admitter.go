@@ -0,0 +1,35 @@
+package fake_linux_backend
+
+import (
+	"sync"
+
+	"github.com/cloudfoundry-incubator/garden-linux/old/linux_backend"
+)
+
+// FakeLimitAdmitter admits every limit, unless given an AdmitError, and
+// counts the admissions released.
+type FakeLimitAdmitter struct {
+	AdmitError error
+
+	Admitted []linux_backend.CommittedResources
+	Released int
+
+	mutex sync.Mutex
+}
+
+func (a *FakeLimitAdmitter) AdmitLimits(container linux_backend.Container, committed linux_backend.CommittedResources) (func(), error) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	if a.AdmitError != nil {
+		return nil, a.AdmitError
+	}
+
+	a.Admitted = append(a.Admitted, committed)
+
+	return func() {
+		a.mutex.Lock()
+		a.Released++
+		a.mutex.Unlock()
+	}, nil
+}
@@ -0,0 +1,21 @@
+package fake_linux_backend
+
+import "github.com/pivotal-golang/lager"
+
+// FakeLinkBuilder records the PIDs it builds links for, unless given a
+// BuildError.
+type FakeLinkBuilder struct {
+	BuildError error
+
+	Built []int
+}
+
+func (b *FakeLinkBuilder) BuildLinks(logger lager.Logger, pid int) error {
+	if b.BuildError != nil {
+		return b.BuildError
+	}
+
+	b.Built = append(b.Built, pid)
+
+	return nil
+}
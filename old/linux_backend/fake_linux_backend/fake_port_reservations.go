@@ -0,0 +1,35 @@
+package fake_linux_backend
+
+import "sync"
+
+// FakePortReservations holds the reserved ports, each of which can be
+// claimed once.
+type FakePortReservations struct {
+	Reserved map[uint32]bool
+
+	mutex sync.Mutex
+}
+
+func NewFakePortReservations(ports ...uint32) *FakePortReservations {
+	reserved := map[uint32]bool{}
+	for _, port := range ports {
+		reserved[port] = true
+	}
+
+	return &FakePortReservations{
+		Reserved: reserved,
+	}
+}
+
+func (r *FakePortReservations) ClaimReservedPort(port uint32) bool {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if !r.Reserved[port] {
+		return false
+	}
+
+	delete(r.Reserved, port)
+
+	return true
+}
@@ -0,0 +1,73 @@
+package fake_linux_backend
+
+import (
+	"sort"
+	"sync"
+)
+
+// FakeSnapshotUploader keeps what it is given to upload, by name, unless
+// given an UploadError, and counts uploads. It lists what it keeps, which
+// may be set up in Uploaded beforehand.
+type FakeSnapshotUploader struct {
+	UploadError error
+	DeleteError error
+	ListError   error
+
+	Uploaded map[string][]byte
+	Uploads  int
+	Deleted  []string
+
+	mutex sync.Mutex
+}
+
+func NewFakeSnapshotUploader() *FakeSnapshotUploader {
+	return &FakeSnapshotUploader{
+		Uploaded: map[string][]byte{},
+	}
+}
+
+func (u *FakeSnapshotUploader) Upload(name string, contents []byte) error {
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+
+	if u.UploadError != nil {
+		return u.UploadError
+	}
+
+	u.Uploads++
+	u.Uploaded[name] = contents
+
+	return nil
+}
+
+func (u *FakeSnapshotUploader) Delete(name string) error {
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+
+	if u.DeleteError != nil {
+		return u.DeleteError
+	}
+
+	u.Deleted = append(u.Deleted, name)
+	delete(u.Uploaded, name)
+
+	return nil
+}
+
+func (u *FakeSnapshotUploader) List() ([]string, error) {
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+
+	if u.ListError != nil {
+		return nil, u.ListError
+	}
+
+	names := []string{}
+	for name := range u.Uploaded {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	return names, nil
+}
@@ -0,0 +1,50 @@
+package fake_linux_backend
+
+import (
+	"sync"
+	"time"
+
+	"github.com/cloudfoundry-incubator/garden-linux/old/linux_backend"
+)
+
+type ObservedUsage struct {
+	Handle string
+	Tags   map[string]string
+	Usage  linux_backend.UsageSummary
+	Final  bool
+}
+
+// FakeUsageExporter records the usage it observes, and counts flushes, which
+// return FlushError.
+type FakeUsageExporter struct {
+	FlushError error
+
+	Observed []ObservedUsage
+	Flushes  int
+
+	mutex sync.Mutex
+}
+
+func (e *FakeUsageExporter) Observe(handle string, tags map[string]string, at time.Time, usage linux_backend.UsageSummary) {
+	e.observe(ObservedUsage{Handle: handle, Tags: tags, Usage: usage})
+}
+
+func (e *FakeUsageExporter) ObserveFinal(handle string, tags map[string]string, at time.Time, usage linux_backend.UsageSummary) {
+	e.observe(ObservedUsage{Handle: handle, Tags: tags, Usage: usage, Final: true})
+}
+
+func (e *FakeUsageExporter) observe(observed ObservedUsage) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	e.Observed = append(e.Observed, observed)
+}
+
+func (e *FakeUsageExporter) Flush() error {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	e.Flushes++
+
+	return e.FlushError
+}
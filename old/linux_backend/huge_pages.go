@@ -0,0 +1,146 @@
+package linux_backend
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/cloudfoundry-incubator/garden/api"
+	"github.com/pivotal-golang/lager"
+)
+
+// HugePageLimits are the most bytes of huge pages of each size, e.g. "2MB"
+// or "1GB", that a container may use.
+type HugePageLimits map[string]uint64
+
+// HugePagesPropertyPrefix requests huge page limits on creation, as
+// hugetlb.<size>.limit_in_bytes properties, e.g. hugetlb.2MB.limit_in_bytes.
+// Info reports each size's limit, usage_in_bytes, max_usage_in_bytes and
+// failcnt under the same prefix.
+const HugePagesPropertyPrefix = "hugetlb."
+
+var hugePageSizePattern = regexp.MustCompile(`^[0-9]+[KMG]B$`)
+
+type InvalidHugePageSizeError struct {
+	Size string
+}
+
+func (e InvalidHugePageSizeError) Error() string {
+	return fmt.Sprintf("invalid huge page size: %s", e.Size)
+}
+
+type InvalidHugePagesPropertyError struct {
+	Property string
+	Value    string
+}
+
+func (e InvalidHugePagesPropertyError) Error() string {
+	return fmt.Sprintf("invalid value for %s: %s", e.Property, e.Value)
+}
+
+// LimitHugePages limits the container's huge pages of each size in limits,
+// leaving other sizes as they are.
+func (c *LinuxContainer) LimitHugePages(limits HugePageLimits) error {
+	for size := range limits {
+		if !hugePageSizePattern.MatchString(size) {
+			return InvalidHugePageSizeError{size}
+		}
+	}
+
+	c.hugePagesMutex.Lock()
+	defer c.hugePagesMutex.Unlock()
+
+	for _, size := range sortedHugePageSizes(limits) {
+		limit := limits[size]
+
+		err := c.cgroupsManager.Set("hugetlb", "hugetlb."+size+".limit_in_bytes", fmt.Sprintf("%d", limit))
+		if err != nil {
+			return err
+		}
+
+		if c.currentHugePageLimits == nil {
+			c.currentHugePageLimits = HugePageLimits{}
+		}
+
+		c.currentHugePageLimits[size] = limit
+
+		c.logger.Info("limited-huge-pages", lager.Data{
+			"size":  size,
+			"limit": limit,
+		})
+	}
+
+	return nil
+}
+
+func (c *LinuxContainer) CurrentHugePageLimits() HugePageLimits {
+	c.hugePagesMutex.RLock()
+	defer c.hugePagesMutex.RUnlock()
+
+	limits := HugePageLimits{}
+	for size, limit := range c.currentHugePageLimits {
+		limits[size] = limit
+	}
+
+	return limits
+}
+
+// requestedHugePageLimits are those in the container's properties.
+func (c *LinuxContainer) requestedHugePageLimits() (HugePageLimits, error) {
+	limits := HugePageLimits{}
+
+	for key, value := range c.Properties() {
+		if !strings.HasPrefix(key, HugePagesPropertyPrefix) || !strings.HasSuffix(key, ".limit_in_bytes") {
+			continue
+		}
+
+		size := strings.TrimSuffix(strings.TrimPrefix(key, HugePagesPropertyPrefix), ".limit_in_bytes")
+
+		limit, err := strconv.ParseUint(value, 10, 64)
+		if err != nil {
+			return nil, InvalidHugePagesPropertyError{key, value}
+		}
+
+		limits[size] = limit
+	}
+
+	return limits, nil
+}
+
+// hugePageProperties reports the usage of each size of huge pages the
+// container is limited in.
+func (c *LinuxContainer) hugePageProperties() (api.Properties, error) {
+	properties := api.Properties{}
+
+	limits := c.CurrentHugePageLimits()
+
+	for _, size := range sortedHugePageSizes(limits) {
+		prefix := HugePagesPropertyPrefix + size + "."
+
+		properties[prefix+"limit_in_bytes"] = fmt.Sprintf("%d", limits[size])
+
+		for _, stat := range []string{"usage_in_bytes", "max_usage_in_bytes", "failcnt"} {
+			value, err := c.cgroupsManager.Get("hugetlb", prefix+stat)
+			if err != nil {
+				return nil, err
+			}
+
+			properties[prefix+stat] = value
+		}
+	}
+
+	return properties, nil
+}
+
+func sortedHugePageSizes(limits HugePageLimits) []string {
+	sizes := []string{}
+	for size := range limits {
+		sizes = append(sizes, size)
+	}
+
+	sort.Strings(sizes)
+
+	return sizes
+}
@@ -0,0 +1,39 @@
+package fake_iptables_manager
+
+import (
+	"github.com/pivotal-golang/lager"
+
+	"github.com/cloudfoundry-incubator/garden-linux/old/linux_backend/iptables_manager"
+)
+
+type FakeIPTablesManager struct {
+	NetInError error
+	NetInCalls [][]iptables_manager.NetIn
+
+	NetOutError error
+	NetOutCalls [][]iptables_manager.NetOut
+}
+
+func New() *FakeIPTablesManager {
+	return &FakeIPTablesManager{}
+}
+
+func (m *FakeIPTablesManager) NetIn(logger lager.Logger, ins ...iptables_manager.NetIn) error {
+	if m.NetInError != nil {
+		return m.NetInError
+	}
+
+	m.NetInCalls = append(m.NetInCalls, ins)
+
+	return nil
+}
+
+func (m *FakeIPTablesManager) NetOut(logger lager.Logger, outs ...iptables_manager.NetOut) error {
+	if m.NetOutError != nil {
+		return m.NetOutError
+	}
+
+	m.NetOutCalls = append(m.NetOutCalls, outs)
+
+	return nil
+}
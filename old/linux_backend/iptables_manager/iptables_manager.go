@@ -0,0 +1,256 @@
+// Package iptables_manager applies the rules in a container's iptables
+// instance chains, created by net.sh setup, from the server itself. Each
+// call is applied with a single iptables-restore, so that either all of its
+// rules are in place or none are, however many other calls are being made.
+package iptables_manager
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/cloudfoundry/gunk/command_runner"
+	"github.com/pivotal-golang/lager"
+
+	"github.com/cloudfoundry-incubator/garden-linux/old/logging"
+	"github.com/cloudfoundry-incubator/garden-linux/old/sysconfig"
+)
+
+// iptables chain names are limited to 28 characters
+const maxChainLength = 28
+
+// RestoreAttempts and RestoreRetryInterval bound waiting for the xtables
+// lock, which iptables-restore, unlike iptables -w, cannot wait for itself.
+var (
+	RestoreAttempts      = 50
+	RestoreRetryInterval = 100 * time.Millisecond
+)
+
+type IPTablesManager interface {
+	NetIn(lager.Logger, ...NetIn) error
+	NetOut(lager.Logger, ...NetOut) error
+}
+
+// NetIn forwards a port on the host's external IP to the container, or, if
+// Count is more than one, that many ports from HostPort to the same ports of
+// the container, which a single DNAT rule can only do by leaving them be.
+type NetIn struct {
+	Protocol      string
+	HostPort      uint32
+	ContainerPort uint32
+	Count         uint32
+}
+
+// NetOut allows traffic out of the container to matching destinations.
+// Empty fields match anything; Network is an iptables range (A-B) and Port a
+// port or iptables port range (A:B).
+type NetOut struct {
+	Protocol string
+	Network  string
+	Port     string
+	ICMPType string
+	ICMPCode string
+	Log      bool
+}
+
+// Chains are a container's instance chains.
+type Chains struct {
+	Filter string
+	NAT    string
+}
+
+// InstanceChains names a container's chains as net.sh does: long IDs are
+// shortened to their tail, leaving room for additional networks' "-N".
+func InstanceChains(config sysconfig.IPTablesConfig, id string) Chains {
+	maxIDLength := maxChainLength - len(config.Filter.InstancePrefix) - 3
+
+	chainID := id
+	if len(chainID) > maxIDLength {
+		chainID = chainID[len(chainID)-maxIDLength:]
+	}
+
+	return Chains{
+		Filter: config.Filter.InstancePrefix + chainID,
+		NAT:    config.NAT.InstancePrefix + chainID,
+	}
+}
+
+// ExternalIP is the host's IP on its route out, as net.sh found it with ip
+// route get. No traffic is sent.
+func ExternalIP() (net.IP, error) {
+	conn, err := net.Dial("udp", "8.8.8.8:53")
+	if err != nil {
+		return nil, err
+	}
+
+	defer conn.Close()
+
+	return conn.LocalAddr().(*net.UDPAddr).IP, nil
+}
+
+type ContainerIPTablesManager struct {
+	chains      Chains
+	containerIP net.IP
+
+	externalIP func() (net.IP, error)
+
+	runner command_runner.CommandRunner
+}
+
+func New(
+	chains Chains,
+	containerIP net.IP,
+	externalIP func() (net.IP, error),
+	runner command_runner.CommandRunner,
+) *ContainerIPTablesManager {
+	return &ContainerIPTablesManager{
+		chains:      chains,
+		containerIP: containerIP,
+
+		externalIP: externalIP,
+
+		runner: runner,
+	}
+}
+
+func (m *ContainerIPTablesManager) NetIn(logger lager.Logger, ins ...NetIn) error {
+	if len(ins) == 0 {
+		return nil
+	}
+
+	externalIP, err := m.externalIP()
+	if err != nil {
+		return err
+	}
+
+	rules := []string{}
+	for _, in := range ins {
+		protocol := in.Protocol
+		if protocol == "" {
+			protocol = "tcp"
+		}
+
+		if in.Count > 1 {
+			rules = append(rules, fmt.Sprintf(
+				"-A %s --protocol %s --destination %s --destination-port %d:%d --jump DNAT --to-destination %s",
+				m.chains.NAT,
+				protocol,
+				externalIP,
+				in.HostPort,
+				in.HostPort+in.Count-1,
+				m.containerIP,
+			))
+
+			continue
+		}
+
+		rules = append(rules, fmt.Sprintf(
+			"-A %s --protocol %s --destination %s --destination-port %d --jump DNAT --to-destination %s:%d",
+			m.chains.NAT,
+			protocol,
+			externalIP,
+			in.HostPort,
+			m.containerIP,
+			in.ContainerPort,
+		))
+	}
+
+	return m.restore(logger.Session("net-in"), "nat", rules)
+}
+
+func (m *ContainerIPTablesManager) NetOut(logger lager.Logger, outs ...NetOut) error {
+	if len(outs) == 0 {
+		return nil
+	}
+
+	rules := []string{}
+	for _, out := range outs {
+		opts := out.opts()
+
+		rules = append(rules, fmt.Sprintf("-I %s 1 %s--jump RETURN", m.chains.Filter, opts))
+
+		// inserted after, and so evaluated before, the RETURN rule
+		if out.Log {
+			rules = append(rules, fmt.Sprintf("-I %s 1 %s--jump LOG --log-prefix \"%s \"", m.chains.Filter, opts, m.chains.Filter))
+		}
+	}
+
+	return m.restore(logger.Session("net-out"), "filter", rules)
+}
+
+// opts are the rule's iptables matches, each followed by a space.
+func (out NetOut) opts() string {
+	opts := ""
+
+	// without an explicit protocol, a port implies tcp
+	protocol := out.Protocol
+	if protocol == "" && out.Port != "" {
+		protocol = "tcp"
+	}
+
+	if protocol != "" && protocol != "all" {
+		opts += "--protocol " + protocol + " "
+	}
+
+	if out.Network != "" {
+		if strings.Contains(out.Network, "-") {
+			opts += "-m iprange --dst-range " + out.Network + " "
+		} else {
+			opts += "--destination " + out.Network + " "
+		}
+	}
+
+	if out.Port != "" {
+		opts += "--destination-port " + out.Port + " "
+	}
+
+	if out.ICMPType != "" {
+		if out.ICMPCode != "" {
+			opts += "--icmp-type " + out.ICMPType + "/" + out.ICMPCode + " "
+		} else {
+			opts += "--icmp-type " + out.ICMPType + " "
+		}
+	}
+
+	return opts
+}
+
+// restore applies the rules to the table with a single iptables-restore,
+// leaving the table's other rules be.
+func (m *ContainerIPTablesManager) restore(logger lager.Logger, table string, rules []string) error {
+	input := "*" + table + "\n" + strings.Join(rules, "\n") + "\nCOMMIT\n"
+
+	runner := logging.Runner{
+		CommandRunner: m.runner,
+		Logger:        logger,
+	}
+
+	var err error
+
+	for attempt := 1; attempt <= RestoreAttempts; attempt++ {
+		restore := exec.Command("iptables-restore", "--noflush")
+		restore.Stdin = bytes.NewBufferString(input)
+
+		err = runner.Run(restore)
+		if !lockHeld(err) {
+			return err
+		}
+
+		time.Sleep(RestoreRetryInterval)
+	}
+
+	logger.Error("gave-up-waiting-for-xtables-lock", err)
+
+	return err
+}
+
+// lockHeld reports whether iptables-restore exited with status 4, as it
+// does when another process holds the xtables lock. The status is read
+// from the message so that failures reported by a privileged helper, which
+// are not *exec.ExitErrors, are recognized too.
+func lockHeld(err error) bool {
+	return err != nil && err.Error() == "exit status 4"
+}
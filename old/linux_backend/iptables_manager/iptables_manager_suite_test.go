@@ -0,0 +1,13 @@
+package iptables_manager_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"testing"
+)
+
+func TestIPTablesManager(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "IPTables Manager Suite")
+}
@@ -0,0 +1,234 @@
+package iptables_manager_test
+
+import (
+	"errors"
+	"io/ioutil"
+	"net"
+	"os/exec"
+	"time"
+
+	"github.com/cloudfoundry/gunk/command_runner/fake_command_runner"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/pivotal-golang/lager/lagertest"
+
+	"github.com/cloudfoundry-incubator/garden-linux/old/linux_backend/iptables_manager"
+	"github.com/cloudfoundry-incubator/garden-linux/old/sysconfig"
+)
+
+var _ = Describe("Instance chains", func() {
+	config := sysconfig.NewConfig("1").IPTables
+
+	It("are the instance prefix and the container's ID", func() {
+		Ω(iptables_manager.InstanceChains(config, "some-id")).Should(Equal(iptables_manager.Chains{
+			Filter: "w-1-instance-some-id",
+			NAT:    "w-1-instance-some-id",
+		}))
+	})
+
+	It("keep the tail of IDs too long for a chain name", func() {
+		chains := iptables_manager.InstanceChains(config, "0123456789abcdefghij")
+
+		Ω(chains.Filter).Should(Equal("w-1-instance-89abcdefghij"))
+		Ω(len(chains.Filter) + len("-N")).Should(BeNumerically("<=", 28))
+	})
+})
+
+var _ = Describe("Container iptables manager", func() {
+	var fakeRunner *fake_command_runner.FakeCommandRunner
+	var logger *lagertest.TestLogger
+	var externalIPErr error
+	var manager *iptables_manager.ContainerIPTablesManager
+
+	var restored []string
+	var restoreErr func(attempt int) error
+
+	BeforeEach(func() {
+		fakeRunner = fake_command_runner.New()
+		logger = lagertest.NewTestLogger("test")
+		externalIPErr = nil
+
+		restored = []string{}
+		restoreErr = func(int) error { return nil }
+
+		fakeRunner.WhenRunning(fake_command_runner.CommandSpec{
+			Path: "iptables-restore",
+		}, func(cmd *exec.Cmd) error {
+			Ω(cmd.Args).Should(Equal([]string{"iptables-restore", "--noflush"}))
+
+			input, err := ioutil.ReadAll(cmd.Stdin)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			restored = append(restored, string(input))
+			return restoreErr(len(restored))
+		})
+
+		manager = iptables_manager.New(
+			iptables_manager.Chains{Filter: "w-1-instance-some-id", NAT: "w-1-nat-some-id"},
+			net.ParseIP("10.2.0.2"),
+			func() (net.IP, error) {
+				return net.ParseIP("1.2.3.4"), externalIPErr
+			},
+			fakeRunner,
+		)
+	})
+
+	Describe("NetIn", func() {
+		It("DNATs the host ports on the external IP to the container, in a single restore", func() {
+			err := manager.NetIn(
+				logger,
+				iptables_manager.NetIn{Protocol: "tcp", HostPort: 1234, ContainerPort: 5678},
+				iptables_manager.NetIn{Protocol: "udp", HostPort: 53, ContainerPort: 5353},
+			)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(restored).Should(Equal([]string{
+				"*nat\n" +
+					"-A w-1-nat-some-id --protocol tcp --destination 1.2.3.4 --destination-port 1234 --jump DNAT --to-destination 10.2.0.2:5678\n" +
+					"-A w-1-nat-some-id --protocol udp --destination 1.2.3.4 --destination-port 53 --jump DNAT --to-destination 10.2.0.2:5353\n" +
+					"COMMIT\n",
+			}))
+		})
+
+		It("DNATs a range of host ports to the same ports of the container with a single rule", func() {
+			err := manager.NetIn(logger, iptables_manager.NetIn{Protocol: "udp", HostPort: 6000, ContainerPort: 6000, Count: 100})
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(restored).Should(Equal([]string{
+				"*nat\n" +
+					"-A w-1-nat-some-id --protocol udp --destination 1.2.3.4 --destination-port 6000:6099 --jump DNAT --to-destination 10.2.0.2\n" +
+					"COMMIT\n",
+			}))
+		})
+
+		It("defaults to tcp", func() {
+			err := manager.NetIn(logger, iptables_manager.NetIn{HostPort: 1234, ContainerPort: 5678})
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(restored).Should(HaveLen(1))
+			Ω(restored[0]).Should(ContainSubstring("--protocol tcp "))
+		})
+
+		It("does nothing for no rules", func() {
+			err := manager.NetIn(logger)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(fakeRunner.ExecutedCommands()).Should(BeEmpty())
+		})
+
+		Context("when the external IP cannot be found", func() {
+			BeforeEach(func() {
+				externalIPErr = errors.New("network is unreachable")
+			})
+
+			It("returns the error without changing anything", func() {
+				err := manager.NetIn(logger, iptables_manager.NetIn{HostPort: 1234, ContainerPort: 5678})
+				Ω(err).Should(Equal(externalIPErr))
+
+				Ω(fakeRunner.ExecutedCommands()).Should(BeEmpty())
+			})
+		})
+	})
+
+	Describe("NetOut", func() {
+		It("returns matching traffic from the instance chain, in a single restore", func() {
+			err := manager.NetOut(
+				logger,
+				iptables_manager.NetOut{Protocol: "tcp", Network: "10.0.0.0-10.0.0.255", Port: "80:90"},
+				iptables_manager.NetOut{Protocol: "all", Network: "8.8.8.8-8.8.8.8"},
+				iptables_manager.NetOut{Protocol: "icmp", ICMPType: "8", ICMPCode: "0"},
+				iptables_manager.NetOut{Protocol: "icmp", ICMPType: "3"},
+			)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(restored).Should(Equal([]string{
+				"*filter\n" +
+					"-I w-1-instance-some-id 1 --protocol tcp -m iprange --dst-range 10.0.0.0-10.0.0.255 --destination-port 80:90 --jump RETURN\n" +
+					"-I w-1-instance-some-id 1 -m iprange --dst-range 8.8.8.8-8.8.8.8 --jump RETURN\n" +
+					"-I w-1-instance-some-id 1 --protocol icmp --icmp-type 8/0 --jump RETURN\n" +
+					"-I w-1-instance-some-id 1 --protocol icmp --icmp-type 3 --jump RETURN\n" +
+					"COMMIT\n",
+			}))
+		})
+
+		It("takes a port without a protocol to mean tcp", func() {
+			err := manager.NetOut(logger, iptables_manager.NetOut{Network: "1.2.3.4", Port: "53"})
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(restored).Should(Equal([]string{
+				"*filter\n" +
+					"-I w-1-instance-some-id 1 --protocol tcp --destination 1.2.3.4 --destination-port 53 --jump RETURN\n" +
+					"COMMIT\n",
+			}))
+		})
+
+		It("logs logged traffic before returning it", func() {
+			err := manager.NetOut(logger, iptables_manager.NetOut{Protocol: "udp", Port: "53", Log: true})
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(restored).Should(Equal([]string{
+				"*filter\n" +
+					"-I w-1-instance-some-id 1 --protocol udp --destination-port 53 --jump RETURN\n" +
+					"-I w-1-instance-some-id 1 --protocol udp --destination-port 53 --jump LOG --log-prefix \"w-1-instance-some-id \"\n" +
+					"COMMIT\n",
+			}))
+		})
+	})
+
+	Context("when another process holds the xtables lock", func() {
+		BeforeEach(func() {
+			iptables_manager.RestoreRetryInterval = time.Millisecond
+
+			restoreErr = func(attempt int) error {
+				if attempt < 3 {
+					return errors.New("exit status 4")
+				}
+
+				return nil
+			}
+		})
+
+		AfterEach(func() {
+			iptables_manager.RestoreRetryInterval = 100 * time.Millisecond
+		})
+
+		It("retries until it is released", func() {
+			err := manager.NetOut(logger, iptables_manager.NetOut{Protocol: "udp"})
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(restored).Should(HaveLen(3))
+		})
+
+		Context("for too long", func() {
+			BeforeEach(func() {
+				iptables_manager.RestoreAttempts = 2
+			})
+
+			AfterEach(func() {
+				iptables_manager.RestoreAttempts = 50
+			})
+
+			It("gives up", func() {
+				err := manager.NetOut(logger, iptables_manager.NetOut{Protocol: "udp"})
+				Ω(err).Should(MatchError("exit status 4"))
+
+				Ω(restored).Should(HaveLen(2))
+			})
+		})
+	})
+
+	Context("when the restore fails", func() {
+		BeforeEach(func() {
+			restoreErr = func(int) error {
+				return errors.New("exit status 1")
+			}
+		})
+
+		It("returns the error, after a single attempt", func() {
+			err := manager.NetOut(logger, iptables_manager.NetOut{Protocol: "udp"})
+			Ω(err).Should(MatchError("exit status 1"))
+
+			Ω(fakeRunner.ExecutedCommands()).Should(HaveLen(1))
+		})
+	})
+})
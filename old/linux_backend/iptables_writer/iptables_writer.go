@@ -0,0 +1,83 @@
+// Package iptables_writer serializes the commands that change iptables, so
+// that concurrent creates and destroys do not fight over the kernel's
+// xtables lock.
+package iptables_writer
+
+import (
+	"os/exec"
+	"path"
+
+	"github.com/cloudfoundry/gunk/command_runner"
+)
+
+// net.sh actions that change iptables; the rest only read it
+var writingNetActions = map[string]bool{
+	"setup":          true,
+	"teardown":       true,
+	"grow_pool":      true,
+	"filter_default": true,
+}
+
+// scripts that change iptables through net.sh, and the iptables-restore
+// through which container rules are applied
+var writingScripts = map[string]bool{
+	"setup.sh":         true,
+	"destroy.sh":       true,
+	"iptables-restore": true,
+}
+
+type writer struct {
+	command_runner.CommandRunner
+
+	writes chan write
+}
+
+type write struct {
+	cmd    *exec.Cmd
+	result chan<- error
+}
+
+// New returns a command runner that runs the commands that change iptables
+// one at a time, on a single goroutine, and any others straight away.
+// Only Run is serialized; commands that change iptables are never started
+// in the background.
+func New(commandRunner command_runner.CommandRunner) command_runner.CommandRunner {
+	writer := &writer{
+		CommandRunner: commandRunner,
+
+		writes: make(chan write),
+	}
+
+	go writer.write()
+
+	return writer
+}
+
+func (writer *writer) Run(cmd *exec.Cmd) error {
+	if !WritesIPTables(cmd) {
+		return writer.CommandRunner.Run(cmd)
+	}
+
+	result := make(chan error, 1)
+
+	writer.writes <- write{cmd: cmd, result: result}
+
+	return <-result
+}
+
+func (writer *writer) write() {
+	for write := range writer.writes {
+		write.result <- writer.CommandRunner.Run(write.cmd)
+	}
+}
+
+// WritesIPTables reports whether the command changes iptables.
+func WritesIPTables(cmd *exec.Cmd) bool {
+	script := path.Base(cmd.Path)
+
+	if script == "net.sh" {
+		return len(cmd.Args) > 1 && writingNetActions[cmd.Args[1]]
+	}
+
+	return writingScripts[script]
+}
@@ -0,0 +1,13 @@
+package iptables_writer_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"testing"
+)
+
+func TestIPTablesWriter(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "IPTables Writer Suite")
+}
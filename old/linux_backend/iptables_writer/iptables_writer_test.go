@@ -0,0 +1,133 @@
+package iptables_writer_test
+
+import (
+	"errors"
+	"os/exec"
+
+	"github.com/cloudfoundry/gunk/command_runner"
+	"github.com/cloudfoundry/gunk/command_runner/fake_command_runner"
+	. "github.com/cloudfoundry/gunk/command_runner/fake_command_runner/matchers"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/cloudfoundry-incubator/garden-linux/old/linux_backend/iptables_writer"
+)
+
+var _ = Describe("IPTables writer", func() {
+	var fakeRunner *fake_command_runner.FakeCommandRunner
+	var writer command_runner.CommandRunner
+
+	var setupStarted chan struct{}
+	var finishSetup chan struct{}
+
+	BeforeEach(func() {
+		fakeRunner = fake_command_runner.New()
+		writer = iptables_writer.New(fakeRunner)
+
+		setupStarted = make(chan struct{}, 1)
+		finishSetup = make(chan struct{})
+
+		fakeRunner.WhenRunning(
+			fake_command_runner.CommandSpec{
+				Path: "/depot/some-id/net.sh",
+				Args: []string{"setup"},
+			},
+			func(*exec.Cmd) error {
+				setupStarted <- struct{}{}
+				<-finishSetup
+				return nil
+			},
+		)
+	})
+
+	runInBackground := func(cmd *exec.Cmd) <-chan error {
+		result := make(chan error, 1)
+
+		go func() {
+			result <- writer.Run(cmd)
+		}()
+
+		return result
+	}
+
+	It("runs commands that change iptables one at a time", func() {
+		setup := runInBackground(exec.Command("/depot/some-id/net.sh", "setup"))
+		Eventually(setupStarted).Should(Receive())
+
+		teardown := runInBackground(exec.Command("/depot/other-id/net.sh", "teardown"))
+		destroy := runInBackground(exec.Command("/bin/destroy.sh", "/depot/another-id"))
+
+		Consistently(teardown).ShouldNot(Receive())
+		Consistently(destroy).ShouldNot(Receive())
+
+		Ω(fakeRunner).ShouldNot(HaveExecutedSerially(
+			fake_command_runner.CommandSpec{
+				Path: "/depot/other-id/net.sh",
+			},
+		))
+
+		close(finishSetup)
+
+		Eventually(setup).Should(Receive(BeNil()))
+		Eventually(teardown).Should(Receive(BeNil()))
+		Eventually(destroy).Should(Receive(BeNil()))
+	})
+
+	It("runs commands that only read iptables straight away", func() {
+		runInBackground(exec.Command("/depot/some-id/net.sh", "setup"))
+		Eventually(setupStarted).Should(Receive())
+
+		check := runInBackground(exec.Command("/depot/other-id/net.sh", "check"))
+		Eventually(check).Should(Receive(BeNil()))
+
+		close(finishSetup)
+	})
+
+	It("returns each command's error to its caller", func() {
+		disaster := errors.New("oh no!")
+
+		fakeRunner.WhenRunning(
+			fake_command_runner.CommandSpec{
+				Path: "/depot/some-id/net.sh",
+				Args: []string{"grow_pool"},
+			},
+			func(*exec.Cmd) error {
+				return disaster
+			},
+		)
+
+		err := writer.Run(exec.Command("/depot/some-id/net.sh", "grow_pool"))
+		Ω(err).Should(Equal(disaster))
+
+		err = writer.Run(exec.Command("/depot/some-id/net.sh", "teardown"))
+		Ω(err).ShouldNot(HaveOccurred())
+	})
+
+	Describe("WritesIPTables", func() {
+		It("is true of net.sh actions that change iptables", func() {
+			for _, action := range []string{"setup", "teardown", "grow_pool", "filter_default"} {
+				Ω(iptables_writer.WritesIPTables(exec.Command("/some/net.sh", action))).Should(BeTrue())
+			}
+		})
+
+		It("is false of net.sh actions that only read iptables", func() {
+			for _, action := range []string{"check", "check_links", "check_gateway", "usage", "get_egress_info"} {
+				Ω(iptables_writer.WritesIPTables(exec.Command("/some/net.sh", action))).Should(BeFalse())
+			}
+		})
+
+		It("is true of the scripts that set up the host and destroy containers", func() {
+			Ω(iptables_writer.WritesIPTables(exec.Command("/bin/setup.sh"))).Should(BeTrue())
+			Ω(iptables_writer.WritesIPTables(exec.Command("/bin/destroy.sh", "/depot/some-id"))).Should(BeTrue())
+		})
+
+		It("is true of iptables-restore", func() {
+			Ω(iptables_writer.WritesIPTables(exec.Command("iptables-restore", "--noflush"))).Should(BeTrue())
+		})
+
+		It("is false of other commands", func() {
+			Ω(iptables_writer.WritesIPTables(exec.Command("/depot/some-id/start.sh"))).Should(BeFalse())
+			Ω(iptables_writer.WritesIPTables(exec.Command("rm", "-rf", "/depot/some-id"))).Should(BeFalse())
+		})
+	})
+})
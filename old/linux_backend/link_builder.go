@@ -0,0 +1,43 @@
+package linux_backend
+
+import (
+	"io/ioutil"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/pivotal-golang/lager"
+)
+
+// LinkBuilder makes a started container's network links, in the network
+// namespace of the given PID, in place of the veth pairs its hooks would
+// otherwise make, e.g. where an SDN controller wires containers up itself.
+type LinkBuilder interface {
+	BuildLinks(logger lager.Logger, pid int) error
+}
+
+// SetLinkBuilder has the builder make the container's links when it is
+// started. The container must have been created without its own links. A
+// container with a link builder is not checked for links or a gateway of
+// its own, as the builder's links need not look like them.
+func (c *LinuxContainer) SetLinkBuilder(builder LinkBuilder) {
+	c.linkBuilder = builder
+}
+
+func (c *LinuxContainer) buildLinks(logger lager.Logger) error {
+	pid, err := c.wshdPID()
+	if err != nil {
+		return err
+	}
+
+	return c.linkBuilder.BuildLinks(logger, pid)
+}
+
+func (c *LinuxContainer) wshdPID() (int, error) {
+	contents, err := ioutil.ReadFile(path.Join(c.path, "run", "wshd.pid"))
+	if err != nil {
+		return 0, err
+	}
+
+	return strconv.Atoi(strings.TrimSpace(string(contents)))
+}
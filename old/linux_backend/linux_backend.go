@@ -1,16 +1,20 @@
 package linux_backend
 
 import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
 	"fmt"
 	"io"
-	"io/ioutil"
-	"os"
-	"path"
+	"net"
+	"sort"
+	"strconv"
 	"sync"
 	"time"
 
 	"github.com/cloudfoundry-incubator/garden-linux/old/system_info"
 	"github.com/cloudfoundry-incubator/garden/api"
+	"github.com/cloudfoundry/dropsonde/metric_sender"
 	"github.com/pivotal-golang/lager"
 )
 
@@ -18,8 +22,32 @@ type Container interface {
 	ID() string
 	Properties() api.Properties
 	GraceTime() time.Duration
+	RootFSProvenance() RootFSProvenance
 
 	Start(mtu uint32) error
+	VerifyStart() error
+	ReconcileNetwork() error
+	MarkDestroying()
+	Break(reason string)
+	CheckDaemon() error
+
+	SampleUsage(keep int) error
+	UsageHistory() []UsageSample
+	UsageSummary() (UsageSummary, error)
+
+	CommittedResources() CommittedResources
+	SetLimitAdmitter(LimitAdmitter)
+	SetPortReservations(PortReservations)
+
+	CheckCoreDumps() error
+
+	AddNetOutRule(NetOutRule) error
+	BulkNetOut([]NetOutRule) error
+	NetInProtocol(protocol Protocol, hostPort uint32, containerPort uint32) (uint32, uint32, error)
+	NetInRange(protocol Protocol, hostPortStart uint32, containerPortStart uint32, count uint32) (NetInSpec, error)
+
+	StartCapture(CaptureLimits) (string, error)
+	StopCapture() error
 
 	Snapshot(io.Writer) error
 	Cleanup()
@@ -31,21 +59,120 @@ type ContainerPool interface {
 	Setup() error
 	Create(api.ContainerSpec) (Container, error)
 	Restore(io.Reader) (Container, error)
+	Preclaim([]ContainerSnapshot) error
 	Destroy(Container) error
 	Prune(keep map[string]bool) error
 	MaxContainers() int
+	Utilization() []PoolUtilization
+	SwapAccounting() bool
+	GrowPortPool(size uint32) error
+	GrowNetworkPool(*net.IPNet) error
+
+	// AcquirePort takes the given host port, or any if it is 0, from the
+	// pool without giving it to a container; ReleasePort returns it.
+	AcquirePort(port uint32) (uint32, error)
+	ReleasePort(port uint32)
+}
+
+// SnapshotStore keeps containers' snapshots, by container ID, while the
+// server is down.
+type SnapshotStore interface {
+	Load(lager.Logger) (map[string][]byte, error)
+	Save(id string, snapshot []byte) error
+
+	// Clear removes every snapshot, leaving the store ready for new ones.
+	Clear() error
+
+	// the host's boot ID when the snapshots were saved, or "" if unknown
+	LoadBootID() (string, error)
+	SaveBootID(bootID string) error
+
+	// the host ports reserved when the snapshots were saved
+	LoadReservedPorts() ([]uint32, error)
+	SaveReservedPorts(ports []uint32) error
+}
+
+// PoolUtilization is how much of one of the pools that containers draw
+// resources from is free.
+type PoolUtilization struct {
+	Pool  string
+	Free  int
+	Total int
+}
+
+// CommittedCapacity is the host's capacity alongside how much of it is
+// committed to existing containers by their limits, so that schedulers can
+// place containers by reservation rather than racing each other for what
+// is free. Containers without a memory or disk limit commit none of it.
+type CommittedCapacity struct {
+	api.Capacity
+
+	CommittedMemoryInBytes uint64
+	CommittedDiskInBytes   uint64
+	Containers             uint64
+}
+
+// Capabilities are what the host's kernel lets the backend enforce.
+type Capabilities struct {
+	// without it, memory limits do not include swap
+	SwapAccounting bool
+}
+
+// StartVerification is how hard to try to verify that a newly started
+// container is usable before giving up on it.
+type StartVerification struct {
+	// zero disables verification
+	Attempts int
+
+	// how long to wait between attempts
+	Interval time.Duration
 }
 
 type LinuxBackend struct {
 	logger lager.Logger
 
-	containerPool ContainerPool
-	systemInfo    system_info.Provider
-	snapshotsPath string
-	mtu           uint32
+	containerPool     ContainerPool
+	systemInfo        system_info.Provider
+	snapshotStore     SnapshotStore
+	mtu               uint32
+	startVerification StartVerification
 
-	containers      map[string]Container
-	containersMutex *sync.RWMutex
+	containers *containerRegistry
+
+	pressure      error
+	pressureMutex sync.RWMutex
+
+	finalUsageSender metric_sender.MetricSender
+	usageExporter    UsageExporter
+
+	snapshotUploader SnapshotUploader
+	backedUp         map[string][sha256.Size]byte
+	backupsListed    bool
+	backupMutex      sync.Mutex
+
+	overcommit  OvercommitFactors
+	commitMutex sync.Mutex
+
+	reservedPorts      map[uint32]bool
+	reservedPortsMutex sync.Mutex
+}
+
+// UsageExporter accounts for containers' usage, e.g. for chargeback, from
+// successive summaries of it, the last of which is taken as each container
+// is destroyed.
+type UsageExporter interface {
+	Observe(handle string, tags map[string]string, at time.Time, usage UsageSummary)
+	ObserveFinal(handle string, tags map[string]string, at time.Time, usage UsageSummary)
+
+	// Flush delivers what has been accounted for since it last succeeded.
+	Flush() error
+}
+
+// PressureThresholds are the least free memory and disk, in bytes, that the
+// host must have for containers to be created. Zero disables a check.
+type PressureThresholds struct {
+	MinFreeMemory uint64
+	MinFreeDisk   uint64
 }
 
 type UnknownHandleError struct {
@@ -56,6 +183,14 @@ func (e UnknownHandleError) Error() string {
 	return "unknown handle: " + e.Handle
 }
 
+type UnknownContainerIDError struct {
+	ID string
+}
+
+func (e UnknownContainerIDError) Error() string {
+	return "unknown container id: " + e.ID
+}
+
 type HandleExistsError struct {
 	Handle string
 }
@@ -64,6 +199,38 @@ func (e HandleExistsError) Error() string {
 	return fmt.Sprintf("handle already exists: %s", e.Handle)
 }
 
+type HostUnderPressureError struct {
+	Resource  string
+	Free      uint64
+	Threshold uint64
+}
+
+func (e HostUnderPressureError) Error() string {
+	return fmt.Sprintf(
+		"host under pressure: %d bytes of %s free, below the threshold of %d",
+		e.Free,
+		e.Resource,
+		e.Threshold,
+	)
+}
+
+// InvalidMTUError is returned for an MTUProperty that is not a number from
+// MinMTU to the host's MTU.
+type InvalidMTUError struct {
+	Requested string
+
+	// set if the requested MTU exceeds it
+	HostMTU uint32
+}
+
+func (e InvalidMTUError) Error() string {
+	if e.HostMTU != 0 {
+		return fmt.Sprintf("invalid MTU %s: exceeds the host's MTU of %d", e.Requested, e.HostMTU)
+	}
+
+	return fmt.Sprintf("invalid MTU %q: must be a number no less than %d", e.Requested, MinMTU)
+}
+
 type FailedToSnapshotError struct {
 	OriginalError error
 }
@@ -72,17 +239,21 @@ func (e FailedToSnapshotError) Error() string {
 	return fmt.Sprintf("failed to save snapshot: %s", e.OriginalError)
 }
 
-func New(logger lager.Logger, containerPool ContainerPool, systemInfo system_info.Provider, snapshotsPath string, mtu uint32) *LinuxBackend {
+// New returns a backend that restores its containers from snapshotStore on
+// Start and saves them there on Stop. A nil snapshotStore disables this.
+func New(logger lager.Logger, containerPool ContainerPool, systemInfo system_info.Provider, snapshotStore SnapshotStore, mtu uint32, startVerification StartVerification) *LinuxBackend {
 	return &LinuxBackend{
 		logger: logger.Session("backend"),
 
-		containerPool: containerPool,
-		systemInfo:    systemInfo,
-		snapshotsPath: snapshotsPath,
-		mtu:           mtu,
+		containerPool:     containerPool,
+		systemInfo:        systemInfo,
+		snapshotStore:     snapshotStore,
+		mtu:               mtu,
+		startVerification: startVerification,
 
-		containers:      make(map[string]Container),
-		containersMutex: new(sync.RWMutex),
+		containers: newContainerRegistry(),
+
+		reservedPorts: map[uint32]bool{},
 	}
 }
 
@@ -91,14 +262,11 @@ func (b *LinuxBackend) Setup() error {
 }
 
 func (b *LinuxBackend) Start() error {
-	if b.snapshotsPath != "" {
-		_, err := os.Stat(b.snapshotsPath)
-		if err == nil {
-			b.restoreSnapshots()
-			os.RemoveAll(b.snapshotsPath)
-		}
+	if b.snapshotStore != nil {
+		b.restoreSnapshots()
+		b.restorePortReservations()
 
-		err = os.MkdirAll(b.snapshotsPath, 0755)
+		err := b.snapshotStore.Clear()
 		if err != nil {
 			return err
 		}
@@ -106,11 +274,7 @@ func (b *LinuxBackend) Start() error {
 
 	keep := map[string]bool{}
 
-	b.containersMutex.RLock()
-	containers := b.containers
-	b.containersMutex.RUnlock()
-
-	for _, container := range containers {
+	for _, container := range b.containers.all() {
 		keep[container.ID()] = true
 	}
 
@@ -139,15 +303,83 @@ func (b *LinuxBackend) Capacity() (api.Capacity, error) {
 	}, nil
 }
 
+func (b *LinuxBackend) CommittedCapacity() (CommittedCapacity, error) {
+	capacity, err := b.Capacity()
+	if err != nil {
+		return CommittedCapacity{}, err
+	}
+
+	resources := b.committedResources("")
+
+	return CommittedCapacity{
+		Capacity: capacity,
+
+		CommittedMemoryInBytes: resources.MemoryInBytes,
+		CommittedDiskInBytes:   resources.DiskInBytes,
+		Containers:             uint64(len(b.containers.all())),
+	}, nil
+}
+
+// containerMTU is the MTU requested by MTUProperty, or else the server's.
+func (b *LinuxBackend) containerMTU(properties api.Properties) (uint32, error) {
+	requested, found := properties[MTUProperty]
+	if !found {
+		return b.mtu, nil
+	}
+
+	mtu, err := strconv.ParseUint(requested, 10, 32)
+	if err != nil || mtu < MinMTU {
+		return 0, InvalidMTUError{Requested: requested}
+	}
+
+	hostMTU, err := b.systemInfo.HostMTU()
+	if err != nil {
+		return 0, err
+	}
+
+	if uint32(mtu) > hostMTU {
+		return 0, InvalidMTUError{Requested: requested, HostMTU: hostMTU}
+	}
+
+	return uint32(mtu), nil
+}
+
 func (b *LinuxBackend) Create(spec api.ContainerSpec) (api.Container, error) {
 	if spec.Handle != "" {
-		b.containersMutex.RLock()
-		_, exists := b.containers[spec.Handle]
-		b.containersMutex.RUnlock()
-
-		if exists {
-			return nil, HandleExistsError{Handle: spec.Handle}
+		err := b.containers.reserve(spec.Handle)
+		if err != nil {
+			return nil, err
 		}
+
+		defer b.containers.unreserve(spec.Handle)
+	}
+
+	b.pressureMutex.RLock()
+	pressure := b.pressure
+	b.pressureMutex.RUnlock()
+
+	if pressure != nil {
+		b.logger.Info("rejected-create-under-pressure", lager.Data{
+			"handle": spec.Handle,
+			"reason": pressure.Error(),
+		})
+
+		return nil, pressure
+	}
+
+	err := b.checkRoomToCommit()
+	if err != nil {
+		b.logger.Info("rejected-create-overcommitted", lager.Data{
+			"handle": spec.Handle,
+			"reason": err.Error(),
+		})
+
+		return nil, err
+	}
+
+	mtu, err := b.containerMTU(spec.Properties)
+	if err != nil {
+		return nil, err
 	}
 
 	container, err := b.containerPool.Create(spec)
@@ -155,57 +387,105 @@ func (b *LinuxBackend) Create(spec api.ContainerSpec) (api.Container, error) {
 		return nil, err
 	}
 
-	err = container.Start(b.mtu)
+	err = container.Start(mtu)
+	if err == nil {
+		err = b.verifyStart(container)
+	}
+
 	if err != nil {
+		// rather than leaving it half-working, holding its resources
+		destroyErr := b.containerPool.Destroy(container)
+		if destroyErr != nil {
+			b.logger.Error("failed-to-destroy-unstarted-container", destroyErr, lager.Data{
+				"container": container.ID(),
+			})
+		}
+
 		return nil, err
 	}
 
-	b.containersMutex.Lock()
-	b.containers[container.Handle()] = container
-	b.containersMutex.Unlock()
+	container.SetLimitAdmitter(b)
+	container.SetPortReservations(b)
+	b.containers.register(container)
 
 	return container, nil
 }
 
-func (b *LinuxBackend) Destroy(handle string) error {
-	b.containersMutex.RLock()
-	container, found := b.containers[handle]
-	b.containersMutex.RUnlock()
+func (b *LinuxBackend) verifyStart(container Container) error {
+	var err error
+
+	for attempt := 1; attempt <= b.startVerification.Attempts; attempt++ {
+		err = container.VerifyStart()
+		if err == nil {
+			return nil
+		}
+
+		b.logger.Error("failed-to-verify-start", err, lager.Data{
+			"container": container.ID(),
+			"attempt":   attempt,
+			"of":        b.startVerification.Attempts,
+		})
 
+		if attempt < b.startVerification.Attempts {
+			time.Sleep(b.startVerification.Interval)
+		}
+	}
+
+	return err
+}
+
+func (b *LinuxBackend) Destroy(handle string) error {
+	container, found := b.containers.lookup(handle)
 	if !found {
 		return UnknownHandleError{handle}
 	}
 
+	// gathered while the container's cgroups still exist, but only exported
+	// once it is gone, so that a container that fails to be destroyed, and is
+	// destroyed again, is neither billed nor counted twice
+	usage, gathered := b.finalUsage(container)
+
+	container.MarkDestroying()
+
 	err := b.containerPool.Destroy(container)
 	if err != nil {
+		// kept, so that it can be seen and destroyed again, rather than its
+		// resources silently leaking
+		container.Break("destroy failed: " + err.Error())
 		return err
 	}
 
-	b.containersMutex.Lock()
-	delete(b.containers, container.Handle())
-	b.containersMutex.Unlock()
+	b.containers.unregister(container)
+
+	if gathered {
+		b.exportFinalUsage(container, usage)
+	}
 
 	return nil
 }
 
 func (b *LinuxBackend) Containers(filter api.Properties) (containers []api.Container, err error) {
-	b.containersMutex.RLock()
-	defer b.containersMutex.RUnlock()
+	for _, container := range b.containers.withProperties(filter) {
+		containers = append(containers, container)
+	}
 
-	for _, container := range b.containers {
-		if containerHasProperties(container, filter) {
-			containers = append(containers, container)
-		}
+	return containers, nil
+}
+
+// ContainersFromImage returns the containers whose rootfs was created from
+// the given image, named as it was requested, by its image ID, or by any
+// layer in its chain, so that they can be found when an image needs
+// replacing.
+func (b *LinuxBackend) ContainersFromImage(image string) (containers []api.Container, err error) {
+	for _, container := range b.containers.fromImage(image) {
+		containers = append(containers, container)
 	}
 
 	return containers, nil
 }
 
 func (b *LinuxBackend) Lookup(handle string) (api.Container, error) {
-	b.containersMutex.RLock()
-	defer b.containersMutex.RUnlock()
-
-	container, found := b.containers[handle]
+	container, found := b.containers.lookup(handle)
 	if !found {
 		return nil, UnknownHandleError{handle}
 	}
@@ -213,15 +493,26 @@ func (b *LinuxBackend) Lookup(handle string) (api.Container, error) {
 	return container, nil
 }
 
+// LookupByID finds a container by its ID, as named in its depot directory
+// and cgroups, rather than by its handle.
+func (b *LinuxBackend) LookupByID(id string) (api.Container, error) {
+	container, found := b.containers.lookupByID(id)
+	if !found {
+		return nil, UnknownContainerIDError{id}
+	}
+
+	return container, nil
+}
+
 func (b *LinuxBackend) GraceTime(container api.Container) time.Duration {
 	return container.(Container).GraceTime()
 }
 
 func (b *LinuxBackend) Stop() {
-	b.containersMutex.RLock()
-	defer b.containersMutex.RUnlock()
+	b.saveBootID()
+	b.savePortReservations()
 
-	for _, container := range b.containers {
+	for _, container := range b.containers.all() {
 		container.Cleanup()
 		err := b.saveSnapshot(container)
 		if err != nil {
@@ -230,41 +521,446 @@ func (b *LinuxBackend) Stop() {
 			})
 		}
 	}
+
+	if b.snapshotUploader != nil {
+		b.BackUpSnapshots()
+	}
+}
+
+// ReconcileNetworks re-installs the network rules of any container whose
+// rules have gone missing from the host.
+func (b *LinuxBackend) ReconcileNetworks() {
+	for _, container := range b.containers.all() {
+		err := container.ReconcileNetwork()
+		if err != nil {
+			b.logger.Error("failed-to-reconcile-network", err, lager.Data{
+				"container": container.ID(),
+			})
+		}
+	}
+}
+
+// MonitorDaemons marks broken any container whose wshd has died, as nothing
+// can run in it any more, and destroys it too if destroyDead is set.
+func (b *LinuxBackend) MonitorDaemons(destroyDead bool) {
+	for _, container := range b.containers.all() {
+		err := container.CheckDaemon()
+		if err == nil {
+			continue
+		}
+
+		if _, dead := err.(DeadDaemonError); !dead {
+			b.logger.Error("failed-to-check-daemon", err, lager.Data{
+				"container": container.ID(),
+			})
+
+			continue
+		}
+
+		b.logger.Error("daemon-died", err, lager.Data{
+			"container": container.ID(),
+		})
+
+		container.Break("wshd died")
+
+		if destroyDead {
+			err := b.Destroy(container.Handle())
+			if err != nil {
+				b.logger.Error("failed-to-destroy-dead-container", err, lager.Data{
+					"container": container.ID(),
+				})
+			}
+		}
+	}
+}
+
+// SampleUsage records the CPU and memory usage of each container, keeping
+// the latest keep samples of each.
+func (b *LinuxBackend) SampleUsage(keep int) {
+	for _, container := range b.containers.all() {
+		err := container.SampleUsage(keep)
+		if err != nil {
+			b.logger.Error("failed-to-sample-usage", err, lager.Data{
+				"container": container.ID(),
+			})
+		}
+	}
+}
+
+// CheckCoreDumps has each container report, as events, the core dumps kept
+// for it since the last check.
+func (b *LinuxBackend) CheckCoreDumps() {
+	for _, container := range b.containers.all() {
+		err := container.CheckCoreDumps()
+		if err != nil {
+			b.logger.Error("failed-to-check-core-dumps", err, lager.Data{
+				"container": container.ID(),
+			})
+		}
+	}
+}
+
+func (b *LinuxBackend) UsageHistory(handle string) ([]UsageSample, error) {
+	container, err := b.Lookup(handle)
+	if err != nil {
+		return nil, err
+	}
+
+	return container.(Container).UsageHistory(), nil
+}
+
+// AddNetOutRule whitelists outbound traffic from a container by a rule the
+// garden API's NetOut cannot express, e.g. udp only, or to a range of ports.
+func (b *LinuxBackend) AddNetOutRule(handle string, rule NetOutRule) error {
+	container, err := b.Lookup(handle)
+	if err != nil {
+		return err
+	}
+
+	return container.(Container).AddNetOutRule(rule)
+}
+
+// BulkNetOut whitelists outbound traffic from a container by several rules
+// at once: either all of them are applied, or none are.
+func (b *LinuxBackend) BulkNetOut(handle string, rules []NetOutRule) error {
+	container, err := b.Lookup(handle)
+	if err != nil {
+		return err
+	}
+
+	return container.(Container).BulkNetOut(rules)
+}
+
+// NetInProtocol maps a host port to a container for a given protocol, which
+// the garden API's NetIn can only do for tcp.
+func (b *LinuxBackend) NetInProtocol(handle string, protocol Protocol, hostPort uint32, containerPort uint32) (uint32, uint32, error) {
+	container, err := b.Lookup(handle)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	return container.(Container).NetInProtocol(protocol, hostPort, containerPort)
+}
+
+// NetInRange maps a contiguous range of host ports to a container with a
+// single rule, which the garden API's NetIn can only do a port at a time.
+func (b *LinuxBackend) NetInRange(handle string, protocol Protocol, hostPortStart uint32, containerPortStart uint32, count uint32) (NetInSpec, error) {
+	container, err := b.Lookup(handle)
+	if err != nil {
+		return NetInSpec{}, err
+	}
+
+	return container.(Container).NetInRange(protocol, hostPortStart, containerPortStart, count)
+}
+
+// StartCapture starts capturing the packets of a container's network,
+// returning where in the container the capture can be streamed out from.
+func (b *LinuxBackend) StartCapture(handle string, limits CaptureLimits) (string, error) {
+	container, err := b.Lookup(handle)
+	if err != nil {
+		return "", err
+	}
+
+	return container.(Container).StartCapture(limits)
 }
 
+func (b *LinuxBackend) StopCapture(handle string) error {
+	container, err := b.Lookup(handle)
+	if err != nil {
+		return err
+	}
+
+	return container.(Container).StopCapture()
+}
+
+// MonitorPressure sends the host's free memory and disk, and how much of
+// each containers' limits commit, as metrics, and
+// rejects creates while either is below its threshold, so that new
+// containers don't destabilize existing ones.
+func (b *LinuxBackend) MonitorPressure(sender metric_sender.MetricSender, thresholds PressureThresholds) {
+	freeMemory, err := b.systemInfo.FreeMemory()
+	if err != nil {
+		b.logger.Error("failed-to-get-free-memory", err)
+		return
+	}
+
+	freeDisk, err := b.systemInfo.FreeDisk()
+	if err != nil {
+		b.logger.Error("failed-to-get-free-disk", err)
+		return
+	}
+
+	sender.SendValue("host.memory.free", float64(freeMemory), "bytes")
+	sender.SendValue("host.disk.free", float64(freeDisk), "bytes")
+
+	committed := b.committedResources("")
+
+	sender.SendValue("host.memory.committed", float64(committed.MemoryInBytes), "bytes")
+	sender.SendValue("host.disk.committed", float64(committed.DiskInBytes), "bytes")
+
+	var pressure error
+	if freeMemory < thresholds.MinFreeMemory {
+		pressure = HostUnderPressureError{"memory", freeMemory, thresholds.MinFreeMemory}
+	} else if freeDisk < thresholds.MinFreeDisk {
+		pressure = HostUnderPressureError{"disk", freeDisk, thresholds.MinFreeDisk}
+	}
+
+	b.pressureMutex.Lock()
+	previous := b.pressure
+	b.pressure = pressure
+	b.pressureMutex.Unlock()
+
+	if pressure != nil {
+		sender.SendValue("host.under_pressure", 1, "bool")
+	} else {
+		sender.SendValue("host.under_pressure", 0, "bool")
+	}
+
+	if pressure != nil && previous == nil {
+		b.logger.Error("host-under-pressure", pressure)
+	} else if pressure == nil && previous != nil {
+		b.logger.Info("host-pressure-relieved")
+	}
+}
+
+// ReportFinalUsage has Destroy send the usage of each container it destroys
+// as metrics, as well as logging it: the peak memory of the latest, and
+// counters of the CPU time, disk writes and network traffic of them all.
+// It must be called before the backend is started.
+func (b *LinuxBackend) ReportFinalUsage(sender metric_sender.MetricSender) {
+	b.finalUsageSender = sender
+}
+
+// ExportUsageWith has ExportUsage, and Destroy, give containers' usage to
+// the exporter. It must be called before the backend is started.
+func (b *LinuxBackend) ExportUsageWith(exporter UsageExporter) {
+	b.usageExporter = exporter
+}
+
+// ExportUsage gives the usage of each container to the exporter, and has it
+// deliver what it has accounted for.
+func (b *LinuxBackend) ExportUsage() {
+	for _, container := range b.containers.all() {
+		summary, err := container.UsageSummary()
+		if err != nil {
+			b.logger.Error("failed-to-summarize-usage", err, lager.Data{
+				"container": container.ID(),
+			})
+
+			continue
+		}
+
+		b.usageExporter.Observe(container.Handle(), MetricTags(container.Properties()), time.Now(), summary)
+	}
+
+	err := b.usageExporter.Flush()
+	if err != nil {
+		b.logger.Error("failed-to-export-usage", err)
+	}
+}
+
+// finalUsage logs the usage of a container about to be destroyed. Failing
+// to gather it does not keep the container from being destroyed.
+func (b *LinuxBackend) finalUsage(container Container) (UsageSummary, bool) {
+	uLog := b.logger.Session("final-usage", lager.Data{
+		"handle": container.Handle(),
+		"tags":   MetricTags(container.Properties()),
+	})
+
+	summary, err := container.UsageSummary()
+	if err != nil {
+		uLog.Error("failed-to-summarize", err)
+		return UsageSummary{}, false
+	}
+
+	uLog.Info("summarized", lager.Data{"usage": summary})
+
+	return summary, true
+}
+
+// exportFinalUsage sends a destroyed container's usage, gathered before it
+// was destroyed, as metrics and to the usage exporter if configured to.
+func (b *LinuxBackend) exportFinalUsage(container Container, summary UsageSummary) {
+	if b.usageExporter != nil {
+		b.usageExporter.ObserveFinal(container.Handle(), MetricTags(container.Properties()), time.Now(), summary)
+	}
+
+	if b.finalUsageSender == nil {
+		return
+	}
+
+	b.finalUsageSender.IncrementCounter("containers.destroyed")
+	b.finalUsageSender.AddToCounter("containers.destroyed.cpu_time", summary.CPUTime)
+	b.finalUsageSender.AddToCounter("containers.destroyed.disk_written", summary.DiskBytesWritten)
+	b.finalUsageSender.AddToCounter("containers.destroyed.network_received", summary.NetworkBytesReceived)
+	b.finalUsageSender.AddToCounter("containers.destroyed.network_sent", summary.NetworkBytesSent)
+	b.finalUsageSender.SendValue("containers.destroyed.peak_memory", float64(summary.PeakMemoryBytes), "bytes")
+}
+
+func (b *LinuxBackend) Capabilities() Capabilities {
+	return Capabilities{
+		SwapAccounting: b.containerPool.SwapAccounting(),
+	}
+}
+
+func (b *LinuxBackend) PoolUtilization() []PoolUtilization {
+	return b.containerPool.Utilization()
+}
+
+// ReportPoolUtilization sends the free and total size of each pool as
+// metrics, and warns of any pool with less than lowWatermark (a fraction of
+// its total) free, so that exhaustion is noticed before creates fail.
+func (b *LinuxBackend) ReportPoolUtilization(sender metric_sender.MetricSender, lowWatermark float64) {
+	for _, pool := range b.containerPool.Utilization() {
+		sender.SendValue("pool."+pool.Pool+".free", float64(pool.Free), "count")
+		sender.SendValue("pool."+pool.Pool+".total", float64(pool.Total), "count")
+
+		if pool.Total > 0 && float64(pool.Free) < lowWatermark*float64(pool.Total) {
+			b.logger.Info("pool-running-low", lager.Data{
+				"pool":  pool.Pool,
+				"free":  pool.Free,
+				"total": pool.Total,
+			})
+		}
+	}
+}
+
+// GrowPortPool and GrowNetworkPool extend the container pool's ports and
+// networks without a restart, so that a busy host need not be evacuated.
+func (b *LinuxBackend) GrowPortPool(size uint32) error {
+	err := b.containerPool.GrowPortPool(size)
+	if err != nil {
+		return err
+	}
+
+	b.logger.Info("grew-port-pool", lager.Data{"size": size})
+
+	return nil
+}
+
+func (b *LinuxBackend) GrowNetworkPool(ipNet *net.IPNet) error {
+	err := b.containerPool.GrowNetworkPool(ipNet)
+	if err != nil {
+		return err
+	}
+
+	b.logger.Info("grew-network-pool", lager.Data{"network": ipNet.String()})
+
+	return nil
+}
+
+// restoreSnapshots restores the saved containers. If the host rebooted since
+// they were saved, their snapshots are marked so that they are re-erected
+// rather than re-attached to.
 func (b *LinuxBackend) restoreSnapshots() {
 	sLog := b.logger.Session("restore")
 
-	entries, err := ioutil.ReadDir(b.snapshotsPath)
+	snapshots, err := b.snapshotStore.Load(sLog)
 	if err != nil {
-		b.logger.Error("failed-to-read-snapshots", err, lager.Data{
-			"from": b.snapshotsPath,
-		})
+		sLog.Error("failed-to-load-snapshots", err)
+		return
 	}
 
-	for _, entry := range entries {
-		snapshot := path.Join(b.snapshotsPath, entry.Name())
+	if len(snapshots) == 0 {
+		return
+	}
 
-		lLog := sLog.Session("load", lager.Data{
-			"snapshot": entry.Name(),
-		})
+	rebooted := b.hostRebooted(sLog)
 
-		lLog.Debug("loading")
+	names := []string{}
+	decoded := []ContainerSnapshot{}
 
-		file, err := os.Open(snapshot)
-		if err != nil {
-			lLog.Error("failed-to-open", err)
+	for name, contents := range snapshots {
+		names = append(names, name)
+
+		// snapshots that cannot be decoded fail to restore below
+		var snapshot ContainerSnapshot
+		if json.Unmarshal(contents, &snapshot) != nil {
+			continue
+		}
+
+		if rebooted {
+			snapshot.HostRebooted = true
+
+			if snapshot.MTU == 0 {
+				snapshot.MTU = b.mtu
+			}
+
+			reerect, err := json.Marshal(snapshot)
+			if err == nil {
+				snapshots[name] = reerect
+			}
 		}
 
-		_, err = b.restore(file)
+		decoded = append(decoded, snapshot)
+	}
+
+	sort.Strings(names)
+
+	// a conflict is only reported here; each container then claims its own
+	// resources, so that only the conflicting ones fail to restore
+	err = b.containerPool.Preclaim(decoded)
+	if err != nil {
+		sLog.Error("failed-to-preclaim", err)
+	}
+
+	for _, name := range names {
+		_, err = b.restore(bytes.NewReader(snapshots[name]))
 		if err != nil {
-			lLog.Error("failed-to-restore", err)
+			sLog.Error("failed-to-restore", err, lager.Data{
+				"snapshot": name,
+			})
 		}
 	}
 }
 
+// hostRebooted says whether the host has rebooted since the snapshots were
+// saved, leaving their containers' processes, cgroups and interfaces gone.
+// When either boot ID is unknown the host is taken not to have rebooted.
+func (b *LinuxBackend) hostRebooted(logger lager.Logger) bool {
+	savedBootID, err := b.snapshotStore.LoadBootID()
+	if err != nil {
+		logger.Error("failed-to-load-boot-id", err)
+		return false
+	}
+
+	bootID, err := b.systemInfo.BootID()
+	if err != nil {
+		logger.Error("failed-to-get-boot-id", err)
+		return false
+	}
+
+	if savedBootID == "" || bootID == "" || savedBootID == bootID {
+		return false
+	}
+
+	logger.Info("host-rebooted", lager.Data{
+		"saved-boot-id": savedBootID,
+		"boot-id":       bootID,
+	})
+
+	return true
+}
+
+func (b *LinuxBackend) saveBootID() {
+	if b.snapshotStore == nil {
+		return
+	}
+
+	bootID, err := b.systemInfo.BootID()
+	if err != nil {
+		b.logger.Error("failed-to-get-boot-id", err)
+		return
+	}
+
+	err = b.snapshotStore.SaveBootID(bootID)
+	if err != nil {
+		b.logger.Error("failed-to-save-boot-id", err)
+	}
+}
+
 func (b *LinuxBackend) saveSnapshot(container Container) error {
-	if b.snapshotsPath == "" {
+	if b.snapshotStore == nil {
 		return nil
 	}
 
@@ -272,32 +968,38 @@ func (b *LinuxBackend) saveSnapshot(container Container) error {
 		"container": container.ID(),
 	})
 
-	snapshotPath := path.Join(b.snapshotsPath, container.ID())
+	snapshot := new(bytes.Buffer)
 
-	snapshot, err := os.Create(snapshotPath)
+	err := container.Snapshot(snapshot)
 	if err != nil {
 		return &FailedToSnapshotError{err}
 	}
 
-	err = container.Snapshot(snapshot)
+	err = b.snapshotStore.Save(container.ID(), snapshot.Bytes())
 	if err != nil {
 		return &FailedToSnapshotError{err}
 	}
 
-	return snapshot.Close()
+	return nil
 }
 
 func (b *LinuxBackend) restore(snapshot io.Reader) (api.Container, error) {
 	container, err := b.containerPool.Restore(snapshot)
 	if err != nil {
-		return nil, err
+		if container == nil {
+			return nil, err
+		}
+
+		// broken, but registered so that it can be seen and destroyed
+		container.Break("restore failed: " + err.Error())
 	}
 
-	b.containersMutex.Lock()
-	b.containers[container.Handle()] = container
-	b.containersMutex.Unlock()
+	// set after restoring, so that restored limits are always applied
+	container.SetLimitAdmitter(b)
+	container.SetPortReservations(b)
+	b.containers.register(container)
 
-	return container, nil
+	return container, err
 }
 
 func containerHasProperties(container Container, properties api.Properties) bool {
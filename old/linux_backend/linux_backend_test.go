@@ -1,8 +1,10 @@
 package linux_backend_test
 
 import (
+	"encoding/json"
 	"errors"
 	"io/ioutil"
+	"net"
 	"os"
 	"path"
 	"time"
@@ -13,8 +15,11 @@ import (
 
 	"github.com/cloudfoundry-incubator/garden-linux/old/linux_backend"
 	"github.com/cloudfoundry-incubator/garden-linux/old/linux_backend/container_pool/fake_container_pool"
+	"github.com/cloudfoundry-incubator/garden-linux/old/linux_backend/fake_linux_backend"
+	"github.com/cloudfoundry-incubator/garden-linux/old/linux_backend/snapshot_store"
 	"github.com/cloudfoundry-incubator/garden-linux/old/system_info/fake_system_info"
 	"github.com/cloudfoundry-incubator/garden/api"
+	"github.com/cloudfoundry/dropsonde/metric_sender/fake"
 )
 
 var logger *lagertest.TestLogger
@@ -31,7 +36,7 @@ var _ = Describe("Setup", func() {
 	BeforeEach(func() {
 		fakeContainerPool = fake_container_pool.New()
 		fakeSystemInfo = fake_system_info.NewFakeProvider()
-		linuxBackend = linux_backend.New(lagertest.NewTestLogger("test"), fakeContainerPool, fakeSystemInfo, "", 1500)
+		linuxBackend = linux_backend.New(lagertest.NewTestLogger("test"), fakeContainerPool, fakeSystemInfo, nil, 1500, linux_backend.StartVerification{})
 	})
 
 	It("sets up the container pool", func() {
@@ -61,7 +66,7 @@ var _ = Describe("Start", func() {
 	It("creates the snapshots directory if it's not already there", func() {
 		snapshotsPath := path.Join(tmpdir, "snapshots")
 
-		linuxBackend := linux_backend.New(logger, fakeContainerPool, fakeSystemInfo, snapshotsPath, 1500)
+		linuxBackend := linux_backend.New(logger, fakeContainerPool, fakeSystemInfo, snapshot_store.NewFileStore(snapshotsPath), 1500, linux_backend.StartVerification{})
 
 		err := linuxBackend.Start()
 		Ω(err).ShouldNot(HaveOccurred())
@@ -82,8 +87,9 @@ var _ = Describe("Start", func() {
 				fakeContainerPool,
 				fakeSystemInfo,
 				// weird scenario: /foo/X/snapshots with X being a file
-				path.Join(tmpfile.Name(), "snapshots"),
+				snapshot_store.NewFileStore(path.Join(tmpfile.Name(), "snapshots")),
 				1500,
+				linux_backend.StartVerification{},
 			)
 
 			err = linuxBackend.Start()
@@ -93,7 +99,7 @@ var _ = Describe("Start", func() {
 
 	Context("when no snapshots directory is given", func() {
 		It("successfully starts", func() {
-			linuxBackend := linux_backend.New(logger, fakeContainerPool, fakeSystemInfo, "", 1500)
+			linuxBackend := linux_backend.New(logger, fakeContainerPool, fakeSystemInfo, nil, 1500, linux_backend.StartVerification{})
 
 			err := linuxBackend.Start()
 			Ω(err).ShouldNot(HaveOccurred())
@@ -123,7 +129,7 @@ var _ = Describe("Start", func() {
 		})
 
 		It("restores them via the container pool", func() {
-			linuxBackend := linux_backend.New(logger, fakeContainerPool, fakeSystemInfo, snapshotsPath, 1500)
+			linuxBackend := linux_backend.New(logger, fakeContainerPool, fakeSystemInfo, snapshot_store.NewFileStore(snapshotsPath), 1500, linux_backend.StartVerification{})
 
 			Ω(fakeContainerPool.RestoredSnapshots).Should(BeEmpty())
 
@@ -134,7 +140,7 @@ var _ = Describe("Start", func() {
 		})
 
 		It("removes the snapshots", func() {
-			linuxBackend := linux_backend.New(logger, fakeContainerPool, fakeSystemInfo, snapshotsPath, 1500)
+			linuxBackend := linux_backend.New(logger, fakeContainerPool, fakeSystemInfo, snapshot_store.NewFileStore(snapshotsPath), 1500, linux_backend.StartVerification{})
 
 			Ω(fakeContainerPool.RestoredSnapshots).Should(BeEmpty())
 
@@ -149,7 +155,7 @@ var _ = Describe("Start", func() {
 		})
 
 		It("registers the containers", func() {
-			linuxBackend := linux_backend.New(logger, fakeContainerPool, fakeSystemInfo, snapshotsPath, 1500)
+			linuxBackend := linux_backend.New(logger, fakeContainerPool, fakeSystemInfo, snapshot_store.NewFileStore(snapshotsPath), 1500, linux_backend.StartVerification{})
 
 			err := linuxBackend.Start()
 			Ω(err).ShouldNot(HaveOccurred())
@@ -161,7 +167,7 @@ var _ = Describe("Start", func() {
 		})
 
 		It("keeps them when pruning the container pool", func() {
-			linuxBackend := linux_backend.New(logger, fakeContainerPool, fakeSystemInfo, snapshotsPath, 1500)
+			linuxBackend := linux_backend.New(logger, fakeContainerPool, fakeSystemInfo, snapshot_store.NewFileStore(snapshotsPath), 1500, linux_backend.StartVerification{})
 
 			err := linuxBackend.Start()
 			Ω(err).ShouldNot(HaveOccurred())
@@ -173,6 +179,153 @@ var _ = Describe("Start", func() {
 			}))
 		})
 
+		Context("when the store validates them", func() {
+			It("restores only those that are valid snapshots, moving the others aside", func() {
+				snapshot, err := json.Marshal(linux_backend.ContainerSnapshot{
+					ID:     "some-snapshotted-id",
+					Handle: "some-snapshotted-handle",
+				})
+				Ω(err).ShouldNot(HaveOccurred())
+
+				err = ioutil.WriteFile(path.Join(snapshotsPath, "some-snapshotted-id"), snapshot, 0644)
+				Ω(err).ShouldNot(HaveOccurred())
+
+				store := snapshot_store.NewFileStore(snapshotsPath)
+				store.Validate = linux_backend.ValidateSnapshot
+
+				linuxBackend := linux_backend.New(logger, fakeContainerPool, fakeSystemInfo, store, 1500, linux_backend.StartVerification{})
+
+				err = linuxBackend.Start()
+				Ω(err).ShouldNot(HaveOccurred())
+
+				Ω(fakeContainerPool.RestoredSnapshots).Should(HaveLen(1))
+
+				_, err = linuxBackend.Lookup("some-snapshotted-handle")
+				Ω(err).ShouldNot(HaveOccurred())
+
+				corrupt, err := ioutil.ReadDir(path.Join(snapshotsPath+".state", "corrupt"))
+				Ω(err).ShouldNot(HaveOccurred())
+				Ω(corrupt).Should(HaveLen(2))
+			})
+		})
+
+		Context("when preclaiming their resources fails", func() {
+			BeforeEach(func() {
+				fakeContainerPool.PreclaimError = errors.New("failed to preclaim")
+			})
+
+			It("restores them anyway", func() {
+				linuxBackend := linux_backend.New(logger, fakeContainerPool, fakeSystemInfo, snapshot_store.NewFileStore(snapshotsPath), 1500, linux_backend.StartVerification{})
+
+				err := linuxBackend.Start()
+				Ω(err).ShouldNot(HaveOccurred())
+
+				Ω(fakeContainerPool.RestoredSnapshots).Should(HaveLen(2))
+			})
+		})
+
+		Context("when the host has rebooted since they were saved", func() {
+			BeforeEach(func() {
+				snapshot, err := json.Marshal(linux_backend.ContainerSnapshot{
+					ID:     "some-snapshotted-id",
+					Handle: "some-snapshotted-handle",
+				})
+				Ω(err).ShouldNot(HaveOccurred())
+
+				err = ioutil.WriteFile(path.Join(snapshotsPath, "some-snapshotted-id"), snapshot, 0644)
+				Ω(err).ShouldNot(HaveOccurred())
+
+				err = snapshot_store.NewFileStore(snapshotsPath).SaveBootID("some-old-boot-id")
+				Ω(err).ShouldNot(HaveOccurred())
+
+				fakeSystemInfo.BootIDResult = "some-new-boot-id"
+			})
+
+			It("restores them to be re-erected, with the server's MTU if they have none", func() {
+				linuxBackend := linux_backend.New(logger, fakeContainerPool, fakeSystemInfo, snapshot_store.NewFileStore(snapshotsPath), 1500, linux_backend.StartVerification{})
+
+				err := linuxBackend.Start()
+				Ω(err).ShouldNot(HaveOccurred())
+
+				Ω(fakeContainerPool.RestoredSnapshots).Should(HaveLen(3))
+
+				var restored linux_backend.ContainerSnapshot
+				err = json.NewDecoder(fakeContainerPool.RestoredSnapshots[2]).Decode(&restored)
+				Ω(err).ShouldNot(HaveOccurred())
+
+				Ω(restored.Handle).Should(Equal("some-snapshotted-handle"))
+				Ω(restored.HostRebooted).Should(BeTrue())
+				Ω(restored.MTU).Should(Equal(uint32(1500)))
+			})
+
+			Context("but the boot ID cannot be determined", func() {
+				BeforeEach(func() {
+					fakeSystemInfo.BootIDError = errors.New("no /proc")
+				})
+
+				It("restores them as usual", func() {
+					linuxBackend := linux_backend.New(logger, fakeContainerPool, fakeSystemInfo, snapshot_store.NewFileStore(snapshotsPath), 1500, linux_backend.StartVerification{})
+
+					err := linuxBackend.Start()
+					Ω(err).ShouldNot(HaveOccurred())
+
+					var restored linux_backend.ContainerSnapshot
+					err = json.NewDecoder(fakeContainerPool.RestoredSnapshots[2]).Decode(&restored)
+					Ω(err).ShouldNot(HaveOccurred())
+
+					Ω(restored.HostRebooted).Should(BeFalse())
+				})
+			})
+		})
+
+		Context("when the host has not rebooted since they were saved", func() {
+			It("restores them as usual", func() {
+				snapshot, err := json.Marshal(linux_backend.ContainerSnapshot{
+					ID:     "some-snapshotted-id",
+					Handle: "some-snapshotted-handle",
+				})
+				Ω(err).ShouldNot(HaveOccurred())
+
+				err = ioutil.WriteFile(path.Join(snapshotsPath, "some-snapshotted-id"), snapshot, 0644)
+				Ω(err).ShouldNot(HaveOccurred())
+
+				err = snapshot_store.NewFileStore(snapshotsPath).SaveBootID("some-boot-id")
+				Ω(err).ShouldNot(HaveOccurred())
+
+				fakeSystemInfo.BootIDResult = "some-boot-id"
+
+				linuxBackend := linux_backend.New(logger, fakeContainerPool, fakeSystemInfo, snapshot_store.NewFileStore(snapshotsPath), 1500, linux_backend.StartVerification{})
+
+				err = linuxBackend.Start()
+				Ω(err).ShouldNot(HaveOccurred())
+
+				var restored linux_backend.ContainerSnapshot
+				err = json.NewDecoder(fakeContainerPool.RestoredSnapshots[2]).Decode(&restored)
+				Ω(err).ShouldNot(HaveOccurred())
+
+				Ω(restored.HostRebooted).Should(BeFalse())
+				Ω(restored.MTU).Should(BeZero())
+			})
+		})
+
+		Context("when restoring the container fails once it is built", func() {
+			BeforeEach(func() {
+				fakeContainerPool.RestoreBrokenError = errors.New("failed to rebuild network")
+			})
+
+			It("registers the containers as broken", func() {
+				linuxBackend := linux_backend.New(logger, fakeContainerPool, fakeSystemInfo, snapshot_store.NewFileStore(snapshotsPath), 1500, linux_backend.StartVerification{})
+
+				err := linuxBackend.Start()
+				Ω(err).ShouldNot(HaveOccurred())
+
+				container, err := linuxBackend.Lookup("handle-a")
+				Ω(err).ShouldNot(HaveOccurred())
+
+				Ω(container.(*fake_container_pool.FakeContainer).BrokenReason).Should(Equal("restore failed: failed to rebuild network"))
+			})
+		})
+
 		Context("when restoring the container fails", func() {
 			disaster := errors.New("failed to restore")
 
@@ -181,7 +334,7 @@ var _ = Describe("Start", func() {
 			})
 
 			It("successfully starts anyway", func() {
-				linuxBackend := linux_backend.New(logger, fakeContainerPool, fakeSystemInfo, snapshotsPath, 1500)
+				linuxBackend := linux_backend.New(logger, fakeContainerPool, fakeSystemInfo, snapshot_store.NewFileStore(snapshotsPath), 1500, linux_backend.StartVerification{})
 
 				err := linuxBackend.Start()
 				Ω(err).ShouldNot(HaveOccurred())
@@ -190,7 +343,7 @@ var _ = Describe("Start", func() {
 	})
 
 	It("prunes the container pool", func() {
-		linuxBackend := linux_backend.New(logger, fakeContainerPool, fakeSystemInfo, "", 1500)
+		linuxBackend := linux_backend.New(logger, fakeContainerPool, fakeSystemInfo, nil, 1500, linux_backend.StartVerification{})
 
 		err := linuxBackend.Start()
 		Ω(err).ShouldNot(HaveOccurred())
@@ -207,7 +360,7 @@ var _ = Describe("Start", func() {
 		})
 
 		It("returns the error", func() {
-			linuxBackend := linux_backend.New(logger, fakeContainerPool, fakeSystemInfo, "", 1500)
+			linuxBackend := linux_backend.New(logger, fakeContainerPool, fakeSystemInfo, nil, 1500, linux_backend.StartVerification{})
 
 			err := linuxBackend.Start()
 			Ω(err).Should(Equal(disaster))
@@ -218,6 +371,7 @@ var _ = Describe("Start", func() {
 var _ = Describe("Stop", func() {
 	var fakeContainerPool *fake_container_pool.FakeContainerPool
 	var fakeSystemInfo *fake_system_info.FakeProvider
+	var snapshotStore *snapshot_store.FileStore
 	var linuxBackend *linux_backend.LinuxBackend
 
 	BeforeEach(func() {
@@ -225,12 +379,18 @@ var _ = Describe("Stop", func() {
 		Ω(err).ShouldNot(HaveOccurred())
 
 		fakeContainerPool = fake_container_pool.New()
+		fakeSystemInfo = fake_system_info.NewFakeProvider()
+		fakeSystemInfo.BootIDResult = "some-boot-id"
+
+		snapshotStore = snapshot_store.NewFileStore(path.Join(tmpdir, "snapshots"))
+
 		linuxBackend = linux_backend.New(
 			logger,
 			fakeContainerPool,
 			fakeSystemInfo,
-			path.Join(tmpdir, "snapshots"),
+			snapshotStore,
 			1500,
+			linux_backend.StartVerification{},
 		)
 
 		err = linuxBackend.Start()
@@ -266,6 +426,12 @@ var _ = Describe("Stop", func() {
 		Ω(fakeContainer1.CleanedUp).Should(BeTrue())
 		Ω(fakeContainer2.CleanedUp).Should(BeTrue())
 	})
+
+	It("saves the host's boot ID with the snapshots", func() {
+		linuxBackend.Stop()
+
+		Ω(snapshotStore.LoadBootID()).Should(Equal("some-boot-id"))
+	})
 })
 
 var _ = Describe("Capacity", func() {
@@ -276,7 +442,7 @@ var _ = Describe("Capacity", func() {
 	BeforeEach(func() {
 		fakeContainerPool = fake_container_pool.New()
 		fakeSystemInfo = fake_system_info.NewFakeProvider()
-		linuxBackend = linux_backend.New(logger, fakeContainerPool, fakeSystemInfo, "", 1500)
+		linuxBackend = linux_backend.New(logger, fakeContainerPool, fakeSystemInfo, nil, 1500, linux_backend.StartVerification{})
 	})
 
 	It("returns the right capacity values", func() {
@@ -317,16 +483,74 @@ var _ = Describe("Capacity", func() {
 			Ω(err).Should(Equal(disaster))
 		})
 	})
+
+	Describe("committed capacity", func() {
+		BeforeEach(func() {
+			fakeSystemInfo.TotalMemoryResult = 1111
+			fakeSystemInfo.TotalDiskResult = 2222
+			fakeContainerPool.MaxContainersValue = 42
+		})
+
+		It("returns the host's capacity and the sum of its containers' limits", func() {
+			container1, err := linuxBackend.Create(api.ContainerSpec{})
+			Ω(err).ShouldNot(HaveOccurred())
+
+			container2, err := linuxBackend.Create(api.ContainerSpec{})
+			Ω(err).ShouldNot(HaveOccurred())
+
+			_, err = linuxBackend.Create(api.ContainerSpec{})
+			Ω(err).ShouldNot(HaveOccurred())
+
+			container1.(*fake_container_pool.FakeContainer).Committed = linux_backend.CommittedResources{
+				MemoryInBytes: 100,
+				DiskInBytes:   200,
+			}
+
+			container2.(*fake_container_pool.FakeContainer).Committed = linux_backend.CommittedResources{
+				MemoryInBytes: 300,
+			}
+
+			capacity, err := linuxBackend.CommittedCapacity()
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(capacity).Should(Equal(linux_backend.CommittedCapacity{
+				Capacity: api.Capacity{
+					MemoryInBytes: 1111,
+					DiskInBytes:   2222,
+					MaxContainers: 42,
+				},
+				CommittedMemoryInBytes: 400,
+				CommittedDiskInBytes:   200,
+				Containers:             3,
+			}))
+		})
+
+		Context("when getting the host's capacity fails", func() {
+			disaster := errors.New("oh no!")
+
+			BeforeEach(func() {
+				fakeSystemInfo.TotalMemoryError = disaster
+			})
+
+			It("returns the error", func() {
+				_, err := linuxBackend.CommittedCapacity()
+				Ω(err).Should(Equal(disaster))
+			})
+		})
+	})
 })
 
 var _ = Describe("Create", func() {
 	var fakeContainerPool *fake_container_pool.FakeContainerPool
 	var linuxBackend *linux_backend.LinuxBackend
 
+	var fakeSystemInfo *fake_system_info.FakeProvider
+
 	BeforeEach(func() {
 		fakeContainerPool = fake_container_pool.New()
-		fakeSystemInfo := fake_system_info.NewFakeProvider()
-		linuxBackend = linux_backend.New(logger, fakeContainerPool, fakeSystemInfo, "", 1400)
+		fakeSystemInfo = fake_system_info.NewFakeProvider()
+		fakeSystemInfo.HostMTUResult = 9000
+		linuxBackend = linux_backend.New(logger, fakeContainerPool, fakeSystemInfo, nil, 1400, linux_backend.StartVerification{})
 	})
 
 	It("creates a container from the pool", func() {
@@ -346,6 +570,56 @@ var _ = Describe("Create", func() {
 		Ω(mtu == uint32(1400)).Should(BeTrue())
 	})
 
+	Context("when the container requests an MTU", func() {
+		It("starts the container with it", func() {
+			container, err := linuxBackend.Create(api.ContainerSpec{
+				Properties: api.Properties{linux_backend.MTUProperty: "8950"},
+			})
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(container.(*fake_container_pool.FakeContainer).Mtu).Should(Equal(uint32(8950)))
+		})
+
+		Context("and it exceeds the host's MTU", func() {
+			It("returns an error without creating the container", func() {
+				_, err := linuxBackend.Create(api.ContainerSpec{
+					Properties: api.Properties{linux_backend.MTUProperty: "9001"},
+				})
+				Ω(err).Should(Equal(linux_backend.InvalidMTUError{Requested: "9001", HostMTU: 9000}))
+
+				Ω(fakeContainerPool.CreatedContainers).Should(BeEmpty())
+			})
+		})
+
+		Context("and it is malformed or too small", func() {
+			It("returns an error without creating the container", func() {
+				for _, requested := range []string{"jumbo", "-1", "67"} {
+					_, err := linuxBackend.Create(api.ContainerSpec{
+						Properties: api.Properties{linux_backend.MTUProperty: requested},
+					})
+					Ω(err).Should(Equal(linux_backend.InvalidMTUError{Requested: requested}))
+				}
+
+				Ω(fakeContainerPool.CreatedContainers).Should(BeEmpty())
+			})
+		})
+
+		Context("and the host's MTU cannot be found", func() {
+			disaster := errors.New("oh no!")
+
+			BeforeEach(func() {
+				fakeSystemInfo.HostMTUError = disaster
+			})
+
+			It("returns the error", func() {
+				_, err := linuxBackend.Create(api.ContainerSpec{
+					Properties: api.Properties{linux_backend.MTUProperty: "1400"},
+				})
+				Ω(err).Should(Equal(disaster))
+			})
+		})
+	})
+
 	It("registers the container", func() {
 		container, err := linuxBackend.Create(api.ContainerSpec{})
 		Ω(err).ShouldNot(HaveOccurred())
@@ -382,6 +656,35 @@ var _ = Describe("Create", func() {
 		})
 	})
 
+	Context("when a container with the given handle is still being created", func() {
+		It("returns a HandleExistsError", func() {
+			var concurrentErr error
+
+			fakeContainerPool.ContainerSetup = func(*fake_container_pool.FakeContainer) {
+				_, concurrentErr = linuxBackend.Create(api.ContainerSpec{Handle: "some-handle"})
+			}
+
+			_, err := linuxBackend.Create(api.ContainerSpec{Handle: "some-handle"})
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(concurrentErr).Should(Equal(linux_backend.HandleExistsError{"some-handle"}))
+		})
+	})
+
+	Context("when creating a container with the given handle failed", func() {
+		It("lets the handle be used again", func() {
+			fakeContainerPool.CreateError = errors.New("oh no!")
+
+			_, err := linuxBackend.Create(api.ContainerSpec{Handle: "some-handle"})
+			Ω(err).Should(HaveOccurred())
+
+			fakeContainerPool.CreateError = nil
+
+			_, err = linuxBackend.Create(api.ContainerSpec{Handle: "some-handle"})
+			Ω(err).ShouldNot(HaveOccurred())
+		})
+	})
+
 	Context("when starting the container fails", func() {
 		disaster := errors.New("failed to start")
 
@@ -408,6 +711,83 @@ var _ = Describe("Create", func() {
 
 			Ω(containers).Should(BeEmpty())
 		})
+
+		It("destroys the container", func() {
+			_, err := linuxBackend.Create(api.ContainerSpec{})
+			Ω(err).Should(HaveOccurred())
+
+			Ω(fakeContainerPool.DestroyedContainers).Should(Equal(fakeContainerPool.CreatedContainers))
+		})
+	})
+
+	Context("when verifying that containers started", func() {
+		var verifyErrors []error
+
+		BeforeEach(func() {
+			verifyErrors = nil
+
+			fakeContainerPool.ContainerSetup = func(c *fake_container_pool.FakeContainer) {
+				c.VerifyStartErrors = verifyErrors
+			}
+
+			fakeSystemInfo := fake_system_info.NewFakeProvider()
+			linuxBackend = linux_backend.New(logger, fakeContainerPool, fakeSystemInfo, nil, 1400, linux_backend.StartVerification{
+				Attempts: 3,
+			})
+		})
+
+		It("verifies the container once it has started", func() {
+			container, err := linuxBackend.Create(api.ContainerSpec{})
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(container.(*fake_container_pool.FakeContainer).VerifyStartCalls).Should(Equal(1))
+		})
+
+		Context("when verification fails and then succeeds", func() {
+			BeforeEach(func() {
+				verifyErrors = []error{errors.New("oh no!"), errors.New("oh no!")}
+			})
+
+			It("retries, and creates the container", func() {
+				container, err := linuxBackend.Create(api.ContainerSpec{})
+				Ω(err).ShouldNot(HaveOccurred())
+
+				Ω(container.(*fake_container_pool.FakeContainer).VerifyStartCalls).Should(Equal(3))
+			})
+		})
+
+		Context("when verification keeps failing", func() {
+			disaster := linux_backend.StartVerificationError{Handle: "some-handle", Check: "gateway", Err: errors.New("oh no!")}
+
+			BeforeEach(func() {
+				verifyErrors = []error{disaster, disaster, disaster}
+			})
+
+			It("returns the error, and destroys the container", func() {
+				_, err := linuxBackend.Create(api.ContainerSpec{})
+				Ω(err).Should(Equal(disaster))
+
+				Ω(fakeContainerPool.CreatedContainers).Should(HaveLen(1))
+				Ω(fakeContainerPool.DestroyedContainers).Should(Equal(fakeContainerPool.CreatedContainers))
+
+				containers, err := linuxBackend.Containers(nil)
+				Ω(err).ShouldNot(HaveOccurred())
+				Ω(containers).Should(BeEmpty())
+			})
+
+			It("logs each failed attempt", func() {
+				linuxBackend.Create(api.ContainerSpec{})
+
+				attempts := 0
+				for _, log := range logger.Logs() {
+					if log.Message == "test.backend.failed-to-verify-start" {
+						attempts++
+					}
+				}
+
+				Ω(attempts).Should(Equal(3))
+			})
+		})
 	})
 })
 
@@ -420,9 +800,13 @@ var _ = Describe("Destroy", func() {
 	BeforeEach(func() {
 		fakeContainerPool = fake_container_pool.New()
 		fakeSystemInfo := fake_system_info.NewFakeProvider()
-		linuxBackend = linux_backend.New(logger, fakeContainerPool, fakeSystemInfo, "", 1500)
+		linuxBackend = linux_backend.New(logger, fakeContainerPool, fakeSystemInfo, nil, 1500, linux_backend.StartVerification{})
 
-		newContainer, err := linuxBackend.Create(api.ContainerSpec{})
+		newContainer, err := linuxBackend.Create(api.ContainerSpec{
+			Properties: api.Properties{
+				linux_backend.MetricsAppIDProperty: "some-app",
+			},
+		})
 		Ω(err).ShouldNot(HaveOccurred())
 
 		container = newContainer
@@ -437,6 +821,13 @@ var _ = Describe("Destroy", func() {
 		Ω(fakeContainerPool.DestroyedContainers).Should(ContainElement(container))
 	})
 
+	It("marks the container as destroying, so that its network is left alone", func() {
+		err := linuxBackend.Destroy(container.Handle())
+		Ω(err).ShouldNot(HaveOccurred())
+
+		Ω(container.(*fake_container_pool.FakeContainer).MarkedDestroying).Should(BeTrue())
+	})
+
 	It("unregisters the container", func() {
 		err := linuxBackend.Destroy(container.Handle())
 		Ω(err).ShouldNot(HaveOccurred())
@@ -446,68 +837,280 @@ var _ = Describe("Destroy", func() {
 		Ω(err).Should(Equal(linux_backend.UnknownHandleError{container.Handle()}))
 	})
 
-	Context("when the container does not exist", func() {
-		It("returns UnknownHandleError", func() {
-			err := linuxBackend.Destroy("bogus-handle")
-			Ω(err).Should(HaveOccurred())
-			Ω(err).Should(Equal(linux_backend.UnknownHandleError{"bogus-handle"}))
-		})
-	})
+	Describe("reporting the container's final usage", func() {
+		finalUsage := linux_backend.UsageSummary{
+			PeakMemoryBytes:      1024,
+			MemoryBytes:          512,
+			DiskBytes:            8192,
+			CPUTime:              2000,
+			DiskBytesWritten:     3072,
+			NetworkBytesReceived: 4096,
+			NetworkBytesSent:     5120,
+		}
+
+		summarizedUsage := func() interface{} {
+			for _, log := range logger.Logs() {
+				if log.Message == "test.backend.final-usage.summarized" {
+					return log.Data["usage"]
+				}
+			}
 
-	Context("when destroying the container fails", func() {
-		disaster := errors.New("failed to destroy")
+			return nil
+		}
 
 		BeforeEach(func() {
-			fakeContainerPool.DestroyError = disaster
+			container.(*fake_container_pool.FakeContainer).FinalUsage = finalUsage
 		})
 
-		It("returns the error", func() {
+		It("logs it", func() {
 			err := linuxBackend.Destroy(container.Handle())
-			Ω(err).Should(HaveOccurred())
-			Ω(err).Should(Equal(disaster))
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(summarizedUsage()).Should(Equal(map[string]interface{}{
+				"PeakMemoryBytes":      float64(1024),
+				"MemoryBytes":          float64(512),
+				"DiskBytes":            float64(8192),
+				"CPUTime":              float64(2000),
+				"DiskBytesWritten":     float64(3072),
+				"NetworkBytesReceived": float64(4096),
+				"NetworkBytesSent":     float64(5120),
+			}))
 		})
 
-		It("does not unregister the container", func() {
+		It("logs the container's metric tags with it", func() {
 			err := linuxBackend.Destroy(container.Handle())
-			Ω(err).Should(HaveOccurred())
-
-			foundContainer, err := linuxBackend.Lookup(container.Handle())
 			Ω(err).ShouldNot(HaveOccurred())
-			Ω(foundContainer).Should(Equal(container))
+
+			var tags interface{}
+			for _, log := range logger.Logs() {
+				if log.Message == "test.backend.final-usage.summarized" {
+					tags = log.Data["tags"]
+				}
+			}
+
+			Ω(tags).Should(Equal(map[string]interface{}{"app_id": "some-app"}))
 		})
-	})
-})
 
-var _ = Describe("Lookup", func() {
-	var fakeContainerPool *fake_container_pool.FakeContainerPool
-	var linuxBackend *linux_backend.LinuxBackend
+		Context("when reporting final usage as metrics", func() {
+			var fakeMetricSender *fake.FakeMetricSender
 
-	BeforeEach(func() {
-		fakeContainerPool = fake_container_pool.New()
-		fakeSystemInfo := fake_system_info.NewFakeProvider()
-		linuxBackend = linux_backend.New(logger, fakeContainerPool, fakeSystemInfo, "", 1500)
-	})
+			BeforeEach(func() {
+				fakeMetricSender = fake.NewFakeMetricSender()
+				linuxBackend.ReportFinalUsage(fakeMetricSender)
+			})
 
-	It("returns the container", func() {
-		container, err := linuxBackend.Create(api.ContainerSpec{})
-		Ω(err).ShouldNot(HaveOccurred())
+			It("adds it to the totals of destroyed containers", func() {
+				err := linuxBackend.Destroy(container.Handle())
+				Ω(err).ShouldNot(HaveOccurred())
 
-		foundContainer, err := linuxBackend.Lookup(container.Handle())
-		Ω(err).ShouldNot(HaveOccurred())
+				Ω(fakeMetricSender.GetCounter("containers.destroyed")).Should(Equal(uint64(1)))
+				Ω(fakeMetricSender.GetCounter("containers.destroyed.cpu_time")).Should(Equal(uint64(2000)))
+				Ω(fakeMetricSender.GetCounter("containers.destroyed.disk_written")).Should(Equal(uint64(3072)))
+				Ω(fakeMetricSender.GetCounter("containers.destroyed.network_received")).Should(Equal(uint64(4096)))
+				Ω(fakeMetricSender.GetCounter("containers.destroyed.network_sent")).Should(Equal(uint64(5120)))
+			})
 
-		Ω(foundContainer).Should(Equal(container))
-	})
+			It("sends its peak memory", func() {
+				err := linuxBackend.Destroy(container.Handle())
+				Ω(err).ShouldNot(HaveOccurred())
 
-	Context("when the handle is not found", func() {
-		It("returns UnknownHandleError", func() {
-			foundContainer, err := linuxBackend.Lookup("bogus-handle")
-			Ω(err).Should(HaveOccurred())
-			Ω(foundContainer).Should(BeNil())
+				Ω(fakeMetricSender.GetValue("containers.destroyed.peak_memory")).Should(Equal(fake.Metric{Value: 1024, Unit: "bytes"}))
+			})
 
-			Ω(err).Should(Equal(linux_backend.UnknownHandleError{"bogus-handle"}))
-		})
-	})
-})
+			Context("when destroying the container fails", func() {
+				BeforeEach(func() {
+					fakeContainerPool.DestroyError = errors.New("oh no!")
+				})
+
+				It("counts it only once the container is destroyed", func() {
+					err := linuxBackend.Destroy(container.Handle())
+					Ω(err).Should(HaveOccurred())
+
+					Ω(fakeMetricSender.GetCounter("containers.destroyed")).Should(Equal(uint64(0)))
+					Ω(fakeMetricSender.GetCounter("containers.destroyed.cpu_time")).Should(Equal(uint64(0)))
+
+					fakeContainerPool.DestroyError = nil
+
+					err = linuxBackend.Destroy(container.Handle())
+					Ω(err).ShouldNot(HaveOccurred())
+
+					Ω(fakeMetricSender.GetCounter("containers.destroyed")).Should(Equal(uint64(1)))
+					Ω(fakeMetricSender.GetCounter("containers.destroyed.cpu_time")).Should(Equal(uint64(2000)))
+				})
+			})
+		})
+
+		Context("when exporting usage", func() {
+			var fakeUsageExporter *fake_linux_backend.FakeUsageExporter
+
+			BeforeEach(func() {
+				fakeUsageExporter = new(fake_linux_backend.FakeUsageExporter)
+				linuxBackend.ExportUsageWith(fakeUsageExporter)
+			})
+
+			It("gives it to the exporter as the container's final usage", func() {
+				err := linuxBackend.Destroy(container.Handle())
+				Ω(err).ShouldNot(HaveOccurred())
+
+				Ω(fakeUsageExporter.Observed).Should(Equal([]fake_linux_backend.ObservedUsage{
+					{
+						Handle: container.Handle(),
+						Tags:   map[string]string{"app_id": "some-app"},
+						Usage:  finalUsage,
+						Final:  true,
+					},
+				}))
+			})
+
+			Context("when destroying the container fails", func() {
+				BeforeEach(func() {
+					fakeContainerPool.DestroyError = errors.New("oh no!")
+				})
+
+				It("gives it to the exporter only once the container is destroyed", func() {
+					err := linuxBackend.Destroy(container.Handle())
+					Ω(err).Should(HaveOccurred())
+
+					Ω(fakeUsageExporter.Observed).Should(BeEmpty())
+
+					fakeContainerPool.DestroyError = nil
+
+					err = linuxBackend.Destroy(container.Handle())
+					Ω(err).ShouldNot(HaveOccurred())
+
+					Ω(fakeUsageExporter.Observed).Should(HaveLen(1))
+				})
+			})
+		})
+
+		Context("when summarizing the usage fails", func() {
+			BeforeEach(func() {
+				container.(*fake_container_pool.FakeContainer).UsageSummaryError = errors.New("oh no!")
+			})
+
+			It("destroys the container anyway", func() {
+				err := linuxBackend.Destroy(container.Handle())
+				Ω(err).ShouldNot(HaveOccurred())
+
+				Ω(fakeContainerPool.DestroyedContainers).Should(ContainElement(container))
+				Ω(summarizedUsage()).Should(BeNil())
+			})
+		})
+	})
+
+	Context("when the container does not exist", func() {
+		It("returns UnknownHandleError", func() {
+			err := linuxBackend.Destroy("bogus-handle")
+			Ω(err).Should(HaveOccurred())
+			Ω(err).Should(Equal(linux_backend.UnknownHandleError{"bogus-handle"}))
+		})
+	})
+
+	Context("when destroying the container fails", func() {
+		disaster := errors.New("failed to destroy")
+
+		BeforeEach(func() {
+			fakeContainerPool.DestroyError = disaster
+		})
+
+		It("returns the error", func() {
+			err := linuxBackend.Destroy(container.Handle())
+			Ω(err).Should(HaveOccurred())
+			Ω(err).Should(Equal(disaster))
+		})
+
+		It("does not unregister the container", func() {
+			err := linuxBackend.Destroy(container.Handle())
+			Ω(err).Should(HaveOccurred())
+
+			foundContainer, err := linuxBackend.Lookup(container.Handle())
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(foundContainer).Should(Equal(container))
+		})
+
+		It("marks the container as broken", func() {
+			err := linuxBackend.Destroy(container.Handle())
+			Ω(err).Should(HaveOccurred())
+
+			Ω(container.(*fake_container_pool.FakeContainer).BrokenReason).Should(Equal("destroy failed: failed to destroy"))
+		})
+	})
+})
+
+var _ = Describe("Lookup", func() {
+	var fakeContainerPool *fake_container_pool.FakeContainerPool
+	var linuxBackend *linux_backend.LinuxBackend
+
+	BeforeEach(func() {
+		fakeContainerPool = fake_container_pool.New()
+		fakeSystemInfo := fake_system_info.NewFakeProvider()
+		linuxBackend = linux_backend.New(logger, fakeContainerPool, fakeSystemInfo, nil, 1500, linux_backend.StartVerification{})
+	})
+
+	It("returns the container", func() {
+		container, err := linuxBackend.Create(api.ContainerSpec{})
+		Ω(err).ShouldNot(HaveOccurred())
+
+		foundContainer, err := linuxBackend.Lookup(container.Handle())
+		Ω(err).ShouldNot(HaveOccurred())
+
+		Ω(foundContainer).Should(Equal(container))
+	})
+
+	Context("when the handle is not found", func() {
+		It("returns UnknownHandleError", func() {
+			foundContainer, err := linuxBackend.Lookup("bogus-handle")
+			Ω(err).Should(HaveOccurred())
+			Ω(foundContainer).Should(BeNil())
+
+			Ω(err).Should(Equal(linux_backend.UnknownHandleError{"bogus-handle"}))
+		})
+	})
+})
+
+var _ = Describe("LookupByID", func() {
+	var fakeContainerPool *fake_container_pool.FakeContainerPool
+	var linuxBackend *linux_backend.LinuxBackend
+
+	BeforeEach(func() {
+		fakeContainerPool = fake_container_pool.New()
+		fakeSystemInfo := fake_system_info.NewFakeProvider()
+		linuxBackend = linux_backend.New(logger, fakeContainerPool, fakeSystemInfo, nil, 1500, linux_backend.StartVerification{})
+	})
+
+	It("returns the container", func() {
+		container, err := linuxBackend.Create(api.ContainerSpec{})
+		Ω(err).ShouldNot(HaveOccurred())
+
+		foundContainer, err := linuxBackend.LookupByID(container.(linux_backend.Container).ID())
+		Ω(err).ShouldNot(HaveOccurred())
+
+		Ω(foundContainer).Should(Equal(container))
+	})
+
+	Context("when the container has been destroyed", func() {
+		It("returns UnknownContainerIDError", func() {
+			container, err := linuxBackend.Create(api.ContainerSpec{})
+			Ω(err).ShouldNot(HaveOccurred())
+
+			err = linuxBackend.Destroy(container.Handle())
+			Ω(err).ShouldNot(HaveOccurred())
+
+			id := container.(linux_backend.Container).ID()
+
+			_, err = linuxBackend.LookupByID(id)
+			Ω(err).Should(Equal(linux_backend.UnknownContainerIDError{id}))
+		})
+	})
+
+	Context("when the ID is not found", func() {
+		It("returns UnknownContainerIDError", func() {
+			foundContainer, err := linuxBackend.LookupByID("bogus-id")
+			Ω(err).Should(Equal(linux_backend.UnknownContainerIDError{"bogus-id"}))
+			Ω(foundContainer).Should(BeNil())
+		})
+	})
+})
 
 var _ = Describe("Containers", func() {
 	var fakeContainerPool *fake_container_pool.FakeContainerPool
@@ -516,7 +1119,7 @@ var _ = Describe("Containers", func() {
 	BeforeEach(func() {
 		fakeContainerPool = fake_container_pool.New()
 		fakeSystemInfo := fake_system_info.NewFakeProvider()
-		linuxBackend = linux_backend.New(logger, fakeContainerPool, fakeSystemInfo, "", 1500)
+		linuxBackend = linux_backend.New(logger, fakeContainerPool, fakeSystemInfo, nil, 1500, linux_backend.StartVerification{})
 	})
 
 	It("returns a list of all existing containers", func() {
@@ -559,6 +1162,114 @@ var _ = Describe("Containers", func() {
 			Ω(containers).ShouldNot(ContainElement(container2))
 			Ω(containers).Should(ContainElement(container3))
 		})
+
+		It("returns none if no container has one of the properties", func() {
+			_, err := linuxBackend.Create(api.ContainerSpec{
+				Properties: api.Properties{"a": "b"},
+			})
+			Ω(err).ShouldNot(HaveOccurred())
+
+			containers, err := linuxBackend.Containers(
+				api.Properties{"a": "b", "c": "d"},
+			)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(containers).Should(BeEmpty())
+		})
+
+		It("does not return destroyed containers", func() {
+			container, err := linuxBackend.Create(api.ContainerSpec{
+				Properties: api.Properties{"a": "b"},
+			})
+			Ω(err).ShouldNot(HaveOccurred())
+
+			err = linuxBackend.Destroy(container.Handle())
+			Ω(err).ShouldNot(HaveOccurred())
+
+			containers, err := linuxBackend.Containers(api.Properties{"a": "b"})
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(containers).Should(BeEmpty())
+		})
+	})
+})
+
+var _ = Describe("ContainersFromImage", func() {
+	var fakeContainerPool *fake_container_pool.FakeContainerPool
+	var linuxBackend *linux_backend.LinuxBackend
+
+	var container1, container2, container3 api.Container
+
+	BeforeEach(func() {
+		fakeContainerPool = fake_container_pool.New()
+		fakeSystemInfo := fake_system_info.NewFakeProvider()
+		linuxBackend = linux_backend.New(logger, fakeContainerPool, fakeSystemInfo, nil, 1500, linux_backend.StartVerification{})
+
+		create := func(provenance linux_backend.RootFSProvenance) api.Container {
+			fakeContainerPool.ContainerSetup = func(container *fake_container_pool.FakeContainer) {
+				container.Provenance = provenance
+			}
+
+			container, err := linuxBackend.Create(api.ContainerSpec{})
+			Ω(err).ShouldNot(HaveOccurred())
+
+			return container
+		}
+
+		container1 = create(linux_backend.RootFSProvenance{
+			Provider: "docker",
+			Image:    "some-repo:latest",
+			ImageID:  "image-1",
+			Layers:   []string{"image-1", "base-layer"},
+		})
+
+		container2 = create(linux_backend.RootFSProvenance{
+			Provider: "docker",
+			Image:    "other-repo:latest",
+			ImageID:  "image-2",
+			Layers:   []string{"image-2", "base-layer"},
+		})
+
+		container3 = create(linux_backend.RootFSProvenance{
+			Image: "/some/rootfs",
+		})
+	})
+
+	It("returns the containers created from the named image", func() {
+		containers, err := linuxBackend.ContainersFromImage("some-repo:latest")
+		Ω(err).ShouldNot(HaveOccurred())
+
+		Ω(containers).Should(ConsistOf(container1))
+	})
+
+	It("returns the containers created from the image ID", func() {
+		containers, err := linuxBackend.ContainersFromImage("image-2")
+		Ω(err).ShouldNot(HaveOccurred())
+
+		Ω(containers).Should(ConsistOf(container2))
+	})
+
+	It("returns the containers with the layer in their chain", func() {
+		containers, err := linuxBackend.ContainersFromImage("base-layer")
+		Ω(err).ShouldNot(HaveOccurred())
+
+		Ω(containers).Should(ConsistOf(container1, container2))
+	})
+
+	It("matches rootfs paths from other providers", func() {
+		containers, err := linuxBackend.ContainersFromImage("/some/rootfs")
+		Ω(err).ShouldNot(HaveOccurred())
+
+		Ω(containers).Should(ConsistOf(container3))
+	})
+
+	Context("when no container was created from the image", func() {
+		It("returns none", func() {
+			containers, err := linuxBackend.ContainersFromImage("bogus-image")
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(containers).Should(BeEmpty())
+		})
 	})
 })
 
@@ -569,7 +1280,7 @@ var _ = Describe("GraceTime", func() {
 	BeforeEach(func() {
 		fakeContainerPool = fake_container_pool.New()
 		fakeSystemInfo := fake_system_info.NewFakeProvider()
-		linuxBackend = linux_backend.New(logger, fakeContainerPool, fakeSystemInfo, "", 1500)
+		linuxBackend = linux_backend.New(logger, fakeContainerPool, fakeSystemInfo, nil, 1500, linux_backend.StartVerification{})
 	})
 
 	It("returns the container's grace time", func() {
@@ -581,3 +1292,1291 @@ var _ = Describe("GraceTime", func() {
 		Ω(linuxBackend.GraceTime(container)).Should(Equal(time.Second))
 	})
 })
+
+var _ = Describe("ReconcileNetworks", func() {
+	var fakeContainerPool *fake_container_pool.FakeContainerPool
+	var linuxBackend *linux_backend.LinuxBackend
+
+	BeforeEach(func() {
+		fakeContainerPool = fake_container_pool.New()
+		fakeSystemInfo := fake_system_info.NewFakeProvider()
+		linuxBackend = linux_backend.New(logger, fakeContainerPool, fakeSystemInfo, nil, 1500, linux_backend.StartVerification{})
+	})
+
+	It("reconciles every container's network", func() {
+		container1, err := linuxBackend.Create(api.ContainerSpec{})
+		Ω(err).ShouldNot(HaveOccurred())
+
+		container2, err := linuxBackend.Create(api.ContainerSpec{})
+		Ω(err).ShouldNot(HaveOccurred())
+
+		linuxBackend.ReconcileNetworks()
+
+		Ω(container1.(*fake_container_pool.FakeContainer).NetworkReconciled).Should(BeTrue())
+		Ω(container2.(*fake_container_pool.FakeContainer).NetworkReconciled).Should(BeTrue())
+	})
+
+	Context("when reconciling a container fails", func() {
+		BeforeEach(func() {
+			first := true
+
+			fakeContainerPool.ContainerSetup = func(c *fake_container_pool.FakeContainer) {
+				if first {
+					c.ReconcileNetworkError = errors.New("oh no!")
+					first = false
+				}
+			}
+		})
+
+		It("carries on with the others", func() {
+			container1, err := linuxBackend.Create(api.ContainerSpec{})
+			Ω(err).ShouldNot(HaveOccurred())
+
+			container2, err := linuxBackend.Create(api.ContainerSpec{})
+			Ω(err).ShouldNot(HaveOccurred())
+
+			linuxBackend.ReconcileNetworks()
+
+			Ω(container1.(*fake_container_pool.FakeContainer).NetworkReconciled).Should(BeTrue())
+			Ω(container2.(*fake_container_pool.FakeContainer).NetworkReconciled).Should(BeTrue())
+		})
+	})
+})
+
+var _ = Describe("Overcommit", func() {
+	var fakeContainerPool *fake_container_pool.FakeContainerPool
+	var fakeSystemInfo *fake_system_info.FakeProvider
+	var linuxBackend *linux_backend.LinuxBackend
+
+	var container *fake_container_pool.FakeContainer
+	var otherContainer *fake_container_pool.FakeContainer
+
+	BeforeEach(func() {
+		fakeContainerPool = fake_container_pool.New()
+
+		fakeSystemInfo = fake_system_info.NewFakeProvider()
+		fakeSystemInfo.TotalMemoryResult = 1000
+		fakeSystemInfo.TotalDiskResult = 2000
+
+		linuxBackend = linux_backend.New(logger, fakeContainerPool, fakeSystemInfo, nil, 1500, linux_backend.StartVerification{})
+		linuxBackend.EnforceOvercommit(linux_backend.OvercommitFactors{
+			Memory: 1.5,
+			Disk:   0.5,
+		})
+
+		created, err := linuxBackend.Create(api.ContainerSpec{})
+		Ω(err).ShouldNot(HaveOccurred())
+
+		container = created.(*fake_container_pool.FakeContainer)
+
+		created, err = linuxBackend.Create(api.ContainerSpec{})
+		Ω(err).ShouldNot(HaveOccurred())
+
+		otherContainer = created.(*fake_container_pool.FakeContainer)
+		otherContainer.Committed = linux_backend.CommittedResources{
+			MemoryInBytes: 1000,
+			DiskInBytes:   500,
+		}
+	})
+
+	It("makes the backend the admitter of its containers' limits", func() {
+		Ω(container.LimitAdmitter).Should(Equal(linuxBackend))
+	})
+
+	Describe("admitting limits", func() {
+		It("admits limits that keep the total commitment within the factors", func() {
+			release, err := linuxBackend.AdmitLimits(container, linux_backend.CommittedResources{
+				MemoryInBytes: 500,
+				DiskInBytes:   500,
+			})
+			Ω(err).ShouldNot(HaveOccurred())
+
+			release()
+		})
+
+		It("rejects limits that would commit too much memory", func() {
+			_, err := linuxBackend.AdmitLimits(container, linux_backend.CommittedResources{
+				MemoryInBytes: 501,
+			})
+			Ω(err).Should(Equal(linux_backend.OvercommitError{
+				Resource:  "memory",
+				Committed: 1501,
+				Allowed:   1500,
+			}))
+		})
+
+		It("rejects limits that would commit too much disk", func() {
+			_, err := linuxBackend.AdmitLimits(container, linux_backend.CommittedResources{
+				DiskInBytes: 501,
+			})
+			Ω(err).Should(Equal(linux_backend.OvercommitError{
+				Resource:  "disk",
+				Committed: 1001,
+				Allowed:   1000,
+			}))
+		})
+
+		It("counts the container's new commitment in place of its current one", func() {
+			container.Committed = linux_backend.CommittedResources{MemoryInBytes: 400}
+
+			release, err := linuxBackend.AdmitLimits(container, linux_backend.CommittedResources{
+				MemoryInBytes: 500,
+			})
+			Ω(err).ShouldNot(HaveOccurred())
+
+			release()
+		})
+
+		It("admits a lowered commitment, even when overcommitted", func() {
+			container.Committed = linux_backend.CommittedResources{MemoryInBytes: 800}
+
+			release, err := linuxBackend.AdmitLimits(container, linux_backend.CommittedResources{
+				MemoryInBytes: 700,
+			})
+			Ω(err).ShouldNot(HaveOccurred())
+
+			release()
+		})
+
+		It("admits no other limits until released", func() {
+			release, err := linuxBackend.AdmitLimits(container, linux_backend.CommittedResources{})
+			Ω(err).ShouldNot(HaveOccurred())
+
+			admitted := make(chan struct{})
+			go func() {
+				defer GinkgoRecover()
+
+				otherRelease, err := linuxBackend.AdmitLimits(otherContainer, linux_backend.CommittedResources{})
+				Ω(err).ShouldNot(HaveOccurred())
+
+				otherRelease()
+				close(admitted)
+			}()
+
+			Consistently(admitted).ShouldNot(BeClosed())
+
+			release()
+
+			Eventually(admitted).Should(BeClosed())
+		})
+
+		Context("when the factors are zero", func() {
+			BeforeEach(func() {
+				linuxBackend.EnforceOvercommit(linux_backend.OvercommitFactors{})
+			})
+
+			It("admits any limits", func() {
+				release, err := linuxBackend.AdmitLimits(container, linux_backend.CommittedResources{
+					MemoryInBytes: 1000000,
+					DiskInBytes:   1000000,
+				})
+				Ω(err).ShouldNot(HaveOccurred())
+
+				release()
+			})
+		})
+
+		Context("when getting the host's memory fails", func() {
+			disaster := errors.New("oh no!")
+
+			BeforeEach(func() {
+				fakeSystemInfo.TotalMemoryError = disaster
+			})
+
+			It("returns the error", func() {
+				_, err := linuxBackend.AdmitLimits(container, linux_backend.CommittedResources{})
+				Ω(err).Should(Equal(disaster))
+			})
+		})
+	})
+
+	Describe("creating", func() {
+		It("creates containers while there is memory and disk left to commit", func() {
+			_, err := linuxBackend.Create(api.ContainerSpec{})
+			Ω(err).ShouldNot(HaveOccurred())
+		})
+
+		Context("when containers' limits commit all of the memory allowed", func() {
+			BeforeEach(func() {
+				container.Committed = linux_backend.CommittedResources{MemoryInBytes: 500}
+			})
+
+			It("rejects creates", func() {
+				_, err := linuxBackend.Create(api.ContainerSpec{})
+				Ω(err).Should(Equal(linux_backend.OvercommitError{
+					Resource:  "memory",
+					Committed: 1500,
+					Allowed:   1500,
+				}))
+
+				Ω(fakeContainerPool.CreatedContainers).Should(HaveLen(2))
+			})
+		})
+
+		Context("when containers' limits commit all of the disk allowed", func() {
+			BeforeEach(func() {
+				container.Committed = linux_backend.CommittedResources{DiskInBytes: 500}
+			})
+
+			It("rejects creates", func() {
+				_, err := linuxBackend.Create(api.ContainerSpec{})
+				Ω(err).Should(Equal(linux_backend.OvercommitError{
+					Resource:  "disk",
+					Committed: 1000,
+					Allowed:   1000,
+				}))
+			})
+		})
+	})
+})
+
+var _ = Describe("Capabilities", func() {
+	It("reports whether the host has swap accounting", func() {
+		fakeContainerPool := fake_container_pool.New()
+		fakeSystemInfo := fake_system_info.NewFakeProvider()
+		linuxBackend := linux_backend.New(logger, fakeContainerPool, fakeSystemInfo, nil, 1500, linux_backend.StartVerification{})
+
+		Ω(linuxBackend.Capabilities()).Should(Equal(linux_backend.Capabilities{SwapAccounting: false}))
+
+		fakeContainerPool.SwapAccountingValue = true
+		Ω(linuxBackend.Capabilities()).Should(Equal(linux_backend.Capabilities{SwapAccounting: true}))
+	})
+})
+
+var _ = Describe("MonitorPressure", func() {
+	var fakeContainerPool *fake_container_pool.FakeContainerPool
+	var fakeSystemInfo *fake_system_info.FakeProvider
+	var fakeMetricSender *fake.FakeMetricSender
+	var linuxBackend *linux_backend.LinuxBackend
+
+	thresholds := linux_backend.PressureThresholds{
+		MinFreeMemory: 1024,
+		MinFreeDisk:   2048,
+	}
+
+	logMessages := func() []string {
+		messages := []string{}
+		for _, log := range logger.Logs() {
+			messages = append(messages, log.Message)
+		}
+
+		return messages
+	}
+
+	BeforeEach(func() {
+		fakeContainerPool = fake_container_pool.New()
+		fakeMetricSender = fake.NewFakeMetricSender()
+
+		fakeSystemInfo = fake_system_info.NewFakeProvider()
+		fakeSystemInfo.FreeMemoryResult = 4096
+		fakeSystemInfo.FreeDiskResult = 8192
+
+		linuxBackend = linux_backend.New(logger, fakeContainerPool, fakeSystemInfo, nil, 1500, linux_backend.StartVerification{})
+	})
+
+	It("sends the host's free memory and disk", func() {
+		linuxBackend.MonitorPressure(fakeMetricSender, thresholds)
+
+		Ω(fakeMetricSender.GetValue("host.memory.free")).Should(Equal(fake.Metric{Value: 4096, Unit: "bytes"}))
+		Ω(fakeMetricSender.GetValue("host.disk.free")).Should(Equal(fake.Metric{Value: 8192, Unit: "bytes"}))
+		Ω(fakeMetricSender.GetValue("host.under_pressure")).Should(Equal(fake.Metric{Value: 0, Unit: "bool"}))
+	})
+
+	It("sends how much memory and disk containers' limits commit", func() {
+		container, err := linuxBackend.Create(api.ContainerSpec{})
+		Ω(err).ShouldNot(HaveOccurred())
+
+		container.(*fake_container_pool.FakeContainer).Committed = linux_backend.CommittedResources{
+			MemoryInBytes: 100,
+			DiskInBytes:   200,
+		}
+
+		linuxBackend.MonitorPressure(fakeMetricSender, thresholds)
+
+		Ω(fakeMetricSender.GetValue("host.memory.committed")).Should(Equal(fake.Metric{Value: 100, Unit: "bytes"}))
+		Ω(fakeMetricSender.GetValue("host.disk.committed")).Should(Equal(fake.Metric{Value: 200, Unit: "bytes"}))
+	})
+
+	It("allows creates while the host has enough free", func() {
+		linuxBackend.MonitorPressure(fakeMetricSender, thresholds)
+
+		_, err := linuxBackend.Create(api.ContainerSpec{})
+		Ω(err).ShouldNot(HaveOccurred())
+	})
+
+	Context("when free memory is below its threshold", func() {
+		BeforeEach(func() {
+			fakeSystemInfo.FreeMemoryResult = 512
+		})
+
+		It("rejects creates", func() {
+			linuxBackend.MonitorPressure(fakeMetricSender, thresholds)
+
+			_, err := linuxBackend.Create(api.ContainerSpec{})
+			Ω(err).Should(Equal(linux_backend.HostUnderPressureError{
+				Resource:  "memory",
+				Free:      512,
+				Threshold: 1024,
+			}))
+
+			Ω(fakeContainerPool.CreatedContainers).Should(BeEmpty())
+			Ω(fakeMetricSender.GetValue("host.under_pressure")).Should(Equal(fake.Metric{Value: 1, Unit: "bool"}))
+		})
+
+		It("logs when the host comes under pressure, and when it is relieved", func() {
+			linuxBackend.MonitorPressure(fakeMetricSender, thresholds)
+			linuxBackend.MonitorPressure(fakeMetricSender, thresholds)
+
+			fakeSystemInfo.FreeMemoryResult = 4096
+			linuxBackend.MonitorPressure(fakeMetricSender, thresholds)
+
+			Ω(logMessages()).Should(Equal([]string{
+				"test.backend.host-under-pressure",
+				"test.backend.host-pressure-relieved",
+			}))
+
+			_, err := linuxBackend.Create(api.ContainerSpec{})
+			Ω(err).ShouldNot(HaveOccurred())
+		})
+	})
+
+	Context("when free disk is below its threshold", func() {
+		BeforeEach(func() {
+			fakeSystemInfo.FreeDiskResult = 1024
+		})
+
+		It("rejects creates", func() {
+			linuxBackend.MonitorPressure(fakeMetricSender, thresholds)
+
+			_, err := linuxBackend.Create(api.ContainerSpec{})
+			Ω(err).Should(Equal(linux_backend.HostUnderPressureError{
+				Resource:  "disk",
+				Free:      1024,
+				Threshold: 2048,
+			}))
+		})
+	})
+
+	Context("when the thresholds are zero", func() {
+		BeforeEach(func() {
+			fakeSystemInfo.FreeMemoryResult = 0
+			fakeSystemInfo.FreeDiskResult = 0
+		})
+
+		It("never rejects creates", func() {
+			linuxBackend.MonitorPressure(fakeMetricSender, linux_backend.PressureThresholds{})
+
+			_, err := linuxBackend.Create(api.ContainerSpec{})
+			Ω(err).ShouldNot(HaveOccurred())
+		})
+	})
+
+	Context("when getting free memory fails", func() {
+		It("logs the failure and keeps the previous state", func() {
+			fakeSystemInfo.FreeMemoryResult = 512
+			linuxBackend.MonitorPressure(fakeMetricSender, thresholds)
+
+			fakeSystemInfo.FreeMemoryError = errors.New("oh no!")
+			linuxBackend.MonitorPressure(fakeMetricSender, thresholds)
+
+			Ω(logMessages()).Should(ContainElement("test.backend.failed-to-get-free-memory"))
+
+			_, err := linuxBackend.Create(api.ContainerSpec{})
+			Ω(err).Should(BeAssignableToTypeOf(linux_backend.HostUnderPressureError{}))
+		})
+	})
+})
+
+var _ = Describe("ReportPoolUtilization", func() {
+	var fakeContainerPool *fake_container_pool.FakeContainerPool
+	var fakeMetricSender *fake.FakeMetricSender
+	var linuxBackend *linux_backend.LinuxBackend
+
+	BeforeEach(func() {
+		fakeContainerPool = fake_container_pool.New()
+		fakeContainerPool.UtilizationValue = []linux_backend.PoolUtilization{
+			{Pool: "uid", Free: 200, Total: 256},
+			{Pool: "network", Free: 10, Total: 1024},
+		}
+
+		fakeMetricSender = fake.NewFakeMetricSender()
+
+		fakeSystemInfo := fake_system_info.NewFakeProvider()
+		linuxBackend = linux_backend.New(logger, fakeContainerPool, fakeSystemInfo, nil, 1500, linux_backend.StartVerification{})
+	})
+
+	It("sends each pool's free and total size", func() {
+		linuxBackend.ReportPoolUtilization(fakeMetricSender, 0.1)
+
+		Ω(fakeMetricSender.GetValue("pool.uid.free")).Should(Equal(fake.Metric{Value: 200, Unit: "count"}))
+		Ω(fakeMetricSender.GetValue("pool.uid.total")).Should(Equal(fake.Metric{Value: 256, Unit: "count"}))
+		Ω(fakeMetricSender.GetValue("pool.network.free")).Should(Equal(fake.Metric{Value: 10, Unit: "count"}))
+		Ω(fakeMetricSender.GetValue("pool.network.total")).Should(Equal(fake.Metric{Value: 1024, Unit: "count"}))
+	})
+
+	It("warns of pools with less than the low watermark free", func() {
+		linuxBackend.ReportPoolUtilization(fakeMetricSender, 0.1)
+
+		warnings := []string{}
+		for _, log := range logger.Logs() {
+			if log.Message == "test.backend.pool-running-low" {
+				warnings = append(warnings, log.Data["pool"].(string))
+			}
+		}
+
+		Ω(warnings).Should(Equal([]string{"network"}))
+	})
+})
+
+var _ = Describe("Growing pools", func() {
+	var fakeContainerPool *fake_container_pool.FakeContainerPool
+	var linuxBackend *linux_backend.LinuxBackend
+
+	BeforeEach(func() {
+		fakeContainerPool = fake_container_pool.New()
+		fakeSystemInfo := fake_system_info.NewFakeProvider()
+		linuxBackend = linux_backend.New(logger, fakeContainerPool, fakeSystemInfo, nil, 1500, linux_backend.StartVerification{})
+	})
+
+	It("grows the container pool's port pool", func() {
+		err := linuxBackend.GrowPortPool(6000)
+		Ω(err).ShouldNot(HaveOccurred())
+
+		Ω(fakeContainerPool.GrownPortPoolSize).Should(Equal(uint32(6000)))
+	})
+
+	It("grows the container pool's network pool", func() {
+		_, ipNet, err := net.ParseCIDR("10.254.0.0/21")
+		Ω(err).ShouldNot(HaveOccurred())
+
+		err = linuxBackend.GrowNetworkPool(ipNet)
+		Ω(err).ShouldNot(HaveOccurred())
+
+		Ω(fakeContainerPool.GrownNetworkPool).Should(Equal(ipNet))
+	})
+
+	Context("when growing fails", func() {
+		disaster := errors.New("oh no!")
+
+		BeforeEach(func() {
+			fakeContainerPool.GrowPortPoolError = disaster
+		})
+
+		It("returns the error", func() {
+			err := linuxBackend.GrowPortPool(6000)
+			Ω(err).Should(Equal(disaster))
+		})
+	})
+})
+
+var _ = Describe("Exporting usage", func() {
+	var fakeContainerPool *fake_container_pool.FakeContainerPool
+	var fakeUsageExporter *fake_linux_backend.FakeUsageExporter
+	var linuxBackend *linux_backend.LinuxBackend
+
+	var container1, container2 *fake_container_pool.FakeContainer
+
+	BeforeEach(func() {
+		fakeContainerPool = fake_container_pool.New()
+		fakeSystemInfo := fake_system_info.NewFakeProvider()
+		linuxBackend = linux_backend.New(logger, fakeContainerPool, fakeSystemInfo, nil, 1500, linux_backend.StartVerification{})
+
+		fakeUsageExporter = new(fake_linux_backend.FakeUsageExporter)
+		linuxBackend.ExportUsageWith(fakeUsageExporter)
+
+		created, err := linuxBackend.Create(api.ContainerSpec{
+			Handle: "handle-1",
+			Properties: api.Properties{
+				linux_backend.MetricsAppIDProperty:   "some-app",
+				linux_backend.MetricsSpaceIDProperty: "some-space",
+				"some-property":                      "some-value",
+			},
+		})
+		Ω(err).ShouldNot(HaveOccurred())
+
+		container1 = created.(*fake_container_pool.FakeContainer)
+		container1.FinalUsage = linux_backend.UsageSummary{CPUTime: 1000}
+
+		created, err = linuxBackend.Create(api.ContainerSpec{Handle: "handle-2"})
+		Ω(err).ShouldNot(HaveOccurred())
+
+		container2 = created.(*fake_container_pool.FakeContainer)
+		container2.FinalUsage = linux_backend.UsageSummary{CPUTime: 2000}
+	})
+
+	It("gives each container's usage to the exporter, then flushes it", func() {
+		linuxBackend.ExportUsage()
+
+		Ω(fakeUsageExporter.Observed).Should(ConsistOf(
+			fake_linux_backend.ObservedUsage{
+				Handle: "handle-1",
+				Tags:   map[string]string{"app_id": "some-app", "space_id": "some-space"},
+				Usage:  linux_backend.UsageSummary{CPUTime: 1000},
+			},
+			fake_linux_backend.ObservedUsage{Handle: "handle-2", Usage: linux_backend.UsageSummary{CPUTime: 2000}},
+		))
+
+		Ω(fakeUsageExporter.Flushes).Should(Equal(1))
+	})
+
+	Context("when summarizing a container's usage fails", func() {
+		BeforeEach(func() {
+			container1.UsageSummaryError = errors.New("oh no!")
+		})
+
+		It("exports the others'", func() {
+			linuxBackend.ExportUsage()
+
+			Ω(fakeUsageExporter.Observed).Should(Equal([]fake_linux_backend.ObservedUsage{
+				{Handle: "handle-2", Usage: linux_backend.UsageSummary{CPUTime: 2000}},
+			}))
+
+			Ω(fakeUsageExporter.Flushes).Should(Equal(1))
+		})
+	})
+
+	Context("when flushing fails", func() {
+		BeforeEach(func() {
+			fakeUsageExporter.FlushError = errors.New("oh no!")
+		})
+
+		It("logs the failure", func() {
+			linuxBackend.ExportUsage()
+
+			messages := []string{}
+			for _, log := range logger.Logs() {
+				messages = append(messages, log.Message)
+			}
+
+			Ω(messages).Should(ContainElement("test.backend.failed-to-export-usage"))
+		})
+	})
+})
+
+var _ = Describe("Usage history", func() {
+	var fakeContainerPool *fake_container_pool.FakeContainerPool
+	var linuxBackend *linux_backend.LinuxBackend
+
+	var container *fake_container_pool.FakeContainer
+
+	BeforeEach(func() {
+		fakeContainerPool = fake_container_pool.New()
+		fakeSystemInfo := fake_system_info.NewFakeProvider()
+		linuxBackend = linux_backend.New(logger, fakeContainerPool, fakeSystemInfo, nil, 1500, linux_backend.StartVerification{})
+
+		created, err := linuxBackend.Create(api.ContainerSpec{Handle: "some-handle"})
+		Ω(err).ShouldNot(HaveOccurred())
+
+		container = created.(*fake_container_pool.FakeContainer)
+	})
+
+	It("samples each container's usage, keeping the given number of samples", func() {
+		linuxBackend.SampleUsage(60)
+
+		Ω(container.SampledUsageKeep).Should(Equal(60))
+	})
+
+	Context("when sampling a container fails", func() {
+		BeforeEach(func() {
+			container.SampleUsageError = errors.New("oh no!")
+		})
+
+		It("logs the failure", func() {
+			linuxBackend.SampleUsage(60)
+
+			messages := []string{}
+			for _, log := range logger.Logs() {
+				messages = append(messages, log.Message)
+			}
+
+			Ω(messages).Should(ContainElement("test.backend.failed-to-sample-usage"))
+		})
+	})
+
+	It("returns a container's usage history by handle", func() {
+		container.Usage = []linux_backend.UsageSample{
+			{CPU: api.ContainerCPUStat{Usage: 42}},
+		}
+
+		history, err := linuxBackend.UsageHistory("some-handle")
+		Ω(err).ShouldNot(HaveOccurred())
+
+		Ω(history).Should(Equal(container.Usage))
+	})
+
+	Context("when the handle is unknown", func() {
+		It("returns an error", func() {
+			_, err := linuxBackend.UsageHistory("bogus")
+			Ω(err).Should(Equal(linux_backend.UnknownHandleError{Handle: "bogus"}))
+		})
+	})
+})
+
+var _ = Describe("Adding net out rules", func() {
+	var fakeContainerPool *fake_container_pool.FakeContainerPool
+	var linuxBackend *linux_backend.LinuxBackend
+
+	var container *fake_container_pool.FakeContainer
+
+	BeforeEach(func() {
+		fakeContainerPool = fake_container_pool.New()
+		fakeSystemInfo := fake_system_info.NewFakeProvider()
+		linuxBackend = linux_backend.New(logger, fakeContainerPool, fakeSystemInfo, nil, 1500, linux_backend.StartVerification{})
+
+		created, err := linuxBackend.Create(api.ContainerSpec{Handle: "some-handle"})
+		Ω(err).ShouldNot(HaveOccurred())
+
+		container = created.(*fake_container_pool.FakeContainer)
+	})
+
+	It("adds the rule to the container by handle", func() {
+		rule := linux_backend.NetOutRule{
+			Protocol: linux_backend.ProtocolUDP,
+			Ports:    []linux_backend.PortRange{{Start: 8000, End: 9000}},
+		}
+
+		err := linuxBackend.AddNetOutRule("some-handle", rule)
+		Ω(err).ShouldNot(HaveOccurred())
+
+		Ω(container.NetOutRules).Should(Equal([]linux_backend.NetOutRule{rule}))
+	})
+
+	Context("when the handle is unknown", func() {
+		It("returns an error", func() {
+			err := linuxBackend.AddNetOutRule("bogus", linux_backend.NetOutRule{})
+			Ω(err).Should(Equal(linux_backend.UnknownHandleError{Handle: "bogus"}))
+		})
+	})
+
+	Describe("in bulk", func() {
+		It("adds the rules to the container by handle, at once", func() {
+			rules := []linux_backend.NetOutRule{
+				{Protocol: linux_backend.ProtocolUDP, Ports: []linux_backend.PortRange{{Start: 53, End: 53}}},
+				{Protocol: linux_backend.ProtocolICMP},
+			}
+
+			err := linuxBackend.BulkNetOut("some-handle", rules)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(container.NetOutRules).Should(Equal(rules))
+		})
+
+		Context("when the handle is unknown", func() {
+			It("returns an error", func() {
+				err := linuxBackend.BulkNetOut("bogus", nil)
+				Ω(err).Should(Equal(linux_backend.UnknownHandleError{Handle: "bogus"}))
+			})
+		})
+	})
+})
+
+var _ = Describe("Mapping port ranges", func() {
+	var fakeContainerPool *fake_container_pool.FakeContainerPool
+	var linuxBackend *linux_backend.LinuxBackend
+
+	var container *fake_container_pool.FakeContainer
+
+	BeforeEach(func() {
+		fakeContainerPool = fake_container_pool.New()
+		fakeSystemInfo := fake_system_info.NewFakeProvider()
+		linuxBackend = linux_backend.New(logger, fakeContainerPool, fakeSystemInfo, nil, 1500, linux_backend.StartVerification{})
+
+		created, err := linuxBackend.Create(api.ContainerSpec{Handle: "some-handle"})
+		Ω(err).ShouldNot(HaveOccurred())
+
+		container = created.(*fake_container_pool.FakeContainer)
+	})
+
+	It("maps a port into the container by handle for a protocol", func() {
+		hostPort, containerPort, err := linuxBackend.NetInProtocol("some-handle", linux_backend.ProtocolUDP, 5353, 53)
+		Ω(err).ShouldNot(HaveOccurred())
+
+		Ω(hostPort).Should(Equal(uint32(5353)))
+		Ω(containerPort).Should(Equal(uint32(53)))
+
+		Ω(container.NetIns).Should(Equal([]linux_backend.NetInSpec{
+			{HostPort: 5353, ContainerPort: 53, Protocol: linux_backend.ProtocolUDP},
+		}))
+	})
+
+	It("maps the range into the container by handle", func() {
+		spec, err := linuxBackend.NetInRange("some-handle", linux_backend.ProtocolUDP, 6000, 6000, 100)
+		Ω(err).ShouldNot(HaveOccurred())
+
+		mapped := linux_backend.NetInSpec{
+			HostPort:      6000,
+			ContainerPort: 6000,
+			Protocol:      linux_backend.ProtocolUDP,
+			Count:         100,
+		}
+
+		Ω(spec).Should(Equal(mapped))
+		Ω(container.NetInRanges).Should(Equal([]linux_backend.NetInSpec{mapped}))
+	})
+
+	Context("when the handle is unknown", func() {
+		It("returns an error", func() {
+			_, _, err := linuxBackend.NetInProtocol("bogus", linux_backend.ProtocolUDP, 0, 0)
+			Ω(err).Should(Equal(linux_backend.UnknownHandleError{Handle: "bogus"}))
+
+			_, err = linuxBackend.NetInRange("bogus", linux_backend.ProtocolTCP, 0, 0, 100)
+			Ω(err).Should(Equal(linux_backend.UnknownHandleError{Handle: "bogus"}))
+		})
+	})
+})
+
+var _ = Describe("Packet captures", func() {
+	var fakeContainerPool *fake_container_pool.FakeContainerPool
+	var linuxBackend *linux_backend.LinuxBackend
+
+	var container *fake_container_pool.FakeContainer
+
+	BeforeEach(func() {
+		fakeContainerPool = fake_container_pool.New()
+		fakeSystemInfo := fake_system_info.NewFakeProvider()
+		linuxBackend = linux_backend.New(logger, fakeContainerPool, fakeSystemInfo, nil, 1500, linux_backend.StartVerification{})
+
+		created, err := linuxBackend.Create(api.ContainerSpec{Handle: "some-handle"})
+		Ω(err).ShouldNot(HaveOccurred())
+
+		container = created.(*fake_container_pool.FakeContainer)
+	})
+
+	It("starts capturing a container by handle, returning the capture's path", func() {
+		container.CapturePath = "/var/garden/captures/some.pcap"
+
+		capturePath, err := linuxBackend.StartCapture("some-handle", linux_backend.CaptureLimits{Packets: 10})
+		Ω(err).ShouldNot(HaveOccurred())
+
+		Ω(capturePath).Should(Equal("/var/garden/captures/some.pcap"))
+		Ω(container.CaptureLimits).Should(Equal(&linux_backend.CaptureLimits{Packets: 10}))
+	})
+
+	It("stops capturing a container by handle", func() {
+		err := linuxBackend.StopCapture("some-handle")
+		Ω(err).ShouldNot(HaveOccurred())
+
+		Ω(container.CaptureStopped).Should(BeTrue())
+	})
+
+	Context("when the handle is unknown", func() {
+		It("returns an error", func() {
+			_, err := linuxBackend.StartCapture("bogus", linux_backend.CaptureLimits{})
+			Ω(err).Should(Equal(linux_backend.UnknownHandleError{Handle: "bogus"}))
+
+			err = linuxBackend.StopCapture("bogus")
+			Ω(err).Should(Equal(linux_backend.UnknownHandleError{Handle: "bogus"}))
+		})
+	})
+})
+
+var _ = Describe("CheckCoreDumps", func() {
+	var fakeContainerPool *fake_container_pool.FakeContainerPool
+	var linuxBackend *linux_backend.LinuxBackend
+
+	var container *fake_container_pool.FakeContainer
+
+	BeforeEach(func() {
+		fakeContainerPool = fake_container_pool.New()
+		fakeSystemInfo := fake_system_info.NewFakeProvider()
+		linuxBackend = linux_backend.New(logger, fakeContainerPool, fakeSystemInfo, nil, 1500, linux_backend.StartVerification{})
+
+		created, err := linuxBackend.Create(api.ContainerSpec{Handle: "some-handle"})
+		Ω(err).ShouldNot(HaveOccurred())
+
+		container = created.(*fake_container_pool.FakeContainer)
+	})
+
+	It("checks each container for new core dumps", func() {
+		linuxBackend.CheckCoreDumps()
+
+		Ω(container.CheckedCoreDumps).Should(BeTrue())
+	})
+
+	Context("when checking a container fails", func() {
+		BeforeEach(func() {
+			container.CheckCoreDumpsError = errors.New("oh no!")
+		})
+
+		It("logs the failure", func() {
+			linuxBackend.CheckCoreDumps()
+
+			messages := []string{}
+			for _, log := range logger.Logs() {
+				messages = append(messages, log.Message)
+			}
+
+			Ω(messages).Should(ContainElement("test.backend.failed-to-check-core-dumps"))
+		})
+	})
+})
+
+var _ = Describe("MonitorDaemons", func() {
+	var fakeContainerPool *fake_container_pool.FakeContainerPool
+	var linuxBackend *linux_backend.LinuxBackend
+
+	var alive, dead *fake_container_pool.FakeContainer
+
+	BeforeEach(func() {
+		fakeContainerPool = fake_container_pool.New()
+		fakeSystemInfo := fake_system_info.NewFakeProvider()
+		linuxBackend = linux_backend.New(logger, fakeContainerPool, fakeSystemInfo, nil, 1500, linux_backend.StartVerification{})
+
+		fakeContainerPool.ContainerSetup = func(c *fake_container_pool.FakeContainer) {
+			if c.Spec.Handle == "dead" {
+				c.CheckDaemonError = linux_backend.DeadDaemonError{Handle: "dead", PID: 123}
+			}
+		}
+
+		container, err := linuxBackend.Create(api.ContainerSpec{Handle: "alive"})
+		Ω(err).ShouldNot(HaveOccurred())
+		alive = container.(*fake_container_pool.FakeContainer)
+
+		container, err = linuxBackend.Create(api.ContainerSpec{Handle: "dead"})
+		Ω(err).ShouldNot(HaveOccurred())
+		dead = container.(*fake_container_pool.FakeContainer)
+	})
+
+	It("marks containers whose wshd has died as broken", func() {
+		linuxBackend.MonitorDaemons(false)
+
+		Ω(dead.BrokenReason).Should(Equal("wshd died"))
+		Ω(alive.BrokenReason).Should(BeEmpty())
+
+		Ω(fakeContainerPool.DestroyedContainers).Should(BeEmpty())
+	})
+
+	Context("when destroying dead containers", func() {
+		It("destroys them", func() {
+			linuxBackend.MonitorDaemons(true)
+
+			Ω(fakeContainerPool.DestroyedContainers).Should(Equal([]linux_backend.Container{dead}))
+
+			_, err := linuxBackend.Lookup("dead")
+			Ω(err).Should(HaveOccurred())
+
+			_, err = linuxBackend.Lookup("alive")
+			Ω(err).ShouldNot(HaveOccurred())
+		})
+	})
+
+	Context("when a daemon cannot be checked", func() {
+		BeforeEach(func() {
+			alive.CheckDaemonError = errors.New("no pid file")
+		})
+
+		It("does not break the container", func() {
+			linuxBackend.MonitorDaemons(true)
+
+			Ω(alive.BrokenReason).Should(BeEmpty())
+
+			_, err := linuxBackend.Lookup("alive")
+			Ω(err).ShouldNot(HaveOccurred())
+		})
+	})
+})
+
+var _ = Describe("Port reservations", func() {
+	var fakeContainerPool *fake_container_pool.FakeContainerPool
+	var fakeSystemInfo *fake_system_info.FakeProvider
+	var snapshotsPath string
+	var linuxBackend *linux_backend.LinuxBackend
+
+	BeforeEach(func() {
+		tmpdir, err := ioutil.TempDir(os.TempDir(), "garden-server-test")
+		Ω(err).ShouldNot(HaveOccurred())
+
+		fakeContainerPool = fake_container_pool.New()
+		fakeContainerPool.NextPort = 61001
+
+		fakeSystemInfo = fake_system_info.NewFakeProvider()
+
+		snapshotsPath = path.Join(tmpdir, "snapshots")
+
+		linuxBackend = linux_backend.New(logger, fakeContainerPool, fakeSystemInfo, snapshot_store.NewFileStore(snapshotsPath), 1500, linux_backend.StartVerification{})
+
+		err = linuxBackend.Start()
+		Ω(err).ShouldNot(HaveOccurred())
+	})
+
+	Describe("reserving a port", func() {
+		It("acquires the given port from the container pool", func() {
+			port, err := linuxBackend.ReservePort(61005)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(port).Should(Equal(uint32(61005)))
+
+			Ω(fakeContainerPool.AcquiredPorts).Should(Equal([]uint32{61005}))
+			Ω(linuxBackend.ReservedPorts()).Should(Equal([]uint32{61005}))
+		})
+
+		Context("when no port is given", func() {
+			It("acquires any port", func() {
+				port, err := linuxBackend.ReservePort(0)
+				Ω(err).ShouldNot(HaveOccurred())
+				Ω(port).Should(Equal(uint32(61001)))
+
+				Ω(linuxBackend.ReservedPorts()).Should(Equal([]uint32{61001}))
+			})
+		})
+
+		Context("when acquiring the port fails", func() {
+			disaster := errors.New("port taken")
+
+			BeforeEach(func() {
+				fakeContainerPool.AcquirePortError = disaster
+			})
+
+			It("returns the error, reserving nothing", func() {
+				_, err := linuxBackend.ReservePort(61005)
+				Ω(err).Should(Equal(disaster))
+
+				Ω(linuxBackend.ReservedPorts()).Should(BeEmpty())
+			})
+		})
+	})
+
+	Describe("releasing a port", func() {
+		It("releases it to the container pool", func() {
+			_, err := linuxBackend.ReservePort(61005)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			err = linuxBackend.ReleasePort(61005)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(fakeContainerPool.ReleasedPorts).Should(Equal([]uint32{61005}))
+			Ω(linuxBackend.ReservedPorts()).Should(BeEmpty())
+		})
+
+		Context("when the port is not reserved", func() {
+			It("returns UnreservedPortError, releasing nothing", func() {
+				err := linuxBackend.ReleasePort(61005)
+				Ω(err).Should(Equal(linux_backend.UnreservedPortError{Port: 61005}))
+
+				Ω(fakeContainerPool.ReleasedPorts).Should(BeEmpty())
+			})
+		})
+	})
+
+	Describe("claiming a reserved port", func() {
+		It("hands the reservation over, so that it is not released", func() {
+			_, err := linuxBackend.ReservePort(61005)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(linuxBackend.ClaimReservedPort(61005)).Should(BeTrue())
+			Ω(linuxBackend.ClaimReservedPort(61005)).Should(BeFalse())
+
+			err = linuxBackend.ReleasePort(61005)
+			Ω(err).Should(Equal(linux_backend.UnreservedPortError{Port: 61005}))
+		})
+
+		It("is not possible for unreserved ports", func() {
+			Ω(linuxBackend.ClaimReservedPort(61005)).Should(BeFalse())
+		})
+	})
+
+	It("makes the backend the port reservations of its containers", func() {
+		container, err := linuxBackend.Create(api.ContainerSpec{})
+		Ω(err).ShouldNot(HaveOccurred())
+
+		Ω(container.(*fake_container_pool.FakeContainer).PortReservations).Should(Equal(linuxBackend))
+	})
+
+	Describe("across restarts", func() {
+		BeforeEach(func() {
+			_, err := linuxBackend.ReservePort(61005)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			_, err = linuxBackend.ReservePort(61003)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			linuxBackend.Stop()
+
+			fakeContainerPool = fake_container_pool.New()
+			linuxBackend = linux_backend.New(logger, fakeContainerPool, fakeSystemInfo, snapshot_store.NewFileStore(snapshotsPath), 1500, linux_backend.StartVerification{})
+		})
+
+		It("keeps the reservations", func() {
+			err := linuxBackend.Start()
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(fakeContainerPool.AcquiredPorts).Should(Equal([]uint32{61003, 61005}))
+			Ω(linuxBackend.ReservedPorts()).Should(Equal([]uint32{61003, 61005}))
+		})
+
+		Context("when a port can no longer be acquired", func() {
+			BeforeEach(func() {
+				fakeContainerPool.AcquirePortError = errors.New("port taken")
+			})
+
+			It("starts without the reservation", func() {
+				err := linuxBackend.Start()
+				Ω(err).ShouldNot(HaveOccurred())
+
+				Ω(linuxBackend.ReservedPorts()).Should(BeEmpty())
+			})
+		})
+	})
+
+	Describe("across restarts without stopping", func() {
+		BeforeEach(func() {
+			_, err := linuxBackend.ReservePort(61005)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			_, err = linuxBackend.ReservePort(61003)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			_, err = linuxBackend.ReservePort(61007)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			err = linuxBackend.ReleasePort(61003)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(linuxBackend.ClaimReservedPort(61007)).Should(BeTrue())
+
+			fakeContainerPool = fake_container_pool.New()
+			linuxBackend = linux_backend.New(logger, fakeContainerPool, fakeSystemInfo, snapshot_store.NewFileStore(snapshotsPath), 1500, linux_backend.StartVerification{})
+		})
+
+		It("keeps the reservations as they last were", func() {
+			err := linuxBackend.Start()
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(fakeContainerPool.AcquiredPorts).Should(Equal([]uint32{61005}))
+			Ω(linuxBackend.ReservedPorts()).Should(Equal([]uint32{61005}))
+		})
+	})
+})
+
+var _ = Describe("WatchdogProbes", func() {
+	var linuxBackend *linux_backend.LinuxBackend
+
+	BeforeEach(func() {
+		linuxBackend = linux_backend.New(logger, fake_container_pool.New(), fake_system_info.NewFakeProvider(), nil, 1500, linux_backend.StartVerification{})
+	})
+
+	It("probes each of the backend's global locks", func() {
+		probes := linuxBackend.WatchdogProbes()
+		Ω(probes).Should(HaveLen(4))
+
+		for _, probe := range probes {
+			Ω(probe()).ShouldNot(HaveOccurred())
+		}
+	})
+
+	Context("when a lock is held", func() {
+		It("does not return until it is released", func() {
+			container, err := linuxBackend.Create(api.ContainerSpec{})
+			Ω(err).ShouldNot(HaveOccurred())
+
+			release, err := linuxBackend.AdmitLimits(container.(linux_backend.Container), linux_backend.CommittedResources{})
+			Ω(err).ShouldNot(HaveOccurred())
+
+			probed := make(chan error, 1)
+			go func() {
+				probed <- linuxBackend.WatchdogProbes()["commitments"]()
+			}()
+
+			Consistently(probed).ShouldNot(Receive())
+
+			release()
+
+			Eventually(probed).Should(Receive())
+		})
+	})
+})
+
+var _ = Describe("Backing up snapshots", func() {
+	var fakeContainerPool *fake_container_pool.FakeContainerPool
+	var fakeSystemInfo *fake_system_info.FakeProvider
+	var fakeSnapshotUploader *fake_linux_backend.FakeSnapshotUploader
+	var linuxBackend *linux_backend.LinuxBackend
+
+	var container1, container2 *fake_container_pool.FakeContainer
+
+	BeforeEach(func() {
+		fakeContainerPool = fake_container_pool.New()
+		fakeSystemInfo = fake_system_info.NewFakeProvider()
+		fakeSystemInfo.BootIDResult = "some-boot-id"
+
+		linuxBackend = linux_backend.New(logger, fakeContainerPool, fakeSystemInfo, nil, 1500, linux_backend.StartVerification{})
+
+		fakeSnapshotUploader = fake_linux_backend.NewFakeSnapshotUploader()
+		linuxBackend.BackUpSnapshotsTo(fakeSnapshotUploader)
+
+		created, err := linuxBackend.Create(api.ContainerSpec{Handle: "handle-1"})
+		Ω(err).ShouldNot(HaveOccurred())
+
+		container1 = created.(*fake_container_pool.FakeContainer)
+		container1.SnapshotData = []byte("snapshot-1")
+
+		created, err = linuxBackend.Create(api.ContainerSpec{Handle: "handle-2"})
+		Ω(err).ShouldNot(HaveOccurred())
+
+		container2 = created.(*fake_container_pool.FakeContainer)
+		container2.SnapshotData = []byte("snapshot-2")
+
+		_, err = linuxBackend.ReservePort(61005)
+		Ω(err).ShouldNot(HaveOccurred())
+	})
+
+	notHeld := func() interface{} {
+		for _, log := range logger.Logs() {
+			if log.Message == "test.backend.back-up-snapshots.keeping-backups-not-held" {
+				return log.Data["names"]
+			}
+		}
+
+		return nil
+	}
+
+	It("uploads each container's snapshot, the reserved ports and the boot ID, as the file store names them", func() {
+		linuxBackend.BackUpSnapshots()
+
+		Ω(fakeSnapshotUploader.Uploaded).Should(Equal(map[string][]byte{
+			"handle-1":        []byte("snapshot-1"),
+			"handle-2":        []byte("snapshot-2"),
+			".reserved-ports": []byte("[61005]"),
+			".boot-id":        []byte("some-boot-id"),
+		}))
+	})
+
+	It("uploads only what has changed since it was last uploaded", func() {
+		linuxBackend.BackUpSnapshots()
+		Ω(fakeSnapshotUploader.Uploads).Should(Equal(4))
+
+		linuxBackend.BackUpSnapshots()
+		Ω(fakeSnapshotUploader.Uploads).Should(Equal(4))
+
+		container1.SnapshotData = []byte("snapshot-1-changed")
+
+		linuxBackend.BackUpSnapshots()
+		Ω(fakeSnapshotUploader.Uploads).Should(Equal(5))
+		Ω(fakeSnapshotUploader.Uploaded["handle-1"]).Should(Equal([]byte("snapshot-1-changed")))
+	})
+
+	It("deletes the snapshots of containers since destroyed", func() {
+		linuxBackend.BackUpSnapshots()
+
+		err := linuxBackend.Destroy("handle-2")
+		Ω(err).ShouldNot(HaveOccurred())
+
+		linuxBackend.BackUpSnapshots()
+
+		Ω(fakeSnapshotUploader.Deleted).Should(Equal([]string{"handle-2"}))
+		Ω(fakeSnapshotUploader.Uploaded).ShouldNot(HaveKey("handle-2"))
+	})
+
+	Context("when snapshots were uploaded by an earlier server", func() {
+		BeforeEach(func() {
+			fakeSnapshotUploader.Uploaded["handle-1"] = []byte("snapshot-1-stale")
+			fakeSnapshotUploader.Uploaded["handle-destroyed-while-down"] = []byte("snapshot-3")
+		})
+
+		It("replaces those of containers it holds, and leaves the rest, logging them", func() {
+			linuxBackend.BackUpSnapshots()
+
+			Ω(fakeSnapshotUploader.Deleted).Should(BeEmpty())
+			Ω(fakeSnapshotUploader.Uploaded["handle-1"]).Should(Equal([]byte("snapshot-1")))
+			Ω(fakeSnapshotUploader.Uploaded["handle-destroyed-while-down"]).Should(Equal([]byte("snapshot-3")))
+
+			Ω(notHeld()).Should(Equal([]interface{}{"handle-destroyed-while-down"}))
+		})
+
+		It("does not delete them on later backups", func() {
+			linuxBackend.BackUpSnapshots()
+			linuxBackend.BackUpSnapshots()
+
+			Ω(fakeSnapshotUploader.Deleted).Should(BeEmpty())
+		})
+
+		Context("and listing them fails", func() {
+			BeforeEach(func() {
+				fakeSnapshotUploader.ListError = errors.New("oh no!")
+			})
+
+			It("still uploads, and lists them on the next backup", func() {
+				linuxBackend.BackUpSnapshots()
+
+				Ω(fakeSnapshotUploader.Uploaded["handle-1"]).Should(Equal([]byte("snapshot-1")))
+
+				fakeSnapshotUploader.ListError = nil
+
+				linuxBackend.BackUpSnapshots()
+
+				Ω(fakeSnapshotUploader.Deleted).Should(BeEmpty())
+				Ω(notHeld()).Should(Equal([]interface{}{"handle-destroyed-while-down"}))
+			})
+		})
+	})
+
+	Context("when the server starts with no local snapshots", func() {
+		BeforeEach(func() {
+			linuxBackend = linux_backend.New(logger, fake_container_pool.New(), fakeSystemInfo, nil, 1500, linux_backend.StartVerification{})
+			linuxBackend.BackUpSnapshotsTo(fakeSnapshotUploader)
+
+			fakeSnapshotUploader.Uploaded["handle-1"] = []byte("snapshot-1")
+			fakeSnapshotUploader.Uploaded["handle-2"] = []byte("snapshot-2")
+		})
+
+		It("leaves the snapshots uploaded before it, to be restored", func() {
+			linuxBackend.BackUpSnapshots()
+			linuxBackend.BackUpSnapshots()
+
+			Ω(fakeSnapshotUploader.Deleted).Should(BeEmpty())
+			Ω(fakeSnapshotUploader.Uploaded).Should(HaveKeyWithValue("handle-1", []byte("snapshot-1")))
+			Ω(fakeSnapshotUploader.Uploaded).Should(HaveKeyWithValue("handle-2", []byte("snapshot-2")))
+		})
+	})
+
+	It("backs up when stopping", func() {
+		linuxBackend.Stop()
+
+		Ω(fakeSnapshotUploader.Uploaded).Should(HaveKey("handle-1"))
+		Ω(fakeSnapshotUploader.Uploaded).Should(HaveKey("handle-2"))
+	})
+
+	Context("when uploading fails", func() {
+		BeforeEach(func() {
+			fakeSnapshotUploader.UploadError = errors.New("oh no!")
+		})
+
+		It("uploads everything on the next backup", func() {
+			linuxBackend.BackUpSnapshots()
+
+			fakeSnapshotUploader.UploadError = nil
+
+			linuxBackend.BackUpSnapshots()
+			Ω(fakeSnapshotUploader.Uploads).Should(Equal(4))
+		})
+	})
+
+	Context("when a container cannot be snapshotted", func() {
+		It("keeps its last backup", func() {
+			linuxBackend.BackUpSnapshots()
+
+			container1.SnapshotError = errors.New("oh no!")
+
+			linuxBackend.BackUpSnapshots()
+
+			Ω(fakeSnapshotUploader.Deleted).Should(BeEmpty())
+			Ω(fakeSnapshotUploader.Uploaded["handle-1"]).Should(Equal([]byte("snapshot-1")))
+		})
+	})
+
+	Context("when deleting fails", func() {
+		It("deletes it on the next backup", func() {
+			linuxBackend.BackUpSnapshots()
+
+			err := linuxBackend.Destroy("handle-2")
+			Ω(err).ShouldNot(HaveOccurred())
+
+			fakeSnapshotUploader.DeleteError = errors.New("oh no!")
+			linuxBackend.BackUpSnapshots()
+
+			fakeSnapshotUploader.DeleteError = nil
+			linuxBackend.BackUpSnapshots()
+
+			Ω(fakeSnapshotUploader.Deleted).Should(Equal([]string{"handle-2"}))
+		})
+	})
+})
@@ -5,6 +5,8 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"io/ioutil"
+	"net"
 	"os"
 	"os/exec"
 	"path"
@@ -12,12 +14,16 @@ import (
 	"strconv"
 	"strings"
 	"sync"
+	"syscall"
 	"time"
 
 	"github.com/cloudfoundry-incubator/garden-linux/old/linux_backend/bandwidth_manager"
 	"github.com/cloudfoundry-incubator/garden-linux/old/linux_backend/cgroups_manager"
+	"github.com/cloudfoundry-incubator/garden-linux/old/linux_backend/env"
+	"github.com/cloudfoundry-incubator/garden-linux/old/linux_backend/iptables_manager"
 	"github.com/cloudfoundry-incubator/garden-linux/old/linux_backend/process_tracker"
 	"github.com/cloudfoundry-incubator/garden-linux/old/linux_backend/quota_manager"
+	"github.com/cloudfoundry-incubator/garden-linux/old/linux_backend/volume_manager"
 	"github.com/cloudfoundry-incubator/garden-linux/old/logging"
 	"github.com/cloudfoundry-incubator/garden/api"
 	"github.com/cloudfoundry/gunk/command_runner"
@@ -36,13 +42,20 @@ type LinuxContainer struct {
 	graceTime time.Duration
 
 	state      State
+	stateTimes StateTimes
 	stateMutex sync.RWMutex
 
 	events      []string
 	eventsMutex sync.RWMutex
 
+	warnings      []string
+	warningsMutex sync.RWMutex
+
 	resources *Resources
 
+	// the MTU it was started with, to start it with again after a reboot
+	mtu uint32
+
 	portPool PortPool
 
 	runner command_runner.CommandRunner
@@ -50,12 +63,21 @@ type LinuxContainer struct {
 	cgroupsManager   cgroups_manager.CgroupsManager
 	quotaManager     quota_manager.QuotaManager
 	bandwidthManager bandwidth_manager.BandwidthManager
+	iptablesManager  iptables_manager.IPTablesManager
+
+	// if non-nil, the container's writable storage is a volume of its own,
+	// whose size is its disk limit, rather than limited by quotas
+	volumeManager volume_manager.VolumeManager
 
 	processTracker process_tracker.ProcessTracker
 
 	oomMutex    sync.RWMutex
 	oomNotifier *exec.Cmd
 
+	// net.sh capture, while running
+	capture      *exec.Cmd
+	captureMutex sync.Mutex
+
 	currentBandwidthLimits *api.BandwidthLimits
 	bandwidthMutex         sync.RWMutex
 
@@ -63,25 +85,150 @@ type LinuxContainer struct {
 	diskMutex         sync.RWMutex
 
 	currentMemoryLimits *api.MemoryLimits
+	swapLimited         bool
 	memoryMutex         sync.RWMutex
 
 	currentCPULimits *api.CPULimits
 	cpuMutex         sync.RWMutex
 
+	currentHugePageLimits HugePageLimits
+	hugePagesMutex        sync.RWMutex
+
 	netIns      []NetInSpec
 	netInsMutex sync.RWMutex
 
-	netOuts      []NetOutSpec
+	netOuts      []NetOutRule
 	netOutsMutex sync.RWMutex
 
+	// held while the container's rules are changed or reinstalled, so that
+	// reconciling cannot race mapping ports, allowing traffic, or teardown
+	networkMutex sync.Mutex
+	destroying   bool
+
+	liveness      map[uint32]LivenessStatus
+	livenessMutex sync.RWMutex
+
+	usage      usageHistory
+	usageMutex sync.RWMutex
+
 	envvars []string
+
+	rootFSProvenance RootFSProvenance
+
+	annotations Annotations
+
+	defaultRLimits api.ResourceLimits
+
+	limitAdmitter      LimitAdmitter
+	limitAdmitterMutex sync.RWMutex
+
+	portReservations      PortReservations
+	portReservationsMutex sync.RWMutex
+
+	// set by the pool, if at all, before the container is started
+	linkBuilder LinkBuilder
+}
+
+// RootFSProvenance records what a container's rootfs was created from: the
+// provider, the image as requested, and for images from a graph, the image
+// ID and its layers, from the image itself down to its base.
+type RootFSProvenance struct {
+	Provider string
+	Image    string
+	ImageID  string   `json:",omitempty"`
+	Layers   []string `json:",omitempty"`
 }
 
+// Annotations are what the server records about a container when creating
+// it. Unlike properties, clients cannot set them; Info reports them under
+// AnnotationPropertyPrefix.
+type Annotations struct {
+	CreatedAt     time.Time
+	GardenVersion string `json:",omitempty"`
+}
+
+// CommittedResources are the memory and disk, in bytes, that a container's
+// limits let it use, zero for those it has no limit on.
+type CommittedResources struct {
+	MemoryInBytes uint64
+	DiskInBytes   uint64
+}
+
+// StateTimes are when a container last started and stopped, zero if it has
+// not.
+type StateTimes struct {
+	StartedAt time.Time
+	StoppedAt time.Time
+}
+
+// AnnotationPropertyPrefix is that of the properties reporting a
+// container's annotations, state times and rootfs provenance in Info. Clients may not
+// set properties with it.
+const AnnotationPropertyPrefix = "annotation."
+
 type NetInSpec struct {
 	HostPort      uint32
 	ContainerPort uint32
+
+	// Protocol is tcp or udp; snapshots predating it leave it unset, as tcp
+	Protocol Protocol
+
+	// Count, if more than one, is how many contiguous ports from HostPort
+	// are mapped, by a single rule, to the same ports of the container
+	Count uint32
+}
+
+// ports are the mapping's host and container ports, a pair per port.
+func (spec NetInSpec) ports() []api.PortMapping {
+	count := spec.Count
+	if count == 0 {
+		count = 1
+	}
+
+	ports := make([]api.PortMapping, 0, count)
+	for i := uint32(0); i < count; i++ {
+		ports = append(ports, api.PortMapping{
+			HostPort:      spec.HostPort + i,
+			ContainerPort: spec.ContainerPort + i,
+		})
+	}
+
+	return ports
 }
 
+// MaxPort is the highest TCP or UDP port.
+const MaxPort = 65535
+
+type InvalidNetInRangeError struct {
+	Reason string
+}
+
+func (e InvalidNetInRangeError) Error() string {
+	return "invalid net in range: " + e.Reason
+}
+
+type UnsupportedNetInProtocolError struct {
+	Protocol Protocol
+}
+
+func (e UnsupportedNetInProtocolError) Error() string {
+	return "net in only supports tcp and udp, not " + e.Protocol.String()
+}
+
+// LinksNotOwnedError is returned for net in and net out on a container whose
+// links a link builder made. Their rules would be bound to host-side links
+// that the container does not have, and so would silently filter and map
+// nothing; the builder must look after its traffic instead.
+type LinksNotOwnedError struct {
+	Operation string
+}
+
+func (e LinksNotOwnedError) Error() string {
+	return e.Operation + " is unsupported for containers whose links are built by the network plugin"
+}
+
+// NetOutSpec is the legacy form of a NetOutRule, as found in snapshots taken
+// before rules were structured.
 type NetOutSpec struct {
 	Network string
 	Port    uint32
@@ -89,8 +236,13 @@ type NetOutSpec struct {
 
 type PortPool interface {
 	Acquire() (uint32, error)
+	AcquireRange(count uint32) (uint32, error)
 	Remove(uint32) error
+	RemoveAll([]uint32) error
 	Release(uint32)
+	Grow(uint32) error
+	InitialSize() int
+	Available() int
 }
 
 type State string
@@ -99,6 +251,157 @@ const (
 	StateBorn    = State("born")
 	StateActive  = State("active")
 	StateStopped = State("stopped")
+
+	// a container whose destroy or restore failed; it holds on to its
+	// resources, and runs nothing more, until it is destroyed
+	StateBroken = State("broken")
+)
+
+type BrokenContainerError struct {
+	Handle string
+}
+
+func (e BrokenContainerError) Error() string {
+	return "container is broken: " + e.Handle
+}
+
+type DestroyingContainerError struct {
+	Handle string
+}
+
+func (e DestroyingContainerError) Error() string {
+	return "container is being destroyed: " + e.Handle
+}
+
+// StartVerificationError says which check a started container failed.
+type StartVerificationError struct {
+	Handle string
+	Check  string
+	Err    error
+}
+
+func (e StartVerificationError) Error() string {
+	return fmt.Sprintf("container %s failed %s check after starting: %s", e.Handle, e.Check, e.Err)
+}
+
+type DeadDaemonError struct {
+	Handle string
+	PID    int
+}
+
+func (e DeadDaemonError) Error() string {
+	return fmt.Sprintf("wshd (pid %d) of container %s has died", e.PID, e.Handle)
+}
+
+type CommandTimedOutError struct {
+	Path    string
+	Timeout time.Duration
+}
+
+func (e CommandTimedOutError) Error() string {
+	return fmt.Sprintf("%s did not finish within %s", e.Path, e.Timeout)
+}
+
+// ExternalIPProperty requests an external IP for a container on creation,
+// and reports it in Info
+const ExternalIPProperty = "network.external_ip"
+
+// MTUProperty sets the MTU of a container's network interfaces on
+// creation, instead of the server's, e.g. for containers whose traffic is
+// carried by an overlay. It may not exceed the host's MTU.
+const MTUProperty = "network.mtu"
+
+// MinMTU is the least MTU an IPv4 interface may have.
+const MinMTU = 68
+
+// DNSServersProperty (comma-separated IPs, at most MaxDNSServers) and
+// DNSSearchDomainsProperty (comma-separated domains) are written to a
+// container's /etc/resolv.conf on creation, instead of the server's
+// defaults or, without those, the host's.
+const (
+	DNSServersProperty       = "network.dns_servers"
+	DNSSearchDomainsProperty = "network.dns_search_domains"
+)
+
+// MaxDNSServers is the most nameservers the resolver uses.
+const MaxDNSServers = 3
+
+// TunProperty, when "true", opts a container in to /dev/net/tun on creation,
+// with CAP_NET_ADMIN kept by its unprivileged processes so that they can
+// configure the device in the container's network namespace.
+const TunProperty = "network.tun"
+
+// FuseProperty, when "true", opts a container in to /dev/fuse on creation,
+// so that its processes can mount FUSE filesystems with the rootfs's
+// fusermount.
+const FuseProperty = "filesystem.fuse"
+
+// AllowSetuidProperty, when "true", opts a container out of its unprivileged
+// processes being run with no_new_privs, so that setuid binaries in its
+// image work as they would on a host. Containers with /dev/fuse are opted
+// out, as their users mount with the image's setuid fusermount.
+const AllowSetuidProperty = "security.allow_setuid"
+
+// HardenProcSysProperty, "true" or "false", overrides whether the server
+// hardens a container's /proc and /sys when it is started: /proc is mounted
+// with hidepid=2, so that unprivileged processes see only their own user's,
+// /proc/kcore and /proc/sys are masked, and /sys, if anything is mounted
+// there, is made read-only with /sys/firmware masked.
+const HardenProcSysProperty = "security.harden_proc_sys"
+
+// AppArmorProfileProperty selects the AppArmor profile, which must be loaded
+// on the host, that a container's processes are confined with, rather than
+// the server's default, or AppArmorUnconfined for none. It has no effect on
+// hosts without AppArmor.
+const AppArmorProfileProperty = "security.apparmor_profile"
+
+const AppArmorUnconfined = "unconfined"
+
+// Properties under MetricTagPropertyPrefix tag what is reported of a
+// container's usage, in exported usage records and the log of its final
+// usage, by the rest of their key, so that downstream systems can aggregate
+// it by e.g. tenant. MetricsAppIDProperty and MetricsSpaceIDProperty are the
+// well-known ones.
+const (
+	MetricTagPropertyPrefix = "metrics."
+
+	MetricsAppIDProperty   = MetricTagPropertyPrefix + "app_id"
+	MetricsSpaceIDProperty = MetricTagPropertyPrefix + "space_id"
+)
+
+// MetricTags are the container's metric tag properties, keyed without their
+// prefix, or nil if it has none.
+func MetricTags(properties api.Properties) map[string]string {
+	var tags map[string]string
+
+	for key, value := range properties {
+		if !strings.HasPrefix(key, MetricTagPropertyPrefix) {
+			continue
+		}
+
+		if tags == nil {
+			tags = map[string]string{}
+		}
+
+		tags[strings.TrimPrefix(key, MetricTagPropertyPrefix)] = value
+	}
+
+	return tags
+}
+
+// SwapLimitedProperty reports in Info whether a container's memory limit
+// includes swap, which it does only on hosts with swap accounting.
+const SwapLimitedProperty = "memory.swap_limited"
+
+// ShutdownHookProperty is a command run in the container, as vcap, when it
+// is stopped gracefully, before its processes are killed. It is given
+// ShutdownHookTimeoutProperty (a duration, DefaultShutdownHookTimeout if
+// unset) to finish.
+const (
+	ShutdownHookProperty        = "lifecycle.shutdown_hook"
+	ShutdownHookTimeoutProperty = "lifecycle.shutdown_hook_timeout"
+
+	DefaultShutdownHookTimeout = 10 * time.Second
 )
 
 func NewLinuxContainer(
@@ -111,9 +414,14 @@ func NewLinuxContainer(
 	runner command_runner.CommandRunner,
 	cgroupsManager cgroups_manager.CgroupsManager,
 	quotaManager quota_manager.QuotaManager,
+	volumeManager volume_manager.VolumeManager,
 	bandwidthManager bandwidth_manager.BandwidthManager,
+	iptablesManager iptables_manager.IPTablesManager,
 	processTracker process_tracker.ProcessTracker,
 	envvars []string,
+	rootFSProvenance RootFSProvenance,
+	annotations Annotations,
+	defaultRLimits api.ResourceLimits,
 ) *LinuxContainer {
 	return &LinuxContainer{
 		logger: logger,
@@ -138,10 +446,19 @@ func NewLinuxContainer(
 		cgroupsManager:   cgroupsManager,
 		quotaManager:     quotaManager,
 		bandwidthManager: bandwidthManager,
+		iptablesManager:  iptablesManager,
+
+		volumeManager: volumeManager,
 
 		processTracker: processTracker,
 
 		envvars: envvars,
+
+		rootFSProvenance: rootFSProvenance,
+
+		annotations: annotations,
+
+		defaultRLimits: defaultRLimits,
 	}
 }
 
@@ -161,6 +478,149 @@ func (c *LinuxContainer) Properties() api.Properties {
 	return c.properties
 }
 
+func (c *LinuxContainer) RootFSProvenance() RootFSProvenance {
+	return c.rootFSProvenance
+}
+
+func (c *LinuxContainer) Annotations() Annotations {
+	return c.annotations
+}
+
+// infoProperties are the container's properties plus the details of its
+// network, as network.subnet, network.netmask, network.gateway,
+// network.host_iface and network.container_iface, the same of its additional
+// networks, as network.<n>.* counting from 1 and with host_ip and
+// container_ip in place of the gateway, its external IP, which of its mapped
+// ports are udp, as network.udp_ports, its warnings, where its core dumps
+// and captures are, its rootfs provenance, as rootfs.*, and its annotations
+// and state times, which api.ContainerInfo has no other place for
+func (c *LinuxContainer) infoProperties() api.Properties {
+	properties := api.Properties{}
+	for key, value := range c.Properties() {
+		properties[key] = value
+	}
+
+	udpPorts := []string{}
+
+	c.netInsMutex.RLock()
+
+	for _, spec := range c.netIns {
+		if spec.Protocol != ProtocolUDP {
+			continue
+		}
+
+		for _, mapping := range spec.ports() {
+			udpPorts = append(udpPorts, fmt.Sprintf("%d:%d", mapping.HostPort, mapping.ContainerPort))
+		}
+	}
+
+	c.netInsMutex.RUnlock()
+
+	if len(udpPorts) > 0 {
+		properties["network.udp_ports"] = strings.Join(udpPorts, ",")
+	}
+
+	if c.resources.ExternalIP != nil {
+		properties[ExternalIPProperty] = c.resources.ExternalIP.String()
+	}
+
+	for i, warning := range c.Warnings() {
+		properties[fmt.Sprintf("%s%d", WarningsPropertyPrefix, i+1)] = warning
+	}
+
+	if _, err := os.Stat(c.coreDumpsDir()); err == nil {
+		properties[CoreDumpsPathProperty] = CoreDumpsPath
+	}
+
+	if _, err := os.Stat(c.capturesDir()); err == nil {
+		properties[CapturesPathProperty] = CapturesPath
+	}
+
+	c.memoryMutex.RLock()
+
+	if c.currentMemoryLimits != nil {
+		properties[SwapLimitedProperty] = strconv.FormatBool(c.swapLimited)
+	}
+
+	c.memoryMutex.RUnlock()
+
+	for processID, status := range c.LivenessStatuses() {
+		prefix := fmt.Sprintf("process.%d.", processID)
+
+		if status.Healthy {
+			properties[prefix+"liveness"] = "healthy"
+		} else {
+			properties[prefix+"liveness"] = "unhealthy"
+		}
+
+		properties[prefix+"liveness_failures"] = strconv.Itoa(status.ConsecutiveFailures)
+	}
+
+	ifaces := c.networkInterfaces()
+
+	properties["network.subnet"] = c.resources.Network.String()
+	properties["network.netmask"] = c.resources.Network.Netmask().String()
+	properties["network.gateway"] = c.resources.Network.HostIP().String()
+
+	if len(ifaces) > 0 {
+		properties["network.host_iface"] = ifaces[0][0]
+		properties["network.container_iface"] = ifaces[0][1]
+	}
+
+	for i, network := range c.resources.AdditionalNetworks {
+		prefix := fmt.Sprintf("network.%d.", i+1)
+		properties[prefix+"subnet"] = network.String()
+		properties[prefix+"netmask"] = network.Netmask().String()
+		properties[prefix+"host_ip"] = network.HostIP().String()
+		properties[prefix+"container_ip"] = network.ContainerIP().String()
+
+		if len(ifaces) > i+1 {
+			properties[prefix+"host_iface"] = ifaces[i+1][0]
+			properties[prefix+"container_iface"] = ifaces[i+1][1]
+		}
+	}
+
+	// rootfs.* are kept for clients from before annotations
+	for _, prefix := range []string{"", AnnotationPropertyPrefix} {
+		if c.rootFSProvenance.Provider != "" {
+			properties[prefix+"rootfs.provider"] = c.rootFSProvenance.Provider
+		}
+
+		if c.rootFSProvenance.Image != "" {
+			properties[prefix+"rootfs.image"] = c.rootFSProvenance.Image
+		}
+
+		if c.rootFSProvenance.ImageID != "" {
+			properties[prefix+"rootfs.image_id"] = c.rootFSProvenance.ImageID
+		}
+
+		if len(c.rootFSProvenance.Layers) > 0 {
+			properties[prefix+"rootfs.layers"] = strings.Join(c.rootFSProvenance.Layers, ",")
+		}
+	}
+
+	// zero in snapshots from before annotations
+	if !c.annotations.CreatedAt.IsZero() {
+		properties[AnnotationPropertyPrefix+"created_at"] = c.annotations.CreatedAt.UTC().Format(time.RFC3339)
+	}
+
+	if c.annotations.GardenVersion != "" {
+		properties[AnnotationPropertyPrefix+"garden_version"] = c.annotations.GardenVersion
+	}
+
+	stateTimes := c.StateTimes()
+
+	if !stateTimes.StartedAt.IsZero() {
+		properties[AnnotationPropertyPrefix+"started_at"] = stateTimes.StartedAt.UTC().Format(time.RFC3339)
+	}
+
+	if !stateTimes.StoppedAt.IsZero() {
+		properties[AnnotationPropertyPrefix+"stopped_at"] = stateTimes.StoppedAt.UTC().Format(time.RFC3339)
+	}
+
+	return properties
+}
+
 func (c *LinuxContainer) State() State {
 	c.stateMutex.RLock()
 	defer c.stateMutex.RUnlock()
@@ -168,6 +628,13 @@ func (c *LinuxContainer) State() State {
 	return c.state
 }
 
+func (c *LinuxContainer) StateTimes() StateTimes {
+	c.stateMutex.RLock()
+	defer c.stateMutex.RUnlock()
+
+	return c.stateTimes
+}
+
 func (c *LinuxContainer) Events() []string {
 	c.eventsMutex.RLock()
 	defer c.eventsMutex.RUnlock()
@@ -200,6 +667,9 @@ func (c *LinuxContainer) Snapshot(out io.Writer) error {
 	c.memoryMutex.RLock()
 	defer c.memoryMutex.RUnlock()
 
+	c.hugePagesMutex.RLock()
+	defer c.hugePagesMutex.RUnlock()
+
 	c.netInsMutex.RLock()
 	defer c.netInsMutex.RUnlock()
 
@@ -223,42 +693,53 @@ func (c *LinuxContainer) Snapshot(out io.Writer) error {
 
 		GraceTime: c.graceTime,
 
-		State:  string(c.State()),
-		Events: c.Events(),
+		State:      string(c.State()),
+		StateTimes: c.StateTimes(),
+		Events:     c.Events(),
+		Warnings:   c.Warnings(),
 
 		Limits: LimitsSnapshot{
 			Bandwidth: c.currentBandwidthLimits,
 			CPU:       c.currentCPULimits,
 			Disk:      c.currentDiskLimits,
 			Memory:    c.currentMemoryLimits,
+			HugePages: c.currentHugePageLimits,
 		},
 
 		Resources: ResourcesSnapshot{
-			UID:     c.resources.UID,
-			Network: c.resources.Network,
-			Ports:   c.resources.Ports,
+			UID:                c.resources.UID,
+			Network:            c.resources.Network,
+			AdditionalNetworks: c.resources.AdditionalNetworks,
+			ExternalIP:         c.resources.ExternalIP,
+			Ports:              c.resources.Ports,
 		},
 
-		NetIns:  c.netIns,
-		NetOuts: c.netOuts,
+		NetIns:      c.netIns,
+		NetOutRules: c.netOuts,
 
 		Processes: processSnapshots,
 
 		Properties: c.Properties(),
 
 		EnvVars: c.envvars,
+
+		RootFSProvenance: c.rootFSProvenance,
+
+		Annotations: c.annotations,
+
+		MTU: c.mtu,
 	}
 
 	err := json.NewEncoder(out).Encode(snapshot)
 	if err != nil {
 		cLog.Error("failed-to-save", err, lager.Data{
-			"snapshot": snapshot,
+			"snapshot": snapshot.loggable(),
 		})
 		return err
 	}
 
 	cLog.Info("saved", lager.Data{
-		"snapshot": snapshot,
+		"snapshot": snapshot.loggable(),
 	})
 
 	return nil
@@ -274,14 +755,42 @@ func (c *LinuxContainer) Restore(snapshot ContainerSnapshot) error {
 		Logger:        cLog,
 	}
 
-	c.setState(State(snapshot.State))
+	c.stateMutex.Lock()
+	c.state = State(snapshot.State)
+	c.stateTimes = snapshot.StateTimes
+	c.stateMutex.Unlock()
+
+	c.warningsMutex.Lock()
+	c.warnings = snapshot.Warnings
+	c.warningsMutex.Unlock()
 
 	c.envvars = snapshot.EnvVars
 
+	err := c.writeEnv()
+	if err != nil {
+		cLog.Error("failed-to-write-env", err)
+		return err
+	}
+
 	for _, ev := range snapshot.Events {
 		c.registerEvent(ev)
 	}
 
+	c.mtu = snapshot.MTU
+
+	if snapshot.HostRebooted {
+		err := c.reerect(cLog, snapshot)
+		if err != nil {
+			cLog.Error("failed-to-reerect", err)
+			return err
+		}
+	}
+
+	// quotas and volumes keep disk limits themselves
+	c.diskMutex.Lock()
+	c.currentDiskLimits = snapshot.Limits.Disk
+	c.diskMutex.Unlock()
+
 	if snapshot.Limits.Memory != nil {
 		err := c.LimitMemory(*snapshot.Limits.Memory)
 		if err != nil {
@@ -290,36 +799,74 @@ func (c *LinuxContainer) Restore(snapshot ContainerSnapshot) error {
 		}
 	}
 
-	for _, process := range snapshot.Processes {
-		cLog.Info("restoring-process", lager.Data{
-			"process": process,
-		})
+	if len(snapshot.Limits.HugePages) > 0 {
+		err := c.LimitHugePages(snapshot.Limits.HugePages)
+		if err != nil {
+			cLog.Error("failed-to-limit-huge-pages", err)
+			return err
+		}
+	}
+
+	// after a reboot there is nothing to re-attach to
+	if !snapshot.HostRebooted {
+		for _, process := range snapshot.Processes {
+			cLog.Info("restoring-process", lager.Data{
+				"process": process,
+			})
 
-		c.processTracker.Restore(process.ID)
+			c.processTracker.Restore(process.ID)
+		}
 	}
 
 	net := exec.Command(path.Join(c.path, "net.sh"), "setup")
 
-	err := cRunner.Run(net)
+	err = cRunner.Run(net)
 	if err != nil {
 		cLog.Error("failed-to-reenforce-network-rules", err)
 		return err
 	}
 
+	netIns := []NetInSpec{}
 	for _, in := range snapshot.NetIns {
-		_, _, err = c.NetIn(in.HostPort, in.ContainerPort)
+		protocol := in.Protocol
+		if protocol == ProtocolAll {
+			protocol = ProtocolTCP
+		}
+
+		spec, err := c.netInSpec(protocol, in.HostPort, in.ContainerPort, in.Count)
 		if err != nil {
 			cLog.Error("failed-to-reenforce-port-mapping", err)
 			return err
 		}
+
+		netIns = append(netIns, spec)
+	}
+
+	err = c.runNetIn(netIns...)
+	if err != nil {
+		cLog.Error("failed-to-reenforce-port-mappings", err)
+		return err
 	}
 
+	c.netInsMutex.Lock()
+	c.netIns = append(c.netIns, netIns...)
+	c.netInsMutex.Unlock()
+
+	netOuts := []NetOutRule{}
 	for _, out := range snapshot.NetOuts {
-		err = c.NetOut(out.Network, out.Port)
+		rule, err := NetOutRuleFromLegacy(out.Network, out.Port)
 		if err != nil {
 			cLog.Error("failed-to-reenforce-allowed-traffic", err)
 			return err
 		}
+
+		netOuts = append(netOuts, rule)
+	}
+
+	err = c.BulkNetOut(append(netOuts, snapshot.NetOutRules...))
+	if err != nil {
+		cLog.Error("failed-to-reenforce-allowed-traffic", err)
+		return err
 	}
 
 	cLog.Info("restored")
@@ -327,74 +874,300 @@ func (c *LinuxContainer) Restore(snapshot ContainerSnapshot) error {
 	return nil
 }
 
-func (c *LinuxContainer) Start(mtu uint32) error {
-	cLog := c.logger.Session("start")
+// reerect starts again a container whose host rebooted since its snapshot
+// was saved. Its processes are gone, and so are its cgroups, its host-side
+// interfaces and its wshd, whose stale pid file would stop start.sh.
+func (c *LinuxContainer) reerect(logger lager.Logger, snapshot ContainerSnapshot) error {
+	logger.Info("reerecting", lager.Data{
+		"lost-processes": snapshot.Processes,
+	})
 
-	cLog.Debug("starting")
+	c.registerEvent("re-erected after a host reboot")
 
-	start := exec.Command(path.Join(c.path, "start.sh"))
-	start.Env = []string{
-		"id=" + c.id,
-		"container_iface_mtu=" + fmt.Sprintf("%d", mtu),
-		"PATH=" + os.Getenv("PATH"),
+	err := os.Remove(path.Join(c.path, "run", "wshd.pid"))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	return c.Start(c.mtu)
+}
+
+// ValidateNetwork checks that the container's host-side interfaces still
+// exist with their addresses configured, e.g. after a host reboot. Unlike
+// its rules, which Restore re-applies, a container's interfaces cannot be
+// recovered, so a container failing this is flagged with an event.
+func (c *LinuxContainer) ValidateNetwork() error {
+	if c.linkBuilder != nil {
+		return nil
 	}
 
+	cLog := c.logger.Session("validate-network")
+
 	cRunner := logging.Runner{
 		CommandRunner: c.runner,
 		Logger:        cLog,
 	}
 
-	err := cRunner.Run(start)
+	check := exec.Command(path.Join(c.path, "net.sh"), "check_links")
+
+	err := cRunner.Run(check)
 	if err != nil {
-		cLog.Error("failed-to-start", err)
+		cLog.Error("network-must-be-re-erected", err)
+		c.registerEvent("network must be re-erected")
 		return err
 	}
 
-	c.setState(StateActive)
-
-	cLog.Info("started")
-
 	return nil
 }
 
-func (c *LinuxContainer) Cleanup() {
-	cLog := c.logger.Session("cleanup")
-
-	cLog.Debug("stopping-oom-notifier")
-	c.stopOomNotifier()
+// Break marks the container as broken, recording why as an event so that
+// it shows in its info.
+func (c *LinuxContainer) Break(reason string) {
+	c.logger.Info("broken", lager.Data{"reason": reason})
 
-	cLog.Info("done")
+	c.setState(StateBroken)
+	c.registerEvent(reason)
 }
 
-func (c *LinuxContainer) Stop(kill bool) error {
-	stop := exec.Command(path.Join(c.path, "stop.sh"))
+// MarkDestroying stops the container's network rules from being changed or
+// reinstalled, once any change in progress is done, so that they can be
+// torn down.
+func (c *LinuxContainer) MarkDestroying() {
+	c.networkMutex.Lock()
+	defer c.networkMutex.Unlock()
 
-	if kill {
-		stop.Args = append(stop.Args, "-w", "0")
+	c.destroying = true
+}
+
+// CheckDaemon returns a DeadDaemonError if the container's wshd has died,
+// leaving nothing able to run in it. Broken containers are not checked.
+func (c *LinuxContainer) CheckDaemon() error {
+	if c.State() == StateBroken {
+		return nil
 	}
 
-	err := c.runner.Run(stop)
+	pid, err := c.wshdPID()
 	if err != nil {
 		return err
 	}
 
-	c.stopOomNotifier()
-
-	c.setState(StateStopped)
+	// signal 0 only checks that the process exists
+	err = syscall.Kill(pid, 0)
+	if err == syscall.ESRCH {
+		return DeadDaemonError{c.handle, pid}
+	}
 
 	return nil
 }
 
-func (c *LinuxContainer) Info() (api.ContainerInfo, error) {
-	cLog := c.logger.Session("info")
+func (c *LinuxContainer) Start(mtu uint32) error {
+	cLog := c.logger.Session("start")
 
-	memoryStat, err := c.cgroupsManager.Get("memory", "memory.stat")
+	cLog.Debug("starting")
+
+	err := c.writeEnv()
 	if err != nil {
-		return api.ContainerInfo{}, err
+		cLog.Error("failed-to-write-env", err)
+		return err
 	}
 
-	cpuUsage, err := c.cgroupsManager.Get("cpuacct", "cpuacct.usage")
-	if err != nil {
+	cRunner := logging.Runner{
+		CommandRunner: c.runner,
+		Logger:        cLog,
+	}
+
+	// set up separately from start.sh, so that only the network rules wait
+	// their turn to change iptables
+	net := exec.Command(path.Join(c.path, "net.sh"), "setup")
+
+	err = cRunner.Run(net)
+	if err != nil {
+		cLog.Error("failed-to-set-up-network-rules", err)
+		return err
+	}
+
+	start := exec.Command(path.Join(c.path, "start.sh"))
+	start.Env = []string{
+		"id=" + c.id,
+		"container_iface_mtu=" + fmt.Sprintf("%d", mtu),
+		"PATH=" + os.Getenv("PATH"),
+	}
+
+	err = cRunner.Run(start)
+	if err != nil {
+		cLog.Error("failed-to-start", err)
+		return err
+	}
+
+	if c.linkBuilder != nil {
+		err = c.buildLinks(cLog.Session("build-links"))
+		if err != nil {
+			cLog.Error("failed-to-build-links", err)
+			return err
+		}
+	}
+
+	c.mtu = mtu
+
+	hugePageLimits, err := c.requestedHugePageLimits()
+	if err != nil {
+		cLog.Error("invalid-huge-pages-request", err)
+		return err
+	}
+
+	if len(hugePageLimits) > 0 {
+		err = c.LimitHugePages(hugePageLimits)
+		if err != nil {
+			cLog.Error("failed-to-limit-huge-pages", err)
+			return err
+		}
+	}
+
+	c.setState(StateActive)
+
+	cLog.Info("started")
+
+	return nil
+}
+
+// VerifyStart checks that a started container is usable: that its wshd
+// accepts connections, and that it answers the host over its network.
+func (c *LinuxContainer) VerifyStart() error {
+	cLog := c.logger.Session("verify-start")
+
+	conn, err := net.DialTimeout("unix", path.Join(c.path, "run", "wshd.sock"), time.Second)
+	if err != nil {
+		cLog.Error("wshd-unresponsive", err)
+		return StartVerificationError{c.handle, "wshd", err}
+	}
+
+	conn.Close()
+
+	if c.linkBuilder != nil {
+		return nil
+	}
+
+	cRunner := logging.Runner{
+		CommandRunner: c.runner,
+		Logger:        cLog,
+	}
+
+	err = cRunner.Run(exec.Command(path.Join(c.path, "net.sh"), "check_gateway"))
+	if err != nil {
+		cLog.Error("gateway-unreachable", err)
+		return StartVerificationError{c.handle, "gateway", err}
+	}
+
+	return nil
+}
+
+func (c *LinuxContainer) Cleanup() {
+	cLog := c.logger.Session("cleanup")
+
+	cLog.Debug("stopping-oom-notifier")
+	c.stopOomNotifier()
+
+	cLog.Debug("stopping-capture")
+	c.stopCapture()
+
+	cLog.Info("done")
+}
+
+func (c *LinuxContainer) Stop(kill bool) error {
+	if !kill {
+		c.runShutdownHook()
+	}
+
+	stop := exec.Command(path.Join(c.path, "stop.sh"))
+
+	if kill {
+		stop.Args = append(stop.Args, "-w", "0")
+	}
+
+	err := c.runner.Run(stop)
+	if err != nil {
+		return err
+	}
+
+	c.stopOomNotifier()
+	c.stopCapture()
+
+	c.setState(StateStopped)
+
+	return nil
+}
+
+// runShutdownHook gives the container's shutdown hook, if it has one, the
+// chance to flush state. Its failing or timing out does not keep the
+// container from stopping.
+func (c *LinuxContainer) runShutdownHook() {
+	command := c.properties[ShutdownHookProperty]
+	if command == "" {
+		return
+	}
+
+	cLog := c.logger.Session("shutdown-hook", lager.Data{
+		"command": command,
+	})
+
+	timeout := DefaultShutdownHookTimeout
+	if value, found := c.properties[ShutdownHookTimeoutProperty]; found {
+		parsed, err := time.ParseDuration(value)
+		if err != nil {
+			cLog.Error("malformed-timeout", err)
+		} else {
+			timeout = parsed
+		}
+	}
+
+	hook := exec.Command(
+		path.Join(c.path, "bin", "wsh"),
+		"--socket", path.Join(c.path, "run", "wshd.sock"),
+		"--user", "vcap",
+		"/bin/sh", "-c", command,
+	)
+
+	err := c.runWithTimeout(hook, timeout)
+	if err != nil {
+		cLog.Error("failed", err)
+		return
+	}
+
+	cLog.Info("finished")
+}
+
+// runWithTimeout runs cmd, killing it if it takes longer than timeout.
+func (c *LinuxContainer) runWithTimeout(cmd *exec.Cmd, timeout time.Duration) error {
+	err := c.runner.Start(cmd)
+	if err != nil {
+		return err
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- c.runner.Wait(cmd)
+	}()
+
+	select {
+	case err := <-done:
+		return err
+
+	case <-time.After(timeout):
+		c.runner.Kill(cmd)
+		return CommandTimedOutError{cmd.Path, timeout}
+	}
+}
+
+func (c *LinuxContainer) Info() (api.ContainerInfo, error) {
+	cLog := c.logger.Session("info")
+
+	memoryStat, err := c.cgroupsManager.Get("memory", "memory.stat")
+	if err != nil {
+		return api.ContainerInfo{}, err
+	}
+
+	cpuUsage, err := c.cgroupsManager.Get("cpuacct", "cpuacct.usage")
+	if err != nil {
 		return api.ContainerInfo{}, err
 	}
 
@@ -403,7 +1176,7 @@ func (c *LinuxContainer) Info() (api.ContainerInfo, error) {
 		return api.ContainerInfo{}, err
 	}
 
-	diskStat, err := c.quotaManager.GetUsage(cLog, c.resources.UID)
+	diskStat, err := c.diskUsage(cLog)
 	if err != nil {
 		return api.ContainerInfo{}, err
 	}
@@ -413,15 +1186,22 @@ func (c *LinuxContainer) Info() (api.ContainerInfo, error) {
 		return api.ContainerInfo{}, err
 	}
 
+	hugePageProperties, err := c.hugePageProperties()
+	if err != nil {
+		return api.ContainerInfo{}, err
+	}
+
+	properties := c.infoProperties()
+	for key, value := range hugePageProperties {
+		properties[key] = value
+	}
+
 	mappedPorts := []api.PortMapping{}
 
 	c.netInsMutex.RLock()
 
 	for _, spec := range c.netIns {
-		mappedPorts = append(mappedPorts, api.PortMapping{
-			HostPort:      spec.HostPort,
-			ContainerPort: spec.ContainerPort,
-		})
+		mappedPorts = append(mappedPorts, spec.ports()...)
 	}
 
 	c.netInsMutex.RUnlock()
@@ -434,7 +1214,7 @@ func (c *LinuxContainer) Info() (api.ContainerInfo, error) {
 	return api.ContainerInfo{
 		State:         string(c.State()),
 		Events:        c.Events(),
-		Properties:    c.Properties(),
+		Properties:    properties,
 		HostIP:        c.resources.Network.HostIP().String(),
 		ContainerIP:   c.resources.Network.ContainerIP().String(),
 		ContainerPath: c.path,
@@ -469,298 +1249,857 @@ func (c *LinuxContainer) StreamIn(dstPath string, tarStream io.Reader) error {
 		dstPath,
 	)
 
-	tar.Stdin = tarStream
+	tar.Stdin = tarStream
+
+	cLog := c.logger.Session("stream-in")
+
+	cRunner := logging.Runner{
+		CommandRunner: c.runner,
+		Logger:        cLog,
+	}
+
+	// even a failed stream may have written some files
+	defer c.quotaManager.InvalidateUsage(c.resources.UID)
+
+	return cRunner.Run(tar)
+}
+
+func (c *LinuxContainer) StreamOut(srcPath string) (io.ReadCloser, error) {
+	workingDir := filepath.Dir(srcPath)
+	compressArg := filepath.Base(srcPath)
+	if strings.HasSuffix(srcPath, "/") {
+		workingDir = srcPath
+		compressArg = "."
+	}
+
+	nsTarPath := path.Join(c.path, "bin", "nstar")
+	pidPath := path.Join(c.path, "run", "wshd.pid")
+
+	pidFile, err := os.Open(pidPath)
+	if err != nil {
+		return nil, err
+	}
+
+	var pid int
+	_, err = fmt.Fscanf(pidFile, "%d", &pid)
+	if err != nil {
+		return nil, err
+	}
+
+	tar := exec.Command(
+		nsTarPath,
+		strconv.Itoa(pid),
+		"vcap",
+		workingDir,
+		compressArg,
+	)
+
+	tarRead, tarWrite, err := os.Pipe()
+	if err != nil {
+		return nil, err
+	}
+
+	tar.Stdout = tarWrite
+
+	err = c.runner.Background(tar)
+	if err != nil {
+		return nil, err
+	}
+
+	// close our end of the tar pipe
+	tarWrite.Close()
+
+	go c.runner.Wait(tar)
+
+	return tarRead, nil
+}
+
+func (c *LinuxContainer) LimitBandwidth(limits api.BandwidthLimits) error {
+	cLog := c.logger.Session("limit-bandwidth")
+
+	err := c.bandwidthManager.SetLimits(cLog, limits)
+	if err != nil {
+		return err
+	}
+
+	c.bandwidthMutex.Lock()
+	defer c.bandwidthMutex.Unlock()
+
+	c.currentBandwidthLimits = &limits
+
+	return nil
+}
+
+func (c *LinuxContainer) CurrentBandwidthLimits() (api.BandwidthLimits, error) {
+	c.bandwidthMutex.RLock()
+	defer c.bandwidthMutex.RUnlock()
+
+	if c.currentBandwidthLimits == nil {
+		return api.BandwidthLimits{}, nil
+	}
+
+	return *c.currentBandwidthLimits, nil
+}
+
+func (c *LinuxContainer) LimitDisk(limits api.DiskLimits) error {
+	cLog := c.logger.Session("limit-disk")
+
+	committed := c.CommittedResources()
+	committed.DiskInBytes = committedDisk(limits)
+
+	release, err := c.admitLimits(committed)
+	if err != nil {
+		return err
+	}
+
+	defer release()
+
+	if c.volumeManager != nil {
+		err = c.resizeVolume(cLog, limits)
+	} else {
+		err = c.quotaManager.SetLimits(cLog, c.resources.UID, limits)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	c.diskMutex.Lock()
+	defer c.diskMutex.Unlock()
+
+	c.currentDiskLimits = &limits
+
+	return nil
+}
+
+// resizeVolume makes the container's volume the size of its hard limit.
+// Volumes have no soft or inode limits.
+func (c *LinuxContainer) resizeVolume(logger lager.Logger, limits api.DiskLimits) error {
+	size := committedDisk(limits)
+	if size == 0 {
+		return nil
+	}
+
+	return c.volumeManager.Resize(logger, c.id, size)
+}
+
+func (c *LinuxContainer) CurrentDiskLimits() (api.DiskLimits, error) {
+	cLog := c.logger.Session("current-disk-limits")
+
+	if c.volumeManager != nil {
+		c.diskMutex.RLock()
+		defer c.diskMutex.RUnlock()
+
+		if c.currentDiskLimits == nil {
+			return api.DiskLimits{}, nil
+		}
+
+		return *c.currentDiskLimits, nil
+	}
+
+	return c.quotaManager.GetLimits(cLog, c.resources.UID)
+}
+
+func (c *LinuxContainer) diskUsage(logger lager.Logger) (api.ContainerDiskStat, error) {
+	if c.volumeManager != nil {
+		return c.volumeManager.Usage(logger, c.id)
+	}
+
+	return c.quotaManager.GetUsage(logger, c.resources.UID)
+}
+
+func (c *LinuxContainer) LimitMemory(limits api.MemoryLimits) error {
+	committed := c.CommittedResources()
+	committed.MemoryInBytes = limits.LimitInBytes
+
+	release, err := c.admitLimits(committed)
+	if err != nil {
+		return err
+	}
+
+	defer release()
+
+	err = c.startOomNotifier()
+	if err != nil {
+		return err
+	}
+
+	limit := fmt.Sprintf("%d", limits.LimitInBytes)
+
+	// memory.memsw.limit_in_bytes must be >= memory.limit_in_bytes
+	//
+	// however, it must be set after memory.limit_in_bytes, and if we're
+	// increasing the limit, writing memory.limit_in_bytes first will fail.
+	//
+	// so, write memory.limit_in_bytes before and after
+	//
+	// without swap accounting there is no memory.memsw.limit_in_bytes, and
+	// the container may swap beyond its limit; this is reported rather than
+	// failed, as the host can do no better
+	_, err = c.cgroupsManager.Get("memory", "memory.memsw.limit_in_bytes")
+	swapLimited := !os.IsNotExist(err)
+
+	c.cgroupsManager.Set("memory", "memory.limit_in_bytes", limit)
+
+	var swapErr error
+	if swapLimited {
+		swapErr = c.cgroupsManager.Set("memory", "memory.memsw.limit_in_bytes", limit)
+	}
+
+	err = c.cgroupsManager.Set("memory", "memory.limit_in_bytes", limit)
+	if err != nil {
+		return err
+	}
+
+	if swapErr != nil {
+		return swapErr
+	}
+
+	if !swapLimited {
+		c.logger.Info("swap-not-limited", lager.Data{"limit": limits.LimitInBytes})
+	}
+
+	c.memoryMutex.Lock()
+	defer c.memoryMutex.Unlock()
+
+	c.currentMemoryLimits = &limits
+	c.swapLimited = swapLimited
+
+	return nil
+}
+
+func (c *LinuxContainer) CurrentMemoryLimits() (api.MemoryLimits, error) {
+	limitInBytes, err := c.cgroupsManager.Get("memory", "memory.limit_in_bytes")
+	if err != nil {
+		return api.MemoryLimits{}, err
+	}
+
+	numericLimit, err := strconv.ParseUint(limitInBytes, 10, 0)
+	if err != nil {
+		return api.MemoryLimits{}, err
+	}
+
+	return api.MemoryLimits{uint64(numericLimit)}, nil
+}
+
+func (c *LinuxContainer) CommittedResources() CommittedResources {
+	committed := CommittedResources{}
+
+	c.memoryMutex.RLock()
+
+	if c.currentMemoryLimits != nil {
+		committed.MemoryInBytes = c.currentMemoryLimits.LimitInBytes
+	}
+
+	c.memoryMutex.RUnlock()
+
+	c.diskMutex.RLock()
+
+	if c.currentDiskLimits != nil {
+		committed.DiskInBytes = committedDisk(*c.currentDiskLimits)
+	}
+
+	c.diskMutex.RUnlock()
+
+	return committed
+}
+
+// committedDisk is the disk, in bytes, that limits let a container use.
+func committedDisk(limits api.DiskLimits) uint64 {
+	if limits.ByteHard != 0 {
+		return limits.ByteHard
+	}
+
+	return limits.BlockHard * quota_manager.QUOTA_BLOCK_SIZE
+}
+
+func (c *LinuxContainer) SetLimitAdmitter(admitter LimitAdmitter) {
+	c.limitAdmitterMutex.Lock()
+	defer c.limitAdmitterMutex.Unlock()
+
+	c.limitAdmitter = admitter
+}
+
+func (c *LinuxContainer) SetPortReservations(reservations PortReservations) {
+	c.portReservationsMutex.Lock()
+	defer c.portReservationsMutex.Unlock()
+
+	c.portReservations = reservations
+}
+
+// claimReservedPort takes over the port's reservation, if it has one.
+func (c *LinuxContainer) claimReservedPort(port uint32) bool {
+	c.portReservationsMutex.RLock()
+	reservations := c.portReservations
+	c.portReservationsMutex.RUnlock()
+
+	if reservations == nil {
+		return false
+	}
+
+	return reservations.ClaimReservedPort(port)
+}
+
+// admitLimits has the container's limit admitter, if it has one, admit its
+// committing to the given resources.
+func (c *LinuxContainer) admitLimits(committed CommittedResources) (func(), error) {
+	c.limitAdmitterMutex.RLock()
+	admitter := c.limitAdmitter
+	c.limitAdmitterMutex.RUnlock()
+
+	if admitter == nil {
+		return func() {}, nil
+	}
+
+	return admitter.AdmitLimits(c, committed)
+}
+
+func (c *LinuxContainer) LimitCPU(limits api.CPULimits) error {
+	limit := fmt.Sprintf("%d", limits.LimitInShares)
+
+	err := c.cgroupsManager.Set("cpu", "cpu.shares", limit)
+	if err != nil {
+		return err
+	}
+
+	c.cpuMutex.Lock()
+	defer c.cpuMutex.Unlock()
+
+	c.currentCPULimits = &limits
+
+	return nil
+}
+
+func (c *LinuxContainer) CurrentCPULimits() (api.CPULimits, error) {
+	actualLimitInShares, err := c.cgroupsManager.Get("cpu", "cpu.shares")
+	if err != nil {
+		return api.CPULimits{}, err
+	}
+
+	numericLimit, err := strconv.ParseUint(actualLimitInShares, 10, 0)
+	if err != nil {
+		return api.CPULimits{}, err
+	}
+
+	return api.CPULimits{uint64(numericLimit)}, nil
+}
+
+// Run runs a process in the container, as RunWithRestart if it asks to be
+// restarted in its environment or RunInNamespacesOf if it asks to join
+// another process, and probes its liveness if it asks to be; see
+// RestartPolicyEnv, JoinProcessEnv and LivenessCommandEnv.
+func (c *LinuxContainer) Run(spec api.ProcessSpec, processIO api.ProcessIO) (api.Process, error) {
+	options, spec, err := processOptionsFrom(spec)
+	if err != nil {
+		return nil, err
+	}
+
+	var process api.Process
+
+	if options.restart != nil {
+		process, err = c.RunWithRestart(spec, processIO, *options.restart)
+	} else if options.joinProcess != nil {
+		process, err = c.RunInNamespacesOf(*options.joinProcess, spec, processIO)
+	} else {
+		var wsh *exec.Cmd
+
+		wsh, err = c.wshCommand(spec)
+		if err != nil {
+			return nil, err
+		}
+
+		process, err = c.processTracker.Run(wsh, processIO, spec.TTY)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if options.liveness != nil {
+		c.probe(process, *options.liveness)
+	}
+
+	return process, nil
+}
+
+// RunWithRestart is Run for a process that is respawned according to
+// policy when it exits, registering an event for each restart. Processes
+// are not restarted once the container has stopped or broken.
+func (c *LinuxContainer) RunWithRestart(spec api.ProcessSpec, processIO api.ProcessIO, policy process_tracker.RestartPolicy) (api.Process, error) {
+	wsh, err := c.wshCommand(spec)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.processTracker.RunWithRestart(wsh, processIO, spec.TTY, policy, c.restartingProcess)
+}
+
+// RunInNamespacesOf is Run for a process that joins the namespaces of
+// another of the container's processes instead of wshd's, so that, e.g., a
+// debugger sees exactly what that process sees.
+func (c *LinuxContainer) RunInNamespacesOf(processID uint32, spec api.ProcessSpec, processIO api.ProcessIO) (api.Process, error) {
+	pid, err := c.processTracker.ContainerPID(processID)
+	if err != nil {
+		return nil, err
+	}
+
+	wsh, err := c.wshCommand(spec, "--ns-pid", strconv.Itoa(pid))
+	if err != nil {
+		return nil, err
+	}
+
+	return c.processTracker.Run(wsh, processIO, spec.TTY)
+}
+
+func (c *LinuxContainer) restartingProcess(processID uint32, restarts int) bool {
+	switch c.State() {
+	case StateStopped, StateBroken:
+		return false
+	}
+
+	c.logger.Info("restarting-process", lager.Data{
+		"process":  processID,
+		"restarts": restarts,
+	})
+
+	c.registerEvent(fmt.Sprintf("process %d restarted (restart count %d)", processID, restarts))
+
+	return true
+}
+
+func (c *LinuxContainer) wshCommand(spec api.ProcessSpec, wshArgs ...string) (*exec.Cmd, error) {
+	if c.State() == StateBroken {
+		return nil, BrokenContainerError{c.handle}
+	}
+
+	wshPath := path.Join(c.path, "bin", "wsh")
+	sockPath := path.Join(c.path, "run", "wshd.sock")
+
+	user := "vcap"
+	if spec.Privileged {
+		user = "root"
+	}
+
+	args := append([]string{"--socket", sockPath, "--user", user}, wshArgs...)
+
+	processEnv := [][]string{c.envvars}
+
+	if isShellSpec(spec) {
+		err := validateShellSpec(spec)
+		if err != nil {
+			return nil, err
+		}
+
+		processEnv = append(processEnv, []string{"TERM=" + DefaultShellTerm})
+	}
+
+	envVars, err := env.Merge(append(processEnv, spec.Env)...)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, envVar := range envVars {
+		args = append(args, "--env", envVar)
+	}
+
+	if spec.Dir != "" {
+		args = append(args, "--dir", spec.Dir)
+	}
+
+	// with no command, wshd runs the user's login shell
+	if !isShellSpec(spec) {
+		args = append(args, spec.Path)
+		args = append(args, spec.Args...)
+	}
+
+	wsh := exec.Command(wshPath, args...)
+
+	setRLimitsEnv(wsh, withDefaultRLimits(spec.Limits, c.defaultRLimits))
+
+	return wsh, nil
+}
 
-	cLog := c.logger.Session("stream-in")
+func (c *LinuxContainer) Attach(processID uint32, processIO api.ProcessIO) (api.Process, error) {
+	return c.processTracker.Attach(processID, processIO)
+}
 
-	cRunner := logging.Runner{
-		CommandRunner: c.runner,
-		Logger:        cLog,
+func (c *LinuxContainer) NetIn(hostPort uint32, containerPort uint32) (uint32, uint32, error) {
+	return c.NetInProtocol(ProtocolTCP, hostPort, containerPort)
+}
+
+// NetInProtocol is NetIn for a given protocol, tcp or udp.
+func (c *LinuxContainer) NetInProtocol(protocol Protocol, hostPort uint32, containerPort uint32) (uint32, uint32, error) {
+	spec, err := c.netIn(protocol, hostPort, containerPort, 1)
+	if err != nil {
+		return 0, 0, err
 	}
 
-	return cRunner.Run(tar)
+	return spec.HostPort, spec.ContainerPort, nil
 }
 
-func (c *LinuxContainer) StreamOut(srcPath string) (io.ReadCloser, error) {
-	workingDir := filepath.Dir(srcPath)
-	compressArg := filepath.Base(srcPath)
-	if strings.HasSuffix(srcPath, "/") {
-		workingDir = srcPath
-		compressArg = "."
+// NetInRange maps count contiguous host ports from hostPortStart, or a block
+// acquired from the pool if it is 0, with a single DNAT rule rather than a
+// rule per port. A DNAT rule can only map a range to the same ports, so
+// containerPortStart must be 0 or hostPortStart.
+func (c *LinuxContainer) NetInRange(protocol Protocol, hostPortStart uint32, containerPortStart uint32, count uint32) (NetInSpec, error) {
+	return c.netIn(protocol, hostPortStart, containerPortStart, count)
+}
+
+func (c *LinuxContainer) netIn(protocol Protocol, hostPort uint32, containerPort uint32, count uint32) (NetInSpec, error) {
+	if c.linkBuilder != nil {
+		return NetInSpec{}, LinksNotOwnedError{"net in"}
 	}
 
-	nsTarPath := path.Join(c.path, "bin", "nstar")
-	pidPath := path.Join(c.path, "run", "wshd.pid")
+	c.networkMutex.Lock()
+	defer c.networkMutex.Unlock()
 
-	pidFile, err := os.Open(pidPath)
-	if err != nil {
-		return nil, err
+	if c.destroying {
+		return NetInSpec{}, DestroyingContainerError{c.handle}
 	}
 
-	var pid int
-	_, err = fmt.Fscanf(pidFile, "%d", &pid)
+	spec, err := c.netInSpec(protocol, hostPort, containerPort, count)
 	if err != nil {
-		return nil, err
+		return NetInSpec{}, err
 	}
 
-	tar := exec.Command(
-		nsTarPath,
-		strconv.Itoa(pid),
-		"vcap",
-		workingDir,
-		compressArg,
-	)
-
-	tarRead, tarWrite, err := os.Pipe()
+	err = c.runNetIn(spec)
 	if err != nil {
-		return nil, err
+		return NetInSpec{}, err
 	}
 
-	tar.Stdout = tarWrite
+	c.netInsMutex.Lock()
+	defer c.netInsMutex.Unlock()
 
-	err = c.runner.Background(tar)
-	if err != nil {
-		return nil, err
+	c.netIns = append(c.netIns, spec)
+
+	return spec, nil
+}
+
+// netInSpec acquires host ports for the mapping if none are given, and
+// takes reserved ones for the container.
+func (c *LinuxContainer) netInSpec(protocol Protocol, hostPort uint32, containerPort uint32, count uint32) (NetInSpec, error) {
+	if protocol != ProtocolTCP && protocol != ProtocolUDP {
+		return NetInSpec{}, UnsupportedNetInProtocolError{protocol}
 	}
 
-	// close our end of the tar pipe
-	tarWrite.Close()
+	if count <= 1 {
+		hostPort, err := c.netInPort(hostPort)
+		if err != nil {
+			return NetInSpec{}, err
+		}
 
-	go c.runner.Wait(tar)
+		if containerPort == 0 {
+			containerPort = hostPort
+		}
 
-	return tarRead, nil
-}
+		return NetInSpec{
+			HostPort:      hostPort,
+			ContainerPort: containerPort,
+			Protocol:      protocol,
+		}, nil
+	}
 
-func (c *LinuxContainer) LimitBandwidth(limits api.BandwidthLimits) error {
-	cLog := c.logger.Session("limit-bandwidth")
+	if containerPort != 0 && containerPort != hostPort {
+		return NetInSpec{}, InvalidNetInRangeError{"container ports must be the same as the host ports"}
+	}
 
-	err := c.bandwidthManager.SetLimits(cLog, limits)
-	if err != nil {
-		return err
+	if count > MaxPort || hostPort+count-1 > MaxPort {
+		return NetInSpec{}, InvalidNetInRangeError{fmt.Sprintf("%d ports from %d exceed %d", count, hostPort, MaxPort)}
 	}
 
-	c.bandwidthMutex.Lock()
-	defer c.bandwidthMutex.Unlock()
+	if hostPort == 0 {
+		first, err := c.portPool.AcquireRange(count)
+		if err != nil {
+			return NetInSpec{}, err
+		}
 
-	c.currentBandwidthLimits = &limits
+		for port := first; port < first+count; port++ {
+			c.resources.AddPort(port)
+		}
 
-	return nil
+		hostPort = first
+	} else {
+		for port := hostPort; port < hostPort+count; port++ {
+			if c.claimReservedPort(port) {
+				c.resources.AddPort(port)
+			}
+		}
+	}
+
+	return NetInSpec{
+		HostPort:      hostPort,
+		ContainerPort: hostPort,
+		Protocol:      protocol,
+		Count:         count,
+	}, nil
 }
 
-func (c *LinuxContainer) CurrentBandwidthLimits() (api.BandwidthLimits, error) {
-	c.bandwidthMutex.RLock()
-	defer c.bandwidthMutex.RUnlock()
+// netInPort acquires a host port if none is given, or takes the given one
+// if it is reserved, for the container.
+func (c *LinuxContainer) netInPort(hostPort uint32) (uint32, error) {
+	if hostPort == 0 {
+		randomPort, err := c.portPool.Acquire()
+		if err != nil {
+			return 0, err
+		}
 
-	if c.currentBandwidthLimits == nil {
-		return api.BandwidthLimits{}, nil
+		c.resources.AddPort(randomPort)
+
+		return randomPort, nil
 	}
 
-	return *c.currentBandwidthLimits, nil
-}
+	if c.claimReservedPort(hostPort) {
+		// now the container's, to be released when it is destroyed
+		c.resources.AddPort(hostPort)
+	}
 
-func (c *LinuxContainer) LimitDisk(limits api.DiskLimits) error {
-	cLog := c.logger.Session("limit-disk")
+	return hostPort, nil
+}
 
-	err := c.quotaManager.SetLimits(cLog, c.resources.UID, limits)
+func (c *LinuxContainer) NetOut(network string, port uint32) error {
+	rule, err := NetOutRuleFromLegacy(network, port)
 	if err != nil {
 		return err
 	}
 
-	c.diskMutex.Lock()
-	defer c.diskMutex.Unlock()
-
-	c.currentDiskLimits = &limits
-
-	return nil
+	return c.AddNetOutRule(rule)
 }
 
-func (c *LinuxContainer) CurrentDiskLimits() (api.DiskLimits, error) {
-	cLog := c.logger.Session("current-disk-limits")
-	return c.quotaManager.GetLimits(cLog, c.resources.UID)
-}
+func (c *LinuxContainer) AddNetOutRule(rule NetOutRule) error {
+	if c.linkBuilder != nil {
+		return LinksNotOwnedError{"net out"}
+	}
 
-func (c *LinuxContainer) LimitMemory(limits api.MemoryLimits) error {
-	err := c.startOomNotifier()
+	err := rule.Validate()
 	if err != nil {
 		return err
 	}
 
-	limit := fmt.Sprintf("%d", limits.LimitInBytes)
+	c.networkMutex.Lock()
+	defer c.networkMutex.Unlock()
 
-	// memory.memsw.limit_in_bytes must be >= memory.limit_in_bytes
-	//
-	// however, it must be set after memory.limit_in_bytes, and if we're
-	// increasing the limit, writing memory.limit_in_bytes first will fail.
-	//
-	// so, write memory.limit_in_bytes before and after
-	c.cgroupsManager.Set("memory", "memory.limit_in_bytes", limit)
-	c.cgroupsManager.Set("memory", "memory.memsw.limit_in_bytes", limit)
+	if c.destroying {
+		return DestroyingContainerError{c.handle}
+	}
 
-	err = c.cgroupsManager.Set("memory", "memory.limit_in_bytes", limit)
+	err = c.iptablesManager.NetOut(c.logger, rule.entries()...)
 	if err != nil {
 		return err
 	}
 
-	c.memoryMutex.Lock()
-	defer c.memoryMutex.Unlock()
+	c.netOutsMutex.Lock()
+	defer c.netOutsMutex.Unlock()
 
-	c.currentMemoryLimits = &limits
+	c.netOuts = append(c.netOuts, rule)
 
 	return nil
 }
 
-func (c *LinuxContainer) CurrentMemoryLimits() (api.MemoryLimits, error) {
-	limitInBytes, err := c.cgroupsManager.Get("memory", "memory.limit_in_bytes")
-	if err != nil {
-		return api.MemoryLimits{}, err
+// BulkNetOut applies a set of rules atomically: either all of them are
+// applied, via a single iptables-restore, or none are.
+func (c *LinuxContainer) BulkNetOut(rules []NetOutRule) error {
+	cLog := c.logger.Session("bulk-net-out")
+
+	if c.linkBuilder != nil {
+		return LinksNotOwnedError{"net out"}
 	}
 
-	numericLimit, err := strconv.ParseUint(limitInBytes, 10, 0)
-	if err != nil {
-		return api.MemoryLimits{}, err
+	for _, rule := range rules {
+		err := rule.Validate()
+		if err != nil {
+			return err
+		}
 	}
 
-	return api.MemoryLimits{uint64(numericLimit)}, nil
-}
+	c.networkMutex.Lock()
+	defer c.networkMutex.Unlock()
 
-func (c *LinuxContainer) LimitCPU(limits api.CPULimits) error {
-	limit := fmt.Sprintf("%d", limits.LimitInShares)
+	if c.destroying {
+		return DestroyingContainerError{c.handle}
+	}
 
-	err := c.cgroupsManager.Set("cpu", "cpu.shares", limit)
+	err := c.iptablesManager.NetOut(cLog, netOutEntries(rules)...)
 	if err != nil {
+		cLog.Error("failed-to-apply-rules", err, lager.Data{
+			"rules": len(rules),
+		})
 		return err
 	}
 
-	c.cpuMutex.Lock()
-	defer c.cpuMutex.Unlock()
+	c.netOutsMutex.Lock()
+	defer c.netOutsMutex.Unlock()
 
-	c.currentCPULimits = &limits
+	c.netOuts = append(c.netOuts, rules...)
 
 	return nil
 }
 
-func (c *LinuxContainer) CurrentCPULimits() (api.CPULimits, error) {
-	actualLimitInShares, err := c.cgroupsManager.Get("cpu", "cpu.shares")
-	if err != nil {
-		return api.CPULimits{}, err
-	}
+// ReconcileNetwork verifies that the container's iptables chains and rules
+// are still in place, and if they are not (e.g. because a host firewall
+// manager flushed them) re-installs them and registers an event. Broken
+// containers, and those being destroyed, are left alone.
+func (c *LinuxContainer) ReconcileNetwork() error {
+	c.networkMutex.Lock()
+	defer c.networkMutex.Unlock()
 
-	numericLimit, err := strconv.ParseUint(actualLimitInShares, 10, 0)
-	if err != nil {
-		return api.CPULimits{}, err
+	if c.destroying || c.State() == StateBroken {
+		return nil
 	}
 
-	return api.CPULimits{uint64(numericLimit)}, nil
-}
+	cLog := c.logger.Session("reconcile-network")
 
-func (c *LinuxContainer) Run(spec api.ProcessSpec, processIO api.ProcessIO) (api.Process, error) {
-	wshPath := path.Join(c.path, "bin", "wsh")
-	sockPath := path.Join(c.path, "run", "wshd.sock")
+	c.netInsMutex.RLock()
+	netIns := make([]NetInSpec, len(c.netIns))
+	copy(netIns, c.netIns)
+	c.netInsMutex.RUnlock()
 
-	user := "vcap"
-	if spec.Privileged {
-		user = "root"
+	c.netOutsMutex.RLock()
+	netOuts := make([]NetOutRule, len(c.netOuts))
+	copy(netOuts, c.netOuts)
+	c.netOutsMutex.RUnlock()
+
+	natRules := len(netIns)
+	if c.resources.ExternalIP != nil {
+		// the 1:1 DNAT
+		natRules++
+	}
+
+	// every instance chain ends with a jump to the default chain
+	filterRules := 1
+	for _, rule := range netOuts {
+		perEntry := 1
+		if rule.Log {
+			perEntry = 2
+		}
+
+		filterRules += perEntry * len(rule.entries())
 	}
 
-	args := []string{"--socket", sockPath, "--user", user}
+	check := exec.Command(path.Join(c.path, "net.sh"), "check")
+	check.Env = []string{
+		fmt.Sprintf("FILTER_RULES=%d", filterRules),
+		fmt.Sprintf("NAT_RULES=%d", natRules),
+		"PATH=" + os.Getenv("PATH"),
+	}
 
-	envVars := []string{}
-	envVars = append(append(envVars, c.envvars...), spec.Env...)
-	envVars = c.dedup(envVars)
+	err := c.runner.Run(check)
+	if err == nil {
+		return nil
+	}
 
-	for _, envVar := range envVars {
-		args = append(args, "--env", envVar)
+	cLog.Info("drift-detected", lager.Data{
+		"error": err.Error(),
+	})
+
+	c.registerEvent("network rules drifted")
+
+	cRunner := logging.Runner{
+		CommandRunner: c.runner,
+		Logger:        cLog,
 	}
 
-	if spec.Dir != "" {
-		args = append(args, "--dir", spec.Dir)
+	setup := exec.Command(path.Join(c.path, "net.sh"), "setup")
+
+	err = cRunner.Run(setup)
+	if err != nil {
+		cLog.Error("failed-to-reinstall-network-rules", err)
+		return err
 	}
 
-	args = append(args, spec.Path)
+	err = c.runNetIn(netIns...)
+	if err != nil {
+		cLog.Error("failed-to-reinstall-port-mappings", err)
+		return err
+	}
 
-	wsh := exec.Command(wshPath, append(args, spec.Args...)...)
+	err = c.iptablesManager.NetOut(cLog, netOutEntries(netOuts)...)
+	if err != nil {
+		cLog.Error("failed-to-reinstall-allowed-traffic", err)
+		return err
+	}
 
-	setRLimitsEnv(wsh, spec.Limits)
+	cLog.Info("reinstalled")
 
-	return c.processTracker.Run(wsh, processIO, spec.TTY)
+	return nil
 }
 
-func (c *LinuxContainer) Attach(processID uint32, processIO api.ProcessIO) (api.Process, error) {
-	return c.processTracker.Attach(processID, processIO)
+func (c *LinuxContainer) runNetIn(specs ...NetInSpec) error {
+	ins := []iptables_manager.NetIn{}
+	for _, spec := range specs {
+		ins = append(ins, iptables_manager.NetIn{
+			Protocol:      spec.Protocol.String(),
+			HostPort:      spec.HostPort,
+			ContainerPort: spec.ContainerPort,
+			Count:         spec.Count,
+		})
+	}
+
+	return c.iptablesManager.NetIn(c.logger, ins...)
 }
 
-func (c *LinuxContainer) NetIn(hostPort uint32, containerPort uint32) (uint32, uint32, error) {
-	if hostPort == 0 {
-		randomPort, err := c.portPool.Acquire()
-		if err != nil {
-			return 0, 0, err
-		}
+func (c *LinuxContainer) CurrentEnvVars() []string {
+	return c.envvars
+}
 
-		c.resources.AddPort(randomPort)
+// writeEnv records the container's environment in the depot, from where it
+// is installed into the rootfs for login shells and the console, so that
+// they see the same environment as processes spawned via Run.
+func (c *LinuxContainer) writeEnv() error {
+	envPath := path.Join(c.path, "etc", "env")
 
-		hostPort = randomPort
+	err := os.MkdirAll(path.Dir(envPath), 0755)
+	if err != nil {
+		return err
 	}
 
-	if containerPort == 0 {
-		containerPort = hostPort
+	err = ioutil.WriteFile(envPath, []byte(env.Exports(c.envvars)), 0600)
+	if err != nil {
+		return err
 	}
 
-	net := exec.Command(path.Join(c.path, "net.sh"), "in")
-	net.Env = []string{
-		fmt.Sprintf("HOST_PORT=%d", hostPort),
-		fmt.Sprintf("CONTAINER_PORT=%d", containerPort),
-		"PATH=" + os.Getenv("PATH"),
-	}
+	// it may hold credentials; files written before were readable by all
+	return os.Chmod(envPath, 0600)
+}
 
-	err := c.runner.Run(net)
+// networkInterfaces are the host and container interface names of the
+// container's network and then of each additional network, as setup.sh named
+// them in etc/config; none if it cannot be read, e.g. for a container that
+// has not been set up.
+func (c *LinuxContainer) networkInterfaces() [][2]string {
+	config, err := os.Open(path.Join(c.path, "etc", "config"))
 	if err != nil {
-		return 0, 0, err
+		return nil
 	}
 
-	c.netInsMutex.Lock()
-	defer c.netInsMutex.Unlock()
-
-	c.netIns = append(c.netIns, NetInSpec{hostPort, containerPort})
-
-	return hostPort, containerPort, nil
-}
-
-func (c *LinuxContainer) NetOut(network string, port uint32) error {
-	net := exec.Command(path.Join(c.path, "net.sh"), "out")
+	defer config.Close()
 
-	if port != 0 {
-		net.Env = []string{
-			"NETWORK=" + network,
-			fmt.Sprintf("PORT=%d", port),
-			"PATH=" + os.Getenv("PATH"),
-		}
-	} else {
-		if network == "" {
-			return fmt.Errorf("network and/or port must be provided")
-		}
+	values := map[string]string{}
 
-		net.Env = []string{
-			"NETWORK=" + network,
-			"PORT=",
-			"PATH=" + os.Getenv("PATH"),
+	scanner := bufio.NewScanner(config)
+	for scanner.Scan() {
+		kv := strings.SplitN(scanner.Text(), "=", 2)
+		if len(kv) == 2 {
+			values[kv[0]] = strings.Trim(kv[1], `"`)
 		}
 	}
 
-	err := c.runner.Run(net)
-	if err != nil {
-		return err
+	if values["network_host_iface"] == "" {
+		return nil
 	}
 
-	c.netOutsMutex.Lock()
-	defer c.netOutsMutex.Unlock()
+	ifaces := [][2]string{{values["network_host_iface"], values["network_container_iface"]}}
 
-	c.netOuts = append(c.netOuts, NetOutSpec{network, port})
+	// host_ip,container_ip,host_iface,container_iface
+	for _, attachment := range strings.Fields(values["network_attachments"]) {
+		fields := strings.Split(attachment, ",")
+		if len(fields) != 4 {
+			break
+		}
 
-	return nil
-}
+		ifaces = append(ifaces, [2]string{fields[2], fields[3]})
+	}
 
-func (c *LinuxContainer) CurrentEnvVars() []string {
-	return c.envvars
+	return ifaces
 }
 
 func (c *LinuxContainer) setState(state State) {
@@ -768,6 +2107,13 @@ func (c *LinuxContainer) setState(state State) {
 	defer c.stateMutex.Unlock()
 
 	c.state = state
+
+	switch state {
+	case StateActive:
+		c.stateTimes.StartedAt = time.Now()
+	case StateStopped:
+		c.stateTimes.StoppedAt = time.Now()
+	}
 }
 
 func (c *LinuxContainer) registerEvent(event string) {
@@ -933,6 +2279,24 @@ func parseCPUStat(usage, statContents string) (stat api.ContainerCPUStat) {
 	return
 }
 
+// withDefaultRLimits fills in the server's default file descriptor, process
+// and core size limits where the process's own limits leave them unset.
+func withDefaultRLimits(rlimits, defaults api.ResourceLimits) api.ResourceLimits {
+	if rlimits.Nofile == nil {
+		rlimits.Nofile = defaults.Nofile
+	}
+
+	if rlimits.Nproc == nil {
+		rlimits.Nproc = defaults.Nproc
+	}
+
+	if rlimits.Core == nil {
+		rlimits.Core = defaults.Core
+	}
+
+	return rlimits
+}
+
 func setRLimitsEnv(cmd *exec.Cmd, rlimits api.ResourceLimits) {
 	if rlimits.As != nil {
 		cmd.Env = append(cmd.Env, fmt.Sprintf("RLIMIT_AS=%d", *rlimits.As))
@@ -994,18 +2358,3 @@ func setRLimitsEnv(cmd *exec.Cmd, rlimits api.ResourceLimits) {
 		cmd.Env = append(cmd.Env, fmt.Sprintf("RLIMIT_STACK=%d", *rlimits.Stack))
 	}
 }
-
-func (c *LinuxContainer) dedup(envVars []string) []string {
-	seenArgs := map[string]string{}
-	result := []string{}
-	for i := len(envVars) - 1; i >= 0; i-- {
-		envVar := envVars[i]
-		keyValue := strings.SplitN(envVar, "=", 2)
-		_, containsKey := seenArgs[keyValue[0]]
-		if len(keyValue) == 2 && !containsKey {
-			result = append([]string{envVar}, result...)
-			seenArgs[keyValue[0]] = envVar
-		}
-	}
-	return (result)
-}
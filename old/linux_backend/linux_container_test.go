@@ -11,9 +11,11 @@ import (
 	"net"
 	"os"
 	"os/exec"
+	"path"
 	"path/filepath"
 	"strings"
 	"sync"
+	"syscall"
 	"time"
 
 	. "github.com/onsi/ginkgo"
@@ -24,10 +26,17 @@ import (
 	"github.com/cloudfoundry-incubator/garden-linux/old/linux_backend"
 	"github.com/cloudfoundry-incubator/garden-linux/old/linux_backend/bandwidth_manager/fake_bandwidth_manager"
 	"github.com/cloudfoundry-incubator/garden-linux/old/linux_backend/cgroups_manager/fake_cgroups_manager"
+	"github.com/cloudfoundry-incubator/garden-linux/old/linux_backend/env"
+	"github.com/cloudfoundry-incubator/garden-linux/old/linux_backend/fake_linux_backend"
+	"github.com/cloudfoundry-incubator/garden-linux/old/linux_backend/iptables_manager"
+	"github.com/cloudfoundry-incubator/garden-linux/old/linux_backend/iptables_manager/fake_iptables_manager"
 	"github.com/cloudfoundry-incubator/garden-linux/old/linux_backend/network_pool"
 	"github.com/cloudfoundry-incubator/garden-linux/old/linux_backend/port_pool/fake_port_pool"
+	"github.com/cloudfoundry-incubator/garden-linux/old/linux_backend/process_tracker"
 	"github.com/cloudfoundry-incubator/garden-linux/old/linux_backend/process_tracker/fake_process_tracker"
+	"github.com/cloudfoundry-incubator/garden-linux/old/linux_backend/quota_manager"
 	"github.com/cloudfoundry-incubator/garden-linux/old/linux_backend/quota_manager/fake_quota_manager"
+	"github.com/cloudfoundry-incubator/garden-linux/old/linux_backend/volume_manager/fake_volume_manager"
 	"github.com/cloudfoundry-incubator/garden/api"
 	wfakes "github.com/cloudfoundry-incubator/garden/api/fakes"
 	"github.com/cloudfoundry/gunk/command_runner/fake_command_runner"
@@ -37,6 +46,7 @@ import (
 var fakeCgroups *fake_cgroups_manager.FakeCgroupsManager
 var fakeQuotaManager *fake_quota_manager.FakeQuotaManager
 var fakeBandwidthManager *fake_bandwidth_manager.FakeBandwidthManager
+var fakeIPTablesManager *fake_iptables_manager.FakeIPTablesManager
 var fakeRunner *fake_command_runner.FakeCommandRunner
 var containerResources *linux_backend.Resources
 var container *linux_backend.LinuxContainer
@@ -52,6 +62,7 @@ var _ = Describe("Linux containers", func() {
 
 		fakeQuotaManager = fake_quota_manager.New()
 		fakeBandwidthManager = fake_bandwidth_manager.New()
+		fakeIPTablesManager = fake_iptables_manager.New()
 		fakeProcessTracker = new(fake_process_tracker.FakeProcessTracker)
 
 		_, ipNet, err := net.ParseCIDR("10.254.0.0/24")
@@ -64,6 +75,12 @@ var _ = Describe("Linux containers", func() {
 		network, err := networkPool.Acquire()
 		Ω(err).ShouldNot(HaveOccurred())
 
+		_, additionalIPNet, err := net.ParseCIDR("10.253.0.0/24")
+		Ω(err).ShouldNot(HaveOccurred())
+
+		additionalNetwork, err := network_pool.New(additionalIPNet).Acquire()
+		Ω(err).ShouldNot(HaveOccurred())
+
 		containerDir, err = ioutil.TempDir("", "depot")
 		Ω(err).ShouldNot(HaveOccurred())
 
@@ -75,9 +92,12 @@ var _ = Describe("Linux containers", func() {
 		containerResources = linux_backend.NewResources(
 			1234,
 			network,
+			nil,
 			[]uint32{},
 		)
 
+		containerResources.AdditionalNetworks = append(containerResources.AdditionalNetworks, additionalNetwork)
+
 		container = linux_backend.NewLinuxContainer(
 			lagertest.NewTestLogger("test"),
 			"some-id",
@@ -92,9 +112,22 @@ var _ = Describe("Linux containers", func() {
 			fakeRunner,
 			fakeCgroups,
 			fakeQuotaManager,
+			nil,
 			fakeBandwidthManager,
+			fakeIPTablesManager,
 			fakeProcessTracker,
 			[]string{"env1=env1Value", "env2=env2Value"},
+			linux_backend.RootFSProvenance{
+				Provider: "docker",
+				Image:    "some-repo:some-tag",
+				ImageID:  "some-image-id",
+				Layers:   []string{"some-image-id", "some-parent-id"},
+			},
+			linux_backend.Annotations{
+				CreatedAt:     time.Date(2015, time.March, 4, 5, 6, 7, 0, time.UTC),
+				GardenVersion: "some-version",
+			},
+			api.ResourceLimits{},
 		)
 	})
 
@@ -135,10 +168,10 @@ var _ = Describe("Linux containers", func() {
 			_, _, err = container.NetIn(3, 4)
 			Ω(err).ShouldNot(HaveOccurred())
 
-			err = container.NetOut("network-a", 1)
+			err = container.NetOut("10.0.0.0/24", 1)
 			Ω(err).ShouldNot(HaveOccurred())
 
-			err = container.NetOut("network-b", 2)
+			err = container.NetOut("10.1.0.1", 2)
 			Ω(err).ShouldNot(HaveOccurred())
 
 			p1 := new(wfakes.FakeProcess)
@@ -153,6 +186,20 @@ var _ = Describe("Linux containers", func() {
 			fakeProcessTracker.ActiveProcessesReturns([]api.Process{p1, p2, p3})
 		})
 
+		It("records the MTU it was started with", func() {
+			out := new(bytes.Buffer)
+
+			err := container.Snapshot(out)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			var snapshot linux_backend.ContainerSnapshot
+
+			err = json.NewDecoder(out).Decode(&snapshot)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(snapshot.MTU).Should(Equal(uint32(1500)))
+		})
+
 		It("writes a JSON ContainerSnapshot", func() {
 			out := new(bytes.Buffer)
 
@@ -170,12 +217,14 @@ var _ = Describe("Linux containers", func() {
 			Ω(snapshot.GraceTime).Should(Equal(1 * time.Second))
 
 			Ω(snapshot.State).Should(Equal("active"))
+			Ω(snapshot.StateTimes.StartedAt).Should(BeTemporally("~", container.StateTimes().StartedAt))
 
 			Ω(snapshot.Resources).Should(Equal(
 				linux_backend.ResourcesSnapshot{
-					UID:     containerResources.UID,
-					Network: containerResources.Network,
-					Ports:   containerResources.Ports,
+					UID:                containerResources.UID,
+					Network:            containerResources.Network,
+					AdditionalNetworks: containerResources.AdditionalNetworks,
+					Ports:              containerResources.Ports,
 				},
 			))
 
@@ -184,27 +233,43 @@ var _ = Describe("Linux containers", func() {
 					{
 						HostPort:      1,
 						ContainerPort: 2,
+						Protocol:      linux_backend.ProtocolTCP,
 					},
 					{
 						HostPort:      3,
 						ContainerPort: 4,
+						Protocol:      linux_backend.ProtocolTCP,
 					},
 				},
 			))
 
-			Ω(snapshot.NetOuts).Should(Equal(
-				[]linux_backend.NetOutSpec{
+			Ω(snapshot.NetOutRules).Should(Equal(
+				[]linux_backend.NetOutRule{
 					{
-						Network: "network-a",
-						Port:    1,
+						Protocol: linux_backend.ProtocolTCP,
+						Networks: []linux_backend.IPRange{
+							{
+								Start: net.ParseIP("10.0.0.0"),
+								End:   net.ParseIP("10.0.0.255"),
+							},
+						},
+						Ports: []linux_backend.PortRange{{Start: 1, End: 1}},
 					},
 					{
-						Network: "network-b",
-						Port:    2,
+						Protocol: linux_backend.ProtocolTCP,
+						Networks: []linux_backend.IPRange{
+							{
+								Start: net.ParseIP("10.1.0.1"),
+								End:   net.ParseIP("10.1.0.1"),
+							},
+						},
+						Ports: []linux_backend.PortRange{{Start: 2, End: 2}},
 					},
 				},
 			))
 
+			Ω(snapshot.NetOuts).Should(BeEmpty())
+
 			Ω(snapshot.Processes).Should(ContainElement(
 				linux_backend.ProcessSnapshot{
 					ID: 1,
@@ -228,6 +293,13 @@ var _ = Describe("Linux containers", func() {
 			})))
 
 			Ω(snapshot.EnvVars).Should(Equal([]string{"env1=env1Value", "env2=env2Value"}))
+
+			Ω(snapshot.RootFSProvenance.ImageID).Should(Equal("some-image-id"))
+
+			Ω(snapshot.Annotations).Should(Equal(linux_backend.Annotations{
+				CreatedAt:     time.Date(2015, time.March, 4, 5, 6, 7, 0, time.UTC),
+				GardenVersion: "some-version",
+			}))
 		})
 
 		Context("with limits set", func() {
@@ -274,6 +346,53 @@ var _ = Describe("Linux containers", func() {
 			})
 		})
 
+		It("redacts sensitive environment variables and properties from the logged snapshot", func() {
+			logger := lagertest.NewTestLogger("test")
+
+			container = linux_backend.NewLinuxContainer(
+				logger,
+				"some-id",
+				"some-handle",
+				containerDir,
+				map[string]string{
+					"owner":   "executor",
+					"api_key": "abc123",
+				},
+				1*time.Second,
+				containerResources,
+				fakePortPool,
+				fakeRunner,
+				fakeCgroups,
+				fakeQuotaManager,
+				nil,
+				fakeBandwidthManager,
+				fakeIPTablesManager,
+				fakeProcessTracker,
+				[]string{"PORT=8080", "DB_PASSWORD=hunter2"},
+				linux_backend.RootFSProvenance{},
+				linux_backend.Annotations{},
+				api.ResourceLimits{},
+			)
+
+			out := new(bytes.Buffer)
+
+			err := container.Snapshot(out)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(out.String()).Should(ContainSubstring("hunter2"))
+
+			logs := logger.Logs()
+			saved := logs[len(logs)-1]
+			Ω(saved.Message).Should(Equal("test.snapshot.saved"))
+
+			logged := saved.Data["snapshot"].(map[string]interface{})
+			Ω(logged["EnvVars"]).Should(Equal([]interface{}{"PORT=8080", "DB_PASSWORD=[REDACTED]"}))
+			Ω(logged["Properties"]).Should(Equal(map[string]interface{}{
+				"owner":   "executor",
+				"api_key": "[REDACTED]",
+			}))
+		})
+
 		Context("with no limits set", func() {
 			It("saves them as nil, not zero values", func() {
 				out := new(bytes.Buffer)
@@ -315,6 +434,22 @@ var _ = Describe("Linux containers", func() {
 
 		})
 
+		It("sets when the container last started and stopped", func() {
+			stateTimes := linux_backend.StateTimes{
+				StartedAt: time.Date(2015, time.March, 4, 5, 6, 7, 0, time.UTC),
+				StoppedAt: time.Date(2015, time.March, 5, 6, 7, 8, 0, time.UTC),
+			}
+
+			err := container.Restore(linux_backend.ContainerSnapshot{
+				State:      "stopped",
+				StateTimes: stateTimes,
+				Events:     []string{},
+			})
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(container.StateTimes()).Should(Equal(stateTimes))
+		})
+
 		It("restores process state", func() {
 			err := container.Restore(linux_backend.ContainerSnapshot{
 				State:  "active",
@@ -340,6 +475,94 @@ var _ = Describe("Linux containers", func() {
 			Ω(pid).Should(Equal(uint32(1)))
 		})
 
+		Context("after a host reboot", func() {
+			var snapshot linux_backend.ContainerSnapshot
+
+			BeforeEach(func() {
+				snapshot = linux_backend.ContainerSnapshot{
+					State:  "active",
+					Events: []string{},
+
+					Processes: []linux_backend.ProcessSnapshot{
+						{ID: 0},
+						{ID: 1},
+					},
+
+					MTU:          1400,
+					HostRebooted: true,
+				}
+			})
+
+			It("starts it again with the MTU it was started with, before redoing its network", func() {
+				err := container.Restore(snapshot)
+				Ω(err).ShouldNot(HaveOccurred())
+
+				Ω(fakeRunner).Should(HaveExecutedSerially(
+					fake_command_runner.CommandSpec{
+						Path: containerDir + "/start.sh",
+						Env: []string{
+							"id=some-id",
+							"container_iface_mtu=1400",
+							"PATH=" + os.Getenv("PATH"),
+						},
+					},
+					fake_command_runner.CommandSpec{
+						Path: containerDir + "/net.sh",
+						Args: []string{"setup"},
+					},
+				))
+			})
+
+			It("removes the dead wshd's pid file first, so that start.sh runs", func() {
+				fakeRunner.WhenRunning(
+					fake_command_runner.CommandSpec{
+						Path: containerDir + "/start.sh",
+					}, func(*exec.Cmd) error {
+						_, err := os.Stat(filepath.Join(containerDir, "run", "wshd.pid"))
+						Ω(os.IsNotExist(err)).Should(BeTrue())
+						return nil
+					},
+				)
+
+				err := container.Restore(snapshot)
+				Ω(err).ShouldNot(HaveOccurred())
+			})
+
+			It("does not re-attach to its processes", func() {
+				err := container.Restore(snapshot)
+				Ω(err).ShouldNot(HaveOccurred())
+
+				Ω(fakeProcessTracker.RestoreCallCount()).Should(Equal(0))
+			})
+
+			It("records that it was re-erected", func() {
+				err := container.Restore(snapshot)
+				Ω(err).ShouldNot(HaveOccurred())
+
+				Ω(container.Events()).Should(ContainElement("re-erected after a host reboot"))
+				Ω(container.State()).Should(Equal(linux_backend.StateActive))
+			})
+
+			Context("when start.sh fails", func() {
+				nastyError := errors.New("oh no!")
+
+				BeforeEach(func() {
+					fakeRunner.WhenRunning(
+						fake_command_runner.CommandSpec{
+							Path: containerDir + "/start.sh",
+						}, func(*exec.Cmd) error {
+							return nastyError
+						},
+					)
+				})
+
+				It("returns the error", func() {
+					err := container.Restore(snapshot)
+					Ω(err).Should(Equal(nastyError))
+				})
+			})
+		})
+
 		It("restores environment variables", func() {
 			err := container.Restore(linux_backend.ContainerSnapshot{
 				EnvVars: []string{"env1=env1value", "env2=env2Value"},
@@ -350,6 +573,18 @@ var _ = Describe("Linux containers", func() {
 
 		})
 
+		It("rewrites the container's environment to the depot", func() {
+			err := container.Restore(linux_backend.ContainerSnapshot{
+				EnvVars: []string{"env1=env1value", "env2=env2Value"},
+			})
+			Ω(err).ShouldNot(HaveOccurred())
+
+			body, err := ioutil.ReadFile(filepath.Join(containerDir, "etc", "env"))
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(string(body)).Should(Equal("export env1='env1value'\nexport env2='env2Value'\n"))
+		})
+
 		It("redoes network setup and net-in/net-outs", func() {
 			err := container.Restore(linux_backend.ContainerSnapshot{
 				State:  "active",
@@ -368,11 +603,11 @@ var _ = Describe("Linux containers", func() {
 
 				NetOuts: []linux_backend.NetOutSpec{
 					{
-						Network: "somehost.example.com",
+						Network: "1.2.3.4/32",
 						Port:    80,
 					},
 					{
-						Network: "someotherhost.example.com",
+						Network: "1.2.3.5/32",
 						Port:    8080,
 					},
 				},
@@ -384,40 +619,141 @@ var _ = Describe("Linux containers", func() {
 					Path: containerDir + "/net.sh",
 					Args: []string{"setup"},
 				},
-				fake_command_runner.CommandSpec{
-					Path: containerDir + "/net.sh",
-					Args: []string{"in"},
+			))
+
+			Ω(fakeIPTablesManager.NetInCalls).Should(Equal([][]iptables_manager.NetIn{
+				{
+					{Protocol: "tcp", HostPort: 1234, ContainerPort: 5678},
+					{Protocol: "tcp", HostPort: 1235, ContainerPort: 5679},
 				},
-				fake_command_runner.CommandSpec{
-					Path: containerDir + "/net.sh",
-					Args: []string{"in"},
+			}))
+
+			Ω(fakeIPTablesManager.NetOutCalls).Should(Equal([][]iptables_manager.NetOut{
+				{
+					{Protocol: "tcp", Network: "1.2.3.4-1.2.3.4", Port: "80"},
+					{Protocol: "tcp", Network: "1.2.3.5-1.2.3.5", Port: "8080"},
 				},
-				fake_command_runner.CommandSpec{
-					Path: containerDir + "/net.sh",
-					Args: []string{"out"},
+			}))
+		})
+
+		It("re-applies udp port mappings as udp", func() {
+			err := container.Restore(linux_backend.ContainerSnapshot{
+				State:  "active",
+				Events: []string{},
+
+				NetIns: []linux_backend.NetInSpec{
+					{
+						HostPort:      1234,
+						ContainerPort: 5678,
+						Protocol:      linux_backend.ProtocolUDP,
+					},
 				},
-				fake_command_runner.CommandSpec{
-					Path: containerDir + "/net.sh",
-					Args: []string{"out"},
+			})
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(fakeIPTablesManager.NetInCalls).Should(Equal([][]iptables_manager.NetIn{
+				{
+					{Protocol: "udp", HostPort: 1234, ContainerPort: 5678},
 				},
-			))
+			}))
+		})
+
+		It("re-applies port range mappings as a single rule", func() {
+			err := container.Restore(linux_backend.ContainerSnapshot{
+				State:  "active",
+				Events: []string{},
+
+				NetIns: []linux_backend.NetInSpec{
+					{
+						HostPort:      6000,
+						ContainerPort: 6000,
+						Protocol:      linux_backend.ProtocolTCP,
+						Count:         100,
+					},
+				},
+			})
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(fakeIPTablesManager.NetInCalls).Should(Equal([][]iptables_manager.NetIn{
+				{
+					{Protocol: "tcp", HostPort: 6000, ContainerPort: 6000, Count: 100},
+				},
+			}))
+		})
+
+		It("re-applies structured net-out rules", func() {
+			err := container.Restore(linux_backend.ContainerSnapshot{
+				State:  "active",
+				Events: []string{},
+
+				NetOutRules: []linux_backend.NetOutRule{
+					{
+						Protocol: linux_backend.ProtocolUDP,
+						Ports:    []linux_backend.PortRange{{Start: 53, End: 53}},
+					},
+				},
+			})
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(fakeIPTablesManager.NetOutCalls).Should(Equal([][]iptables_manager.NetOut{
+				{
+					{Protocol: "udp", Port: "53"},
+				},
+			}))
+		})
+
+		It("re-applies legacy and structured net-out rules together, in order", func() {
+			err := container.Restore(linux_backend.ContainerSnapshot{
+				State:  "active",
+				Events: []string{},
+
+				NetOuts: []linux_backend.NetOutSpec{
+					{
+						Network: "1.2.3.4/32",
+					},
+				},
+
+				NetOutRules: []linux_backend.NetOutRule{
+					{
+						Protocol: linux_backend.ProtocolUDP,
+						Ports:    []linux_backend.PortRange{{Start: 53, End: 53}},
+					},
+				},
+			})
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(fakeIPTablesManager.NetOutCalls).Should(Equal([][]iptables_manager.NetOut{
+				{
+					{Protocol: "all", Network: "1.2.3.4-1.2.3.4"},
+					{Protocol: "udp", Port: "53"},
+				},
+			}))
 		})
 
-		for _, cmd := range []string{"setup", "in", "out"} {
-			command := cmd
+		for _, failure := range []string{"net.sh setup", "port mappings", "net-out rules"} {
+			failing := failure
 
-			Context("when net.sh "+cmd+" fails", func() {
+			Context("when re-applying the "+failing+" fails", func() {
 				disaster := errors.New("oh no!")
 
 				BeforeEach(func() {
-					fakeRunner.WhenRunning(
-						fake_command_runner.CommandSpec{
-							Path: containerDir + "/net.sh",
-							Args: []string{command},
-						}, func(*exec.Cmd) error {
-							return disaster
-						},
-					)
+					switch failing {
+					case "net.sh setup":
+						fakeRunner.WhenRunning(
+							fake_command_runner.CommandSpec{
+								Path: containerDir + "/net.sh",
+								Args: []string{"setup"},
+							}, func(*exec.Cmd) error {
+								return disaster
+							},
+						)
+
+					case "port mappings":
+						fakeIPTablesManager.NetInError = disaster
+
+					case "net-out rules":
+						fakeIPTablesManager.NetOutError = disaster
+					}
 				})
 
 				It("returns the error", func() {
@@ -438,11 +774,11 @@ var _ = Describe("Linux containers", func() {
 
 						NetOuts: []linux_backend.NetOutSpec{
 							{
-								Network: "somehost.example.com",
+								Network: "1.2.3.4/32",
 								Port:    80,
 							},
 							{
-								Network: "someotherhost.example.com",
+								Network: "1.2.3.5/32",
 								Port:    8080,
 							},
 						},
@@ -523,11 +859,15 @@ var _ = Describe("Linux containers", func() {
 	})
 
 	Describe("Starting", func() {
-		It("executes the container's start.sh with the correct environment", func() {
+		It("sets up the container's network rules, then executes its start.sh with the correct environment", func() {
 			err := container.Start(1400)
 			Ω(err).ShouldNot(HaveOccurred())
 
 			Ω(fakeRunner).Should(HaveExecutedSerially(
+				fake_command_runner.CommandSpec{
+					Path: containerDir + "/net.sh",
+					Args: []string{"setup"},
+				},
 				fake_command_runner.CommandSpec{
 					Path: containerDir + "/start.sh",
 					Env: []string{
@@ -540,6 +880,34 @@ var _ = Describe("Linux containers", func() {
 
 		})
 
+		It("writes the container's environment to the depot before starting", func() {
+			fakeRunner.WhenRunning(
+				fake_command_runner.CommandSpec{
+					Path: containerDir + "/start.sh",
+				}, func(*exec.Cmd) error {
+					body, err := ioutil.ReadFile(filepath.Join(containerDir, "etc", "env"))
+					Ω(err).ShouldNot(HaveOccurred())
+
+					Ω(string(body)).Should(Equal("export env1='env1Value'\nexport env2='env2Value'\n"))
+
+					return nil
+				},
+			)
+
+			err := container.Start(1500)
+			Ω(err).ShouldNot(HaveOccurred())
+		})
+
+		It("keeps the container's environment in the depot readable only by root", func() {
+			err := container.Start(1500)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			info, err := os.Stat(filepath.Join(containerDir, "etc", "env"))
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(info.Mode().Perm()).Should(Equal(os.FileMode(0600)))
+		})
+
 		It("changes the container's state to active", func() {
 			Ω(container.State()).Should(Equal(linux_backend.StateBorn))
 
@@ -549,37 +917,121 @@ var _ = Describe("Linux containers", func() {
 			Ω(container.State()).Should(Equal(linux_backend.StateActive))
 		})
 
-		Context("when start.sh fails", func() {
+		It("records when the container started", func() {
+			before := time.Now()
+
+			err := container.Start(1500)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			startedAt := container.StateTimes().StartedAt
+			Ω(startedAt).Should(BeTemporally(">=", before))
+			Ω(startedAt).Should(BeTemporally("<=", time.Now()))
+		})
+
+		Context("when setting up the network rules fails", func() {
 			nastyError := errors.New("oh no!")
 
 			BeforeEach(func() {
 				fakeRunner.WhenRunning(
 					fake_command_runner.CommandSpec{
-						Path: containerDir + "/start.sh",
+						Path: containerDir + "/net.sh",
+						Args: []string{"setup"},
 					}, func(*exec.Cmd) error {
 						return nastyError
 					},
 				)
 			})
 
-			It("returns the error", func() {
+			It("returns the error without executing start.sh", func() {
 				err := container.Start(1500)
 				Ω(err).Should(Equal(nastyError))
-			})
-
-			It("does not change the container's state", func() {
-				Ω(container.State()).Should(Equal(linux_backend.StateBorn))
-
-				err := container.Start(1500)
-				Ω(err).Should(HaveOccurred())
 
-				Ω(container.State()).Should(Equal(linux_backend.StateBorn))
+				Ω(fakeRunner).ShouldNot(HaveExecutedSerially(
+					fake_command_runner.CommandSpec{
+						Path: containerDir + "/start.sh",
+					},
+				))
 			})
 		})
-	})
 
-	Describe("Stopping", func() {
-		It("executes the container's stop.sh", func() {
+		Context("when start.sh fails", func() {
+			nastyError := errors.New("oh no!")
+
+			BeforeEach(func() {
+				fakeRunner.WhenRunning(
+					fake_command_runner.CommandSpec{
+						Path: containerDir + "/start.sh",
+					}, func(*exec.Cmd) error {
+						return nastyError
+					},
+				)
+			})
+
+			It("returns the error", func() {
+				err := container.Start(1500)
+				Ω(err).Should(Equal(nastyError))
+			})
+
+			It("does not change the container's state", func() {
+				Ω(container.State()).Should(Equal(linux_backend.StateBorn))
+
+				err := container.Start(1500)
+				Ω(err).Should(HaveOccurred())
+
+				Ω(container.State()).Should(Equal(linux_backend.StateBorn))
+			})
+
+			It("does not record a start", func() {
+				err := container.Start(1500)
+				Ω(err).Should(HaveOccurred())
+
+				Ω(container.StateTimes().StartedAt.IsZero()).Should(BeTrue())
+			})
+		})
+
+		Context("with a link builder", func() {
+			var linkBuilder *fake_linux_backend.FakeLinkBuilder
+
+			BeforeEach(func() {
+				linkBuilder = &fake_linux_backend.FakeLinkBuilder{}
+				container.SetLinkBuilder(linkBuilder)
+			})
+
+			It("has it build the container's links for wshd, once start.sh has run", func() {
+				fakeRunner.WhenRunning(
+					fake_command_runner.CommandSpec{
+						Path: containerDir + "/start.sh",
+					}, func(*exec.Cmd) error {
+						Ω(linkBuilder.Built).Should(BeEmpty())
+						return nil
+					},
+				)
+
+				err := container.Start(1500)
+				Ω(err).ShouldNot(HaveOccurred())
+
+				Ω(linkBuilder.Built).Should(Equal([]int{12345}))
+			})
+
+			Context("when building the links fails", func() {
+				disaster := errors.New("oh no!")
+
+				BeforeEach(func() {
+					linkBuilder.BuildError = disaster
+				})
+
+				It("returns the error without changing the container's state", func() {
+					err := container.Start(1500)
+					Ω(err).Should(Equal(disaster))
+
+					Ω(container.State()).Should(Equal(linux_backend.StateBorn))
+				})
+			})
+		})
+	})
+
+	Describe("Stopping", func() {
+		It("executes the container's stop.sh", func() {
 			err := container.Stop(false)
 			Ω(err).ShouldNot(HaveOccurred())
 
@@ -601,6 +1053,112 @@ var _ = Describe("Linux containers", func() {
 
 		})
 
+		It("records when the container stopped", func() {
+			before := time.Now()
+
+			err := container.Stop(false)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			stoppedAt := container.StateTimes().StoppedAt
+			Ω(stoppedAt).Should(BeTemporally(">=", before))
+			Ω(stoppedAt).Should(BeTemporally("<=", time.Now()))
+		})
+
+		Context("when the container has a shutdown hook", func() {
+			hookSpec := fake_command_runner.CommandSpec{
+				Path: containerDir + "/bin/wsh",
+			}
+
+			BeforeEach(func() {
+				hookSpec.Path = containerDir + "/bin/wsh"
+
+				container.Properties()[linux_backend.ShutdownHookProperty] = "/lifecycle/shutdown"
+			})
+
+			It("runs the hook as vcap before executing stop.sh", func() {
+				fakeRunner.WhenRunning(fake_command_runner.CommandSpec{
+					Path: containerDir + "/stop.sh",
+				}, func(*exec.Cmd) error {
+					Ω(fakeRunner.StartedCommands()).Should(HaveLen(1))
+					return nil
+				})
+
+				err := container.Stop(false)
+				Ω(err).ShouldNot(HaveOccurred())
+
+				started := fakeRunner.StartedCommands()
+				Ω(started).Should(HaveLen(1))
+				Ω(started[0].Path).Should(Equal(containerDir + "/bin/wsh"))
+				Ω(started[0].Args).Should(Equal([]string{
+					containerDir + "/bin/wsh",
+					"--socket", containerDir + "/run/wshd.sock",
+					"--user", "vcap",
+					"/bin/sh", "-c", "/lifecycle/shutdown",
+				}))
+
+				Ω(fakeRunner).Should(HaveExecutedSerially(
+					fake_command_runner.CommandSpec{
+						Path: containerDir + "/stop.sh",
+					},
+				))
+			})
+
+			It("does not run the hook when killing", func() {
+				err := container.Stop(true)
+				Ω(err).ShouldNot(HaveOccurred())
+
+				Ω(fakeRunner.StartedCommands()).Should(BeEmpty())
+			})
+
+			Context("when the hook fails", func() {
+				BeforeEach(func() {
+					fakeRunner.WhenWaitingFor(hookSpec, func(*exec.Cmd) error {
+						return errors.New("oh no!")
+					})
+				})
+
+				It("still stops the container", func() {
+					err := container.Stop(false)
+					Ω(err).ShouldNot(HaveOccurred())
+
+					Ω(container.State()).Should(Equal(linux_backend.StateStopped))
+				})
+			})
+
+			Context("when the hook takes longer than its timeout", func() {
+				var release chan struct{}
+
+				BeforeEach(func() {
+					release = make(chan struct{})
+
+					container.Properties()[linux_backend.ShutdownHookTimeoutProperty] = "100ms"
+
+					fakeRunner.WhenWaitingFor(hookSpec, func(*exec.Cmd) error {
+						<-release
+						return nil
+					})
+				})
+
+				AfterEach(func() {
+					close(release)
+				})
+
+				It("kills the hook and stops the container", func() {
+					err := container.Stop(false)
+					Ω(err).ShouldNot(HaveOccurred())
+
+					hook := fakeRunner.StartedCommands()[0]
+					Ω(fakeRunner.KilledCommands()).Should(ContainElement(hook))
+
+					Ω(fakeRunner).Should(HaveExecutedSerially(
+						fake_command_runner.CommandSpec{
+							Path: containerDir + "/stop.sh",
+						},
+					))
+				})
+			})
+		})
+
 		Context("when kill is true", func() {
 			It("executes stop.sh with -w 0", func() {
 				err := container.Stop(true)
@@ -735,6 +1293,19 @@ var _ = Describe("Linux containers", func() {
 				err := container.StreamIn("/some/directory/dst", nil)
 				Ω(err).Should(Equal(disaster))
 			})
+
+			It("still invalidates the container's disk usage", func() {
+				container.StreamIn("/some/directory/dst", nil)
+
+				Ω(fakeQuotaManager.Invalidated).Should(Equal([]uint32{containerResources.UID}))
+			})
+		})
+
+		It("invalidates the container's disk usage", func() {
+			err := container.StreamIn("/some/directory/dst", bytes.NewBufferString("the-tar-content"))
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(fakeQuotaManager.Invalidated).Should(Equal([]uint32{containerResources.UID}))
 		})
 	})
 
@@ -840,6 +1411,19 @@ var _ = Describe("Linux containers", func() {
 	})
 
 	Describe("Running", func() {
+		Context("when the container is broken", func() {
+			BeforeEach(func() {
+				container.Break("restore failed: oh no!")
+			})
+
+			It("refuses to run anything", func() {
+				_, err := container.Run(api.ProcessSpec{Path: "/some/script"}, api.ProcessIO{})
+				Ω(err).Should(Equal(linux_backend.BrokenContainerError{Handle: container.Handle()}))
+
+				Ω(fakeRunner.ExecutedCommands()).Should(BeEmpty())
+			})
+		})
+
 		It("runs the /bin/bash via wsh with the given script as the input, and rlimits in env", func() {
 			_, err := container.Run(api.ProcessSpec{
 				Path: "/some/script",
@@ -919,6 +1503,91 @@ var _ = Describe("Linux containers", func() {
 			}))
 		})
 
+		It("gives the process's environment variables precedence over the container's", func() {
+			_, err := container.Run(api.ProcessSpec{
+				Path: "/some/script",
+				Env:  []string{"env2=overridden", "env3=env3Value"},
+			}, api.ProcessIO{})
+
+			Ω(err).ShouldNot(HaveOccurred())
+
+			ranCmd, _, _ := fakeProcessTracker.RunArgsForCall(0)
+			Ω(ranCmd.Args).Should(Equal([]string{
+				containerDir + "/bin/wsh",
+				"--socket", containerDir + "/run/wshd.sock",
+				"--user", "vcap",
+				"--env", "env1=env1Value",
+				"--env", "env2=overridden",
+				"--env", "env3=env3Value",
+				"/some/script",
+			}))
+		})
+
+		Context("when the spec has a tty but no path", func() {
+			It("runs the user's login shell with a default TERM", func() {
+				_, err := container.Run(api.ProcessSpec{
+					TTY: &api.TTYSpec{},
+				}, api.ProcessIO{})
+				Ω(err).ShouldNot(HaveOccurred())
+
+				ranCmd, _, ranTTY := fakeProcessTracker.RunArgsForCall(0)
+				Ω(ranCmd.Args).Should(Equal([]string{
+					containerDir + "/bin/wsh",
+					"--socket", containerDir + "/run/wshd.sock",
+					"--user", "vcap",
+					"--env", "env1=env1Value",
+					"--env", "env2=env2Value",
+					"--env", "TERM=" + linux_backend.DefaultShellTerm,
+				}))
+				Ω(ranTTY).Should(Equal(&api.TTYSpec{}))
+			})
+
+			It("lets the spec choose TERM", func() {
+				_, err := container.Run(api.ProcessSpec{
+					Env: []string{"TERM=vt100"},
+					TTY: &api.TTYSpec{},
+				}, api.ProcessIO{})
+				Ω(err).ShouldNot(HaveOccurred())
+
+				ranCmd, _, _ := fakeProcessTracker.RunArgsForCall(0)
+				Ω(ranCmd.Args).Should(ContainElement("TERM=vt100"))
+				Ω(ranCmd.Args).ShouldNot(ContainElement("TERM=" + linux_backend.DefaultShellTerm))
+			})
+
+			Context("and args", func() {
+				It("returns an error without running anything", func() {
+					_, err := container.Run(api.ProcessSpec{
+						Args: []string{"-c", "ls"},
+						TTY:  &api.TTYSpec{},
+					}, api.ProcessIO{})
+					Ω(err).Should(BeAssignableToTypeOf(linux_backend.InvalidShellSpecError{}))
+
+					Ω(fakeProcessTracker.RunCallCount()).Should(Equal(0))
+				})
+			})
+		})
+
+		Context("when the spec has neither a path nor a tty", func() {
+			It("returns an error without running anything", func() {
+				_, err := container.Run(api.ProcessSpec{}, api.ProcessIO{})
+				Ω(err).Should(BeAssignableToTypeOf(linux_backend.InvalidShellSpecError{}))
+
+				Ω(fakeProcessTracker.RunCallCount()).Should(Equal(0))
+			})
+		})
+
+		Context("when an environment variable is malformed", func() {
+			It("returns an error without running the process", func() {
+				_, err := container.Run(api.ProcessSpec{
+					Path: "/some/script",
+					Env:  []string{"bogus"},
+				}, api.ProcessIO{})
+
+				Ω(err).Should(Equal(env.MalformedEnvironmentVariableError{Var: "bogus"}))
+				Ω(fakeProcessTracker.RunCallCount()).Should(Equal(0))
+			})
+		})
+
 		It("runs the script with the working dir set if present", func() {
 			_, err := container.Run(api.ProcessSpec{
 				Path: "/some/script",
@@ -1050,6 +1719,81 @@ var _ = Describe("Linux containers", func() {
 			}))
 		})
 
+		Context("when the server has default rlimits", func() {
+			BeforeEach(func() {
+				container = linux_backend.NewLinuxContainer(
+					lagertest.NewTestLogger("test"),
+					"some-id",
+					"some-handle",
+					containerDir,
+					nil,
+					1*time.Second,
+					containerResources,
+					fakePortPool,
+					fakeRunner,
+					fakeCgroups,
+					fakeQuotaManager,
+					nil,
+					fakeBandwidthManager,
+					fakeIPTablesManager,
+					fakeProcessTracker,
+					nil,
+					linux_backend.RootFSProvenance{},
+					linux_backend.Annotations{},
+					api.ResourceLimits{
+						Core:   uint64ptr(0),
+						Nofile: uint64ptr(65536),
+						Nproc:  uint64ptr(1024),
+					},
+				)
+			})
+
+			It("applies them to processes that do not set their own", func() {
+				_, err := container.Run(api.ProcessSpec{
+					Path: "/some/script",
+					Limits: api.ResourceLimits{
+						As: uint64ptr(1),
+					},
+				}, api.ProcessIO{})
+				Ω(err).ShouldNot(HaveOccurred())
+
+				ranCmd, _, _ := fakeProcessTracker.RunArgsForCall(0)
+				Ω(ranCmd.Env).Should(Equal([]string{
+					"RLIMIT_AS=1",
+					"RLIMIT_CORE=0",
+					"RLIMIT_NOFILE=65536",
+					"RLIMIT_NPROC=1024",
+				}))
+			})
+
+			It("gives the process's own limits precedence", func() {
+				_, err := container.Run(api.ProcessSpec{
+					Path: "/some/script",
+					Limits: api.ResourceLimits{
+						Nofile: uint64ptr(10),
+					},
+				}, api.ProcessIO{})
+				Ω(err).ShouldNot(HaveOccurred())
+
+				ranCmd, _, _ := fakeProcessTracker.RunArgsForCall(0)
+				Ω(ranCmd.Env).Should(Equal([]string{
+					"RLIMIT_CORE=0",
+					"RLIMIT_NOFILE=10",
+					"RLIMIT_NPROC=1024",
+				}))
+			})
+
+			It("applies them to processes run with a restart policy", func() {
+				_, err := container.RunWithRestart(api.ProcessSpec{
+					Path: "/some/daemon",
+				}, api.ProcessIO{}, process_tracker.RestartPolicy{Mode: process_tracker.RestartOnFailure})
+				Ω(err).ShouldNot(HaveOccurred())
+
+				ranCmd, _, _, _, _ := fakeProcessTracker.RunWithRestartArgsForCall(0)
+				Ω(ranCmd.Env).Should(ContainElement("RLIMIT_NOFILE=65536"))
+			})
+		})
+
 		Context("with 'privileged' true", func() {
 			It("runs with --user root", func() {
 				_, err := container.Run(api.ProcessSpec{
@@ -1090,31 +1834,421 @@ var _ = Describe("Linux containers", func() {
 		})
 	})
 
-	Describe("Attaching", func() {
-		Context("to a started process", func() {
-			BeforeEach(func() {
-				fakeProcessTracker.AttachStub = func(id uint32, io api.ProcessIO) (api.Process, error) {
-					writing := new(sync.WaitGroup)
-					writing.Add(1)
+	Describe("Running with a restart policy in the environment", func() {
+		It("runs the process with the policy, without the policy in its environment", func() {
+			_, err := container.Run(api.ProcessSpec{
+				Path: "/some/daemon",
+				Env: []string{
+					"GARDEN_RESTART_POLICY=on-failure",
+					"GARDEN_RESTART_BACKOFF=2s",
+					"GARDEN_RESTART_MAX_BACKOFF=30s",
+					"FOO=bar",
+				},
+			}, api.ProcessIO{})
+			Ω(err).ShouldNot(HaveOccurred())
 
-					go func() {
-						defer writing.Done()
-						defer GinkgoRecover()
+			Ω(fakeProcessTracker.RunCallCount()).Should(Equal(0))
 
-						_, err := fmt.Fprintf(io.Stdout, "hi out\n")
-						Ω(err).ShouldNot(HaveOccurred())
+			ranCmd, _, _, ranPolicy, _ := fakeProcessTracker.RunWithRestartArgsForCall(0)
+			Ω(ranPolicy).Should(Equal(process_tracker.RestartPolicy{
+				Mode:       process_tracker.RestartOnFailure,
+				Backoff:    2 * time.Second,
+				MaxBackoff: 30 * time.Second,
+			}))
 
-						_, err = fmt.Fprintf(io.Stderr, "hi err\n")
-						Ω(err).ShouldNot(HaveOccurred())
-					}()
+			Ω(ranCmd.Args).Should(ContainElement("FOO=bar"))
+			for _, arg := range ranCmd.Args {
+				Ω(arg).ShouldNot(HavePrefix("GARDEN_RESTART"))
+			}
+		})
 
-					process := new(wfakes.FakeProcess)
+		It("defaults the backoff", func() {
+			_, err := container.Run(api.ProcessSpec{
+				Path: "/some/daemon",
+				Env:  []string{"GARDEN_RESTART_POLICY=always"},
+			}, api.ProcessIO{})
+			Ω(err).ShouldNot(HaveOccurred())
 
-					process.IDReturns(42)
+			_, _, _, ranPolicy, _ := fakeProcessTracker.RunWithRestartArgsForCall(0)
+			Ω(ranPolicy).Should(Equal(process_tracker.RestartPolicy{
+				Mode:       process_tracker.RestartAlways,
+				Backoff:    linux_backend.DefaultRestartBackoff,
+				MaxBackoff: linux_backend.DefaultRestartMaxBackoff,
+			}))
+		})
 
-					process.WaitStub = func() (int, error) {
-						writing.Wait()
-						return 123, nil
+		Context("when the policy is never", func() {
+			It("runs the process as usual", func() {
+				_, err := container.Run(api.ProcessSpec{
+					Path: "/some/script",
+					Env:  []string{"GARDEN_RESTART_POLICY=never"},
+				}, api.ProcessIO{})
+				Ω(err).ShouldNot(HaveOccurred())
+
+				Ω(fakeProcessTracker.RunCallCount()).Should(Equal(1))
+				Ω(fakeProcessTracker.RunWithRestartCallCount()).Should(Equal(0))
+			})
+		})
+
+		Context("when the policy is invalid", func() {
+			It("returns an InvalidProcessOptionError and runs nothing", func() {
+				for _, envVar := range []string{
+					"GARDEN_RESTART_POLICY=sometimes",
+					"GARDEN_RESTART_BACKOFF=soon",
+					"GARDEN_RESTART_MAX_BACKOFF=-1s",
+				} {
+					_, err := container.Run(api.ProcessSpec{
+						Path: "/some/daemon",
+						Env:  []string{"GARDEN_RESTART_POLICY=always", envVar},
+					}, api.ProcessIO{})
+					Ω(err).Should(BeAssignableToTypeOf(linux_backend.InvalidProcessOptionError{}))
+				}
+
+				Ω(fakeProcessTracker.RunCallCount()).Should(Equal(0))
+				Ω(fakeProcessTracker.RunWithRestartCallCount()).Should(Equal(0))
+			})
+		})
+	})
+
+	Describe("Running with a restart policy", func() {
+		policy := process_tracker.RestartPolicy{
+			Mode:    process_tracker.RestartOnFailure,
+			Backoff: time.Second,
+		}
+
+		It("runs the process via wsh with the policy", func() {
+			_, err := container.RunWithRestart(api.ProcessSpec{
+				Path: "/some/daemon",
+				Args: []string{"arg1"},
+			}, api.ProcessIO{}, policy)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			ranCmd, _, _, ranPolicy, _ := fakeProcessTracker.RunWithRestartArgsForCall(0)
+			Ω(ranCmd.Path).Should(Equal(containerDir + "/bin/wsh"))
+			Ω(ranCmd.Args[len(ranCmd.Args)-2:]).Should(Equal([]string{"/some/daemon", "arg1"}))
+			Ω(ranPolicy).Should(Equal(policy))
+		})
+
+		It("registers an event for each restart", func() {
+			_, err := container.RunWithRestart(api.ProcessSpec{Path: "/some/daemon"}, api.ProcessIO{}, policy)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			_, _, _, _, hook := fakeProcessTracker.RunWithRestartArgsForCall(0)
+			Ω(hook(42, 1)).Should(BeTrue())
+			Ω(hook(42, 2)).Should(BeTrue())
+
+			Ω(container.Events()).Should(Equal([]string{
+				"process 42 restarted (restart count 1)",
+				"process 42 restarted (restart count 2)",
+			}))
+		})
+
+		Context("when the container has been stopped", func() {
+			It("does not restart processes", func() {
+				_, err := container.RunWithRestart(api.ProcessSpec{Path: "/some/daemon"}, api.ProcessIO{}, policy)
+				Ω(err).ShouldNot(HaveOccurred())
+
+				err = container.Stop(false)
+				Ω(err).ShouldNot(HaveOccurred())
+
+				_, _, _, _, hook := fakeProcessTracker.RunWithRestartArgsForCall(0)
+				Ω(hook(42, 1)).Should(BeFalse())
+
+				Ω(container.Events()).Should(BeEmpty())
+			})
+		})
+
+		Context("when the container is broken", func() {
+			It("refuses to run anything", func() {
+				container.Break("wshd died")
+
+				_, err := container.RunWithRestart(api.ProcessSpec{Path: "/some/daemon"}, api.ProcessIO{}, policy)
+				Ω(err).Should(Equal(linux_backend.BrokenContainerError{Handle: container.Handle()}))
+
+				Ω(fakeProcessTracker.RunWithRestartCallCount()).Should(Equal(0))
+			})
+		})
+	})
+
+	Describe("Running in another process's namespaces", func() {
+		BeforeEach(func() {
+			fakeProcessTracker.ContainerPIDReturns(1234, nil)
+		})
+
+		It("runs the process via wsh, joining the namespaces of the other process's pid in the container", func() {
+			_, err := container.RunInNamespacesOf(42, api.ProcessSpec{
+				Path: "/usr/bin/gdb",
+				Args: []string{"-p", "1234"},
+			}, api.ProcessIO{})
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(fakeProcessTracker.ContainerPIDArgsForCall(0)).Should(Equal(uint32(42)))
+
+			ranCmd, _, _ := fakeProcessTracker.RunArgsForCall(0)
+			Ω(ranCmd.Args).Should(Equal([]string{
+				containerDir + "/bin/wsh",
+				"--socket", containerDir + "/run/wshd.sock",
+				"--user", "vcap",
+				"--ns-pid", "1234",
+				"--env", "env1=env1Value",
+				"--env", "env2=env2Value",
+				"/usr/bin/gdb",
+				"-p",
+				"1234",
+			}))
+		})
+
+		Context("when the other process's pid in the container is not known", func() {
+			BeforeEach(func() {
+				fakeProcessTracker.ContainerPIDReturns(0, process_tracker.NoContainerPIDError{ProcessID: 42})
+			})
+
+			It("returns the error without running anything", func() {
+				_, err := container.RunInNamespacesOf(42, api.ProcessSpec{Path: "/usr/bin/gdb"}, api.ProcessIO{})
+				Ω(err).Should(Equal(process_tracker.NoContainerPIDError{ProcessID: 42}))
+
+				Ω(fakeProcessTracker.RunCallCount()).Should(Equal(0))
+			})
+		})
+
+		Context("when the process asks to join the other in its environment", func() {
+			It("runs it in the other's namespaces, without the request in its environment", func() {
+				_, err := container.Run(api.ProcessSpec{
+					Path: "/usr/bin/gdb",
+					Env:  []string{"GARDEN_JOIN_PROCESS=42"},
+				}, api.ProcessIO{})
+				Ω(err).ShouldNot(HaveOccurred())
+
+				Ω(fakeProcessTracker.ContainerPIDArgsForCall(0)).Should(Equal(uint32(42)))
+
+				ranCmd, _, _ := fakeProcessTracker.RunArgsForCall(0)
+				Ω(ranCmd.Args).Should(ContainElement("--ns-pid"))
+				Ω(ranCmd.Args).ShouldNot(ContainElement("GARDEN_JOIN_PROCESS=42"))
+			})
+
+			Context("when the process ID is invalid, or it also asks to be restarted", func() {
+				It("returns an InvalidProcessOptionError and runs nothing", func() {
+					for _, env := range [][]string{
+						{"GARDEN_JOIN_PROCESS=gdb"},
+						{"GARDEN_JOIN_PROCESS=42", "GARDEN_RESTART_POLICY=always"},
+					} {
+						_, err := container.Run(api.ProcessSpec{
+							Path: "/usr/bin/gdb",
+							Env:  env,
+						}, api.ProcessIO{})
+						Ω(err).Should(BeAssignableToTypeOf(linux_backend.InvalidProcessOptionError{}))
+					}
+
+					Ω(fakeProcessTracker.RunCallCount()).Should(Equal(0))
+					Ω(fakeProcessTracker.RunWithRestartCallCount()).Should(Equal(0))
+				})
+			})
+		})
+	})
+
+	Describe("Probing liveness", func() {
+		var process *wfakes.FakeProcess
+		var exited chan struct{}
+		var probe linux_backend.LivenessProbe
+
+		BeforeEach(func() {
+			exited = make(chan struct{})
+
+			process = new(wfakes.FakeProcess)
+			process.IDReturns(1)
+
+			processExited := exited
+			process.WaitStub = func() (int, error) {
+				<-processExited
+				return 0, nil
+			}
+
+			fakeProcessTracker.ActiveProcessesReturns([]api.Process{process})
+
+			probe = linux_backend.LivenessProbe{
+				Command:          []string{"/check", "arg"},
+				Interval:         10 * time.Millisecond,
+				Timeout:          time.Second,
+				FailureThreshold: 2,
+			}
+		})
+
+		AfterEach(func() {
+			close(exited)
+		})
+
+		Context("when a process asks to be probed in its environment", func() {
+			BeforeEach(func() {
+				fakeProcessTracker.RunReturns(process, nil)
+			})
+
+			It("runs it without the probe in its environment, then probes it", func() {
+				_, err := container.Run(api.ProcessSpec{
+					Path: "/some/daemon",
+					Env: []string{
+						"GARDEN_LIVENESS_COMMAND=/check arg",
+						"GARDEN_LIVENESS_INTERVAL=10ms",
+						"FOO=bar",
+					},
+				}, api.ProcessIO{})
+				Ω(err).ShouldNot(HaveOccurred())
+
+				ranCmd, _, _ := fakeProcessTracker.RunArgsForCall(0)
+				Ω(ranCmd.Args).Should(ContainElement("FOO=bar"))
+				for _, arg := range ranCmd.Args {
+					Ω(arg).ShouldNot(HavePrefix("GARDEN_LIVENESS"))
+				}
+
+				Eventually(fakeRunner.StartedCommands).ShouldNot(BeEmpty())
+
+				check := fakeRunner.StartedCommands()[0]
+				Ω(check.Args[len(check.Args)-2:]).Should(Equal([]string{"/check", "arg"}))
+
+				Ω(container.LivenessStatuses()).Should(HaveKey(uint32(1)))
+			})
+
+			Context("when the probe is invalid", func() {
+				It("returns an error and runs nothing", func() {
+					for _, env := range [][]string{
+						{"GARDEN_LIVENESS_PORT=70000"},
+						{"GARDEN_LIVENESS_COMMAND=/check", "GARDEN_LIVENESS_TIMEOUT=soon"},
+						{"GARDEN_LIVENESS_COMMAND=/check", "GARDEN_LIVENESS_FAILURE_THRESHOLD=0"},
+						{"GARDEN_LIVENESS_COMMAND=/check", "GARDEN_LIVENESS_PORT=8080"},
+					} {
+						_, err := container.Run(api.ProcessSpec{
+							Path: "/some/daemon",
+							Env:  env,
+						}, api.ProcessIO{})
+						Ω(err).Should(HaveOccurred())
+					}
+
+					Ω(fakeProcessTracker.RunCallCount()).Should(Equal(0))
+					Ω(container.LivenessStatuses()).Should(BeEmpty())
+				})
+			})
+		})
+
+		It("periodically runs the command via wsh as vcap", func() {
+			err := container.Probe(1, probe)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Eventually(fakeRunner.StartedCommands).Should(HaveLen(2))
+
+			check := fakeRunner.StartedCommands()[0]
+			Ω(check.Args).Should(Equal([]string{
+				containerDir + "/bin/wsh",
+				"--socket", containerDir + "/run/wshd.sock",
+				"--user", "vcap",
+				"/check", "arg",
+			}))
+
+			Ω(container.LivenessStatuses()).Should(Equal(map[uint32]linux_backend.LivenessStatus{
+				1: {Healthy: true},
+			}))
+		})
+
+		Context("when the check keeps failing", func() {
+			BeforeEach(func() {
+				fakeRunner.WhenWaitingFor(fake_command_runner.CommandSpec{
+					Path: containerDir + "/bin/wsh",
+				}, func(*exec.Cmd) error {
+					return errors.New("oh no!")
+				})
+			})
+
+			It("registers an event and reports the process as unhealthy", func() {
+				err := container.Probe(1, probe)
+				Ω(err).ShouldNot(HaveOccurred())
+
+				Eventually(container.Events).Should(ContainElement("process 1 failed liveness probe"))
+
+				Ω(fakeProcessTracker.KillCallCount()).Should(Equal(0))
+			})
+
+			It("reports the failures", func() {
+				probe.FailureThreshold = 1000
+
+				err := container.Probe(1, probe)
+				Ω(err).ShouldNot(HaveOccurred())
+
+				Eventually(func() int {
+					return container.LivenessStatuses()[1].ConsecutiveFailures
+				}).Should(BeNumerically(">=", 2))
+
+				Ω(container.LivenessStatuses()[1].LastError).Should(Equal("oh no!"))
+			})
+
+			Context("and the probe restarts the process", func() {
+				BeforeEach(func() {
+					probe.Restart = true
+				})
+
+				It("kills the process so that its restart policy applies", func() {
+					err := container.Probe(1, probe)
+					Ω(err).ShouldNot(HaveOccurred())
+
+					Eventually(fakeProcessTracker.KillCallCount).ShouldNot(BeZero())
+					Ω(fakeProcessTracker.KillArgsForCall(0)).Should(Equal(uint32(1)))
+				})
+			})
+		})
+
+		Context("when the process exits", func() {
+			It("stops probing it", func() {
+				err := container.Probe(1, probe)
+				Ω(err).ShouldNot(HaveOccurred())
+
+				close(exited)
+				exited = make(chan struct{})
+
+				Eventually(container.LivenessStatuses).Should(BeEmpty())
+			})
+		})
+
+		Context("when the process is unknown", func() {
+			It("returns an error", func() {
+				err := container.Probe(2, probe)
+				Ω(err).Should(Equal(process_tracker.UnknownProcessError{ProcessID: 2}))
+			})
+		})
+
+		Context("when the probe is invalid", func() {
+			It("returns an error", func() {
+				probe.Port = 8080
+
+				err := container.Probe(1, probe)
+				Ω(err).Should(HaveOccurred())
+
+				Ω(container.LivenessStatuses()).Should(BeEmpty())
+			})
+		})
+	})
+
+	Describe("Attaching", func() {
+		Context("to a started process", func() {
+			BeforeEach(func() {
+				fakeProcessTracker.AttachStub = func(id uint32, io api.ProcessIO) (api.Process, error) {
+					writing := new(sync.WaitGroup)
+					writing.Add(1)
+
+					go func() {
+						defer writing.Done()
+						defer GinkgoRecover()
+
+						_, err := fmt.Fprintf(io.Stdout, "hi out\n")
+						Ω(err).ShouldNot(HaveOccurred())
+
+						_, err = fmt.Fprintf(io.Stderr, "hi err\n")
+						Ω(err).ShouldNot(HaveOccurred())
+					}()
+
+					process := new(wfakes.FakeProcess)
+
+					process.IDReturns(42)
+
+					process.WaitStub = func() (int, error) {
+						writing.Wait()
+						return 123, nil
 					}
 
 					return process, nil
@@ -1225,587 +2359,2296 @@ var _ = Describe("Linux containers", func() {
 		})
 	})
 
-	Describe("Limiting memory", func() {
-		It("starts the oom notifier", func() {
-			limits := api.MemoryLimits{
-				LimitInBytes: 102400,
-			}
+	Describe("Checking for core dumps", func() {
+		var coresDir string
 
-			err := container.LimitMemory(limits)
+		BeforeEach(func() {
+			coresDir = filepath.Join(containerDir, "cores")
+
+			err := os.Mkdir(coresDir, 0755)
 			Ω(err).ShouldNot(HaveOccurred())
 
-			Ω(fakeRunner).Should(HaveStartedExecuting(
-				fake_command_runner.CommandSpec{
-					Path: containerDir + "/bin/oom",
-					Args: []string{"/cgroups/memory/instance-some-id"},
-				},
-			))
+			err = ioutil.WriteFile(filepath.Join(coresDir, "core.ruby.1234.1400000000"), []byte("some-core"), 0644)
+			Ω(err).ShouldNot(HaveOccurred())
+		})
+
+		It("registers an event naming each new core dump's path in the container", func() {
+			err := container.CheckCoreDumps()
+			Ω(err).ShouldNot(HaveOccurred())
 
+			Ω(container.Events()).Should(Equal([]string{
+				"core dumped: /var/garden/cores/core.ruby.1234.1400000000",
+			}))
 		})
 
-		It("sets memory.limit_in_bytes and then memory.memsw.limit_in_bytes", func() {
-			limits := api.MemoryLimits{
-				LimitInBytes: 102400,
-			}
+		It("reports each core dump only once", func() {
+			err := container.CheckCoreDumps()
+			Ω(err).ShouldNot(HaveOccurred())
 
-			err := container.LimitMemory(limits)
+			err = ioutil.WriteFile(filepath.Join(coresDir, "core.java.5678.1400000001"), []byte("some-core"), 0644)
 			Ω(err).ShouldNot(HaveOccurred())
 
-			Ω(fakeCgroups.SetValues()).Should(Equal(
-				[]fake_cgroups_manager.SetValue{
-					{
-						Subsystem: "memory",
-						Name:      "memory.limit_in_bytes",
-						Value:     "102400",
-					},
-					{
-						Subsystem: "memory",
-						Name:      "memory.memsw.limit_in_bytes",
-						Value:     "102400",
-					},
-					{
-						Subsystem: "memory",
-						Name:      "memory.limit_in_bytes",
-						Value:     "102400",
-					},
-				},
-			))
+			err = container.CheckCoreDumps()
+			Ω(err).ShouldNot(HaveOccurred())
 
+			Ω(container.Events()).Should(Equal([]string{
+				"core dumped: /var/garden/cores/core.ruby.1234.1400000000",
+				"core dumped: /var/garden/cores/core.java.5678.1400000001",
+			}))
 		})
 
-		Context("when the oom notifier is already running", func() {
-			It("does not start another", func() {
-				started := 0
+		It("does not report core dumps reported before it was restored", func() {
+			err := container.Restore(linux_backend.ContainerSnapshot{
+				Events: []string{"core dumped: /var/garden/cores/core.ruby.1234.1400000000"},
+			})
+			Ω(err).ShouldNot(HaveOccurred())
 
-				fakeRunner.WhenRunning(fake_command_runner.CommandSpec{
-					Path: containerDir + "/bin/oom",
-				}, func(*exec.Cmd) error {
-					started++
-					return nil
-				})
+			err = container.CheckCoreDumps()
+			Ω(err).ShouldNot(HaveOccurred())
 
-				limits := api.MemoryLimits{
-					LimitInBytes: 102400,
-				}
+			Ω(container.Events()).Should(HaveLen(1))
+		})
 
-				err := container.LimitMemory(limits)
-				Ω(err).ShouldNot(HaveOccurred())
+		It("ignores core dumps still being written", func() {
+			err := os.Rename(
+				filepath.Join(coresDir, "core.ruby.1234.1400000000"),
+				filepath.Join(coresDir, ".core.ruby.1234.1400000000"),
+			)
+			Ω(err).ShouldNot(HaveOccurred())
 
-				err = container.LimitMemory(limits)
-				Ω(err).ShouldNot(HaveOccurred())
+			err = container.CheckCoreDumps()
+			Ω(err).ShouldNot(HaveOccurred())
 
-				Ω(started).Should(Equal(1))
-			})
+			Ω(container.Events()).Should(BeEmpty())
 		})
 
-		Context("when the oom notifier exits 0", func() {
+		It("reports where the core dumps can be streamed out from in Info", func() {
+			info, err := container.Info()
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(info.Properties[linux_backend.CoreDumpsPathProperty]).Should(Equal("/var/garden/cores"))
+		})
+
+		Context("when the container has no core dumps directory", func() {
 			BeforeEach(func() {
-				fakeRunner.WhenWaitingFor(fake_command_runner.CommandSpec{
-					Path: containerDir + "/bin/oom",
-				}, func(cmd *exec.Cmd) error {
-					return nil
-				})
+				err := os.RemoveAll(coresDir)
+				Ω(err).ShouldNot(HaveOccurred())
 			})
 
-			It("stops the container", func() {
-				limits := api.MemoryLimits{
-					LimitInBytes: 102400,
-				}
+			It("reports nothing", func() {
+				err := container.CheckCoreDumps()
+				Ω(err).ShouldNot(HaveOccurred())
 
-				err := container.LimitMemory(limits)
+				Ω(container.Events()).Should(BeEmpty())
+
+				info, err := container.Info()
 				Ω(err).ShouldNot(HaveOccurred())
 
-				Eventually(fakeRunner).Should(HaveExecutedSerially(
-					fake_command_runner.CommandSpec{
-						Path: containerDir + "/stop.sh",
-					},
-				))
+				Ω(info.Properties).ShouldNot(HaveKey(linux_backend.CoreDumpsPathProperty))
 			})
+		})
+	})
 
-			It("registers an 'out of memory' event", func() {
-				limits := api.MemoryLimits{
-					LimitInBytes: 102400,
-				}
+	Describe("Packet captures", func() {
+		var captureSpec fake_command_runner.CommandSpec
+		var captureFinished chan struct{}
 
-				err := container.LimitMemory(limits)
-				Ω(err).ShouldNot(HaveOccurred())
+		BeforeEach(func() {
+			captureSpec = fake_command_runner.CommandSpec{
+				Path: containerDir + "/net.sh",
+				Args: []string{"capture"},
+			}
 
-				Eventually(func() []string {
-					return container.Events()
-				}).Should(ContainElement("out of memory"))
+			finished := make(chan struct{})
+			captureFinished = finished
+
+			fakeRunner.WhenWaitingFor(captureSpec, func(*exec.Cmd) error {
+				<-finished
+				return nil
 			})
 		})
 
-		Context("when setting memory.memsw.limit_in_bytes fails", func() {
-			disaster := errors.New("oh no!")
+		AfterEach(func() {
+			select {
+			case <-captureFinished:
+			default:
+				close(captureFinished)
+			}
+		})
 
-			BeforeEach(func() {
-				fakeCgroups.WhenSetting("memory", "memory.memsw.limit_in_bytes", func() error {
-					return disaster
-				})
+		It("starts net.sh capture, writing to the depot, bounded by the limits", func() {
+			capturePath, err := container.StartCapture(linux_backend.CaptureLimits{
+				Packets:    100,
+				SnapLength: 1500,
 			})
+			Ω(err).ShouldNot(HaveOccurred())
 
-			It("does not fail", func() {
-				err := container.LimitMemory(api.MemoryLimits{
-					LimitInBytes: 102400,
-				})
+			Ω(path.Dir(capturePath)).Should(Equal(linux_backend.CapturesPath))
+			Ω(capturePath).Should(HaveSuffix(".pcap"))
 
-				Ω(err).ShouldNot(HaveOccurred())
-			})
+			Ω(fakeRunner).Should(HaveStartedExecuting(
+				fake_command_runner.CommandSpec{
+					Path: containerDir + "/net.sh",
+					Args: []string{"capture"},
+					Env: []string{
+						"CAPTURE_PATH=" + filepath.Join(containerDir, "captures", path.Base(capturePath)),
+						"PACKETS=100",
+						"SNAP_LENGTH=1500",
+						"PATH=" + os.Getenv("PATH"),
+					},
+				},
+			))
 		})
 
-		Context("when setting memory.limit_in_bytes fails only the first time", func() {
-			disaster := errors.New("oh no!")
+		It("defaults limits that are not given", func() {
+			_, err := container.StartCapture(linux_backend.CaptureLimits{})
+			Ω(err).ShouldNot(HaveOccurred())
 
-			BeforeEach(func() {
-				numSet := 0
+			Ω(fakeRunner.StartedCommands()).Should(HaveLen(1))
+			Ω(fakeRunner.StartedCommands()[0].Env).Should(ContainElement("PACKETS=1000"))
+			Ω(fakeRunner.StartedCommands()[0].Env).Should(ContainElement("SNAP_LENGTH=65535"))
+		})
 
-				fakeCgroups.WhenSetting("memory", "memory.limit_in_bytes", func() error {
-					numSet++
+		It("reports where the captures can be streamed out from in Info", func() {
+			_, err := container.StartCapture(linux_backend.CaptureLimits{})
+			Ω(err).ShouldNot(HaveOccurred())
 
-					if numSet == 1 {
-						return disaster
-					}
+			info, err := container.Info()
+			Ω(err).ShouldNot(HaveOccurred())
 
-					return nil
-				})
-			})
+			Ω(info.Properties[linux_backend.CapturesPathProperty]).Should(Equal("/var/garden/captures"))
+		})
 
-			It("succeeds", func() {
-				fakeCgroups.WhenGetting("memory", "memory.limit_in_bytes", func() (string, error) {
-					return "123", nil
-				})
+		Context("when the limits exceed the maximum", func() {
+			It("returns a CaptureLimitsExceededError and captures nothing", func() {
+				limits := linux_backend.CaptureLimits{
+					Packets:    linux_backend.MaxCaptureBytes/1500 + 1,
+					SnapLength: 1500,
+				}
 
-				err := container.LimitMemory(api.MemoryLimits{
-					LimitInBytes: 102400,
-				})
+				_, err := container.StartCapture(limits)
+				Ω(err).Should(BeAssignableToTypeOf(linux_backend.CaptureLimitsExceededError{}))
 
-				Ω(err).ShouldNot(HaveOccurred())
+				_, err = container.StartCapture(linux_backend.CaptureLimits{Duration: 2 * time.Hour})
+				Ω(err).Should(BeAssignableToTypeOf(linux_backend.CaptureLimitsExceededError{}))
+
+				Ω(fakeRunner.StartedCommands()).Should(BeEmpty())
 			})
 		})
 
-		Context("when setting memory.limit_in_bytes fails the second time", func() {
-			disaster := errors.New("oh no!")
+		Context("when the container is broken", func() {
+			BeforeEach(func() {
+				container.Break("something went wrong")
+			})
+
+			It("returns a BrokenContainerError and captures nothing", func() {
+				_, err := container.StartCapture(linux_backend.CaptureLimits{})
+				Ω(err).Should(Equal(linux_backend.BrokenContainerError{Handle: "some-handle"}))
+
+				Ω(fakeRunner.StartedCommands()).Should(BeEmpty())
+			})
+		})
 
+		Context("when a capture is running", func() {
 			BeforeEach(func() {
-				numSet := 0
+				_, err := container.StartCapture(linux_backend.CaptureLimits{})
+				Ω(err).ShouldNot(HaveOccurred())
+			})
 
-				fakeCgroups.WhenSetting("memory", "memory.limit_in_bytes", func() error {
-					numSet++
+			It("does not start another", func() {
+				_, err := container.StartCapture(linux_backend.CaptureLimits{})
+				Ω(err).Should(Equal(linux_backend.CaptureInProgressError{Handle: "some-handle"}))
+			})
 
-					if numSet == 2 {
-						return disaster
-					}
+			It("can be stopped, after which another can be started", func() {
+				err := container.StopCapture()
+				Ω(err).ShouldNot(HaveOccurred())
 
-					return nil
-				})
+				Ω(fakeRunner).Should(HaveKilled(captureSpec))
+
+				_, err = container.StartCapture(linux_backend.CaptureLimits{})
+				Ω(err).ShouldNot(HaveOccurred())
 			})
 
-			It("returns the error and no limits", func() {
-				err := container.LimitMemory(api.MemoryLimits{
-					LimitInBytes: 102400,
-				})
+			It("is stopped when the container is stopped", func() {
+				err := container.Stop(false)
+				Ω(err).ShouldNot(HaveOccurred())
 
-				Ω(err).Should(Equal(disaster))
+				Ω(fakeRunner).Should(HaveKilled(captureSpec))
 			})
-		})
 
-		Context("when starting the oom notifier fails", func() {
-			disaster := errors.New("oh no!")
+			Context("and it finishes", func() {
+				It("lets another be started", func() {
+					close(captureFinished)
 
-			BeforeEach(func() {
-				fakeRunner.WhenRunning(fake_command_runner.CommandSpec{
-					Path: containerDir + "/bin/oom",
-				}, func(cmd *exec.Cmd) error {
-					return disaster
+					Eventually(func() error {
+						_, err := container.StartCapture(linux_backend.CaptureLimits{})
+						return err
+					}).ShouldNot(HaveOccurred())
 				})
 			})
+		})
 
-			It("returns the error", func() {
-				err := container.LimitMemory(api.MemoryLimits{
-					LimitInBytes: 102400,
-				})
+		Context("when the capture runs for its duration", func() {
+			It("is stopped", func() {
+				_, err := container.StartCapture(linux_backend.CaptureLimits{Duration: 10 * time.Millisecond})
+				Ω(err).ShouldNot(HaveOccurred())
 
-				Ω(err).Should(Equal(disaster))
+				Eventually(fakeRunner.KilledCommands).ShouldNot(BeEmpty())
+
+				err = container.StopCapture()
+				Ω(err).Should(Equal(linux_backend.NoCaptureError{Handle: "some-handle"}))
 			})
 		})
-	})
 
-	Describe("Getting the current memory limit", func() {
-		It("returns the limited memory", func() {
-			fakeCgroups.WhenGetting("memory", "memory.limit_in_bytes", func() (string, error) {
-				return "18446744073709551615", nil
+		Context("when no capture is running", func() {
+			It("returns a NoCaptureError on stopping", func() {
+				err := container.StopCapture()
+				Ω(err).Should(Equal(linux_backend.NoCaptureError{Handle: "some-handle"}))
 			})
-
-			limits, err := container.CurrentMemoryLimits()
-			Ω(err).ShouldNot(HaveOccurred())
-			Ω(limits.LimitInBytes).Should(Equal(uint64(math.MaxUint64)))
 		})
+	})
 
-		Context("when getting the limit fails", func() {
-			disaster := errors.New("oh no!")
+	Describe("Warnings", func() {
+		BeforeEach(func() {
+			container.Warn("disk quotas are disabled")
+			container.Warn("swap accounting is disabled")
+		})
 
-			BeforeEach(func() {
-				fakeCgroups.WhenGetting("memory", "memory.limit_in_bytes", func() (string, error) {
-					return "", disaster
-				})
-			})
+		It("reports them in Info, in order", func() {
+			info, err := container.Info()
+			Ω(err).ShouldNot(HaveOccurred())
 
-			It("returns the error", func() {
-				limits, err := container.CurrentMemoryLimits()
-				Ω(err).Should(Equal(disaster))
-				Ω(limits).Should(BeZero())
-			})
+			Ω(info.Properties).Should(HaveKeyWithValue("warnings.1", "disk quotas are disabled"))
+			Ω(info.Properties).Should(HaveKeyWithValue("warnings.2", "swap accounting is disabled"))
 		})
-	})
 
-	Describe("Limiting CPU", func() {
-		It("sets cpu.shares", func() {
-			limits := api.CPULimits{
-				LimitInShares: 512,
-			}
+		It("keeps them across a snapshot and restore", func() {
+			out := new(bytes.Buffer)
 
-			err := container.LimitCPU(limits)
+			err := container.Snapshot(out)
 			Ω(err).ShouldNot(HaveOccurred())
 
-			Ω(fakeCgroups.SetValues()).Should(Equal(
-				[]fake_cgroups_manager.SetValue{
-					{
-						Subsystem: "cpu",
-						Name:      "cpu.shares",
-						Value:     "512",
-					},
-				},
-			))
+			var snapshot linux_backend.ContainerSnapshot
 
-		})
+			err = json.NewDecoder(out).Decode(&snapshot)
+			Ω(err).ShouldNot(HaveOccurred())
 
-		Context("when setting cpu.shares fails", func() {
-			disaster := errors.New("oh no!")
+			Ω(snapshot.Warnings).Should(Equal([]string{
+				"disk quotas are disabled",
+				"swap accounting is disabled",
+			}))
 
-			BeforeEach(func() {
-				fakeCgroups.WhenSetting("cpu", "cpu.shares", func() error {
-					return disaster
-				})
-			})
+			restored := linux_backend.NewLinuxContainer(
+				lagertest.NewTestLogger("test"),
+				"some-id",
+				"some-handle",
+				containerDir,
+				nil,
+				1*time.Second,
+				containerResources,
+				fakePortPool,
+				fakeRunner,
+				fakeCgroups,
+				fakeQuotaManager,
+				nil,
+				fakeBandwidthManager,
+				fakeIPTablesManager,
+				fakeProcessTracker,
+				nil,
+				linux_backend.RootFSProvenance{},
+				linux_backend.Annotations{},
+				api.ResourceLimits{},
+			)
 
-			It("returns the error", func() {
-				err := container.LimitCPU(api.CPULimits{
-					LimitInShares: 512,
-				})
+			err = restored.Restore(snapshot)
+			Ω(err).ShouldNot(HaveOccurred())
 
-				Ω(err).Should(Equal(disaster))
-			})
+			Ω(restored.Warnings()).Should(Equal(snapshot.Warnings))
 		})
 	})
 
-	Describe("Getting the current CPU limits", func() {
-		It("returns the CPU limits", func() {
-			fakeCgroups.WhenGetting("cpu", "cpu.shares", func() (string, error) {
-				return "512", nil
-			})
+	Describe("Enabling core dumps", func() {
+		var corePatternPath string
+		var hostCoresPath string
 
-			limits, err := container.CurrentCPULimits()
-			Ω(err).ShouldNot(HaveOccurred())
-			Ω(limits.LimitInShares).Should(Equal(uint64(512)))
+		BeforeEach(func() {
+			corePatternPath = filepath.Join(containerDir, "core_pattern")
+			hostCoresPath = filepath.Join(containerDir, "host-cores")
 		})
 
-		Context("when getting the limit fails", func() {
-			disaster := errors.New("oh no!")
+		It("pipes cores to the core handler, with the depot, caps and host cores directory, and who dumped them", func() {
+			_, err := linux_backend.EnableCoreDumps(corePatternPath, "/some/bin", "/some/depot", hostCoresPath, 1048576, 5)
+			Ω(err).ShouldNot(HaveOccurred())
 
-			BeforeEach(func() {
-				fakeCgroups.WhenGetting("cpu", "cpu.shares", func() (string, error) {
-					return "", disaster
-				})
-			})
+			pattern, err := ioutil.ReadFile(corePatternPath)
+			Ω(err).ShouldNot(HaveOccurred())
 
-			It("returns the error", func() {
-				limits, err := container.CurrentCPULimits()
-				Ω(err).Should(Equal(disaster))
-				Ω(limits).Should(BeZero())
-			})
+			Ω(string(pattern)).Should(Equal("|/some/bin/core.sh /some/depot 1048576 5 " + hostCoresPath + " %P %u %g %t %e"))
 		})
-	})
 
-	Describe("Limiting disk", func() {
-		limits := api.DiskLimits{
-			BlockSoft: 3,
-			BlockHard: 4,
+		It("creates the host cores directory, readable only by root", func() {
+			_, err := linux_backend.EnableCoreDumps(corePatternPath, "/some/bin", "/some/depot", hostCoresPath, 1048576, 5)
+			Ω(err).ShouldNot(HaveOccurred())
 
-			InodeSoft: 13,
-			InodeHard: 14,
+			info, err := os.Stat(hostCoresPath)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(info.IsDir()).Should(BeTrue())
+			Ω(info.Mode().Perm()).Should(Equal(os.FileMode(0700)))
+		})
 
-			ByteSoft: 23,
-			ByteHard: 24,
-		}
+		It("returns the pattern it replaced, which can be restored", func() {
+			err := ioutil.WriteFile(corePatternPath, []byte("|/usr/share/apport/apport %p %s %c\n"), 0644)
+			Ω(err).ShouldNot(HaveOccurred())
 
-		It("sets the quota via the quota manager with the uid and limits", func() {
-			resultingLimits := api.DiskLimits{
-				BlockHard: 1234567,
-			}
+			previous, err := linux_backend.EnableCoreDumps(corePatternPath, "/some/bin", "/some/depot", hostCoresPath, 1048576, 5)
+			Ω(err).ShouldNot(HaveOccurred())
 
-			fakeQuotaManager.GetLimitsResult = resultingLimits
+			Ω(previous).Should(Equal("|/usr/share/apport/apport %p %s %c"))
 
-			err := container.LimitDisk(limits)
+			err = linux_backend.RestoreCorePattern(corePatternPath, hostCoresPath, previous)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			pattern, err := ioutil.ReadFile(corePatternPath)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(string(pattern)).Should(Equal("|/usr/share/apport/apport %p %s %c"))
+		})
+
+		Context("when an earlier server exited without restoring the pattern", func() {
+			BeforeEach(func() {
+				err := ioutil.WriteFile(corePatternPath, []byte("|/usr/share/apport/apport %p %s %c\n"), 0644)
+				Ω(err).ShouldNot(HaveOccurred())
+
+				_, err = linux_backend.EnableCoreDumps(corePatternPath, "/some/bin", "/some/depot", hostCoresPath, 1048576, 5)
+				Ω(err).ShouldNot(HaveOccurred())
+			})
+
+			It("returns the pattern the earlier server replaced, rather than its own", func() {
+				previous, err := linux_backend.EnableCoreDumps(corePatternPath, "/some/bin", "/some/depot", hostCoresPath, 1048576, 5)
+				Ω(err).ShouldNot(HaveOccurred())
+
+				Ω(previous).Should(Equal("|/usr/share/apport/apport %p %s %c"))
+			})
+
+			It("returns the pattern as it is if it has since been changed", func() {
+				err := ioutil.WriteFile(corePatternPath, []byte("/some/cores/core.%p\n"), 0644)
+				Ω(err).ShouldNot(HaveOccurred())
+
+				previous, err := linux_backend.EnableCoreDumps(corePatternPath, "/some/bin", "/some/depot", hostCoresPath, 1048576, 5)
+				Ω(err).ShouldNot(HaveOccurred())
+
+				Ω(previous).Should(Equal("/some/cores/core.%p"))
+
+				previous, err = linux_backend.EnableCoreDumps(corePatternPath, "/some/bin", "/some/depot", hostCoresPath, 1048576, 5)
+				Ω(err).ShouldNot(HaveOccurred())
+
+				Ω(previous).Should(Equal("/some/cores/core.%p"))
+			})
+
+			It("returns the kernel's default if the replaced pattern was not saved", func() {
+				err := os.Remove(filepath.Join(hostCoresPath, ".core_pattern"))
+				Ω(err).ShouldNot(HaveOccurred())
+
+				previous, err := linux_backend.EnableCoreDumps(corePatternPath, "/some/bin", "/some/depot", hostCoresPath, 1048576, 5)
+				Ω(err).ShouldNot(HaveOccurred())
+
+				Ω(previous).Should(Equal("core"))
+			})
+		})
+
+		Context("once the pattern is restored", func() {
+			It("no longer has it saved", func() {
+				err := ioutil.WriteFile(corePatternPath, []byte("core\n"), 0644)
+				Ω(err).ShouldNot(HaveOccurred())
+
+				previous, err := linux_backend.EnableCoreDumps(corePatternPath, "/some/bin", "/some/depot", hostCoresPath, 1048576, 5)
+				Ω(err).ShouldNot(HaveOccurred())
+
+				err = linux_backend.RestoreCorePattern(corePatternPath, hostCoresPath, previous)
+				Ω(err).ShouldNot(HaveOccurred())
+
+				_, err = os.Stat(filepath.Join(hostCoresPath, ".core_pattern"))
+				Ω(os.IsNotExist(err)).Should(BeTrue())
+			})
+		})
+
+		It("refuses a pattern the kernel would truncate", func() {
+			_, err := linux_backend.EnableCoreDumps(corePatternPath, "/some/bin/"+strings.Repeat("x", 100), "/some/depot", hostCoresPath, 1048576, 5)
+			Ω(err).Should(BeAssignableToTypeOf(linux_backend.CorePatternTooLongError{}))
+
+			_, err = os.Stat(corePatternPath)
+			Ω(os.IsNotExist(err)).Should(BeTrue())
+		})
+	})
+
+	Describe("Limiting huge pages", func() {
+		It("sets hugetlb.<size>.limit_in_bytes for each size", func() {
+			err := container.LimitHugePages(linux_backend.HugePageLimits{
+				"2MB": 4194304,
+				"1GB": 1073741824,
+			})
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(fakeCgroups.SetValues()).Should(Equal([]fake_cgroups_manager.SetValue{
+				{Subsystem: "hugetlb", Name: "hugetlb.1GB.limit_in_bytes", Value: "1073741824"},
+				{Subsystem: "hugetlb", Name: "hugetlb.2MB.limit_in_bytes", Value: "4194304"},
+			}))
+		})
+
+		It("remembers the limits, keeping those of other sizes", func() {
+			err := container.LimitHugePages(linux_backend.HugePageLimits{"2MB": 4194304})
+			Ω(err).ShouldNot(HaveOccurred())
+
+			err = container.LimitHugePages(linux_backend.HugePageLimits{"1GB": 1073741824})
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(container.CurrentHugePageLimits()).Should(Equal(linux_backend.HugePageLimits{
+				"2MB": 4194304,
+				"1GB": 1073741824,
+			}))
+		})
+
+		It("rejects sizes that are not of the kernel's form", func() {
+			err := container.LimitHugePages(linux_backend.HugePageLimits{"2M": 4194304})
+			Ω(err).Should(Equal(linux_backend.InvalidHugePageSizeError{Size: "2M"}))
+
+			Ω(fakeCgroups.SetValues()).Should(BeEmpty())
+		})
+
+		Context("when setting the limit fails", func() {
+			disaster := errors.New("oh no!")
+
+			BeforeEach(func() {
+				fakeCgroups.WhenSetting("hugetlb", "hugetlb.2MB.limit_in_bytes", func() error {
+					return disaster
+				})
+			})
+
+			It("returns the error and does not remember the limit", func() {
+				err := container.LimitHugePages(linux_backend.HugePageLimits{"2MB": 4194304})
+				Ω(err).Should(Equal(disaster))
+
+				Ω(container.CurrentHugePageLimits()).Should(BeEmpty())
+			})
+		})
+
+		Context("when they are requested as properties", func() {
+			var requested string
+
+			JustBeforeEach(func() {
+				container = linux_backend.NewLinuxContainer(
+					lagertest.NewTestLogger("test"),
+					"some-id",
+					"some-handle",
+					containerDir,
+					map[string]string{
+						"hugetlb.2MB.limit_in_bytes": requested,
+					},
+					1*time.Second,
+					containerResources,
+					fakePortPool,
+					fakeRunner,
+					fakeCgroups,
+					fakeQuotaManager,
+					nil,
+					fakeBandwidthManager,
+					fakeIPTablesManager,
+					fakeProcessTracker,
+					nil,
+					linux_backend.RootFSProvenance{},
+					linux_backend.Annotations{},
+					api.ResourceLimits{},
+				)
+			})
+
+			BeforeEach(func() {
+				requested = "4194304"
+			})
+
+			It("applies them once the container has started", func() {
+				err := container.Start(1500)
+				Ω(err).ShouldNot(HaveOccurred())
+
+				Ω(container.CurrentHugePageLimits()).Should(Equal(linux_backend.HugePageLimits{
+					"2MB": 4194304,
+				}))
+			})
+
+			Context("and a limit is not a number", func() {
+				BeforeEach(func() {
+					requested = "lots"
+				})
+
+				It("fails to start", func() {
+					err := container.Start(1500)
+					Ω(err).Should(Equal(linux_backend.InvalidHugePagesPropertyError{
+						Property: "hugetlb.2MB.limit_in_bytes",
+						Value:    "lots",
+					}))
+
+					Ω(container.State()).Should(Equal(linux_backend.StateBorn))
+				})
+			})
+		})
+
+		It("reports their limits and usage in Info", func() {
+			fakeCgroups.WhenGetting("hugetlb", "hugetlb.2MB.usage_in_bytes", func() (string, error) {
+				return "2097152", nil
+			})
+
+			fakeCgroups.WhenGetting("hugetlb", "hugetlb.2MB.max_usage_in_bytes", func() (string, error) {
+				return "4194304", nil
+			})
+
+			fakeCgroups.WhenGetting("hugetlb", "hugetlb.2MB.failcnt", func() (string, error) {
+				return "3", nil
+			})
+
+			err := container.LimitHugePages(linux_backend.HugePageLimits{"2MB": 4194304})
+			Ω(err).ShouldNot(HaveOccurred())
+
+			info, err := container.Info()
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(info.Properties["hugetlb.2MB.limit_in_bytes"]).Should(Equal("4194304"))
+			Ω(info.Properties["hugetlb.2MB.usage_in_bytes"]).Should(Equal("2097152"))
+			Ω(info.Properties["hugetlb.2MB.max_usage_in_bytes"]).Should(Equal("4194304"))
+			Ω(info.Properties["hugetlb.2MB.failcnt"]).Should(Equal("3"))
+		})
+
+		It("does not report sizes it is not limited in", func() {
+			info, err := container.Info()
+			Ω(err).ShouldNot(HaveOccurred())
+
+			for key := range info.Properties {
+				Ω(key).ShouldNot(HavePrefix("hugetlb."))
+			}
+		})
+
+		It("snapshots them, and reapplies them on restore", func() {
+			err := container.LimitHugePages(linux_backend.HugePageLimits{"2MB": 4194304})
+			Ω(err).ShouldNot(HaveOccurred())
+
+			out := new(bytes.Buffer)
+
+			err = container.Snapshot(out)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			var snapshot linux_backend.ContainerSnapshot
+
+			err = json.NewDecoder(out).Decode(&snapshot)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(snapshot.Limits.HugePages).Should(Equal(linux_backend.HugePageLimits{"2MB": 4194304}))
+
+			restoredCgroups := fake_cgroups_manager.New("/cgroups", "some-id")
+
+			restored := linux_backend.NewLinuxContainer(
+				lagertest.NewTestLogger("test"),
+				"some-id",
+				"some-handle",
+				containerDir,
+				nil,
+				1*time.Second,
+				containerResources,
+				fakePortPool,
+				fakeRunner,
+				restoredCgroups,
+				fakeQuotaManager,
+				nil,
+				fakeBandwidthManager,
+				fakeIPTablesManager,
+				fakeProcessTracker,
+				nil,
+				linux_backend.RootFSProvenance{},
+				linux_backend.Annotations{},
+				api.ResourceLimits{},
+			)
+
+			err = restored.Restore(snapshot)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(restoredCgroups.SetValues()).Should(ContainElement(fake_cgroups_manager.SetValue{
+				Subsystem: "hugetlb",
+				Name:      "hugetlb.2MB.limit_in_bytes",
+				Value:     "4194304",
+			}))
+		})
+	})
+
+	Describe("Limiting memory", func() {
+		Context("when the container has a limit admitter", func() {
+			var admitter *fake_linux_backend.FakeLimitAdmitter
+
+			BeforeEach(func() {
+				admitter = new(fake_linux_backend.FakeLimitAdmitter)
+				container.SetLimitAdmitter(admitter)
+
+				err := container.LimitDisk(api.DiskLimits{ByteHard: 2048})
+				Ω(err).ShouldNot(HaveOccurred())
+			})
+
+			It("has it admit the container's new commitment, and releases it", func() {
+				err := container.LimitMemory(api.MemoryLimits{LimitInBytes: 1024})
+				Ω(err).ShouldNot(HaveOccurred())
+
+				Ω(admitter.Admitted).Should(Equal([]linux_backend.CommittedResources{
+					{DiskInBytes: 2048},
+					{MemoryInBytes: 1024, DiskInBytes: 2048},
+				}))
+
+				Ω(admitter.Released).Should(Equal(2))
+			})
+
+			Context("and it does not admit the limit", func() {
+				disaster := linux_backend.OvercommitError{
+					Resource:  "memory",
+					Committed: 2048,
+					Allowed:   1024,
+				}
+
+				BeforeEach(func() {
+					admitter.AdmitError = disaster
+				})
+
+				It("returns the error without limiting the container", func() {
+					err := container.LimitMemory(api.MemoryLimits{LimitInBytes: 1024})
+					Ω(err).Should(Equal(disaster))
+
+					Ω(fakeCgroups.SetValues()).Should(BeEmpty())
+					Ω(container.CommittedResources().MemoryInBytes).Should(BeZero())
+				})
+			})
+		})
+
+		It("starts the oom notifier", func() {
+			limits := api.MemoryLimits{
+				LimitInBytes: 102400,
+			}
+
+			err := container.LimitMemory(limits)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(fakeRunner).Should(HaveStartedExecuting(
+				fake_command_runner.CommandSpec{
+					Path: containerDir + "/bin/oom",
+					Args: []string{"/cgroups/memory/instance-some-id"},
+				},
+			))
+
+		})
+
+		It("sets memory.limit_in_bytes and then memory.memsw.limit_in_bytes", func() {
+			limits := api.MemoryLimits{
+				LimitInBytes: 102400,
+			}
+
+			err := container.LimitMemory(limits)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(fakeCgroups.SetValues()).Should(Equal(
+				[]fake_cgroups_manager.SetValue{
+					{
+						Subsystem: "memory",
+						Name:      "memory.limit_in_bytes",
+						Value:     "102400",
+					},
+					{
+						Subsystem: "memory",
+						Name:      "memory.memsw.limit_in_bytes",
+						Value:     "102400",
+					},
+					{
+						Subsystem: "memory",
+						Name:      "memory.limit_in_bytes",
+						Value:     "102400",
+					},
+				},
+			))
+
+		})
+
+		Context("when the oom notifier is already running", func() {
+			It("does not start another", func() {
+				started := 0
+
+				fakeRunner.WhenRunning(fake_command_runner.CommandSpec{
+					Path: containerDir + "/bin/oom",
+				}, func(*exec.Cmd) error {
+					started++
+					return nil
+				})
+
+				limits := api.MemoryLimits{
+					LimitInBytes: 102400,
+				}
+
+				err := container.LimitMemory(limits)
+				Ω(err).ShouldNot(HaveOccurred())
+
+				err = container.LimitMemory(limits)
+				Ω(err).ShouldNot(HaveOccurred())
+
+				Ω(started).Should(Equal(1))
+			})
+		})
+
+		Context("when the oom notifier exits 0", func() {
+			BeforeEach(func() {
+				fakeRunner.WhenWaitingFor(fake_command_runner.CommandSpec{
+					Path: containerDir + "/bin/oom",
+				}, func(cmd *exec.Cmd) error {
+					return nil
+				})
+			})
+
+			It("stops the container", func() {
+				limits := api.MemoryLimits{
+					LimitInBytes: 102400,
+				}
+
+				err := container.LimitMemory(limits)
+				Ω(err).ShouldNot(HaveOccurred())
+
+				Eventually(fakeRunner).Should(HaveExecutedSerially(
+					fake_command_runner.CommandSpec{
+						Path: containerDir + "/stop.sh",
+					},
+				))
+			})
+
+			It("registers an 'out of memory' event", func() {
+				limits := api.MemoryLimits{
+					LimitInBytes: 102400,
+				}
+
+				err := container.LimitMemory(limits)
+				Ω(err).ShouldNot(HaveOccurred())
+
+				Eventually(func() []string {
+					return container.Events()
+				}).Should(ContainElement("out of memory"))
+			})
+		})
+
+		Context("when setting memory.memsw.limit_in_bytes fails", func() {
+			disaster := errors.New("oh no!")
+
+			BeforeEach(func() {
+				fakeCgroups.WhenSetting("memory", "memory.memsw.limit_in_bytes", func() error {
+					return disaster
+				})
+			})
+
+			It("returns the error, as the limit is not in force", func() {
+				err := container.LimitMemory(api.MemoryLimits{
+					LimitInBytes: 102400,
+				})
+
+				Ω(err).Should(Equal(disaster))
+			})
+		})
+
+		It("reports that swap is limited", func() {
+			err := container.LimitMemory(api.MemoryLimits{
+				LimitInBytes: 102400,
+			})
+			Ω(err).ShouldNot(HaveOccurred())
+
+			info, err := container.Info()
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(info.Properties).Should(HaveKeyWithValue(linux_backend.SwapLimitedProperty, "true"))
+		})
+
+		Context("when the host has no swap accounting", func() {
+			BeforeEach(func() {
+				fakeCgroups.WhenGetting("memory", "memory.memsw.limit_in_bytes", func() (string, error) {
+					return "", &os.PathError{
+						Op:   "open",
+						Path: "/cgroups/memory/instance-some-id/memory.memsw.limit_in_bytes",
+						Err:  syscall.ENOENT,
+					}
+				})
+			})
+
+			It("sets only memory.limit_in_bytes", func() {
+				err := container.LimitMemory(api.MemoryLimits{
+					LimitInBytes: 102400,
+				})
+				Ω(err).ShouldNot(HaveOccurred())
+
+				Ω(fakeCgroups.SetValues()).Should(Equal(
+					[]fake_cgroups_manager.SetValue{
+						{
+							Subsystem: "memory",
+							Name:      "memory.limit_in_bytes",
+							Value:     "102400",
+						},
+						{
+							Subsystem: "memory",
+							Name:      "memory.limit_in_bytes",
+							Value:     "102400",
+						},
+					},
+				))
+			})
+
+			It("reports that swap is not limited", func() {
+				err := container.LimitMemory(api.MemoryLimits{
+					LimitInBytes: 102400,
+				})
+				Ω(err).ShouldNot(HaveOccurred())
+
+				info, err := container.Info()
+				Ω(err).ShouldNot(HaveOccurred())
+
+				Ω(info.Properties).Should(HaveKeyWithValue(linux_backend.SwapLimitedProperty, "false"))
+			})
+		})
+
+		Context("when setting memory.limit_in_bytes fails only the first time", func() {
+			disaster := errors.New("oh no!")
+
+			BeforeEach(func() {
+				numSet := 0
+
+				fakeCgroups.WhenSetting("memory", "memory.limit_in_bytes", func() error {
+					numSet++
+
+					if numSet == 1 {
+						return disaster
+					}
+
+					return nil
+				})
+			})
+
+			It("succeeds", func() {
+				fakeCgroups.WhenGetting("memory", "memory.limit_in_bytes", func() (string, error) {
+					return "123", nil
+				})
+
+				err := container.LimitMemory(api.MemoryLimits{
+					LimitInBytes: 102400,
+				})
+
+				Ω(err).ShouldNot(HaveOccurred())
+			})
+		})
+
+		Context("when setting memory.limit_in_bytes fails the second time", func() {
+			disaster := errors.New("oh no!")
+
+			BeforeEach(func() {
+				numSet := 0
+
+				fakeCgroups.WhenSetting("memory", "memory.limit_in_bytes", func() error {
+					numSet++
+
+					if numSet == 2 {
+						return disaster
+					}
+
+					return nil
+				})
+			})
+
+			It("returns the error and no limits", func() {
+				err := container.LimitMemory(api.MemoryLimits{
+					LimitInBytes: 102400,
+				})
+
+				Ω(err).Should(Equal(disaster))
+			})
+		})
+
+		Context("when starting the oom notifier fails", func() {
+			disaster := errors.New("oh no!")
+
+			BeforeEach(func() {
+				fakeRunner.WhenRunning(fake_command_runner.CommandSpec{
+					Path: containerDir + "/bin/oom",
+				}, func(cmd *exec.Cmd) error {
+					return disaster
+				})
+			})
+
+			It("returns the error", func() {
+				err := container.LimitMemory(api.MemoryLimits{
+					LimitInBytes: 102400,
+				})
+
+				Ω(err).Should(Equal(disaster))
+			})
+		})
+	})
+
+	Describe("Getting the current memory limit", func() {
+		It("returns the limited memory", func() {
+			fakeCgroups.WhenGetting("memory", "memory.limit_in_bytes", func() (string, error) {
+				return "18446744073709551615", nil
+			})
+
+			limits, err := container.CurrentMemoryLimits()
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(limits.LimitInBytes).Should(Equal(uint64(math.MaxUint64)))
+		})
+
+		Context("when getting the limit fails", func() {
+			disaster := errors.New("oh no!")
+
+			BeforeEach(func() {
+				fakeCgroups.WhenGetting("memory", "memory.limit_in_bytes", func() (string, error) {
+					return "", disaster
+				})
+			})
+
+			It("returns the error", func() {
+				limits, err := container.CurrentMemoryLimits()
+				Ω(err).Should(Equal(disaster))
+				Ω(limits).Should(BeZero())
+			})
+		})
+	})
+
+	Describe("Limiting CPU", func() {
+		It("sets cpu.shares", func() {
+			limits := api.CPULimits{
+				LimitInShares: 512,
+			}
+
+			err := container.LimitCPU(limits)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(fakeCgroups.SetValues()).Should(Equal(
+				[]fake_cgroups_manager.SetValue{
+					{
+						Subsystem: "cpu",
+						Name:      "cpu.shares",
+						Value:     "512",
+					},
+				},
+			))
+
+		})
+
+		Context("when setting cpu.shares fails", func() {
+			disaster := errors.New("oh no!")
+
+			BeforeEach(func() {
+				fakeCgroups.WhenSetting("cpu", "cpu.shares", func() error {
+					return disaster
+				})
+			})
+
+			It("returns the error", func() {
+				err := container.LimitCPU(api.CPULimits{
+					LimitInShares: 512,
+				})
+
+				Ω(err).Should(Equal(disaster))
+			})
+		})
+	})
+
+	Describe("Getting the current CPU limits", func() {
+		It("returns the CPU limits", func() {
+			fakeCgroups.WhenGetting("cpu", "cpu.shares", func() (string, error) {
+				return "512", nil
+			})
+
+			limits, err := container.CurrentCPULimits()
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(limits.LimitInShares).Should(Equal(uint64(512)))
+		})
+
+		Context("when getting the limit fails", func() {
+			disaster := errors.New("oh no!")
+
+			BeforeEach(func() {
+				fakeCgroups.WhenGetting("cpu", "cpu.shares", func() (string, error) {
+					return "", disaster
+				})
+			})
+
+			It("returns the error", func() {
+				limits, err := container.CurrentCPULimits()
+				Ω(err).Should(Equal(disaster))
+				Ω(limits).Should(BeZero())
+			})
+		})
+	})
+
+	Describe("Limiting disk", func() {
+		limits := api.DiskLimits{
+			BlockSoft: 3,
+			BlockHard: 4,
+
+			InodeSoft: 13,
+			InodeHard: 14,
+
+			ByteSoft: 23,
+			ByteHard: 24,
+		}
+
+		It("sets the quota via the quota manager with the uid and limits", func() {
+			resultingLimits := api.DiskLimits{
+				BlockHard: 1234567,
+			}
+
+			fakeQuotaManager.GetLimitsResult = resultingLimits
+
+			err := container.LimitDisk(limits)
 			Ω(err).ShouldNot(HaveOccurred())
 
 			uid := containerResources.UID
 
-			Ω(fakeQuotaManager.Limited).Should(HaveKey(uid))
-			Ω(fakeQuotaManager.Limited[uid]).Should(Equal(limits))
+			Ω(fakeQuotaManager.Limited).Should(HaveKey(uid))
+			Ω(fakeQuotaManager.Limited[uid]).Should(Equal(limits))
+		})
+
+		Context("when setting the quota fails", func() {
+			disaster := errors.New("oh no!")
+
+			BeforeEach(func() {
+				fakeQuotaManager.SetLimitsError = disaster
+			})
+
+			It("returns the error", func() {
+				err := container.LimitDisk(limits)
+				Ω(err).Should(Equal(disaster))
+			})
+		})
+
+		Context("when the container has a limit admitter that does not admit the limit", func() {
+			disaster := linux_backend.OvercommitError{
+				Resource:  "disk",
+				Committed: 48,
+				Allowed:   24,
+			}
+
+			BeforeEach(func() {
+				container.SetLimitAdmitter(&fake_linux_backend.FakeLimitAdmitter{AdmitError: disaster})
+			})
+
+			It("returns the error without limiting the container", func() {
+				err := container.LimitDisk(limits)
+				Ω(err).Should(Equal(disaster))
+
+				Ω(fakeQuotaManager.Limited).Should(BeEmpty())
+				Ω(container.CommittedResources().DiskInBytes).Should(BeZero())
+			})
+		})
+
+		Context("when the container has its own volume", func() {
+			var fakeVolumeManager *fake_volume_manager.FakeVolumeManager
+
+			BeforeEach(func() {
+				fakeVolumeManager = fake_volume_manager.New()
+
+				container = linux_backend.NewLinuxContainer(
+					lagertest.NewTestLogger("test"),
+					"some-id",
+					"some-handle",
+					containerDir,
+					nil,
+					1*time.Second,
+					containerResources,
+					fakePortPool,
+					fakeRunner,
+					fakeCgroups,
+					fakeQuotaManager,
+					fakeVolumeManager,
+					fakeBandwidthManager,
+					fakeIPTablesManager,
+					fakeProcessTracker,
+					nil,
+					linux_backend.RootFSProvenance{},
+					linux_backend.Annotations{},
+					api.ResourceLimits{},
+				)
+			})
+
+			It("resizes the volume to the hard byte limit instead of setting a quota", func() {
+				err := container.LimitDisk(limits)
+				Ω(err).ShouldNot(HaveOccurred())
+
+				Ω(fakeVolumeManager.Resized).Should(Equal(map[string]uint64{
+					"some-id": 24,
+				}))
+
+				Ω(fakeQuotaManager.Limited).Should(BeEmpty())
+			})
+
+			It("reports the limits it was given as the current limits", func() {
+				err := container.LimitDisk(limits)
+				Ω(err).ShouldNot(HaveOccurred())
+
+				Ω(container.CurrentDiskLimits()).Should(Equal(limits))
+			})
+
+			Context("when only a block limit is given", func() {
+				It("resizes the volume to that many quota blocks", func() {
+					err := container.LimitDisk(api.DiskLimits{BlockHard: 4})
+					Ω(err).ShouldNot(HaveOccurred())
+
+					Ω(fakeVolumeManager.Resized).Should(Equal(map[string]uint64{
+						"some-id": 4 * quota_manager.QUOTA_BLOCK_SIZE,
+					}))
+				})
+			})
+
+			Context("when no hard limit is given", func() {
+				It("leaves the volume alone", func() {
+					err := container.LimitDisk(api.DiskLimits{ByteSoft: 23})
+					Ω(err).ShouldNot(HaveOccurred())
+
+					Ω(fakeVolumeManager.Resized).Should(BeEmpty())
+				})
+			})
+
+			Context("when resizing the volume fails", func() {
+				disaster := errors.New("oh no!")
+
+				BeforeEach(func() {
+					fakeVolumeManager.ResizeError = disaster
+				})
+
+				It("returns the error", func() {
+					err := container.LimitDisk(limits)
+					Ω(err).Should(Equal(disaster))
+				})
+
+				It("does not change the current limits", func() {
+					container.LimitDisk(limits)
+
+					Ω(container.CurrentDiskLimits()).Should(BeZero())
+				})
+			})
+		})
+	})
+
+	Describe("Getting the current disk limits", func() {
+		It("returns the disk limits", func() {
+			limits := api.DiskLimits{
+				BlockHard: 1234567,
+			}
+
+			fakeQuotaManager.GetLimitsResult = limits
+
+			receivedLimits, err := container.CurrentDiskLimits()
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(receivedLimits).Should(Equal(limits))
+		})
+
+		Context("when getting the limit fails", func() {
+			disaster := errors.New("oh no!")
+
+			BeforeEach(func() {
+				fakeQuotaManager.GetLimitsError = disaster
+			})
+
+			It("returns the error", func() {
+				limits, err := container.CurrentDiskLimits()
+				Ω(err).Should(Equal(disaster))
+				Ω(limits).Should(BeZero())
+			})
+		})
+	})
+
+	Describe("Getting committed resources", func() {
+		It("returns nothing for a container without limits", func() {
+			Ω(container.CommittedResources()).Should(BeZero())
+		})
+
+		It("returns the limited memory and hard disk limit", func() {
+			err := container.LimitMemory(api.MemoryLimits{LimitInBytes: 1024})
+			Ω(err).ShouldNot(HaveOccurred())
+
+			err = container.LimitDisk(api.DiskLimits{ByteHard: 2048})
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(container.CommittedResources()).Should(Equal(linux_backend.CommittedResources{
+				MemoryInBytes: 1024,
+				DiskInBytes:   2048,
+			}))
+		})
+
+		Context("when the disk is limited in blocks", func() {
+			It("returns the limit in bytes", func() {
+				err := container.LimitDisk(api.DiskLimits{BlockHard: 2})
+				Ω(err).ShouldNot(HaveOccurred())
+
+				Ω(container.CommittedResources().DiskInBytes).Should(Equal(uint64(2 * quota_manager.QUOTA_BLOCK_SIZE)))
+			})
+		})
+	})
+
+	Describe("Net in", func() {
+		It("maps the host port to the container port", func() {
+			hostPort, containerPort, err := container.NetIn(123, 456)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(fakeIPTablesManager.NetInCalls).Should(Equal([][]iptables_manager.NetIn{
+				{
+					{Protocol: "tcp", HostPort: 123, ContainerPort: 456},
+				},
+			}))
+
+			Ω(hostPort).Should(Equal(uint32(123)))
+			Ω(containerPort).Should(Equal(uint32(456)))
+		})
+
+		Context("when the protocol is udp", func() {
+			It("maps the port for udp", func() {
+				_, _, err := container.NetInProtocol(linux_backend.ProtocolUDP, 123, 456)
+				Ω(err).ShouldNot(HaveOccurred())
+
+				Ω(fakeIPTablesManager.NetInCalls).Should(Equal([][]iptables_manager.NetIn{
+					{
+						{Protocol: "udp", HostPort: 123, ContainerPort: 456},
+					},
+				}))
+			})
+
+			It("is reported in the container's info", func() {
+				_, _, err := container.NetInProtocol(linux_backend.ProtocolUDP, 123, 456)
+				Ω(err).ShouldNot(HaveOccurred())
+
+				_, _, err = container.NetIn(789, 1011)
+				Ω(err).ShouldNot(HaveOccurred())
+
+				info, err := container.Info()
+				Ω(err).ShouldNot(HaveOccurred())
+
+				Ω(info.MappedPorts).Should(HaveLen(2))
+				Ω(info.Properties).Should(HaveKeyWithValue("network.udp_ports", "123:456"))
+			})
+		})
+
+		Context("when the protocol is neither tcp nor udp", func() {
+			It("returns an UnsupportedNetInProtocolError without running net.sh", func() {
+				_, _, err := container.NetInProtocol(linux_backend.ProtocolICMP, 123, 456)
+				Ω(err).Should(Equal(linux_backend.UnsupportedNetInProtocolError{
+					Protocol: linux_backend.ProtocolICMP,
+				}))
+
+				Ω(fakeRunner.ExecutedCommands()).Should(BeEmpty())
+			})
+		})
+
+		Context("when a host port is not provided", func() {
+			It("acquires one from the port pool", func() {
+				hostPort, containerPort, err := container.NetIn(0, 456)
+				Ω(err).ShouldNot(HaveOccurred())
+
+				Ω(hostPort).Should(Equal(uint32(1000)))
+				Ω(containerPort).Should(Equal(uint32(456)))
+
+				secondHostPort, _, err := container.NetIn(0, 456)
+				Ω(err).ShouldNot(HaveOccurred())
+
+				Ω(secondHostPort).ShouldNot(Equal(hostPort))
+
+				Ω(container.Resources().Ports).Should(ContainElement(hostPort))
+			})
+
+			Context("and acquiring a port from the pool fails", func() {
+				disaster := errors.New("oh no!")
+
+				BeforeEach(func() {
+					fakePortPool.AcquireError = disaster
+				})
+
+				It("returns the error", func() {
+					_, _, err := container.NetIn(0, 456)
+					Ω(err).Should(Equal(disaster))
+				})
+			})
+		})
+
+		Context("when the host port is reserved", func() {
+			var reservations *fake_linux_backend.FakePortReservations
+
+			BeforeEach(func() {
+				reservations = fake_linux_backend.NewFakePortReservations(1005)
+				container.SetPortReservations(reservations)
+			})
+
+			It("claims the reservation, to release the port when the container is destroyed", func() {
+				hostPort, _, err := container.NetIn(1005, 456)
+				Ω(err).ShouldNot(HaveOccurred())
+				Ω(hostPort).Should(Equal(uint32(1005)))
+
+				Ω(reservations.Reserved).Should(BeEmpty())
+				Ω(container.Resources().Ports).Should(ContainElement(uint32(1005)))
+			})
+
+			It("leaves unreserved host ports out of the container's resources", func() {
+				_, _, err := container.NetIn(123, 456)
+				Ω(err).ShouldNot(HaveOccurred())
+
+				Ω(reservations.Reserved).Should(HaveLen(1))
+				Ω(container.Resources().Ports).ShouldNot(ContainElement(uint32(123)))
+			})
+		})
+
+		Context("when a container port is not provided", func() {
+			It("defaults it to the host port", func() {
+				hostPort, containerPort, err := container.NetIn(123, 0)
+				Ω(err).ShouldNot(HaveOccurred())
+
+				Ω(fakeIPTablesManager.NetInCalls).Should(Equal([][]iptables_manager.NetIn{
+					{
+						{Protocol: "tcp", HostPort: 123, ContainerPort: 123},
+					},
+				}))
+
+				Ω(hostPort).Should(Equal(uint32(123)))
+				Ω(containerPort).Should(Equal(uint32(123)))
+			})
+
+			Context("and a host port is not provided either", func() {
+				It("defaults it to the same acquired port", func() {
+					hostPort, containerPort, err := container.NetIn(0, 0)
+					Ω(err).ShouldNot(HaveOccurred())
+
+					Ω(fakeIPTablesManager.NetInCalls).Should(Equal([][]iptables_manager.NetIn{
+						{
+							{Protocol: "tcp", HostPort: 1000, ContainerPort: 1000},
+						},
+					}))
+
+					Ω(hostPort).Should(Equal(uint32(1000)))
+					Ω(containerPort).Should(Equal(uint32(1000)))
+				})
+			})
+		})
+
+		Context("when applying the mapping fails", func() {
+			disaster := errors.New("oh no!")
+
+			BeforeEach(func() {
+				fakeIPTablesManager.NetInError = disaster
+			})
+
+			It("returns the error", func() {
+				_, _, err := container.NetIn(123, 456)
+				Ω(err).Should(Equal(disaster))
+			})
+		})
+	})
+
+	Describe("Net in range", func() {
+		It("maps the host ports to the same container ports with a single rule", func() {
+			spec, err := container.NetInRange(linux_backend.ProtocolUDP, 6000, 6000, 100)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(fakeIPTablesManager.NetInCalls).Should(Equal([][]iptables_manager.NetIn{
+				{
+					{Protocol: "udp", HostPort: 6000, ContainerPort: 6000, Count: 100},
+				},
+			}))
+
+			Ω(spec).Should(Equal(linux_backend.NetInSpec{
+				HostPort:      6000,
+				ContainerPort: 6000,
+				Protocol:      linux_backend.ProtocolUDP,
+				Count:         100,
+			}))
+		})
+
+		It("reports each port of the range in the container's info", func() {
+			_, err := container.NetInRange(linux_backend.ProtocolUDP, 6000, 0, 3)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			info, err := container.Info()
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(info.MappedPorts).Should(Equal([]api.PortMapping{
+				{HostPort: 6000, ContainerPort: 6000},
+				{HostPort: 6001, ContainerPort: 6001},
+				{HostPort: 6002, ContainerPort: 6002},
+			}))
+
+			Ω(info.Properties).Should(HaveKeyWithValue("network.udp_ports", "6000:6000,6001:6001,6002:6002"))
+		})
+
+		It("is snapshotted", func() {
+			_, err := container.NetInRange(linux_backend.ProtocolTCP, 6000, 6000, 100)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			snapshot := new(bytes.Buffer)
+
+			err = container.Snapshot(snapshot)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			var restored linux_backend.ContainerSnapshot
+
+			err = json.NewDecoder(snapshot).Decode(&restored)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(restored.NetIns).Should(ContainElement(linux_backend.NetInSpec{
+				HostPort:      6000,
+				ContainerPort: 6000,
+				Protocol:      linux_backend.ProtocolTCP,
+				Count:         100,
+			}))
+		})
+
+		Context("when a host port is not provided", func() {
+			It("acquires a contiguous block from the port pool", func() {
+				spec, err := container.NetInRange(linux_backend.ProtocolTCP, 0, 0, 10)
+				Ω(err).ShouldNot(HaveOccurred())
+
+				Ω(spec.HostPort).Should(Equal(uint32(1000)))
+				Ω(spec.ContainerPort).Should(Equal(uint32(1000)))
+
+				Ω(container.Resources().Ports).Should(HaveLen(10))
+				Ω(container.Resources().Ports).Should(ContainElement(uint32(1000)))
+				Ω(container.Resources().Ports).Should(ContainElement(uint32(1009)))
+			})
+
+			Context("and acquiring a block from the pool fails", func() {
+				disaster := errors.New("oh no!")
+
+				BeforeEach(func() {
+					fakePortPool.AcquireRangeError = disaster
+				})
+
+				It("returns the error", func() {
+					_, err := container.NetInRange(linux_backend.ProtocolTCP, 0, 0, 10)
+					Ω(err).Should(Equal(disaster))
+				})
+			})
+		})
+
+		Context("when some of the host ports are reserved", func() {
+			var reservations *fake_linux_backend.FakePortReservations
+
+			BeforeEach(func() {
+				reservations = fake_linux_backend.NewFakePortReservations(1005)
+				container.SetPortReservations(reservations)
+			})
+
+			It("claims the reservations", func() {
+				_, err := container.NetInRange(linux_backend.ProtocolTCP, 1004, 0, 3)
+				Ω(err).ShouldNot(HaveOccurred())
+
+				Ω(reservations.Reserved).Should(BeEmpty())
+				Ω(container.Resources().Ports).Should(Equal([]uint32{1005}))
+			})
+		})
+
+		Context("when the container ports differ from the host ports", func() {
+			It("returns an InvalidNetInRangeError without mapping them", func() {
+				_, err := container.NetInRange(linux_backend.ProtocolTCP, 6000, 7000, 100)
+				Ω(err).Should(BeAssignableToTypeOf(linux_backend.InvalidNetInRangeError{}))
+
+				Ω(fakeIPTablesManager.NetInCalls).Should(BeEmpty())
+			})
+		})
+
+		Context("when the range exceeds the highest port", func() {
+			It("returns an InvalidNetInRangeError", func() {
+				_, err := container.NetInRange(linux_backend.ProtocolTCP, 65500, 0, 100)
+				Ω(err).Should(BeAssignableToTypeOf(linux_backend.InvalidNetInRangeError{}))
+			})
+		})
+	})
+
+	Context("when the container's links are built by a link builder", func() {
+		BeforeEach(func() {
+			container.SetLinkBuilder(&fake_linux_backend.FakeLinkBuilder{})
+		})
+
+		It("refuses net in, rather than mapping nothing", func() {
+			_, _, err := container.NetIn(123, 456)
+			Ω(err).Should(Equal(linux_backend.LinksNotOwnedError{Operation: "net in"}))
+
+			_, err = container.NetInRange(linux_backend.ProtocolTCP, 1000, 0, 10)
+			Ω(err).Should(Equal(linux_backend.LinksNotOwnedError{Operation: "net in"}))
+
+			Ω(fakeIPTablesManager.NetInCalls).Should(BeEmpty())
+			Ω(fakePortPool.Acquired).Should(BeEmpty())
+		})
+
+		It("refuses net out, rather than filtering nothing", func() {
+			err := container.NetOut("1.2.3.4/22", 567)
+			Ω(err).Should(Equal(linux_backend.LinksNotOwnedError{Operation: "net out"}))
+
+			err = container.BulkNetOut([]linux_backend.NetOutRule{{Protocol: linux_backend.ProtocolTCP}})
+			Ω(err).Should(Equal(linux_backend.LinksNotOwnedError{Operation: "net out"}))
+
+			Ω(fakeIPTablesManager.NetOutCalls).Should(BeEmpty())
+		})
+	})
+
+	Describe("Net out", func() {
+		It("allows the network, as a range, on the tcp port", func() {
+			err := container.NetOut("1.2.3.4/22", 567)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(fakeIPTablesManager.NetOutCalls).Should(Equal([][]iptables_manager.NetOut{
+				{
+					{Protocol: "tcp", Network: "1.2.0.0-1.2.3.255", Port: "567"},
+				},
+			}))
+		})
+
+		Context("when port 0 is given", func() {
+			It("allows all protocols", func() {
+				err := container.NetOut("1.2.3.4/22", 0)
+				Ω(err).ShouldNot(HaveOccurred())
+
+				Ω(fakeIPTablesManager.NetOutCalls).Should(Equal([][]iptables_manager.NetOut{
+					{
+						{Protocol: "all", Network: "1.2.0.0-1.2.3.255"},
+					},
+				}))
+			})
+
+			Context("and a network is not given", func() {
+				It("returns an error", func() {
+					err := container.NetOut("", 0)
+					Ω(err).Should(HaveOccurred())
+				})
+			})
+		})
+
+		Context("when the network is not an IP address or CIDR", func() {
+			It("returns an error without applying anything", func() {
+				err := container.NetOut("somehost.example.com", 80)
+				Ω(err).Should(BeAssignableToTypeOf(linux_backend.InvalidNetOutRuleError{}))
+
+				Ω(fakeIPTablesManager.NetOutCalls).Should(BeEmpty())
+			})
+		})
+
+		Describe("with a structured rule", func() {
+			It("applies an entry per network and port range, at once", func() {
+				err := container.AddNetOutRule(linux_backend.NetOutRule{
+					Protocol: linux_backend.ProtocolTCP,
+					Networks: []linux_backend.IPRange{
+						linux_backend.IPRangeFromIP(net.ParseIP("10.0.0.1")),
+						{Start: net.ParseIP("10.0.1.0"), End: net.ParseIP("10.0.1.9")},
+					},
+					Ports: []linux_backend.PortRange{
+						{Start: 8080, End: 8090},
+						linux_backend.PortRangeFromPort(9000),
+					},
+					Log: true,
+				})
+				Ω(err).ShouldNot(HaveOccurred())
+
+				entries := []iptables_manager.NetOut{}
+				for _, network := range []string{"10.0.0.1-10.0.0.1", "10.0.1.0-10.0.1.9"} {
+					for _, port := range []string{"8080:8090", "9000"} {
+						entries = append(entries, iptables_manager.NetOut{
+							Protocol: "tcp",
+							Network:  network,
+							Port:     port,
+							Log:      true,
+						})
+					}
+				}
+
+				Ω(fakeIPTablesManager.NetOutCalls).Should(Equal([][]iptables_manager.NetOut{entries}))
+			})
+
+			It("passes the ICMP type and code for icmp rules", func() {
+				code := linux_backend.ICMPCode(1)
+
+				err := container.AddNetOutRule(linux_backend.NetOutRule{
+					Protocol: linux_backend.ProtocolICMP,
+					ICMPs: &linux_backend.ICMPControl{
+						Type: 3,
+						Code: &code,
+					},
+				})
+				Ω(err).ShouldNot(HaveOccurred())
+
+				Ω(fakeIPTablesManager.NetOutCalls).Should(Equal([][]iptables_manager.NetOut{
+					{
+						{Protocol: "icmp", ICMPType: "3", ICMPCode: "1"},
+					},
+				}))
+			})
+
+			Context("when the rule is invalid", func() {
+				It("returns an error without applying anything", func() {
+					err := container.AddNetOutRule(linux_backend.NetOutRule{
+						Protocol: linux_backend.ProtocolAll,
+						Ports:    []linux_backend.PortRange{{Start: 80, End: 80}},
+					})
+					Ω(err).Should(BeAssignableToTypeOf(linux_backend.InvalidNetOutRuleError{}))
+
+					Ω(fakeIPTablesManager.NetOutCalls).Should(BeEmpty())
+				})
+			})
+		})
+
+		Context("when applying the rule fails", func() {
+			disaster := errors.New("oh no!")
+
+			BeforeEach(func() {
+				fakeIPTablesManager.NetOutError = disaster
+			})
+
+			It("returns the error", func() {
+				err := container.NetOut("1.2.3.4/22", 567)
+				Ω(err).Should(Equal(disaster))
+			})
+		})
+	})
+
+	Describe("Validating the network", func() {
+		It("checks the container's links", func() {
+			err := container.ValidateNetwork()
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(fakeRunner).Should(HaveExecutedSerially(
+				fake_command_runner.CommandSpec{
+					Path: containerDir + "/net.sh",
+					Args: []string{"check_links"},
+				},
+			))
+
+			Ω(container.Events()).ShouldNot(ContainElement("network must be re-erected"))
+		})
+
+		Context("when the links are not intact", func() {
+			disaster := errors.New("oh no!")
+
+			BeforeEach(func() {
+				fakeRunner.WhenRunning(
+					fake_command_runner.CommandSpec{
+						Path: containerDir + "/net.sh",
+						Args: []string{"check_links"},
+					}, func(*exec.Cmd) error {
+						return disaster
+					},
+				)
+			})
+
+			It("returns the error and flags the container with an event", func() {
+				err := container.ValidateNetwork()
+				Ω(err).Should(Equal(disaster))
+
+				Ω(container.Events()).Should(ContainElement("network must be re-erected"))
+			})
+		})
+
+		Context("when its links were built by a link builder", func() {
+			BeforeEach(func() {
+				container.SetLinkBuilder(&fake_linux_backend.FakeLinkBuilder{})
+			})
+
+			It("does not check them", func() {
+				err := container.ValidateNetwork()
+				Ω(err).ShouldNot(HaveOccurred())
+
+				Ω(fakeRunner.ExecutedCommands()).Should(BeEmpty())
+			})
+		})
+	})
+
+	Describe("Verifying that it started", func() {
+		var listener net.Listener
+
+		BeforeEach(func() {
+			var err error
+
+			listener, err = net.Listen("unix", filepath.Join(containerDir, "run", "wshd.sock"))
+			Ω(err).ShouldNot(HaveOccurred())
 		})
 
-		Context("when setting the quota fails", func() {
+		AfterEach(func() {
+			listener.Close()
+		})
+
+		It("checks that the container answers the host over its network", func() {
+			err := container.VerifyStart()
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(fakeRunner).Should(HaveExecutedSerially(
+				fake_command_runner.CommandSpec{
+					Path: containerDir + "/net.sh",
+					Args: []string{"check_gateway"},
+				},
+			))
+		})
+
+		Context("when wshd is not listening", func() {
+			BeforeEach(func() {
+				listener.Close()
+			})
+
+			It("returns a StartVerificationError for the wshd check", func() {
+				err := container.VerifyStart()
+				Ω(err).Should(BeAssignableToTypeOf(linux_backend.StartVerificationError{}))
+				Ω(err.(linux_backend.StartVerificationError).Check).Should(Equal("wshd"))
+
+				Ω(fakeRunner.ExecutedCommands()).Should(BeEmpty())
+			})
+		})
+
+		Context("when the gateway check fails", func() {
 			disaster := errors.New("oh no!")
 
 			BeforeEach(func() {
-				fakeQuotaManager.SetLimitsError = disaster
+				fakeRunner.WhenRunning(
+					fake_command_runner.CommandSpec{
+						Path: containerDir + "/net.sh",
+						Args: []string{"check_gateway"},
+					}, func(*exec.Cmd) error {
+						return disaster
+					},
+				)
 			})
 
-			It("returns the error", func() {
-				err := container.LimitDisk(limits)
-				Ω(err).Should(Equal(disaster))
+			It("returns a StartVerificationError for the gateway check", func() {
+				err := container.VerifyStart()
+				Ω(err).Should(Equal(linux_backend.StartVerificationError{
+					Handle: container.Handle(),
+					Check:  "gateway",
+					Err:    disaster,
+				}))
+			})
+		})
+
+		Context("when its links were built by a link builder", func() {
+			BeforeEach(func() {
+				container.SetLinkBuilder(&fake_linux_backend.FakeLinkBuilder{})
+			})
+
+			It("does not check the gateway", func() {
+				err := container.VerifyStart()
+				Ω(err).ShouldNot(HaveOccurred())
+
+				Ω(fakeRunner.ExecutedCommands()).Should(BeEmpty())
 			})
 		})
 	})
 
-	Describe("Getting the current disk limits", func() {
-		It("returns the disk limits", func() {
-			limits := api.DiskLimits{
-				BlockHard: 1234567,
-			}
+	Describe("Checking the daemon", func() {
+		writePID := func(pid int) {
+			err := ioutil.WriteFile(filepath.Join(containerDir, "run", "wshd.pid"), []byte(fmt.Sprintf("%d\n", pid)), 0644)
+			Ω(err).ShouldNot(HaveOccurred())
+		}
 
-			fakeQuotaManager.GetLimitsResult = limits
+		deadPID := func() int {
+			cmd := exec.Command("true")
 
-			receivedLimits, err := container.CurrentDiskLimits()
+			err := cmd.Run()
 			Ω(err).ShouldNot(HaveOccurred())
-			Ω(receivedLimits).Should(Equal(limits))
+
+			return cmd.Process.Pid
+		}
+
+		Context("when wshd is running", func() {
+			BeforeEach(func() {
+				writePID(os.Getpid())
+			})
+
+			It("returns no error", func() {
+				Ω(container.CheckDaemon()).ShouldNot(HaveOccurred())
+			})
 		})
 
-		Context("when getting the limit fails", func() {
-			disaster := errors.New("oh no!")
+		Context("when wshd has died", func() {
+			var pid int
 
 			BeforeEach(func() {
-				fakeQuotaManager.GetLimitsError = disaster
+				pid = deadPID()
+				writePID(pid)
 			})
 
-			It("returns the error", func() {
-				limits, err := container.CurrentDiskLimits()
-				Ω(err).Should(Equal(disaster))
-				Ω(limits).Should(BeZero())
+			It("returns a DeadDaemonError", func() {
+				Ω(container.CheckDaemon()).Should(Equal(linux_backend.DeadDaemonError{
+					Handle: container.Handle(),
+					PID:    pid,
+				}))
+			})
+
+			Context("but the container is already broken", func() {
+				BeforeEach(func() {
+					container.Break("destroy failed: oh no!")
+				})
+
+				It("returns no error", func() {
+					Ω(container.CheckDaemon()).ShouldNot(HaveOccurred())
+				})
+			})
+		})
+
+		Context("when the pid file is missing", func() {
+			BeforeEach(func() {
+				err := os.Remove(filepath.Join(containerDir, "run", "wshd.pid"))
+				Ω(err).ShouldNot(HaveOccurred())
+			})
+
+			It("returns an error", func() {
+				Ω(container.CheckDaemon()).Should(HaveOccurred())
 			})
 		})
 	})
 
-	Describe("Net in", func() {
-		It("executes net.sh in with HOST_PORT and CONTAINER_PORT", func() {
-			hostPort, containerPort, err := container.NetIn(123, 456)
+	Describe("Reconciling the network", func() {
+		BeforeEach(func() {
+			_, _, err := container.NetIn(1, 2)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			err = container.NetOut("10.0.0.0/24", 80)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			err = container.AddNetOutRule(linux_backend.NetOutRule{
+				Protocol: linux_backend.ProtocolUDP,
+				Ports: []linux_backend.PortRange{
+					linux_backend.PortRangeFromPort(53),
+					linux_backend.PortRangeFromPort(123),
+				},
+				Log: true,
+			})
+			Ω(err).ShouldNot(HaveOccurred())
+		})
+
+		It("checks the rules with the expected number of filter and nat rules", func() {
+			err := container.ReconcileNetwork()
 			Ω(err).ShouldNot(HaveOccurred())
 
 			Ω(fakeRunner).Should(HaveExecutedSerially(
 				fake_command_runner.CommandSpec{
 					Path: containerDir + "/net.sh",
-					Args: []string{"in"},
+					Args: []string{"check"},
 					Env: []string{
-						"HOST_PORT=123",
-						"CONTAINER_PORT=456",
+						"FILTER_RULES=6",
+						"NAT_RULES=1",
 						"PATH=" + os.Getenv("PATH"),
 					},
 				},
 			))
+		})
 
-			Ω(hostPort).Should(Equal(uint32(123)))
-			Ω(containerPort).Should(Equal(uint32(456)))
+		Context("when the rules are intact", func() {
+			It("does not re-install them", func() {
+				before := len(fakeRunner.ExecutedCommands())
+
+				err := container.ReconcileNetwork()
+				Ω(err).ShouldNot(HaveOccurred())
+
+				Ω(fakeRunner.ExecutedCommands()).Should(HaveLen(before + 1))
+				Ω(container.Events()).Should(BeEmpty())
+			})
 		})
 
-		Context("when a host port is not provided", func() {
-			It("acquires one from the port pool", func() {
-				hostPort, containerPort, err := container.NetIn(0, 456)
+		Context("when the rules have drifted", func() {
+			BeforeEach(func() {
+				fakeRunner.WhenRunning(
+					fake_command_runner.CommandSpec{
+						Path: containerDir + "/net.sh",
+						Args: []string{"check"},
+					}, func(*exec.Cmd) error {
+						return errors.New("exit status 1")
+					},
+				)
+			})
+
+			It("re-does network setup and re-installs the net-ins and net-outs", func() {
+				installedIns := []iptables_manager.NetIn{}
+				for _, ins := range fakeIPTablesManager.NetInCalls {
+					installedIns = append(installedIns, ins...)
+				}
+
+				installedOuts := []iptables_manager.NetOut{}
+				for _, outs := range fakeIPTablesManager.NetOutCalls {
+					installedOuts = append(installedOuts, outs...)
+				}
+
+				err := container.ReconcileNetwork()
 				Ω(err).ShouldNot(HaveOccurred())
 
-				Ω(hostPort).Should(Equal(uint32(1000)))
-				Ω(containerPort).Should(Equal(uint32(456)))
+				Ω(fakeRunner).Should(HaveExecutedSerially(
+					fake_command_runner.CommandSpec{
+						Path: containerDir + "/net.sh",
+						Args: []string{"check"},
+					},
+					fake_command_runner.CommandSpec{
+						Path: containerDir + "/net.sh",
+						Args: []string{"setup"},
+					},
+				))
 
-				secondHostPort, _, err := container.NetIn(0, 456)
+				Ω(fakeIPTablesManager.NetInCalls[len(fakeIPTablesManager.NetInCalls)-1]).Should(Equal(installedIns))
+				Ω(fakeIPTablesManager.NetOutCalls[len(fakeIPTablesManager.NetOutCalls)-1]).Should(Equal(installedOuts))
+				Ω(installedOuts).Should(HaveLen(3))
+			})
+
+			It("does not record the rules again", func() {
+				err := container.ReconcileNetwork()
 				Ω(err).ShouldNot(HaveOccurred())
 
-				Ω(secondHostPort).ShouldNot(Equal(hostPort))
+				info, err := container.Info()
+				Ω(err).ShouldNot(HaveOccurred())
 
-				Ω(container.Resources().Ports).Should(ContainElement(hostPort))
+				Ω(info.MappedPorts).Should(HaveLen(1))
 			})
 
-			Context("and acquiring a port from the pool fails", func() {
+			It("registers an event", func() {
+				err := container.ReconcileNetwork()
+				Ω(err).ShouldNot(HaveOccurred())
+
+				Ω(container.Events()).Should(ContainElement("network rules drifted"))
+			})
+
+			Context("and re-doing network setup fails", func() {
 				disaster := errors.New("oh no!")
 
 				BeforeEach(func() {
-					fakePortPool.AcquireError = disaster
+					fakeRunner.WhenRunning(
+						fake_command_runner.CommandSpec{
+							Path: containerDir + "/net.sh",
+							Args: []string{"setup"},
+						}, func(*exec.Cmd) error {
+							return disaster
+						},
+					)
 				})
 
 				It("returns the error", func() {
-					_, _, err := container.NetIn(0, 456)
+					err := container.ReconcileNetwork()
 					Ω(err).Should(Equal(disaster))
 				})
 			})
+
+			Context("and the container is broken", func() {
+				BeforeEach(func() {
+					container.Break("something went wrong")
+				})
+
+				It("leaves its network alone", func() {
+					before := len(fakeRunner.ExecutedCommands())
+
+					err := container.ReconcileNetwork()
+					Ω(err).ShouldNot(HaveOccurred())
+
+					Ω(fakeRunner.ExecutedCommands()).Should(HaveLen(before))
+				})
+			})
+
+			Context("and the container is being destroyed", func() {
+				BeforeEach(func() {
+					container.MarkDestroying()
+				})
+
+				It("leaves its network alone", func() {
+					before := len(fakeRunner.ExecutedCommands())
+
+					err := container.ReconcileNetwork()
+					Ω(err).ShouldNot(HaveOccurred())
+
+					Ω(fakeRunner.ExecutedCommands()).Should(HaveLen(before))
+				})
+			})
+		})
+	})
+
+	Describe("Marking the container as destroying", func() {
+		BeforeEach(func() {
+			container.MarkDestroying()
+		})
+
+		It("refuses to map ports", func() {
+			_, _, err := container.NetIn(1, 2)
+			Ω(err).Should(Equal(linux_backend.DestroyingContainerError{Handle: "some-handle"}))
+
+			Ω(fakeRunner.ExecutedCommands()).Should(BeEmpty())
+		})
+
+		It("refuses to allow traffic out", func() {
+			err := container.NetOut("10.0.0.0/24", 80)
+			Ω(err).Should(Equal(linux_backend.DestroyingContainerError{Handle: "some-handle"}))
+
+			err = container.BulkNetOut([]linux_backend.NetOutRule{
+				{Protocol: linux_backend.ProtocolTCP},
+			})
+			Ω(err).Should(Equal(linux_backend.DestroyingContainerError{Handle: "some-handle"}))
+
+			Ω(fakeIPTablesManager.NetOutCalls).Should(BeEmpty())
+		})
+	})
+
+	Describe("Bulk net out", func() {
+		rules := []linux_backend.NetOutRule{
+			{
+				Protocol: linux_backend.ProtocolTCP,
+				Networks: []linux_backend.IPRange{
+					linux_backend.IPRangeFromIP(net.ParseIP("10.0.0.1")),
+				},
+				Ports: []linux_backend.PortRange{{Start: 8080, End: 8090}},
+			},
+			{
+				Protocol: linux_backend.ProtocolUDP,
+				Ports: []linux_backend.PortRange{
+					linux_backend.PortRangeFromPort(53),
+					linux_backend.PortRangeFromPort(123),
+				},
+				Log: true,
+			},
+		}
+
+		It("applies the rules at once, with an entry per network and port range", func() {
+			err := container.BulkNetOut(rules)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(fakeIPTablesManager.NetOutCalls).Should(Equal([][]iptables_manager.NetOut{
+				{
+					{Protocol: "tcp", Network: "10.0.0.1-10.0.0.1", Port: "8080:8090"},
+					{Protocol: "udp", Port: "53", Log: true},
+					{Protocol: "udp", Port: "123", Log: true},
+				},
+			}))
+
+			Ω(fakeRunner.ExecutedCommands()).Should(BeEmpty())
+		})
+
+		It("records the rules in the snapshot", func() {
+			err := container.BulkNetOut(rules)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			out := new(bytes.Buffer)
+
+			err = container.Snapshot(out)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			var snapshot linux_backend.ContainerSnapshot
+
+			err = json.NewDecoder(out).Decode(&snapshot)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(snapshot.NetOutRules).Should(HaveLen(2))
+			Ω(snapshot.NetOutRules[1].Protocol).Should(Equal(linux_backend.ProtocolUDP))
+		})
+
+		Context("when any rule is invalid", func() {
+			It("returns an error without applying any of the rules", func() {
+				err := container.BulkNetOut(append(rules, linux_backend.NetOutRule{
+					Protocol: linux_backend.ProtocolICMP,
+					Ports:    []linux_backend.PortRange{{Start: 80, End: 80}},
+				}))
+				Ω(err).Should(BeAssignableToTypeOf(linux_backend.InvalidNetOutRuleError{}))
+
+				Ω(fakeIPTablesManager.NetOutCalls).Should(BeEmpty())
+			})
+		})
+
+		Context("when applying the rules fails", func() {
+			disaster := errors.New("oh no!")
+
+			BeforeEach(func() {
+				fakeIPTablesManager.NetOutError = disaster
+			})
+
+			It("returns the error and does not record any of the rules", func() {
+				err := container.BulkNetOut(rules)
+				Ω(err).Should(Equal(disaster))
+
+				out := new(bytes.Buffer)
+
+				err = container.Snapshot(out)
+				Ω(err).ShouldNot(HaveOccurred())
+
+				var snapshot linux_backend.ContainerSnapshot
+
+				err = json.NewDecoder(out).Decode(&snapshot)
+				Ω(err).ShouldNot(HaveOccurred())
+
+				Ω(snapshot.NetOutRules).Should(BeEmpty())
+			})
+		})
+	})
+
+	Describe("Info", func() {
+		It("returns the container's state", func() {
+			info, err := container.Info()
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(info.State).Should(Equal("born"))
+		})
+
+		Context("when the container is broken", func() {
+			BeforeEach(func() {
+				container.Break("destroy failed: oh no!")
+			})
+
+			It("reports it as broken, with the reason as an event", func() {
+				info, err := container.Info()
+				Ω(err).ShouldNot(HaveOccurred())
+
+				Ω(info.State).Should(Equal("broken"))
+				Ω(info.Events).Should(ContainElement("destroy failed: oh no!"))
+			})
+		})
+
+		It("returns the container's events", func() {
+			info, err := container.Info()
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(info.Events).Should(Equal([]string{}))
 		})
 
-		Context("when a container port is not provided", func() {
-			It("defaults it to the host port", func() {
-				hostPort, containerPort, err := container.NetIn(123, 0)
-				Ω(err).ShouldNot(HaveOccurred())
+		It("returns the container's properties", func() {
+			info, err := container.Info()
+			Ω(err).ShouldNot(HaveOccurred())
 
-				Ω(fakeRunner).Should(HaveExecutedSerially(
-					fake_command_runner.CommandSpec{
-						Path: containerDir + "/net.sh",
-						Args: []string{"in"},
-						Env: []string{
-							"HOST_PORT=123",
-							"CONTAINER_PORT=123",
-							"PATH=" + os.Getenv("PATH"),
-						},
-					},
-				))
+			Ω(info.Properties).Should(HaveKeyWithValue("property-name", "property-value"))
+		})
 
-				Ω(hostPort).Should(Equal(uint32(123)))
-				Ω(containerPort).Should(Equal(uint32(123)))
-			})
+		It("returns the container's network info", func() {
+			info, err := container.Info()
+			Ω(err).ShouldNot(HaveOccurred())
 
-			Context("and a host port is not provided either", func() {
-				It("defaults it to the same acquired port", func() {
-					hostPort, containerPort, err := container.NetIn(0, 0)
-					Ω(err).ShouldNot(HaveOccurred())
+			Ω(info.HostIP).Should(Equal("10.254.0.1"))
+			Ω(info.ContainerIP).Should(Equal("10.254.0.2"))
+		})
 
-					Ω(fakeRunner).Should(HaveExecutedSerially(
-						fake_command_runner.CommandSpec{
-							Path: containerDir + "/net.sh",
-							Args: []string{"in"},
-							Env: []string{
-								"HOST_PORT=1000",
-								"CONTAINER_PORT=1000",
-								"PATH=" + os.Getenv("PATH"),
-							},
-						},
-					))
+		It("returns the container's external IP as a property", func() {
+			containerResources.ExternalIP = net.ParseIP("203.0.113.1")
 
-					Ω(hostPort).Should(Equal(uint32(1000)))
-					Ω(containerPort).Should(Equal(uint32(1000)))
-				})
-			})
+			info, err := container.Info()
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(info.Properties).Should(HaveKeyWithValue(linux_backend.ExternalIPProperty, "203.0.113.1"))
 		})
 
-		Context("when net.sh fails", func() {
-			disaster := errors.New("oh no!")
+		It("returns the addresses of the container's additional networks as properties", func() {
+			info, err := container.Info()
+			Ω(err).ShouldNot(HaveOccurred())
 
-			BeforeEach(func() {
-				fakeRunner.WhenRunning(
-					fake_command_runner.CommandSpec{
-						Path: containerDir + "/net.sh",
-					}, func(*exec.Cmd) error {
-						return disaster
-					},
-				)
-			})
+			Ω(info.Properties).Should(HaveKeyWithValue("network.1.host_ip", "10.253.0.1"))
+			Ω(info.Properties).Should(HaveKeyWithValue("network.1.container_ip", "10.253.0.2"))
 
-			It("returns the error", func() {
-				_, _, err := container.NetIn(123, 456)
-				Ω(err).Should(Equal(disaster))
-			})
+			Ω(container.Properties()).ShouldNot(HaveKey("network.1.host_ip"))
 		})
-	})
 
-	Describe("Net out", func() {
-		It("executes net.sh out with NETWORK and PORT", func() {
-			err := container.NetOut("1.2.3.4/22", 567)
+		It("returns the container's subnet, netmask and gateway as properties", func() {
+			info, err := container.Info()
 			Ω(err).ShouldNot(HaveOccurred())
 
-			Ω(fakeRunner).Should(HaveExecutedSerially(
-				fake_command_runner.CommandSpec{
-					Path: containerDir + "/net.sh",
-					Args: []string{"out"},
-					Env: []string{
-						"NETWORK=1.2.3.4/22",
-						"PORT=567",
-						"PATH=" + os.Getenv("PATH"),
-					},
-				},
-			))
+			Ω(info.Properties).Should(HaveKeyWithValue("network.subnet", "10.254.0.0/30"))
+			Ω(info.Properties).Should(HaveKeyWithValue("network.netmask", "255.255.255.252"))
+			Ω(info.Properties).Should(HaveKeyWithValue("network.gateway", "10.254.0.1"))
 
+			Ω(info.Properties).Should(HaveKeyWithValue("network.1.subnet", "10.253.0.0/30"))
+			Ω(info.Properties).Should(HaveKeyWithValue("network.1.netmask", "255.255.255.252"))
 		})
 
-		Context("when port 0 is given", func() {
-			It("executes with PORT as an empty string", func() {
-				err := container.NetOut("1.2.3.4/22", 0)
+		Context("when the container has been set up", func() {
+			BeforeEach(func() {
+				err := os.MkdirAll(filepath.Join(containerDir, "etc"), 0755)
 				Ω(err).ShouldNot(HaveOccurred())
 
-				Ω(fakeRunner).Should(HaveExecutedSerially(
-					fake_command_runner.CommandSpec{
-						Path: containerDir + "/net.sh",
-						Args: []string{"out"},
-						Env: []string{
-							"NETWORK=1.2.3.4/22",
-							"PORT=",
-							"PATH=" + os.Getenv("PATH"),
-						},
-					},
-				))
-
+				err = ioutil.WriteFile(filepath.Join(containerDir, "etc", "config"), []byte(`id=some-id
+network_host_ip=10.254.0.1
+network_host_iface=wsome-id-0
+network_container_ip=10.254.0.2
+network_container_iface=wsome-id-1
+network_attachments="10.253.0.1,10.253.0.2,wsome-id-2,wsome-id-3"
+`), 0644)
+				Ω(err).ShouldNot(HaveOccurred())
 			})
 
-			Context("and a network is not given", func() {
-				It("returns an error", func() {
-					err := container.NetOut("", 0)
-					Ω(err).Should(HaveOccurred())
-				})
+			It("returns the names of the container's interfaces as properties", func() {
+				info, err := container.Info()
+				Ω(err).ShouldNot(HaveOccurred())
+
+				Ω(info.Properties).Should(HaveKeyWithValue("network.host_iface", "wsome-id-0"))
+				Ω(info.Properties).Should(HaveKeyWithValue("network.container_iface", "wsome-id-1"))
+
+				Ω(info.Properties).Should(HaveKeyWithValue("network.1.host_iface", "wsome-id-2"))
+				Ω(info.Properties).Should(HaveKeyWithValue("network.1.container_iface", "wsome-id-3"))
 			})
 		})
 
-		Context("when net.sh fails", func() {
-			disaster := errors.New("oh no!")
+		Context("when the container has not been set up", func() {
+			It("does not return the names of its interfaces", func() {
+				info, err := container.Info()
+				Ω(err).ShouldNot(HaveOccurred())
 
-			BeforeEach(func() {
-				fakeRunner.WhenRunning(
-					fake_command_runner.CommandSpec{
-						Path: containerDir + "/net.sh",
-					}, func(*exec.Cmd) error {
-						return disaster
-					},
-				)
+				Ω(info.Properties).ShouldNot(HaveKey("network.host_iface"))
+				Ω(info.Properties).ShouldNot(HaveKey("network.1.host_iface"))
 			})
+		})
 
-			It("returns the error", func() {
-				err := container.NetOut("1.2.3.4/22", 567)
-				Ω(err).Should(Equal(disaster))
+		It("returns the liveness of probed processes as properties", func() {
+			process := new(wfakes.FakeProcess)
+			process.IDReturns(7)
+			process.WaitStub = func() (int, error) {
+				select {}
+			}
+
+			fakeProcessTracker.ActiveProcessesReturns([]api.Process{process})
+
+			err := container.Probe(7, linux_backend.LivenessProbe{
+				Command:          []string{"/check"},
+				Interval:         time.Hour,
+				Timeout:          time.Second,
+				FailureThreshold: 1,
 			})
-		})
-	})
+			Ω(err).ShouldNot(HaveOccurred())
 
-	Describe("Info", func() {
-		It("returns the container's state", func() {
 			info, err := container.Info()
 			Ω(err).ShouldNot(HaveOccurred())
 
-			Ω(info.State).Should(Equal("born"))
+			Ω(info.Properties).Should(HaveKeyWithValue("process.7.liveness", "healthy"))
+			Ω(info.Properties).Should(HaveKeyWithValue("process.7.liveness_failures", "0"))
 		})
 
-		It("returns the container's events", func() {
+		It("returns the provenance of the container's rootfs as properties", func() {
 			info, err := container.Info()
 			Ω(err).ShouldNot(HaveOccurred())
 
-			Ω(info.Events).Should(Equal([]string{}))
+			Ω(info.Properties).Should(HaveKeyWithValue("rootfs.provider", "docker"))
+			Ω(info.Properties).Should(HaveKeyWithValue("rootfs.image", "some-repo:some-tag"))
+			Ω(info.Properties).Should(HaveKeyWithValue("rootfs.image_id", "some-image-id"))
+			Ω(info.Properties).Should(HaveKeyWithValue("rootfs.layers", "some-image-id,some-parent-id"))
 		})
 
-		It("returns the container's properties", func() {
+		It("returns the container's annotations, and its rootfs provenance, as annotation properties", func() {
 			info, err := container.Info()
 			Ω(err).ShouldNot(HaveOccurred())
 
-			Ω(info.Properties).Should(Equal(container.Properties()))
+			Ω(info.Properties).Should(HaveKeyWithValue("annotation.created_at", "2015-03-04T05:06:07Z"))
+			Ω(info.Properties).Should(HaveKeyWithValue("annotation.garden_version", "some-version"))
+			Ω(info.Properties).Should(HaveKeyWithValue("annotation.rootfs.provider", "docker"))
+			Ω(info.Properties).Should(HaveKeyWithValue("annotation.rootfs.image", "some-repo:some-tag"))
+			Ω(info.Properties).Should(HaveKeyWithValue("annotation.rootfs.image_id", "some-image-id"))
+			Ω(info.Properties).Should(HaveKeyWithValue("annotation.rootfs.layers", "some-image-id,some-parent-id"))
 		})
 
-		It("returns the container's network info", func() {
+		It("returns when the container last started and stopped as annotation properties", func() {
 			info, err := container.Info()
 			Ω(err).ShouldNot(HaveOccurred())
 
-			Ω(info.HostIP).Should(Equal("10.254.0.1"))
-			Ω(info.ContainerIP).Should(Equal("10.254.0.2"))
+			Ω(info.Properties).ShouldNot(HaveKey("annotation.started_at"))
+			Ω(info.Properties).ShouldNot(HaveKey("annotation.stopped_at"))
+
+			err = container.Restore(linux_backend.ContainerSnapshot{
+				State: "stopped",
+				StateTimes: linux_backend.StateTimes{
+					StartedAt: time.Date(2015, time.March, 4, 5, 6, 7, 0, time.UTC),
+					StoppedAt: time.Date(2015, time.March, 5, 6, 7, 8, 0, time.FixedZone("CET", 3600)),
+				},
+			})
+			Ω(err).ShouldNot(HaveOccurred())
+
+			info, err = container.Info()
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(info.Properties).Should(HaveKeyWithValue("annotation.started_at", "2015-03-04T05:06:07Z"))
+			Ω(info.Properties).Should(HaveKeyWithValue("annotation.stopped_at", "2015-03-05T05:07:08Z"))
 		})
 
 		It("returns the container's path", func() {
@@ -2023,6 +4866,48 @@ system 2
 					Ω(err).Should(Equal(disaster))
 				})
 			})
+
+			Context("when the container has its own volume", func() {
+				var fakeVolumeManager *fake_volume_manager.FakeVolumeManager
+
+				BeforeEach(func() {
+					fakeVolumeManager = fake_volume_manager.New()
+					fakeVolumeManager.UsageResult = api.ContainerDiskStat{
+						BytesUsed: 3,
+					}
+
+					container = linux_backend.NewLinuxContainer(
+						lagertest.NewTestLogger("test"),
+						"some-id",
+						"some-handle",
+						containerDir,
+						nil,
+						1*time.Second,
+						containerResources,
+						fakePortPool,
+						fakeRunner,
+						fakeCgroups,
+						fakeQuotaManager,
+						fakeVolumeManager,
+						fakeBandwidthManager,
+						fakeIPTablesManager,
+						fakeProcessTracker,
+						nil,
+						linux_backend.RootFSProvenance{},
+						linux_backend.Annotations{},
+						api.ResourceLimits{},
+					)
+				})
+
+				It("returns the volume's usage", func() {
+					info, err := container.Info()
+					Ω(err).ShouldNot(HaveOccurred())
+
+					Ω(info.DiskStat).Should(Equal(api.ContainerDiskStat{
+						BytesUsed: 3,
+					}))
+				})
+			})
 		})
 
 		Describe("bandwidth info", func() {
@@ -2060,6 +4945,228 @@ system 2
 			})
 		})
 	})
+
+	Describe("Sampling usage", func() {
+		var usage uint64
+		var memoryStatError error
+
+		BeforeEach(func() {
+			usage = 0
+			memoryStatError = nil
+
+			fakeCgroups.WhenGetting("memory", "memory.stat", func() (string, error) {
+				return fmt.Sprintf("rss %d\n", usage*1024), memoryStatError
+			})
+
+			fakeCgroups.WhenGetting("cpuacct", "cpuacct.usage", func() (string, error) {
+				return fmt.Sprintf("%d\n", usage), nil
+			})
+
+			fakeCgroups.WhenGetting("cpuacct", "cpuacct.stat", func() (string, error) {
+				return "user 1\nsystem 2\n", nil
+			})
+		})
+
+		sample := func(keep int) {
+			usage++
+
+			err := container.SampleUsage(keep)
+			Ω(err).ShouldNot(HaveOccurred())
+		}
+
+		usages := func() []uint64 {
+			usages := []uint64{}
+			for _, sample := range container.UsageHistory() {
+				Ω(sample.Memory.Rss).Should(Equal(sample.CPU.Usage * 1024))
+				usages = append(usages, sample.CPU.Usage)
+			}
+
+			return usages
+		}
+
+		It("records the container's CPU and memory usage", func() {
+			before := time.Now()
+			sample(3)
+
+			history := container.UsageHistory()
+			Ω(history).Should(HaveLen(1))
+			Ω(history[0].Time).ShouldNot(BeTemporally("<", before))
+			Ω(history[0].Memory.Rss).Should(Equal(uint64(1024)))
+			Ω(history[0].CPU).Should(Equal(api.ContainerCPUStat{
+				Usage:  1,
+				User:   1,
+				System: 2,
+			}))
+		})
+
+		It("keeps only the latest samples, oldest first", func() {
+			for i := 0; i < 5; i++ {
+				sample(3)
+			}
+
+			Ω(usages()).Should(Equal([]uint64{3, 4, 5}))
+		})
+
+		Context("when the number to keep changes", func() {
+			It("keeps the latest samples that fit", func() {
+				for i := 0; i < 4; i++ {
+					sample(3)
+				}
+
+				sample(2)
+				Ω(usages()).Should(Equal([]uint64{4, 5}))
+
+				sample(4)
+				sample(4)
+				Ω(usages()).Should(Equal([]uint64{4, 5, 6, 7}))
+			})
+		})
+
+		Context("when getting memory.stat fails", func() {
+			disaster := errors.New("oh no!")
+
+			BeforeEach(func() {
+				memoryStatError = disaster
+			})
+
+			It("returns the error and records nothing", func() {
+				err := container.SampleUsage(3)
+				Ω(err).Should(Equal(disaster))
+
+				Ω(container.UsageHistory()).Should(BeEmpty())
+			})
+		})
+	})
+
+	Describe("Summarizing usage", func() {
+		var peakMemoryError error
+		var networkUsage string
+		var networkUsageError error
+
+		BeforeEach(func() {
+			peakMemoryError = nil
+			networkUsage = "4096 5120\n"
+			networkUsageError = nil
+
+			fakeCgroups.WhenGetting("memory", "memory.max_usage_in_bytes", func() (string, error) {
+				return "1024\n", peakMemoryError
+			})
+
+			fakeCgroups.WhenGetting("memory", "memory.usage_in_bytes", func() (string, error) {
+				return "512\n", nil
+			})
+
+			fakeQuotaManager.GetUsageResult = api.ContainerDiskStat{
+				BytesUsed: 8192,
+			}
+
+			fakeCgroups.WhenGetting("cpuacct", "cpuacct.usage", func() (string, error) {
+				return "2000\n", nil
+			})
+
+			fakeCgroups.WhenGetting("blkio", "blkio.throttle.io_service_bytes", func() (string, error) {
+				return "8:0 Read 100\n8:0 Write 1000\n8:0 Sync 50\n8:0 Async 1050\n8:0 Total 1100\n8:16 Read 200\n8:16 Write 2072\n8:16 Total 2272\nTotal 3372\n", nil
+			})
+
+			fakeRunner.WhenRunning(
+				fake_command_runner.CommandSpec{
+					Path: containerDir + "/net.sh",
+					Args: []string{"usage"},
+				}, func(cmd *exec.Cmd) error {
+					if networkUsageError != nil {
+						return networkUsageError
+					}
+
+					_, err := cmd.Stdout.Write([]byte(networkUsage))
+					return err
+				},
+			)
+		})
+
+		It("returns the container's peak and current memory, CPU time, disk usage and writes, and network traffic", func() {
+			summary, err := container.UsageSummary()
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(summary).Should(Equal(linux_backend.UsageSummary{
+				PeakMemoryBytes:      1024,
+				MemoryBytes:          512,
+				DiskBytes:            8192,
+				CPUTime:              2000,
+				DiskBytesWritten:     3072,
+				NetworkBytesReceived: 4096,
+				NetworkBytesSent:     5120,
+			}))
+		})
+
+		Context("when getting the peak memory fails", func() {
+			disaster := errors.New("oh no!")
+
+			BeforeEach(func() {
+				peakMemoryError = disaster
+			})
+
+			It("returns the error", func() {
+				_, err := container.UsageSummary()
+				Ω(err).Should(Equal(disaster))
+			})
+		})
+
+		Context("when getting the disk usage fails", func() {
+			disaster := errors.New("oh no!")
+
+			BeforeEach(func() {
+				fakeQuotaManager.GetUsageError = disaster
+			})
+
+			It("returns the error", func() {
+				_, err := container.UsageSummary()
+				Ω(err).Should(Equal(disaster))
+			})
+		})
+
+		Context("when getting the network usage fails", func() {
+			disaster := errors.New("oh no!")
+
+			BeforeEach(func() {
+				networkUsageError = disaster
+			})
+
+			It("returns the error", func() {
+				_, err := container.UsageSummary()
+				Ω(err).Should(Equal(disaster))
+			})
+		})
+
+		Context("when the network usage is invalid", func() {
+			BeforeEach(func() {
+				networkUsage = "lots\n"
+			})
+
+			It("returns an error", func() {
+				_, err := container.UsageSummary()
+				Ω(err).Should(HaveOccurred())
+			})
+		})
+	})
+})
+
+var _ = Describe("Metric tags", func() {
+	It("are the metric tag properties, keyed without their prefix", func() {
+		Ω(linux_backend.MetricTags(api.Properties{
+			linux_backend.MetricsAppIDProperty:   "some-app",
+			linux_backend.MetricsSpaceIDProperty: "some-space",
+			"metrics.tenant":                     "some-tenant",
+			"network.mtu":                        "1400",
+		})).Should(Equal(map[string]string{
+			"app_id":   "some-app",
+			"space_id": "some-space",
+			"tenant":   "some-tenant",
+		}))
+	})
+
+	It("are nil for a container without any", func() {
+		Ω(linux_backend.MetricTags(api.Properties{"network.mtu": "1400"})).Should(BeNil())
+	})
 })
 
 func uint64ptr(n uint64) *uint64 {
@@ -0,0 +1,215 @@
+package linux_backend
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os/exec"
+	"path"
+	"strconv"
+	"time"
+
+	"github.com/cloudfoundry-incubator/garden/api"
+	"github.com/pivotal-golang/lager"
+
+	"github.com/cloudfoundry-incubator/garden-linux/old/linux_backend/process_tracker"
+)
+
+// LivenessProbe periodically checks a process run in a container, either by
+// running Command in the container as vcap or by connecting to Port on the
+// container's IP. After FailureThreshold consecutive failures an event is
+// registered and, if Restart is set, the process is killed so that its
+// restart policy respawns it.
+type LivenessProbe struct {
+	Command []string
+	Port    uint32
+
+	Interval         time.Duration
+	Timeout          time.Duration
+	FailureThreshold int
+
+	Restart bool
+}
+
+// LivenessStatus is the outcome of a process's liveness probe so far.
+type LivenessStatus struct {
+	Healthy             bool
+	ConsecutiveFailures int
+	LastError           string
+}
+
+func (probe LivenessProbe) Validate() error {
+	if len(probe.Command) == 0 && probe.Port == 0 {
+		return errors.New("liveness probe needs a command or a port")
+	}
+
+	if len(probe.Command) != 0 && probe.Port != 0 {
+		return errors.New("liveness probe cannot have both a command and a port")
+	}
+
+	if probe.Port > 65535 {
+		return fmt.Errorf("liveness probe port out of range: %d", probe.Port)
+	}
+
+	if probe.Interval <= 0 || probe.Timeout <= 0 {
+		return errors.New("liveness probe interval and timeout must be positive")
+	}
+
+	if probe.FailureThreshold < 1 {
+		return errors.New("liveness probe failure threshold must be at least 1")
+	}
+
+	return nil
+}
+
+// Probe starts checking a running process's liveness, until it exits.
+func (c *LinuxContainer) Probe(processID uint32, probe LivenessProbe) error {
+	err := probe.Validate()
+	if err != nil {
+		return err
+	}
+
+	var process api.Process
+	for _, active := range c.processTracker.ActiveProcesses() {
+		if active.ID() == processID {
+			process = active
+			break
+		}
+	}
+
+	if process == nil {
+		return process_tracker.UnknownProcessError{ProcessID: processID}
+	}
+
+	c.probe(process, probe)
+
+	return nil
+}
+
+func (c *LinuxContainer) probe(process api.Process, probe LivenessProbe) {
+	c.setLiveness(process.ID(), LivenessStatus{Healthy: true})
+
+	exited := make(chan struct{})
+	go func() {
+		process.Wait()
+		close(exited)
+	}()
+
+	go c.runProbe(process.ID(), probe, exited)
+}
+
+// LivenessStatuses returns the status of each probed process, by ID.
+func (c *LinuxContainer) LivenessStatuses() map[uint32]LivenessStatus {
+	c.livenessMutex.RLock()
+	defer c.livenessMutex.RUnlock()
+
+	statuses := make(map[uint32]LivenessStatus, len(c.liveness))
+	for processID, status := range c.liveness {
+		statuses[processID] = status
+	}
+
+	return statuses
+}
+
+func (c *LinuxContainer) runProbe(processID uint32, probe LivenessProbe, exited <-chan struct{}) {
+	pLog := c.logger.Session("liveness-probe", lager.Data{
+		"process": processID,
+	})
+
+	ticker := time.NewTicker(probe.Interval)
+	defer ticker.Stop()
+
+	failures := 0
+
+	for {
+		select {
+		case <-exited:
+			c.forgetLiveness(processID)
+			return
+
+		case <-ticker.C:
+		}
+
+		switch c.State() {
+		case StateStopped, StateBroken:
+			continue
+		}
+
+		err := c.checkLiveness(probe)
+		if err == nil {
+			failures = 0
+			c.setLiveness(processID, LivenessStatus{Healthy: true})
+			continue
+		}
+
+		failures++
+
+		pLog.Error("failed", err, lager.Data{"failures": failures})
+
+		c.setLiveness(processID, LivenessStatus{
+			Healthy:             failures < probe.FailureThreshold,
+			ConsecutiveFailures: failures,
+			LastError:           err.Error(),
+		})
+
+		if failures < probe.FailureThreshold {
+			continue
+		}
+
+		c.registerEvent(fmt.Sprintf("process %d failed liveness probe", processID))
+
+		if probe.Restart {
+			err := c.processTracker.Kill(processID)
+			if err != nil {
+				pLog.Error("failed-to-kill", err)
+			}
+		}
+
+		// give a restarted process as long as a new one to come up
+		failures = 0
+	}
+}
+
+func (c *LinuxContainer) checkLiveness(probe LivenessProbe) error {
+	if probe.Port != 0 {
+		addr := net.JoinHostPort(
+			c.resources.Network.ContainerIP().String(),
+			strconv.Itoa(int(probe.Port)),
+		)
+
+		conn, err := net.DialTimeout("tcp", addr, probe.Timeout)
+		if err != nil {
+			return err
+		}
+
+		return conn.Close()
+	}
+
+	check := exec.Command(
+		path.Join(c.path, "bin", "wsh"),
+		append([]string{
+			"--socket", path.Join(c.path, "run", "wshd.sock"),
+			"--user", "vcap",
+		}, probe.Command...)...,
+	)
+
+	return c.runWithTimeout(check, probe.Timeout)
+}
+
+func (c *LinuxContainer) setLiveness(processID uint32, status LivenessStatus) {
+	c.livenessMutex.Lock()
+	defer c.livenessMutex.Unlock()
+
+	if c.liveness == nil {
+		c.liveness = make(map[uint32]LivenessStatus)
+	}
+
+	c.liveness[processID] = status
+}
+
+func (c *LinuxContainer) forgetLiveness(processID uint32) {
+	c.livenessMutex.Lock()
+	defer c.livenessMutex.Unlock()
+
+	delete(c.liveness, processID)
+}
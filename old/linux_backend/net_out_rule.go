@@ -0,0 +1,276 @@
+package linux_backend
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/cloudfoundry-incubator/garden-linux/old/linux_backend/iptables_manager"
+)
+
+type Protocol uint8
+
+const (
+	ProtocolAll Protocol = iota
+	ProtocolTCP
+	ProtocolUDP
+	ProtocolICMP
+)
+
+func (p Protocol) String() string {
+	switch p {
+	case ProtocolTCP:
+		return "tcp"
+	case ProtocolUDP:
+		return "udp"
+	case ProtocolICMP:
+		return "icmp"
+	default:
+		return "all"
+	}
+}
+
+// ParseProtocol parses a protocol as String formats it.
+func ParseProtocol(protocol string) (Protocol, error) {
+	for _, p := range []Protocol{ProtocolAll, ProtocolTCP, ProtocolUDP, ProtocolICMP} {
+		if p.String() == protocol {
+			return p, nil
+		}
+	}
+
+	return ProtocolAll, InvalidNetOutRuleError{"unknown protocol: " + protocol}
+}
+
+// NetOutRule whitelists outbound traffic from a container. Empty Networks or
+// Ports mean any destination address or port respectively.
+type NetOutRule struct {
+	Protocol Protocol
+	Networks []IPRange
+	Ports    []PortRange
+	ICMPs    *ICMPControl
+	Log      bool
+}
+
+type IPRange struct {
+	Start net.IP
+	End   net.IP
+}
+
+type PortRange struct {
+	Start uint16
+	End   uint16
+}
+
+type ICMPControl struct {
+	Type ICMPType
+	Code *ICMPCode
+}
+
+type ICMPType uint8
+type ICMPCode uint8
+
+type InvalidNetOutRuleError struct {
+	Reason string
+}
+
+func (e InvalidNetOutRuleError) Error() string {
+	return "invalid net out rule: " + e.Reason
+}
+
+func IPRangeFromIP(ip net.IP) IPRange {
+	return IPRange{Start: ip, End: ip}
+}
+
+func IPRangeFromIPNet(ipNet *net.IPNet) IPRange {
+	start := ipNet.IP.To4()
+	if start == nil {
+		start = ipNet.IP
+	}
+
+	end := make(net.IP, len(start))
+	for i := range start {
+		end[i] = start[i] | ^ipNet.Mask[i]
+	}
+
+	return IPRange{Start: start, End: end}
+}
+
+func (r IPRange) String() string {
+	return fmt.Sprintf("%s-%s", r.Start, r.End)
+}
+
+// ParseIPRange parses a network in CIDR or IP notation, or a range of IPs,
+// as 10.0.0.1-10.0.0.9.
+func ParseIPRange(network string) (IPRange, error) {
+	segs := strings.SplitN(network, "-", 2)
+	if len(segs) == 1 {
+		return parseNetwork(network)
+	}
+
+	start := net.ParseIP(segs[0])
+	end := net.ParseIP(segs[1])
+	if start == nil || end == nil {
+		return IPRange{}, InvalidNetOutRuleError{"malformed IP range: " + network}
+	}
+
+	return IPRange{Start: start, End: end}, nil
+}
+
+func PortRangeFromPort(port uint16) PortRange {
+	return PortRange{Start: port, End: port}
+}
+
+// ParsePortRange parses a port, or a range of ports, as 8000-9000.
+func ParsePortRange(ports string) (PortRange, error) {
+	segs := strings.SplitN(ports, "-", 2)
+
+	start, err := strconv.ParseUint(segs[0], 10, 16)
+	if err != nil {
+		return PortRange{}, InvalidNetOutRuleError{"malformed port range: " + ports}
+	}
+
+	end := start
+	if len(segs) == 2 {
+		end, err = strconv.ParseUint(segs[1], 10, 16)
+		if err != nil {
+			return PortRange{}, InvalidNetOutRuleError{"malformed port range: " + ports}
+		}
+	}
+
+	return PortRange{Start: uint16(start), End: uint16(end)}, nil
+}
+
+func (r PortRange) String() string {
+	if r.Start == r.End {
+		return fmt.Sprintf("%d", r.Start)
+	}
+
+	return fmt.Sprintf("%d:%d", r.Start, r.End)
+}
+
+// NetOutRuleFromLegacy translates the arguments of the original NetOut call,
+// a network in CIDR or IP notation and a port, into a rule. A port restricts
+// the rule to TCP, as it always has.
+func NetOutRuleFromLegacy(network string, port uint32) (NetOutRule, error) {
+	if network == "" && port == 0 {
+		return NetOutRule{}, InvalidNetOutRuleError{"network and/or port must be provided"}
+	}
+
+	rule := NetOutRule{Protocol: ProtocolAll}
+
+	if network != "" {
+		ipRange, err := parseNetwork(network)
+		if err != nil {
+			return NetOutRule{}, err
+		}
+
+		rule.Networks = []IPRange{ipRange}
+	}
+
+	if port != 0 {
+		if port > 65535 {
+			return NetOutRule{}, InvalidNetOutRuleError{fmt.Sprintf("port out of range: %d", port)}
+		}
+
+		rule.Protocol = ProtocolTCP
+		rule.Ports = []PortRange{PortRangeFromPort(uint16(port))}
+	}
+
+	return rule, nil
+}
+
+func (rule NetOutRule) Validate() error {
+	if rule.Protocol > ProtocolICMP {
+		return InvalidNetOutRuleError{fmt.Sprintf("unknown protocol: %d", rule.Protocol)}
+	}
+
+	if len(rule.Ports) > 0 && rule.Protocol != ProtocolTCP && rule.Protocol != ProtocolUDP {
+		return InvalidNetOutRuleError{"ports may only be given for tcp or udp"}
+	}
+
+	if rule.ICMPs != nil && rule.Protocol != ProtocolICMP {
+		return InvalidNetOutRuleError{"icmp control may only be given for icmp"}
+	}
+
+	for _, r := range rule.Networks {
+		if r.Start.To4() == nil || r.End.To4() == nil {
+			return InvalidNetOutRuleError{"networks must be IPv4 ranges: " + r.String()}
+		}
+	}
+
+	for _, r := range rule.Ports {
+		if r.Start == 0 || r.End < r.Start {
+			return InvalidNetOutRuleError{"invalid port range: " + r.String()}
+		}
+	}
+
+	return nil
+}
+
+// entries are the rule as iptables rules, one per network and port range.
+func (rule NetOutRule) entries() []iptables_manager.NetOut {
+	networks := []string{""}
+	if len(rule.Networks) > 0 {
+		networks = []string{}
+		for _, r := range rule.Networks {
+			networks = append(networks, r.String())
+		}
+	}
+
+	ports := []string{""}
+	if len(rule.Ports) > 0 {
+		ports = []string{}
+		for _, r := range rule.Ports {
+			ports = append(ports, r.String())
+		}
+	}
+
+	icmpType, icmpCode := "", ""
+	if rule.ICMPs != nil {
+		icmpType = fmt.Sprintf("%d", rule.ICMPs.Type)
+
+		if rule.ICMPs.Code != nil {
+			icmpCode = fmt.Sprintf("%d", *rule.ICMPs.Code)
+		}
+	}
+
+	entries := []iptables_manager.NetOut{}
+	for _, network := range networks {
+		for _, port := range ports {
+			entries = append(entries, iptables_manager.NetOut{
+				Protocol: rule.Protocol.String(),
+				Network:  network,
+				Port:     port,
+				ICMPType: icmpType,
+				ICMPCode: icmpCode,
+				Log:      rule.Log,
+			})
+		}
+	}
+
+	return entries
+}
+
+func netOutEntries(rules []NetOutRule) []iptables_manager.NetOut {
+	entries := []iptables_manager.NetOut{}
+	for _, rule := range rules {
+		entries = append(entries, rule.entries()...)
+	}
+
+	return entries
+}
+
+func parseNetwork(network string) (IPRange, error) {
+	_, ipNet, err := net.ParseCIDR(network)
+	if err == nil {
+		return IPRangeFromIPNet(ipNet), nil
+	}
+
+	ip := net.ParseIP(network)
+	if ip != nil {
+		return IPRangeFromIP(ip), nil
+	}
+
+	return IPRange{}, InvalidNetOutRuleError{"network must be an IP address or CIDR: " + network}
+}
@@ -0,0 +1,147 @@
+package linux_backend_test
+
+import (
+	"net"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/cloudfoundry-incubator/garden-linux/old/linux_backend"
+)
+
+var _ = Describe("Net out rules", func() {
+	Describe("translating the legacy network and port", func() {
+		It("converts a CIDR to an IP range", func() {
+			rule, err := linux_backend.NetOutRuleFromLegacy("10.0.0.0/8", 0)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(rule.Protocol).Should(Equal(linux_backend.ProtocolAll))
+			Ω(rule.Networks).Should(HaveLen(1))
+			Ω(rule.Networks[0].String()).Should(Equal("10.0.0.0-10.255.255.255"))
+			Ω(rule.Ports).Should(BeEmpty())
+		})
+
+		It("converts an IP address to a single-address range", func() {
+			rule, err := linux_backend.NetOutRuleFromLegacy("10.0.0.1", 0)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(rule.Networks).Should(Equal([]linux_backend.IPRange{
+				linux_backend.IPRangeFromIP(net.ParseIP("10.0.0.1")),
+			}))
+		})
+
+		It("restricts a port to tcp", func() {
+			rule, err := linux_backend.NetOutRuleFromLegacy("", 8080)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(rule.Protocol).Should(Equal(linux_backend.ProtocolTCP))
+			Ω(rule.Networks).Should(BeEmpty())
+			Ω(rule.Ports).Should(Equal([]linux_backend.PortRange{{Start: 8080, End: 8080}}))
+		})
+
+		It("rejects neither a network nor a port", func() {
+			_, err := linux_backend.NetOutRuleFromLegacy("", 0)
+			Ω(err).Should(HaveOccurred())
+		})
+
+		It("rejects a malformed network", func() {
+			_, err := linux_backend.NetOutRuleFromLegacy("not-a-network", 0)
+			Ω(err).Should(HaveOccurred())
+		})
+
+		It("rejects a port out of range", func() {
+			_, err := linux_backend.NetOutRuleFromLegacy("", 65536)
+			Ω(err).Should(HaveOccurred())
+		})
+	})
+
+	Describe("validating", func() {
+		It("accepts a tcp rule with networks and port ranges", func() {
+			err := linux_backend.NetOutRule{
+				Protocol: linux_backend.ProtocolTCP,
+				Networks: []linux_backend.IPRange{{Start: net.ParseIP("10.0.0.1"), End: net.ParseIP("10.0.0.9")}},
+				Ports:    []linux_backend.PortRange{{Start: 8080, End: 8090}},
+			}.Validate()
+			Ω(err).ShouldNot(HaveOccurred())
+		})
+
+		It("rejects ports for protocols other than tcp and udp", func() {
+			err := linux_backend.NetOutRule{
+				Protocol: linux_backend.ProtocolICMP,
+				Ports:    []linux_backend.PortRange{{Start: 80, End: 80}},
+			}.Validate()
+			Ω(err).Should(HaveOccurred())
+		})
+
+		It("rejects icmp control for protocols other than icmp", func() {
+			err := linux_backend.NetOutRule{
+				Protocol: linux_backend.ProtocolTCP,
+				ICMPs:    &linux_backend.ICMPControl{Type: 8},
+			}.Validate()
+			Ω(err).Should(HaveOccurred())
+		})
+
+		It("rejects inverted port ranges", func() {
+			err := linux_backend.NetOutRule{
+				Protocol: linux_backend.ProtocolUDP,
+				Ports:    []linux_backend.PortRange{{Start: 90, End: 80}},
+			}.Validate()
+			Ω(err).Should(HaveOccurred())
+		})
+
+		It("rejects unknown protocols", func() {
+			err := linux_backend.NetOutRule{Protocol: 42}.Validate()
+			Ω(err).Should(HaveOccurred())
+		})
+	})
+
+	Describe("parsing", func() {
+		It("parses protocols as they are formatted", func() {
+			for _, protocol := range []linux_backend.Protocol{
+				linux_backend.ProtocolAll,
+				linux_backend.ProtocolTCP,
+				linux_backend.ProtocolUDP,
+				linux_backend.ProtocolICMP,
+			} {
+				parsed, err := linux_backend.ParseProtocol(protocol.String())
+				Ω(err).ShouldNot(HaveOccurred())
+				Ω(parsed).Should(Equal(protocol))
+			}
+
+			_, err := linux_backend.ParseProtocol("sctp")
+			Ω(err).Should(Equal(linux_backend.InvalidNetOutRuleError{Reason: "unknown protocol: sctp"}))
+		})
+
+		It("parses networks as CIDRs, IPs or ranges of IPs", func() {
+			ipRange, err := linux_backend.ParseIPRange("10.0.0.0/24")
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(ipRange.String()).Should(Equal("10.0.0.0-10.0.0.255"))
+
+			ipRange, err = linux_backend.ParseIPRange("10.0.0.1")
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(ipRange.String()).Should(Equal("10.0.0.1-10.0.0.1"))
+
+			ipRange, err = linux_backend.ParseIPRange("10.0.0.1-10.0.0.9")
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(ipRange.String()).Should(Equal("10.0.0.1-10.0.0.9"))
+
+			_, err = linux_backend.ParseIPRange("10.0.0.1-")
+			Ω(err).Should(HaveOccurred())
+		})
+
+		It("parses ports or ranges of ports", func() {
+			portRange, err := linux_backend.ParsePortRange("8080")
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(portRange).Should(Equal(linux_backend.PortRange{Start: 8080, End: 8080}))
+
+			portRange, err = linux_backend.ParsePortRange("8000-9000")
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(portRange).Should(Equal(linux_backend.PortRange{Start: 8000, End: 9000}))
+
+			for _, malformed := range []string{"", "http", "8000-", "8000-65536"} {
+				_, err = linux_backend.ParsePortRange(malformed)
+				Ω(err).Should(HaveOccurred())
+			}
+		})
+	})
+})
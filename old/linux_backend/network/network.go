@@ -28,6 +28,12 @@ func (n Network) IP() net.IP {
 	return n.ipNet.IP
 }
 
+func (n Network) Netmask() net.IP {
+	return net.IP(n.ipNet.Mask)
+}
+
+// HostIP is the host's end of the container's veth pair, and so also the
+// container's gateway.
 func (n Network) HostIP() net.IP {
 	return n.hostIP
 }
@@ -0,0 +1,108 @@
+package network
+
+import (
+	"fmt"
+	"net"
+	"strings"
+)
+
+// Spec is a container's requested network, parsed from comma-separated
+// key:value pairs, e.g. "subnet:10.1.0.0/24,ip:10.1.0.5". A bare CIDR or IP,
+// as accepted before keys were, is read as the subnet or IP.
+type Spec struct {
+	Subnet *net.IPNet
+	IP     net.IP
+}
+
+type MalformedSpecError struct {
+	Segment string
+	Reason  string
+}
+
+func (e MalformedSpecError) Error() string {
+	return fmt.Sprintf("malformed network spec %q: %s", e.Segment, e.Reason)
+}
+
+// specKeys parse each key's value into the spec; new kinds of request are
+// added here rather than guessed from the value's shape.
+var specKeys = map[string]func(*Spec, string) error{
+	"subnet": func(spec *Spec, value string) error {
+		_, subnet, err := net.ParseCIDR(value)
+		if err != nil {
+			return err
+		}
+
+		spec.Subnet = subnet
+		return nil
+	},
+
+	"ip": func(spec *Spec, value string) error {
+		ip := net.ParseIP(value)
+		if ip == nil {
+			return fmt.Errorf("not an IP")
+		}
+
+		spec.IP = ip
+		return nil
+	},
+}
+
+// ParseSpec parses a container's requested network. The empty string
+// requests nothing in particular.
+func ParseSpec(spec string) (Spec, error) {
+	parsed := Spec{}
+
+	if spec == "" {
+		return parsed, nil
+	}
+
+	seen := map[string]bool{}
+
+	for _, segment := range strings.Split(spec, ",") {
+		key, value, err := splitSegment(segment)
+		if err != nil {
+			return Spec{}, err
+		}
+
+		parse, found := specKeys[key]
+		if !found {
+			return Spec{}, MalformedSpecError{segment, "unknown key " + key}
+		}
+
+		if seen[key] {
+			return Spec{}, MalformedSpecError{segment, "duplicate key " + key}
+		}
+
+		seen[key] = true
+
+		err = parse(&parsed, value)
+		if err != nil {
+			return Spec{}, MalformedSpecError{segment, err.Error()}
+		}
+	}
+
+	if parsed.Subnet != nil && parsed.IP != nil && !parsed.Subnet.Contains(parsed.IP) {
+		return Spec{}, MalformedSpecError{spec, "ip is not in the subnet"}
+	}
+
+	return parsed, nil
+}
+
+// splitSegment splits key:value, recognizing a bare CIDR or IP, which may
+// itself contain colons if IPv6, by parsing it.
+func splitSegment(segment string) (string, string, error) {
+	if _, _, err := net.ParseCIDR(segment); err == nil {
+		return "subnet", segment, nil
+	}
+
+	if net.ParseIP(segment) != nil {
+		return "ip", segment, nil
+	}
+
+	kv := strings.SplitN(segment, ":", 2)
+	if len(kv) != 2 || kv[0] == "" {
+		return "", "", MalformedSpecError{segment, "expected key:value, a CIDR or an IP"}
+	}
+
+	return kv[0], kv[1], nil
+}
@@ -0,0 +1,93 @@
+package network_test
+
+import (
+	"net"
+
+	. "github.com/cloudfoundry-incubator/garden-linux/old/linux_backend/network"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Parsing network specs", func() {
+	mustParseCIDR := func(cidr string) *net.IPNet {
+		_, ipNet, err := net.ParseCIDR(cidr)
+		Ω(err).ShouldNot(HaveOccurred())
+		return ipNet
+	}
+
+	It("parses nothing from the empty string", func() {
+		spec, err := ParseSpec("")
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(spec).Should(Equal(Spec{}))
+	})
+
+	It("parses a subnet and an IP", func() {
+		spec, err := ParseSpec("subnet:10.1.0.0/24,ip:10.1.0.5")
+		Ω(err).ShouldNot(HaveOccurred())
+
+		Ω(spec.Subnet).Should(Equal(mustParseCIDR("10.1.0.0/24")))
+		Ω(spec.IP.Equal(net.ParseIP("10.1.0.5"))).Should(BeTrue())
+	})
+
+	Describe("bare values", func() {
+		It("reads a CIDR as the subnet", func() {
+			spec, err := ParseSpec("10.1.0.0/24")
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(spec.Subnet).Should(Equal(mustParseCIDR("10.1.0.0/24")))
+		})
+
+		It("reads an IP, even an IPv6 one, as the IP", func() {
+			spec, err := ParseSpec("fd00::5")
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(spec.IP.Equal(net.ParseIP("fd00::5"))).Should(BeTrue())
+		})
+	})
+
+	Context("with an unknown key", func() {
+		It("returns a MalformedSpecError", func() {
+			_, err := ParseSpec("ip:10.1.0.5,fence:macvlan")
+			Ω(err).Should(Equal(MalformedSpecError{
+				Segment: "fence:macvlan",
+				Reason:  "unknown key fence",
+			}))
+		})
+	})
+
+	Context("with a key given twice", func() {
+		It("returns a MalformedSpecError", func() {
+			_, err := ParseSpec("ip:10.1.0.5,10.1.0.6")
+			Ω(err).Should(Equal(MalformedSpecError{
+				Segment: "10.1.0.6",
+				Reason:  "duplicate key ip",
+			}))
+		})
+	})
+
+	Context("with a malformed value", func() {
+		It("returns a MalformedSpecError", func() {
+			_, err := ParseSpec("subnet:10.1.0.0")
+			Ω(err).Should(BeAssignableToTypeOf(MalformedSpecError{}))
+		})
+	})
+
+	Context("with an IP outside the subnet", func() {
+		It("returns a MalformedSpecError", func() {
+			_, err := ParseSpec("subnet:10.1.0.0/24,ip:10.2.0.5")
+			Ω(err).Should(Equal(MalformedSpecError{
+				Segment: "subnet:10.1.0.0/24,ip:10.2.0.5",
+				Reason:  "ip is not in the subnet",
+			}))
+		})
+	})
+
+	Context("with neither a key nor an address", func() {
+		It("returns a MalformedSpecError", func() {
+			_, err := ParseSpec("bogus")
+			Ω(err).Should(Equal(MalformedSpecError{
+				Segment: "bogus",
+				Reason:  "expected key:value, a CIDR or an IP",
+			}))
+		})
+	})
+})
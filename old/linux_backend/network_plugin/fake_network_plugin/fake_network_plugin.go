@@ -0,0 +1,63 @@
+package fake_network_plugin
+
+import (
+	"github.com/pivotal-golang/lager"
+
+	"github.com/cloudfoundry-incubator/garden-linux/old/linux_backend/network_plugin"
+)
+
+type FakeNetworkPlugin struct {
+	BuildError     error
+	ErectError     error
+	RebuildError   error
+	DismantleError error
+
+	Built      []network_plugin.Request
+	Erected    []network_plugin.Request
+	Rebuilt    []network_plugin.Request
+	Dismantled []network_plugin.Request
+}
+
+func New() *FakeNetworkPlugin {
+	return &FakeNetworkPlugin{}
+}
+
+func (p *FakeNetworkPlugin) Build(logger lager.Logger, request network_plugin.Request) error {
+	if p.BuildError != nil {
+		return p.BuildError
+	}
+
+	p.Built = append(p.Built, request)
+
+	return nil
+}
+
+func (p *FakeNetworkPlugin) Erect(logger lager.Logger, request network_plugin.Request) error {
+	if p.ErectError != nil {
+		return p.ErectError
+	}
+
+	p.Erected = append(p.Erected, request)
+
+	return nil
+}
+
+func (p *FakeNetworkPlugin) Rebuild(logger lager.Logger, request network_plugin.Request) error {
+	if p.RebuildError != nil {
+		return p.RebuildError
+	}
+
+	p.Rebuilt = append(p.Rebuilt, request)
+
+	return nil
+}
+
+func (p *FakeNetworkPlugin) Dismantle(logger lager.Logger, request network_plugin.Request) error {
+	if p.DismantleError != nil {
+		return p.DismantleError
+	}
+
+	p.Dismantled = append(p.Dismantled, request)
+
+	return nil
+}
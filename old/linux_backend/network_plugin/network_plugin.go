@@ -0,0 +1,149 @@
+package network_plugin
+
+import (
+	"bytes"
+	"encoding/json"
+	"os/exec"
+
+	"github.com/cloudfoundry/gunk/command_runner"
+	"github.com/pivotal-golang/lager"
+
+	"github.com/cloudfoundry-incubator/garden-linux/old/linux_backend/network"
+	"github.com/cloudfoundry-incubator/garden-linux/old/logging"
+)
+
+// NetworkPlugin lets network integrations act on containers' networks as
+// containers are created (Erect), restored (Rebuild) and destroyed
+// (Dismantle), without being compiled in.
+//
+// Dismantle is also called after Erect fails, to undo whatever it did before
+// failing, so it must tolerate finding the network partly erected.
+//
+// Where the plugin replaces the veth pairs garden-linux would make for each
+// container, Build is called once the container is started, to make its
+// links in the network namespace of the container's PID.
+type NetworkPlugin interface {
+	Build(lager.Logger, Request) error
+	Erect(lager.Logger, Request) error
+	Rebuild(lager.Logger, Request) error
+	Dismantle(lager.Logger, Request) error
+}
+
+type Request struct {
+	ContainerID     string
+	ContainerHandle string
+
+	Network            *network.Network
+	AdditionalNetworks []*network.Network
+
+	// the container's init process, given only to Build
+	PID int `json:",omitempty"`
+}
+
+// ExecPlugin runs a binary as
+//
+//   <path> build|erect|rebuild|dismantle
+//
+// with the Request as JSON on stdin. The binary fails the action by writing
+// a JSON object with a non-empty "Error" to stdout, and optionally a "Cause"
+// (e.g. "address_in_use"), whether or not it exits non-zero, or by exiting
+// non-zero without writing anything.
+type ExecPlugin struct {
+	path string
+
+	runner command_runner.CommandRunner
+}
+
+// Causes plugins may give for failing, so that callers can tell failures
+// apart without parsing messages. Plugins may give others.
+const (
+	CauseAddressInUse   = "address_in_use"
+	CauseInvalidMTU     = "invalid_mtu"
+	CauseNetworkMissing = "network_missing"
+)
+
+type PluginError struct {
+	Action  string
+	Message string
+
+	// as given by the plugin, if at all
+	Cause string
+}
+
+func (e PluginError) Error() string {
+	if e.Cause != "" {
+		return "network plugin failed to " + e.Action + " (" + e.Cause + "): " + e.Message
+	}
+
+	return "network plugin failed to " + e.Action + ": " + e.Message
+}
+
+type response struct {
+	Error string
+	Cause string
+}
+
+func New(path string, runner command_runner.CommandRunner) *ExecPlugin {
+	return &ExecPlugin{
+		path: path,
+
+		runner: runner,
+	}
+}
+
+func (p *ExecPlugin) Build(logger lager.Logger, request Request) error {
+	return p.run(logger, "build", request)
+}
+
+func (p *ExecPlugin) Erect(logger lager.Logger, request Request) error {
+	return p.run(logger, "erect", request)
+}
+
+func (p *ExecPlugin) Rebuild(logger lager.Logger, request Request) error {
+	return p.run(logger, "rebuild", request)
+}
+
+func (p *ExecPlugin) Dismantle(logger lager.Logger, request Request) error {
+	return p.run(logger, "dismantle", request)
+}
+
+func (p *ExecPlugin) run(logger lager.Logger, action string, request Request) error {
+	runner := logging.Runner{
+		CommandRunner: p.runner,
+		Logger:        logger,
+	}
+
+	stdin, err := json.Marshal(request)
+	if err != nil {
+		return err
+	}
+
+	stdout := new(bytes.Buffer)
+
+	plugin := exec.Command(p.path, action)
+	plugin.Stdin = bytes.NewReader(stdin)
+	plugin.Stdout = stdout
+
+	runErr := runner.Run(plugin)
+
+	if stdout.Len() == 0 {
+		return runErr
+	}
+
+	var resp response
+
+	err = json.Unmarshal(stdout.Bytes(), &resp)
+	if err != nil {
+		if runErr != nil {
+			return runErr
+		}
+
+		return PluginError{Action: action, Message: "malformed response: " + err.Error()}
+	}
+
+	if resp.Error != "" {
+		return PluginError{Action: action, Message: resp.Error, Cause: resp.Cause}
+	}
+
+	return runErr
+}
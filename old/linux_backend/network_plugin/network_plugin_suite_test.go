@@ -0,0 +1,13 @@
+package network_plugin_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"testing"
+)
+
+func TestNetwork_plugin(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Network Plugin Suite")
+}
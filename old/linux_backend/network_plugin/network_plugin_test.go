@@ -0,0 +1,232 @@
+package network_plugin_test
+
+import (
+	"encoding/json"
+	"errors"
+	"net"
+	"os/exec"
+
+	"github.com/cloudfoundry/gunk/command_runner/fake_command_runner"
+	. "github.com/cloudfoundry/gunk/command_runner/fake_command_runner/matchers"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/pivotal-golang/lager/lagertest"
+
+	"github.com/cloudfoundry-incubator/garden-linux/old/linux_backend/network"
+	"github.com/cloudfoundry-incubator/garden-linux/old/linux_backend/network_plugin"
+)
+
+var _ = Describe("Exec network plugin", func() {
+	var fakeRunner *fake_command_runner.FakeCommandRunner
+	var plugin *network_plugin.ExecPlugin
+	var request network_plugin.Request
+
+	BeforeEach(func() {
+		fakeRunner = fake_command_runner.New()
+		plugin = network_plugin.New("/path/to/plugin", fakeRunner)
+
+		_, ipNet, err := net.ParseCIDR("10.254.0.0/30")
+		Ω(err).ShouldNot(HaveOccurred())
+
+		request = network_plugin.Request{
+			ContainerID:     "some-id",
+			ContainerHandle: "some-handle",
+			Network:         network.New(ipNet),
+		}
+	})
+
+	actions := map[string]func(network_plugin.Request) error{
+		"build": func(request network_plugin.Request) error {
+			return plugin.Build(lagertest.NewTestLogger("test"), request)
+		},
+		"erect": func(request network_plugin.Request) error {
+			return plugin.Erect(lagertest.NewTestLogger("test"), request)
+		},
+		"rebuild": func(request network_plugin.Request) error {
+			return plugin.Rebuild(lagertest.NewTestLogger("test"), request)
+		},
+		"dismantle": func(request network_plugin.Request) error {
+			return plugin.Dismantle(lagertest.NewTestLogger("test"), request)
+		},
+	}
+
+	for action, perform := range actions {
+		action := action
+		perform := perform
+
+		Describe(action, func() {
+			It("runs the plugin with the request as JSON on stdin", func() {
+				var received network_plugin.Request
+
+				fakeRunner.WhenRunning(
+					fake_command_runner.CommandSpec{
+						Path: "/path/to/plugin",
+						Args: []string{action},
+					}, func(cmd *exec.Cmd) error {
+						return json.NewDecoder(cmd.Stdin).Decode(&received)
+					},
+				)
+
+				err := perform(request)
+				Ω(err).ShouldNot(HaveOccurred())
+
+				Ω(fakeRunner).Should(HaveExecutedSerially(
+					fake_command_runner.CommandSpec{
+						Path: "/path/to/plugin",
+						Args: []string{action},
+					},
+				))
+
+				Ω(received.ContainerID).Should(Equal("some-id"))
+				Ω(received.ContainerHandle).Should(Equal("some-handle"))
+				Ω(received.Network.String()).Should(Equal("10.254.0.0/30"))
+			})
+
+			Context("when the plugin exits non-zero", func() {
+				disaster := errors.New("oh no!")
+
+				BeforeEach(func() {
+					fakeRunner.WhenRunning(
+						fake_command_runner.CommandSpec{
+							Path: "/path/to/plugin",
+						}, func(*exec.Cmd) error {
+							return disaster
+						},
+					)
+				})
+
+				It("returns the error", func() {
+					err := perform(request)
+					Ω(err).Should(Equal(disaster))
+				})
+			})
+
+			Context("when the plugin responds with an error", func() {
+				BeforeEach(func() {
+					fakeRunner.WhenRunning(
+						fake_command_runner.CommandSpec{
+							Path: "/path/to/plugin",
+						}, func(cmd *exec.Cmd) error {
+							_, err := cmd.Stdout.Write([]byte(`{"Error":"no vlan for you"}`))
+							return err
+						},
+					)
+				})
+
+				It("returns a PluginError", func() {
+					err := perform(request)
+					Ω(err).Should(Equal(network_plugin.PluginError{
+						Action:  action,
+						Message: "no vlan for you",
+					}))
+				})
+			})
+
+			Context("when the plugin responds with an error and a cause", func() {
+				BeforeEach(func() {
+					fakeRunner.WhenRunning(
+						fake_command_runner.CommandSpec{
+							Path: "/path/to/plugin",
+						}, func(cmd *exec.Cmd) error {
+							_, err := cmd.Stdout.Write([]byte(`{"Error":"10.254.0.2 is in use","Cause":"address_in_use"}`))
+							return err
+						},
+					)
+				})
+
+				It("returns a PluginError with the cause", func() {
+					err := perform(request)
+					Ω(err).Should(Equal(network_plugin.PluginError{
+						Action:  action,
+						Message: "10.254.0.2 is in use",
+						Cause:   network_plugin.CauseAddressInUse,
+					}))
+
+					Ω(err.Error()).Should(Equal("network plugin failed to " + action + " (address_in_use): 10.254.0.2 is in use"))
+				})
+			})
+
+			Context("when the plugin exits non-zero after responding with an error", func() {
+				BeforeEach(func() {
+					fakeRunner.WhenRunning(
+						fake_command_runner.CommandSpec{
+							Path: "/path/to/plugin",
+						}, func(cmd *exec.Cmd) error {
+							cmd.Stdout.Write([]byte(`{"Error":"mtu 100000 is too large","Cause":"invalid_mtu"}`))
+							return errors.New("exit status 1")
+						},
+					)
+				})
+
+				It("returns the PluginError rather than the exit status", func() {
+					err := perform(request)
+					Ω(err).Should(Equal(network_plugin.PluginError{
+						Action:  action,
+						Message: "mtu 100000 is too large",
+						Cause:   network_plugin.CauseInvalidMTU,
+					}))
+				})
+			})
+
+			Context("when the plugin exits non-zero after writing something other than JSON", func() {
+				disaster := errors.New("exit status 2")
+
+				BeforeEach(func() {
+					fakeRunner.WhenRunning(
+						fake_command_runner.CommandSpec{
+							Path: "/path/to/plugin",
+						}, func(cmd *exec.Cmd) error {
+							cmd.Stdout.Write([]byte(`panic: oh no`))
+							return disaster
+						},
+					)
+				})
+
+				It("returns the exit error", func() {
+					err := perform(request)
+					Ω(err).Should(Equal(disaster))
+				})
+			})
+
+			Context("when the plugin responds with malformed JSON", func() {
+				BeforeEach(func() {
+					fakeRunner.WhenRunning(
+						fake_command_runner.CommandSpec{
+							Path: "/path/to/plugin",
+						}, func(cmd *exec.Cmd) error {
+							_, err := cmd.Stdout.Write([]byte(`{`))
+							return err
+						},
+					)
+				})
+
+				It("returns an error", func() {
+					err := perform(request)
+					Ω(err).Should(HaveOccurred())
+				})
+			})
+		})
+	}
+
+	Describe("build", func() {
+		It("gives the plugin the container's PID", func() {
+			var received network_plugin.Request
+
+			fakeRunner.WhenRunning(
+				fake_command_runner.CommandSpec{
+					Path: "/path/to/plugin",
+					Args: []string{"build"},
+				}, func(cmd *exec.Cmd) error {
+					return json.NewDecoder(cmd.Stdin).Decode(&received)
+				},
+			)
+
+			request.PID = 1234
+
+			err := plugin.Build(lagertest.NewTestLogger("test"), request)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(received.PID).Should(Equal(1234))
+		})
+	})
+})
@@ -0,0 +1,92 @@
+package network_pool
+
+import (
+	"encoding/binary"
+	"sort"
+
+	"github.com/cloudfoundry/dropsonde/metric_sender"
+)
+
+// ReportAllocations has the pool send metrics, named pool.<name>.*, that
+// tell a full pool from one fragmented by networks taken for restored or
+// statically allocated containers:
+//
+// acquire_failures counts acquisitions that found the pool exhausted,
+// static_conflicts counts networks that could not be removed from the pool
+// as they were taken already, and largest_free_block, sent whenever the
+// pool changes, is the most contiguous networks that are free.
+//
+// It must be called before the pool is used.
+func (p *RealNetworkPool) ReportAllocations(sender metric_sender.MetricSender, name string) {
+	p.poolMutex.Lock()
+	defer p.poolMutex.Unlock()
+
+	p.sender = sender
+	p.metricPrefix = "pool." + name + "."
+
+	p.sendLargestFreeBlock()
+}
+
+// LargestFreeBlock returns the most contiguous networks that are free.
+func (p *RealNetworkPool) LargestFreeBlock() int {
+	p.poolMutex.Lock()
+	defer p.poolMutex.Unlock()
+
+	return p.largestFreeBlock()
+}
+
+func (p *RealNetworkPool) largestFreeBlock() int {
+	starts := make([]int, 0, len(p.pool))
+	for _, network := range p.pool {
+		ip := network.IP().To4()
+		if ip == nil {
+			continue
+		}
+
+		starts = append(starts, int(binary.BigEndian.Uint32(ip)))
+	}
+
+	sort.Ints(starts)
+
+	largest := 0
+	block := 0
+	for i, start := range starts {
+		if i > 0 && start == starts[i-1]+4 {
+			block++
+		} else {
+			block = 1
+		}
+
+		if block > largest {
+			largest = block
+		}
+	}
+
+	return largest
+}
+
+// the following must be called with the pool locked
+
+func (p *RealNetworkPool) countAcquireFailure() {
+	if p.sender == nil {
+		return
+	}
+
+	p.sender.IncrementCounter(p.metricPrefix + "acquire_failures")
+}
+
+func (p *RealNetworkPool) countStaticConflicts(conflicts int) {
+	if p.sender == nil {
+		return
+	}
+
+	p.sender.AddToCounter(p.metricPrefix+"static_conflicts", uint64(conflicts))
+}
+
+func (p *RealNetworkPool) sendLargestFreeBlock() {
+	if p.sender == nil {
+		return
+	}
+
+	p.sender.SendValue(p.metricPrefix+"largest_free_block", float64(p.largestFreeBlock()), "count")
+}
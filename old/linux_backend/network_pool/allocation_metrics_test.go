@@ -0,0 +1,93 @@
+package network_pool_test
+
+import (
+	"net"
+
+	"github.com/cloudfoundry/dropsonde/metric_sender/fake"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/cloudfoundry-incubator/garden-linux/old/linux_backend/network"
+	"github.com/cloudfoundry-incubator/garden-linux/old/linux_backend/network_pool"
+)
+
+var _ = Describe("Reporting allocations", func() {
+	var pool *network_pool.RealNetworkPool
+	var fakeMetricSender *fake.FakeMetricSender
+
+	networkFor := func(cidr string) *network.Network {
+		_, ipNet, err := net.ParseCIDR(cidr)
+		Ω(err).ShouldNot(HaveOccurred())
+
+		return network.New(ipNet)
+	}
+
+	BeforeEach(func() {
+		_, ipNet, err := net.ParseCIDR("10.254.0.0/28")
+		Ω(err).ShouldNot(HaveOccurred())
+
+		pool = network_pool.New(ipNet)
+
+		fakeMetricSender = fake.NewFakeMetricSender()
+		pool.ReportAllocations(fakeMetricSender, "network")
+	})
+
+	It("sends the largest free block straight away", func() {
+		Ω(fakeMetricSender.GetValue("pool.network.largest_free_block")).Should(Equal(fake.Metric{Value: 4, Unit: "count"}))
+	})
+
+	It("sends the largest free block as networks are taken and released", func() {
+		err := pool.Remove(networkFor("10.254.0.4/30"))
+		Ω(err).ShouldNot(HaveOccurred())
+
+		Ω(pool.LargestFreeBlock()).Should(Equal(2))
+		Ω(fakeMetricSender.GetValue("pool.network.largest_free_block").Value).Should(Equal(float64(2)))
+
+		acquired, err := pool.Acquire()
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(acquired.String()).Should(Equal("10.254.0.0/30"))
+
+		Ω(fakeMetricSender.GetValue("pool.network.largest_free_block").Value).Should(Equal(float64(2)))
+
+		pool.Release(networkFor("10.254.0.4/30"))
+
+		Ω(fakeMetricSender.GetValue("pool.network.largest_free_block").Value).Should(Equal(float64(3)))
+	})
+
+	It("counts acquisitions that find the pool exhausted", func() {
+		for i := 0; i < 4; i++ {
+			_, err := pool.Acquire()
+			Ω(err).ShouldNot(HaveOccurred())
+		}
+
+		Ω(fakeMetricSender.GetCounter("pool.network.acquire_failures")).Should(BeZero())
+
+		_, err := pool.Acquire()
+		Ω(err).Should(HaveOccurred())
+
+		_, err = pool.Acquire()
+		Ω(err).Should(HaveOccurred())
+
+		Ω(fakeMetricSender.GetCounter("pool.network.acquire_failures")).Should(Equal(uint64(2)))
+		Ω(fakeMetricSender.GetValue("pool.network.largest_free_block").Value).Should(BeZero())
+	})
+
+	It("counts networks that cannot be removed because they are taken", func() {
+		_, err := pool.Acquire()
+		Ω(err).ShouldNot(HaveOccurred())
+
+		err = pool.Remove(networkFor("10.254.0.0/30"))
+		Ω(err).Should(HaveOccurred())
+
+		Ω(fakeMetricSender.GetCounter("pool.network.static_conflicts")).Should(Equal(uint64(1)))
+
+		err = pool.RemoveAll([]*network.Network{
+			networkFor("10.254.0.0/30"),
+			networkFor("10.254.0.4/30"),
+			networkFor("10.254.0.4/30"),
+		})
+		Ω(err).Should(HaveOccurred())
+
+		Ω(fakeMetricSender.GetCounter("pool.network.static_conflicts")).Should(Equal(uint64(3)))
+	})
+})
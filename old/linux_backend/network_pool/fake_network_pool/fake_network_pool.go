@@ -10,10 +10,12 @@ type FakeNetworkPool struct {
 	ipNet       *net.IPNet
 	nextNetwork net.IP
 
-	InitialPoolSize int
+	InitialPoolSize   int
+	AvailablePoolSize int
 
 	AcquireError error
 	RemoveError  error
+	GrowError    error
 
 	Released []string
 	Removed  []string
@@ -31,6 +33,10 @@ func (p *FakeNetworkPool) InitialSize() int {
 	return p.InitialPoolSize
 }
 
+func (p *FakeNetworkPool) Available() int {
+	return p.AvailablePoolSize
+}
+
 func (p *FakeNetworkPool) Acquire() (*network.Network, error) {
 	if p.AcquireError != nil {
 		return nil, p.AcquireError
@@ -59,10 +65,32 @@ func (p *FakeNetworkPool) Remove(network *network.Network) error {
 	return nil
 }
 
+func (p *FakeNetworkPool) RemoveAll(networks []*network.Network) error {
+	if p.RemoveError != nil {
+		return p.RemoveError
+	}
+
+	for _, network := range networks {
+		p.Removed = append(p.Removed, network.String())
+	}
+
+	return nil
+}
+
 func (p *FakeNetworkPool) Release(network *network.Network) {
 	p.Released = append(p.Released, network.String())
 }
 
+func (p *FakeNetworkPool) Grow(ipNet *net.IPNet) error {
+	if p.GrowError != nil {
+		return p.GrowError
+	}
+
+	p.ipNet = ipNet
+
+	return nil
+}
+
 func (p *FakeNetworkPool) Network() *net.IPNet {
 	return p.ipNet
 }
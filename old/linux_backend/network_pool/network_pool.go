@@ -2,8 +2,12 @@ package network_pool
 
 import (
 	"fmt"
+	"math/rand"
 	"net"
 	"sync"
+	"time"
+
+	"github.com/cloudfoundry/dropsonde/metric_sender"
 
 	"github.com/cloudfoundry-incubator/garden-linux/old/linux_backend/network"
 )
@@ -12,16 +16,57 @@ type NetworkPool interface {
 	Acquire() (*network.Network, error)
 	Release(*network.Network)
 	Remove(*network.Network) error
+	RemoveAll([]*network.Network) error
+	Grow(*net.IPNet) error
 	Network() *net.IPNet
 	InitialSize() int
+	Available() int
+}
+
+// AllocationStrategy decides which free network is acquired next.
+type AllocationStrategy string
+
+const (
+	// LeastRecentlyUsed acquires the network that has been free the longest,
+	// giving stale ARP and conntrack entries for it the most time to expire
+	LeastRecentlyUsed AllocationStrategy = "lru"
+
+	// Random acquires any free network
+	Random AllocationStrategy = "random"
+)
+
+type UnknownAllocationStrategyError struct {
+	Strategy string
+}
+
+func (e UnknownAllocationStrategyError) Error() string {
+	return fmt.Sprintf("unknown network allocation strategy: %s", e.Strategy)
+}
+
+func ParseAllocationStrategy(strategy string) (AllocationStrategy, error) {
+	switch AllocationStrategy(strategy) {
+	case LeastRecentlyUsed, Random:
+		return AllocationStrategy(strategy), nil
+	default:
+		return "", UnknownAllocationStrategyError{strategy}
+	}
 }
 
 type RealNetworkPool struct {
 	ipNet *net.IPNet
 
+	strategy AllocationStrategy
+	random   *rand.Rand
+
 	pool            []*network.Network
 	poolMutex       *sync.Mutex
 	initialPoolSize int
+
+	reserved []*net.IPNet
+
+	// set by ReportAllocations
+	sender       metric_sender.MetricSender
+	metricPrefix string
 }
 
 type PoolExhaustedError struct{}
@@ -38,7 +83,35 @@ func (e NetworkTakenError) Error() string {
 	return fmt.Sprintf("network already acquired: %s", e.Network.String())
 }
 
+// NetworksTakenError reports every network that could not be removed in a
+// RemoveAll
+type NetworksTakenError struct {
+	Networks []*network.Network
+}
+
+func (e NetworksTakenError) Error() string {
+	networks := []string{}
+	for _, network := range e.Networks {
+		networks = append(networks, network.String())
+	}
+
+	return fmt.Sprintf("networks already acquired: %v", networks)
+}
+
+type CannotShrinkError struct {
+	Network    *net.IPNet
+	NewNetwork *net.IPNet
+}
+
+func (e CannotShrinkError) Error() string {
+	return fmt.Sprintf("network pool %s cannot become %s, which does not contain it", e.Network, e.NewNetwork)
+}
+
 func New(ipNet *net.IPNet) *RealNetworkPool {
+	return NewWithStrategy(ipNet, LeastRecentlyUsed)
+}
+
+func NewWithStrategy(ipNet *net.IPNet, strategy AllocationStrategy) *RealNetworkPool {
 	pool := []*network.Network{}
 
 	_, startNet, err := net.ParseCIDR(ipNet.IP.String() + "/30")
@@ -53,6 +126,9 @@ func New(ipNet *net.IPNet) *RealNetworkPool {
 	return &RealNetworkPool{
 		ipNet: ipNet,
 
+		strategy: strategy,
+		random:   rand.New(rand.NewSource(time.Now().UnixNano())),
+
 		pool:            pool,
 		poolMutex:       new(sync.Mutex),
 		initialPoolSize: len(pool),
@@ -64,11 +140,19 @@ func (p *RealNetworkPool) Acquire() (*network.Network, error) {
 	defer p.poolMutex.Unlock()
 
 	if len(p.pool) == 0 {
+		p.countAcquireFailure()
 		return nil, PoolExhaustedError{}
 	}
 
-	acquired := p.pool[0]
-	p.pool = p.pool[1:]
+	idx := 0
+	if p.strategy == Random {
+		idx = p.random.Intn(len(p.pool))
+	}
+
+	acquired := p.pool[idx]
+	p.pool = append(p.pool[:idx], p.pool[idx+1:]...)
+
+	p.sendLargestFreeBlock()
 
 	return acquired, nil
 }
@@ -89,33 +173,183 @@ func (p *RealNetworkPool) Remove(network *network.Network) error {
 	}
 
 	if !found {
+		// containers restored onto since-reserved networks keep them
+		if p.isReserved(network) {
+			return nil
+		}
+
+		p.countStaticConflicts(1)
+
 		return NetworkTakenError{network}
 	}
 
 	p.pool = append(p.pool[:idx], p.pool[idx+1:]...)
 
+	p.sendLargestFreeBlock()
+
+	return nil
+}
+
+// RemoveAll removes many networks in one pass, as when restoring
+// containers. If any of them is taken, or given twice, none are removed.
+func (p *RealNetworkPool) RemoveAll(networks []*network.Network) error {
+	p.poolMutex.Lock()
+	defer p.poolMutex.Unlock()
+
+	available := map[string]bool{}
+	for _, network := range p.pool {
+		available[network.String()] = true
+	}
+
+	taken := []*network.Network{}
+	for _, network := range networks {
+		if !available[network.String()] {
+			// containers restored onto since-reserved networks keep them
+			if !p.isReserved(network) {
+				taken = append(taken, network)
+			}
+
+			continue
+		}
+
+		delete(available, network.String())
+	}
+
+	if len(taken) > 0 {
+		p.countStaticConflicts(len(taken))
+		return NetworksTakenError{taken}
+	}
+
+	pool := make([]*network.Network, 0, len(available))
+	for _, network := range p.pool {
+		if available[network.String()] {
+			pool = append(pool, network)
+		}
+	}
+
+	p.pool = pool
+
+	p.sendLargestFreeBlock()
+
 	return nil
 }
 
 func (p *RealNetworkPool) Release(network *network.Network) {
+	p.poolMutex.Lock()
+	defer p.poolMutex.Unlock()
+
 	if !p.ipNet.Contains(network.IP()) {
 		return
 	}
 
+	if p.isReserved(network) {
+		return
+	}
+
+	p.pool = append(p.pool, network)
+
+	p.sendLargestFreeBlock()
+}
+
+// Reserve permanently takes every network overlapping reserved out of the
+// pool, e.g. for addresses used by host services, shrinking its initial size.
+// Networks already acquired are left to their containers, but not returned
+// to the pool on release.
+func (p *RealNetworkPool) Reserve(reserved *net.IPNet) {
 	p.poolMutex.Lock()
 	defer p.poolMutex.Unlock()
 
-	p.pool = append(p.pool, network)
+	p.reserved = append(p.reserved, reserved)
+
+	pool := []*network.Network{}
+	for _, network := range p.pool {
+		if p.isReserved(network) {
+			p.initialPoolSize--
+			continue
+		}
+
+		pool = append(pool, network)
+	}
+
+	p.pool = pool
+
+	p.sendLargestFreeBlock()
+}
+
+func (p *RealNetworkPool) isReserved(network *network.Network) bool {
+	_, ipNet, err := net.ParseCIDR(network.String())
+	if err != nil {
+		return false
+	}
+
+	for _, reserved := range p.reserved {
+		if reserved.Contains(ipNet.IP) || ipNet.Contains(reserved.IP) {
+			return true
+		}
+	}
+
+	return false
 }
 
 func (p *RealNetworkPool) InitialSize() int {
 	return p.initialPoolSize
 }
 
+// Available returns how many networks can still be acquired.
+func (p *RealNetworkPool) Available() int {
+	p.poolMutex.Lock()
+	defer p.poolMutex.Unlock()
+
+	return len(p.pool)
+}
+
 func (p *RealNetworkPool) Network() *net.IPNet {
+	p.poolMutex.Lock()
+	defer p.poolMutex.Unlock()
+
 	return p.ipNet
 }
 
+// Grow extends the pool to a larger network containing its current one,
+// adding the new subnets that are not reserved. Networks already acquired
+// are undisturbed.
+func (p *RealNetworkPool) Grow(ipNet *net.IPNet) error {
+	p.poolMutex.Lock()
+	defer p.poolMutex.Unlock()
+
+	ones, _ := p.ipNet.Mask.Size()
+	newOnes, _ := ipNet.Mask.Size()
+
+	if newOnes > ones || !ipNet.Contains(p.ipNet.IP) {
+		return CannotShrinkError{p.ipNet, ipNet}
+	}
+
+	_, startNet, err := net.ParseCIDR(ipNet.IP.String() + "/30")
+	if err != nil {
+		return err
+	}
+
+	for subnet := startNet; ipNet.Contains(subnet.IP); subnet = nextSubnet(subnet) {
+		if p.ipNet.Contains(subnet.IP) {
+			continue
+		}
+
+		network := network.New(subnet)
+		if p.isReserved(network) {
+			continue
+		}
+
+		p.pool = append(p.pool, network)
+		p.initialPoolSize++
+	}
+
+	p.ipNet = ipNet
+
+	p.sendLargestFreeBlock()
+
+	return nil
+}
+
 func nextSubnet(ipNet *net.IPNet) *net.IPNet {
 	next := net.ParseIP(ipNet.IP.String())
 
@@ -75,6 +75,47 @@ var _ = Describe("Network Pool", func() {
 		})
 	})
 
+	Describe("removing many", func() {
+		It("acquires all of the networks from the pool", func() {
+			_, ipNet1, err := net.ParseCIDR("10.254.0.0/30")
+			Ω(err).ShouldNot(HaveOccurred())
+
+			_, ipNet2, err := net.ParseCIDR("10.254.0.4/30")
+			Ω(err).ShouldNot(HaveOccurred())
+
+			err = pool.RemoveAll([]*network.Network{network.New(ipNet1), network.New(ipNet2)})
+			Ω(err).ShouldNot(HaveOccurred())
+
+			for i := 0; i < (256 - 2); i++ {
+				network, err := pool.Acquire()
+				Ω(err).ShouldNot(HaveOccurred())
+				Ω(network.String()).ShouldNot(Equal("10.254.0.0/30"))
+				Ω(network.String()).ShouldNot(Equal("10.254.0.4/30"))
+			}
+
+			_, err = pool.Acquire()
+			Ω(err).Should(HaveOccurred())
+		})
+
+		Context("when some are already acquired", func() {
+			It("reports them all and removes none", func() {
+				acquired, err := pool.Acquire()
+				Ω(err).ShouldNot(HaveOccurred())
+
+				_, ipNet, err := net.ParseCIDR("10.254.0.8/30")
+				Ω(err).ShouldNot(HaveOccurred())
+
+				free := network.New(ipNet)
+
+				err = pool.RemoveAll([]*network.Network{acquired, free})
+				Ω(err).Should(Equal(network_pool.NetworksTakenError{Networks: []*network.Network{acquired}}))
+
+				err = pool.Remove(free)
+				Ω(err).ShouldNot(HaveOccurred())
+			})
+		})
+	})
+
 	Describe("releasing", func() {
 		It("places a network back and the end of the pool", func() {
 			first, err := pool.Acquire()
@@ -116,6 +157,207 @@ var _ = Describe("Network Pool", func() {
 		})
 	})
 
+	Describe("acquiring randomly", func() {
+		BeforeEach(func() {
+			_, ipNet, err := net.ParseCIDR("10.254.0.0/28")
+			Ω(err).ShouldNot(HaveOccurred())
+
+			pool = network_pool.NewWithStrategy(ipNet, network_pool.Random)
+		})
+
+		It("takes each network in the pool exactly once", func() {
+			acquired := []string{}
+
+			for i := 0; i < 4; i++ {
+				network, err := pool.Acquire()
+				Ω(err).ShouldNot(HaveOccurred())
+
+				acquired = append(acquired, network.String())
+			}
+
+			Ω(acquired).Should(ConsistOf(
+				"10.254.0.0/30",
+				"10.254.0.4/30",
+				"10.254.0.8/30",
+				"10.254.0.12/30",
+			))
+
+			_, err := pool.Acquire()
+			Ω(err).Should(Equal(network_pool.PoolExhaustedError{}))
+		})
+	})
+
+	Describe("parsing an allocation strategy", func() {
+		It("accepts lru and random", func() {
+			strategy, err := network_pool.ParseAllocationStrategy("lru")
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(strategy).Should(Equal(network_pool.LeastRecentlyUsed))
+
+			strategy, err = network_pool.ParseAllocationStrategy("random")
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(strategy).Should(Equal(network_pool.Random))
+		})
+
+		It("rejects anything else", func() {
+			_, err := network_pool.ParseAllocationStrategy("first-fit")
+			Ω(err).Should(Equal(network_pool.UnknownAllocationStrategyError{Strategy: "first-fit"}))
+		})
+	})
+
+	Describe("growing", func() {
+		BeforeEach(func() {
+			_, ipNet, err := net.ParseCIDR("10.254.0.0/29")
+			Ω(err).ShouldNot(HaveOccurred())
+
+			pool = network_pool.New(ipNet)
+		})
+
+		It("adds the new subnets to the pool", func() {
+			_, grown, err := net.ParseCIDR("10.254.0.0/28")
+			Ω(err).ShouldNot(HaveOccurred())
+
+			err = pool.Grow(grown)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(pool.Network()).Should(Equal(grown))
+			Ω(pool.InitialSize()).Should(Equal(4))
+
+			acquired := []string{}
+			for i := 0; i < 4; i++ {
+				network, err := pool.Acquire()
+				Ω(err).ShouldNot(HaveOccurred())
+
+				acquired = append(acquired, network.String())
+			}
+
+			Ω(acquired).Should(ConsistOf(
+				"10.254.0.0/30",
+				"10.254.0.4/30",
+				"10.254.0.8/30",
+				"10.254.0.12/30",
+			))
+		})
+
+		It("leaves acquired networks with their containers", func() {
+			_, err := pool.Acquire()
+			Ω(err).ShouldNot(HaveOccurred())
+
+			_, grown, err := net.ParseCIDR("10.254.0.0/28")
+			Ω(err).ShouldNot(HaveOccurred())
+
+			err = pool.Grow(grown)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(pool.Available()).Should(Equal(3))
+		})
+
+		It("does not add reserved subnets", func() {
+			_, reserved, err := net.ParseCIDR("10.254.0.8/30")
+			Ω(err).ShouldNot(HaveOccurred())
+
+			pool.Reserve(reserved)
+
+			_, grown, err := net.ParseCIDR("10.254.0.0/28")
+			Ω(err).ShouldNot(HaveOccurred())
+
+			err = pool.Grow(grown)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(pool.InitialSize()).Should(Equal(3))
+		})
+
+		Context("when the new network does not contain the pool's", func() {
+			It("returns a CannotShrinkError", func() {
+				_, other, err := net.ParseCIDR("10.253.0.0/28")
+				Ω(err).ShouldNot(HaveOccurred())
+
+				err = pool.Grow(other)
+				Ω(err).Should(Equal(network_pool.CannotShrinkError{
+					Network:    pool.Network(),
+					NewNetwork: other,
+				}))
+
+				Ω(pool.InitialSize()).Should(Equal(2))
+			})
+		})
+	})
+
+	Describe("reserving", func() {
+		BeforeEach(func() {
+			_, ipNet, err := net.ParseCIDR("10.254.0.0/28")
+			Ω(err).ShouldNot(HaveOccurred())
+
+			pool = network_pool.New(ipNet)
+		})
+
+		It("never hands out networks overlapping the reserved network", func() {
+			_, reserved, err := net.ParseCIDR("10.254.0.5/32")
+			Ω(err).ShouldNot(HaveOccurred())
+
+			pool.Reserve(reserved)
+
+			acquired := []string{}
+			for i := 0; i < 3; i++ {
+				network, err := pool.Acquire()
+				Ω(err).ShouldNot(HaveOccurred())
+
+				acquired = append(acquired, network.String())
+			}
+
+			Ω(acquired).Should(Equal([]string{
+				"10.254.0.0/30",
+				"10.254.0.8/30",
+				"10.254.0.12/30",
+			}))
+
+			_, err = pool.Acquire()
+			Ω(err).Should(Equal(network_pool.PoolExhaustedError{}))
+		})
+
+		It("excludes networks within a larger reserved network", func() {
+			_, reserved, err := net.ParseCIDR("10.254.0.8/29")
+			Ω(err).ShouldNot(HaveOccurred())
+
+			pool.Reserve(reserved)
+
+			Ω(pool.InitialSize()).Should(Equal(2))
+		})
+
+		Context("when a container is restored onto a reserved network", func() {
+			It("lets it keep the network", func() {
+				_, reserved, err := net.ParseCIDR("10.254.0.4/30")
+				Ω(err).ShouldNot(HaveOccurred())
+
+				pool.Reserve(reserved)
+
+				err = pool.Remove(network.New(reserved))
+				Ω(err).ShouldNot(HaveOccurred())
+			})
+		})
+
+		Context("when a reserved network was already acquired", func() {
+			It("is not returned to the pool on release", func() {
+				acquired, err := pool.Acquire()
+				Ω(err).ShouldNot(HaveOccurred())
+
+				_, reserved, err := net.ParseCIDR(acquired.String())
+				Ω(err).ShouldNot(HaveOccurred())
+
+				pool.Reserve(reserved)
+				pool.Release(acquired)
+
+				for i := 0; i < 3; i++ {
+					network, err := pool.Acquire()
+					Ω(err).ShouldNot(HaveOccurred())
+					Ω(network.String()).ShouldNot(Equal(acquired.String()))
+				}
+
+				_, err = pool.Acquire()
+				Ω(err).Should(HaveOccurred())
+			})
+		})
+	})
+
 	Describe("InitialSize", func() {
 		It("returns the count of maximum available networks", func() {
 			Ω(pool.InitialSize()).Should(Equal(256))
@@ -125,6 +367,19 @@ var _ = Describe("Network Pool", func() {
 		})
 	})
 
+	Describe("Available", func() {
+		It("returns the count of networks that can still be acquired", func() {
+			Ω(pool.Available()).Should(Equal(256))
+
+			network, err := pool.Acquire()
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(pool.Available()).Should(Equal(255))
+
+			pool.Release(network)
+			Ω(pool.Available()).Should(Equal(256))
+		})
+	})
+
 	Describe("getting the network", func() {
 		It("returns the network's *net.IPNet", func() {
 			Ω(pool.Network().String()).Should(Equal("10.254.0.0/22"))
@@ -0,0 +1,141 @@
+package network_pool
+
+import (
+	"sync"
+	"time"
+
+	"github.com/cloudfoundry/dropsonde/metric_sender"
+	"github.com/pivotal-golang/lager"
+
+	"github.com/cloudfoundry-incubator/garden-linux/old/linux_backend/network"
+)
+
+// WaitingNetworkPool queues acquisitions from an exhausted pool until a
+// network is released or the timeout passes, smoothing over destroys and
+// creates that race each other.
+type WaitingNetworkPool struct {
+	NetworkPool
+
+	logger  lager.Logger
+	timeout time.Duration
+
+	released      chan struct{}
+	releasedMutex *sync.Mutex
+
+	stats      WaitStats
+	statsMutex *sync.Mutex
+}
+
+type WaitStats struct {
+	// Waits counts acquisitions that found the pool exhausted
+	Waits uint64
+
+	// Timeouts counts acquisitions that gave up waiting
+	Timeouts uint64
+
+	// WaitTime is the total time spent waiting, including timed out waits
+	WaitTime time.Duration
+}
+
+func NewWaiting(logger lager.Logger, pool NetworkPool, timeout time.Duration) *WaitingNetworkPool {
+	return &WaitingNetworkPool{
+		NetworkPool: pool,
+
+		logger:  logger.Session("network-pool"),
+		timeout: timeout,
+
+		released:      make(chan struct{}),
+		releasedMutex: new(sync.Mutex),
+
+		statsMutex: new(sync.Mutex),
+	}
+}
+
+func (p *WaitingNetworkPool) Acquire() (*network.Network, error) {
+	var waitStarted time.Time
+	var deadline <-chan time.Time
+
+	for {
+		// taken before acquiring, so that a release in between is not missed
+		released := p.releasedSignal()
+
+		network, err := p.NetworkPool.Acquire()
+		if _, exhausted := err.(PoolExhaustedError); !exhausted {
+			if deadline != nil {
+				p.recordWait(waitStarted, false)
+
+				p.logger.Info("acquired-after-waiting", lager.Data{
+					"waited": time.Since(waitStarted).String(),
+				})
+			}
+
+			return network, err
+		}
+
+		if deadline == nil {
+			waitStarted = time.Now()
+			deadline = time.After(p.timeout)
+
+			p.logger.Info("waiting-for-network", lager.Data{
+				"timeout": p.timeout.String(),
+			})
+		}
+
+		select {
+		case <-released:
+		case <-deadline:
+			p.recordWait(waitStarted, true)
+
+			p.logger.Error("timed-out-waiting-for-network", err)
+
+			return nil, err
+		}
+	}
+}
+
+func (p *WaitingNetworkPool) Release(network *network.Network) {
+	p.NetworkPool.Release(network)
+
+	p.releasedMutex.Lock()
+	close(p.released)
+	p.released = make(chan struct{})
+	p.releasedMutex.Unlock()
+}
+
+func (p *WaitingNetworkPool) Stats() WaitStats {
+	p.statsMutex.Lock()
+	defer p.statsMutex.Unlock()
+
+	return p.stats
+}
+
+// ReportWaits sends the waits so far as metrics named after the pool, e.g.
+// pool.network.waits, alongside its utilization.
+func (p *WaitingNetworkPool) ReportWaits(sender metric_sender.MetricSender, name string) {
+	stats := p.Stats()
+
+	prefix := "pool." + name + "."
+
+	sender.SendValue(prefix+"waits", float64(stats.Waits), "count")
+	sender.SendValue(prefix+"wait_timeouts", float64(stats.Timeouts), "count")
+	sender.SendValue(prefix+"wait_time", float64(stats.WaitTime/time.Millisecond), "ms")
+}
+
+func (p *WaitingNetworkPool) releasedSignal() <-chan struct{} {
+	p.releasedMutex.Lock()
+	defer p.releasedMutex.Unlock()
+
+	return p.released
+}
+
+func (p *WaitingNetworkPool) recordWait(started time.Time, timedOut bool) {
+	p.statsMutex.Lock()
+	defer p.statsMutex.Unlock()
+
+	p.stats.Waits++
+	p.stats.WaitTime += time.Since(started)
+
+	if timedOut {
+		p.stats.Timeouts++
+	}
+}
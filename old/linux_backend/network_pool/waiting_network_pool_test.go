@@ -0,0 +1,102 @@
+package network_pool_test
+
+import (
+	"net"
+	"time"
+
+	"github.com/cloudfoundry/dropsonde/metric_sender/fake"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/pivotal-golang/lager/lagertest"
+
+	"github.com/cloudfoundry-incubator/garden-linux/old/linux_backend/network"
+	"github.com/cloudfoundry-incubator/garden-linux/old/linux_backend/network_pool"
+)
+
+var _ = Describe("Waiting Network Pool", func() {
+	var pool *network_pool.WaitingNetworkPool
+
+	BeforeEach(func() {
+		_, ipNet, err := net.ParseCIDR("10.254.0.0/29")
+		Ω(err).ShouldNot(HaveOccurred())
+
+		pool = network_pool.NewWaiting(
+			lagertest.NewTestLogger("test"),
+			network_pool.New(ipNet),
+			100*time.Millisecond,
+		)
+	})
+
+	Context("when the pool has networks available", func() {
+		It("acquires one without waiting", func() {
+			network, err := pool.Acquire()
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(network.String()).Should(Equal("10.254.0.0/30"))
+
+			Ω(pool.Stats()).Should(Equal(network_pool.WaitStats{}))
+		})
+	})
+
+	Context("when the pool is exhausted", func() {
+		var acquired []*network.Network
+
+		BeforeEach(func() {
+			acquired = []*network.Network{}
+
+			for i := 0; i < 2; i++ {
+				network, err := pool.Acquire()
+				Ω(err).ShouldNot(HaveOccurred())
+
+				acquired = append(acquired, network)
+			}
+		})
+
+		Context("and a network is released before the timeout", func() {
+			It("acquires the released network", func() {
+				go func() {
+					time.Sleep(10 * time.Millisecond)
+					pool.Release(acquired[1])
+				}()
+
+				network, err := pool.Acquire()
+				Ω(err).ShouldNot(HaveOccurred())
+				Ω(network).Should(Equal(acquired[1]))
+
+				stats := pool.Stats()
+				Ω(stats.Waits).Should(Equal(uint64(1)))
+				Ω(stats.Timeouts).Should(BeZero())
+				Ω(stats.WaitTime).Should(BeNumerically(">", 0))
+			})
+		})
+
+		Context("and no network is released before the timeout", func() {
+			It("returns a PoolExhaustedError", func() {
+				started := time.Now()
+
+				_, err := pool.Acquire()
+				Ω(err).Should(Equal(network_pool.PoolExhaustedError{}))
+
+				Ω(time.Since(started)).Should(BeNumerically(">=", 100*time.Millisecond))
+
+				stats := pool.Stats()
+				Ω(stats.Waits).Should(Equal(uint64(1)))
+				Ω(stats.Timeouts).Should(Equal(uint64(1)))
+			})
+
+			It("reports the wait as metrics", func() {
+				_, err := pool.Acquire()
+				Ω(err).Should(HaveOccurred())
+
+				fakeMetricSender := fake.NewFakeMetricSender()
+				pool.ReportWaits(fakeMetricSender, "network")
+
+				Ω(fakeMetricSender.GetValue("pool.network.waits")).Should(Equal(fake.Metric{Value: 1, Unit: "count"}))
+				Ω(fakeMetricSender.GetValue("pool.network.wait_timeouts")).Should(Equal(fake.Metric{Value: 1, Unit: "count"}))
+
+				waitTime := fakeMetricSender.GetValue("pool.network.wait_time")
+				Ω(waitTime.Unit).Should(Equal("ms"))
+				Ω(waitTime.Value).Should(BeNumerically(">=", 100))
+			})
+		})
+	})
+})
@@ -0,0 +1,70 @@
+package fake_numa_placer
+
+import (
+	"sync"
+
+	"github.com/cloudfoundry-incubator/garden-linux/old/linux_backend/numa_placer"
+)
+
+// FakePlacer places every container on Node, and reports Utilization as
+// given.
+type FakePlacer struct {
+	Node numa_placer.Node
+
+	// whether claims succeed
+	ClaimResult bool
+
+	Placed   []string
+	Claimed  map[string]string
+	Released []string
+
+	NodeUtilization []numa_placer.NodeUtilization
+
+	mutex sync.Mutex
+}
+
+func New(node numa_placer.Node) *FakePlacer {
+	return &FakePlacer{
+		Node: node,
+
+		ClaimResult: true,
+
+		Claimed: map[string]string{},
+	}
+}
+
+func (p *FakePlacer) Place(containerID string) numa_placer.Node {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	p.Placed = append(p.Placed, containerID)
+
+	return p.Node
+}
+
+func (p *FakePlacer) Claim(containerID string, mems string) bool {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if !p.ClaimResult {
+		return false
+	}
+
+	p.Claimed[containerID] = mems
+
+	return true
+}
+
+func (p *FakePlacer) Release(containerID string) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	p.Released = append(p.Released, containerID)
+}
+
+func (p *FakePlacer) Utilization() []numa_placer.NodeUtilization {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	return p.NodeUtilization
+}
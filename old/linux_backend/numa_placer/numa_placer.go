@@ -0,0 +1,210 @@
+package numa_placer
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Node is one of the host's NUMA nodes.
+type Node struct {
+	ID int
+
+	// in cpuset.cpus format, e.g. "0-7,16-23"
+	CPUs string
+}
+
+// Mems is the node in cpuset.mems format.
+func (n Node) Mems() string {
+	return strconv.Itoa(n.ID)
+}
+
+// NodeUtilization is how many containers are placed on a node.
+type NodeUtilization struct {
+	Node       Node
+	Containers int
+}
+
+// Policy decides which node a container is placed on.
+type Policy string
+
+const (
+	// Spread places each container on the node with the fewest containers
+	Spread Policy = "spread"
+
+	// RoundRobin places containers on each node in turn
+	RoundRobin Policy = "round-robin"
+)
+
+type UnknownPolicyError struct {
+	Policy string
+}
+
+func (e UnknownPolicyError) Error() string {
+	return fmt.Sprintf("unknown numa placement policy: %s", e.Policy)
+}
+
+func ParsePolicy(policy string) (Policy, error) {
+	switch Policy(policy) {
+	case Spread, RoundRobin:
+		return Policy(policy), nil
+	default:
+		return "", UnknownPolicyError{policy}
+	}
+}
+
+// DiscoverNodes reads the host's NUMA nodes from nodesPath, usually
+// /sys/devices/system/node.
+func DiscoverNodes(nodesPath string) ([]Node, error) {
+	nodeDirs, err := filepath.Glob(path.Join(nodesPath, "node[0-9]*"))
+	if err != nil {
+		return nil, err
+	}
+
+	nodes := []Node{}
+
+	for _, nodeDir := range nodeDirs {
+		id, err := strconv.Atoi(strings.TrimPrefix(path.Base(nodeDir), "node"))
+		if err != nil {
+			continue
+		}
+
+		cpus, err := ioutil.ReadFile(path.Join(nodeDir, "cpulist"))
+		if err != nil {
+			return nil, err
+		}
+
+		// memory-only nodes have no CPUs to run containers on
+		if strings.TrimSpace(string(cpus)) == "" {
+			continue
+		}
+
+		nodes = append(nodes, Node{
+			ID:   id,
+			CPUs: strings.TrimSpace(string(cpus)),
+		})
+	}
+
+	sort.Sort(byID(nodes))
+
+	return nodes, nil
+}
+
+type Placer interface {
+	Place(containerID string) Node
+	Claim(containerID string, mems string) bool
+	Release(containerID string)
+	Utilization() []NodeUtilization
+}
+
+type RealPlacer struct {
+	nodes  []Node
+	policy Policy
+
+	placed map[string]int
+	counts []int
+	next   int
+
+	mutex *sync.Mutex
+}
+
+func New(nodes []Node, policy Policy) *RealPlacer {
+	return &RealPlacer{
+		nodes:  nodes,
+		policy: policy,
+
+		placed: map[string]int{},
+		counts: make([]int, len(nodes)),
+
+		mutex: new(sync.Mutex),
+	}
+}
+
+// Place chooses a node for the container according to the policy.
+func (p *RealPlacer) Place(containerID string) Node {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if index, found := p.placed[containerID]; found {
+		return p.nodes[index]
+	}
+
+	var index int
+
+	switch p.policy {
+	case RoundRobin:
+		index = p.next
+		p.next = (p.next + 1) % len(p.nodes)
+	default:
+		for i, count := range p.counts {
+			if count < p.counts[index] {
+				index = i
+			}
+		}
+	}
+
+	p.placed[containerID] = index
+	p.counts[index]++
+
+	return p.nodes[index]
+}
+
+// Claim records that a restored container is already placed on the node
+// with the given cpuset.mems, saying whether there is such a node.
+func (p *RealPlacer) Claim(containerID string, mems string) bool {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if _, found := p.placed[containerID]; found {
+		return true
+	}
+
+	for index, node := range p.nodes {
+		if node.Mems() == strings.TrimSpace(mems) {
+			p.placed[containerID] = index
+			p.counts[index]++
+			return true
+		}
+	}
+
+	return false
+}
+
+func (p *RealPlacer) Release(containerID string) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	index, found := p.placed[containerID]
+	if !found {
+		return
+	}
+
+	delete(p.placed, containerID)
+	p.counts[index]--
+}
+
+func (p *RealPlacer) Utilization() []NodeUtilization {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	utilization := make([]NodeUtilization, len(p.nodes))
+	for i, node := range p.nodes {
+		utilization[i] = NodeUtilization{
+			Node:       node,
+			Containers: p.counts[i],
+		}
+	}
+
+	return utilization
+}
+
+type byID []Node
+
+func (nodes byID) Len() int           { return len(nodes) }
+func (nodes byID) Swap(i, j int)      { nodes[i], nodes[j] = nodes[j], nodes[i] }
+func (nodes byID) Less(i, j int) bool { return nodes[i].ID < nodes[j].ID }
@@ -0,0 +1,13 @@
+package numa_placer_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"testing"
+)
+
+func TestNUMAPlacer(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "NUMA Placer Suite")
+}
@@ -0,0 +1,168 @@
+package numa_placer_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/cloudfoundry-incubator/garden-linux/old/linux_backend/numa_placer"
+)
+
+var _ = Describe("NUMA placement", func() {
+	nodes := []numa_placer.Node{
+		{ID: 0, CPUs: "0-3"},
+		{ID: 1, CPUs: "4-7"},
+	}
+
+	Describe("parsing a policy", func() {
+		It("accepts spread and round-robin", func() {
+			policy, err := numa_placer.ParsePolicy("spread")
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(policy).Should(Equal(numa_placer.Spread))
+
+			policy, err = numa_placer.ParsePolicy("round-robin")
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(policy).Should(Equal(numa_placer.RoundRobin))
+		})
+
+		It("rejects anything else", func() {
+			_, err := numa_placer.ParsePolicy("pack")
+			Ω(err).Should(Equal(numa_placer.UnknownPolicyError{Policy: "pack"}))
+		})
+	})
+
+	Describe("discovering nodes", func() {
+		var nodesPath string
+
+		writeNode := func(name, cpulist string) {
+			err := os.MkdirAll(path.Join(nodesPath, name), 0755)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			err = ioutil.WriteFile(path.Join(nodesPath, name, "cpulist"), []byte(cpulist), 0644)
+			Ω(err).ShouldNot(HaveOccurred())
+		}
+
+		BeforeEach(func() {
+			var err error
+
+			nodesPath, err = ioutil.TempDir("", "numa-nodes")
+			Ω(err).ShouldNot(HaveOccurred())
+		})
+
+		AfterEach(func() {
+			os.RemoveAll(nodesPath)
+		})
+
+		It("reads each node's CPUs, in node order", func() {
+			writeNode("node10", "16-23\n")
+			writeNode("node0", "0-7,32-39\n")
+			writeNode("node1", "8-15\n")
+
+			discovered, err := numa_placer.DiscoverNodes(nodesPath)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(discovered).Should(Equal([]numa_placer.Node{
+				{ID: 0, CPUs: "0-7,32-39"},
+				{ID: 1, CPUs: "8-15"},
+				{ID: 10, CPUs: "16-23"},
+			}))
+		})
+
+		It("skips nodes without CPUs", func() {
+			writeNode("node0", "0-7\n")
+			writeNode("node1", "\n")
+
+			discovered, err := numa_placer.DiscoverNodes(nodesPath)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(discovered).Should(Equal([]numa_placer.Node{{ID: 0, CPUs: "0-7"}}))
+		})
+
+		It("ignores other entries", func() {
+			writeNode("node0", "0-7\n")
+			err := os.MkdirAll(path.Join(nodesPath, "power"), 0755)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			discovered, err := numa_placer.DiscoverNodes(nodesPath)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(discovered).Should(HaveLen(1))
+		})
+	})
+
+	Describe("with the spread policy", func() {
+		var placer *numa_placer.RealPlacer
+
+		BeforeEach(func() {
+			placer = numa_placer.New(nodes, numa_placer.Spread)
+		})
+
+		It("places each container on the node with the fewest containers", func() {
+			Ω(placer.Place("a").ID).Should(Equal(0))
+			Ω(placer.Place("b").ID).Should(Equal(1))
+			Ω(placer.Place("c").ID).Should(Equal(0))
+
+			placer.Release("a")
+			placer.Release("c")
+
+			Ω(placer.Place("d").ID).Should(Equal(0))
+			Ω(placer.Place("e").ID).Should(Equal(0))
+			Ω(placer.Place("f").ID).Should(Equal(1))
+		})
+
+		It("places a container only once", func() {
+			Ω(placer.Place("a").ID).Should(Equal(0))
+			Ω(placer.Place("a").ID).Should(Equal(0))
+
+			Ω(placer.Utilization()[0].Containers).Should(Equal(1))
+		})
+	})
+
+	Describe("with the round-robin policy", func() {
+		It("places containers on each node in turn", func() {
+			placer := numa_placer.New(nodes, numa_placer.RoundRobin)
+
+			Ω(placer.Place("a").ID).Should(Equal(0))
+			placer.Release("a")
+
+			Ω(placer.Place("b").ID).Should(Equal(1))
+			Ω(placer.Place("c").ID).Should(Equal(0))
+		})
+	})
+
+	Describe("claiming a restored container's node", func() {
+		var placer *numa_placer.RealPlacer
+
+		BeforeEach(func() {
+			placer = numa_placer.New(nodes, numa_placer.Spread)
+		})
+
+		It("counts the container on the node with its mems", func() {
+			Ω(placer.Claim("a", "1\n")).Should(BeTrue())
+
+			Ω(placer.Place("b").ID).Should(Equal(0))
+			Ω(placer.Utilization()[1].Containers).Should(Equal(1))
+		})
+
+		It("says so if there is no such node", func() {
+			Ω(placer.Claim("a", "0-1")).Should(BeFalse())
+			Ω(placer.Utilization()[0].Containers).Should(BeZero())
+			Ω(placer.Utilization()[1].Containers).Should(BeZero())
+		})
+	})
+
+	It("reports how many containers are on each node", func() {
+		placer := numa_placer.New(nodes, numa_placer.Spread)
+
+		placer.Place("a")
+		placer.Place("b")
+		placer.Place("c")
+
+		Ω(placer.Utilization()).Should(Equal([]numa_placer.NodeUtilization{
+			{Node: nodes[0], Containers: 2},
+			{Node: nodes[1], Containers: 1},
+		}))
+	})
+})
@@ -0,0 +1,158 @@
+package linux_backend
+
+import (
+	"fmt"
+
+	"github.com/pivotal-golang/lager"
+)
+
+// OvercommitFactors are how much memory and disk the limits of all
+// containers together may commit, as multiples of the host's total. Zero
+// disables a check.
+type OvercommitFactors struct {
+	Memory float64
+	Disk   float64
+}
+
+// LimitAdmitter decides whether a container may commit to new limits, so
+// that containers' limits together can be kept within what the host can
+// give. No other limits are admitted until the returned release is called,
+// once the limits are applied.
+type LimitAdmitter interface {
+	AdmitLimits(container Container, committed CommittedResources) (release func(), err error)
+}
+
+type OvercommitError struct {
+	Resource  string
+	Committed uint64
+	Allowed   uint64
+}
+
+func (e OvercommitError) Error() string {
+	return fmt.Sprintf(
+		"%s overcommitted: container limits would commit %d bytes, of %d allowed",
+		e.Resource,
+		e.Committed,
+		e.Allowed,
+	)
+}
+
+// EnforceOvercommit limits how far containers' limits may commit the host's
+// memory and disk. It must be called before the backend is started.
+func (b *LinuxBackend) EnforceOvercommit(factors OvercommitFactors) {
+	b.overcommit = factors
+}
+
+// AdmitLimits admits a container committing to the given resources unless
+// that would take all containers' commitment past what the overcommit
+// factors allow. Lowering a commitment is always admitted.
+func (b *LinuxBackend) AdmitLimits(container Container, committed CommittedResources) (func(), error) {
+	b.commitMutex.Lock()
+
+	err := b.admitLimits(container, committed)
+	if err != nil {
+		b.commitMutex.Unlock()
+
+		b.logger.Info("rejected-limits", lager.Data{
+			"handle": container.Handle(),
+			"reason": err.Error(),
+		})
+
+		return nil, err
+	}
+
+	return b.commitMutex.Unlock, nil
+}
+
+func (b *LinuxBackend) admitLimits(container Container, committed CommittedResources) error {
+	allowed, err := b.allowedCommitment()
+	if err != nil {
+		return err
+	}
+
+	current := container.CommittedResources()
+
+	total := b.committedResources(container.ID())
+	total.MemoryInBytes += committed.MemoryInBytes
+	total.DiskInBytes += committed.DiskInBytes
+
+	if allowed.MemoryInBytes > 0 && committed.MemoryInBytes > current.MemoryInBytes && total.MemoryInBytes > allowed.MemoryInBytes {
+		return OvercommitError{"memory", total.MemoryInBytes, allowed.MemoryInBytes}
+	}
+
+	if allowed.DiskInBytes > 0 && committed.DiskInBytes > current.DiskInBytes && total.DiskInBytes > allowed.DiskInBytes {
+		return OvercommitError{"disk", total.DiskInBytes, allowed.DiskInBytes}
+	}
+
+	return nil
+}
+
+// checkRoomToCommit returns an OvercommitError if containers' limits
+// already commit all the memory or disk that the overcommit factors allow,
+// leaving none for a new container.
+func (b *LinuxBackend) checkRoomToCommit() error {
+	b.commitMutex.Lock()
+	defer b.commitMutex.Unlock()
+
+	allowed, err := b.allowedCommitment()
+	if err != nil {
+		return err
+	}
+
+	total := b.committedResources("")
+
+	if allowed.MemoryInBytes > 0 && total.MemoryInBytes >= allowed.MemoryInBytes {
+		return OvercommitError{"memory", total.MemoryInBytes, allowed.MemoryInBytes}
+	}
+
+	if allowed.DiskInBytes > 0 && total.DiskInBytes >= allowed.DiskInBytes {
+		return OvercommitError{"disk", total.DiskInBytes, allowed.DiskInBytes}
+	}
+
+	return nil
+}
+
+// allowedCommitment is the most memory and disk that containers' limits
+// may commit, zero for those not enforced.
+func (b *LinuxBackend) allowedCommitment() (CommittedResources, error) {
+	allowed := CommittedResources{}
+
+	if b.overcommit.Memory > 0 {
+		totalMemory, err := b.systemInfo.TotalMemory()
+		if err != nil {
+			return allowed, err
+		}
+
+		allowed.MemoryInBytes = uint64(float64(totalMemory) * b.overcommit.Memory)
+	}
+
+	if b.overcommit.Disk > 0 {
+		totalDisk, err := b.systemInfo.TotalDisk()
+		if err != nil {
+			return allowed, err
+		}
+
+		allowed.DiskInBytes = uint64(float64(totalDisk) * b.overcommit.Disk)
+	}
+
+	return allowed, nil
+}
+
+// committedResources totals the resources committed by the limits of every
+// container but the one with the given ID.
+func (b *LinuxBackend) committedResources(exceptID string) CommittedResources {
+	total := CommittedResources{}
+
+	for _, container := range b.containers.all() {
+		if container.ID() == exceptID {
+			continue
+		}
+
+		committed := container.CommittedResources()
+
+		total.MemoryInBytes += committed.MemoryInBytes
+		total.DiskInBytes += committed.DiskInBytes
+	}
+
+	return total
+}
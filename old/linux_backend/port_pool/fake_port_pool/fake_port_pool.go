@@ -3,8 +3,13 @@ package fake_port_pool
 type FakePortPool struct {
 	nextPort uint32
 
-	AcquireError error
-	RemoveError  error
+	InitialPoolSize   int
+	AvailablePoolSize int
+
+	AcquireError      error
+	AcquireRangeError error
+	RemoveError       error
+	GrowError         error
 
 	Acquired []uint32
 	Released []uint32
@@ -17,6 +22,24 @@ func New(start uint32) *FakePortPool {
 	}
 }
 
+func (p *FakePortPool) InitialSize() int {
+	return p.InitialPoolSize
+}
+
+func (p *FakePortPool) Available() int {
+	return p.AvailablePoolSize
+}
+
+func (p *FakePortPool) Grow(size uint32) error {
+	if p.GrowError != nil {
+		return p.GrowError
+	}
+
+	p.InitialPoolSize = int(size)
+
+	return nil
+}
+
 func (p *FakePortPool) Acquire() (uint32, error) {
 	if p.AcquireError != nil {
 		return 0, p.AcquireError
@@ -28,6 +51,17 @@ func (p *FakePortPool) Acquire() (uint32, error) {
 	return port, nil
 }
 
+func (p *FakePortPool) AcquireRange(count uint32) (uint32, error) {
+	if p.AcquireRangeError != nil {
+		return 0, p.AcquireRangeError
+	}
+
+	first := p.nextPort
+	p.nextPort += count
+
+	return first, nil
+}
+
 func (p *FakePortPool) Remove(port uint32) error {
 	if p.RemoveError != nil {
 		return p.RemoveError
@@ -38,6 +72,16 @@ func (p *FakePortPool) Remove(port uint32) error {
 	return nil
 }
 
+func (p *FakePortPool) RemoveAll(ports []uint32) error {
+	if p.RemoveError != nil {
+		return p.RemoveError
+	}
+
+	p.Removed = append(p.Removed, ports...)
+
+	return nil
+}
+
 func (p *FakePortPool) Release(port uint32) {
 	p.Released = append(p.Released, port)
 }
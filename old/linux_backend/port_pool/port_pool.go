@@ -27,6 +27,25 @@ func (e PortTakenError) Error() string {
 	return fmt.Sprintf("port already acquired: %d", e.Port)
 }
 
+// PortsTakenError reports every port that could not be removed in a
+// RemoveAll
+type PortsTakenError struct {
+	Ports []uint32
+}
+
+func (e PortsTakenError) Error() string {
+	return fmt.Sprintf("ports already acquired: %v", e.Ports)
+}
+
+type CannotShrinkError struct {
+	Size    uint32
+	NewSize uint32
+}
+
+func (e CannotShrinkError) Error() string {
+	return fmt.Sprintf("port pool cannot shrink from %d to %d", e.Size, e.NewSize)
+}
+
 func New(start, size uint32) *PortPool {
 	pool := []uint32{}
 
@@ -42,6 +61,40 @@ func New(start, size uint32) *PortPool {
 	}
 }
 
+func (p *PortPool) InitialSize() int {
+	p.poolMutex.Lock()
+	defer p.poolMutex.Unlock()
+
+	return int(p.size)
+}
+
+// Grow extends the pool's range to size ports from its start, without
+// disturbing any ports already acquired.
+func (p *PortPool) Grow(size uint32) error {
+	p.poolMutex.Lock()
+	defer p.poolMutex.Unlock()
+
+	if size < p.size {
+		return CannotShrinkError{p.size, size}
+	}
+
+	for port := p.start + p.size; port < p.start+size; port++ {
+		p.pool = append(p.pool, port)
+	}
+
+	p.size = size
+
+	return nil
+}
+
+// Available returns how many ports can still be acquired.
+func (p *PortPool) Available() int {
+	p.poolMutex.Lock()
+	defer p.poolMutex.Unlock()
+
+	return len(p.pool)
+}
+
 func (p *PortPool) Acquire() (uint32, error) {
 	p.poolMutex.Lock()
 	defer p.poolMutex.Unlock()
@@ -57,6 +110,47 @@ func (p *PortPool) Acquire() (uint32, error) {
 	return port, nil
 }
 
+// AcquireRange acquires count contiguous ports, the lowest such block
+// available, and returns the first.
+func (p *PortPool) AcquireRange(count uint32) (uint32, error) {
+	p.poolMutex.Lock()
+	defer p.poolMutex.Unlock()
+
+	available := map[uint32]bool{}
+	for _, port := range p.pool {
+		available[port] = true
+	}
+
+	run := uint32(0)
+	for port := p.start; port < p.start+p.size; port++ {
+		if !available[port] {
+			run = 0
+			continue
+		}
+
+		run++
+
+		if run < count {
+			continue
+		}
+
+		first := port - count + 1
+
+		pool := make([]uint32, 0, len(p.pool)-int(count))
+		for _, existingPort := range p.pool {
+			if existingPort < first || existingPort > port {
+				pool = append(pool, existingPort)
+			}
+		}
+
+		p.pool = pool
+
+		return first, nil
+	}
+
+	return 0, PoolExhaustedError{}
+}
+
 func (p *PortPool) Remove(port uint32) error {
 	idx := 0
 	found := false
@@ -81,14 +175,51 @@ func (p *PortPool) Remove(port uint32) error {
 	return nil
 }
 
-func (p *PortPool) Release(port uint32) {
-	if port < p.start || port >= p.start+p.size {
-		return
+// RemoveAll removes many ports in one pass, as when restoring containers.
+// If any of them is taken, or given twice, none are removed.
+func (p *PortPool) RemoveAll(ports []uint32) error {
+	p.poolMutex.Lock()
+	defer p.poolMutex.Unlock()
+
+	available := map[uint32]bool{}
+	for _, port := range p.pool {
+		available[port] = true
 	}
 
+	taken := []uint32{}
+	for _, port := range ports {
+		if !available[port] {
+			taken = append(taken, port)
+			continue
+		}
+
+		delete(available, port)
+	}
+
+	if len(taken) > 0 {
+		return PortsTakenError{taken}
+	}
+
+	pool := make([]uint32, 0, len(available))
+	for _, port := range p.pool {
+		if available[port] {
+			pool = append(pool, port)
+		}
+	}
+
+	p.pool = pool
+
+	return nil
+}
+
+func (p *PortPool) Release(port uint32) {
 	p.poolMutex.Lock()
 	defer p.poolMutex.Unlock()
 
+	if port < p.start || port >= p.start+p.size {
+		return
+	}
+
 	for _, existingPort := range p.pool {
 		if existingPort == port {
 			return
@@ -37,6 +37,57 @@ var _ = Describe("Port pool", func() {
 		})
 	})
 
+	Describe("acquiring a range", func() {
+		It("returns the first of the lowest contiguous block available", func() {
+			pool := port_pool.New(10000, 10)
+
+			err := pool.RemoveAll([]uint32{10001, 10004})
+			Ω(err).ShouldNot(HaveOccurred())
+
+			first, err := pool.AcquireRange(3)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(first).Should(Equal(uint32(10005)))
+
+			err = pool.RemoveAll([]uint32{10005})
+			Ω(err).Should(HaveOccurred())
+
+			err = pool.RemoveAll([]uint32{10007})
+			Ω(err).Should(HaveOccurred())
+
+			err = pool.RemoveAll([]uint32{10000, 10002, 10003, 10008, 10009})
+			Ω(err).ShouldNot(HaveOccurred())
+		})
+
+		It("finds blocks in released ports", func() {
+			pool := port_pool.New(10000, 3)
+
+			first, err := pool.AcquireRange(3)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(first).Should(Equal(uint32(10000)))
+
+			pool.Release(10002)
+			pool.Release(10001)
+
+			first, err = pool.AcquireRange(2)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(first).Should(Equal(uint32(10001)))
+		})
+
+		Context("when there is no block that large", func() {
+			It("returns a PoolExhaustedError, and acquires nothing", func() {
+				pool := port_pool.New(10000, 5)
+
+				err := pool.Remove(10002)
+				Ω(err).ShouldNot(HaveOccurred())
+
+				_, err = pool.AcquireRange(3)
+				Ω(err).Should(Equal(port_pool.PoolExhaustedError{}))
+
+				Ω(pool.Available()).Should(Equal(4))
+			})
+		})
+	})
+
 	Describe("removing", func() {
 		It("acquires a specific port from the pool", func() {
 			pool := port_pool.New(10000, 2)
@@ -65,6 +116,102 @@ var _ = Describe("Port pool", func() {
 		})
 	})
 
+	Describe("removing many", func() {
+		It("acquires all of the ports from the pool", func() {
+			pool := port_pool.New(10000, 3)
+
+			err := pool.RemoveAll([]uint32{10000, 10002})
+			Ω(err).ShouldNot(HaveOccurred())
+
+			port, err := pool.Acquire()
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(port).Should(Equal(uint32(10001)))
+
+			_, err = pool.Acquire()
+			Ω(err).Should(HaveOccurred())
+		})
+
+		Context("when some are already acquired or given twice", func() {
+			It("reports them all and removes none", func() {
+				pool := port_pool.New(10000, 3)
+
+				port, err := pool.Acquire()
+				Ω(err).ShouldNot(HaveOccurred())
+
+				err = pool.RemoveAll([]uint32{port, 10001, 10002, 10002})
+				Ω(err).Should(Equal(port_pool.PortsTakenError{Ports: []uint32{port, 10002}}))
+
+				err = pool.RemoveAll([]uint32{10001, 10002})
+				Ω(err).ShouldNot(HaveOccurred())
+			})
+		})
+	})
+
+	Describe("sizing", func() {
+		It("reports the pool's size and how many ports can still be acquired", func() {
+			pool := port_pool.New(10000, 3)
+
+			Ω(pool.InitialSize()).Should(Equal(3))
+			Ω(pool.Available()).Should(Equal(3))
+
+			_, err := pool.Acquire()
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(pool.InitialSize()).Should(Equal(3))
+			Ω(pool.Available()).Should(Equal(2))
+		})
+	})
+
+	Describe("growing", func() {
+		It("adds the new ports to the pool", func() {
+			pool := port_pool.New(10000, 1)
+
+			_, err := pool.Acquire()
+			Ω(err).ShouldNot(HaveOccurred())
+
+			err = pool.Grow(3)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(pool.InitialSize()).Should(Equal(3))
+
+			port1, err := pool.Acquire()
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(port1).Should(Equal(uint32(10001)))
+
+			port2, err := pool.Acquire()
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(port2).Should(Equal(uint32(10002)))
+
+			_, err = pool.Acquire()
+			Ω(err).Should(HaveOccurred())
+		})
+
+		It("takes back released ports in the new range", func() {
+			pool := port_pool.New(10000, 1)
+
+			err := pool.Grow(2)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			err = pool.RemoveAll([]uint32{10000, 10001})
+			Ω(err).ShouldNot(HaveOccurred())
+
+			pool.Release(10001)
+
+			port, err := pool.Acquire()
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(port).Should(Equal(uint32(10001)))
+		})
+
+		Context("when the new size is smaller", func() {
+			It("returns a CannotShrinkError", func() {
+				pool := port_pool.New(10000, 3)
+
+				err := pool.Grow(2)
+				Ω(err).Should(Equal(port_pool.CannotShrinkError{Size: 3, NewSize: 2}))
+			})
+		})
+	})
+
 	Describe("releasing", func() {
 		It("places a port back at the end of the pool", func() {
 			pool := port_pool.New(10000, 2)
@@ -0,0 +1,165 @@
+package linux_backend
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/pivotal-golang/lager"
+)
+
+// PortReservations hands host ports reserved ahead of any container over to
+// the first container to map them.
+type PortReservations interface {
+	// ClaimReservedPort takes the port's reservation, if it has one, so that
+	// it is the claiming container's to release.
+	ClaimReservedPort(port uint32) bool
+}
+
+type UnreservedPortError struct {
+	Port uint32
+}
+
+func (e UnreservedPortError) Error() string {
+	return fmt.Sprintf("port not reserved: %d", e.Port)
+}
+
+// ReservePort takes a host port from the port pool before any container
+// exists to map it, as for registering routes ahead of time: the given
+// port, or any free one if it is 0. The reservation lasts until it is
+// released or a container maps the port with NetIn.
+//
+// The reservations are saved whenever they change, so that they outlast a
+// server that does not stop cleanly.
+func (b *LinuxBackend) ReservePort(port uint32) (uint32, error) {
+	b.reservedPortsMutex.Lock()
+	defer b.reservedPortsMutex.Unlock()
+
+	port, err := b.reservePort(port)
+	if err != nil {
+		return 0, err
+	}
+
+	b.saveReservedPorts()
+
+	return port, nil
+}
+
+func (b *LinuxBackend) reservePort(port uint32) (uint32, error) {
+	port, err := b.containerPool.AcquirePort(port)
+	if err != nil {
+		return 0, err
+	}
+
+	b.reservedPorts[port] = true
+
+	b.logger.Info("reserved-port", lager.Data{"port": port})
+
+	return port, nil
+}
+
+// ReleasePort returns a reserved port that no container has mapped to the
+// port pool.
+func (b *LinuxBackend) ReleasePort(port uint32) error {
+	b.reservedPortsMutex.Lock()
+	defer b.reservedPortsMutex.Unlock()
+
+	if !b.reservedPorts[port] {
+		return UnreservedPortError{port}
+	}
+
+	delete(b.reservedPorts, port)
+	b.containerPool.ReleasePort(port)
+
+	b.logger.Info("released-port", lager.Data{"port": port})
+
+	b.saveReservedPorts()
+
+	return nil
+}
+
+func (b *LinuxBackend) ClaimReservedPort(port uint32) bool {
+	b.reservedPortsMutex.Lock()
+	defer b.reservedPortsMutex.Unlock()
+
+	if !b.reservedPorts[port] {
+		return false
+	}
+
+	delete(b.reservedPorts, port)
+
+	b.saveReservedPorts()
+
+	return true
+}
+
+// ReservedPorts returns the ports reserved and not yet mapped, in order.
+func (b *LinuxBackend) ReservedPorts() []uint32 {
+	b.reservedPortsMutex.Lock()
+	defer b.reservedPortsMutex.Unlock()
+
+	return b.sortedReservedPorts()
+}
+
+func (b *LinuxBackend) sortedReservedPorts() []uint32 {
+	ports := []uint32{}
+	for port := range b.reservedPorts {
+		ports = append(ports, port)
+	}
+
+	sort.Sort(portsByNumber(ports))
+
+	return ports
+}
+
+// restorePortReservations takes back the ports reserved when the server
+// stopped, or last changed. It is run once the containers are restored, so
+// that a port that a container has since come to hold stays with the
+// container. They are saved once all are taken back, rather than as each
+// is, so that failing part way through loses none.
+func (b *LinuxBackend) restorePortReservations() {
+	rLog := b.logger.Session("restore-port-reservations")
+
+	ports, err := b.snapshotStore.LoadReservedPorts()
+	if err != nil {
+		rLog.Error("failed-to-load", err)
+		return
+	}
+
+	b.reservedPortsMutex.Lock()
+	defer b.reservedPortsMutex.Unlock()
+
+	for _, port := range ports {
+		_, err := b.reservePort(port)
+		if err != nil {
+			rLog.Error("failed-to-reserve", err, lager.Data{"port": port})
+		}
+	}
+
+	b.saveReservedPorts()
+}
+
+func (b *LinuxBackend) savePortReservations() {
+	b.reservedPortsMutex.Lock()
+	defer b.reservedPortsMutex.Unlock()
+
+	b.saveReservedPorts()
+}
+
+// saveReservedPorts is called with reservedPortsMutex held, so that saves
+// are in the order of the changes they save.
+func (b *LinuxBackend) saveReservedPorts() {
+	if b.snapshotStore == nil {
+		return
+	}
+
+	err := b.snapshotStore.SaveReservedPorts(b.sortedReservedPorts())
+	if err != nil {
+		b.logger.Error("failed-to-save-port-reservations", err)
+	}
+}
+
+type portsByNumber []uint32
+
+func (p portsByNumber) Len() int           { return len(p) }
+func (p portsByNumber) Less(i, j int) bool { return p[i] < p[j] }
+func (p portsByNumber) Swap(i, j int)      { p[i], p[j] = p[j], p[i] }
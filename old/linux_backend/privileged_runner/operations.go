@@ -0,0 +1,616 @@
+package privileged_runner
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// InvalidRequestError is returned by the helper for requests with fields
+// it will not build a command from.
+type InvalidRequestError struct {
+	Field string
+	Value string
+}
+
+func (e InvalidRequestError) Error() string {
+	return fmt.Sprintf("invalid %s for the privileged helper: %q", e.Field, e.Value)
+}
+
+// UnsafePathError is returned for containers whose directories could have
+// been changed by someone other than the helper's user, who could then
+// have the container's scripts source or run anything.
+type UnsafePathError struct {
+	Path string
+}
+
+func (e UnsafePathError) Error() string {
+	return fmt.Sprintf("not owned and writable only by the privileged helper's user: %s", e.Path)
+}
+
+// Output is how a request's output is to be returned.
+type Output struct {
+	// stdout and stderr are to be returned, interleaved, as Stdout
+	Combined bool
+}
+
+// NetRequest runs an action of net.sh for a container.
+type NetRequest struct {
+	ID     string
+	Action string
+
+	// the number of rules net.sh check expects in the container's chains
+	FilterRules uint64
+	NATRules    uint64
+
+	Output
+}
+
+var netActions = map[string]bool{
+	"setup":            true,
+	"check":            true,
+	"check_links":      true,
+	"check_gateway":    true,
+	"usage":            true,
+	"get_egress_info":  true,
+	"get_ingress_info": true,
+}
+
+func (request NetRequest) command(layout Layout) (*exec.Cmd, error) {
+	if !netActions[request.Action] {
+		return nil, InvalidRequestError{"net.sh action", request.Action}
+	}
+
+	env := []string{}
+
+	switch request.Action {
+	case "check":
+		env = append(env,
+			fmt.Sprintf("FILTER_RULES=%d", request.FilterRules),
+			fmt.Sprintf("NAT_RULES=%d", request.NATRules),
+		)
+
+	case "get_egress_info", "get_ingress_info":
+		env = append(env, "ID="+request.ID)
+	}
+
+	return layout.containerScript(request.ID, "net.sh", []string{request.Action}, env)
+}
+
+// NetRateRequest limits a container's bandwidth with net_rate.sh.
+type NetRateRequest struct {
+	ID string
+
+	// in bits and bytes per second, as net_rate.sh takes them
+	Rate  uint64
+	Burst uint64
+
+	Output
+}
+
+func (request NetRateRequest) command(layout Layout) (*exec.Cmd, error) {
+	return layout.containerScript(request.ID, "net_rate.sh", nil, []string{
+		fmt.Sprintf("RATE=%d", request.Rate),
+		fmt.Sprintf("BURST=%d", request.Burst),
+	})
+}
+
+// StartRequest starts a container's wshd with start.sh.
+type StartRequest struct {
+	ID  string
+	MTU uint64
+
+	Output
+}
+
+func (request StartRequest) command(layout Layout) (*exec.Cmd, error) {
+	return layout.containerScript(request.ID, "start.sh", nil, []string{
+		"id=" + request.ID,
+		fmt.Sprintf("container_iface_mtu=%d", request.MTU),
+	})
+}
+
+// StopRequest stops a container's processes with stop.sh, killing them
+// at once if Kill is set.
+type StopRequest struct {
+	ID   string
+	Kill bool
+
+	Output
+}
+
+func (request StopRequest) command(layout Layout) (*exec.Cmd, error) {
+	args := []string{}
+	if request.Kill {
+		args = append(args, "-w", "0")
+	}
+
+	return layout.containerScript(request.ID, "stop.sh", args, nil)
+}
+
+// SetUpHostRequest makes the host-wide changes of setup.sh.
+type SetUpHostRequest struct {
+	PoolNetwork   string
+	DenyNetworks  []string
+	AllowNetworks []string
+
+	DiskQuotaEnabled bool
+	AppArmorProfile  string
+
+	Output
+}
+
+func (request SetUpHostRequest) command(layout Layout) (*exec.Cmd, error) {
+	err := checkNetworks("pool network", request.PoolNetwork)
+	if err != nil {
+		return nil, err
+	}
+
+	err = checkNetworks("network", append(request.DenyNetworks, request.AllowNetworks...)...)
+	if err != nil {
+		return nil, err
+	}
+
+	if !validName.MatchString(request.AppArmorProfile) {
+		return nil, InvalidRequestError{"AppArmor profile", request.AppArmorProfile}
+	}
+
+	return layout.binScript("setup.sh", nil, []string{
+		"POOL_NETWORK=" + request.PoolNetwork,
+		"DENY_NETWORKS=" + strings.Join(request.DenyNetworks, " "),
+		"ALLOW_NETWORKS=" + strings.Join(request.AllowNetworks, " "),
+		"CONTAINER_DEPOT_PATH=" + layout.DepotPath,
+		"CONTAINER_DEPOT_MOUNT_POINT_PATH=" + layout.QuotaMountPoint,
+		fmt.Sprintf("DISK_QUOTA_ENABLED=%v", request.DiskQuotaEnabled),
+		"APPARMOR_PROFILE=" + request.AppArmorProfile,
+	}), nil
+}
+
+// GrowPoolRequest moves the pool's NAT to a larger network with net.sh
+// grow_pool.
+type GrowPoolRequest struct {
+	PoolNetwork    string
+	OldPoolNetwork string
+
+	Output
+}
+
+func (request GrowPoolRequest) command(layout Layout) (*exec.Cmd, error) {
+	err := checkNetworks("pool network", request.PoolNetwork, request.OldPoolNetwork)
+	if err != nil {
+		return nil, err
+	}
+
+	return layout.binScript("net.sh", []string{"grow_pool"}, []string{
+		"POOL_NETWORK=" + request.PoolNetwork,
+		"OLD_POOL_NETWORK=" + request.OldPoolNetwork,
+	}), nil
+}
+
+// FilterDefaultRequest replaces the networks containers are denied and
+// allowed by default with net.sh filter_default.
+type FilterDefaultRequest struct {
+	DenyNetworks  []string
+	AllowNetworks []string
+
+	Output
+}
+
+func (request FilterDefaultRequest) command(layout Layout) (*exec.Cmd, error) {
+	err := checkNetworks("network", append(request.DenyNetworks, request.AllowNetworks...)...)
+	if err != nil {
+		return nil, err
+	}
+
+	return layout.binScript("net.sh", []string{"filter_default"}, []string{
+		"DENY_NETWORKS=" + strings.Join(request.DenyNetworks, " "),
+		"ALLOW_NETWORKS=" + strings.Join(request.AllowNetworks, " "),
+	}), nil
+}
+
+// CreateRequest creates a container's depot directory with create.sh. Vars
+// are create.sh's settings, other than its ID, by name.
+type CreateRequest struct {
+	ID   string
+	Vars map[string]string
+
+	Output
+}
+
+// createVars are the settings create.sh takes, and what their values may
+// be; rootfs_path and user_uid are checked against the layout as well
+var createVars = map[string]func(string) bool{
+	"iface_name":                validName.MatchString,
+	"rootfs_path":               validPath,
+	"user_uid":                  validNumber.MatchString,
+	"network_host_ip":           validIPs.MatchString,
+	"network_container_ip":      validIPs.MatchString,
+	"network_attachments":       validIPs.MatchString,
+	"container_external_ip":     validIPs.MatchString,
+	"network_tun":               validBool.MatchString,
+	"filesystem_fuse":           validBool.MatchString,
+	"security_no_new_privs":     validBool.MatchString,
+	"security_harden_proc_sys":  validBool.MatchString,
+	"security_apparmor_profile": validName.MatchString,
+	"security_selinux_label":    validName.MatchString,
+	"network_plugin_links":      validBool.MatchString,
+	"network_dns_servers":       validWords.MatchString,
+	"network_dns_search":        validWords.MatchString,
+}
+
+func (request CreateRequest) command(layout Layout) (*exec.Cmd, error) {
+	containerPath, err := layout.containerPath(request.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	env := []string{"id=" + request.ID}
+
+	for name, value := range request.Vars {
+		valid, known := createVars[name]
+		if !known {
+			return nil, InvalidRequestError{"create.sh setting", name}
+		}
+
+		if !valid(value) {
+			return nil, InvalidRequestError{name, value}
+		}
+
+		env = append(env, name+"="+value)
+	}
+
+	err = layout.checkRootFS(request.ID, request.Vars["rootfs_path"])
+	if err != nil {
+		return nil, err
+	}
+
+	uid, err := parseUint(request.Vars["user_uid"])
+	if err != nil || !layout.pooledUID(uid) {
+		return nil, InvalidRequestError{"user_uid", request.Vars["user_uid"]}
+	}
+
+	// in a stable order, for the sake of logs and tests
+	sort.Strings(env[1:])
+
+	return layout.binScript("create.sh", []string{containerPath}, env), nil
+}
+
+// DestroyRequest tears a container down with destroy.sh, moving its depot
+// directory to the graveyard for the reaper if Bury is set.
+type DestroyRequest struct {
+	ID   string
+	Bury bool
+
+	Output
+}
+
+func (request DestroyRequest) command(layout Layout) (*exec.Cmd, error) {
+	containerPath, err := layout.containerPath(request.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	args := []string{containerPath}
+	if request.Bury {
+		args = append(args, layout.graveyardPath())
+	}
+
+	return layout.binScript("destroy.sh", args, nil), nil
+}
+
+// OverlayRequest creates, cleans up or remounts a container's overlay with
+// overlay.sh. RootFSPath is the base of the overlay, for create and
+// remount.
+type OverlayRequest struct {
+	Action     string
+	ID         string
+	RootFSPath string
+	MountLabel string
+
+	Output
+}
+
+func (request OverlayRequest) command(layout Layout) (*exec.Cmd, error) {
+	if !validID.MatchString(request.ID) {
+		return nil, InvalidRequestError{"container ID", request.ID}
+	}
+
+	overlayPath := path.Join(layout.OverlaysPath, request.ID)
+
+	var args []string
+
+	switch request.Action {
+	case "create", "remount":
+		if !validPath(request.RootFSPath) || !layout.overlayBase(request.RootFSPath) {
+			return nil, InvalidRequestError{"rootfs path", request.RootFSPath}
+		}
+
+		if !validName.MatchString(request.MountLabel) {
+			return nil, InvalidRequestError{"mount label", request.MountLabel}
+		}
+
+		args = []string{request.Action, overlayPath, request.RootFSPath}
+		if request.MountLabel != "" {
+			args = append(args, request.MountLabel)
+		}
+
+	case "cleanup":
+		args = []string{request.Action, overlayPath}
+
+	default:
+		return nil, InvalidRequestError{"overlay.sh action", request.Action}
+	}
+
+	return layout.binScript("overlay.sh", args, nil), nil
+}
+
+// SetQuotaRequest sets the disk quota of a container's user on the depot.
+type SetQuotaRequest struct {
+	UID uint32
+
+	BlockSoft uint64
+	BlockHard uint64
+	InodeSoft uint64
+	InodeHard uint64
+
+	Output
+}
+
+func (request SetQuotaRequest) command(layout Layout) (*exec.Cmd, error) {
+	if !layout.pooledUID(uint64(request.UID)) {
+		return nil, InvalidRequestError{"uid", fmt.Sprintf("%d", request.UID)}
+	}
+
+	cmd := exec.Command(
+		"setquota",
+		"-u",
+		fmt.Sprintf("%d", request.UID),
+		fmt.Sprintf("%d", request.BlockSoft),
+		fmt.Sprintf("%d", request.BlockHard),
+		fmt.Sprintf("%d", request.InodeSoft),
+		fmt.Sprintf("%d", request.InodeHard),
+		layout.QuotaMountPoint,
+	)
+
+	cmd.Env = helperEnv(nil)
+
+	return cmd, nil
+}
+
+// RepquotaRequest reports the disk quota and usage of a container's user on
+// the depot.
+type RepquotaRequest struct {
+	UID uint32
+
+	Output
+}
+
+func (request RepquotaRequest) command(layout Layout) (*exec.Cmd, error) {
+	return layout.binScript("repquota", []string{
+		layout.QuotaMountPoint,
+		fmt.Sprintf("%d", request.UID),
+	}, nil), nil
+}
+
+// ListRulesRequest lists the rules of an iptables filter chain.
+type ListRulesRequest struct {
+	Chain string
+
+	Output
+}
+
+func (request ListRulesRequest) command(layout Layout) (*exec.Cmd, error) {
+	if !validChain.MatchString(request.Chain) {
+		return nil, InvalidRequestError{"chain", request.Chain}
+	}
+
+	cmd := exec.Command("iptables", "-w", "-S", request.Chain)
+	cmd.Env = helperEnv(nil)
+
+	return cmd, nil
+}
+
+// ApplyRulesRequest adds rules to containers' instance chains in a table,
+// all at once, with iptables-restore.
+type ApplyRulesRequest struct {
+	Table string
+	Rules []string
+
+	Output
+}
+
+func (request ApplyRulesRequest) command(layout Layout) (*exec.Cmd, error) {
+	var prefix string
+
+	switch request.Table {
+	case "filter":
+		prefix = layout.IPTables.Filter.InstancePrefix
+	case "nat":
+		prefix = layout.IPTables.NAT.InstancePrefix
+	default:
+		return nil, InvalidRequestError{"table", request.Table}
+	}
+
+	input := new(bytes.Buffer)
+
+	fmt.Fprintf(input, "*%s\n", request.Table)
+
+	for _, rule := range request.Rules {
+		fields, err := ruleFields(prefix, rule)
+		if err != nil {
+			return nil, err
+		}
+
+		fmt.Fprintln(input, strings.Join(fields, " "))
+	}
+
+	fmt.Fprintln(input, "COMMIT")
+
+	cmd := exec.Command("iptables-restore", "--noflush")
+	cmd.Env = helperEnv(nil)
+	cmd.Stdin = input
+
+	return cmd, nil
+}
+
+var (
+	// containers' IDs are all that is taken from requests for the paths of
+	// their directories
+	validID = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+	validNumber = regexp.MustCompile(`^[0-9]+$`)
+	validBool   = regexp.MustCompile(`^(true|false)$`)
+
+	// space-separated IPs, or host_ip,container_ip pairs of them
+	validIPs = regexp.MustCompile(`^[0-9A-Fa-f.:, ]*$`)
+
+	// interface names, AppArmor profiles and SELinux labels
+	validName = regexp.MustCompile(`^[A-Za-z0-9_.:,/-]*$`)
+
+	// space-separated nameservers and search domains
+	validWords = regexp.MustCompile(`^[A-Za-z0-9_.: -]*$`)
+
+	validNetwork = regexp.MustCompile(`^[0-9A-Fa-f.:/-]+$`)
+
+	validChain = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+	validPathChars = regexp.MustCompile(`^[A-Za-z0-9_.@+/-]+$`)
+)
+
+// validPath accepts clean, absolute paths without spaces or anything the
+// shell would make something of.
+func validPath(p string) bool {
+	return path.IsAbs(p) && path.Clean(p) == p && validPathChars.MatchString(p)
+}
+
+func checkNetworks(field string, networks ...string) error {
+	for _, network := range networks {
+		if !validNetwork.MatchString(network) {
+			return InvalidRequestError{field, network}
+		}
+	}
+
+	return nil
+}
+
+// containerPath is the depot directory of the container with the ID.
+func (layout Layout) containerPath(id string) (string, error) {
+	if !validID.MatchString(id) {
+		return "", InvalidRequestError{"container ID", id}
+	}
+
+	return path.Join(layout.DepotPath, id), nil
+}
+
+// checkRootFS fails unless the rootfs is the container's overlay or an
+// image mounted in the graph, so that a container cannot be made of the
+// host's own directories.
+func (layout Layout) checkRootFS(id string, rootfsPath string) error {
+	if rootfsPath == path.Join(layout.OverlaysPath, id, "rootfs") || under(layout.GraphRoot, rootfsPath) {
+		return nil
+	}
+
+	return InvalidRequestError{"rootfs_path", rootfsPath}
+}
+
+// overlayBase is whether an overlay may be made of the rootfs.
+func (layout Layout) overlayBase(rootfsPath string) bool {
+	for _, allowed := range layout.RootFSPaths {
+		if allowed != "" && rootfsPath == path.Clean(allowed) {
+			return true
+		}
+	}
+
+	return under(layout.GraphRoot, rootfsPath)
+}
+
+func (layout Layout) pooledUID(uid uint64) bool {
+	start := uint64(layout.UIDPoolStart)
+	return uid >= start && uid < start+uint64(layout.UIDPoolSize)
+}
+
+// under is whether p is beneath dir, which must be given.
+func under(dir string, p string) bool {
+	if dir == "" {
+		return false
+	}
+
+	return strings.HasPrefix(p, path.Clean(dir)+"/")
+}
+
+func (layout Layout) skeletonPath() string {
+	return path.Join(layout.BinPath, "..", "skeleton")
+}
+
+func (layout Layout) graveyardPath() string {
+	return path.Join(layout.DepotPath, "tmp", "reaping")
+}
+
+func (layout Layout) binScript(script string, args []string, env []string) *exec.Cmd {
+	cmd := exec.Command(path.Join(layout.BinPath, script), args...)
+	cmd.Env = helperEnv(env)
+
+	return cmd
+}
+
+// containerScript runs the script of the skeleton that the container was
+// created from, rather than its copy in the container's directory, in the
+// container's directory. The directory is checked first, as the script
+// sources its config and runs what is in its bin and lib.
+func (layout Layout) containerScript(id string, script string, args []string, env []string) (*exec.Cmd, error) {
+	containerPath, err := layout.containerPath(id)
+	if err != nil {
+		return nil, err
+	}
+
+	err = checkOwned(
+		containerPath,
+		path.Join(containerPath, "bin"),
+		path.Join(containerPath, "etc"),
+		path.Join(containerPath, "etc", "config"),
+		path.Join(containerPath, "lib"),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	cmd := exec.Command(path.Join(layout.skeletonPath(), script), args...)
+	cmd.Env = helperEnv(append(env, "container_path="+containerPath))
+
+	return cmd, nil
+}
+
+// checkOwned fails unless each path is owned by the helper's user, is
+// writable by no one else and is not a symlink.
+func checkOwned(paths ...string) error {
+	for _, p := range paths {
+		info, err := os.Lstat(p)
+		if err != nil {
+			return err
+		}
+
+		stat, ok := info.Sys().(*syscall.Stat_t)
+		if !ok || int(stat.Uid) != os.Geteuid() || info.Mode()&os.ModeSymlink != 0 || info.Mode().Perm()&0022 != 0 {
+			return UnsafePathError{p}
+		}
+	}
+
+	return nil
+}
+
+// helperEnv is all the environment the helper's commands have: what it
+// built from the request, and its own $PATH.
+func helperEnv(env []string) []string {
+	return append(env, "PATH="+os.Getenv("PATH"))
+}
+
+func parseUint(s string) (uint64, error) {
+	return strconv.ParseUint(s, 10, 64)
+}
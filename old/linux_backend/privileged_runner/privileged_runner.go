@@ -0,0 +1,535 @@
+// Package privileged_runner carries out the operations through which the
+// backend changes the host as root (its scripts, iptables and quotas) in a
+// separate helper process, reached over RPC on a unix socket, so that they
+// are all that is done as root on the server's behalf.
+//
+// The server sends operations, not commands: the helper builds each
+// command's arguments and environment itself, from fields it has checked,
+// and runs containers' scripts from its own skeleton rather than from
+// their depot directories.
+//
+// This narrows what a server's requests can make the helper do; it does
+// not let the server run unprivileged. The server still needs root for
+// what it does itself: starting wsh, nstar and packet captures, mounting
+// images through the graph driver, writing cgroups and the core pattern,
+// and writing the hooks and environment of containers' depot directories,
+// which the helper creates as root.
+package privileged_runner
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/rpc"
+	"os/exec"
+	"path"
+	"strings"
+
+	"github.com/cloudfoundry/gunk/command_runner"
+	"github.com/pivotal-golang/lager"
+
+	"github.com/cloudfoundry-incubator/garden-linux/old/linux_backend/bounded_runner"
+	"github.com/cloudfoundry-incubator/garden-linux/old/sysconfig"
+)
+
+// Layout is where the server keeps what the helper acts on, as given to
+// both by the same flags.
+type Layout struct {
+	BinPath      string
+	DepotPath    string
+	OverlaysPath string
+
+	// where images are mounted, which containers' rootfses and overlays'
+	// bases may be under, and the rootfses, besides, that overlays may be
+	// made of
+	GraphRoot   string
+	RootFSPaths []string
+
+	// the uids that containers' users may be given
+	UIDPoolStart uint32
+	UIDPoolSize  uint32
+
+	// the mount point of the depot, whose quotas are set
+	QuotaMountPoint string
+
+	IPTables sysconfig.IPTablesConfig
+}
+
+// UnsupportedCommandError is returned for commands that the helper runs,
+// but not with the given arguments, environment or input.
+type UnsupportedCommandError struct {
+	Args []string
+}
+
+func (e UnsupportedCommandError) Error() string {
+	return fmt.Sprintf("command not supported by the privileged helper: %v", e.Args)
+}
+
+// Response is what a command wrote, and why it failed, if it did.
+type Response struct {
+	Stdout []byte
+	Stderr []byte
+
+	Error string
+}
+
+// Helper carries out requested operations as the user it runs as.
+type Helper struct {
+	runner command_runner.CommandRunner
+	layout Layout
+	logger lager.Logger
+}
+
+func NewHelper(runner command_runner.CommandRunner, layout Layout, logger lager.Logger) *Helper {
+	return &Helper{
+		runner: runner,
+		layout: layout,
+		logger: logger,
+	}
+}
+
+// Serve serves the helper to connections accepted from the listener until
+// it is closed.
+func Serve(listener net.Listener, helper *Helper) error {
+	server := rpc.NewServer()
+
+	err := server.RegisterName("PrivilegedHelper", helper)
+	if err != nil {
+		return err
+	}
+
+	server.Accept(listener)
+
+	return nil
+}
+
+type request interface {
+	command(Layout) (*exec.Cmd, error)
+}
+
+func (helper *Helper) Net(request NetRequest, response *Response) error {
+	return helper.run("net", request, request.Output, response)
+}
+
+func (helper *Helper) NetRate(request NetRateRequest, response *Response) error {
+	return helper.run("net-rate", request, request.Output, response)
+}
+
+func (helper *Helper) Start(request StartRequest, response *Response) error {
+	return helper.run("start", request, request.Output, response)
+}
+
+func (helper *Helper) Stop(request StopRequest, response *Response) error {
+	return helper.run("stop", request, request.Output, response)
+}
+
+func (helper *Helper) SetUpHost(request SetUpHostRequest, response *Response) error {
+	return helper.run("set-up-host", request, request.Output, response)
+}
+
+func (helper *Helper) GrowPool(request GrowPoolRequest, response *Response) error {
+	return helper.run("grow-pool", request, request.Output, response)
+}
+
+func (helper *Helper) FilterDefault(request FilterDefaultRequest, response *Response) error {
+	return helper.run("filter-default", request, request.Output, response)
+}
+
+func (helper *Helper) Create(request CreateRequest, response *Response) error {
+	return helper.run("create", request, request.Output, response)
+}
+
+func (helper *Helper) Destroy(request DestroyRequest, response *Response) error {
+	return helper.run("destroy", request, request.Output, response)
+}
+
+func (helper *Helper) Overlay(request OverlayRequest, response *Response) error {
+	return helper.run("overlay", request, request.Output, response)
+}
+
+func (helper *Helper) SetQuota(request SetQuotaRequest, response *Response) error {
+	return helper.run("set-quota", request, request.Output, response)
+}
+
+func (helper *Helper) Repquota(request RepquotaRequest, response *Response) error {
+	return helper.run("repquota", request, request.Output, response)
+}
+
+func (helper *Helper) ListRules(request ListRulesRequest, response *Response) error {
+	return helper.run("list-rules", request, request.Output, response)
+}
+
+func (helper *Helper) ApplyRules(request ApplyRulesRequest, response *Response) error {
+	return helper.run("apply-rules", request, request.Output, response)
+}
+
+// run runs the request's command. Failures of the command itself are
+// reported in the response, rather than failing the call.
+func (helper *Helper) run(operation string, request request, output Output, response *Response) error {
+	cmd, err := request.command(helper.layout)
+	if err != nil {
+		helper.logger.Info("rejected", lager.Data{
+			"operation": operation,
+			"error":     err.Error(),
+		})
+
+		return err
+	}
+
+	stdout := new(bytes.Buffer)
+	stderr := new(bytes.Buffer)
+
+	cmd.Stdout = stdout
+	if output.Combined {
+		cmd.Stderr = stdout
+	} else {
+		cmd.Stderr = stderr
+	}
+
+	err = helper.runner.Run(cmd)
+	if err != nil {
+		response.Error = err.Error()
+	}
+
+	response.Stdout = stdout.Bytes()
+	response.Stderr = stderr.Bytes()
+
+	return nil
+}
+
+type runner struct {
+	command_runner.CommandRunner
+
+	client *rpc.Client
+	layout Layout
+}
+
+// New returns a command runner that has the helper carry out what the
+// commands that it runs, when run with Run, amount to, and runs the rest
+// itself. Commands started rather than run, e.g. wsh and long-running
+// hooks, are not sent to the helper.
+func New(commandRunner command_runner.CommandRunner, client *rpc.Client, layout Layout) command_runner.CommandRunner {
+	return &runner{
+		CommandRunner: commandRunner,
+
+		client: client,
+		layout: layout,
+	}
+}
+
+var errNotPrivileged = errors.New("not run by the privileged helper")
+
+func (runner *runner) Run(cmd *exec.Cmd) error {
+	if len(cmd.Args) == 0 || cmd.Dir != "" {
+		return runner.CommandRunner.Run(cmd)
+	}
+
+	method, request, err := runner.layout.operation(cmd)
+	if err == errNotPrivileged {
+		return runner.CommandRunner.Run(cmd)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	response := Response{}
+
+	err = runner.client.Call("PrivilegedHelper."+method, request, &response)
+	if err != nil {
+		return err
+	}
+
+	err = write(cmd.Stdout, response.Stdout)
+	if err != nil {
+		return err
+	}
+
+	err = write(cmd.Stderr, response.Stderr)
+	if err != nil {
+		return err
+	}
+
+	if response.Error != "" {
+		return errors.New(response.Error)
+	}
+
+	return nil
+}
+
+// operation is the helper's operation that the command, as the backend
+// runs it, amounts to: the name of its method and its request. Commands
+// that the helper does not run are errNotPrivileged.
+func (layout Layout) operation(cmd *exec.Cmd) (string, interface{}, error) {
+	cmdPath := cmd.Args[0]
+	args := cmd.Args[1:]
+	env := envVars(cmd.Env)
+
+	output := Output{Combined: bounded_runner.SameWriter(cmd.Stdout, cmd.Stderr)}
+
+	unsupported := UnsupportedCommandError{cmd.Args}
+
+	switch {
+	case cmdPath == "iptables":
+		if len(args) != 3 || args[0] != "-w" || args[1] != "-S" {
+			return "", nil, unsupported
+		}
+
+		return "ListRules", ListRulesRequest{Chain: args[2], Output: output}, nil
+
+	case cmdPath == "iptables-restore":
+		if len(args) != 1 || args[0] != "--noflush" || cmd.Stdin == nil {
+			return "", nil, unsupported
+		}
+
+		table, rules, err := readRules(cmd.Stdin)
+		if err != nil {
+			return "", nil, unsupported
+		}
+
+		return "ApplyRules", ApplyRulesRequest{Table: table, Rules: rules, Output: output}, nil
+
+	case cmdPath == "setquota":
+		if len(args) != 7 || args[0] != "-u" || args[6] != layout.QuotaMountPoint {
+			return "", nil, unsupported
+		}
+
+		limits := make([]uint64, 5)
+		for i := range limits {
+			var err error
+
+			limits[i], err = parseUint(args[i+1])
+			if err != nil {
+				return "", nil, unsupported
+			}
+		}
+
+		return "SetQuota", SetQuotaRequest{
+			UID:       uint32(limits[0]),
+			BlockSoft: limits[1],
+			BlockHard: limits[2],
+			InodeSoft: limits[3],
+			InodeHard: limits[4],
+			Output:    output,
+		}, nil
+
+	case path.Dir(cmdPath) == path.Clean(layout.BinPath):
+		return layout.binOperation(path.Base(cmdPath), args, env, output, unsupported)
+
+	case path.Dir(path.Dir(cmdPath)) == path.Clean(layout.DepotPath):
+		id := path.Base(path.Dir(cmdPath))
+		return containerOperation(id, path.Base(cmdPath), args, env, output, unsupported)
+	}
+
+	return "", nil, errNotPrivileged
+}
+
+func (layout Layout) binOperation(script string, args []string, env map[string]string, output Output, unsupported error) (string, interface{}, error) {
+	switch script {
+	case "setup.sh":
+		return "SetUpHost", SetUpHostRequest{
+			PoolNetwork:      env["POOL_NETWORK"],
+			DenyNetworks:     strings.Fields(env["DENY_NETWORKS"]),
+			AllowNetworks:    strings.Fields(env["ALLOW_NETWORKS"]),
+			DiskQuotaEnabled: env["DISK_QUOTA_ENABLED"] == "true",
+			AppArmorProfile:  env["APPARMOR_PROFILE"],
+			Output:           output,
+		}, nil
+
+	case "net.sh":
+		if len(args) != 1 {
+			return "", nil, unsupported
+		}
+
+		switch args[0] {
+		case "grow_pool":
+			return "GrowPool", GrowPoolRequest{
+				PoolNetwork:    env["POOL_NETWORK"],
+				OldPoolNetwork: env["OLD_POOL_NETWORK"],
+				Output:         output,
+			}, nil
+
+		case "filter_default":
+			return "FilterDefault", FilterDefaultRequest{
+				DenyNetworks:  strings.Fields(env["DENY_NETWORKS"]),
+				AllowNetworks: strings.Fields(env["ALLOW_NETWORKS"]),
+				Output:        output,
+			}, nil
+		}
+
+	case "create.sh":
+		if len(args) != 1 || path.Dir(args[0]) != path.Clean(layout.DepotPath) {
+			return "", nil, unsupported
+		}
+
+		delete(env, "id")
+
+		return "Create", CreateRequest{
+			ID:     path.Base(args[0]),
+			Vars:   env,
+			Output: output,
+		}, nil
+
+	case "destroy.sh":
+		if len(args) < 1 || len(args) > 2 || path.Dir(args[0]) != path.Clean(layout.DepotPath) {
+			return "", nil, unsupported
+		}
+
+		if len(args) == 2 && args[1] != layout.graveyardPath() {
+			return "", nil, unsupported
+		}
+
+		return "Destroy", DestroyRequest{
+			ID:     path.Base(args[0]),
+			Bury:   len(args) == 2,
+			Output: output,
+		}, nil
+
+	case "overlay.sh":
+		if len(args) < 2 || path.Dir(args[1]) != path.Clean(layout.OverlaysPath) {
+			return "", nil, unsupported
+		}
+
+		request := OverlayRequest{
+			Action: args[0],
+			ID:     path.Base(args[1]),
+			Output: output,
+		}
+
+		if len(args) > 2 {
+			request.RootFSPath = args[2]
+		}
+
+		if len(args) > 3 {
+			request.MountLabel = args[3]
+		}
+
+		return "Overlay", request, nil
+
+	case "repquota":
+		if len(args) != 2 || args[0] != layout.QuotaMountPoint {
+			return "", nil, unsupported
+		}
+
+		uid, err := parseUint(args[1])
+		if err != nil {
+			return "", nil, unsupported
+		}
+
+		return "Repquota", RepquotaRequest{UID: uint32(uid), Output: output}, nil
+
+	default:
+		return "", nil, errNotPrivileged
+	}
+
+	return "", nil, unsupported
+}
+
+func containerOperation(id string, script string, args []string, env map[string]string, output Output, unsupported error) (string, interface{}, error) {
+	switch script {
+	case "net.sh":
+		if len(args) != 1 {
+			return "", nil, unsupported
+		}
+
+		request := NetRequest{ID: id, Action: args[0], Output: output}
+
+		if args[0] == "check" {
+			var err error
+
+			request.FilterRules, err = parseUint(env["FILTER_RULES"])
+			if err != nil {
+				return "", nil, unsupported
+			}
+
+			request.NATRules, err = parseUint(env["NAT_RULES"])
+			if err != nil {
+				return "", nil, unsupported
+			}
+		}
+
+		return "Net", request, nil
+
+	case "net_rate.sh":
+		rate, err := parseUint(env["RATE"])
+		if err != nil {
+			return "", nil, unsupported
+		}
+
+		burst, err := parseUint(env["BURST"])
+		if err != nil {
+			return "", nil, unsupported
+		}
+
+		return "NetRate", NetRateRequest{ID: id, Rate: rate, Burst: burst, Output: output}, nil
+
+	case "start.sh":
+		mtu, err := parseUint(env["container_iface_mtu"])
+		if err != nil {
+			return "", nil, unsupported
+		}
+
+		return "Start", StartRequest{ID: id, MTU: mtu, Output: output}, nil
+
+	case "stop.sh":
+		kill := len(args) == 2 && args[0] == "-w" && args[1] == "0"
+		if len(args) != 0 && !kill {
+			return "", nil, unsupported
+		}
+
+		return "Stop", StopRequest{ID: id, Kill: kill, Output: output}, nil
+	}
+
+	return "", nil, errNotPrivileged
+}
+
+// readRules reads iptables-restore input of a single table's rules.
+func readRules(input io.Reader) (string, []string, error) {
+	content, err := ioutil.ReadAll(input)
+	if err != nil {
+		return "", nil, err
+	}
+
+	lines := []string{}
+
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+
+	if len(lines) < 2 || !strings.HasPrefix(lines[0], "*") || lines[len(lines)-1] != "COMMIT" {
+		return "", nil, errors.New("not a single table's rules")
+	}
+
+	return lines[0][1:], lines[1 : len(lines)-1], nil
+}
+
+// envVars are the variables of an environment by name, without $PATH, which
+// the helper sets itself.
+func envVars(env []string) map[string]string {
+	vars := map[string]string{}
+
+	for _, kv := range env {
+		segs := strings.SplitN(kv, "=", 2)
+		if len(segs) != 2 || segs[0] == "PATH" {
+			continue
+		}
+
+		vars[segs[0]] = segs[1]
+	}
+
+	return vars
+}
+
+func write(w io.Writer, output []byte) error {
+	if w == nil || len(output) == 0 {
+		return nil
+	}
+
+	_, err := w.Write(output)
+	return err
+}
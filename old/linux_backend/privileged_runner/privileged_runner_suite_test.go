@@ -0,0 +1,13 @@
+package privileged_runner_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"testing"
+)
+
+func TestPrivilegedRunner(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Privileged Runner Suite")
+}
@@ -0,0 +1,421 @@
+package privileged_runner_test
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"net"
+	"net/rpc"
+	"os"
+	"os/exec"
+	"path"
+	"strings"
+
+	"github.com/cloudfoundry/gunk/command_runner"
+	"github.com/cloudfoundry/gunk/command_runner/fake_command_runner"
+	. "github.com/cloudfoundry/gunk/command_runner/fake_command_runner/matchers"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/pivotal-golang/lager/lagertest"
+
+	"github.com/cloudfoundry-incubator/garden-linux/old/linux_backend/privileged_runner"
+	"github.com/cloudfoundry-incubator/garden-linux/old/sysconfig"
+)
+
+var _ = Describe("Privileged runner", func() {
+	var helperRunner *fake_command_runner.FakeCommandRunner
+	var localRunner *fake_command_runner.FakeCommandRunner
+
+	var tmpDir string
+	var layout privileged_runner.Layout
+	var containerPath string
+
+	var listener net.Listener
+	var client *rpc.Client
+
+	var runner command_runner.CommandRunner
+
+	BeforeEach(func() {
+		helperRunner = fake_command_runner.New()
+		localRunner = fake_command_runner.New()
+
+		var err error
+
+		tmpDir, err = ioutil.TempDir("", "privileged-runner")
+		Ω(err).ShouldNot(HaveOccurred())
+
+		err = os.Chmod(tmpDir, 0755)
+		Ω(err).ShouldNot(HaveOccurred())
+
+		layout = privileged_runner.Layout{
+			BinPath:         path.Join(tmpDir, "bin"),
+			DepotPath:       path.Join(tmpDir, "depot"),
+			OverlaysPath:    path.Join(tmpDir, "overlays"),
+			GraphRoot:       path.Join(tmpDir, "graph"),
+			RootFSPaths:     []string{"/some/rootfs"},
+			UIDPoolStart:    10000,
+			UIDPoolSize:     256,
+			QuotaMountPoint: "/depot-mount",
+			IPTables:        sysconfig.NewConfig("x").IPTables,
+		}
+
+		containerPath = path.Join(layout.DepotPath, "some-id")
+
+		for _, dir := range []string{"bin", "etc", "lib"} {
+			err = os.MkdirAll(path.Join(containerPath, dir), 0755)
+			Ω(err).ShouldNot(HaveOccurred())
+		}
+
+		err = ioutil.WriteFile(path.Join(containerPath, "etc", "config"), []byte("id=some-id\n"), 0644)
+		Ω(err).ShouldNot(HaveOccurred())
+
+		listener, err = net.Listen("unix", path.Join(tmpDir, "helper.sock"))
+		Ω(err).ShouldNot(HaveOccurred())
+
+		helper := privileged_runner.NewHelper(helperRunner, layout, lagertest.NewTestLogger("test"))
+
+		go privileged_runner.Serve(listener, helper)
+
+		client, err = rpc.Dial("unix", path.Join(tmpDir, "helper.sock"))
+		Ω(err).ShouldNot(HaveOccurred())
+
+		runner = privileged_runner.New(localRunner, client, layout)
+	})
+
+	AfterEach(func() {
+		client.Close()
+		listener.Close()
+		os.RemoveAll(tmpDir)
+	})
+
+	It("has the helper run containers' scripts from the skeleton, in the container's directory", func() {
+		err := runner.Run(exec.Command(path.Join(containerPath, "net.sh"), "setup"))
+		Ω(err).ShouldNot(HaveOccurred())
+
+		Ω(helperRunner).Should(HaveExecutedSerially(fake_command_runner.CommandSpec{
+			Path: path.Join(tmpDir, "skeleton", "net.sh"),
+			Args: []string{"setup"},
+			Env: []string{
+				"container_path=" + containerPath,
+				"PATH=" + os.Getenv("PATH"),
+			},
+		}))
+
+		Ω(localRunner.ExecutedCommands()).Should(BeEmpty())
+	})
+
+	It("has the helper run the backend's scripts", func() {
+		err := runner.Run(exec.Command(path.Join(layout.BinPath, "destroy.sh"), containerPath, path.Join(layout.DepotPath, "tmp", "reaping")))
+		Ω(err).ShouldNot(HaveOccurred())
+
+		Ω(helperRunner).Should(HaveExecutedSerially(fake_command_runner.CommandSpec{
+			Path: path.Join(layout.BinPath, "destroy.sh"),
+			Args: []string{containerPath, path.Join(layout.DepotPath, "tmp", "reaping")},
+		}))
+	})
+
+	It("has the helper set quotas on the depot", func() {
+		err := runner.Run(exec.Command("setquota", "-u", "10000", "1", "2", "3", "4", "/depot-mount"))
+		Ω(err).ShouldNot(HaveOccurred())
+
+		Ω(helperRunner).Should(HaveExecutedSerially(fake_command_runner.CommandSpec{
+			Path: "setquota",
+			Args: []string{"-u", "10000", "1", "2", "3", "4", "/depot-mount"},
+		}))
+	})
+
+	It("runs other commands itself", func() {
+		err := runner.Run(exec.Command(path.Join(containerPath, "bin", "wsh"), "ls"))
+		Ω(err).ShouldNot(HaveOccurred())
+
+		Ω(localRunner).Should(HaveExecutedSerially(fake_command_runner.CommandSpec{
+			Path: path.Join(containerPath, "bin", "wsh"),
+			Args: []string{"ls"},
+		}))
+
+		Ω(helperRunner.ExecutedCommands()).Should(BeEmpty())
+	})
+
+	It("builds the command's environment itself, from the settings it takes", func() {
+		cmd := exec.Command(path.Join(containerPath, "net.sh"), "check")
+		cmd.Env = []string{
+			"FILTER_RULES=3",
+			"NAT_RULES=1",
+			"PATH=/evil",
+			"LD_PRELOAD=/evil.so",
+			"SHELLOPTS=xtrace",
+			"PS4=$(evil)",
+			"BASH_FUNC_iptables%%=() { evil; }",
+		}
+
+		err := runner.Run(cmd)
+		Ω(err).ShouldNot(HaveOccurred())
+
+		Ω(helperRunner).Should(HaveExecutedSerially(fake_command_runner.CommandSpec{
+			Path: path.Join(tmpDir, "skeleton", "net.sh"),
+			Args: []string{"check"},
+			Env: []string{
+				"FILTER_RULES=3",
+				"NAT_RULES=1",
+				"container_path=" + containerPath,
+				"PATH=" + os.Getenv("PATH"),
+			},
+		}))
+	})
+
+	It("rebuilds iptables-restore's input from the rules", func() {
+		cmd := exec.Command("iptables-restore", "--noflush")
+		cmd.Stdin = strings.NewReader(`*filter
+-I w-x-instance-some-id 1 --protocol tcp --destination 1.2.3.4 --destination-port 80 --jump RETURN
+-I w-x-instance-some-id 1 --protocol tcp --destination 1.2.3.4 --destination-port 80 --jump LOG --log-prefix "w-x-instance-some-id "
+COMMIT
+`)
+
+		err := runner.Run(cmd)
+		Ω(err).ShouldNot(HaveOccurred())
+
+		Ω(helperRunner).Should(HaveExecutedSerially(fake_command_runner.CommandSpec{
+			Path: "iptables-restore",
+			Args: []string{"--noflush"},
+			Stdin: `*filter
+-I w-x-instance-some-id 1 --protocol tcp --destination 1.2.3.4 --destination-port 80 --jump RETURN
+-I w-x-instance-some-id 1 --protocol tcp --destination 1.2.3.4 --destination-port 80 --jump LOG --log-prefix "w-x-instance-some-id "
+COMMIT
+`,
+		}))
+	})
+
+	It("writes back the command's output", func() {
+		helperRunner.WhenRunning(fake_command_runner.CommandSpec{
+			Path: path.Join(tmpDir, "skeleton", "net.sh"),
+		}, func(cmd *exec.Cmd) error {
+			cmd.Stdout.Write([]byte("some-stdout"))
+			cmd.Stderr.Write([]byte("some-stderr"))
+			return nil
+		})
+
+		stdout := new(bytes.Buffer)
+		stderr := new(bytes.Buffer)
+
+		cmd := exec.Command(path.Join(containerPath, "net.sh"), "usage")
+		cmd.Stdout = stdout
+		cmd.Stderr = stderr
+
+		err := runner.Run(cmd)
+		Ω(err).ShouldNot(HaveOccurred())
+
+		Ω(stdout.String()).Should(Equal("some-stdout"))
+		Ω(stderr.String()).Should(Equal("some-stderr"))
+	})
+
+	It("keeps combined output combined", func() {
+		helperRunner.WhenRunning(fake_command_runner.CommandSpec{
+			Path: path.Join(tmpDir, "skeleton", "net.sh"),
+		}, func(cmd *exec.Cmd) error {
+			cmd.Stdout.Write([]byte("out "))
+			cmd.Stderr.Write([]byte("err "))
+			cmd.Stdout.Write([]byte("out"))
+			return nil
+		})
+
+		output := new(bytes.Buffer)
+
+		cmd := exec.Command(path.Join(containerPath, "net.sh"), "usage")
+		cmd.Stdout = output
+		cmd.Stderr = output
+
+		err := runner.Run(cmd)
+		Ω(err).ShouldNot(HaveOccurred())
+
+		Ω(output.String()).Should(Equal("out err out"))
+	})
+
+	It("returns the command's failure, with its output", func() {
+		helperRunner.WhenRunning(fake_command_runner.CommandSpec{
+			Path: path.Join(tmpDir, "skeleton", "net.sh"),
+		}, func(cmd *exec.Cmd) error {
+			cmd.Stderr.Write([]byte("no such chain"))
+			return errors.New("exit status 1")
+		})
+
+		stderr := new(bytes.Buffer)
+
+		cmd := exec.Command(path.Join(containerPath, "net.sh"), "setup")
+		cmd.Stderr = stderr
+
+		err := runner.Run(cmd)
+		Ω(err).Should(MatchError("exit status 1"))
+
+		Ω(stderr.String()).Should(Equal("no such chain"))
+	})
+
+	It("fails commands that the helper runs, but not as given", func() {
+		err := runner.Run(exec.Command("iptables", "--modprobe=/tmp/evil", "-S", "FORWARD"))
+		Ω(err).Should(BeAssignableToTypeOf(privileged_runner.UnsupportedCommandError{}))
+
+		Ω(helperRunner.ExecutedCommands()).Should(BeEmpty())
+		Ω(localRunner.ExecutedCommands()).Should(BeEmpty())
+	})
+
+	Describe("the helper", func() {
+		call := func(method string, request interface{}) error {
+			return client.Call("PrivilegedHelper."+method, request, &privileged_runner.Response{})
+		}
+
+		It("refuses container IDs that are not plain names", func() {
+			err := call("Net", privileged_runner.NetRequest{ID: "../../tmp", Action: "setup"})
+			Ω(err).Should(HaveOccurred())
+
+			Ω(helperRunner.ExecutedCommands()).Should(BeEmpty())
+		})
+
+		It("refuses actions that net.sh is not run with", func() {
+			err := call("Net", privileged_runner.NetRequest{ID: "some-id", Action: "teardown"})
+			Ω(err).Should(HaveOccurred())
+
+			Ω(helperRunner.ExecutedCommands()).Should(BeEmpty())
+		})
+
+		It("refuses to run the scripts of containers whose directories others could change", func() {
+			err := os.Chmod(path.Join(containerPath, "etc"), 0777)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			err = call("Net", privileged_runner.NetRequest{ID: "some-id", Action: "setup"})
+			Ω(err).Should(MatchError(privileged_runner.UnsafePathError{path.Join(containerPath, "etc")}.Error()))
+
+			Ω(helperRunner.ExecutedCommands()).Should(BeEmpty())
+		})
+
+		It("refuses to run the scripts of containers whose config is a symlink", func() {
+			configPath := path.Join(containerPath, "etc", "config")
+
+			err := os.Remove(configPath)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			err = os.Symlink("/tmp/evil", configPath)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			err = call("Start", privileged_runner.StartRequest{ID: "some-id", MTU: 1500})
+			Ω(err).Should(MatchError(privileged_runner.UnsafePathError{configPath}.Error()))
+		})
+
+		It("refuses create.sh settings it does not know", func() {
+			err := call("Create", privileged_runner.CreateRequest{
+				ID:   "some-id",
+				Vars: map[string]string{"BASH_ENV": "/tmp/evil.sh"},
+			})
+			Ω(err).Should(HaveOccurred())
+
+			Ω(helperRunner.ExecutedCommands()).Should(BeEmpty())
+		})
+
+		It("refuses create.sh settings with values the shell would make something of", func() {
+			err := call("Create", privileged_runner.CreateRequest{
+				ID:   "some-id",
+				Vars: map[string]string{"rootfs_path": "/rootfs; evil"},
+			})
+			Ω(err).Should(HaveOccurred())
+
+			Ω(helperRunner.ExecutedCommands()).Should(BeEmpty())
+		})
+
+		Describe("creating containers", func() {
+			var vars map[string]string
+
+			BeforeEach(func() {
+				vars = map[string]string{
+					"rootfs_path": path.Join(layout.OverlaysPath, "some-id", "rootfs"),
+					"user_uid":    "10001",
+				}
+			})
+
+			It("creates containers of their overlay or of images in the graph", func() {
+				err := call("Create", privileged_runner.CreateRequest{ID: "some-id", Vars: vars})
+				Ω(err).ShouldNot(HaveOccurred())
+
+				vars["rootfs_path"] = path.Join(layout.GraphRoot, "aufs", "mnt", "some-image")
+
+				err = call("Create", privileged_runner.CreateRequest{ID: "some-id", Vars: vars})
+				Ω(err).ShouldNot(HaveOccurred())
+
+				Ω(helperRunner.ExecutedCommands()).Should(HaveLen(2))
+			})
+
+			for _, rootfsPath := range []string{"/", "/etc", "/some/rootfs"} {
+				rootfsPath := rootfsPath
+
+				It("refuses rootfs "+rootfsPath, func() {
+					vars["rootfs_path"] = rootfsPath
+
+					err := call("Create", privileged_runner.CreateRequest{ID: "some-id", Vars: vars})
+					Ω(err).Should(MatchError(privileged_runner.InvalidRequestError{"rootfs_path", rootfsPath}.Error()))
+
+					Ω(helperRunner.ExecutedCommands()).Should(BeEmpty())
+				})
+			}
+
+			It("refuses another container's overlay", func() {
+				vars["rootfs_path"] = path.Join(layout.OverlaysPath, "other-id", "rootfs")
+
+				err := call("Create", privileged_runner.CreateRequest{ID: "some-id", Vars: vars})
+				Ω(err).Should(HaveOccurred())
+
+				Ω(helperRunner.ExecutedCommands()).Should(BeEmpty())
+			})
+
+			for _, uid := range []string{"0", "9999", "10256"} {
+				uid := uid
+
+				It("refuses uid "+uid+", outside of the pool", func() {
+					vars["user_uid"] = uid
+
+					err := call("Create", privileged_runner.CreateRequest{ID: "some-id", Vars: vars})
+					Ω(err).Should(MatchError(privileged_runner.InvalidRequestError{"user_uid", uid}.Error()))
+
+					Ω(helperRunner.ExecutedCommands()).Should(BeEmpty())
+				})
+			}
+		})
+
+		It("makes overlays only of the rootfses it is given and images in the graph", func() {
+			for _, base := range []string{"/some/rootfs", path.Join(layout.GraphRoot, "aufs", "mnt", "some-image")} {
+				err := call("Overlay", privileged_runner.OverlayRequest{Action: "create", ID: "some-id", RootFSPath: base})
+				Ω(err).ShouldNot(HaveOccurred())
+			}
+
+			for _, base := range []string{"/", "/etc", "/some"} {
+				err := call("Overlay", privileged_runner.OverlayRequest{Action: "create", ID: "some-id", RootFSPath: base})
+				Ω(err).Should(MatchError(privileged_runner.InvalidRequestError{"rootfs path", base}.Error()))
+			}
+
+			Ω(helperRunner.ExecutedCommands()).Should(HaveLen(2))
+		})
+
+		It("refuses to set quotas of uids outside of the pool", func() {
+			err := call("SetQuota", privileged_runner.SetQuotaRequest{UID: 0, BlockHard: 1})
+			Ω(err).Should(HaveOccurred())
+
+			Ω(helperRunner.ExecutedCommands()).Should(BeEmpty())
+		})
+
+		It("refuses rules outside of containers' instance chains", func() {
+			err := call("ApplyRules", privileged_runner.ApplyRulesRequest{
+				Table: "filter",
+				Rules: []string{"-I INPUT 1 --jump ACCEPT"},
+			})
+			Ω(err).Should(HaveOccurred())
+
+			Ω(helperRunner.ExecutedCommands()).Should(BeEmpty())
+		})
+
+		It("refuses rules with options containers' rules are not made of", func() {
+			err := call("ApplyRules", privileged_runner.ApplyRulesRequest{
+				Table: "filter",
+				Rules: []string{"-A w-x-instance-some-id --modprobe /tmp/evil --jump RETURN"},
+			})
+			Ω(err).Should(HaveOccurred())
+
+			Ω(helperRunner.ExecutedCommands()).Should(BeEmpty())
+		})
+	})
+})
@@ -0,0 +1,113 @@
+package privileged_runner
+
+import (
+	"regexp"
+	"strings"
+)
+
+// ruleOptions are the iptables options that containers' rules are made of,
+// and what their values may be. Anything else, e.g. --modprobe, which has
+// iptables run a program of the caller's choosing, is refused.
+var ruleOptions = map[string]*regexp.Regexp{
+	"--protocol":         regexp.MustCompile(`^[a-z]+$`),
+	"--destination":      validRuleValue,
+	"--destination-port": validRuleValue,
+	"--dst-range":        validRuleValue,
+	"--icmp-type":        validRuleValue,
+	"--to-destination":   validRuleValue,
+	"-m":                 regexp.MustCompile(`^iprange$`),
+	"--jump":             regexp.MustCompile(`^(RETURN|DNAT|LOG)$`),
+	"--log-prefix":       regexp.MustCompile(`^[A-Za-z0-9_.-]+ ?$`),
+}
+
+var validRuleValue = regexp.MustCompile(`^[A-Za-z0-9.:/-]+$`)
+
+// ruleFields checks that the rule only adds to a container's instance
+// chain, whose names start with the prefix, and only with known options,
+// and returns it as fields for iptables-restore, quoted as it needs them.
+func ruleFields(prefix, rule string) ([]string, error) {
+	fields, ok := splitRule(rule)
+	if !ok || len(fields) < 2 {
+		return nil, InvalidRequestError{"rule", rule}
+	}
+
+	if fields[0] != "-A" && fields[0] != "-I" {
+		return nil, InvalidRequestError{"rule", rule}
+	}
+
+	chain := fields[1]
+	if !strings.HasPrefix(chain, prefix) || !validChain.MatchString(chain) {
+		return nil, InvalidRequestError{"chain", chain}
+	}
+
+	built := []string{fields[0], chain}
+
+	opts := fields[2:]
+
+	// rules may be inserted at a position
+	if fields[0] == "-I" && len(opts) > 0 && validNumber.MatchString(opts[0]) {
+		built = append(built, opts[0])
+		opts = opts[1:]
+	}
+
+	if len(opts)%2 != 0 {
+		return nil, InvalidRequestError{"rule", rule}
+	}
+
+	for i := 0; i < len(opts); i += 2 {
+		option, value := opts[i], opts[i+1]
+
+		valid, known := ruleOptions[option]
+		if !known || !valid.MatchString(value) {
+			return nil, InvalidRequestError{"rule", rule}
+		}
+
+		if option == "--log-prefix" {
+			value = `"` + value + `"`
+		}
+
+		built = append(built, option, value)
+	}
+
+	return built, nil
+}
+
+// splitRule splits a rule into fields as iptables-restore does: on spaces,
+// other than within double quotes.
+func splitRule(rule string) ([]string, bool) {
+	fields := []string{}
+
+	field := ""
+	inField := false
+	quoted := false
+
+	for _, r := range rule {
+		switch {
+		case r == '"':
+			quoted = !quoted
+			inField = true
+
+		case r == ' ' && !quoted:
+			if inField {
+				fields = append(fields, field)
+			}
+
+			field = ""
+			inField = false
+
+		default:
+			field += string(r)
+			inField = true
+		}
+	}
+
+	if quoted {
+		return nil, false
+	}
+
+	if inField {
+		fields = append(fields, field)
+	}
+
+	return fields, true
+}
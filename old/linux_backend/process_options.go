@@ -0,0 +1,246 @@
+package linux_backend
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cloudfoundry-incubator/garden/api"
+
+	"github.com/cloudfoundry-incubator/garden-linux/old/linux_backend/process_tracker"
+)
+
+// Processes run through the garden API can ask for what a ProcessSpec
+// cannot express with these environment variables, which are taken out of
+// the process's environment rather than passed to it.
+const (
+	// never, the default, on-failure or always
+	RestartPolicyEnv = "GARDEN_RESTART_POLICY"
+
+	// Go durations: the delay before the first restart, which doubles with
+	// each restart up to the maximum; DefaultRestartBackoff and
+	// DefaultRestartMaxBackoff if not given
+	RestartBackoffEnv    = "GARDEN_RESTART_BACKOFF"
+	RestartMaxBackoffEnv = "GARDEN_RESTART_MAX_BACKOFF"
+
+	// a command, split on spaces, or a port to probe the process's liveness
+	// with; see LivenessProbe
+	LivenessCommandEnv = "GARDEN_LIVENESS_COMMAND"
+	LivenessPortEnv    = "GARDEN_LIVENESS_PORT"
+
+	// how to probe it; the defaults below if not given
+	LivenessIntervalEnv         = "GARDEN_LIVENESS_INTERVAL"
+	LivenessTimeoutEnv          = "GARDEN_LIVENESS_TIMEOUT"
+	LivenessFailureThresholdEnv = "GARDEN_LIVENESS_FAILURE_THRESHOLD"
+	LivenessRestartEnv          = "GARDEN_LIVENESS_RESTART"
+
+	// the ID of another of the container's processes whose namespaces to
+	// run the process in; see RunInNamespacesOf
+	JoinProcessEnv = "GARDEN_JOIN_PROCESS"
+)
+
+const (
+	DefaultRestartBackoff    = time.Second
+	DefaultRestartMaxBackoff = time.Minute
+
+	DefaultLivenessInterval         = 10 * time.Second
+	DefaultLivenessTimeout          = time.Second
+	DefaultLivenessFailureThreshold = 3
+)
+
+var processOptionEnvs = map[string]bool{
+	RestartPolicyEnv:     true,
+	RestartBackoffEnv:    true,
+	RestartMaxBackoffEnv: true,
+
+	LivenessCommandEnv:          true,
+	LivenessPortEnv:             true,
+	LivenessIntervalEnv:         true,
+	LivenessTimeoutEnv:          true,
+	LivenessFailureThresholdEnv: true,
+	LivenessRestartEnv:          true,
+
+	JoinProcessEnv: true,
+}
+
+type InvalidProcessOptionError struct {
+	Name  string
+	Value string
+}
+
+func (e InvalidProcessOptionError) Error() string {
+	return fmt.Sprintf("invalid %s: %q", e.Name, e.Value)
+}
+
+// processOptions are what a process asked for in its environment.
+type processOptions struct {
+	// nil if it is not to be restarted
+	restart *process_tracker.RestartPolicy
+
+	// nil if it is not to be probed
+	liveness *LivenessProbe
+
+	// nil if it is to be run in wshd's namespaces
+	joinProcess *uint32
+}
+
+// processOptionsFrom takes the options out of the spec's environment,
+// returning the spec without them.
+func processOptionsFrom(spec api.ProcessSpec) (processOptions, api.ProcessSpec, error) {
+	values := map[string]string{}
+
+	var env []string
+	for _, envVar := range spec.Env {
+		segs := strings.SplitN(envVar, "=", 2)
+
+		if !processOptionEnvs[segs[0]] {
+			env = append(env, envVar)
+			continue
+		}
+
+		if len(segs) == 2 {
+			values[segs[0]] = segs[1]
+		}
+	}
+
+	if len(values) == 0 {
+		return processOptions{}, spec, nil
+	}
+
+	spec.Env = env
+
+	var options processOptions
+
+	restart, err := restartPolicyFrom(values)
+	if err != nil {
+		return processOptions{}, spec, err
+	}
+
+	options.restart = restart
+
+	liveness, err := livenessProbeFrom(values)
+	if err != nil {
+		return processOptions{}, spec, err
+	}
+
+	options.liveness = liveness
+
+	if value, found := values[JoinProcessEnv]; found {
+		processID, err := strconv.ParseUint(value, 10, 32)
+		if err != nil || options.restart != nil {
+			// a restarted process could not rejoin namespaces that are gone
+			return processOptions{}, spec, InvalidProcessOptionError{JoinProcessEnv, value}
+		}
+
+		joinProcess := uint32(processID)
+		options.joinProcess = &joinProcess
+	}
+
+	return options, spec, nil
+}
+
+func restartPolicyFrom(values map[string]string) (*process_tracker.RestartPolicy, error) {
+	mode := process_tracker.RestartMode(values[RestartPolicyEnv])
+
+	switch mode {
+	case "", process_tracker.RestartNever:
+		return nil, nil
+	case process_tracker.RestartOnFailure, process_tracker.RestartAlways:
+	default:
+		return nil, InvalidProcessOptionError{RestartPolicyEnv, string(mode)}
+	}
+
+	policy := process_tracker.RestartPolicy{
+		Mode:       mode,
+		Backoff:    DefaultRestartBackoff,
+		MaxBackoff: DefaultRestartMaxBackoff,
+	}
+
+	for name, backoff := range map[string]*time.Duration{
+		RestartBackoffEnv:    &policy.Backoff,
+		RestartMaxBackoffEnv: &policy.MaxBackoff,
+	} {
+		value, found := values[name]
+		if !found {
+			continue
+		}
+
+		duration, err := time.ParseDuration(value)
+		if err != nil || duration <= 0 {
+			return nil, InvalidProcessOptionError{name, value}
+		}
+
+		*backoff = duration
+	}
+
+	return &policy, nil
+}
+
+func livenessProbeFrom(values map[string]string) (*LivenessProbe, error) {
+	command, hasCommand := values[LivenessCommandEnv]
+	port, hasPort := values[LivenessPortEnv]
+
+	if !hasCommand && !hasPort {
+		return nil, nil
+	}
+
+	probe := LivenessProbe{
+		Command: strings.Fields(command),
+
+		Interval:         DefaultLivenessInterval,
+		Timeout:          DefaultLivenessTimeout,
+		FailureThreshold: DefaultLivenessFailureThreshold,
+	}
+
+	if hasPort {
+		parsed, err := strconv.ParseUint(port, 10, 16)
+		if err != nil {
+			return nil, InvalidProcessOptionError{LivenessPortEnv, port}
+		}
+
+		probe.Port = uint32(parsed)
+	}
+
+	for name, duration := range map[string]*time.Duration{
+		LivenessIntervalEnv: &probe.Interval,
+		LivenessTimeoutEnv:  &probe.Timeout,
+	} {
+		value, found := values[name]
+		if !found {
+			continue
+		}
+
+		parsed, err := time.ParseDuration(value)
+		if err != nil {
+			return nil, InvalidProcessOptionError{name, value}
+		}
+
+		*duration = parsed
+	}
+
+	if value, found := values[LivenessFailureThresholdEnv]; found {
+		threshold, err := strconv.Atoi(value)
+		if err != nil {
+			return nil, InvalidProcessOptionError{LivenessFailureThresholdEnv, value}
+		}
+
+		probe.FailureThreshold = threshold
+	}
+
+	if value, found := values[LivenessRestartEnv]; found {
+		restart, err := strconv.ParseBool(value)
+		if err != nil {
+			return nil, InvalidProcessOptionError{LivenessRestartEnv, value}
+		}
+
+		probe.Restart = restart
+	}
+
+	err := probe.Validate()
+	if err != nil {
+		return nil, err
+	}
+
+	return &probe, nil
+}
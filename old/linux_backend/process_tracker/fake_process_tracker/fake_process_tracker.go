@@ -21,6 +21,19 @@ type FakeProcessTracker struct {
 		result1 api.Process
 		result2 error
 	}
+	RunWithRestartStub        func(*exec.Cmd, api.ProcessIO, *api.TTYSpec, process_tracker.RestartPolicy, process_tracker.RestartHook) (api.Process, error)
+	runWithRestartMutex       sync.RWMutex
+	runWithRestartArgsForCall []struct {
+		arg1 *exec.Cmd
+		arg2 api.ProcessIO
+		arg3 *api.TTYSpec
+		arg4 process_tracker.RestartPolicy
+		arg5 process_tracker.RestartHook
+	}
+	runWithRestartReturns struct {
+		result1 api.Process
+		result2 error
+	}
 	AttachStub        func(uint32, api.ProcessIO) (api.Process, error)
 	attachMutex       sync.RWMutex
 	attachArgsForCall []struct {
@@ -31,6 +44,23 @@ type FakeProcessTracker struct {
 		result1 api.Process
 		result2 error
 	}
+	KillStub        func(processID uint32) error
+	killMutex       sync.RWMutex
+	killArgsForCall []struct {
+		processID uint32
+	}
+	killReturns struct {
+		result1 error
+	}
+	ContainerPIDStub        func(processID uint32) (int, error)
+	containerPIDMutex       sync.RWMutex
+	containerPIDArgsForCall []struct {
+		processID uint32
+	}
+	containerPIDReturns struct {
+		result1 int
+		result2 error
+	}
 	RestoreStub        func(processID uint32)
 	restoreMutex       sync.RWMutex
 	restoreArgsForCall []struct {
@@ -79,6 +109,43 @@ func (fake *FakeProcessTracker) RunReturns(result1 api.Process, result2 error) {
 	}{result1, result2}
 }
 
+func (fake *FakeProcessTracker) RunWithRestart(arg1 *exec.Cmd, arg2 api.ProcessIO, arg3 *api.TTYSpec, arg4 process_tracker.RestartPolicy, arg5 process_tracker.RestartHook) (api.Process, error) {
+	fake.runWithRestartMutex.Lock()
+	defer fake.runWithRestartMutex.Unlock()
+	fake.runWithRestartArgsForCall = append(fake.runWithRestartArgsForCall, struct {
+		arg1 *exec.Cmd
+		arg2 api.ProcessIO
+		arg3 *api.TTYSpec
+		arg4 process_tracker.RestartPolicy
+		arg5 process_tracker.RestartHook
+	}{arg1, arg2, arg3, arg4, arg5})
+	if fake.RunWithRestartStub != nil {
+		return fake.RunWithRestartStub(arg1, arg2, arg3, arg4, arg5)
+	} else {
+		return fake.runWithRestartReturns.result1, fake.runWithRestartReturns.result2
+	}
+}
+
+func (fake *FakeProcessTracker) RunWithRestartCallCount() int {
+	fake.runWithRestartMutex.RLock()
+	defer fake.runWithRestartMutex.RUnlock()
+	return len(fake.runWithRestartArgsForCall)
+}
+
+func (fake *FakeProcessTracker) RunWithRestartArgsForCall(i int) (*exec.Cmd, api.ProcessIO, *api.TTYSpec, process_tracker.RestartPolicy, process_tracker.RestartHook) {
+	fake.runWithRestartMutex.RLock()
+	defer fake.runWithRestartMutex.RUnlock()
+	return fake.runWithRestartArgsForCall[i].arg1, fake.runWithRestartArgsForCall[i].arg2, fake.runWithRestartArgsForCall[i].arg3, fake.runWithRestartArgsForCall[i].arg4, fake.runWithRestartArgsForCall[i].arg5
+}
+
+func (fake *FakeProcessTracker) RunWithRestartReturns(result1 api.Process, result2 error) {
+	fake.RunWithRestartStub = nil
+	fake.runWithRestartReturns = struct {
+		result1 api.Process
+		result2 error
+	}{result1, result2}
+}
+
 func (fake *FakeProcessTracker) Attach(arg1 uint32, arg2 api.ProcessIO) (api.Process, error) {
 	fake.attachMutex.Lock()
 	defer fake.attachMutex.Unlock()
@@ -113,6 +180,71 @@ func (fake *FakeProcessTracker) AttachReturns(result1 api.Process, result2 error
 	}{result1, result2}
 }
 
+func (fake *FakeProcessTracker) Kill(processID uint32) error {
+	fake.killMutex.Lock()
+	defer fake.killMutex.Unlock()
+	fake.killArgsForCall = append(fake.killArgsForCall, struct {
+		processID uint32
+	}{processID})
+	if fake.KillStub != nil {
+		return fake.KillStub(processID)
+	} else {
+		return fake.killReturns.result1
+	}
+}
+
+func (fake *FakeProcessTracker) KillCallCount() int {
+	fake.killMutex.RLock()
+	defer fake.killMutex.RUnlock()
+	return len(fake.killArgsForCall)
+}
+
+func (fake *FakeProcessTracker) KillArgsForCall(i int) uint32 {
+	fake.killMutex.RLock()
+	defer fake.killMutex.RUnlock()
+	return fake.killArgsForCall[i].processID
+}
+
+func (fake *FakeProcessTracker) KillReturns(result1 error) {
+	fake.KillStub = nil
+	fake.killReturns = struct {
+		result1 error
+	}{result1}
+}
+
+func (fake *FakeProcessTracker) ContainerPID(processID uint32) (int, error) {
+	fake.containerPIDMutex.Lock()
+	defer fake.containerPIDMutex.Unlock()
+	fake.containerPIDArgsForCall = append(fake.containerPIDArgsForCall, struct {
+		processID uint32
+	}{processID})
+	if fake.ContainerPIDStub != nil {
+		return fake.ContainerPIDStub(processID)
+	} else {
+		return fake.containerPIDReturns.result1, fake.containerPIDReturns.result2
+	}
+}
+
+func (fake *FakeProcessTracker) ContainerPIDCallCount() int {
+	fake.containerPIDMutex.RLock()
+	defer fake.containerPIDMutex.RUnlock()
+	return len(fake.containerPIDArgsForCall)
+}
+
+func (fake *FakeProcessTracker) ContainerPIDArgsForCall(i int) uint32 {
+	fake.containerPIDMutex.RLock()
+	defer fake.containerPIDMutex.RUnlock()
+	return fake.containerPIDArgsForCall[i].processID
+}
+
+func (fake *FakeProcessTracker) ContainerPIDReturns(result1 int, result2 error) {
+	fake.ContainerPIDStub = nil
+	fake.containerPIDReturns = struct {
+		result1 int
+		result2 error
+	}{result1, result2}
+}
+
 func (fake *FakeProcessTracker) Restore(processID uint32) {
 	fake.restoreMutex.Lock()
 	defer fake.restoreMutex.Unlock()
@@ -18,13 +18,12 @@ func (w *faninWriter) Write(data []byte) (int, error) {
 	<-w.hasSink
 
 	w.writeL.Lock()
+	defer w.writeL.Unlock()
 
 	if w.closed {
 		return 0, errors.New("write after close")
 	}
 
-	defer w.writeL.Unlock()
-
 	return w.w.Write(data)
 }
 
@@ -32,6 +31,7 @@ func (w *faninWriter) Close() error {
 	<-w.hasSink
 
 	w.writeL.Lock()
+	defer w.writeL.Unlock()
 
 	if w.closed {
 		return errors.New("closed twice")
@@ -39,8 +39,6 @@ func (w *faninWriter) Close() error {
 
 	w.closed = true
 
-	defer w.writeL.Unlock()
-
 	return w.w.Close()
 }
 
@@ -49,6 +47,19 @@ func (w *faninWriter) AddSink(sink io.WriteCloser) {
 	close(w.hasSink)
 }
 
+// replaceSink directs further writes to sink, e.g. when the process has
+// been restarted.
+func (w *faninWriter) replaceSink(sink io.WriteCloser) {
+	w.writeL.Lock()
+	defer w.writeL.Unlock()
+
+	w.w = sink
+
+	if w.closed {
+		sink.Close()
+	}
+}
+
 func (w *faninWriter) AddSource(source io.Reader) {
 	go func() {
 		_, err := io.Copy(w, source)
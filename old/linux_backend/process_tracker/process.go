@@ -3,9 +3,13 @@ package process_tracker
 import (
 	"bufio"
 	"fmt"
+	"io/ioutil"
+	"os"
 	"os/exec"
 	"path"
 	"sync"
+	"syscall"
+	"time"
 
 	"github.com/cloudfoundry-incubator/garden/api"
 	"github.com/cloudfoundry/gunk/command_runner"
@@ -23,6 +27,17 @@ type Process struct {
 
 	linked chan struct{}
 	link   *link.Link
+	linkL  sync.Mutex
+
+	cmd *exec.Cmd
+	tty *api.TTYSpec
+
+	// pid is that of the spawned command on the host, e.g. wsh
+	pid  int
+	pidL sync.Mutex
+
+	restartPolicy RestartPolicy
+	restartHook   RestartHook
 
 	exited     chan struct{}
 	exitStatus int
@@ -68,6 +83,9 @@ func (p *Process) Wait() (int, error) {
 func (p *Process) SetTTY(tty api.TTYSpec) error {
 	<-p.linked
 
+	p.linkL.Lock()
+	defer p.linkL.Unlock()
+
 	if tty.WindowSize != nil {
 		return p.link.SetWindowSize(tty.WindowSize.Columns, tty.WindowSize.Rows)
 	}
@@ -79,6 +97,9 @@ func (p *Process) Spawn(cmd *exec.Cmd, tty *api.TTYSpec) (ready, active chan err
 	ready = make(chan error, 1)
 	active = make(chan error, 1)
 
+	p.cmd = cmd
+	p.tty = tty
+
 	spawnPath := path.Join(p.containerPath, "bin", "iodaemon")
 	processSock := path.Join(p.containerPath, "processes", fmt.Sprintf("%d.sock", p.ID()))
 
@@ -104,7 +125,14 @@ func (p *Process) Spawn(cmd *exec.Cmd, tty *api.TTYSpec) (ready, active chan err
 	bashFlags = append(bashFlags, "spawn", processSock)
 
 	spawn := exec.Command("bash", append(bashFlags, cmd.Args...)...)
-	spawn.Env = cmd.Env
+
+	spawnEnv := cmd.Env
+	if spawnEnv == nil {
+		spawnEnv = os.Environ()
+	}
+
+	// wsh records the pid of the process in the container here
+	spawn.Env = append(append([]string{}, spawnEnv...), "WSH_PIDFILE="+p.containerPIDFile())
 
 	spawnR, err := spawn.StdoutPipe()
 	if err != nil {
@@ -129,12 +157,20 @@ func (p *Process) Spawn(cmd *exec.Cmd, tty *api.TTYSpec) (ready, active chan err
 
 		ready <- nil
 
-		_, err = spawnOut.ReadBytes('\n')
+		activeLine, err := spawnOut.ReadBytes('\n')
 		if err != nil {
 			active <- fmt.Errorf("failed to read active: %s", err)
 			return
 		}
 
+		var pid int
+		_, err = fmt.Sscanf(string(activeLine), "pid: %d", &pid)
+		if err == nil {
+			p.pidL.Lock()
+			p.pid = pid
+			p.pidL.Unlock()
+		}
+
 		active <- nil
 
 		spawn.Wait()
@@ -143,6 +179,53 @@ func (p *Process) Spawn(cmd *exec.Cmd, tty *api.TTYSpec) (ready, active chan err
 	return
 }
 
+// ContainerPID returns the pid of the process in the container's pid
+// namespace, as recorded by wsh when it was last spawned.
+func (p *Process) ContainerPID() (int, error) {
+	contents, err := ioutil.ReadFile(p.containerPIDFile())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0, NoContainerPIDError{p.id}
+		}
+
+		return 0, err
+	}
+
+	var pid int
+	_, err = fmt.Sscanf(string(contents), "%d", &pid)
+	if err != nil {
+		return 0, err
+	}
+
+	return pid, nil
+}
+
+func (p *Process) containerPIDFile() string {
+	return path.Join(p.containerPath, "processes", fmt.Sprintf("%d.pid", p.ID()))
+}
+
+// Supervise has the process respawned according to policy when it exits,
+// for as long as hook allows. It must be called before the process is
+// linked.
+func (p *Process) Supervise(policy RestartPolicy, hook RestartHook) {
+	p.restartPolicy = policy
+	p.restartHook = hook
+}
+
+// Kill kills the spawned command, which counts as it failing for the
+// process's restart policy.
+func (p *Process) Kill() error {
+	p.pidL.Lock()
+	pid := p.pid
+	p.pidL.Unlock()
+
+	if pid == 0 {
+		return ProcessNotStartedError{p.id}
+	}
+
+	return syscall.Kill(pid, syscall.SIGKILL)
+}
+
 func (p *Process) Link() {
 	p.runningLink.Do(p.runLinker)
 }
@@ -175,12 +258,57 @@ func (p *Process) runLinker() {
 	p.link = link
 	close(p.linked)
 
-	p.completed(p.link.Wait())
+	exitStatus, err := p.link.Wait()
+
+	for restarts := 1; p.restartPolicy.shouldRestart(exitStatus, err); restarts++ {
+		time.Sleep(p.restartPolicy.backoff(restarts))
+
+		if p.restartHook != nil && !p.restartHook(p.id, restarts) {
+			break
+		}
+
+		exitStatus, err = p.respawn(processSock)
+	}
+
+	p.completed(exitStatus, err)
 
 	// don't leak stdin pipe
 	p.stdin.Close()
 }
 
+func (p *Process) respawn(processSock string) (int, error) {
+	// the previous i/o daemon exits without cleaning up its socket
+	err := os.Remove(processSock)
+	if err != nil && !os.IsNotExist(err) {
+		return -1, err
+	}
+
+	ready, active := p.Spawn(p.cmd, p.tty)
+
+	err = <-ready
+	if err != nil {
+		return -1, err
+	}
+
+	link, err := link.Create(processSock, p.stdout, p.stderr)
+	if err != nil {
+		return -1, err
+	}
+
+	err = <-active
+	if err != nil {
+		return -1, err
+	}
+
+	p.linkL.Lock()
+	p.link = link
+	p.linkL.Unlock()
+
+	p.stdin.replaceSink(link)
+
+	return link.Wait()
+}
+
 func (p *Process) completed(exitStatus int, err error) {
 	p.exitStatus = exitStatus
 	p.exitErr = err
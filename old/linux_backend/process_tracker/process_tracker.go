@@ -11,7 +11,10 @@ import (
 
 type ProcessTracker interface {
 	Run(*exec.Cmd, api.ProcessIO, *api.TTYSpec) (api.Process, error)
+	RunWithRestart(*exec.Cmd, api.ProcessIO, *api.TTYSpec, RestartPolicy, RestartHook) (api.Process, error)
 	Attach(uint32, api.ProcessIO) (api.Process, error)
+	Kill(processID uint32) error
+	ContainerPID(processID uint32) (int, error)
 	Restore(processID uint32)
 	ActiveProcesses() []api.Process
 }
@@ -33,6 +36,22 @@ func (e UnknownProcessError) Error() string {
 	return fmt.Sprintf("unknown process: %d", e.ProcessID)
 }
 
+type NoContainerPIDError struct {
+	ProcessID uint32
+}
+
+func (e NoContainerPIDError) Error() string {
+	return fmt.Sprintf("pid in the container not known for process: %d", e.ProcessID)
+}
+
+type ProcessNotStartedError struct {
+	ProcessID uint32
+}
+
+func (e ProcessNotStartedError) Error() string {
+	return fmt.Sprintf("process not started by this tracker: %d", e.ProcessID)
+}
+
 func New(containerPath string, runner command_runner.CommandRunner) ProcessTracker {
 	return &processTracker{
 		containerPath: containerPath,
@@ -46,12 +65,21 @@ func New(containerPath string, runner command_runner.CommandRunner) ProcessTrack
 }
 
 func (t *processTracker) Run(cmd *exec.Cmd, processIO api.ProcessIO, tty *api.TTYSpec) (api.Process, error) {
+	return t.RunWithRestart(cmd, processIO, tty, RestartPolicy{Mode: RestartNever}, nil)
+}
+
+// RunWithRestart is Run for a process that is respawned according to
+// policy when it exits. The process keeps its ID across restarts, and
+// Wait returns once it is no longer restarted. Restart policies are not
+// kept when processes are restored.
+func (t *processTracker) RunWithRestart(cmd *exec.Cmd, processIO api.ProcessIO, tty *api.TTYSpec, policy RestartPolicy, hook RestartHook) (api.Process, error) {
 	t.processesMutex.Lock()
 
 	processID := t.nextProcessID
 	t.nextProcessID++
 
 	process := NewProcess(processID, t.containerPath, t.runner)
+	process.Supervise(policy, hook)
 
 	t.processes[processID] = process
 
@@ -92,6 +120,30 @@ func (t *processTracker) Attach(processID uint32, processIO api.ProcessIO) (api.
 	return process, nil
 }
 
+func (t *processTracker) Kill(processID uint32) error {
+	t.processesMutex.RLock()
+	process, ok := t.processes[processID]
+	t.processesMutex.RUnlock()
+
+	if !ok {
+		return UnknownProcessError{processID}
+	}
+
+	return process.Kill()
+}
+
+func (t *processTracker) ContainerPID(processID uint32) (int, error) {
+	t.processesMutex.RLock()
+	process, ok := t.processes[processID]
+	t.processesMutex.RUnlock()
+
+	if !ok {
+		return 0, UnknownProcessError{processID}
+	}
+
+	return process.ContainerPID()
+}
+
 func (t *processTracker) Restore(processID uint32) {
 	t.processesMutex.Lock()
 
@@ -8,6 +8,7 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
+	"time"
 
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
@@ -187,6 +188,181 @@ var _ = Describe("Running processes", func() {
 	})
 })
 
+var _ = Describe("Running processes with a restart policy", func() {
+	var attemptsFile string
+	var restarts []int
+
+	// exits 1 on its first two runs, and 0 after that
+	flakyCommand := func() *exec.Cmd {
+		return exec.Command("bash", "-c", `
+			echo attempt >> `+attemptsFile+`
+			attempts=$(wc -l < `+attemptsFile+`)
+			echo "attempt $attempts"
+			[ $attempts -ge 3 ]
+		`)
+	}
+
+	recordRestarts := func(processID uint32, restart int) bool {
+		restarts = append(restarts, restart)
+		return true
+	}
+
+	BeforeEach(func() {
+		processTracker = process_tracker.New(tmpdir, linux_command_runner.New())
+
+		attemptsFile = filepath.Join(tmpdir, "attempts")
+		restarts = nil
+	})
+
+	Context("when the policy is on-failure", func() {
+		policy := process_tracker.RestartPolicy{
+			Mode:    process_tracker.RestartOnFailure,
+			Backoff: 10 * time.Millisecond,
+		}
+
+		It("restarts the process until it succeeds", func() {
+			stdout := gbytes.NewBuffer()
+
+			process, err := processTracker.RunWithRestart(flakyCommand(), api.ProcessIO{
+				Stdout: stdout,
+			}, nil, policy, recordRestarts)
+			Expect(err).NotTo(HaveOccurred())
+
+			Ω(process.Wait()).Should(Equal(0))
+			Ω(restarts).Should(Equal([]int{1, 2}))
+
+			Ω(stdout).Should(gbytes.Say("attempt 1\n"))
+			Ω(stdout).Should(gbytes.Say("attempt 2\n"))
+			Ω(stdout).Should(gbytes.Say("attempt 3\n"))
+		})
+
+		It("keeps the process's ID across restarts", func() {
+			process, err := processTracker.RunWithRestart(flakyCommand(), api.ProcessIO{}, nil, policy, func(processID uint32, restart int) bool {
+				restarts = append(restarts, int(processID))
+				return true
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			process.Wait()
+			Ω(restarts).Should(Equal([]int{int(process.ID()), int(process.ID())}))
+		})
+
+		Context("when the hook gives up", func() {
+			It("returns the last exit status", func() {
+				process, err := processTracker.RunWithRestart(flakyCommand(), api.ProcessIO{}, nil, policy, func(uint32, int) bool {
+					return false
+				})
+				Expect(err).NotTo(HaveOccurred())
+
+				Ω(process.Wait()).Should(Equal(1))
+			})
+		})
+	})
+
+	Context("when the policy is always", func() {
+		It("restarts the process even when it succeeds", func() {
+			process, err := processTracker.RunWithRestart(exec.Command("true"), api.ProcessIO{}, nil, process_tracker.RestartPolicy{
+				Mode: process_tracker.RestartAlways,
+			}, func(processID uint32, restart int) bool {
+				restarts = append(restarts, restart)
+				return restart < 3
+			})
+			Expect(err).NotTo(HaveOccurred())
+
+			Ω(process.Wait()).Should(Equal(0))
+			Ω(restarts).Should(Equal([]int{1, 2, 3}))
+		})
+	})
+
+	Context("when the policy is never", func() {
+		It("does not restart the process", func() {
+			process, err := processTracker.RunWithRestart(flakyCommand(), api.ProcessIO{}, nil, process_tracker.RestartPolicy{
+				Mode: process_tracker.RestartNever,
+			}, recordRestarts)
+			Expect(err).NotTo(HaveOccurred())
+
+			Ω(process.Wait()).Should(Equal(1))
+			Ω(restarts).Should(BeEmpty())
+		})
+	})
+})
+
+var _ = Describe("Killing processes", func() {
+	BeforeEach(func() {
+		processTracker = process_tracker.New(tmpdir, linux_command_runner.New())
+	})
+
+	It("kills the process", func() {
+		process, err := processTracker.Run(exec.Command("sleep", "1000"), api.ProcessIO{}, nil)
+		Expect(err).NotTo(HaveOccurred())
+
+		err = processTracker.Kill(process.ID())
+		Ω(err).ShouldNot(HaveOccurred())
+
+		Ω(process.Wait()).ShouldNot(Equal(0))
+	})
+
+	It("restarts the process if its policy says to", func() {
+		restarted := make(chan int, 1)
+
+		process, err := processTracker.RunWithRestart(exec.Command("sleep", "1000"), api.ProcessIO{}, nil, process_tracker.RestartPolicy{
+			Mode: process_tracker.RestartOnFailure,
+		}, func(processID uint32, restarts int) bool {
+			restarted <- restarts
+			return false
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		err = processTracker.Kill(process.ID())
+		Ω(err).ShouldNot(HaveOccurred())
+
+		Eventually(restarted).Should(Receive(Equal(1)))
+	})
+
+	Context("when the process is unknown", func() {
+		It("returns an error", func() {
+			err := processTracker.Kill(42)
+			Ω(err).Should(Equal(process_tracker.UnknownProcessError{ProcessID: 42}))
+		})
+	})
+})
+
+var _ = Describe("Getting processes' pids in the container", func() {
+	BeforeEach(func() {
+		processTracker = process_tracker.New(tmpdir, linux_command_runner.New())
+	})
+
+	It("returns the pid recorded by the spawned command", func() {
+		process, err := processTracker.Run(exec.Command("bash", "-c", `echo 1234 > "$WSH_PIDFILE"; exec sleep 1000`), api.ProcessIO{}, nil)
+		Expect(err).NotTo(HaveOccurred())
+
+		defer processTracker.Kill(process.ID())
+
+		Eventually(func() (int, error) {
+			return processTracker.ContainerPID(process.ID())
+		}).Should(Equal(1234))
+	})
+
+	Context("when the spawned command has not recorded one", func() {
+		It("returns an error", func() {
+			process, err := processTracker.Run(exec.Command("sleep", "1000"), api.ProcessIO{}, nil)
+			Expect(err).NotTo(HaveOccurred())
+
+			defer processTracker.Kill(process.ID())
+
+			_, err = processTracker.ContainerPID(process.ID())
+			Ω(err).Should(Equal(process_tracker.NoContainerPIDError{ProcessID: process.ID()}))
+		})
+	})
+
+	Context("when the process is unknown", func() {
+		It("returns an error", func() {
+			_, err := processTracker.ContainerPID(42)
+			Ω(err).Should(Equal(process_tracker.UnknownProcessError{ProcessID: 42}))
+		})
+	})
+})
+
 var _ = Describe("Restoring processes", func() {
 	BeforeEach(func() {
 		processTracker = process_tracker.New(tmpdir, linux_command_runner.New())
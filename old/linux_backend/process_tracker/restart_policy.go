@@ -0,0 +1,54 @@
+package process_tracker
+
+import "time"
+
+type RestartMode string
+
+const (
+	RestartNever     RestartMode = "never"
+	RestartOnFailure RestartMode = "on-failure"
+	RestartAlways    RestartMode = "always"
+)
+
+// RestartPolicy says when a process is respawned after it exits. The delay
+// before a restart starts at Backoff and doubles with each restart, up to
+// MaxBackoff if it is set.
+type RestartPolicy struct {
+	Mode       RestartMode
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+}
+
+// RestartHook is called before a process is restarted, with its ID and the
+// number of restarts so far including this one. Returning false gives up on
+// the process instead.
+type RestartHook func(processID uint32, restarts int) bool
+
+func (p RestartPolicy) shouldRestart(exitStatus int, err error) bool {
+	switch p.Mode {
+	case RestartAlways:
+		return true
+	case RestartOnFailure:
+		return err != nil || exitStatus != 0
+	default:
+		return false
+	}
+}
+
+func (p RestartPolicy) backoff(restarts int) time.Duration {
+	delay := p.Backoff
+
+	for i := 1; i < restarts; i++ {
+		if p.MaxBackoff != 0 && delay >= p.MaxBackoff {
+			break
+		}
+
+		delay *= 2
+	}
+
+	if p.MaxBackoff != 0 && delay > p.MaxBackoff {
+		delay = p.MaxBackoff
+	}
+
+	return delay
+}
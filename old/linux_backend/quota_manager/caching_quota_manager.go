@@ -0,0 +1,71 @@
+package quota_manager
+
+import (
+	"sync"
+	"time"
+
+	"github.com/cloudfoundry-incubator/garden/api"
+	"github.com/pivotal-golang/lager"
+)
+
+// CachingQuotaManager keeps each uid's usage for a while, so that a busy
+// host does not run repquota for every container's every Info call.
+//
+// Usage is invalidated when the caller knows it has changed, e.g. after
+// streaming files in, so only writes from inside the container go unseen
+// until the cached usage expires.
+type CachingQuotaManager struct {
+	QuotaManager
+
+	ttl time.Duration
+
+	usage      map[uint32]cachedUsage
+	usageMutex *sync.Mutex
+}
+
+type cachedUsage struct {
+	stat    api.ContainerDiskStat
+	fetched time.Time
+}
+
+func NewCaching(manager QuotaManager, ttl time.Duration) *CachingQuotaManager {
+	return &CachingQuotaManager{
+		QuotaManager: manager,
+
+		ttl: ttl,
+
+		usage:      make(map[uint32]cachedUsage),
+		usageMutex: new(sync.Mutex),
+	}
+}
+
+func (m *CachingQuotaManager) GetUsage(logger lager.Logger, uid uint32) (api.ContainerDiskStat, error) {
+	m.usageMutex.Lock()
+	cached, found := m.usage[uid]
+	m.usageMutex.Unlock()
+
+	if found && time.Since(cached.fetched) < m.ttl {
+		return cached.stat, nil
+	}
+
+	fetched := time.Now()
+
+	stat, err := m.QuotaManager.GetUsage(logger, uid)
+	if err != nil {
+		return stat, err
+	}
+
+	m.usageMutex.Lock()
+	m.usage[uid] = cachedUsage{stat: stat, fetched: fetched}
+	m.usageMutex.Unlock()
+
+	return stat, nil
+}
+
+func (m *CachingQuotaManager) InvalidateUsage(uid uint32) {
+	m.usageMutex.Lock()
+	delete(m.usage, uid)
+	m.usageMutex.Unlock()
+
+	m.QuotaManager.InvalidateUsage(uid)
+}
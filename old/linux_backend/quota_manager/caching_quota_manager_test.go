@@ -0,0 +1,136 @@
+package quota_manager_test
+
+import (
+	"errors"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/pivotal-golang/lager/lagertest"
+
+	"github.com/cloudfoundry-incubator/garden-linux/old/linux_backend/quota_manager"
+	"github.com/cloudfoundry-incubator/garden-linux/old/linux_backend/quota_manager/fake_quota_manager"
+	"github.com/cloudfoundry-incubator/garden/api"
+)
+
+var _ = Describe("Caching Quota manager", func() {
+	var fakeQuotaManager *fake_quota_manager.FakeQuotaManager
+	var logger *lagertest.TestLogger
+	var quotaManager *quota_manager.CachingQuotaManager
+
+	BeforeEach(func() {
+		fakeQuotaManager = fake_quota_manager.New()
+		logger = lagertest.NewTestLogger("test")
+		quotaManager = quota_manager.NewCaching(fakeQuotaManager, 100*time.Millisecond)
+
+		fakeQuotaManager.GetUsageResult = api.ContainerDiskStat{
+			BytesUsed:  1,
+			InodesUsed: 2,
+		}
+	})
+
+	Describe("getting usage", func() {
+		It("returns the usage", func() {
+			usage, err := quotaManager.GetUsage(logger, 1234)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(usage).Should(Equal(api.ContainerDiskStat{
+				BytesUsed:  1,
+				InodesUsed: 2,
+			}))
+		})
+
+		It("reuses the usage until it expires", func() {
+			_, err := quotaManager.GetUsage(logger, 1234)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			fakeQuotaManager.GetUsageResult = api.ContainerDiskStat{BytesUsed: 3}
+
+			usage, err := quotaManager.GetUsage(logger, 1234)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(usage).Should(Equal(api.ContainerDiskStat{
+				BytesUsed:  1,
+				InodesUsed: 2,
+			}))
+
+			Ω(fakeQuotaManager.UsageQueried).Should(Equal([]uint32{1234}))
+
+			time.Sleep(100 * time.Millisecond)
+
+			usage, err = quotaManager.GetUsage(logger, 1234)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(usage).Should(Equal(api.ContainerDiskStat{BytesUsed: 3}))
+
+			Ω(fakeQuotaManager.UsageQueried).Should(Equal([]uint32{1234, 1234}))
+		})
+
+		It("keeps each uid's usage separately", func() {
+			_, err := quotaManager.GetUsage(logger, 1234)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			_, err = quotaManager.GetUsage(logger, 5678)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(fakeQuotaManager.UsageQueried).Should(Equal([]uint32{1234, 5678}))
+		})
+
+		Context("when the usage is invalidated", func() {
+			It("queries it again", func() {
+				_, err := quotaManager.GetUsage(logger, 1234)
+				Ω(err).ShouldNot(HaveOccurred())
+
+				quotaManager.InvalidateUsage(1234)
+
+				_, err = quotaManager.GetUsage(logger, 1234)
+				Ω(err).ShouldNot(HaveOccurred())
+
+				Ω(fakeQuotaManager.UsageQueried).Should(Equal([]uint32{1234, 1234}))
+			})
+
+			It("passes the invalidation on", func() {
+				quotaManager.InvalidateUsage(1234)
+
+				Ω(fakeQuotaManager.Invalidated).Should(Equal([]uint32{1234}))
+			})
+		})
+
+		Context("when getting the usage fails", func() {
+			disaster := errors.New("oh no!")
+
+			BeforeEach(func() {
+				fakeQuotaManager.GetUsageError = disaster
+			})
+
+			It("returns the error", func() {
+				_, err := quotaManager.GetUsage(logger, 1234)
+				Ω(err).Should(Equal(disaster))
+			})
+
+			It("does not cache anything", func() {
+				quotaManager.GetUsage(logger, 1234)
+
+				fakeQuotaManager.GetUsageError = nil
+
+				usage, err := quotaManager.GetUsage(logger, 1234)
+				Ω(err).ShouldNot(HaveOccurred())
+				Ω(usage).Should(Equal(api.ContainerDiskStat{
+					BytesUsed:  1,
+					InodesUsed: 2,
+				}))
+			})
+		})
+	})
+
+	Describe("setting limits", func() {
+		It("passes them through", func() {
+			limits := api.DiskLimits{BlockHard: 2}
+
+			err := quotaManager.SetLimits(logger, 1234, limits)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(fakeQuotaManager.Limited).Should(Equal(map[uint32]api.DiskLimits{
+				1234: limits,
+			}))
+		})
+	})
+})
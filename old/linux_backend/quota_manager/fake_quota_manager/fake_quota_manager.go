@@ -19,6 +19,9 @@ type FakeQuotaManager struct {
 
 	Limited map[uint32]api.DiskLimits
 
+	UsageQueried []uint32
+	Invalidated  []uint32
+
 	enabled bool
 
 	sync.RWMutex
@@ -61,12 +64,21 @@ func (m *FakeQuotaManager) GetUsage(logger lager.Logger, uid uint32) (api.Contai
 		return api.ContainerDiskStat{}, m.GetUsageError
 	}
 
-	m.RLock()
-	defer m.RUnlock()
+	m.Lock()
+	defer m.Unlock()
+
+	m.UsageQueried = append(m.UsageQueried, uid)
 
 	return m.GetUsageResult, nil
 }
 
+func (m *FakeQuotaManager) InvalidateUsage(uid uint32) {
+	m.Lock()
+	defer m.Unlock()
+
+	m.Invalidated = append(m.Invalidated, uid)
+}
+
 func (m *FakeQuotaManager) MountPoint() string {
 	return m.MountPointResult
 }
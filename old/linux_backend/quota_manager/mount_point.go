@@ -0,0 +1,140 @@
+package quota_manager
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+const mountInfoPath = "/proc/self/mountinfo"
+
+type NoMountPointError struct {
+	Path string
+}
+
+func (e NoMountPointError) Error() string {
+	return fmt.Sprintf("no mount point found for %s", e.Path)
+}
+
+// MountPointMismatchError is returned when the mount point found for a path
+// is not of the filesystem the path is on, as when the mount table and the
+// filesystem disagree.
+type MountPointMismatchError struct {
+	Path       string
+	MountPoint string
+}
+
+func (e MountPointMismatchError) Error() string {
+	return fmt.Sprintf("%s is not on the filesystem mounted at %s", e.Path, e.MountPoint)
+}
+
+// MountPointOf returns where the filesystem holding path, for its quotas to
+// be set and reported on, is mounted. It is found from the mount table
+// rather than df's output, which is neither stable across locales nor
+// parseable when device names are long or contain spaces.
+func MountPointOf(path string) (string, error) {
+	resolved, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return "", err
+	}
+
+	resolved, err = filepath.Abs(resolved)
+	if err != nil {
+		return "", err
+	}
+
+	mountInfo, err := os.Open(mountInfoPath)
+	if err != nil {
+		return "", err
+	}
+
+	defer mountInfo.Close()
+
+	mountPoints, err := parseMountPoints(mountInfo)
+	if err != nil {
+		return "", err
+	}
+
+	// the deepest mount point above the path; of mounts stacked on the same
+	// point, the last is the one seen
+	mountPoint := ""
+	for _, candidate := range mountPoints {
+		if contains(candidate, resolved) && len(candidate) >= len(mountPoint) {
+			mountPoint = candidate
+		}
+	}
+
+	if mountPoint == "" {
+		return "", NoMountPointError{path}
+	}
+
+	var pathStat, mountStat syscall.Statfs_t
+
+	err = syscall.Statfs(resolved, &pathStat)
+	if err != nil {
+		return "", err
+	}
+
+	err = syscall.Statfs(mountPoint, &mountStat)
+	if err != nil {
+		return "", err
+	}
+
+	if pathStat.Fsid != mountStat.Fsid || pathStat.Type != mountStat.Type {
+		return "", MountPointMismatchError{Path: path, MountPoint: mountPoint}
+	}
+
+	return mountPoint, nil
+}
+
+// parseMountPoints returns the mount points listed in mountinfo, in order.
+func parseMountPoints(mountInfo io.Reader) ([]string, error) {
+	mountPoints := []string{}
+
+	scanner := bufio.NewScanner(mountInfo)
+	for scanner.Scan() {
+		// id parent major:minor root mount-point options ...
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 5 {
+			continue
+		}
+
+		mountPoints = append(mountPoints, unescapeMountPath(fields[4]))
+	}
+
+	return mountPoints, scanner.Err()
+}
+
+// unescapeMountPath undoes the kernel's octal escaping of whitespace and
+// backslashes in mount paths, e.g. \040 for a space.
+func unescapeMountPath(escaped string) string {
+	unescaped := make([]byte, 0, len(escaped))
+
+	for i := 0; i < len(escaped); i++ {
+		if escaped[i] == '\\' && i+4 <= len(escaped) {
+			code, err := strconv.ParseUint(escaped[i+1:i+4], 8, 8)
+			if err == nil {
+				unescaped = append(unescaped, byte(code))
+				i += 3
+				continue
+			}
+		}
+
+		unescaped = append(unescaped, escaped[i])
+	}
+
+	return string(unescaped)
+}
+
+func contains(mountPoint, path string) bool {
+	if mountPoint == "/" || mountPoint == path {
+		return true
+	}
+
+	return strings.HasPrefix(path, mountPoint+"/")
+}
@@ -0,0 +1,71 @@
+package quota_manager_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"syscall"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/cloudfoundry-incubator/garden-linux/old/linux_backend/quota_manager"
+)
+
+var _ = Describe("Finding a path's mount point", func() {
+	var tmpdir string
+
+	BeforeEach(func() {
+		var err error
+
+		tmpdir, err = ioutil.TempDir(os.TempDir(), "mount-point-test")
+		Ω(err).ShouldNot(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(tmpdir)
+	})
+
+	sameFilesystem := func(a, b string) bool {
+		var aStat, bStat syscall.Stat_t
+
+		Ω(syscall.Stat(a, &aStat)).ShouldNot(HaveOccurred())
+		Ω(syscall.Stat(b, &bStat)).ShouldNot(HaveOccurred())
+
+		return aStat.Dev == bStat.Dev
+	}
+
+	It("finds the root's", func() {
+		Ω(quota_manager.MountPointOf("/")).Should(Equal("/"))
+	})
+
+	It("finds the mount point of the filesystem that holds the path", func() {
+		depot := path.Join(tmpdir, "depot")
+
+		err := os.MkdirAll(depot, 0755)
+		Ω(err).ShouldNot(HaveOccurred())
+
+		mountPoint, err := quota_manager.MountPointOf(depot)
+		Ω(err).ShouldNot(HaveOccurred())
+
+		Ω(mountPoint == "/" || strings.HasPrefix(depot, mountPoint+"/")).Should(BeTrue())
+		Ω(sameFilesystem(mountPoint, depot)).Should(BeTrue())
+	})
+
+	It("resolves symlinks first", func() {
+		link := path.Join(tmpdir, "link")
+
+		err := os.Symlink("/", link)
+		Ω(err).ShouldNot(HaveOccurred())
+
+		Ω(quota_manager.MountPointOf(link)).Should(Equal("/"))
+	})
+
+	Context("when the path does not exist", func() {
+		It("returns an error", func() {
+			_, err := quota_manager.MountPointOf(path.Join(tmpdir, "nonexistent"))
+			Ω(err).Should(HaveOccurred())
+		})
+	})
+})
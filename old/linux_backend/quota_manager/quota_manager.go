@@ -18,6 +18,9 @@ type QuotaManager interface {
 	GetLimits(logger lager.Logger, uid uint32) (api.DiskLimits, error)
 	GetUsage(logger lager.Logger, uid uint32) (api.ContainerDiskStat, error)
 
+	// InvalidateUsage tells the manager that uid's usage may have changed
+	InvalidateUsage(uid uint32)
+
 	MountPoint() string
 	Disable()
 	IsEnabled() bool
@@ -171,6 +174,9 @@ func (m *LinuxQuotaManager) GetUsage(logger lager.Logger, uid uint32) (api.Conta
 	return usage, err
 }
 
+// InvalidateUsage does nothing; usage is read afresh every time.
+func (m *LinuxQuotaManager) InvalidateUsage(uid uint32) {}
+
 func (m *LinuxQuotaManager) MountPoint() string {
 	return m.mountPoint
 }
@@ -1,6 +1,7 @@
 package linux_backend
 
 import (
+	"net"
 	"sync"
 
 	"github.com/cloudfoundry-incubator/garden-linux/old/linux_backend/network"
@@ -11,18 +12,27 @@ type Resources struct {
 	Network *network.Network
 	Ports   []uint32
 
+	// AdditionalNetworks are attached alongside Network, e.g. for management
+	// traffic; each has its own interface and fence, but no default route
+	AdditionalNetworks []*network.Network
+
+	// ExternalIP, if any, is NATed 1:1 to and from Network's container IP
+	ExternalIP net.IP
+
 	portsLock *sync.Mutex
 }
 
 func NewResources(
 	uid uint32,
 	network *network.Network,
+	additionalNetworks []*network.Network,
 	ports []uint32,
 ) *Resources {
 	return &Resources{
-		UID:     uid,
-		Network: network,
-		Ports:   ports,
+		UID:                uid,
+		Network:            network,
+		AdditionalNetworks: additionalNetworks,
+		Ports:              ports,
 
 		portsLock: new(sync.Mutex),
 	}
@@ -0,0 +1,102 @@
+// Package selinux_labeler labels each container's processes and files with
+// MCS categories of its own, as sVirt does for virtual machines, so that
+// SELinux keeps containers from reading or writing one another's files even
+// where their users' permissions would let them.
+package selinux_labeler
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"regexp"
+)
+
+// the contexts of the Docker-compatible sVirt policy shipped by
+// SELinux-enforcing distributions
+const (
+	DefaultProcessContext = "system_u:system_r:svirt_lxc_net_t:s0"
+	DefaultFileContext    = "system_u:object_r:svirt_sandbox_file_t:s0"
+)
+
+// Categories is how many MCS categories (c0 to c1023) policies define.
+const Categories = 1024
+
+// MaxContainers is how many containers can have distinct pairs of
+// categories.
+const MaxContainers = Categories * (Categories - 1) / 2
+
+// Labels are a container's SELinux contexts.
+type Labels struct {
+	// what its processes run as
+	Process string
+
+	// what its rootfs is mounted with
+	File string
+}
+
+// contexts are labelled with categories, so must have a sensitivity level
+// without any; they are also written into mount options and shell
+var validContext = regexp.MustCompile(`^[A-Za-z0-9_]+:[A-Za-z0-9_]+:[A-Za-z0-9_]+:s[0-9]+$`)
+
+type InvalidContextError struct {
+	Context string
+}
+
+func (e InvalidContextError) Error() string {
+	return fmt.Sprintf("invalid selinux context (expected user:role:type:sN): %s", e.Context)
+}
+
+type Labeler struct {
+	processContext string
+	fileContext    string
+}
+
+func New(processContext, fileContext string) (*Labeler, error) {
+	for _, context := range []string{processContext, fileContext} {
+		if !validContext.MatchString(context) {
+			return nil, InvalidContextError{context}
+		}
+	}
+
+	return &Labeler{
+		processContext: processContext,
+		fileContext:    fileContext,
+	}, nil
+}
+
+// Labels labels the container whose user has the UID. Containers' UIDs are
+// unique, so as long as there are no more than MaxContainers UIDs in the
+// pool, so are their categories. The same UID is always given the same
+// labels, so they need not be recorded to be restored.
+func (l *Labeler) Labels(uid uint32) Labels {
+	low, high := categoryPair(uid % MaxContainers)
+	categories := fmt.Sprintf(":c%d,c%d", low, high)
+
+	return Labels{
+		Process: l.processContext + categories,
+		File:    l.fileContext + categories,
+	}
+}
+
+// categoryPair is the nth pair of distinct categories, ordered by their
+// higher category: (0, 1), (0, 2), (1, 2), (0, 3) and so on.
+func categoryPair(n uint32) (uint32, uint32) {
+	high := uint32(1)
+	for n >= high {
+		n -= high
+		high++
+	}
+
+	return n, high
+}
+
+// SELinuxFSPath is where the kernel's selinuxfs is mounted, if SELinux is
+// enabled.
+var SELinuxFSPath = "/sys/fs/selinux"
+
+// Enabled reports whether the host has SELinux enabled, whether or not it
+// is enforcing.
+func Enabled() bool {
+	_, err := os.Stat(path.Join(SELinuxFSPath, "enforce"))
+	return err == nil
+}
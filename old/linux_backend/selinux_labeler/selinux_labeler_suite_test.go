@@ -0,0 +1,13 @@
+package selinux_labeler_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"testing"
+)
+
+func TestSELinuxLabeler(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "SELinux Labeler Suite")
+}
@@ -0,0 +1,98 @@
+package selinux_labeler_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/cloudfoundry-incubator/garden-linux/old/linux_backend/selinux_labeler"
+)
+
+var _ = Describe("SELinux labeling", func() {
+	var labeler *selinux_labeler.Labeler
+
+	BeforeEach(func() {
+		var err error
+
+		labeler, err = selinux_labeler.New(selinux_labeler.DefaultProcessContext, selinux_labeler.DefaultFileContext)
+		Ω(err).ShouldNot(HaveOccurred())
+	})
+
+	It("labels processes and files with the same pair of categories", func() {
+		Ω(labeler.Labels(0)).Should(Equal(selinux_labeler.Labels{
+			Process: "system_u:system_r:svirt_lxc_net_t:s0:c0,c1",
+			File:    "system_u:object_r:svirt_sandbox_file_t:s0:c0,c1",
+		}))
+
+		Ω(labeler.Labels(3).Process).Should(Equal("system_u:system_r:svirt_lxc_net_t:s0:c0,c3"))
+		Ω(labeler.Labels(3).File).Should(Equal("system_u:object_r:svirt_sandbox_file_t:s0:c0,c3"))
+	})
+
+	It("gives each UID in a pool its own categories", func() {
+		seen := map[string]bool{}
+
+		for uid := uint32(10000); uid < 10000+4096; uid++ {
+			label := labeler.Labels(uid).Process
+			Ω(seen).ShouldNot(HaveKey(label))
+
+			seen[label] = true
+		}
+	})
+
+	It("never labels with the same category twice", func() {
+		Ω(labeler.Labels(selinux_labeler.MaxContainers - 1).Process).Should(HaveSuffix(":c1022,c1023"))
+		Ω(labeler.Labels(selinux_labeler.MaxContainers).Process).Should(HaveSuffix(":c0,c1"))
+	})
+
+	It("gives the same UID the same labels", func() {
+		Ω(labeler.Labels(10042)).Should(Equal(labeler.Labels(10042)))
+	})
+
+	Context("with a context that already has categories", func() {
+		It("returns an error", func() {
+			_, err := selinux_labeler.New("system_u:system_r:svirt_lxc_net_t:s0:c1,c2", selinux_labeler.DefaultFileContext)
+			Ω(err).Should(Equal(selinux_labeler.InvalidContextError{Context: "system_u:system_r:svirt_lxc_net_t:s0:c1,c2"}))
+		})
+	})
+
+	Context("with a context that is not user:role:type:level", func() {
+		It("returns an error", func() {
+			_, err := selinux_labeler.New(selinux_labeler.DefaultProcessContext, "svirt_sandbox_file_t")
+			Ω(err).Should(Equal(selinux_labeler.InvalidContextError{Context: "svirt_sandbox_file_t"}))
+		})
+	})
+
+	Describe("detecting SELinux", func() {
+		var originalPath string
+		var selinuxFSPath string
+
+		BeforeEach(func() {
+			var err error
+
+			selinuxFSPath, err = ioutil.TempDir("", "selinuxfs")
+			Ω(err).ShouldNot(HaveOccurred())
+
+			originalPath = selinux_labeler.SELinuxFSPath
+			selinux_labeler.SELinuxFSPath = selinuxFSPath
+		})
+
+		AfterEach(func() {
+			selinux_labeler.SELinuxFSPath = originalPath
+			os.RemoveAll(selinuxFSPath)
+		})
+
+		It("is enabled if selinuxfs is mounted", func() {
+			err := ioutil.WriteFile(path.Join(selinuxFSPath, "enforce"), []byte("1"), 0644)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(selinux_labeler.Enabled()).Should(BeTrue())
+		})
+
+		It("is not enabled otherwise", func() {
+			Ω(selinux_labeler.Enabled()).Should(BeFalse())
+		})
+	})
+})
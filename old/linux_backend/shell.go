@@ -0,0 +1,35 @@
+package linux_backend
+
+import "github.com/cloudfoundry-incubator/garden/api"
+
+// A process spec with a TTY but no path runs the user's login shell, for
+// `garden shell`-style clients. wshd starts it in the user's home directory
+// as a login shell, so that it reads /etc/profile, and the client resizes
+// its pty with Process.SetTTY.
+
+// DefaultShellTerm is TERM for interactive shells whose spec does not set it.
+const DefaultShellTerm = "xterm"
+
+type InvalidShellSpecError struct {
+	Reason string
+}
+
+func (e InvalidShellSpecError) Error() string {
+	return "invalid interactive shell spec: " + e.Reason
+}
+
+func isShellSpec(spec api.ProcessSpec) bool {
+	return spec.Path == ""
+}
+
+func validateShellSpec(spec api.ProcessSpec) error {
+	if spec.TTY == nil {
+		return InvalidShellSpecError{"a process without a path must have a tty"}
+	}
+
+	if len(spec.Args) > 0 {
+		return InvalidShellSpecError{"a process without a path cannot have args"}
+	}
+
+	return nil
+}
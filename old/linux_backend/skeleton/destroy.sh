@@ -37,23 +37,22 @@ then
 
   # Done, remove pid
   rm -f ./run/wshd.pid
-
-  # Remove cgroups
-  for system_path in ${cgroup_path}/*
-  do
-    path=$system_path/instance-$id
-
-    if [ -d $path ]
-    then
-      # Recursively remove all cgroup trees under (and including) the instance.
-      #
-      # Running another containerization tool in the container may create these,
-      # and the parent cannot be removed until they're removed first.
-      #
-      # find .. -delete ensures that it processes them depth-first.
-      find $path -type d -delete
-    fi
-  done
-
-  exit 0
 fi
+
+# Remove cgroups, including the devices cgroup made before the container was
+# started
+for system_path in ${cgroup_path}/*
+do
+  path=$system_path/instance-$id
+
+  if [ -d $path ]
+  then
+    # Recursively remove all cgroup trees under (and including) the instance.
+    #
+    # Running another containerization tool in the container may create these,
+    # and the parent cannot be removed until they're removed first.
+    #
+    # find .. -delete ensures that it processes them depth-first.
+    find $path -type d -delete
+  fi
+done
@@ -13,7 +13,16 @@ mount -t devpts -o newinstance,ptmxmode=0666 devpts /dev/pts
 ln -sf pts/ptmx /dev/ptmx
 
 mkdir -p /proc
-mount -t proc none /proc
+if [ "${security_harden_proc_sys:-false}" = "true" ]; then
+  # unprivileged processes see only their own user's processes
+  mount -t proc -o hidepid=2 none /proc
+
+  # the host's memory and kernel tunables are none of the container's business
+  mount --bind /dev/null /proc/kcore
+  mount -t tmpfs -o ro,size=0 none /proc/sys
+else
+  mount -t proc none /proc
+fi
 
 mkdir -p /dev/shm
 mount -t tmpfs tmpfs /dev/shm
@@ -23,10 +32,31 @@ hostname $id
 ip address add 127.0.0.1/8 dev lo
 ip link set lo up
 
-ip address add $network_container_ip/30 dev $network_container_iface
-ip link set $network_container_iface mtu $container_iface_mtu up
+# the network plugin configures the links it builds
+if [ "${network_plugin_links:-false}" != "true" ]; then
+  ip address add $network_container_ip/30 dev $network_container_iface
+  ip link set $network_container_iface mtu $container_iface_mtu up
+
+  ip route add default via $network_host_ip dev $network_container_iface
 
-ip route add default via $network_host_ip dev $network_container_iface
+  # Additional networks are reachable only through their own subnets
+  for attachment in $network_attachments; do
+    attachment_container_ip=$(echo $attachment | cut -d, -f2)
+    attachment_container_iface=$(echo $attachment | cut -d, -f4)
+
+    ip address add $attachment_container_ip/30 dev $attachment_container_iface
+    ip link set $attachment_container_iface mtu $container_iface_mtu up
+  done
+fi
+
+# /sys is only ever there if bind mounted in
+if [ "${security_harden_proc_sys:-false}" = "true" ] && grep -q " /sys " /proc/mounts; then
+  mount -o remount,bind,ro /sys
+
+  if [ -d /sys/firmware ]; then
+    mount -t tmpfs -o ro,size=0 none /sys/firmware
+  fi
+fi
 
 if [ -e /etc/seed ]; then
   . /etc/seed
@@ -13,65 +13,83 @@ source etc/config
 
 # cpuset must be set up first, so that cpuset.cpus and cpuset.mems is assigned
 # otherwise adding the process to the subsystem's tasks will fail with ENOSPC
-for system_path in ${GARDEN_CGROUP_PATH}/{cpuset,cpu,cpuacct,devices,memory}
+#
+# the devices cgroup has already been created and whitelisted by the server
+#
+# hugetlb is only joined where the kernel has it
+subsystems="cpuset cpu cpuacct devices memory"
+if [ -d ${GARDEN_CGROUP_PATH}/hugetlb ]
+then
+  subsystems="$subsystems hugetlb"
+fi
+
+for subsystem in $subsystems
 do
+  system_path=${GARDEN_CGROUP_PATH}/$subsystem
   instance_path=$system_path/instance-$id
 
   mkdir -p $instance_path
 
-  if [ $(basename $system_path) == "cpuset" ]
+  # unless the server placed the container on a NUMA node, it may use all of
+  # the host's
+  if [ $(basename $system_path) == "cpuset" ] && [ -z "$(cat $instance_path/cpuset.cpus)" ]
   then
     cat $system_path/cpuset.cpus > $instance_path/cpuset.cpus
     cat $system_path/cpuset.mems > $instance_path/cpuset.mems
   fi
 
-  if [ $(basename $system_path) == "devices" ]
-  then
-    # Deny everything, allow explicitly
-    echo a > $instance_path/devices.deny
-
-    # Allow mknod for everything.
-    echo "c *:* m" > $instance_path/devices.allow
-    echo "b *:* m" > $instance_path/devices.allow
-
-    # /dev/null
-    echo "c 1:3 rwm" > $instance_path/devices.allow
-    # /dev/zero
-    echo "c 1:5 rwm" > $instance_path/devices.allow
-    # /dev/full
-    echo "c 1:7 rwm" > $instance_path/devices.allow
-    # /dev/random
-    echo "c 1:8 rwm" > $instance_path/devices.allow
-    # /dev/urandom
-    echo "c 1:9 rwm" > $instance_path/devices.allow
-    # /dev/tty0
-    echo "c 4:0 rwm" > $instance_path/devices.allow
-    # /dev/tty1
-    echo "c 4:1 rwm" > $instance_path/devices.allow
-    # /dev/tty
-    echo "c 5:0 rwm" > $instance_path/devices.allow
-    # /dev/console
-    echo "c 5:1 rwm" > $instance_path/devices.allow
-    # /dev/ptmx
-    echo "c 5:2 rwm" > $instance_path/devices.allow
-    # /dev/pts/*
-    echo "c 136:* rwm" > $instance_path/devices.allow
-    # tuntap (?)
-    echo "c 10:200 rwm" > $instance_path/devices.allow
-    # /dev/fuse
-    echo "c 10:229 rwm" > $instance_path/devices.allow
-  fi
-
   echo $PID > $instance_path/tasks
 done
 
 echo $PID > ./run/wshd.pid
 
-ip link add name $network_host_iface type veth peer name $network_container_iface
-ip link set $network_host_iface netns 1
-ip link set $network_container_iface netns $PID
+# Host-side interfaces made so far; if the hook fails part way, they are
+# removed, as they would otherwise outlive the container
+created_ifaces=""
+
+function remove_created_ifaces() {
+  if [ $? -ne 0 ]; then
+    for iface in $created_ifaces; do
+      ip link del $iface 2> /dev/null || true
+    done
+  fi
+}
+
+trap remove_created_ifaces EXIT
+
+# add_veth <host_iface> <container_iface> <host_ip>
+function add_veth() {
+  local host_iface=$1
+  local container_iface=$2
+  local host_ip=$3
+
+  # left behind by an earlier attempt to start the container, which would
+  # make adding it fail
+  ip link del $host_iface 2> /dev/null || true
+
+  ip link add name $host_iface type veth peer name $container_iface
+  created_ifaces="$created_ifaces $host_iface"
+
+  # $PID is wshd's cloned child, which waits on wshd until this hook is done
+  # and cannot be reaped meanwhile, so its pid cannot have been recycled
+  ip link set $host_iface netns 1
+  ip link set $container_iface netns $PID
+
+  ip address add $host_ip/30 dev $host_iface
+  ip link set $host_iface mtu $container_iface_mtu up
+}
+
+# the network plugin builds the container's links itself, once it has
+# started
+if [ "${network_plugin_links:-false}" != "true" ]
+then
+  add_veth $network_host_iface $network_container_iface $network_host_ip
+
+  for attachment in $network_attachments; do
+    IFS=, read attachment_host_ip attachment_container_ip attachment_host_iface attachment_container_iface <<< "$attachment"
 
-ip address add $network_host_ip/30 dev $network_host_iface
-ip link set $network_host_iface mtu $container_iface_mtu up
+    add_veth $attachment_host_iface $attachment_container_iface $attachment_host_ip
+  done
+fi
 
 exit 0
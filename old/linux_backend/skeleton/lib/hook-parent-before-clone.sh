@@ -11,3 +11,45 @@ source ./etc/config
 
 cp bin/wshd $rootfs_path/sbin/wshd
 chmod 700 $rootfs_path/sbin/wshd
+
+# Fails if any of the given path's components within the rootfs is a
+# symlink. This runs on the host, outside of the container's root, so the
+# image's symlinks would be followed to wherever they point on the host.
+function check_no_symlinks() {
+  local target=$rootfs_path
+  local component
+
+  for component in $(echo $1 | tr / ' '); do
+    target=$target/$component
+
+    if [ -L $target ]; then
+      echo "refusing to follow symlink in rootfs: ${target#${rootfs_path}}" 1>&2
+      return 1
+    fi
+  done
+}
+
+# Make the container's environment visible to login shells and the console
+if [ -f etc/env ] && check_no_symlinks etc/profile.d/garden-env.sh
+then
+  mkdir -p $rootfs_path/etc/profile.d
+  cp etc/env $rootfs_path/etc/profile.d/garden-env.sh
+
+  # the depot's copy is only readable by root
+  chmod 644 $rootfs_path/etc/profile.d/garden-env.sh
+fi
+
+# Expose the container's core dumps, kept in the depot by the host's core
+# handler, read-only at /var/garden/cores so that they can be streamed out.
+# The mount point comes from the image, so creation fails rather than
+# follow its symlinks and mount over the host's directories.
+check_no_symlinks var/garden/cores
+mkdir -p cores $rootfs_path/var/garden/cores
+mount -n --bind cores $rootfs_path/var/garden/cores
+mount -n --bind -o remount,ro cores $rootfs_path/var/garden/cores
+
+# Likewise packet captures, written to the depot by net.sh capture
+check_no_symlinks var/garden/captures
+mkdir -p captures $rootfs_path/var/garden/captures
+mount -n --bind captures $rootfs_path/var/garden/captures
+mount -n --bind -o remount,ro captures $rootfs_path/var/garden/captures
@@ -5,7 +5,8 @@ set -o nounset
 set -o errexit
 shopt -s nullglob
 
-cd $(dirname "${0}")
+# run from the skeleton by the privileged helper, with the container's path
+cd "${container_path:-$(dirname "${0}")}"
 
 source ./etc/config
 
@@ -17,10 +18,22 @@ nat_postrouting_chain="${GARDEN_IPTABLES_NAT_POSTROUTING_CHAIN}"
 nat_instance_prefix="${GARDEN_IPTABLES_NAT_INSTANCE_PREFIX}"
 interface_name_prefix="${GARDEN_NETWORK_INTERFACE_PREFIX}"
 
-filter_instance_chain="${filter_instance_prefix}${id}"
-nat_instance_chain="${filter_instance_prefix}${id}"
+# iptables chain names are limited to 28 characters, so long IDs are
+# shortened to their tail, leaving room for additional networks' "-N"
+max_chain_id_len=$((28 - ${#filter_instance_prefix} - 3))
+chain_id="${id}"
+if [ ${#id} -gt ${max_chain_id_len} ]; then
+  chain_id="${id: -${max_chain_id_len}}"
+fi
 
-external_ip=$(ip route get 8.8.8.8 | sed 's/.*src\s\(.*\)\s/\1/;tx;d;:x')
+filter_instance_chain="${filter_instance_prefix}${chain_id}"
+nat_instance_chain="${filter_instance_prefix}${chain_id}"
+
+# Additional networks, as host_ip,container_ip,host_iface,container_iface
+network_attachments="${network_attachments:-}"
+
+# External IP NATed 1:1 to and from the container, if any
+container_external_ip="${container_external_ip:-}"
 
 function teardown_filter() {
   # Prune forward chain
@@ -32,6 +45,14 @@ function teardown_filter() {
   # Flush and delete instance chain
   iptables -w -F ${filter_instance_chain} 2> /dev/null || true
   iptables -w -X ${filter_instance_chain} 2> /dev/null || true
+
+  # Flush and delete additional networks' chains
+  local index=1
+  for attachment in ${network_attachments}; do
+    iptables -w -F ${filter_instance_chain}-${index} 2> /dev/null || true
+    iptables -w -X ${filter_instance_chain}-${index} 2> /dev/null || true
+    index=$((index + 1))
+  done
 }
 
 function setup_filter() {
@@ -46,6 +67,23 @@ function setup_filter() {
   iptables -w -I ${filter_forward_chain} 2 \
     --in-interface ${network_host_iface} \
     --goto ${filter_instance_chain}
+
+  # Each additional network gets a chain of its own, so that rules for one
+  # network never apply to another
+  local index=1
+  for attachment in ${network_attachments}; do
+    local host_iface=$(echo ${attachment} | cut -d, -f3)
+
+    iptables -w -N ${filter_instance_chain}-${index}
+    iptables -w -A ${filter_instance_chain}-${index} \
+      --goto ${filter_default_chain}
+
+    iptables -w -I ${filter_forward_chain} 2 \
+      --in-interface ${host_iface} \
+      --goto ${filter_instance_chain}-${index}
+
+    index=$((index + 1))
+  done
 }
 
 function teardown_nat() {
@@ -58,6 +96,14 @@ function teardown_nat() {
   # Flush and delete instance chain
   iptables -w -t nat -F ${nat_instance_chain} 2> /dev/null || true
   iptables -w -t nat -X ${nat_instance_chain} 2> /dev/null || true
+
+  # Remove external IP's SNAT
+  if [ -n "${container_external_ip}" ]; then
+    iptables -w -t nat -D ${nat_postrouting_chain} \
+      --source ${network_container_ip} \
+      --jump SNAT \
+      --to-source ${container_external_ip} 2> /dev/null || true
+  fi
 }
 
 function setup_nat() {
@@ -69,6 +115,39 @@ function setup_nat() {
   # Bind instance chain to prerouting chain
   iptables -w -t nat -A ${nat_prerouting_chain} \
     --jump ${nat_instance_chain}
+
+  # NAT the external IP 1:1; the SNAT goes ahead of the pool's SNAT to the
+  # host's IP
+  if [ -n "${container_external_ip}" ]; then
+    iptables -w -t nat -A ${nat_instance_chain} \
+      --destination ${container_external_ip} \
+      --jump DNAT \
+      --to-destination ${network_container_ip}
+
+    iptables -w -t nat -I ${nat_postrouting_chain} 1 \
+      --source ${network_container_ip} \
+      --jump SNAT \
+      --to-source ${container_external_ip}
+  fi
+}
+
+function teardown_neighbours() {
+  # Neighbour and conntrack entries for the container's addresses would
+  # otherwise outlive it, leaving whichever container is next given them
+  # unreachable until they expire
+  local ips="${network_container_ip}"
+  for attachment in ${network_attachments}; do
+    ips="${ips} $(echo ${attachment} | cut -d, -f2)"
+  done
+
+  for ip in ${ips}; do
+    ip neigh flush to ${ip} 2> /dev/null || true
+
+    if which conntrack > /dev/null 2>&1; then
+      conntrack -D --orig-src ${ip} > /dev/null 2>&1 || true
+      conntrack -D --reply-src ${ip} > /dev/null 2>&1 || true
+    fi
+  done
 }
 
 case "${1}" in
@@ -81,50 +160,114 @@ case "${1}" in
   "teardown")
     teardown_filter
     teardown_nat
+    teardown_neighbours
 
     ;;
 
-  "in")
-    if [ -z "${HOST_PORT:-}" ]; then
-      echo "Please specify HOST_PORT..." 1>&2
+  "check")
+    # Fails if the instance chains are missing, unbound, or do not contain
+    # the expected number of rules
+    iptables -w -S ${filter_forward_chain} | grep -q "\-i ${network_host_iface} -g ${filter_instance_chain}$"
+    iptables -w -t nat -S ${nat_prerouting_chain} | grep -q "\-j ${nat_instance_chain}\b"
+
+    filter_rules=$(iptables -w -S ${filter_instance_chain} | grep -c "^-A" || true)
+    nat_rules=$(iptables -w -t nat -S ${nat_instance_chain} | grep -c "^-A" || true)
+
+    if [ "${filter_rules}" != "${FILTER_RULES:-1}" ]; then
+      echo "expected ${FILTER_RULES:-1} filter rules, found ${filter_rules}" 1>&2
       exit 1
     fi
 
-    if [ -z "${CONTAINER_PORT:-}" ]; then
-      echo "Please specify CONTAINER_PORT..." 1>&2
+    if [ "${nat_rules}" != "${NAT_RULES:-0}" ]; then
+      echo "expected ${NAT_RULES:-0} nat rules, found ${nat_rules}" 1>&2
       exit 1
     fi
 
-    iptables -w -t nat -A ${nat_instance_chain} \
-      --protocol tcp \
-      --destination "${external_ip}" \
-      --destination-port "${HOST_PORT}" \
-      --jump DNAT \
-      --to-destination "${network_container_ip}:${CONTAINER_PORT}"
+    index=1
+    for attachment in ${network_attachments}; do
+      host_iface=$(echo ${attachment} | cut -d, -f3)
+
+      iptables -w -S ${filter_forward_chain} | grep -q "\-i ${host_iface} -g ${filter_instance_chain}-${index}$"
+
+      attachment_rules=$(iptables -w -S ${filter_instance_chain}-${index} | grep -c "^-A" || true)
+      if [ "${attachment_rules}" != "1" ]; then
+        echo "expected 1 filter rule for network ${index}, found ${attachment_rules}" 1>&2
+        exit 1
+      fi
+
+      index=$((index + 1))
+    done
+
+    ;;
+
+  "check_links")
+    # Fails if a host-side interface is missing or has lost its address
+    ip address show dev ${network_host_iface} | grep -q "inet ${network_host_ip}/30"
+
+    for attachment in ${network_attachments}; do
+      host_ip=$(echo ${attachment} | cut -d, -f1)
+      host_iface=$(echo ${attachment} | cut -d, -f3)
+
+      ip address show dev ${host_iface} | grep -q "inet ${host_ip}/30"
+    done
 
     ;;
 
-  "out")
-    if [ -z "${NETWORK:-}" ] && [ -z "${PORT:-}" ]; then
-      echo "Please specify NETWORK and/or PORT..." 1>&2
+  "check_gateway")
+    # Fails unless the container answers the host over its network
+    ping -c 1 -W 1 -I ${network_host_iface} ${network_container_ip} > /dev/null
+
+    ;;
+
+  "usage")
+    # Prints the bytes received and sent by the container over all of its
+    # networks, which are those sent and received by the host-side interfaces
+    host_ifaces=${network_host_iface}
+    for attachment in ${network_attachments}; do
+      host_ifaces="${host_ifaces} $(echo ${attachment} | cut -d, -f3)"
+    done
+
+    received=0
+    sent=0
+    for host_iface in ${host_ifaces}; do
+      received=$((received + $(cat /sys/class/net/${host_iface}/statistics/tx_bytes)))
+      sent=$((sent + $(cat /sys/class/net/${host_iface}/statistics/rx_bytes)))
+    done
+
+    echo "${received} ${sent}"
+
+    ;;
+
+  "capture")
+    # Captures packets on all of the container's interfaces, from inside its
+    # network namespace, to CAPTURE_PATH until killed or PACKETS packets, of
+    # which SNAP_LENGTH bytes each are kept, have been captured
+    if [ -z "${CAPTURE_PATH:-}" ]; then
+      echo "Please specify CAPTURE_PATH..." 1>&2
       exit 1
     fi
 
-    opts=""
+    pid=$(cat run/wshd.pid)
 
-    if [ -n "${NETWORK:-}" ]; then
-      opts="${opts} --destination ${NETWORK}"
-    fi
+    # wshd may have died, and its pid been reused, since it was recorded, so
+    # its namespace is held open before checking that it is still in the
+    # container's cgroups
+    exec 3< /proc/${pid}/ns/net
 
-    # Restrict protocol to tcp when port is specified
-    if [ -n "${PORT:-}" ]; then
-      opts="${opts} --protocol tcp"
-      opts="${opts} --destination-port ${PORT}"
+    if ! grep -q "/instance-${id}\$" /proc/${pid}/cgroup; then
+      echo "wshd (pid ${pid}) is no longer in the container" 1>&2
+      exit 1
     fi
 
-    iptables -w -I ${filter_instance_chain} 1 ${opts} --jump RETURN
+    # Debian and Ubuntu build tcpdump to drop to the tcpdump user before
+    # opening the capture file, which it could not then write in the
+    # root-owned captures directory; -Z root keeps it as root
+    exec nsenter --net=/proc/self/fd/3 \
+      tcpdump -Z root -i any -n -U -w "${CAPTURE_PATH}" \
+      -c "${PACKETS:-1000}" -s "${SNAP_LENGTH:-65535}"
 
     ;;
+
   "get_ingress_info")
     if [ -z "${ID:-}" ]; then
       echo "Please specify container ID..." 1>&2
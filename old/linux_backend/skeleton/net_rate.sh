@@ -5,7 +5,8 @@ set -o nounset
 set -o errexit
 shopt -s nullglob
 
-cd $(dirname "${0}")
+# run from the skeleton by the privileged helper, with the container's path
+cd "${container_path:-$(dirname "${0}")}"
 
 source ./etc/config
 
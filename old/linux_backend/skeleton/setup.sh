@@ -10,12 +10,37 @@ cd $(dirname $0)
 # Defaults for debugging the setup script
 iface_name_prefix="${GARDEN_NETWORK_INTERFACE_PREFIX}"
 max_id_len=$(expr 16 - ${#iface_name_prefix} - 2)
-iface_name=$(tail -c ${max_id_len} <<< ${id})
+
+# The pool chooses the interface name, to keep it unique
+iface_name=${iface_name:-$(tail -c ${max_id_len} <<< ${id})}
 id=${id:-test}
 network_host_ip=${network_host_ip:-10.0.0.1}
 network_host_iface="${iface_name_prefix}${iface_name}-0"
 network_container_ip=${network_container_ip:-10.0.0.2}
 network_container_iface="${iface_name_prefix}${iface_name}-1"
+
+# Additional networks, given as host_ip,container_ip pairs, get interfaces
+# -2/-3, -4/-5 and so on
+attachments=""
+attachment_index=1
+for attachment in ${network_attachments:-}; do
+  attachment_host_iface="${iface_name_prefix}${iface_name}-$((attachment_index * 2))"
+  attachment_container_iface="${iface_name_prefix}${iface_name}-$((attachment_index * 2 + 1))"
+  attachments="${attachments} ${attachment},${attachment_host_iface},${attachment_container_iface}"
+  attachment_index=$((attachment_index + 1))
+done
+network_attachments="${attachments# }"
+container_external_ip=${container_external_ip:-}
+network_tun=${network_tun:-false}
+filesystem_fuse=${filesystem_fuse:-false}
+security_no_new_privs=${security_no_new_privs:-false}
+security_harden_proc_sys=${security_harden_proc_sys:-false}
+security_apparmor_profile=${security_apparmor_profile:-}
+security_selinux_label=${security_selinux_label:-}
+network_plugin_links=${network_plugin_links:-false}
+network_dns_servers=${network_dns_servers:-}
+network_dns_search=${network_dns_search:-}
+
 user_uid=${user_uid:-10000}
 rootfs_path=$(readlink -f $rootfs_path)
 
@@ -26,6 +51,15 @@ network_host_ip=$network_host_ip
 network_host_iface=$network_host_iface
 network_container_ip=$network_container_ip
 network_container_iface=$network_container_iface
+network_attachments="$network_attachments"
+container_external_ip=$container_external_ip
+network_tun=$network_tun
+filesystem_fuse=$filesystem_fuse
+security_no_new_privs=$security_no_new_privs
+security_harden_proc_sys=$security_harden_proc_sys
+security_apparmor_profile=$security_apparmor_profile
+security_selinux_label=$security_selinux_label
+network_plugin_links=$network_plugin_links
 user_uid=$user_uid
 rootfs_path=$rootfs_path
 EOS
@@ -54,6 +88,20 @@ adddev root $rootfs_path/dev/null 1 3
 adddev root $rootfs_path/dev/zero 1 5
 adddev root $rootfs_path/dev/full 1 7
 
+# /dev/net/tun, for containers that opted in to it
+if [ "$network_tun" == "true" ]
+then
+  mkdir -p $rootfs_path/dev/net
+  adddev root $rootfs_path/dev/net/tun 10 200
+fi
+
+# /dev/fuse, for containers that opted in to it; unprivileged users mount with
+# the rootfs's setuid fusermount
+if [ "$filesystem_fuse" == "true" ]
+then
+  adddev root $rootfs_path/dev/fuse 10 229
+fi
+
 # /dev/fd, /dev/std{in,out,err}
 pushd $rootfs_path/dev > /dev/null
 ln -s /proc/self/fd
@@ -71,13 +119,22 @@ cat > $rootfs_path/etc/hosts <<-EOS
 $network_container_ip $id
 EOS
 
-# By default, inherit the nameserver from the host container.
+# Use the nameservers the container was given, if any. By default, inherit
+# the nameserver from the host container.
 #
 # Exception: When the host's nameserver is set to localhost (127.0.0.1), it is
 # assumed to be running its own DNS server and listening on all interfaces.
 # In this case, the container must use the network_host_ip address
 # as the nameserver.
-if [[ "$(cat /etc/resolv.conf)" == "nameserver 127.0.0.1" ]]
+if [ -n "$network_dns_servers" ]
+then
+  rm -f $rootfs_path/etc/resolv.conf
+
+  for server in $network_dns_servers
+  do
+    echo "nameserver $server"
+  done > $rootfs_path/etc/resolv.conf
+elif [[ "$(cat /etc/resolv.conf)" == "nameserver 127.0.0.1" ]]
 then
   cat > $rootfs_path/etc/resolv.conf <<-EOS
 nameserver $network_host_ip
@@ -90,6 +147,13 @@ else
   cp /etc/resolv.conf $rootfs_path/etc/
 fi
 
+# The search domains the container was given replace any others
+if [ -n "$network_dns_search" ]
+then
+  sed -i -e '/^\(search\|domain\)[[:space:]]/d' $rootfs_path/etc/resolv.conf
+  echo "search $network_dns_search" >> $rootfs_path/etc/resolv.conf
+fi
+
 # Add vcap user if not already present
 if ! chroot $rootfs_path id vcap >/dev/null 2>&1; then
   mkdir -p $rootfs_path/home
@@ -5,7 +5,8 @@ set -o nounset
 set -o errexit
 shopt -s nullglob
 
-cd $(dirname $0)
+# run from the skeleton by the privileged helper, with the container's path
+cd "${container_path:-$(dirname $0)}"
 
 source ./etc/config
 
@@ -15,6 +16,39 @@ then
   exit 1
 fi
 
-./net.sh setup
+wshd_opts=""
 
-./bin/wshd --run ./run --lib ./lib --root $rootfs_path --title "wshd: $id"
+# Let unprivileged processes configure the container's tun devices
+if [ "${network_tun:-false}" == "true" ]
+then
+  wshd_opts="--net-admin"
+fi
+
+# Keep unprivileged processes from escalating through setuid binaries in the
+# image, unless the container opted out
+if [ "${security_no_new_privs:-false}" == "true" ]
+then
+  wshd_opts="$wshd_opts --no-new-privs"
+fi
+
+# Confine the container's processes with its AppArmor profile, if the host has
+# AppArmor; elsewhere they run unconfined, as they always have
+if [ -n "${security_apparmor_profile:-}" ] && [ "$(cat /sys/module/apparmor/parameters/enabled 2> /dev/null)" == "Y" ]
+then
+  if ! grep -q "^${security_apparmor_profile} (" /sys/kernel/security/apparmor/profiles
+  then
+    echo "AppArmor profile not loaded: ${security_apparmor_profile}" 1>&2
+    exit 1
+  fi
+
+  wshd_opts="$wshd_opts --apparmor-profile $security_apparmor_profile"
+fi
+
+# Run the container's processes with its SELinux label, whose categories keep
+# them out of other containers' files
+if [ -n "${security_selinux_label:-}" ]
+then
+  wshd_opts="$wshd_opts --selinux-label $security_selinux_label"
+fi
+
+./bin/wshd --run ./run --lib ./lib --root $rootfs_path --title "wshd: $id" $wshd_opts
@@ -1,11 +1,15 @@
 package linux_backend
 
 import (
+	"encoding/json"
+	"errors"
+	"net"
 	"time"
 
 	"github.com/cloudfoundry-incubator/garden/api"
 
 	"github.com/cloudfoundry-incubator/garden-linux/old/linux_backend/network"
+	"github.com/cloudfoundry-incubator/garden-linux/old/logging"
 )
 
 type ContainerSnapshot struct {
@@ -14,21 +18,67 @@ type ContainerSnapshot struct {
 
 	GraceTime time.Duration
 
-	State  string
+	State string
+
+	// StateTimes are zero in snapshots from before they were recorded
+	StateTimes StateTimes
+
 	Events []string
 
+	Warnings []string `json:",omitempty"`
+
 	Limits LimitsSnapshot
 
 	Resources ResourcesSnapshot
 
 	Processes []ProcessSnapshot
 
-	NetIns  []NetInSpec
-	NetOuts []NetOutSpec
+	NetIns      []NetInSpec
+	NetOutRules []NetOutRule
+
+	// NetOuts is only read, from snapshots predating NetOutRules
+	NetOuts []NetOutSpec `json:",omitempty"`
 
 	Properties api.Properties
 
 	EnvVars []string
+
+	RootFSProvenance RootFSProvenance
+
+	Annotations Annotations
+
+	// MTU is that of the container's interfaces, as it was started with
+	MTU uint32 `json:",omitempty"`
+
+	// HostRebooted is set on snapshots saved before a host reboot, whose
+	// containers must be started again rather than re-attached to
+	HostRebooted bool `json:",omitempty"`
+}
+
+// ValidateSnapshot checks that a saved snapshot is one that can be restored:
+// a ContainerSnapshot naming the container it is of.
+func ValidateSnapshot(contents []byte) error {
+	var snapshot ContainerSnapshot
+
+	err := json.Unmarshal(contents, &snapshot)
+	if err != nil {
+		return err
+	}
+
+	if snapshot.ID == "" || snapshot.Handle == "" {
+		return errors.New("snapshot has no container id or handle")
+	}
+
+	return nil
+}
+
+// loggable is the snapshot with the values of sensitive environment
+// variables and properties redacted.
+func (s ContainerSnapshot) loggable() ContainerSnapshot {
+	s.EnvVars = logging.DefaultRedactor.Env(s.EnvVars)
+	s.Properties = logging.DefaultRedactor.Properties(s.Properties)
+
+	return s
 }
 
 type LimitsSnapshot struct {
@@ -36,12 +86,15 @@ type LimitsSnapshot struct {
 	Disk      *api.DiskLimits
 	Bandwidth *api.BandwidthLimits
 	CPU       *api.CPULimits
+	HugePages HugePageLimits `json:",omitempty"`
 }
 
 type ResourcesSnapshot struct {
-	UID     uint32
-	Network *network.Network
-	Ports   []uint32
+	UID                uint32
+	Network            *network.Network
+	AdditionalNetworks []*network.Network
+	ExternalIP         net.IP
+	Ports              []uint32
 }
 
 type ProcessSnapshot struct {
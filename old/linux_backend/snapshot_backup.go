@@ -0,0 +1,143 @@
+package linux_backend
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+
+	"github.com/pivotal-golang/lager"
+)
+
+// SnapshotUploader ships snapshots off the host, e.g. to a blobstore, so
+// that containers' metadata survives the loss of its disk.
+type SnapshotUploader interface {
+	Upload(name string, contents []byte) error
+	Delete(name string) error
+
+	// List returns the names of the snapshots uploaded, by this server or
+	// any before it.
+	List() ([]string, error)
+}
+
+// the names of the reserved ports and boot ID, as the file store keeps them
+const (
+	reservedPortsBackup = ".reserved-ports"
+	bootIDBackup        = ".boot-id"
+)
+
+// BackUpSnapshotsTo has BackUpSnapshots, and Stop, upload snapshots with
+// the uploader. It must be called before the backend is started.
+func (b *LinuxBackend) BackUpSnapshotsTo(uploader SnapshotUploader) {
+	b.snapshotUploader = uploader
+	b.backedUp = map[string][sha256.Size]byte{}
+}
+
+// BackUpSnapshots uploads the snapshot of each container, which records the
+// subnets, ports and uid it holds, along with the reserved ports and the
+// host's boot ID, each only if it has changed since it was last uploaded,
+// and deletes the snapshots it uploaded of containers since destroyed. They
+// are named as the file store names them, so that a directory of them can
+// be given as the snapshots directory of a server replacing this one.
+// Failures are logged, and retried on the next backup.
+//
+// Only what this server uploaded is ever deleted: a replacement starting
+// on a blank disk must not delete the snapshots it is to be restored from,
+// nor servers sharing a prefix each other's. The first backup lists and
+// logs what is uploaded that the server does not hold, for operators to
+// restore or clean up.
+func (b *LinuxBackend) BackUpSnapshots() {
+	b.backupMutex.Lock()
+	defer b.backupMutex.Unlock()
+
+	bLog := b.logger.Session("back-up-snapshots")
+
+	backups := map[string][]byte{}
+
+	// containers that could not be snapshotted keep their last backups
+	kept := map[string]bool{}
+
+	for _, container := range b.containers.all() {
+		snapshot := new(bytes.Buffer)
+
+		err := container.Snapshot(snapshot)
+		if err != nil {
+			bLog.Error("failed-to-snapshot", err, lager.Data{
+				"container": container.ID(),
+			})
+
+			kept[container.ID()] = true
+
+			continue
+		}
+
+		backups[container.ID()] = snapshot.Bytes()
+	}
+
+	reservedPorts, err := json.Marshal(b.ReservedPorts())
+	if err == nil {
+		backups[reservedPortsBackup] = reservedPorts
+	}
+
+	bootID, err := b.systemInfo.BootID()
+	if err != nil {
+		bLog.Error("failed-to-get-boot-id", err)
+	} else {
+		backups[bootIDBackup] = []byte(bootID)
+	}
+
+	if !b.backupsListed {
+		b.listBackups(bLog, backups, kept)
+	}
+
+	for name, contents := range backups {
+		sum := sha256.Sum256(contents)
+		if last, found := b.backedUp[name]; found && last == sum {
+			continue
+		}
+
+		err := b.snapshotUploader.Upload(name, contents)
+		if err != nil {
+			bLog.Error("failed-to-upload", err, lager.Data{"name": name})
+			continue
+		}
+
+		b.backedUp[name] = sum
+	}
+
+	for name := range b.backedUp {
+		if _, found := backups[name]; found || kept[name] || name == bootIDBackup {
+			continue
+		}
+
+		err := b.snapshotUploader.Delete(name)
+		if err != nil {
+			bLog.Error("failed-to-delete", err, lager.Data{"name": name})
+			continue
+		}
+
+		delete(b.backedUp, name)
+	}
+}
+
+// listBackups logs the snapshots already uploaded that are not among those
+// the server holds, which it leaves as they are.
+func (b *LinuxBackend) listBackups(logger lager.Logger, backups map[string][]byte, kept map[string]bool) {
+	names, err := b.snapshotUploader.List()
+	if err != nil {
+		logger.Error("failed-to-list", err)
+		return
+	}
+
+	unheld := []string{}
+	for _, name := range names {
+		if _, found := backups[name]; !found && !kept[name] {
+			unheld = append(unheld, name)
+		}
+	}
+
+	if len(unheld) > 0 {
+		logger.Info("keeping-backups-not-held", lager.Data{"names": unheld})
+	}
+
+	b.backupsListed = true
+}
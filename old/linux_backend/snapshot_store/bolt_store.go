@@ -0,0 +1,401 @@
+package snapshot_store
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"os"
+	"time"
+
+	"github.com/boltdb/bolt"
+	"github.com/pivotal-golang/lager"
+)
+
+// BoltStore keeps the snapshots, the boot ID and the reserved ports in a
+// single BoltDB file, each saved in a transaction of its own, so that a
+// crash leaves either the old or the new version of whatever was being
+// saved, and Clear removes every snapshot or none.
+//
+// Bolt only checksums its own metadata, so each value is kept with a CRC-32
+// of it. Snapshots whose checksum does not match, or that Validate rejects,
+// are moved to a corrupt bucket rather than being loaded. A database that
+// cannot be opened, or fails bolt's consistency check, is moved aside for a
+// new one, named after it with a .corrupt suffix and when it was moved.
+//
+// Bolt never shrinks its file, so the database is compacted whenever it is
+// opened.
+type BoltStore struct {
+	path string
+	db   *bolt.DB
+
+	// whether a snapshot can be restored; every snapshot is if nil
+	Validate func(snapshot []byte) error
+}
+
+var (
+	snapshotsBucket = []byte("snapshots")
+	stateBucket     = []byte("state")
+	corruptBucket   = []byte("corrupt")
+
+	bootIDKey        = []byte("boot-id")
+	reservedPortsKey = []byte("reserved-ports")
+)
+
+// ErrChecksumMismatch is returned for values that are not as they were
+// saved.
+var ErrChecksumMismatch = errors.New("checksum mismatch")
+
+// how long to wait for another process to let go of the database, as
+// another server still running on it would not
+const boltOpenTimeout = time.Second
+
+// OpenBoltStore opens the database at the path, creating it if need be.
+func OpenBoltStore(logger lager.Logger, path string) (*BoltStore, error) {
+	store := &BoltStore{path: path}
+
+	err := store.open(logger)
+	if err != nil {
+		return nil, err
+	}
+
+	err = store.Compact()
+	if err != nil {
+		logger.Error("failed-to-compact", err)
+	}
+
+	return store, nil
+}
+
+func (s *BoltStore) open(logger lager.Logger) error {
+	db, err := openChecked(s.path)
+	if corrupt, ok := err.(CorruptDatabaseError); ok {
+		logger.Error("corrupt-database", corrupt, lager.Data{"path": s.path})
+
+		movedPath := s.path + ".corrupt." + time.Now().UTC().Format("20060102T150405.000000000")
+
+		err = os.Rename(s.path, movedPath)
+		if err != nil {
+			return err
+		}
+
+		logger.Info("moved-aside", lager.Data{"path": movedPath})
+
+		db, err = openBolt(s.path)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, bucket := range [][]byte{snapshotsBucket, stateBucket, corruptBucket} {
+			_, err := tx.CreateBucketIfNotExists(bucket)
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return err
+	}
+
+	s.db = db
+
+	return nil
+}
+
+// CorruptDatabaseError is why a database was found to be corrupt.
+type CorruptDatabaseError struct {
+	Err error
+}
+
+func (e CorruptDatabaseError) Error() string {
+	return "corrupt snapshot database: " + e.Err.Error()
+}
+
+// openChecked opens the database and runs bolt's consistency check of
+// every page. Bolt panics, rather than failing, on some corruption.
+func openChecked(path string) (db *bolt.DB, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			if db != nil {
+				db.Close()
+			}
+
+			db, err = nil, CorruptDatabaseError{fmt.Errorf("%v", r)}
+		}
+	}()
+
+	db, err = openBolt(path)
+
+	switch err {
+	case nil:
+	case bolt.ErrInvalid, bolt.ErrVersionMismatch, bolt.ErrChecksum:
+		return nil, CorruptDatabaseError{err}
+	default:
+		return nil, err
+	}
+
+	err = db.View(func(tx *bolt.Tx) error {
+		for err := range tx.Check() {
+			return err
+		}
+
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, CorruptDatabaseError{err}
+	}
+
+	return db, nil
+}
+
+func openBolt(path string) (*bolt.DB, error) {
+	return bolt.Open(path, 0600, &bolt.Options{Timeout: boltOpenTimeout})
+}
+
+// Compact rewrites the database into a new file, without the free pages
+// left by what was saved and cleared, and renames it into place.
+func (s *BoltStore) Compact() error {
+	compactingPath := s.path + ".compacting"
+
+	os.Remove(compactingPath)
+
+	compacted, err := openBolt(compactingPath)
+	if err != nil {
+		return err
+	}
+
+	err = s.db.View(func(tx *bolt.Tx) error {
+		return compacted.Update(func(compactedTx *bolt.Tx) error {
+			return tx.ForEach(func(name []byte, bucket *bolt.Bucket) error {
+				compactedBucket, err := compactedTx.CreateBucket(name)
+				if err != nil {
+					return err
+				}
+
+				return bucket.ForEach(func(key []byte, value []byte) error {
+					return compactedBucket.Put(key, value)
+				})
+			})
+		})
+	})
+
+	closeErr := compacted.Close()
+	if err == nil {
+		err = closeErr
+	}
+
+	if err != nil {
+		os.Remove(compactingPath)
+		return err
+	}
+
+	err = s.db.Close()
+	if err != nil {
+		return err
+	}
+
+	err = os.Rename(compactingPath, s.path)
+	if err != nil {
+		os.Remove(compactingPath)
+	}
+
+	// reopened whether or not it was replaced
+	db, openErr := openBolt(s.path)
+	if openErr != nil {
+		return openErr
+	}
+
+	s.db = db
+
+	return err
+}
+
+func (s *BoltStore) Close() error {
+	return s.db.Close()
+}
+
+// Load returns the snapshots by container ID. Snapshots that are corrupt or
+// invalid are logged, moved to the corrupt bucket and left out.
+func (s *BoltStore) Load(logger lager.Logger) (map[string][]byte, error) {
+	snapshots := map[string][]byte{}
+
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(snapshotsBucket)
+
+		unloadable := [][]byte{}
+
+		err := bucket.ForEach(func(key []byte, value []byte) error {
+			snapshot, err := decode(value)
+			if err == nil && s.Validate != nil {
+				err = s.Validate(snapshot)
+			}
+
+			if err != nil {
+				logger.Error("invalid-snapshot", err, lager.Data{
+					"snapshot": string(key),
+				})
+
+				unloadable = append(unloadable, append([]byte{}, key...))
+
+				return nil
+			}
+
+			// values are only valid for the transaction
+			snapshots[string(key)] = append([]byte{}, snapshot...)
+
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		corrupt := tx.Bucket(corruptBucket)
+
+		for _, key := range unloadable {
+			movedKey := string(key) + "." + time.Now().UTC().Format("20060102T150405.000000000")
+
+			err := corrupt.Put([]byte(movedKey), bucket.Get(key))
+			if err != nil {
+				return err
+			}
+
+			err = bucket.Delete(key)
+			if err != nil {
+				return err
+			}
+
+			logger.Info("moved-aside", lager.Data{
+				"snapshot": string(key),
+				"key":      movedKey,
+			})
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return snapshots, nil
+}
+
+func (s *BoltStore) Save(id string, snapshot []byte) error {
+	return s.put(snapshotsBucket, []byte(id), snapshot)
+}
+
+// Clear removes every snapshot, leaving the boot ID, the reserved ports and
+// the corrupt snapshots as they are.
+func (s *BoltStore) Clear() error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		err := tx.DeleteBucket(snapshotsBucket)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.CreateBucket(snapshotsBucket)
+		return err
+	})
+}
+
+// LoadBootID returns the boot ID saved with the snapshots, or "" if none
+// was.
+func (s *BoltStore) LoadBootID() (string, error) {
+	contents, err := s.get(stateBucket, bootIDKey)
+	if err != nil {
+		return "", err
+	}
+
+	return string(contents), nil
+}
+
+func (s *BoltStore) SaveBootID(bootID string) error {
+	return s.put(stateBucket, bootIDKey, []byte(bootID))
+}
+
+// LoadReservedPorts returns the host ports saved as reserved, or none if
+// none were.
+func (s *BoltStore) LoadReservedPorts() ([]uint32, error) {
+	contents, err := s.get(stateBucket, reservedPortsKey)
+	if err != nil || contents == nil {
+		return nil, err
+	}
+
+	var ports []uint32
+
+	err = json.Unmarshal(contents, &ports)
+	if err != nil {
+		return nil, err
+	}
+
+	return ports, nil
+}
+
+func (s *BoltStore) SaveReservedPorts(ports []uint32) error {
+	contents, err := json.Marshal(ports)
+	if err != nil {
+		return err
+	}
+
+	return s.put(stateBucket, reservedPortsKey, contents)
+}
+
+func (s *BoltStore) put(bucket []byte, key []byte, contents []byte) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(bucket).Put(key, encode(contents))
+	})
+}
+
+// get returns the decoded value of the key, or nil if it has none.
+func (s *BoltStore) get(bucket []byte, key []byte) ([]byte, error) {
+	var contents []byte
+
+	err := s.db.View(func(tx *bolt.Tx) error {
+		value := tx.Bucket(bucket).Get(key)
+		if value == nil {
+			return nil
+		}
+
+		decoded, err := decode(value)
+		if err != nil {
+			return err
+		}
+
+		contents = append([]byte{}, decoded...)
+
+		return nil
+	})
+
+	return contents, err
+}
+
+// encode prefixes the contents with their CRC-32, big-endian.
+func encode(contents []byte) []byte {
+	value := make([]byte, 4+len(contents))
+
+	binary.BigEndian.PutUint32(value, crc32.ChecksumIEEE(contents))
+	copy(value[4:], contents)
+
+	return value
+}
+
+func decode(value []byte) ([]byte, error) {
+	if len(value) < 4 {
+		return nil, ErrChecksumMismatch
+	}
+
+	contents := value[4:]
+
+	if binary.BigEndian.Uint32(value) != crc32.ChecksumIEEE(contents) {
+		return nil, ErrChecksumMismatch
+	}
+
+	return contents, nil
+}
@@ -0,0 +1,322 @@
+package snapshot_store_test
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/boltdb/bolt"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/pivotal-golang/lager/lagertest"
+
+	"github.com/cloudfoundry-incubator/garden-linux/old/linux_backend/snapshot_store"
+)
+
+var _ = Describe("BoltStore", func() {
+	var tmpdir string
+	var dbPath string
+
+	var store *snapshot_store.BoltStore
+	var logger *lagertest.TestLogger
+
+	open := func() {
+		var err error
+
+		store, err = snapshot_store.OpenBoltStore(logger, dbPath)
+		Ω(err).ShouldNot(HaveOccurred())
+	}
+
+	reopen := func() {
+		err := store.Close()
+		Ω(err).ShouldNot(HaveOccurred())
+
+		open()
+	}
+
+	// withRaw closes the store, for the database to be changed behind its
+	// back, and opens it again
+	withRaw := func(change func(tx *bolt.Tx) error) {
+		err := store.Close()
+		Ω(err).ShouldNot(HaveOccurred())
+
+		db, err := bolt.Open(dbPath, 0600, nil)
+		Ω(err).ShouldNot(HaveOccurred())
+
+		err = db.Update(change)
+		Ω(err).ShouldNot(HaveOccurred())
+
+		err = db.Close()
+		Ω(err).ShouldNot(HaveOccurred())
+
+		open()
+	}
+
+	BeforeEach(func() {
+		var err error
+
+		tmpdir, err = ioutil.TempDir(os.TempDir(), "bolt-store-test")
+		Ω(err).ShouldNot(HaveOccurred())
+
+		dbPath = path.Join(tmpdir, "snapshots.db")
+
+		logger = lagertest.NewTestLogger("test")
+
+		open()
+	})
+
+	AfterEach(func() {
+		store.Close()
+		os.RemoveAll(tmpdir)
+	})
+
+	It("loads no snapshots from a new database", func() {
+		snapshots, err := store.Load(logger)
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(snapshots).Should(BeEmpty())
+	})
+
+	Describe("saving", func() {
+		It("loads the snapshots by container ID, after reopening", func() {
+			err := store.Save("some-id", []byte("some-snapshot"))
+			Ω(err).ShouldNot(HaveOccurred())
+
+			err = store.Save("some-other-id", []byte("some-other-snapshot"))
+			Ω(err).ShouldNot(HaveOccurred())
+
+			reopen()
+
+			snapshots, err := store.Load(logger)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(snapshots).Should(Equal(map[string][]byte{
+				"some-id":       []byte("some-snapshot"),
+				"some-other-id": []byte("some-other-snapshot"),
+			}))
+		})
+
+		It("replaces an earlier snapshot of the same container", func() {
+			err := store.Save("some-id", []byte("some-snapshot"))
+			Ω(err).ShouldNot(HaveOccurred())
+
+			err = store.Save("some-id", []byte("some-newer-snapshot"))
+			Ω(err).ShouldNot(HaveOccurred())
+
+			snapshots, err := store.Load(logger)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(snapshots).Should(Equal(map[string][]byte{
+				"some-id": []byte("some-newer-snapshot"),
+			}))
+		})
+	})
+
+	Describe("clearing", func() {
+		BeforeEach(func() {
+			err := store.Save("some-id", []byte("some-snapshot"))
+			Ω(err).ShouldNot(HaveOccurred())
+
+			err = store.SaveBootID("some-boot-id")
+			Ω(err).ShouldNot(HaveOccurred())
+
+			err = store.SaveReservedPorts([]uint32{61001})
+			Ω(err).ShouldNot(HaveOccurred())
+
+			err = store.Clear()
+			Ω(err).ShouldNot(HaveOccurred())
+		})
+
+		It("removes saved snapshots", func() {
+			snapshots, err := store.Load(logger)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(snapshots).Should(BeEmpty())
+		})
+
+		It("keeps the boot ID and reserved ports", func() {
+			Ω(store.LoadBootID()).Should(Equal("some-boot-id"))
+			Ω(store.LoadReservedPorts()).Should(Equal([]uint32{61001}))
+		})
+	})
+
+	Describe("the boot ID and reserved ports", func() {
+		It("are empty when none were saved", func() {
+			Ω(store.LoadBootID()).Should(BeEmpty())
+			Ω(store.LoadReservedPorts()).Should(BeEmpty())
+		})
+
+		It("are loaded as saved, and not as snapshots", func() {
+			err := store.SaveBootID("some-boot-id")
+			Ω(err).ShouldNot(HaveOccurred())
+
+			err = store.SaveReservedPorts([]uint32{61001, 61002})
+			Ω(err).ShouldNot(HaveOccurred())
+
+			reopen()
+
+			Ω(store.LoadBootID()).Should(Equal("some-boot-id"))
+			Ω(store.LoadReservedPorts()).Should(Equal([]uint32{61001, 61002}))
+
+			snapshots, err := store.Load(logger)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(snapshots).Should(BeEmpty())
+		})
+
+		Context("when the boot ID is not as saved", func() {
+			It("returns an error", func() {
+				withRaw(func(tx *bolt.Tx) error {
+					return tx.Bucket([]byte("state")).Put([]byte("boot-id"), []byte("\x00\x00\x00\x00some-boot-id"))
+				})
+
+				_, err := store.LoadBootID()
+				Ω(err).Should(Equal(snapshot_store.ErrChecksumMismatch))
+			})
+		})
+	})
+
+	Describe("corruption", func() {
+		BeforeEach(func() {
+			err := store.Save("some-id", []byte("some-snapshot"))
+			Ω(err).ShouldNot(HaveOccurred())
+
+			err = store.Save("some-other-id", []byte("some-other-snapshot"))
+			Ω(err).ShouldNot(HaveOccurred())
+		})
+
+		Context("when a snapshot's checksum does not match", func() {
+			BeforeEach(func() {
+				withRaw(func(tx *bolt.Tx) error {
+					bucket := tx.Bucket([]byte("snapshots"))
+
+					value := append([]byte{}, bucket.Get([]byte("some-id"))...)
+					value[len(value)-1] ^= 0xff
+
+					return bucket.Put([]byte("some-id"), value)
+				})
+			})
+
+			It("moves it aside rather than loading it", func() {
+				snapshots, err := store.Load(logger)
+				Ω(err).ShouldNot(HaveOccurred())
+				Ω(snapshots).Should(Equal(map[string][]byte{
+					"some-other-id": []byte("some-other-snapshot"),
+				}))
+
+				reopen()
+
+				snapshots, err = store.Load(logger)
+				Ω(err).ShouldNot(HaveOccurred())
+				Ω(snapshots).Should(HaveLen(1))
+
+				var corrupt []string
+
+				withRaw(func(tx *bolt.Tx) error {
+					return tx.Bucket([]byte("corrupt")).ForEach(func(key []byte, value []byte) error {
+						corrupt = append(corrupt, string(key))
+						return nil
+					})
+				})
+
+				Ω(corrupt).Should(HaveLen(1))
+				Ω(corrupt[0]).Should(HavePrefix("some-id."))
+			})
+		})
+
+		Context("with a validator", func() {
+			It("moves invalid snapshots aside rather than loading them", func() {
+				store.Validate = func(snapshot []byte) error {
+					if string(snapshot) == "some-snapshot" {
+						return errors.New("invalid")
+					}
+
+					return nil
+				}
+
+				snapshots, err := store.Load(logger)
+				Ω(err).ShouldNot(HaveOccurred())
+				Ω(snapshots).Should(Equal(map[string][]byte{
+					"some-other-id": []byte("some-other-snapshot"),
+				}))
+
+				store.Validate = nil
+
+				snapshots, err = store.Load(logger)
+				Ω(err).ShouldNot(HaveOccurred())
+				Ω(snapshots).Should(HaveLen(1))
+			})
+		})
+
+		Context("when the database file is not a database", func() {
+			BeforeEach(func() {
+				err := store.Close()
+				Ω(err).ShouldNot(HaveOccurred())
+
+				err = ioutil.WriteFile(dbPath, []byte(strings.Repeat("garbage", 4096)), 0600)
+				Ω(err).ShouldNot(HaveOccurred())
+
+				open()
+			})
+
+			It("moves it aside and starts a new one", func() {
+				snapshots, err := store.Load(logger)
+				Ω(err).ShouldNot(HaveOccurred())
+				Ω(snapshots).Should(BeEmpty())
+
+				moved, err := filepath.Glob(dbPath + ".corrupt.*")
+				Ω(err).ShouldNot(HaveOccurred())
+				Ω(moved).Should(HaveLen(1))
+
+				contents, err := ioutil.ReadFile(moved[0])
+				Ω(err).ShouldNot(HaveOccurred())
+				Ω(string(contents)).Should(HavePrefix("garbage"))
+
+				err = store.Save("some-id", []byte("some-snapshot"))
+				Ω(err).ShouldNot(HaveOccurred())
+			})
+		})
+	})
+
+	Context("when another process has the database open", func() {
+		It("fails rather than moving it aside", func() {
+			_, err := snapshot_store.OpenBoltStore(logger, dbPath)
+			Ω(err).Should(Equal(bolt.ErrTimeout))
+
+			moved, err := filepath.Glob(dbPath + ".corrupt.*")
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(moved).Should(BeEmpty())
+		})
+	})
+
+	Describe("compaction", func() {
+		It("shrinks the database to what it holds when opened", func() {
+			snapshot := []byte(strings.Repeat("x", 64*1024))
+
+			for i := 0; i < 100; i++ {
+				err := store.Save(fmt.Sprintf("id-%d", i), snapshot)
+				Ω(err).ShouldNot(HaveOccurred())
+			}
+
+			err := store.Clear()
+			Ω(err).ShouldNot(HaveOccurred())
+
+			err = store.Save("some-id", []byte("some-snapshot"))
+			Ω(err).ShouldNot(HaveOccurred())
+
+			grown, err := os.Stat(dbPath)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			reopen()
+
+			compacted, err := os.Stat(dbPath)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(compacted.Size()).Should(BeNumerically("<", grown.Size()/4))
+
+			snapshots, err := store.Load(logger)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(snapshots).Should(Equal(map[string][]byte{
+				"some-id": []byte("some-snapshot"),
+			}))
+		})
+	})
+})
@@ -0,0 +1,115 @@
+package fake_snapshot_store
+
+import (
+	"sync"
+
+	"github.com/pivotal-golang/lager"
+)
+
+// FakeSnapshotStore keeps snapshots in memory, so that they survive a
+// backend being stopped and another started on the same store.
+type FakeSnapshotStore struct {
+	Snapshots     map[string][]byte
+	BootID        string
+	ReservedPorts []uint32
+
+	LoadError  error
+	SaveError  error
+	ClearError error
+
+	LoadBootIDError error
+	SaveBootIDError error
+
+	LoadReservedPortsError error
+	SaveReservedPortsError error
+
+	mutex sync.Mutex
+}
+
+func New() *FakeSnapshotStore {
+	return &FakeSnapshotStore{
+		Snapshots: map[string][]byte{},
+	}
+}
+
+func (s *FakeSnapshotStore) Load(lager.Logger) (map[string][]byte, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.LoadError != nil {
+		return nil, s.LoadError
+	}
+
+	snapshots := map[string][]byte{}
+	for id, snapshot := range s.Snapshots {
+		snapshots[id] = snapshot
+	}
+
+	return snapshots, nil
+}
+
+func (s *FakeSnapshotStore) Save(id string, snapshot []byte) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.SaveError != nil {
+		return s.SaveError
+	}
+
+	s.Snapshots[id] = snapshot
+
+	return nil
+}
+
+func (s *FakeSnapshotStore) Clear() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.ClearError != nil {
+		return s.ClearError
+	}
+
+	s.Snapshots = map[string][]byte{}
+
+	return nil
+}
+
+func (s *FakeSnapshotStore) LoadBootID() (string, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.BootID, s.LoadBootIDError
+}
+
+func (s *FakeSnapshotStore) SaveBootID(bootID string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.SaveBootIDError != nil {
+		return s.SaveBootIDError
+	}
+
+	s.BootID = bootID
+
+	return nil
+}
+
+func (s *FakeSnapshotStore) LoadReservedPorts() ([]uint32, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.ReservedPorts, s.LoadReservedPortsError
+}
+
+func (s *FakeSnapshotStore) SaveReservedPorts(ports []uint32) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.SaveReservedPortsError != nil {
+		return s.SaveReservedPortsError
+	}
+
+	s.ReservedPorts = ports
+
+	return nil
+}
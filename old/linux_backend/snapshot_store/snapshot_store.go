@@ -0,0 +1,212 @@
+package snapshot_store
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/pivotal-golang/lager"
+)
+
+// FileStore keeps each container's snapshot in a file named after its ID,
+// in a flat directory that Clear removes.
+//
+// The host's boot ID and the reserved ports, which must outlive Clear, are
+// kept in .boot-id and .reserved-ports in a state directory alongside it,
+// named after it with a .state suffix. Servers before kept them in the
+// snapshots directory, as backups of it still do, so they are loaded from
+// there if not found alongside.
+//
+// Snapshots that cannot be read, or that Validate rejects, are moved to the
+// state directory's corrupt directory rather than being cleared, so that
+// they can be looked into.
+type FileStore struct {
+	path      string
+	statePath string
+
+	// whether a snapshot can be restored; every snapshot is if nil
+	Validate func(snapshot []byte) error
+}
+
+func NewFileStore(path string) *FileStore {
+	return &FileStore{
+		path:      path,
+		statePath: path + ".state",
+	}
+}
+
+// Load returns the snapshots by container ID. Snapshots that cannot be read
+// or are invalid are logged, moved aside and left out.
+func (s *FileStore) Load(logger lager.Logger) (map[string][]byte, error) {
+	snapshots := map[string][]byte{}
+
+	entries, err := ioutil.ReadDir(s.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return snapshots, nil
+		}
+
+		return nil, err
+	}
+
+	for _, entry := range entries {
+		// still being saved when the server went down
+		if strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+
+		contents, err := ioutil.ReadFile(path.Join(s.path, entry.Name()))
+		if err != nil {
+			logger.Error("failed-to-read-snapshot", err, lager.Data{
+				"snapshot": entry.Name(),
+			})
+
+			s.moveAside(logger, entry.Name())
+
+			continue
+		}
+
+		if s.Validate != nil {
+			err := s.Validate(contents)
+			if err != nil {
+				logger.Error("invalid-snapshot", err, lager.Data{
+					"snapshot": entry.Name(),
+				})
+
+				s.moveAside(logger, entry.Name())
+
+				continue
+			}
+		}
+
+		snapshots[entry.Name()] = contents
+	}
+
+	return snapshots, nil
+}
+
+// moveAside moves a snapshot that cannot be loaded to the corrupt
+// directory, named after when it was moved so that earlier ones are kept.
+func (s *FileStore) moveAside(logger lager.Logger, name string) {
+	corruptPath := path.Join(s.statePath, "corrupt")
+
+	err := os.MkdirAll(corruptPath, 0755)
+	if err != nil {
+		logger.Error("failed-to-move-aside", err, lager.Data{"snapshot": name})
+		return
+	}
+
+	movedPath := path.Join(corruptPath, name+"."+time.Now().UTC().Format("20060102T150405.000000000"))
+
+	err = os.Rename(path.Join(s.path, name), movedPath)
+	if err != nil {
+		logger.Error("failed-to-move-aside", err, lager.Data{"snapshot": name})
+		return
+	}
+
+	logger.Info("moved-aside", lager.Data{
+		"snapshot": name,
+		"path":     movedPath,
+	})
+}
+
+// Save writes the snapshot alongside its final path and then renames it
+// into place, so that a snapshot is never left half-written.
+func (s *FileStore) Save(id string, snapshot []byte) error {
+	return save(s.path, id, snapshot)
+}
+
+func save(dir string, name string, contents []byte) error {
+	tmpPath := path.Join(dir, "."+name)
+
+	err := ioutil.WriteFile(tmpPath, contents, 0644)
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(tmpPath, path.Join(dir, name))
+}
+
+// loadState reads a state file, from the snapshots directory if it has not
+// been saved to the state directory.
+func (s *FileStore) loadState(name string) ([]byte, error) {
+	contents, err := ioutil.ReadFile(path.Join(s.statePath, name))
+	if os.IsNotExist(err) {
+		return ioutil.ReadFile(path.Join(s.path, name))
+	}
+
+	return contents, err
+}
+
+func (s *FileStore) saveState(name string, contents []byte) error {
+	err := os.MkdirAll(s.statePath, 0755)
+	if err != nil {
+		return err
+	}
+
+	return save(s.statePath, name, contents)
+}
+
+// LoadBootID returns the boot ID saved with the snapshots, or "" if none
+// was.
+func (s *FileStore) LoadBootID() (string, error) {
+	contents, err := s.loadState(".boot-id")
+	if err != nil {
+		if os.IsNotExist(err) {
+			return "", nil
+		}
+
+		return "", err
+	}
+
+	return string(contents), nil
+}
+
+func (s *FileStore) SaveBootID(bootID string) error {
+	return s.saveState(".boot-id", []byte(bootID))
+}
+
+// LoadReservedPorts returns the host ports saved as reserved, or none if
+// none were.
+func (s *FileStore) LoadReservedPorts() ([]uint32, error) {
+	contents, err := s.loadState(".reserved-ports")
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+
+		return nil, err
+	}
+
+	var ports []uint32
+
+	err = json.Unmarshal(contents, &ports)
+	if err != nil {
+		return nil, err
+	}
+
+	return ports, nil
+}
+
+func (s *FileStore) SaveReservedPorts(ports []uint32) error {
+	contents, err := json.Marshal(ports)
+	if err != nil {
+		return err
+	}
+
+	return s.saveState(".reserved-ports", contents)
+}
+
+// Clear removes every snapshot, leaving the directory ready for new ones.
+// The state directory is left as it is.
+func (s *FileStore) Clear() error {
+	err := os.RemoveAll(s.path)
+	if err != nil {
+		return err
+	}
+
+	return os.MkdirAll(s.path, 0755)
+}
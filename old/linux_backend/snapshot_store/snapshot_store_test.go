@@ -0,0 +1,315 @@
+package snapshot_store_test
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/pivotal-golang/lager/lagertest"
+
+	"github.com/cloudfoundry-incubator/garden-linux/old/linux_backend/snapshot_store"
+)
+
+var _ = Describe("FileStore", func() {
+	var tmpdir string
+	var snapshotsPath string
+
+	var store *snapshot_store.FileStore
+	var logger *lagertest.TestLogger
+
+	BeforeEach(func() {
+		var err error
+
+		tmpdir, err = ioutil.TempDir(os.TempDir(), "snapshot-store-test")
+		Ω(err).ShouldNot(HaveOccurred())
+
+		snapshotsPath = path.Join(tmpdir, "snapshots")
+
+		store = snapshot_store.NewFileStore(snapshotsPath)
+		logger = lagertest.NewTestLogger("test")
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(tmpdir)
+	})
+
+	Context("when the snapshots directory does not exist", func() {
+		It("loads no snapshots", func() {
+			snapshots, err := store.Load(logger)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(snapshots).Should(BeEmpty())
+		})
+	})
+
+	Describe("clearing", func() {
+		It("creates the snapshots directory", func() {
+			err := store.Clear()
+			Ω(err).ShouldNot(HaveOccurred())
+
+			info, err := os.Stat(snapshotsPath)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(info.IsDir()).Should(BeTrue())
+		})
+
+		It("removes saved snapshots", func() {
+			err := store.Clear()
+			Ω(err).ShouldNot(HaveOccurred())
+
+			err = store.Save("some-id", []byte("some-snapshot"))
+			Ω(err).ShouldNot(HaveOccurred())
+
+			err = store.Clear()
+			Ω(err).ShouldNot(HaveOccurred())
+
+			snapshots, err := store.Load(logger)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(snapshots).Should(BeEmpty())
+		})
+
+		Context("when the directory cannot be created", func() {
+			It("returns an error", func() {
+				err := ioutil.WriteFile(path.Join(tmpdir, "file"), []byte{}, 0644)
+				Ω(err).ShouldNot(HaveOccurred())
+
+				store = snapshot_store.NewFileStore(path.Join(tmpdir, "file", "snapshots"))
+
+				err = store.Clear()
+				Ω(err).Should(HaveOccurred())
+			})
+		})
+	})
+
+	Describe("saving", func() {
+		BeforeEach(func() {
+			err := store.Clear()
+			Ω(err).ShouldNot(HaveOccurred())
+		})
+
+		It("writes a file per container, named after its ID", func() {
+			err := store.Save("some-id", []byte("some-snapshot"))
+			Ω(err).ShouldNot(HaveOccurred())
+
+			contents, err := ioutil.ReadFile(path.Join(snapshotsPath, "some-id"))
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(string(contents)).Should(Equal("some-snapshot"))
+		})
+
+		It("loads the snapshots by container ID", func() {
+			err := store.Save("some-id", []byte("some-snapshot"))
+			Ω(err).ShouldNot(HaveOccurred())
+
+			err = store.Save("some-other-id", []byte("some-other-snapshot"))
+			Ω(err).ShouldNot(HaveOccurred())
+
+			snapshots, err := store.Load(logger)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(snapshots).Should(Equal(map[string][]byte{
+				"some-id":       []byte("some-snapshot"),
+				"some-other-id": []byte("some-other-snapshot"),
+			}))
+		})
+
+		It("replaces an earlier snapshot of the same container", func() {
+			err := store.Save("some-id", []byte("old-snapshot"))
+			Ω(err).ShouldNot(HaveOccurred())
+
+			err = store.Save("some-id", []byte("new-snapshot"))
+			Ω(err).ShouldNot(HaveOccurred())
+
+			snapshots, err := store.Load(logger)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(snapshots).Should(Equal(map[string][]byte{
+				"some-id": []byte("new-snapshot"),
+			}))
+		})
+
+		It("does not load snapshots that were still being saved", func() {
+			err := ioutil.WriteFile(path.Join(snapshotsPath, ".some-id"), []byte("half-a-snap"), 0644)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			snapshots, err := store.Load(logger)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(snapshots).Should(BeEmpty())
+		})
+
+		Context("with a validator", func() {
+			BeforeEach(func() {
+				store.Validate = func(snapshot []byte) error {
+					if string(snapshot) == "corrupt" {
+						return errors.New("corrupt snapshot")
+					}
+
+					return nil
+				}
+			})
+
+			It("moves invalid snapshots aside rather than loading them", func() {
+				err := store.Save("some-id", []byte("some-snapshot"))
+				Ω(err).ShouldNot(HaveOccurred())
+
+				err = store.Save("some-corrupt-id", []byte("corrupt"))
+				Ω(err).ShouldNot(HaveOccurred())
+
+				snapshots, err := store.Load(logger)
+				Ω(err).ShouldNot(HaveOccurred())
+
+				Ω(snapshots).Should(Equal(map[string][]byte{
+					"some-id": []byte("some-snapshot"),
+				}))
+
+				_, err = os.Stat(path.Join(snapshotsPath, "some-corrupt-id"))
+				Ω(os.IsNotExist(err)).Should(BeTrue())
+
+				corrupt, err := ioutil.ReadDir(path.Join(snapshotsPath+".state", "corrupt"))
+				Ω(err).ShouldNot(HaveOccurred())
+				Ω(corrupt).Should(HaveLen(1))
+				Ω(corrupt[0].Name()).Should(HavePrefix("some-corrupt-id."))
+
+				contents, err := ioutil.ReadFile(path.Join(snapshotsPath+".state", "corrupt", corrupt[0].Name()))
+				Ω(err).ShouldNot(HaveOccurred())
+				Ω(string(contents)).Should(Equal("corrupt"))
+			})
+
+			It("keeps them through clearing", func() {
+				err := store.Save("some-corrupt-id", []byte("corrupt"))
+				Ω(err).ShouldNot(HaveOccurred())
+
+				_, err = store.Load(logger)
+				Ω(err).ShouldNot(HaveOccurred())
+
+				err = store.Clear()
+				Ω(err).ShouldNot(HaveOccurred())
+
+				corrupt, err := ioutil.ReadDir(path.Join(snapshotsPath+".state", "corrupt"))
+				Ω(err).ShouldNot(HaveOccurred())
+				Ω(corrupt).Should(HaveLen(1))
+			})
+		})
+
+		Context("when the snapshots directory is gone", func() {
+			It("returns an error", func() {
+				err := os.RemoveAll(snapshotsPath)
+				Ω(err).ShouldNot(HaveOccurred())
+
+				err = store.Save("some-id", []byte("some-snapshot"))
+				Ω(err).Should(HaveOccurred())
+			})
+		})
+	})
+
+	Describe("the boot ID", func() {
+		BeforeEach(func() {
+			err := store.Clear()
+			Ω(err).ShouldNot(HaveOccurred())
+		})
+
+		It("is empty when none was saved", func() {
+			Ω(store.LoadBootID()).Should(BeEmpty())
+		})
+
+		It("loads the boot ID that was saved", func() {
+			err := store.SaveBootID("some-boot-id")
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(store.LoadBootID()).Should(Equal("some-boot-id"))
+		})
+
+		It("is not loaded as a snapshot", func() {
+			err := store.SaveBootID("some-boot-id")
+			Ω(err).ShouldNot(HaveOccurred())
+
+			snapshots, err := store.Load(logger)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(snapshots).Should(BeEmpty())
+		})
+
+		It("outlives clearing", func() {
+			err := store.SaveBootID("some-boot-id")
+			Ω(err).ShouldNot(HaveOccurred())
+
+			err = store.Clear()
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(store.LoadBootID()).Should(Equal("some-boot-id"))
+		})
+
+		It("is kept in the state directory, alongside the snapshots directory", func() {
+			err := store.SaveBootID("some-boot-id")
+			Ω(err).ShouldNot(HaveOccurred())
+
+			contents, err := ioutil.ReadFile(path.Join(snapshotsPath+".state", ".boot-id"))
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(string(contents)).Should(Equal("some-boot-id"))
+		})
+
+		Context("when it was saved in the snapshots directory", func() {
+			BeforeEach(func() {
+				err := ioutil.WriteFile(path.Join(snapshotsPath, ".boot-id"), []byte("some-older-boot-id"), 0644)
+				Ω(err).ShouldNot(HaveOccurred())
+			})
+
+			It("loads it from there", func() {
+				Ω(store.LoadBootID()).Should(Equal("some-older-boot-id"))
+			})
+
+			It("loads the one saved since instead", func() {
+				err := store.SaveBootID("some-boot-id")
+				Ω(err).ShouldNot(HaveOccurred())
+
+				Ω(store.LoadBootID()).Should(Equal("some-boot-id"))
+			})
+		})
+	})
+
+	Describe("the reserved ports", func() {
+		BeforeEach(func() {
+			err := store.Clear()
+			Ω(err).ShouldNot(HaveOccurred())
+		})
+
+		It("are empty when none were saved", func() {
+			Ω(store.LoadReservedPorts()).Should(BeEmpty())
+		})
+
+		It("loads the ports that were saved", func() {
+			err := store.SaveReservedPorts([]uint32{61001, 61005})
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(store.LoadReservedPorts()).Should(Equal([]uint32{61001, 61005}))
+		})
+
+		It("are not loaded as a snapshot", func() {
+			err := store.SaveReservedPorts([]uint32{61001})
+			Ω(err).ShouldNot(HaveOccurred())
+
+			snapshots, err := store.Load(logger)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(snapshots).Should(BeEmpty())
+		})
+
+		It("outlive clearing", func() {
+			err := store.SaveReservedPorts([]uint32{61001})
+			Ω(err).ShouldNot(HaveOccurred())
+
+			err = store.Clear()
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(store.LoadReservedPorts()).Should(Equal([]uint32{61001}))
+		})
+
+		Context("when the saved ports are corrupt", func() {
+			It("returns an error", func() {
+				err := ioutil.WriteFile(path.Join(snapshotsPath, ".reserved-ports"), []byte("{"), 0644)
+				Ω(err).ShouldNot(HaveOccurred())
+
+				_, err = store.LoadReservedPorts()
+				Ω(err).Should(HaveOccurred())
+			})
+		})
+	})
+})
@@ -0,0 +1,222 @@
+package snapshot_uploader
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+// S3 PUTs snapshots into, DELETEs them from, and lists, a bucket, given by
+// a path-style URL such as https://s3.amazonaws.com/bucket/prefix, signing
+// requests with AWS signature version 4.
+type S3 struct {
+	url             string
+	region          string
+	accessKeyID     string
+	secretAccessKey string
+	client          *http.Client
+
+	now func() time.Time
+}
+
+func NewS3(url string, region string, accessKeyID string, secretAccessKey string, client *http.Client) *S3 {
+	return &S3{
+		url:             url,
+		region:          region,
+		accessKeyID:     accessKeyID,
+		secretAccessKey: secretAccessKey,
+		client:          client,
+
+		now: time.Now,
+	}
+}
+
+func (s *S3) Upload(name string, contents []byte) error {
+	request, err := http.NewRequest("PUT", objectURL(s.url, name), bytes.NewReader(contents))
+	if err != nil {
+		return err
+	}
+
+	request.Header.Set("Content-Type", "application/octet-stream")
+
+	s.sign(request, contents)
+
+	return do(s.client, request)
+}
+
+func (s *S3) Delete(name string) error {
+	request, err := http.NewRequest("DELETE", objectURL(s.url, name), nil)
+	if err != nil {
+		return err
+	}
+
+	s.sign(request, nil)
+
+	return do(s.client, request)
+}
+
+// List returns the names of the snapshots under the URL's prefix, page by
+// page.
+func (s *S3) List() ([]string, error) {
+	bucketURL, err := url.Parse(s.url)
+	if err != nil {
+		return nil, err
+	}
+
+	segments := strings.SplitN(strings.Trim(bucketURL.Path, "/"), "/", 2)
+
+	prefix := ""
+	if len(segments) == 2 {
+		prefix = segments[1] + "/"
+	}
+
+	bucketURL.Path = "/" + segments[0]
+
+	names := []string{}
+	token := ""
+
+	for {
+		query := url.Values{
+			"list-type": {"2"},
+			"prefix":    {prefix},
+			"delimiter": {"/"},
+		}
+
+		if token != "" {
+			query.Set("continuation-token", token)
+		}
+
+		// signed as it is sent, so it must be in canonical form: sorted,
+		// which Encode does, and with spaces as %20
+		bucketURL.RawQuery = strings.Replace(query.Encode(), "+", "%20", -1)
+
+		request, err := http.NewRequest("GET", bucketURL.String(), nil)
+		if err != nil {
+			return nil, err
+		}
+
+		s.sign(request, nil)
+
+		response, err := send(s.client, request)
+		if err != nil {
+			return nil, err
+		}
+
+		var result struct {
+			Contents []struct {
+				Key string
+			}
+
+			IsTruncated           bool
+			NextContinuationToken string
+		}
+
+		err = xml.NewDecoder(response.Body).Decode(&result)
+
+		response.Body.Close()
+
+		if err != nil {
+			return nil, err
+		}
+
+		for _, object := range result.Contents {
+			names = append(names, strings.TrimPrefix(object.Key, prefix))
+		}
+
+		if !result.IsTruncated || result.NextContinuationToken == "" {
+			return names, nil
+		}
+
+		token = result.NextContinuationToken
+	}
+}
+
+// sign adds the headers of a signature version 4 request signed for the
+// whole payload.
+func (s *S3) sign(request *http.Request, payload []byte) {
+	now := s.now().UTC()
+	timestamp := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+
+	payloadHash := sha256.Sum256(payload)
+
+	request.Header.Set("Host", request.URL.Host)
+	request.Header.Set("X-Amz-Date", timestamp)
+	request.Header.Set("X-Amz-Content-Sha256", hex.EncodeToString(payloadHash[:]))
+
+	signedHeaders, canonicalHeaders := canonicalHeaders(request.Header)
+
+	path := request.URL.Path
+	if path == "" {
+		path = "/"
+	}
+
+	canonicalRequest := strings.Join([]string{
+		request.Method,
+		path,
+		request.URL.RawQuery,
+		canonicalHeaders,
+		signedHeaders,
+		hex.EncodeToString(payloadHash[:]),
+	}, "\n")
+
+	scope := date + "/" + s.region + "/s3/aws4_request"
+
+	canonicalRequestHash := sha256.Sum256([]byte(canonicalRequest))
+
+	stringToSign := strings.Join([]string{
+		"AWS4-HMAC-SHA256",
+		timestamp,
+		scope,
+		hex.EncodeToString(canonicalRequestHash[:]),
+	}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+s.secretAccessKey), date)
+	key = hmacSHA256(key, s.region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	request.Header.Set(
+		"Authorization",
+		"AWS4-HMAC-SHA256 Credential="+s.accessKeyID+"/"+scope+
+			", SignedHeaders="+signedHeaders+
+			", Signature="+signature,
+	)
+}
+
+// canonicalHeaders returns the signed header names, and the headers as they
+// are signed: lowercased, sorted, and trimmed.
+func canonicalHeaders(header http.Header) (string, string) {
+	names := []string{}
+	values := map[string]string{}
+
+	for name, value := range header {
+		lower := strings.ToLower(name)
+		names = append(names, lower)
+		values[lower] = strings.TrimSpace(strings.Join(value, ","))
+	}
+
+	sort.Strings(names)
+
+	canonical := ""
+	for _, name := range names {
+		canonical += name + ":" + values[name] + "\n"
+	}
+
+	return strings.Join(names, ";"), canonical
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
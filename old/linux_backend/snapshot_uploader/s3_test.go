@@ -0,0 +1,166 @@
+package snapshot_uploader_test
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/cloudfoundry-incubator/garden-linux/old/linux_backend/snapshot_uploader"
+)
+
+var _ = Describe("S3", func() {
+	var server *httptest.Server
+	var status int
+	var respond func(*http.Request) string
+	var received []receivedRequest
+
+	var uploader *snapshot_uploader.S3
+
+	BeforeEach(func() {
+		status = http.StatusOK
+		respond = nil
+		received = nil
+
+		server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			body, err := ioutil.ReadAll(r.Body)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			received = append(received, receivedRequest{
+				Method: r.Method,
+				Path:   r.URL.Path,
+				Query:  r.URL.Query(),
+				Header: r.Header,
+				Body:   body,
+			})
+
+			w.WriteHeader(status)
+
+			if respond != nil {
+				w.Write([]byte(respond(r)))
+			}
+		}))
+
+		uploader = snapshot_uploader.NewS3(server.URL+"/some-bucket/some-prefix", "eu-west-1", "some-key-id", "some-secret", http.DefaultClient)
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	Describe("Upload", func() {
+		It("PUTs the contents into the bucket, signed for the region", func() {
+			err := uploader.Upload("some-id", []byte("some-snapshot"))
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(received).Should(HaveLen(1))
+			Ω(received[0].Method).Should(Equal("PUT"))
+			Ω(received[0].Path).Should(Equal("/some-bucket/some-prefix/some-id"))
+			Ω(received[0].Body).Should(Equal([]byte("some-snapshot")))
+
+			payloadHash := sha256.Sum256([]byte("some-snapshot"))
+			Ω(received[0].Header.Get("X-Amz-Content-Sha256")).Should(Equal(hex.EncodeToString(payloadHash[:])))
+
+			date := time.Now().UTC().Format("20060102")
+			Ω(received[0].Header.Get("X-Amz-Date")).Should(HavePrefix(date))
+
+			authorization := received[0].Header.Get("Authorization")
+			Ω(authorization).Should(HavePrefix("AWS4-HMAC-SHA256 Credential=some-key-id/" + date + "/eu-west-1/s3/aws4_request, "))
+			Ω(authorization).Should(ContainSubstring("SignedHeaders=content-type;host;x-amz-content-sha256;x-amz-date, "))
+			Ω(authorization).Should(MatchRegexp("Signature=[0-9a-f]{64}$"))
+		})
+
+		Context("when the server responds with an error", func() {
+			BeforeEach(func() {
+				status = http.StatusForbidden
+			})
+
+			It("returns an UnexpectedStatusError", func() {
+				err := uploader.Upload("some-id", []byte("some-snapshot"))
+				Ω(err).Should(Equal(snapshot_uploader.UnexpectedStatusError{
+					Method:     "PUT",
+					URL:        server.URL + "/some-bucket/some-prefix/some-id",
+					StatusCode: http.StatusForbidden,
+				}))
+			})
+		})
+	})
+
+	Describe("Delete", func() {
+		It("DELETEs it from the bucket, signed for an empty payload", func() {
+			err := uploader.Delete("some-id")
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(received).Should(HaveLen(1))
+			Ω(received[0].Method).Should(Equal("DELETE"))
+			Ω(received[0].Path).Should(Equal("/some-bucket/some-prefix/some-id"))
+			Ω(received[0].Header.Get("X-Amz-Content-Sha256")).Should(Equal("e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"))
+		})
+
+		Context("when it is already gone", func() {
+			BeforeEach(func() {
+				status = http.StatusNotFound
+			})
+
+			It("succeeds", func() {
+				err := uploader.Delete("some-id")
+				Ω(err).ShouldNot(HaveOccurred())
+			})
+		})
+	})
+
+	Describe("List", func() {
+		BeforeEach(func() {
+			respond = func(r *http.Request) string {
+				if r.URL.Query().Get("continuation-token") == "" {
+					return `<?xml version="1.0" encoding="UTF-8"?>
+<ListBucketResult xmlns="http://s3.amazonaws.com/doc/2006-03-01/">
+  <Contents><Key>some-prefix/some-id</Key></Contents>
+  <IsTruncated>true</IsTruncated>
+  <NextContinuationToken>some/token+</NextContinuationToken>
+</ListBucketResult>`
+				}
+
+				return `<?xml version="1.0" encoding="UTF-8"?>
+<ListBucketResult xmlns="http://s3.amazonaws.com/doc/2006-03-01/">
+  <Contents><Key>some-prefix/.boot-id</Key></Contents>
+  <IsTruncated>false</IsTruncated>
+</ListBucketResult>`
+			}
+		})
+
+		It("lists the objects under the prefix, page by page", func() {
+			names, err := uploader.List()
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(names).Should(Equal([]string{"some-id", ".boot-id"}))
+
+			Ω(received).Should(HaveLen(2))
+
+			Ω(received[0].Method).Should(Equal("GET"))
+			Ω(received[0].Path).Should(Equal("/some-bucket"))
+			Ω(received[0].Query.Get("list-type")).Should(Equal("2"))
+			Ω(received[0].Query.Get("prefix")).Should(Equal("some-prefix/"))
+			Ω(received[0].Query.Get("delimiter")).Should(Equal("/"))
+
+			Ω(received[1].Query.Get("continuation-token")).Should(Equal("some/token+"))
+			Ω(received[1].Header.Get("Authorization")).Should(HavePrefix("AWS4-HMAC-SHA256 Credential=some-key-id/"))
+		})
+
+		Context("when the server responds with an error", func() {
+			BeforeEach(func() {
+				status = http.StatusForbidden
+			})
+
+			It("returns an UnexpectedStatusError", func() {
+				_, err := uploader.List()
+				Ω(err).Should(BeAssignableToTypeOf(snapshot_uploader.UnexpectedStatusError{}))
+			})
+		})
+	})
+})
@@ -0,0 +1,61 @@
+package snapshot_uploader
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+type UnexpectedStatusError struct {
+	Method     string
+	URL        string
+	StatusCode int
+}
+
+func (e UnexpectedStatusError) Error() string {
+	return fmt.Sprintf("%s %s responded with status %d", e.Method, e.URL, e.StatusCode)
+}
+
+// objectURL joins the base URL and the name; names are container IDs and
+// the dotfiles the file store keeps, so need no escaping.
+func objectURL(base string, name string) string {
+	return strings.TrimRight(base, "/") + "/" + name
+}
+
+// do makes the request, treating 2xx statuses, and 404 if deleting, as
+// success.
+func do(client *http.Client, request *http.Request) error {
+	response, err := send(client, request)
+	if err != nil {
+		return err
+	}
+
+	response.Body.Close()
+
+	return nil
+}
+
+// send makes the request, returning the response, whose body must be
+// closed, for 2xx statuses, and 404 if deleting.
+func send(client *http.Client, request *http.Request) (*http.Response, error) {
+	response, err := client.Do(request)
+	if err != nil {
+		return nil, err
+	}
+
+	if response.StatusCode/100 == 2 {
+		return response, nil
+	}
+
+	if request.Method == "DELETE" && response.StatusCode == http.StatusNotFound {
+		return response, nil
+	}
+
+	response.Body.Close()
+
+	return nil, UnexpectedStatusError{
+		Method:     request.Method,
+		URL:        request.URL.String(),
+		StatusCode: response.StatusCode,
+	}
+}
@@ -0,0 +1,107 @@
+package snapshot_uploader
+
+import (
+	"bytes"
+	"encoding/xml"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+)
+
+// WebDAV PUTs snapshots into, DELETEs them from, and lists with PROPFIND, a
+// collection, which must already exist.
+type WebDAV struct {
+	url      string
+	username string
+	password string
+	client   *http.Client
+}
+
+// NewWebDAV uploads to the collection at the URL, authenticating with basic
+// auth if a username is given.
+func NewWebDAV(url string, username string, password string, client *http.Client) *WebDAV {
+	return &WebDAV{
+		url:      url,
+		username: username,
+		password: password,
+		client:   client,
+	}
+}
+
+func (w *WebDAV) Upload(name string, contents []byte) error {
+	request, err := http.NewRequest("PUT", objectURL(w.url, name), bytes.NewReader(contents))
+	if err != nil {
+		return err
+	}
+
+	request.Header.Set("Content-Type", "application/octet-stream")
+
+	return w.do(request)
+}
+
+func (w *WebDAV) Delete(name string) error {
+	request, err := http.NewRequest("DELETE", objectURL(w.url, name), nil)
+	if err != nil {
+		return err
+	}
+
+	return w.do(request)
+}
+
+// List returns the names of the snapshots in the collection.
+func (w *WebDAV) List() ([]string, error) {
+	request, err := http.NewRequest("PROPFIND", strings.TrimRight(w.url, "/")+"/", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	request.Header.Set("Depth", "1")
+
+	if w.username != "" {
+		request.SetBasicAuth(w.username, w.password)
+	}
+
+	response, err := send(w.client, request)
+	if err != nil {
+		return nil, err
+	}
+
+	defer response.Body.Close()
+
+	var multistatus struct {
+		Responses []struct {
+			Href string `xml:"href"`
+		} `xml:"response"`
+	}
+
+	err = xml.NewDecoder(response.Body).Decode(&multistatus)
+	if err != nil {
+		return nil, err
+	}
+
+	names := []string{}
+	for _, r := range multistatus.Responses {
+		// the collection itself, and any collections in it
+		if strings.HasSuffix(r.Href, "/") {
+			continue
+		}
+
+		href, err := url.Parse(r.Href)
+		if err != nil {
+			return nil, err
+		}
+
+		names = append(names, path.Base(href.Path))
+	}
+
+	return names, nil
+}
+
+func (w *WebDAV) do(request *http.Request) error {
+	if w.username != "" {
+		request.SetBasicAuth(w.username, w.password)
+	}
+
+	return do(w.client, request)
+}
@@ -0,0 +1,185 @@
+package snapshot_uploader_test
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/cloudfoundry-incubator/garden-linux/old/linux_backend/snapshot_uploader"
+)
+
+type receivedRequest struct {
+	Method   string
+	Path     string
+	Query    url.Values
+	Header   http.Header
+	Body     []byte
+	Username string
+	Password string
+}
+
+var _ = Describe("WebDAV", func() {
+	var server *httptest.Server
+	var status int
+	var respond func(*http.Request) string
+	var received []receivedRequest
+
+	var uploader *snapshot_uploader.WebDAV
+
+	BeforeEach(func() {
+		status = http.StatusCreated
+		respond = nil
+		received = nil
+
+		server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			body, err := ioutil.ReadAll(r.Body)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			username, password, _ := r.BasicAuth()
+
+			received = append(received, receivedRequest{
+				Method:   r.Method,
+				Path:     r.URL.Path,
+				Query:    r.URL.Query(),
+				Header:   r.Header,
+				Body:     body,
+				Username: username,
+				Password: password,
+			})
+
+			w.WriteHeader(status)
+
+			if respond != nil {
+				w.Write([]byte(respond(r)))
+			}
+		}))
+
+		uploader = snapshot_uploader.NewWebDAV(server.URL+"/snapshots/", "some-user", "some-password", http.DefaultClient)
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	Describe("Upload", func() {
+		It("PUTs the contents into the collection, with basic auth", func() {
+			err := uploader.Upload("some-id", []byte("some-snapshot"))
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(received).Should(HaveLen(1))
+			Ω(received[0].Method).Should(Equal("PUT"))
+			Ω(received[0].Path).Should(Equal("/snapshots/some-id"))
+			Ω(received[0].Body).Should(Equal([]byte("some-snapshot")))
+			Ω(received[0].Username).Should(Equal("some-user"))
+			Ω(received[0].Password).Should(Equal("some-password"))
+		})
+
+		Context("without a username", func() {
+			BeforeEach(func() {
+				uploader = snapshot_uploader.NewWebDAV(server.URL+"/snapshots", "", "", http.DefaultClient)
+			})
+
+			It("does not authenticate", func() {
+				err := uploader.Upload(".boot-id", []byte("some-boot-id"))
+				Ω(err).ShouldNot(HaveOccurred())
+
+				Ω(received).Should(HaveLen(1))
+				Ω(received[0].Path).Should(Equal("/snapshots/.boot-id"))
+				Ω(received[0].Header.Get("Authorization")).Should(BeEmpty())
+			})
+		})
+
+		Context("when the server responds with an error", func() {
+			BeforeEach(func() {
+				status = http.StatusForbidden
+			})
+
+			It("returns an UnexpectedStatusError", func() {
+				err := uploader.Upload("some-id", []byte("some-snapshot"))
+				Ω(err).Should(Equal(snapshot_uploader.UnexpectedStatusError{
+					Method:     "PUT",
+					URL:        server.URL + "/snapshots/some-id",
+					StatusCode: http.StatusForbidden,
+				}))
+			})
+		})
+	})
+
+	Describe("Delete", func() {
+		It("DELETEs it from the collection", func() {
+			err := uploader.Delete("some-id")
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(received).Should(HaveLen(1))
+			Ω(received[0].Method).Should(Equal("DELETE"))
+			Ω(received[0].Path).Should(Equal("/snapshots/some-id"))
+		})
+
+		Context("when it is already gone", func() {
+			BeforeEach(func() {
+				status = http.StatusNotFound
+			})
+
+			It("succeeds", func() {
+				err := uploader.Delete("some-id")
+				Ω(err).ShouldNot(HaveOccurred())
+			})
+		})
+
+		Context("when the server responds with an error", func() {
+			BeforeEach(func() {
+				status = http.StatusInternalServerError
+			})
+
+			It("returns an UnexpectedStatusError", func() {
+				err := uploader.Delete("some-id")
+				Ω(err).Should(HaveOccurred())
+				Ω(err.(snapshot_uploader.UnexpectedStatusError).StatusCode).Should(Equal(http.StatusInternalServerError))
+			})
+		})
+	})
+
+	Describe("List", func() {
+		BeforeEach(func() {
+			status = http.StatusMultiStatus
+
+			respond = func(*http.Request) string {
+				return `<?xml version="1.0" encoding="utf-8"?>
+<D:multistatus xmlns:D="DAV:">
+  <D:response><D:href>/snapshots/</D:href></D:response>
+  <D:response><D:href>/snapshots/some-id</D:href></D:response>
+  <D:response><D:href>/snapshots/.boot-id</D:href></D:response>
+  <D:response><D:href>/snapshots/some-collection/</D:href></D:response>
+</D:multistatus>`
+			}
+		})
+
+		It("PROPFINDs the collection's members, with basic auth", func() {
+			names, err := uploader.List()
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(names).Should(Equal([]string{"some-id", ".boot-id"}))
+
+			Ω(received).Should(HaveLen(1))
+			Ω(received[0].Method).Should(Equal("PROPFIND"))
+			Ω(received[0].Path).Should(Equal("/snapshots/"))
+			Ω(received[0].Header.Get("Depth")).Should(Equal("1"))
+			Ω(received[0].Username).Should(Equal("some-user"))
+		})
+
+		Context("when the server responds with an error", func() {
+			BeforeEach(func() {
+				status = http.StatusForbidden
+			})
+
+			It("returns an UnexpectedStatusError", func() {
+				_, err := uploader.List()
+				Ω(err).Should(BeAssignableToTypeOf(snapshot_uploader.UnexpectedStatusError{}))
+			})
+		})
+	})
+})
@@ -166,12 +166,32 @@ int msg_dir_import(msg__dir_t *d, const char *dir) {
   return 0;
 }
 
+int msg_version_supported(int version) {
+  return version >= MSG_VERSION_MIN && version <= MSG_VERSION;
+}
+
+size_t msg_request_size(int version) {
+  if (version == 1) {
+    return offsetof(msg_request_t, ns_pid);
+  }
+
+  return sizeof(msg_request_t);
+}
+
+size_t msg_response_size(int version) {
+  if (version == 1) {
+    return offsetof(msg_response_t, pid);
+  }
+
+  return sizeof(msg_response_t);
+}
+
 void msg_request_init(msg_request_t *req) {
   memset(req, 0, sizeof(*req));
   req->version = MSG_VERSION;
 }
 
-void msg_response_init(msg_response_t *res) {
+void msg_response_init(msg_response_t *res, int version) {
   memset(res, 0, sizeof(*res));
-  res->version = MSG_VERSION;
+  res->version = version;
 }
@@ -1,8 +1,17 @@
 #ifndef MSG_H
 #define MSG_H 1
 
-#define MSG_VERSION 1
-
+/* Requests and responses lead with the version of their sender. wshd
+ * serves requests from MSG_VERSION_MIN on, so that a wsh from before an
+ * upgrade keeps working with a newer wshd, and answers each request in its
+ * own version.
+ *
+ * Later versions only append fields, so that older messages are prefixes
+ * of newer ones. */
+#define MSG_VERSION 2
+#define MSG_VERSION_MIN 1
+
+#include <stddef.h>
 #include <sys/time.h>
 #include <sys/resource.h>
 
@@ -44,10 +53,16 @@ struct msg_request_s {
   msg__rlimit_t rlim;
   msg__user_t user;
   msg__dir_t dir;
+
+  /* Since version 2: pid of the process whose namespaces to join, or 0 */
+  int ns_pid;
 };
 
 struct msg_response_s {
   int version;
+
+  /* Since version 2: pid of the spawned process */
+  int pid;
 };
 
 int msg_array_import(msg__array_t * a, int count, const char ** ptr);
@@ -61,7 +76,12 @@ int msg_user_export(msg__user_t *u, struct passwd *pw);
 
 int msg_dir_import(msg__dir_t *d, const char *dir);
 
+int msg_version_supported(int version);
+
+size_t msg_request_size(int version);
+size_t msg_response_size(int version);
+
 void msg_request_init(msg_request_t *req);
-void msg_response_init(msg_response_t *res);
+void msg_response_init(msg_response_t *res, int version);
 
 #endif
@@ -131,7 +131,16 @@ int un_recv_fds(int fd, char *data, int datalen, int *fds, int fdslen) {
 
   if (fds != NULL) {
     cmh = CMSG_FIRSTHDR(&mh);
-    assert(cmh != NULL);
+  }
+
+  /* The peer refused to send descriptors */
+  if (fds != NULL && cmh == NULL) {
+    int i;
+
+    for (i = 0; i < fdslen; i++) {
+      fds[i] = -1;
+    }
+  } else if (fds != NULL) {
     assert(cmh->cmsg_level == SOL_SOCKET);
     assert(cmh->cmsg_type == SCM_RIGHTS);
     assert(cmh->cmsg_len == CMSG_LEN(sizeof(int) * fdslen));
@@ -2,6 +2,7 @@
 
 #include <assert.h>
 #include <errno.h>
+#include <limits.h>
 #include <signal.h>
 #include <stdio.h>
 #include <stdlib.h>
@@ -33,6 +34,9 @@ struct wsh_s {
 
   /* Working directory of process */
   const char *dir;
+
+  /* Process whose namespaces to join instead of wshd's */
+  int ns_pid;
 };
 
 int wsh__usage(wsh_t *w) {
@@ -56,6 +60,10 @@ int wsh__usage(wsh_t *w) {
     "Working directory for the running process"
     "\n");
 
+  fprintf(stderr, "  --ns-pid PID    "
+    "Join the namespaces of the container's process PID instead of wshd's"
+    "\n");
+
   fprintf(stderr, "  --rsh           "
     "RSH compatibility mode"
     "\n");
@@ -86,6 +94,10 @@ int wsh__getopt(wsh_t *w) {
       w->dir = strdup(w->argv[i+1]);
       i += 2;
       j -= 2;
+    } else if (j >= 2 && strcmp(w->argv[i], "--ns-pid") == 0) {
+      w->ns_pid = atoi(w->argv[i+1]);
+      i += 2;
+      j -= 2;
     } else if (j >= 2 && strcmp(w->argv[i], "--env") == 0) {
       w->environment_variable_count++;
       w->environment_variables = realloc(w->environment_variables, w->environment_variable_count * sizeof(char *));
@@ -254,6 +266,68 @@ void tty_winsz(void) {
   tty_swinsz();
 }
 
+/* Write the pid of the spawned process to the file named by WSH_PIDFILE,
+ * if set, for whoever is tracking it. A missing pidfile does not stop the
+ * process, so failures are only reported. */
+void write_pidfile(int pid) {
+  const char *pidfile;
+  char tmp[PATH_MAX];
+  FILE *f;
+  int rv;
+
+  pidfile = getenv("WSH_PIDFILE");
+  if (pidfile == NULL) {
+    return;
+  }
+
+  rv = snprintf(tmp, sizeof(tmp), "%s.tmp", pidfile);
+  assert(rv < sizeof(tmp));
+
+  f = fopen(tmp, "w");
+  if (f == NULL) {
+    perror("fopen");
+    return;
+  }
+
+  fprintf(f, "%d\n", pid);
+  fclose(f);
+
+  rv = rename(tmp, pidfile);
+  if (rv == -1) {
+    perror("rename");
+  }
+}
+
+/* Responses without descriptors are refusals, which only carry wshd's
+ * version */
+void handle_response(msg_response_t *res, int len, int *fds) {
+  if (len < sizeof(res->version)) {
+    fprintf(stderr, "wshd closed the connection without responding\n");
+    exit(255);
+  }
+
+  if (!msg_version_supported(res->version)) {
+    fprintf(stderr,
+        "wshd speaks protocol version %d; this wsh speaks versions %d to %d\n",
+        res->version, MSG_VERSION_MIN, MSG_VERSION);
+    exit(255);
+  }
+
+  if (fds[0] == -1) {
+    fprintf(stderr,
+        "wshd refused the request; it speaks protocol version %d and this wsh %d\n",
+        res->version, MSG_VERSION);
+    exit(255);
+  }
+
+  assert(len == msg_response_size(res->version));
+
+  /* wshd from before version 2 does not say */
+  if (res->version >= 2) {
+    write_pidfile(res->pid);
+  }
+}
+
 void loop_interactive(int fd) {
   msg_response_t res;
   int fds[2];
@@ -266,7 +340,7 @@ void loop_interactive(int fd) {
     exit(255);
   }
 
-  assert(rv == sizeof(res));
+  handle_response(&res, rv, fds);
 
   pty_remote_fd = fds[0];
   pty_local_fd = STDIN_FILENO;
@@ -296,7 +370,7 @@ void loop_noninteractive(int fd) {
     exit(255);
   }
 
-  assert(rv == sizeof(res));
+  handle_response(&res, rv, fds);
 
   pump_t p;
   pump_pair_t pp[3];
@@ -343,6 +417,8 @@ int main(int argc, char **argv) {
 
   msg_dir_import(&req.dir, w->dir);
 
+  req.ns_pid = w->ns_pid;
+
   if (isatty(STDIN_FILENO)) {
     req.tty = 1;
   } else {
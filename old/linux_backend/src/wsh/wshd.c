@@ -12,14 +12,17 @@
 #include <sys/ipc.h>
 #include <sys/mount.h>
 #include <sys/param.h>
+#include <sys/prctl.h>
 #include <sys/shm.h>
 #include <sys/signalfd.h>
 #include <sys/socket.h>
 #include <sys/stat.h>
+#include <sys/syscall.h>
 #include <sys/types.h>
 #include <sys/wait.h>
 #include <termios.h>
 #include <unistd.h>
+#include <linux/capability.h>
 
 #include "barrier.h"
 #include "msg.h"
@@ -28,6 +31,16 @@
 #include "un.h"
 #include "util.h"
 
+#ifndef PR_CAP_AMBIENT
+#define PR_CAP_AMBIENT 47
+#define PR_CAP_AMBIENT_RAISE 2
+#define PR_CAP_AMBIENT_CLEAR_ALL 4
+#endif
+
+#ifndef PR_SET_NO_NEW_PRIVS
+#define PR_SET_NO_NEW_PRIVS 38
+#endif
+
 typedef struct wshd_s wshd_t;
 
 struct wshd_s {
@@ -43,6 +56,19 @@ struct wshd_s {
   /* Process title */
   char title[32];
 
+  /* Whether processes run as unprivileged users keep CAP_NET_ADMIN */
+  int net_admin;
+
+  /* Whether processes run as unprivileged users may not gain privileges
+   * through setuid binaries or file capabilities */
+  int no_new_privs;
+
+  /* AppArmor profile to confine processes with, if any */
+  char apparmor_profile[256];
+
+  /* SELinux context to run processes in, if any */
+  char selinux_label[256];
+
   /* File descriptor of listening socket */
   int fd;
 
@@ -77,6 +103,22 @@ int wshd__usage(wshd_t *w, int argc, char **argv) {
     "Process title"
     "\n");
 
+  fprintf(stderr, "  --net-admin  "
+    "Let processes run as unprivileged users keep CAP_NET_ADMIN"
+    "\n");
+
+  fprintf(stderr, "  --no-new-privs "
+    "Keep processes run as unprivileged users from gaining privileges"
+    "\n");
+
+  fprintf(stderr, "  --apparmor-profile NAME "
+    "Confine processes with the AppArmor profile"
+    "\n");
+
+  fprintf(stderr, "  --selinux-label CONTEXT "
+    "Run processes in the SELinux context"
+    "\n");
+
   return 0;
 }
 
@@ -86,7 +128,17 @@ int wshd__getopt(wshd_t *w, int argc, char **argv) {
   int rv;
 
   while (i < argc) {
-    if (j >= 2) {
+    if (strcmp("--net-admin", argv[i]) == 0) {
+      w->net_admin = 1;
+
+      i += 1;
+      j -= 1;
+    } else if (strcmp("--no-new-privs", argv[i]) == 0) {
+      w->no_new_privs = 1;
+
+      i += 1;
+      j -= 1;
+    } else if (j >= 2) {
       if (strcmp("--run", argv[i]) == 0) {
         rv = snprintf(w->run_path, sizeof(w->run_path), "%s", argv[i+1]);
         if (rv >= sizeof(w->run_path)) {
@@ -107,6 +159,16 @@ int wshd__getopt(wshd_t *w, int argc, char **argv) {
         if (rv >= sizeof(w->title)) {
           goto toolong;
         }
+      } else if (strcmp("--apparmor-profile", argv[i]) == 0) {
+        rv = snprintf(w->apparmor_profile, sizeof(w->apparmor_profile), "%s", argv[i+1]);
+        if (rv >= sizeof(w->apparmor_profile)) {
+          goto toolong;
+        }
+      } else if (strcmp("--selinux-label", argv[i]) == 0) {
+        rv = snprintf(w->selinux_label, sizeof(w->selinux_label), "%s", argv[i+1]);
+        if (rv >= sizeof(w->selinux_label)) {
+          goto toolong;
+        }
       } else {
         goto invalid;
       }
@@ -204,12 +266,33 @@ int child_pid_to_fd_remove(wshd_t *w, pid_t pid) {
   return fd;
 }
 
+int env__has(char **envp, const char *key) {
+  size_t keylen = strlen(key);
+
+  if (envp == NULL) {
+    return 0;
+  }
+
+  for (; *envp != NULL; envp++) {
+    if (strncmp(*envp, key, keylen) == 0 && (*envp)[keylen] == '=') {
+      return 1;
+    }
+  }
+
+  return 0;
+}
+
+/* Adds a default for key; variables from the request take precedence */
 char **env__add(char **envp, const char *key, const char *value) {
   size_t envplen = 0;
   char *buf;
   size_t buflen;
   int rv;
 
+  if (env__has(envp, key)) {
+    return envp;
+  }
+
   if (envp == NULL) {
     /* Trailing NULL */
     envplen = 1;
@@ -255,7 +338,129 @@ char **child_setup_environment(struct passwd *pw, char **extra_env_vars) {
   return envp;
 }
 
-int child_fork(msg_request_t *req, int in, int out, int err) {
+/* Keep only CAP_NET_ADMIN, as an ambient capability so that it survives
+ * execve. The process must have set PR_SET_KEEPCAPS before changing user. */
+int child_keep_net_admin(void) {
+  struct __user_cap_header_struct header;
+  struct __user_cap_data_struct data[2];
+  int rv;
+
+  memset(&header, 0, sizeof(header));
+  memset(data, 0, sizeof(data));
+
+  header.version = _LINUX_CAPABILITY_VERSION_3;
+  header.pid = 0;
+
+  data[CAP_TO_INDEX(CAP_NET_ADMIN)].effective = CAP_TO_MASK(CAP_NET_ADMIN);
+  data[CAP_TO_INDEX(CAP_NET_ADMIN)].permitted = CAP_TO_MASK(CAP_NET_ADMIN);
+  data[CAP_TO_INDEX(CAP_NET_ADMIN)].inheritable = CAP_TO_MASK(CAP_NET_ADMIN);
+
+  rv = syscall(SYS_capset, &header, data);
+  if (rv == -1) {
+    return rv;
+  }
+
+  return prctl(PR_CAP_AMBIENT, PR_CAP_AMBIENT_RAISE, CAP_NET_ADMIN, 0, 0);
+}
+
+/* Leave an unprivileged process no ambient capabilities but those it is
+ * meant to keep, and, if asked, no way of gaining more by executing setuid
+ * binaries or binaries with file capabilities. */
+int child_drop_privileges(wshd_t *w) {
+  int rv;
+
+  rv = prctl(PR_CAP_AMBIENT, PR_CAP_AMBIENT_CLEAR_ALL, 0, 0, 0);
+  if (rv == -1 && errno != EINVAL) {
+    return rv;
+  }
+
+  if (w->net_admin) {
+    rv = child_keep_net_admin();
+    if (rv == -1) {
+      return rv;
+    }
+  }
+
+  if (w->no_new_privs) {
+    rv = prctl(PR_SET_NO_NEW_PRIVS, 1, 0, 0, 0);
+    if (rv == -1) {
+      return rv;
+    }
+  }
+
+  return 0;
+}
+
+/* Set what the process's security module applies to it once it executes
+ * its command. */
+int child_write_attr_exec(const char *attr) {
+  int fd, rv;
+
+  fd = open("/proc/self/attr/exec", O_WRONLY);
+  if (fd == -1) {
+    return -1;
+  }
+
+  rv = write(fd, attr, strlen(attr));
+  close(fd);
+
+  if (rv == -1) {
+    return -1;
+  }
+
+  return 0;
+}
+
+/* Have the process confined by the AppArmor profile once it executes its
+ * command, as aa_change_onexec would, without needing libapparmor. */
+int child_change_profile_onexec(const char *profile) {
+  char cmd[sizeof("exec ") + 256];
+  int rv;
+
+  rv = snprintf(cmd, sizeof(cmd), "exec %s", profile);
+  assert(rv < sizeof(cmd));
+
+  return child_write_attr_exec(cmd);
+}
+
+/* Have the process run in the SELinux context once it executes its command,
+ * as setexeccon would, without needing libselinux. */
+int child_set_exec_label(const char *label) {
+  return child_write_attr_exec(label);
+}
+
+/* Join the namespaces of another process in the container, so that the
+ * child sees what it sees. Joining a pid namespace only applies to the
+ * children of the child. */
+int child_join_namespaces(pid_t pid) {
+  /* mnt goes last, as it changes what /proc is */
+  const char *namespaces[] = { "ipc", "uts", "net", "pid", "mnt" };
+  char path[64];
+  int i, fd, rv;
+
+  for (i = 0; i < sizeof(namespaces)/sizeof(namespaces[0]); i++) {
+    rv = snprintf(path, sizeof(path), "/proc/%d/ns/%s", pid, namespaces[i]);
+    assert(rv < sizeof(path));
+
+    fd = open(path, O_RDONLY);
+    if (fd == -1) {
+      perror(path);
+      return -1;
+    }
+
+    rv = setns(fd, 0);
+    close(fd);
+
+    if (rv == -1) {
+      perror("setns");
+      return -1;
+    }
+  }
+
+  return 0;
+}
+
+int child_fork(wshd_t *w, msg_request_t *req, int in, int out, int err) {
   int rv;
 
   rv = fork();
@@ -272,6 +477,8 @@ int child_fork(msg_request_t *req, int in, int out, int err) {
     char **argv = default_argv;
     char **envp = default_envp;
     char **extra_env_vars = NULL;
+    char *path;
+    char *login_name;
 
     rv = dup2(in, STDIN_FILENO);
     assert(rv != -1);
@@ -285,6 +492,31 @@ int child_fork(msg_request_t *req, int in, int out, int err) {
     rv = setsid();
     assert(rv != -1);
 
+    /* before joining another process's namespaces, after which /proc/self
+     * may not be this process */
+    if (strlen(w->apparmor_profile)) {
+      rv = child_change_profile_onexec(w->apparmor_profile);
+      if (rv == -1) {
+        perror("child_change_profile_onexec");
+        goto error;
+      }
+    }
+
+    if (strlen(w->selinux_label)) {
+      rv = child_set_exec_label(w->selinux_label);
+      if (rv == -1) {
+        perror("child_set_exec_label");
+        goto error;
+      }
+    }
+
+    if (req->ns_pid) {
+      rv = child_join_namespaces(req->ns_pid);
+      if (rv == -1) {
+        goto error;
+      }
+    }
+
     user = req->user.name;
     if (!strlen(user)) {
       user = "root";
@@ -306,10 +538,24 @@ int child_fork(msg_request_t *req, int in, int out, int err) {
       assert(rv != -1);
     }
 
+    path = default_argv[0];
+
     /* Use argv from request if needed */
     if (req->arg.count) {
       argv = (char **)msg_array_export(&req->arg);
       assert(argv != NULL);
+      path = argv[0];
+    } else {
+      /* Interactive shells are login shells, so that they pick up the
+       * container's environment from /etc/profile.d */
+      login_name = strrchr(path, '/');
+      login_name = login_name == NULL ? path : login_name + 1;
+
+      argv[0] = malloc(strlen(login_name) + 2);
+      assert(argv[0] != NULL);
+
+      rv = sprintf(argv[0], "-%s", login_name);
+      assert(rv > 0);
     }
 
     rv = msg_rlimit_export(&req->rlim);
@@ -318,12 +564,28 @@ int child_fork(msg_request_t *req, int in, int out, int err) {
       goto error;
     }
 
+    if (w->net_admin && pw->pw_uid != 0) {
+      rv = prctl(PR_SET_KEEPCAPS, 1, 0, 0, 0);
+      if (rv == -1) {
+        perror("prctl");
+        goto error;
+      }
+    }
+
     rv = msg_user_export(&req->user, pw);
     if (rv == -1) {
       perror("msg_user_export");
       goto error;
     }
 
+    if (pw->pw_uid != 0) {
+      rv = child_drop_privileges(w);
+      if (rv == -1) {
+        perror("child_drop_privileges");
+        goto error;
+      }
+    }
+
     if (req->env.count) {
       extra_env_vars = (char **)msg_array_export(&req->env);
       assert(extra_env_vars != NULL);
@@ -340,7 +602,7 @@ int child_fork(msg_request_t *req, int in, int out, int err) {
       }
     }
 
-    execvpe(argv[0], argv, envp);
+    execvpe(path, argv, envp);
     perror("execvpe");
 
 error:
@@ -355,9 +617,10 @@ int child_handle_interactive(int fd, wshd_t *w, msg_request_t *req) {
   int p[2][2];
   int p_[2];
   int rv;
+  pid_t pid;
   msg_response_t res;
 
-  msg_response_init(&res);
+  msg_response_init(&res, req->version);
 
   /* Initialize so that the error handler can do its job */
   for (i = 0; i < 2; i++) {
@@ -388,15 +651,19 @@ int child_handle_interactive(int fd, wshd_t *w, msg_request_t *req) {
   p_[0] = p[0][0];
   p_[1] = p[1][0];
 
-  rv = un_send_fds(fd, (char *)&res, sizeof(res), p_, 2);
+  /* Fork first, so that the client can be told the child's pid */
+  pid = child_fork(w, req, p[0][1], p[0][1], p[0][1]);
+  assert(pid > 0);
+
+  res.pid = pid;
+
+  rv = un_send_fds(fd, (char *)&res, msg_response_size(res.version), p_, 2);
   if (rv == -1) {
+    kill(pid, SIGKILL);
     goto err;
   }
 
-  rv = child_fork(req, p[0][1], p[0][1], p[0][1]);
-  assert(rv > 0);
-
-  child_pid_to_fd_add(w, rv, p[1][1]);
+  child_pid_to_fd_add(w, pid, p[1][1]);
 
 err:
   for (i = 0; i < 2; i++) {
@@ -421,9 +688,10 @@ int child_handle_noninteractive(int fd, wshd_t *w, msg_request_t *req) {
   int p[4][2];
   int p_[4];
   int rv;
+  pid_t pid;
   msg_response_t res;
 
-  msg_response_init(&res);
+  msg_response_init(&res, req->version);
 
   /* Initialize so that the error handler can do its job */
   for (i = 0; i < 4; i++) {
@@ -449,15 +717,19 @@ int child_handle_noninteractive(int fd, wshd_t *w, msg_request_t *req) {
   p_[2] = p[2][0];
   p_[3] = p[3][0];
 
-  rv = un_send_fds(fd, (char *)&res, sizeof(res), p_, 4);
+  /* Fork first, so that the client can be told the child's pid */
+  pid = child_fork(w, req, p[0][0], p[1][1], p[2][1]);
+  assert(pid > 0);
+
+  res.pid = pid;
+
+  rv = un_send_fds(fd, (char *)&res, msg_response_size(res.version), p_, 4);
   if (rv == -1) {
+    kill(pid, SIGKILL);
     goto err;
   }
 
-  rv = child_fork(req, p[0][0], p[1][1], p[2][1]);
-  assert(rv > 0);
-
-  child_pid_to_fd_add(w, rv, p[3][1]);
+  child_pid_to_fd_add(w, pid, p[3][1]);
 
 err:
   for (i = 0; i < 4; i++) {
@@ -477,10 +749,34 @@ err:
   return 0;
 }
 
+/* Tell a client speaking an unsupported protocol version which version
+ * this wshd speaks, rather than misreading its request */
+int child_refuse(int fd, int version) {
+  msg_response_t res;
+
+  msg_response_init(&res, MSG_VERSION);
+
+  fprintf(stderr,
+      "refusing request of protocol version %d; speaking versions %d to %d\n",
+      version, MSG_VERSION_MIN, MSG_VERSION);
+
+  /* Only the version is common to every response. Best effort; the client
+   * may already be gone */
+  write(fd, &res, sizeof(res.version));
+
+  close(fd);
+
+  return 0;
+}
+
 int child_accept(wshd_t *w) {
   int rv, fd;
+  size_t size;
   msg_request_t req;
 
+  /* Fields newer than the request's version stay zeroed */
+  memset(&req, 0, sizeof(req));
+
   rv = accept(w->fd, NULL, NULL);
   if (rv == -1) {
     perror("accept");
@@ -491,7 +787,27 @@ int child_accept(wshd_t *w) {
 
   fcntl_mix_cloexec(fd);
 
-  rv = un_recv_fds(fd, (char *)&req, sizeof(req), NULL, 0);
+  /* Read the version alone first; the rest of the request depends on it */
+  rv = un_recv_fds(fd, (char *)&req.version, sizeof(req.version), NULL, 0);
+  if (rv < 0) {
+    perror("recvmsg");
+    exit(255);
+  }
+
+  if (rv == 0) {
+    close(fd);
+    return 0;
+  }
+
+  assert(rv == sizeof(req.version));
+
+  if (!msg_version_supported(req.version)) {
+    return child_refuse(fd, req.version);
+  }
+
+  size = msg_request_size(req.version) - sizeof(req.version);
+
+  rv = un_recv_fds(fd, (char *)&req + sizeof(req.version), size, NULL, 0);
   if (rv < 0) {
     perror("recvmsg");
     exit(255);
@@ -502,7 +818,7 @@ int child_accept(wshd_t *w) {
     return 0;
   }
 
-  assert(rv == sizeof(req));
+  assert(rv == size);
 
   if (req.tty) {
     return child_handle_interactive(fd, w, &req);
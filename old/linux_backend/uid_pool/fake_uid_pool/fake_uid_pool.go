@@ -3,7 +3,8 @@ package fake_uid_pool
 type FakeUIDPool struct {
 	nextUID uint32
 
-	InitialPoolSize int
+	InitialPoolSize   int
+	AvailablePoolSize int
 
 	AcquireError error
 	RemoveError  error
@@ -23,6 +24,10 @@ func (p *FakeUIDPool) InitialSize() int {
 	return p.InitialPoolSize
 }
 
+func (p *FakeUIDPool) Available() int {
+	return p.AvailablePoolSize
+}
+
 func (p *FakeUIDPool) Acquire() (uint32, error) {
 	if p.AcquireError != nil {
 		return 0, p.AcquireError
@@ -31,6 +36,8 @@ func (p *FakeUIDPool) Acquire() (uint32, error) {
 	uid := p.nextUID
 	p.nextUID++
 
+	p.Acquired = append(p.Acquired, uid)
+
 	return uid, nil
 }
 
@@ -44,6 +51,16 @@ func (p *FakeUIDPool) Remove(uid uint32) error {
 	return nil
 }
 
+func (p *FakeUIDPool) RemoveAll(uids []uint32) error {
+	if p.RemoveError != nil {
+		return p.RemoveError
+	}
+
+	p.Removed = append(p.Removed, uids...)
+
+	return nil
+}
+
 func (p *FakeUIDPool) Release(uid uint32) {
 	p.Released = append(p.Released, uid)
 }
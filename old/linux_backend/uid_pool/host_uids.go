@@ -0,0 +1,105 @@
+package uid_pool
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+type MalformedPasswdError struct {
+	Line string
+}
+
+func (e MalformedPasswdError) Error() string {
+	return fmt.Sprintf("malformed passwd entry: %q", e.Line)
+}
+
+// HostUIDs returns the uids that the host is using: those of the users in
+// passwdPath, and of the processes running under procPath.
+func HostUIDs(passwdPath, procPath string) (map[uint32]bool, error) {
+	uids := map[uint32]bool{}
+
+	err := passwdUIDs(passwdPath, uids)
+	if err != nil {
+		return nil, err
+	}
+
+	err = processUIDs(procPath, uids)
+	if err != nil {
+		return nil, err
+	}
+
+	return uids, nil
+}
+
+func passwdUIDs(passwdPath string, uids map[uint32]bool) error {
+	passwd, err := os.Open(passwdPath)
+	if err != nil {
+		return err
+	}
+
+	defer passwd.Close()
+
+	scanner := bufio.NewScanner(passwd)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.Split(line, ":")
+		if len(fields) < 3 {
+			return MalformedPasswdError{line}
+		}
+
+		uid, err := strconv.ParseUint(fields[2], 10, 32)
+		if err != nil {
+			return MalformedPasswdError{line}
+		}
+
+		uids[uint32(uid)] = true
+	}
+
+	return scanner.Err()
+}
+
+func processUIDs(procPath string, uids map[uint32]bool) error {
+	entries, err := ioutil.ReadDir(procPath)
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		if _, err := strconv.Atoi(entry.Name()); err != nil {
+			continue
+		}
+
+		// processes may exit while we look; skip any that have gone
+		status, err := ioutil.ReadFile(filepath.Join(procPath, entry.Name(), "status"))
+		if err != nil {
+			continue
+		}
+
+		for _, line := range strings.Split(string(status), "\n") {
+			if !strings.HasPrefix(line, "Uid:") {
+				continue
+			}
+
+			// real, effective, saved and filesystem uids
+			for _, field := range strings.Fields(line)[1:] {
+				uid, err := strconv.ParseUint(field, 10, 32)
+				if err == nil {
+					uids[uint32(uid)] = true
+				}
+			}
+
+			break
+		}
+	}
+
+	return nil
+}
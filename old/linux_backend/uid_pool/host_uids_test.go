@@ -0,0 +1,76 @@
+package uid_pool_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/cloudfoundry-incubator/garden-linux/old/linux_backend/uid_pool"
+)
+
+var _ = Describe("HostUIDs", func() {
+	var tmpdir string
+	var passwdPath string
+	var procPath string
+
+	writeFile := func(path, contents string) {
+		err := os.MkdirAll(filepath.Dir(path), 0755)
+		Ω(err).ShouldNot(HaveOccurred())
+
+		err = ioutil.WriteFile(path, []byte(contents), 0644)
+		Ω(err).ShouldNot(HaveOccurred())
+	}
+
+	BeforeEach(func() {
+		var err error
+
+		tmpdir, err = ioutil.TempDir("", "host-uids")
+		Ω(err).ShouldNot(HaveOccurred())
+
+		passwdPath = filepath.Join(tmpdir, "passwd")
+		procPath = filepath.Join(tmpdir, "proc")
+
+		writeFile(passwdPath, "root:x:0:0:root:/root:/bin/bash\n# a comment\n\nvcap:x:10001:10001::/home/vcap:/bin/bash\n")
+
+		writeFile(filepath.Join(procPath, "1", "status"), "Name:\tinit\nUid:\t0\t0\t0\t0\nGid:\t0\t0\t0\t0\n")
+		writeFile(filepath.Join(procPath, "42", "status"), "Name:\tsome-daemon\nUid:\t10005\t10006\t10005\t10005\n")
+		writeFile(filepath.Join(procPath, "self", "status"), "Name:\tself\nUid:\t20000\t20000\t20000\t20000\n")
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(tmpdir)
+	})
+
+	It("returns the uids of the host's users and processes", func() {
+		uids, err := uid_pool.HostUIDs(passwdPath, procPath)
+		Ω(err).ShouldNot(HaveOccurred())
+
+		Ω(uids).Should(Equal(map[uint32]bool{
+			0:     true,
+			10001: true,
+			10005: true,
+			10006: true,
+		}))
+	})
+
+	Context("when the passwd file is malformed", func() {
+		BeforeEach(func() {
+			writeFile(passwdPath, "root:x:zero:0:root:/root:/bin/bash\n")
+		})
+
+		It("returns a MalformedPasswdError", func() {
+			_, err := uid_pool.HostUIDs(passwdPath, procPath)
+			Ω(err).Should(Equal(uid_pool.MalformedPasswdError{Line: "root:x:zero:0:root:/root:/bin/bash"}))
+		})
+	})
+
+	Context("when the passwd file does not exist", func() {
+		It("returns an error", func() {
+			_, err := uid_pool.HostUIDs(filepath.Join(tmpdir, "bogus"), procPath)
+			Ω(err).Should(HaveOccurred())
+		})
+	})
+})
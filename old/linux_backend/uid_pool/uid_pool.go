@@ -3,6 +3,8 @@ package uid_pool
 type UIDPool interface {
 	Acquire() (uint32, error)
 	Remove(uint32) error
+	RemoveAll([]uint32) error
 	Release(uint32)
 	InitialSize() int
+	Available() int
 }
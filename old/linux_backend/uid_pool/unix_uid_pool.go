@@ -12,6 +12,10 @@ type UnixUIDPool struct {
 	pool            []uint32
 	poolMutex       *sync.Mutex
 	initialPoolSize int
+
+	// uids in the range that the host was found to be using; they are
+	// never acquired, but may still be removed by restored containers
+	excluded map[uint32]bool
 }
 
 type PoolExhaustedError struct{}
@@ -28,6 +32,15 @@ func (e UIDTakenError) Error() string {
 	return fmt.Sprintf("uid already acquired: %d", e.UID)
 }
 
+// UIDsTakenError reports every uid that could not be removed in a RemoveAll
+type UIDsTakenError struct {
+	UIDs []uint32
+}
+
+func (e UIDsTakenError) Error() string {
+	return fmt.Sprintf("uids already acquired: %v", e.UIDs)
+}
+
 func New(start, size uint32) *UnixUIDPool {
 	pool := []uint32{}
 
@@ -42,11 +55,51 @@ func New(start, size uint32) *UnixUIDPool {
 		pool:            pool,
 		poolMutex:       new(sync.Mutex),
 		initialPoolSize: len(pool),
+
+		excluded: map[uint32]bool{},
 	}
 }
 
 func (p *UnixUIDPool) InitialSize() int {
-	return p.initialPoolSize
+	p.poolMutex.Lock()
+	defer p.poolMutex.Unlock()
+
+	return p.initialPoolSize - len(p.excluded)
+}
+
+// Available returns how many uids can still be acquired.
+func (p *UnixUIDPool) Available() int {
+	p.poolMutex.Lock()
+	defer p.poolMutex.Unlock()
+
+	return len(p.pool)
+}
+
+// Exclude takes any of the given uids out of the pool so that they are never
+// acquired, and returns those that were in it.
+//
+// A restored container may still Remove an excluded uid, as the host
+// processes it was excluded for are most likely the container's own.
+func (p *UnixUIDPool) Exclude(uids map[uint32]bool) []uint32 {
+	p.poolMutex.Lock()
+	defer p.poolMutex.Unlock()
+
+	excluded := []uint32{}
+	pool := make([]uint32, 0, len(p.pool))
+
+	for _, uid := range p.pool {
+		if uids[uid] {
+			p.excluded[uid] = true
+			excluded = append(excluded, uid)
+			continue
+		}
+
+		pool = append(pool, uid)
+	}
+
+	p.pool = pool
+
+	return excluded
 }
 
 func (p *UnixUIDPool) Acquire() (uint32, error) {
@@ -71,6 +124,11 @@ func (p *UnixUIDPool) Remove(uid uint32) error {
 	p.poolMutex.Lock()
 	defer p.poolMutex.Unlock()
 
+	if p.excluded[uid] {
+		delete(p.excluded, uid)
+		return nil
+	}
+
 	for i, existingUID := range p.pool {
 		if existingUID == uid {
 			idx = i
@@ -88,6 +146,51 @@ func (p *UnixUIDPool) Remove(uid uint32) error {
 	return nil
 }
 
+// RemoveAll removes many uids in one pass, as when restoring containers.
+// If any of them is taken, or given twice, none are removed.
+func (p *UnixUIDPool) RemoveAll(uids []uint32) error {
+	p.poolMutex.Lock()
+	defer p.poolMutex.Unlock()
+
+	available := map[uint32]bool{}
+	for _, uid := range p.pool {
+		available[uid] = true
+	}
+
+	for uid := range p.excluded {
+		available[uid] = true
+	}
+
+	taken := []uint32{}
+	for _, uid := range uids {
+		if !available[uid] {
+			taken = append(taken, uid)
+			continue
+		}
+
+		delete(available, uid)
+	}
+
+	if len(taken) > 0 {
+		return UIDsTakenError{taken}
+	}
+
+	for _, uid := range uids {
+		delete(p.excluded, uid)
+	}
+
+	pool := make([]uint32, 0, len(available))
+	for _, uid := range p.pool {
+		if available[uid] {
+			pool = append(pool, uid)
+		}
+	}
+
+	p.pool = pool
+
+	return nil
+}
+
 func (p *UnixUIDPool) Release(uid uint32) {
 	if uid < p.start || uid >= p.start+p.size {
 		return
@@ -65,6 +65,90 @@ var _ = Describe("Unix UID pool", func() {
 		})
 	})
 
+	Describe("removing many", func() {
+		It("acquires all of the uids from the pool", func() {
+			pool := uid_pool.New(10000, 3)
+
+			err := pool.RemoveAll([]uint32{10000, 10002})
+			Ω(err).ShouldNot(HaveOccurred())
+
+			uid, err := pool.Acquire()
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(uid).Should(Equal(uint32(10001)))
+
+			_, err = pool.Acquire()
+			Ω(err).Should(HaveOccurred())
+		})
+
+		Context("when some are already acquired or given twice", func() {
+			It("reports them all and removes none", func() {
+				pool := uid_pool.New(10000, 3)
+
+				uid, err := pool.Acquire()
+				Ω(err).ShouldNot(HaveOccurred())
+
+				err = pool.RemoveAll([]uint32{uid, 10001, 10002, 10002})
+				Ω(err).Should(Equal(uid_pool.UIDsTakenError{UIDs: []uint32{uid, 10002}}))
+
+				err = pool.RemoveAll([]uint32{10001, 10002})
+				Ω(err).ShouldNot(HaveOccurred())
+			})
+		})
+	})
+
+	Describe("Available", func() {
+		It("returns the count of uids that can still be acquired", func() {
+			pool := uid_pool.New(10000, 3)
+
+			_, err := pool.Acquire()
+			Ω(err).ShouldNot(HaveOccurred())
+
+			pool.Exclude(map[uint32]bool{10002: true})
+
+			Ω(pool.Available()).Should(Equal(1))
+		})
+	})
+
+	Describe("excluding", func() {
+		It("never acquires the excluded uids", func() {
+			pool := uid_pool.New(10000, 3)
+
+			excluded := pool.Exclude(map[uint32]bool{10000: true, 10002: true, 20000: true})
+			Ω(excluded).Should(Equal([]uint32{10000, 10002}))
+
+			uid, err := pool.Acquire()
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(uid).Should(Equal(uint32(10001)))
+
+			_, err = pool.Acquire()
+			Ω(err).Should(HaveOccurred())
+		})
+
+		It("does not count them towards the pool's size", func() {
+			pool := uid_pool.New(10000, 3)
+
+			pool.Exclude(map[uint32]bool{10000: true})
+			Ω(pool.InitialSize()).Should(Equal(2))
+		})
+
+		It("still allows them to be removed", func() {
+			pool := uid_pool.New(10000, 3)
+
+			pool.Exclude(map[uint32]bool{10000: true, 10001: true})
+
+			err := pool.Remove(10000)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			err = pool.RemoveAll([]uint32{10001})
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(pool.InitialSize()).Should(Equal(3))
+
+			err = pool.Remove(10000)
+			Ω(err).Should(Equal(uid_pool.UIDTakenError{UID: 10000}))
+		})
+	})
+
 	Describe("releasing", func() {
 		It("places a uid back at the end of the pool", func() {
 			pool := uid_pool.New(10000, 2)
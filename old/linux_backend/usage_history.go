@@ -0,0 +1,111 @@
+package linux_backend
+
+import (
+	"time"
+
+	"github.com/cloudfoundry-incubator/garden/api"
+)
+
+// UsageSample is a container's CPU and memory usage at a point in time.
+type UsageSample struct {
+	Time   time.Time
+	Memory api.ContainerMemoryStat
+	CPU    api.ContainerCPUStat
+}
+
+// usageHistory is a ring buffer of a container's most recent usage samples.
+type usageHistory struct {
+	samples []UsageSample
+	next    int
+	count   int
+}
+
+func (h *usageHistory) add(sample UsageSample, size int) {
+	if size != len(h.samples) {
+		h.resize(size)
+	}
+
+	if size == 0 {
+		return
+	}
+
+	h.samples[h.next] = sample
+	h.next = (h.next + 1) % size
+
+	if h.count < size {
+		h.count++
+	}
+}
+
+// ordered returns the samples, oldest first.
+func (h *usageHistory) ordered() []UsageSample {
+	ordered := make([]UsageSample, 0, h.count)
+
+	start := h.next - h.count
+	if start < 0 {
+		start += len(h.samples)
+	}
+
+	for i := 0; i < h.count; i++ {
+		ordered = append(ordered, h.samples[(start+i)%len(h.samples)])
+	}
+
+	return ordered
+}
+
+// resize keeps the latest samples that fit in the new size.
+func (h *usageHistory) resize(size int) {
+	kept := h.ordered()
+	if len(kept) > size {
+		kept = kept[len(kept)-size:]
+	}
+
+	h.samples = make([]UsageSample, size)
+	h.count = copy(h.samples, kept)
+	h.next = 0
+
+	if size > 0 {
+		h.next = h.count % size
+	}
+}
+
+// SampleUsage records the container's current CPU and memory usage, keeping
+// the latest keep samples.
+func (c *LinuxContainer) SampleUsage(keep int) error {
+	memoryStat, err := c.cgroupsManager.Get("memory", "memory.stat")
+	if err != nil {
+		return err
+	}
+
+	cpuUsage, err := c.cgroupsManager.Get("cpuacct", "cpuacct.usage")
+	if err != nil {
+		return err
+	}
+
+	cpuStat, err := c.cgroupsManager.Get("cpuacct", "cpuacct.stat")
+	if err != nil {
+		return err
+	}
+
+	sample := UsageSample{
+		Time:   time.Now(),
+		Memory: parseMemoryStat(memoryStat),
+		CPU:    parseCPUStat(cpuUsage, cpuStat),
+	}
+
+	c.usageMutex.Lock()
+	defer c.usageMutex.Unlock()
+
+	c.usage.add(sample, keep)
+
+	return nil
+}
+
+// UsageHistory returns the container's recorded usage samples, oldest first,
+// so that spikes, e.g. those leading to an OOM, can be looked into later.
+func (c *LinuxContainer) UsageHistory() []UsageSample {
+	c.usageMutex.RLock()
+	defer c.usageMutex.RUnlock()
+
+	return c.usage.ordered()
+}
@@ -0,0 +1,132 @@
+package linux_backend
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os/exec"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/cloudfoundry-incubator/garden-linux/old/logging"
+)
+
+// UsageSummary is a container's usage over its whole life, as reported when
+// it is destroyed, for chargeback and capacity planning, and what it is
+// using at the time.
+type UsageSummary struct {
+	PeakMemoryBytes uint64
+
+	// in use at the time
+	MemoryBytes uint64
+	DiskBytes   uint64
+
+	// CPU time used, in nanoseconds
+	CPUTime uint64
+
+	DiskBytesWritten uint64
+
+	// across all of its networks, from the container's side
+	NetworkBytesReceived uint64
+	NetworkBytesSent     uint64
+}
+
+// UsageSummary gathers the container's usage since it was created. It must
+// be called before the container is destroyed, while its cgroups and network
+// interfaces still exist.
+func (c *LinuxContainer) UsageSummary() (UsageSummary, error) {
+	cLog := c.logger.Session("usage-summary")
+
+	summary := UsageSummary{}
+
+	peakMemory, err := c.cgroupsManager.Get("memory", "memory.max_usage_in_bytes")
+	if err != nil {
+		return summary, err
+	}
+
+	summary.PeakMemoryBytes, err = strconv.ParseUint(strings.TrimSpace(peakMemory), 10, 64)
+	if err != nil {
+		return summary, err
+	}
+
+	memoryUsage, err := c.cgroupsManager.Get("memory", "memory.usage_in_bytes")
+	if err != nil {
+		return summary, err
+	}
+
+	summary.MemoryBytes, err = strconv.ParseUint(strings.TrimSpace(memoryUsage), 10, 64)
+	if err != nil {
+		return summary, err
+	}
+
+	cpuUsage, err := c.cgroupsManager.Get("cpuacct", "cpuacct.usage")
+	if err != nil {
+		return summary, err
+	}
+
+	summary.CPUTime, err = strconv.ParseUint(strings.TrimSpace(cpuUsage), 10, 64)
+	if err != nil {
+		return summary, err
+	}
+
+	ioServiceBytes, err := c.cgroupsManager.Get("blkio", "blkio.throttle.io_service_bytes")
+	if err != nil {
+		return summary, err
+	}
+
+	summary.DiskBytesWritten = parseBytesWritten(ioServiceBytes)
+
+	diskStat, err := c.diskUsage(cLog)
+	if err != nil {
+		return summary, err
+	}
+
+	summary.DiskBytes = diskStat.BytesUsed
+
+	cRunner := logging.Runner{
+		CommandRunner: c.runner,
+		Logger:        cLog,
+	}
+
+	networkUsage := new(bytes.Buffer)
+
+	usage := exec.Command(path.Join(c.path, "net.sh"), "usage")
+	usage.Stdout = networkUsage
+
+	err = cRunner.Run(usage)
+	if err != nil {
+		return summary, err
+	}
+
+	_, err = fmt.Sscanf(networkUsage.String(), "%d %d", &summary.NetworkBytesReceived, &summary.NetworkBytesSent)
+	if err != nil {
+		return summary, fmt.Errorf("invalid network usage %q: %s", networkUsage.String(), err)
+	}
+
+	return summary, nil
+}
+
+// parseBytesWritten totals the writes to each device in the contents of
+// blkio.throttle.io_service_bytes, whose lines are "<major:minor> <op>
+// <bytes>", followed by an overall "Total <bytes>".
+func parseBytesWritten(ioServiceBytes string) uint64 {
+	var written uint64
+
+	scanner := bufio.NewScanner(strings.NewReader(ioServiceBytes))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 3 || fields[1] != "Write" {
+			continue
+		}
+
+		count, err := strconv.ParseUint(fields[2], 10, 64)
+		if err != nil {
+			continue
+		}
+
+		written += count
+	}
+
+	return written
+}
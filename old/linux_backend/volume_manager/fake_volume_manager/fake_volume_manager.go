@@ -0,0 +1,93 @@
+package fake_volume_manager
+
+import (
+	"sync"
+
+	"github.com/cloudfoundry-incubator/garden/api"
+	"github.com/pivotal-golang/lager"
+)
+
+type FakeVolumeManager struct {
+	CreateError  error
+	MountError   error
+	ResizeError  error
+	UsageError   error
+	DestroyError error
+
+	UsageResult api.ContainerDiskStat
+
+	// container ID -> mount point
+	Created map[string]string
+	Mounted map[string]string
+
+	// container ID -> size in bytes
+	Resized map[string]uint64
+
+	Destroyed []string
+
+	sync.RWMutex
+}
+
+func New() *FakeVolumeManager {
+	return &FakeVolumeManager{
+		Created: make(map[string]string),
+		Mounted: make(map[string]string),
+		Resized: make(map[string]uint64),
+	}
+}
+
+func (m *FakeVolumeManager) Create(logger lager.Logger, id string, mountPoint string) error {
+	if m.CreateError != nil {
+		return m.CreateError
+	}
+
+	m.Lock()
+	m.Created[id] = mountPoint
+	m.Unlock()
+
+	return nil
+}
+
+func (m *FakeVolumeManager) Mount(logger lager.Logger, id string, mountPoint string) error {
+	if m.MountError != nil {
+		return m.MountError
+	}
+
+	m.Lock()
+	m.Mounted[id] = mountPoint
+	m.Unlock()
+
+	return nil
+}
+
+func (m *FakeVolumeManager) Resize(logger lager.Logger, id string, sizeInBytes uint64) error {
+	if m.ResizeError != nil {
+		return m.ResizeError
+	}
+
+	m.Lock()
+	m.Resized[id] = sizeInBytes
+	m.Unlock()
+
+	return nil
+}
+
+func (m *FakeVolumeManager) Usage(logger lager.Logger, id string) (api.ContainerDiskStat, error) {
+	if m.UsageError != nil {
+		return api.ContainerDiskStat{}, m.UsageError
+	}
+
+	return m.UsageResult, nil
+}
+
+func (m *FakeVolumeManager) Destroy(logger lager.Logger, id string) error {
+	if m.DestroyError != nil {
+		return m.DestroyError
+	}
+
+	m.Lock()
+	m.Destroyed = append(m.Destroyed, id)
+	m.Unlock()
+
+	return nil
+}
@@ -0,0 +1,192 @@
+package volume_manager
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path"
+
+	"github.com/cloudfoundry-incubator/garden-linux/old/logging"
+	"github.com/cloudfoundry-incubator/garden/api"
+	"github.com/cloudfoundry/gunk/command_runner"
+	"github.com/pivotal-golang/lager"
+)
+
+// VolumeManager gives each container a dedicated volume for its writable
+// storage, so that its size is a hard limit and its usage is known without
+// walking its files.
+type VolumeManager interface {
+	// Create makes the container's volume and mounts it, removing the
+	// volume again if it cannot be.
+	Create(logger lager.Logger, id string, mountPoint string) error
+
+	// Mount mounts the container's volume again, unless it still is, as
+	// after a host reboot.
+	Mount(logger lager.Logger, id string, mountPoint string) error
+
+	Resize(logger lager.Logger, id string, sizeInBytes uint64) error
+	Usage(logger lager.Logger, id string) (api.ContainerDiskStat, error)
+
+	// Destroy removes the container's volume, which must be unmounted.
+	Destroy(logger lager.Logger, id string) error
+}
+
+// LVMVolumeManager makes thin volumes in a thin pool, so that a volume only
+// takes up what is written to it, and the pool's metadata says how much
+// that is.
+type LVMVolumeManager struct {
+	volumeGroup string
+	thinPool    string
+
+	// the size volumes are created at, until resized to a disk limit
+	defaultSize uint64
+
+	runner command_runner.CommandRunner
+}
+
+func NewLVM(runner command_runner.CommandRunner, volumeGroup, thinPool string, defaultSize uint64) *LVMVolumeManager {
+	return &LVMVolumeManager{
+		volumeGroup: volumeGroup,
+		thinPool:    thinPool,
+
+		defaultSize: defaultSize,
+
+		runner: runner,
+	}
+}
+
+func (m *LVMVolumeManager) Create(logger lager.Logger, id string, mountPoint string) error {
+	runner := logging.Runner{
+		Logger:        logger,
+		CommandRunner: m.runner,
+	}
+
+	err := runner.Run(exec.Command(
+		"lvcreate",
+		"--thin",
+		"--virtualsize", fmt.Sprintf("%db", m.defaultSize),
+		"--name", id,
+		m.volumeGroup+"/"+m.thinPool,
+	))
+	if err != nil {
+		return err
+	}
+
+	err = m.mountNew(runner, id, mountPoint)
+	if err != nil {
+		// the volume is not mounted, so can be removed
+		destroyErr := m.Destroy(logger, id)
+		if destroyErr != nil {
+			logger.Error("failed-to-remove-unmounted-volume", destroyErr)
+		}
+
+		return err
+	}
+
+	return nil
+}
+
+// mountNew makes a filesystem on a new volume and mounts it.
+func (m *LVMVolumeManager) mountNew(runner logging.Runner, id string, mountPoint string) error {
+	err := runner.Run(exec.Command("mkfs.ext4", "-q", m.device(id)))
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(mountPoint, 0755)
+	if err != nil {
+		return err
+	}
+
+	return runner.Run(exec.Command("mount", m.device(id), mountPoint))
+}
+
+func (m *LVMVolumeManager) Mount(logger lager.Logger, id string, mountPoint string) error {
+	runner := logging.Runner{
+		Logger:        logger,
+		CommandRunner: m.runner,
+	}
+
+	if runner.Run(exec.Command("mountpoint", "-q", mountPoint)) == nil {
+		return nil
+	}
+
+	// a thin volume is not activated with its pool after a reboot
+	err := runner.Run(exec.Command("lvchange", "--activate", "y", m.volumeGroup+"/"+id))
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(mountPoint, 0755)
+	if err != nil {
+		return err
+	}
+
+	return runner.Run(exec.Command("mount", m.device(id), mountPoint))
+}
+
+// Resize resizes the volume and its filesystem together. Filesystems can
+// only shrink while unmounted, so shrinking a container's volume fails.
+func (m *LVMVolumeManager) Resize(logger lager.Logger, id string, sizeInBytes uint64) error {
+	runner := logging.Runner{
+		Logger:        logger,
+		CommandRunner: m.runner,
+	}
+
+	return runner.Run(exec.Command(
+		"lvresize",
+		"--resizefs",
+		"--size", fmt.Sprintf("%db", sizeInBytes),
+		m.volumeGroup+"/"+id,
+	))
+}
+
+func (m *LVMVolumeManager) Usage(logger lager.Logger, id string) (api.ContainerDiskStat, error) {
+	lvs := exec.Command(
+		"lvs",
+		"--noheadings",
+		"--nosuffix",
+		"--units", "b",
+		"--options", "lv_size,data_percent",
+		m.volumeGroup+"/"+id,
+	)
+
+	out := new(bytes.Buffer)
+	lvs.Stdout = out
+
+	runner := logging.Runner{
+		Logger:        logger,
+		CommandRunner: m.runner,
+	}
+
+	err := runner.Run(lvs)
+	if err != nil {
+		return api.ContainerDiskStat{}, err
+	}
+
+	var size uint64
+	var dataPercent float64
+
+	_, err = fmt.Fscanf(out, "%d %f", &size, &dataPercent)
+	if err != nil {
+		return api.ContainerDiskStat{}, err
+	}
+
+	return api.ContainerDiskStat{
+		BytesUsed: uint64(float64(size) * dataPercent / 100),
+	}, nil
+}
+
+func (m *LVMVolumeManager) Destroy(logger lager.Logger, id string) error {
+	runner := logging.Runner{
+		Logger:        logger,
+		CommandRunner: m.runner,
+	}
+
+	return runner.Run(exec.Command("lvremove", "--force", m.volumeGroup+"/"+id))
+}
+
+func (m *LVMVolumeManager) device(id string) string {
+	return path.Join("/dev", m.volumeGroup, id)
+}
@@ -0,0 +1,13 @@
+package volume_manager_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"testing"
+)
+
+func TestVolume_manager(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Volume Manager Suite")
+}
@@ -0,0 +1,257 @@
+package volume_manager_test
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/pivotal-golang/lager/lagertest"
+
+	"github.com/cloudfoundry-incubator/garden-linux/old/linux_backend/volume_manager"
+	"github.com/cloudfoundry-incubator/garden/api"
+	"github.com/cloudfoundry/gunk/command_runner/fake_command_runner"
+	. "github.com/cloudfoundry/gunk/command_runner/fake_command_runner/matchers"
+)
+
+var _ = Describe("LVM volume manager", func() {
+	var fakeRunner *fake_command_runner.FakeCommandRunner
+	var logger *lagertest.TestLogger
+	var volumeManager *volume_manager.LVMVolumeManager
+
+	var mountPoint string
+
+	BeforeEach(func() {
+		fakeRunner = fake_command_runner.New()
+		logger = lagertest.NewTestLogger("test")
+		volumeManager = volume_manager.NewLVM(fakeRunner, "some-vg", "some-pool", 1073741824)
+
+		tmpdir, err := ioutil.TempDir("", "volume-manager")
+		Ω(err).ShouldNot(HaveOccurred())
+
+		mountPoint = path.Join(tmpdir, "some-id", "overlay")
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(path.Dir(path.Dir(mountPoint)))
+	})
+
+	Describe("creating a volume", func() {
+		It("creates a thin volume at the default size, makes a filesystem on it, and mounts it", func() {
+			err := volumeManager.Create(logger, "some-id", mountPoint)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(fakeRunner).Should(HaveExecutedSerially(
+				fake_command_runner.CommandSpec{
+					Path: "lvcreate",
+					Args: []string{
+						"--thin",
+						"--virtualsize", "1073741824b",
+						"--name", "some-id",
+						"some-vg/some-pool",
+					},
+				},
+				fake_command_runner.CommandSpec{
+					Path: "mkfs.ext4",
+					Args: []string{"-q", "/dev/some-vg/some-id"},
+				},
+				fake_command_runner.CommandSpec{
+					Path: "mount",
+					Args: []string{"/dev/some-vg/some-id", mountPoint},
+				},
+			))
+
+			info, err := os.Stat(mountPoint)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(info.IsDir()).Should(BeTrue())
+		})
+
+		Context("when creating the thin volume fails", func() {
+			disaster := errors.New("oh no!")
+
+			BeforeEach(func() {
+				fakeRunner.WhenRunning(
+					fake_command_runner.CommandSpec{
+						Path: "lvcreate",
+					}, func(*exec.Cmd) error {
+						return disaster
+					},
+				)
+			})
+
+			It("returns the error, without going on", func() {
+				err := volumeManager.Create(logger, "some-id", mountPoint)
+				Ω(err).Should(Equal(disaster))
+
+				Ω(fakeRunner).ShouldNot(HaveExecutedSerially(
+					fake_command_runner.CommandSpec{
+						Path: "mkfs.ext4",
+					},
+				))
+
+				Ω(fakeRunner).ShouldNot(HaveExecutedSerially(
+					fake_command_runner.CommandSpec{
+						Path: "lvremove",
+					},
+				))
+			})
+		})
+
+		for _, failing := range []string{"mkfs.ext4", "mount"} {
+			failing := failing
+
+			Context("when "+failing+" fails", func() {
+				disaster := errors.New("oh no!")
+
+				BeforeEach(func() {
+					fakeRunner.WhenRunning(
+						fake_command_runner.CommandSpec{
+							Path: failing,
+						}, func(*exec.Cmd) error {
+							return disaster
+						},
+					)
+				})
+
+				It("removes the volume, returning the error", func() {
+					err := volumeManager.Create(logger, "some-id", mountPoint)
+					Ω(err).Should(Equal(disaster))
+
+					Ω(fakeRunner).Should(HaveExecutedSerially(
+						fake_command_runner.CommandSpec{
+							Path: failing,
+						},
+						fake_command_runner.CommandSpec{
+							Path: "lvremove",
+							Args: []string{"--force", "some-vg/some-id"},
+						},
+					))
+				})
+			})
+		}
+	})
+
+	Describe("mounting a volume", func() {
+		Context("when it is still mounted", func() {
+			It("leaves it alone", func() {
+				err := volumeManager.Mount(logger, "some-id", mountPoint)
+				Ω(err).ShouldNot(HaveOccurred())
+
+				Ω(fakeRunner).ShouldNot(HaveExecutedSerially(
+					fake_command_runner.CommandSpec{
+						Path: "mount",
+					},
+				))
+			})
+		})
+
+		Context("when it is no longer mounted", func() {
+			BeforeEach(func() {
+				fakeRunner.WhenRunning(
+					fake_command_runner.CommandSpec{
+						Path: "mountpoint",
+					}, func(*exec.Cmd) error {
+						return errors.New("exit status 1")
+					},
+				)
+			})
+
+			It("activates and mounts it", func() {
+				err := volumeManager.Mount(logger, "some-id", mountPoint)
+				Ω(err).ShouldNot(HaveOccurred())
+
+				Ω(fakeRunner).Should(HaveExecutedSerially(
+					fake_command_runner.CommandSpec{
+						Path: "mountpoint",
+						Args: []string{"-q", mountPoint},
+					},
+					fake_command_runner.CommandSpec{
+						Path: "lvchange",
+						Args: []string{"--activate", "y", "some-vg/some-id"},
+					},
+					fake_command_runner.CommandSpec{
+						Path: "mount",
+						Args: []string{"/dev/some-vg/some-id", mountPoint},
+					},
+				))
+			})
+		})
+	})
+
+	Describe("resizing a volume", func() {
+		It("resizes it with its filesystem", func() {
+			err := volumeManager.Resize(logger, "some-id", 2147483648)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(fakeRunner).Should(HaveExecutedSerially(
+				fake_command_runner.CommandSpec{
+					Path: "lvresize",
+					Args: []string{"--resizefs", "--size", "2147483648b", "some-vg/some-id"},
+				},
+			))
+		})
+	})
+
+	Describe("getting a volume's usage", func() {
+		It("works it out from the thin pool's metadata", func() {
+			fakeRunner.WhenRunning(
+				fake_command_runner.CommandSpec{
+					Path: "lvs",
+					Args: []string{
+						"--noheadings",
+						"--nosuffix",
+						"--units", "b",
+						"--options", "lv_size,data_percent",
+						"some-vg/some-id",
+					},
+				}, func(cmd *exec.Cmd) error {
+					_, err := cmd.Stdout.Write([]byte("  1073741824 25.00\n"))
+					return err
+				},
+			)
+
+			usage, err := volumeManager.Usage(logger, "some-id")
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(usage).Should(Equal(api.ContainerDiskStat{
+				BytesUsed: 268435456,
+			}))
+		})
+
+		Context("when lvs fails", func() {
+			disaster := errors.New("oh no!")
+
+			BeforeEach(func() {
+				fakeRunner.WhenRunning(
+					fake_command_runner.CommandSpec{
+						Path: "lvs",
+					}, func(*exec.Cmd) error {
+						return disaster
+					},
+				)
+			})
+
+			It("returns the error", func() {
+				_, err := volumeManager.Usage(logger, "some-id")
+				Ω(err).Should(Equal(disaster))
+			})
+		})
+	})
+
+	Describe("destroying a volume", func() {
+		It("removes it", func() {
+			err := volumeManager.Destroy(logger, "some-id")
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(fakeRunner).Should(HaveExecutedSerially(
+				fake_command_runner.CommandSpec{
+					Path: "lvremove",
+					Args: []string{"--force", "some-vg/some-id"},
+				},
+			))
+		})
+	})
+})
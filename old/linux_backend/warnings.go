@@ -0,0 +1,30 @@
+package linux_backend
+
+import "github.com/pivotal-golang/lager"
+
+// WarningsPropertyPrefix reports in Info, as warnings.<n> counting from 1,
+// the guarantees a container was created without, e.g. disk quotas, so that
+// clients can record them; the create response has no place for them.
+const WarningsPropertyPrefix = "warnings."
+
+// Warn records that the container lacks a guarantee it would normally have.
+func (c *LinuxContainer) Warn(warning string) {
+	c.logger.Info("warning", lager.Data{
+		"warning": warning,
+	})
+
+	c.warningsMutex.Lock()
+	defer c.warningsMutex.Unlock()
+
+	c.warnings = append(c.warnings, warning)
+}
+
+func (c *LinuxContainer) Warnings() []string {
+	c.warningsMutex.RLock()
+	defer c.warningsMutex.RUnlock()
+
+	warnings := make([]string, len(c.warnings))
+	copy(warnings, c.warnings)
+
+	return warnings
+}
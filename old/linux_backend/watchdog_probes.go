@@ -0,0 +1,32 @@
+package linux_backend
+
+// WatchdogProbes returns probes of the backend's global locks, by name, each
+// returning once its lock can be taken. They only ever take the locks for
+// reading where they can, so as not to hold up anything themselves.
+func (b *LinuxBackend) WatchdogProbes() map[string]func() error {
+	return map[string]func() error{
+		"containers": func() error {
+			b.containers.mutex.RLock()
+			b.containers.mutex.RUnlock()
+			return nil
+		},
+
+		"commitments": func() error {
+			b.commitMutex.Lock()
+			b.commitMutex.Unlock()
+			return nil
+		},
+
+		"pressure": func() error {
+			b.pressureMutex.RLock()
+			b.pressureMutex.RUnlock()
+			return nil
+		},
+
+		"port-reservations": func() error {
+			b.reservedPortsMutex.Lock()
+			b.reservedPortsMutex.Unlock()
+			return nil
+		},
+	}
+}
@@ -0,0 +1,69 @@
+package logging
+
+import (
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/pivotal-golang/lager"
+)
+
+type UnknownLogLevelError struct {
+	Level string
+}
+
+func (e UnknownLogLevelError) Error() string {
+	return fmt.Sprintf("unknown log level: %s", e.Level)
+}
+
+// ParseLogLevel parses the levels that -logLevel takes: debug, info, error
+// or fatal.
+func ParseLogLevel(level string) (lager.LogLevel, error) {
+	switch level {
+	case "debug":
+		return lager.DEBUG, nil
+	case "info":
+		return lager.INFO, nil
+	case "error":
+		return lager.ERROR, nil
+	case "fatal":
+		return lager.FATAL, nil
+	default:
+		return 0, UnknownLogLevelError{level}
+	}
+}
+
+// LevelSink writes logs of at least its level, which, unlike lager's
+// writer sink's, can be changed while logging.
+type LevelSink struct {
+	writer   io.Writer
+	minLevel lager.LogLevel
+
+	mutex sync.Mutex
+}
+
+func NewLevelSink(writer io.Writer, minLevel lager.LogLevel) *LevelSink {
+	return &LevelSink{
+		writer:   writer,
+		minLevel: minLevel,
+	}
+}
+
+func (sink *LevelSink) SetMinLevel(minLevel lager.LogLevel) {
+	sink.mutex.Lock()
+	defer sink.mutex.Unlock()
+
+	sink.minLevel = minLevel
+}
+
+func (sink *LevelSink) Log(level lager.LogLevel, log []byte) {
+	sink.mutex.Lock()
+	defer sink.mutex.Unlock()
+
+	if level < sink.minLevel {
+		return
+	}
+
+	sink.writer.Write(log)
+	sink.writer.Write([]byte("\n"))
+}
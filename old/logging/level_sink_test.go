@@ -0,0 +1,68 @@
+package logging_test
+
+import (
+	"github.com/onsi/gomega/gbytes"
+	"github.com/pivotal-golang/lager"
+
+	. "github.com/cloudfoundry-incubator/garden-linux/old/logging"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("ParseLogLevel", func() {
+	It("parses the levels that lager logs at", func() {
+		for name, level := range map[string]lager.LogLevel{
+			"debug": lager.DEBUG,
+			"info":  lager.INFO,
+			"error": lager.ERROR,
+			"fatal": lager.FATAL,
+		} {
+			parsed, err := ParseLogLevel(name)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(parsed).Should(Equal(level))
+		}
+	})
+
+	Context("with an unknown level", func() {
+		It("returns an UnknownLogLevelError", func() {
+			_, err := ParseLogLevel("loud")
+			Ω(err).Should(Equal(UnknownLogLevelError{Level: "loud"}))
+		})
+	})
+})
+
+var _ = Describe("LevelSink", func() {
+	var buffer *gbytes.Buffer
+	var sink *LevelSink
+
+	BeforeEach(func() {
+		buffer = gbytes.NewBuffer()
+		sink = NewLevelSink(buffer, lager.INFO)
+	})
+
+	It("writes logs of at least its level, a line each", func() {
+		sink.Log(lager.INFO, []byte("hello"))
+		sink.Log(lager.ERROR, []byte("oops"))
+
+		Ω(string(buffer.Contents())).Should(Equal("hello\noops\n"))
+	})
+
+	It("drops logs below its level", func() {
+		sink.Log(lager.DEBUG, []byte("chatter"))
+
+		Ω(buffer.Contents()).Should(BeEmpty())
+	})
+
+	Describe("changing its level", func() {
+		It("writes logs of the new level from then on", func() {
+			sink.SetMinLevel(lager.DEBUG)
+			sink.Log(lager.DEBUG, []byte("chatter"))
+
+			sink.SetMinLevel(lager.ERROR)
+			sink.Log(lager.INFO, []byte("hello"))
+
+			Ω(string(buffer.Contents())).Should(Equal("chatter\n"))
+		})
+	})
+})
@@ -68,6 +68,14 @@ var _ = Describe("Logging", func() {
 		Ω(log.Data["argv"]).Should(Equal([]interface{}{"bash", "-c", "echo sup"}))
 	})
 
+	It("redacts sensitive environment variables from the argv", func() {
+		err := runner.Run(exec.Command("echo", "--env", "DB_PASSWORD=hunter2"))
+		Ω(err).ShouldNot(HaveOccurred())
+
+		log := logger.TestSink.Logs()[0]
+		Ω(log.Data["argv"]).Should(Equal([]interface{}{"echo", "--env", "DB_PASSWORD=[REDACTED]"}))
+	})
+
 	Describe("running a command that exits normally", func() {
 		It("logs its exit status with 'debug' level", func() {
 			err := runner.Run(exec.Command("true"))
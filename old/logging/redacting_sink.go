@@ -0,0 +1,135 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+
+	"github.com/pivotal-golang/lager"
+)
+
+// RedactingSink hides the values of environment variables and properties in
+// what is logged through it with the DefaultRedactor, as of each log, so
+// that requests logged by the garden server, e.g. creates and runs, do not
+// leak credentials. They are found, however deep in a log's data, under the
+// keys that the server's requests and specs carry them in.
+type RedactingSink struct {
+	sink lager.Sink
+}
+
+func NewRedactingSink(sink lager.Sink) *RedactingSink {
+	return &RedactingSink{sink: sink}
+}
+
+func (sink *RedactingSink) Log(level lager.LogLevel, log []byte) {
+	sink.sink.Log(level, DefaultRedactor.Log(log))
+}
+
+// Log returns a copy of a lager log with the redacted values replaced, or
+// the log as it is if none are.
+func (r Redactor) Log(log []byte) []byte {
+	decoder := json.NewDecoder(bytes.NewReader(log))
+	decoder.UseNumber()
+
+	var format lager.LogFormat
+
+	err := decoder.Decode(&format)
+	if err != nil || format.Data == nil {
+		return log
+	}
+
+	redacted := false
+	for key, value := range format.Data {
+		format.Data[key] = r.logged(key, value, &redacted)
+	}
+
+	if !redacted {
+		return log
+	}
+
+	return format.ToJSON()
+}
+
+// logged redacts a logged value found under the given key, and walks into
+// it for any that it contains.
+func (r Redactor) logged(key string, value interface{}, redacted *bool) interface{} {
+	switch strings.ToLower(key) {
+	case "env", "envvars":
+		return r.loggedVars(value, redacted)
+	case "properties":
+		return r.loggedProperties(value, redacted)
+	}
+
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for k, nested := range v {
+			v[k] = r.logged(k, nested, redacted)
+		}
+
+	case []interface{}:
+		for i, nested := range v {
+			v[i] = r.logged("", nested, redacted)
+		}
+	}
+
+	return value
+}
+
+// loggedVars redacts environment variables, logged either as KEY=VALUE
+// strings or, as in the garden protocol, as {"Key":..., "Value":...}.
+func (r Redactor) loggedVars(value interface{}, redacted *bool) interface{} {
+	vars, ok := value.([]interface{})
+	if !ok {
+		return value
+	}
+
+	for i, v := range vars {
+		switch variable := v.(type) {
+		case string:
+			vars[i] = r.envVar(variable)
+			if vars[i] != variable {
+				*redacted = true
+			}
+
+		case map[string]interface{}:
+			r.loggedPair(variable, redacted)
+		}
+	}
+
+	return vars
+}
+
+// loggedProperties redacts properties, logged either as a map or, as in the
+// garden protocol, as {"Key":..., "Value":...}.
+func (r Redactor) loggedProperties(value interface{}, redacted *bool) interface{} {
+	switch properties := value.(type) {
+	case map[string]interface{}:
+		for name := range properties {
+			if r.Redacts(name) {
+				properties[name] = Redacted
+				*redacted = true
+			}
+		}
+
+	case []interface{}:
+		for _, p := range properties {
+			if property, ok := p.(map[string]interface{}); ok {
+				r.loggedPair(property, redacted)
+			}
+		}
+	}
+
+	return value
+}
+
+func (r Redactor) loggedPair(pair map[string]interface{}, redacted *bool) {
+	name, ok := pair["Key"].(string)
+	if !ok || !r.Redacts(name) {
+		return
+	}
+
+	if _, hasValue := pair["Value"]; hasValue {
+		pair["Value"] = Redacted
+		*redacted = true
+	}
+}
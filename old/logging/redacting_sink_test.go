@@ -0,0 +1,146 @@
+package logging_test
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path"
+	"time"
+
+	"github.com/cloudfoundry-incubator/garden/api"
+	"github.com/cloudfoundry-incubator/garden/api/fakes"
+	"github.com/cloudfoundry-incubator/garden/client"
+	"github.com/cloudfoundry-incubator/garden/client/connection"
+	"github.com/cloudfoundry-incubator/garden/server"
+	"github.com/onsi/gomega/gbytes"
+	"github.com/pivotal-golang/lager"
+
+	. "github.com/cloudfoundry-incubator/garden-linux/old/logging"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("RedactingSink", func() {
+	var buffer *gbytes.Buffer
+	var logger lager.Logger
+
+	BeforeEach(func() {
+		buffer = gbytes.NewBuffer()
+
+		logger = lager.NewLogger("test")
+		logger.RegisterSink(NewRedactingSink(NewLevelSink(buffer, lager.DEBUG)))
+	})
+
+	logged := func() lager.LogFormat {
+		var log lager.LogFormat
+
+		err := json.Unmarshal(buffer.Contents(), &log)
+		Ω(err).ShouldNot(HaveOccurred())
+
+		return log
+	}
+
+	It("redacts environment variables logged as KEY=VALUE", func() {
+		logger.Info("running", lager.Data{
+			"spec": api.ProcessSpec{
+				Path: "/some/script",
+				Env:  []string{"DB_PASSWORD=hunter2", "HOME=/home/vcap"},
+			},
+		})
+
+		spec := logged().Data["spec"].(map[string]interface{})
+		Ω(spec["Env"]).Should(Equal([]interface{}{"DB_PASSWORD=" + Redacted, "HOME=/home/vcap"}))
+		Ω(spec["Path"]).Should(Equal("/some/script"))
+	})
+
+	It("redacts properties logged as a map", func() {
+		logger.Info("creating", lager.Data{
+			"properties": map[string]string{"api_token": "abc", "app": "some-app"},
+		})
+
+		Ω(logged().Data["properties"]).Should(Equal(map[string]interface{}{
+			"api_token": Redacted,
+			"app":       "some-app",
+		}))
+	})
+
+	It("leaves logs without anything to redact as they are", func() {
+		logger.Info("creating", lager.Data{"handle": "some-handle", "size": uint64(1<<63 + 1)})
+
+		Ω(buffer).Should(gbytes.Say(`"size":9223372036854775809`))
+	})
+
+	Context("when logging the garden server's requests", func() {
+		var tmpdir string
+
+		var serverBackend *fakes.FakeBackend
+		var fakeContainer *fakes.FakeContainer
+
+		var apiServer *server.GardenServer
+		var apiClient api.Client
+
+		BeforeEach(func() {
+			var err error
+
+			tmpdir, err = ioutil.TempDir("", "redacting-sink")
+			Ω(err).ShouldNot(HaveOccurred())
+
+			socketPath := path.Join(tmpdir, "api.sock")
+
+			fakeContainer = new(fakes.FakeContainer)
+			fakeContainer.HandleReturns("some-handle")
+
+			serverBackend = new(fakes.FakeBackend)
+			serverBackend.CreateReturns(fakeContainer, nil)
+			serverBackend.LookupReturns(fakeContainer, nil)
+
+			apiServer = server.New("unix", socketPath, time.Minute, serverBackend, logger)
+
+			err = apiServer.Start()
+			Ω(err).ShouldNot(HaveOccurred())
+
+			apiClient = client.New(connection.New("unix", socketPath))
+			Eventually(apiClient.Ping).ShouldNot(HaveOccurred())
+		})
+
+		AfterEach(func() {
+			apiServer.Stop()
+			os.RemoveAll(tmpdir)
+		})
+
+		It("redacts the environment and properties of creates", func() {
+			_, err := apiClient.Create(api.ContainerSpec{
+				Handle:     "some-handle",
+				Env:        []string{"DB_PASSWORD=hunter2", "HOME=/home/vcap"},
+				Properties: api.Properties{"api_token": "abc", "app": "some-app"},
+			})
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(buffer).Should(gbytes.Say("garden-server.create"))
+			Ω(buffer.Contents()).ShouldNot(ContainSubstring("hunter2"))
+			Ω(buffer.Contents()).ShouldNot(ContainSubstring(`"abc"`))
+			Ω(buffer.Contents()).Should(ContainSubstring("/home/vcap"))
+			Ω(buffer.Contents()).Should(ContainSubstring("some-app"))
+		})
+
+		It("redacts the environment of runs", func() {
+			fakeProcess := new(fakes.FakeProcess)
+			fakeProcess.IDReturns(42)
+			fakeContainer.RunReturns(fakeProcess, nil)
+
+			container, err := apiClient.Create(api.ContainerSpec{Handle: "some-handle"})
+			Ω(err).ShouldNot(HaveOccurred())
+
+			_, err = container.Run(api.ProcessSpec{
+				Path: "/some/script",
+				Env:  []string{"DB_PASSWORD=hunter2"},
+			}, api.ProcessIO{})
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Eventually(buffer).Should(gbytes.Say("garden-server.run.spawned"))
+			Ω(buffer.Contents()).ShouldNot(ContainSubstring("hunter2"))
+			Ω(buffer.Contents()).Should(ContainSubstring("DB_PASSWORD=" + Redacted))
+		})
+	})
+})
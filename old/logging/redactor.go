@@ -0,0 +1,118 @@
+package logging
+
+import "strings"
+
+// Redacted replaces the values that a Redactor hides.
+const Redacted = "[REDACTED]"
+
+// DefaultSensitiveKeys are the fragments of environment variable and
+// property names whose values are redacted by default.
+var DefaultSensitiveKeys = []string{
+	"password",
+	"passwd",
+	"secret",
+	"token",
+	"key",
+	"credential",
+	"auth",
+}
+
+// Redactor hides the values of environment variables and properties, which
+// often carry service credentials, from logs.
+type Redactor struct {
+	// names containing any of these, ignoring case, are redacted
+	SensitiveKeys []string
+
+	// if non-nil, the values of names not in it are redacted too
+	Allowlist []string
+}
+
+// DefaultRedactor is used for everything the server logs. It is set once,
+// from the server's flags, before anything is logged.
+var DefaultRedactor = Redactor{SensitiveKeys: DefaultSensitiveKeys}
+
+// Redacts says whether the value of the named variable or property is
+// hidden.
+func (r Redactor) Redacts(name string) bool {
+	if r.Allowlist != nil && !contains(r.Allowlist, name) {
+		return true
+	}
+
+	lower := strings.ToLower(name)
+
+	for _, key := range r.SensitiveKeys {
+		if key != "" && strings.Contains(lower, strings.ToLower(key)) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Env returns a copy of the KEY=VALUE environment variables with the
+// redacted values replaced.
+func (r Redactor) Env(vars []string) []string {
+	if vars == nil {
+		return nil
+	}
+
+	redacted := make([]string, len(vars))
+	for i, v := range vars {
+		redacted[i] = r.envVar(v)
+	}
+
+	return redacted
+}
+
+// Properties returns a copy of the properties with the redacted values
+// replaced.
+func (r Redactor) Properties(properties map[string]string) map[string]string {
+	if properties == nil {
+		return nil
+	}
+
+	redacted := map[string]string{}
+	for name, value := range properties {
+		if r.Redacts(name) {
+			value = Redacted
+		}
+
+		redacted[name] = value
+	}
+
+	return redacted
+}
+
+// Argv returns a copy of a command's arguments with the values of
+// environment variables passed as --env KEY=VALUE, as to wsh, redacted.
+func (r Redactor) Argv(argv []string) []string {
+	redacted := make([]string, len(argv))
+	copy(redacted, argv)
+
+	for i := 1; i < len(redacted); i++ {
+		if redacted[i-1] == "--env" {
+			redacted[i] = r.envVar(redacted[i])
+		}
+	}
+
+	return redacted
+}
+
+func (r Redactor) envVar(v string) string {
+	segs := strings.SplitN(v, "=", 2)
+	if len(segs) != 2 || !r.Redacts(segs[0]) {
+		return v
+	}
+
+	return segs[0] + "=" + Redacted
+}
+
+func contains(names []string, name string) bool {
+	for _, n := range names {
+		if n == name {
+			return true
+		}
+	}
+
+	return false
+}
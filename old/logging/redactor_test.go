@@ -0,0 +1,105 @@
+package logging_test
+
+import (
+	. "github.com/cloudfoundry-incubator/garden-linux/old/logging"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Redactor", func() {
+	var redactor Redactor
+
+	BeforeEach(func() {
+		redactor = Redactor{SensitiveKeys: DefaultSensitiveKeys}
+	})
+
+	It("redacts names containing a sensitive key, ignoring case", func() {
+		Ω(redactor.Redacts("DB_PASSWORD")).Should(BeTrue())
+		Ω(redactor.Redacts("aws_secret_access_key")).Should(BeTrue())
+		Ω(redactor.Redacts("GITHUB_TOKEN")).Should(BeTrue())
+
+		Ω(redactor.Redacts("PATH")).Should(BeFalse())
+		Ω(redactor.Redacts("PORT")).Should(BeFalse())
+	})
+
+	It("redacts the values of sensitive environment variables", func() {
+		Ω(redactor.Env([]string{
+			"PORT=8080",
+			"DB_PASSWORD=hunter2",
+			"EMPTY_TOKEN=",
+			"malformed",
+		})).Should(Equal([]string{
+			"PORT=8080",
+			"DB_PASSWORD=[REDACTED]",
+			"EMPTY_TOKEN=[REDACTED]",
+			"malformed",
+		}))
+	})
+
+	It("does not modify the given environment", func() {
+		env := []string{"DB_PASSWORD=hunter2"}
+
+		redactor.Env(env)
+
+		Ω(env).Should(Equal([]string{"DB_PASSWORD=hunter2"}))
+	})
+
+	It("redacts the values of sensitive properties", func() {
+		Ω(redactor.Properties(map[string]string{
+			"owner":        "executor",
+			"api_key":      "abc123",
+			"network.tun":  "true",
+			"service.auth": "basic",
+		})).Should(Equal(map[string]string{
+			"owner":        "executor",
+			"api_key":      Redacted,
+			"network.tun":  "true",
+			"service.auth": Redacted,
+		}))
+	})
+
+	It("redacts environment variables passed as --env in argv", func() {
+		Ω(redactor.Argv([]string{
+			"/depot/some-id/bin/wsh",
+			"--user", "vcap",
+			"--env", "PORT=8080",
+			"--env", "DB_PASSWORD=hunter2",
+			"/bin/echo", "DB_PASSWORD=not-an-env-var",
+		})).Should(Equal([]string{
+			"/depot/some-id/bin/wsh",
+			"--user", "vcap",
+			"--env", "PORT=8080",
+			"--env", "DB_PASSWORD=[REDACTED]",
+			"/bin/echo", "DB_PASSWORD=not-an-env-var",
+		}))
+	})
+
+	Context("with an allowlist", func() {
+		BeforeEach(func() {
+			redactor.Allowlist = []string{"PORT", "owner", "API_TOKEN"}
+		})
+
+		It("redacts everything not in it", func() {
+			Ω(redactor.Env([]string{
+				"PORT=8080",
+				"HOME=/home/vcap",
+			})).Should(Equal([]string{
+				"PORT=8080",
+				"HOME=[REDACTED]",
+			}))
+
+			Ω(redactor.Properties(map[string]string{
+				"owner": "executor",
+				"zone":  "z1",
+			})).Should(Equal(map[string]string{
+				"owner": "executor",
+				"zone":  Redacted,
+			}))
+		})
+
+		It("still redacts sensitive names in it", func() {
+			Ω(redactor.Redacts("API_TOKEN")).Should(BeTrue())
+		})
+	})
+})
@@ -34,7 +34,7 @@ func (runner *Runner) Run(cmd *exec.Cmd) error {
 	}
 
 	rLog := runner.Logger.Session("command", lager.Data{
-		"argv": cmd.Args,
+		"argv": DefaultRedactor.Argv(cmd.Args),
 	})
 
 	started := time.Now()
@@ -1,17 +1,20 @@
 package old
 
 import (
-	"bytes"
 	"flag"
 	"fmt"
+	"io/ioutil"
 	"math"
 	"net"
+	"net/http"
+	"net/rpc"
 	"os"
-	"os/exec"
 	"os/signal"
+	"path/filepath"
 	"runtime"
 	"strings"
 	"syscall"
+	"time"
 
 	"github.com/docker/docker/daemon/graphdriver"
 	_ "github.com/docker/docker/daemon/graphdriver/aufs"
@@ -21,19 +24,40 @@ import (
 	"github.com/pivotal-golang/lager"
 
 	"github.com/cloudfoundry-incubator/cf-debug-server"
-	"github.com/cloudfoundry-incubator/cf-lager"
+	_ "github.com/cloudfoundry-incubator/cf-lager" // for -logLevel
+	"github.com/cloudfoundry-incubator/garden-linux/old/admin"
 	"github.com/cloudfoundry-incubator/garden-linux/old/linux_backend"
+	"github.com/cloudfoundry-incubator/garden-linux/old/linux_backend/bounded_runner"
+	"github.com/cloudfoundry-incubator/garden-linux/old/linux_backend/cgroups_manager"
 	"github.com/cloudfoundry-incubator/garden-linux/old/linux_backend/container_pool"
 	"github.com/cloudfoundry-incubator/garden-linux/old/linux_backend/container_pool/repository_fetcher"
 	"github.com/cloudfoundry-incubator/garden-linux/old/linux_backend/container_pool/rootfs_provider"
+	"github.com/cloudfoundry-incubator/garden-linux/old/linux_backend/external_ip_pool"
+	"github.com/cloudfoundry-incubator/garden-linux/old/linux_backend/iptables_writer"
+	"github.com/cloudfoundry-incubator/garden-linux/old/linux_backend/network_plugin"
 	"github.com/cloudfoundry-incubator/garden-linux/old/linux_backend/network_pool"
+	"github.com/cloudfoundry-incubator/garden-linux/old/linux_backend/numa_placer"
 	"github.com/cloudfoundry-incubator/garden-linux/old/linux_backend/port_pool"
+	"github.com/cloudfoundry-incubator/garden-linux/old/linux_backend/privileged_runner"
 	"github.com/cloudfoundry-incubator/garden-linux/old/linux_backend/quota_manager"
+	"github.com/cloudfoundry-incubator/garden-linux/old/linux_backend/selinux_labeler"
+	"github.com/cloudfoundry-incubator/garden-linux/old/linux_backend/snapshot_store"
+	"github.com/cloudfoundry-incubator/garden-linux/old/linux_backend/snapshot_uploader"
 	"github.com/cloudfoundry-incubator/garden-linux/old/linux_backend/uid_pool"
+	"github.com/cloudfoundry-incubator/garden-linux/old/linux_backend/volume_manager"
+	"github.com/cloudfoundry-incubator/garden-linux/old/logging"
+	"github.com/cloudfoundry-incubator/garden-linux/old/maintenance"
+	"github.com/cloudfoundry-incubator/garden-linux/old/reloadable"
 	"github.com/cloudfoundry-incubator/garden-linux/old/sysconfig"
 	"github.com/cloudfoundry-incubator/garden-linux/old/system_info"
+	"github.com/cloudfoundry-incubator/garden-linux/old/usage_exporter"
+	"github.com/cloudfoundry-incubator/garden-linux/old/watchdog"
+	"github.com/cloudfoundry-incubator/garden/client"
+	"github.com/cloudfoundry-incubator/garden/client/connection"
 	"github.com/cloudfoundry-incubator/garden/server"
-	_ "github.com/cloudfoundry/dropsonde/autowire"
+	"github.com/cloudfoundry/dropsonde/autowire"
+	"github.com/cloudfoundry/dropsonde/metric_sender"
+	"github.com/cloudfoundry/gunk/command_runner"
 	"github.com/cloudfoundry/gunk/command_runner/linux_command_runner"
 )
 
@@ -52,7 +76,13 @@ var listenAddr = flag.String(
 var snapshotsPath = flag.String(
 	"snapshots",
 	"",
-	"directory in which to store container state to persist through restarts",
+	"directory in which to store container state to persist through restarts, or database file with -snapshotStore=bolt",
+)
+
+var snapshotStoreKind = flag.String(
+	"snapshotStore",
+	"file",
+	"how -snapshots stores container state: file, a file per container, or bolt, a BoltDB database checked for corruption and compacted on start",
 )
 
 var binPath = flag.String(
@@ -85,6 +115,30 @@ var disableQuotas = flag.Bool(
 	"disable disk quotas",
 )
 
+var diskUsageCacheTTL = flag.Duration(
+	"diskUsageCacheTTL",
+	5*time.Second,
+	"how long to reuse a container's disk usage before querying quotas again; 0 to always query",
+)
+
+var lvmVolumeGroup = flag.String(
+	"lvmVolumeGroup",
+	"",
+	"LVM volume group holding -lvmThinPool; if set, each container's writable storage is a thin volume of its own",
+)
+
+var lvmThinPool = flag.String(
+	"lvmThinPool",
+	"garden",
+	"LVM thin pool to create containers' volumes in",
+)
+
+var lvmVolumeSize = flag.Uint64(
+	"lvmVolumeSize",
+	10*1024*1024*1024,
+	"size in bytes containers' volumes are created at, until their disk limit is set",
+)
+
 var containerGraceTime = flag.Duration(
 	"containerGraceTime",
 	0,
@@ -97,6 +151,66 @@ var networkPool = flag.String(
 	"network pool CIDR for containers; each container will get a /30",
 )
 
+var reservedNetworks = flag.String(
+	"reservedNetworks",
+	"",
+	"comma-separated CIDRs or IPs within the network pools that are never given to containers",
+)
+
+var networkPoolStrategy = flag.String(
+	"networkPoolStrategy",
+	"lru",
+	"which free network containers get next: lru (free the longest) or random",
+)
+
+var networkPoolWaitTimeout = flag.Duration(
+	"networkPoolWaitTimeout",
+	0,
+	"how long creates wait for a network to be released when the network pool is exhausted (0 fails immediately)",
+)
+
+var additionalNetworkPools = flag.String(
+	"additionalNetworkPools",
+	"",
+	"comma-separated network pool CIDRs (at most 4) from each of which every container will get an additional /30, e.g. for management traffic",
+)
+
+var networkPluginPath = flag.String(
+	"networkPlugin",
+	"",
+	"path to a binary to run as each container's network is erected, rebuilt and dismantled",
+)
+
+var networkPluginBuildsLinks = flag.Bool(
+	"networkPluginBuildsLinks",
+	false,
+	"have the network plugin build each container's links once it has started, instead of veth pairs to it from the host; network usage, captures, bandwidth limits, net in and net out, which use the veth pairs, are then unavailable, and the plugin must filter containers' traffic itself",
+)
+
+var validateRestoredNetworks = flag.Bool(
+	"validateRestoredNetworks",
+	false,
+	"check that restored containers' network interfaces still exist, flagging those that do not",
+)
+
+var externalIPs = flag.String(
+	"externalIPs",
+	"",
+	"comma-separated IPs, routed to this host, which containers may request for 1:1 NAT",
+)
+
+var dnsServers = flag.String(
+	"dnsServers",
+	"",
+	"comma-separated nameservers (at most 3) written to containers' /etc/resolv.conf, unless they request their own with the network.dns_servers property, rather than copying the host's",
+)
+
+var dnsSearchDomains = flag.String(
+	"dnsSearchDomains",
+	"",
+	"comma-separated search domains written to containers' /etc/resolv.conf, unless they request their own with the network.dns_search_domains property",
+)
+
 var portPoolStart = flag.Uint(
 	"portPoolStart",
 	61001,
@@ -133,6 +247,36 @@ var allowNetworks = flag.String(
 	"CIDR blocks representing IPs to whitelist",
 )
 
+var logRedactKeys = flag.String(
+	"logRedactKeys",
+	strings.Join(logging.DefaultSensitiveKeys, ","),
+	"comma-separated fragments of environment variable and property names whose values are redacted from logs",
+)
+
+var logEnvAllowlist = flag.String(
+	"logEnvAllowlist",
+	"",
+	"comma-separated environment variable and property names whose values may be logged; if set, all others are redacted",
+)
+
+var deviceWhitelist = flag.String(
+	"deviceWhitelist",
+	cgroups_manager.FormatDeviceRules(cgroups_manager.DefaultDeviceRules),
+	"comma-separated devices cgroup rules (e.g. 'c 10:229 rwm') for the devices containers may use; all others are denied, except /dev/net/tun and /dev/fuse for containers created with the network.tun and filesystem.fuse properties",
+)
+
+var numaPlacement = flag.String(
+	"numaPlacement",
+	"",
+	"confine each container to one NUMA node's CPUs and memory: spread (the node with the fewest containers) or round-robin; empty lets containers use every node",
+)
+
+var numaNodesPath = flag.String(
+	"numaNodesPath",
+	"/sys/devices/system/node",
+	"where the host's NUMA nodes are listed",
+)
+
 var graphRoot = flag.String(
 	"graph",
 	"/var/lib/garden-docker-graph",
@@ -145,10 +289,391 @@ var dockerRegistry = flag.String(
 	"docker registry API endpoint",
 )
 
+var registryCACert = flag.String(
+	"registryCACert",
+	"",
+	"CA certificate bundle to trust when talking to the docker registry",
+)
+
+var registryClientCert = flag.String(
+	"registryClientCert",
+	"",
+	"client certificate to present to the docker registry",
+)
+
+var registryClientKey = flag.String(
+	"registryClientKey",
+	"",
+	"key for the client certificate presented to the docker registry",
+)
+
+var registryTLSOverrides = flag.String(
+	"registryTLSOverrides",
+	"",
+	"directory of per-registry TLS files, in subdirectories named by registry host, each with ca.crt and/or client.cert and client.key",
+)
+
+var registryFetchAttempts = flag.Int(
+	"registryFetchAttempts",
+	repository_fetcher.DefaultAttempts,
+	"number of times to try fetching a docker image before giving up",
+)
+
+var registryFetchBackoff = flag.String(
+	"registryFetchBackoff",
+	"",
+	"comma-separated durations to wait after each failed docker image fetch; the last is reused for later attempts",
+)
+
+var registryRetryServerErrorsOnly = flag.Bool(
+	"registryRetryServerErrorsOnly",
+	false,
+	"do not retry docker image fetches that the registry rejected with a 4xx response",
+)
+
+var registryCredentialHelper = flag.String(
+	"registryCredentialHelper",
+	"",
+	"docker-credential-* compatible executable to ask for registry credentials on each image fetch",
+)
+
+var dockerCacheFirst = flag.Bool(
+	"dockerCacheFirst",
+	false,
+	"use the image a docker tag was last fetched as without asking the registry again",
+)
+
+var failOnStalePull = flag.Bool(
+	"failOnStalePull",
+	false,
+	"fail creates when the registry cannot be reached, rather than using the image a docker tag was last fetched as",
+)
+
+var skipHostSetup = flag.Bool(
+	"skipHostSetup",
+	false,
+	"assume the host has been set up by running with the setup argument, e.g. as root at boot, rather than setting it up on start",
+)
+
+var privilegedHelperSocket = flag.String(
+	"privilegedHelperSocket",
+	"",
+	"unix socket of a helper, run with the privileged-helper argument as root, that carries out the backend's scripts, iptables and quotas for the server; the server must still run as root",
+)
+
 var tag = flag.String(
 	"tag",
 	"",
-	"server-wide identifier used for 'global' configuration",
+	"server-wide identifier used for 'global' configuration; at most 4 letters and digits, and unique among servers on the host",
+)
+
+var startVerificationAttempts = flag.Int(
+	"startVerificationAttempts",
+	3,
+	"number of times to check that a new container's wshd and network work before failing its creation (0 to disable)",
+)
+
+var startVerificationInterval = flag.Duration(
+	"startVerificationInterval",
+	500*time.Millisecond,
+	"interval between checks of a new container",
+)
+
+var daemonCheckInterval = flag.Duration(
+	"daemonCheckInterval",
+	time.Minute,
+	"interval at which to check that each container's wshd is still running, marking those that are not as broken (0 to disable)",
+)
+
+var destroyDeadContainers = flag.Bool(
+	"destroyDeadContainers",
+	false,
+	"destroy containers whose wshd has died, rather than leaving them broken",
+)
+
+var reapInBackground = flag.Bool(
+	"reapInBackground",
+	false,
+	"remove destroyed containers' files in the background, at idle IO priority, rather than while destroying them",
+)
+
+var reapInterval = flag.Duration(
+	"reapInterval",
+	time.Second,
+	"least time between removing each destroyed container's files in the background",
+)
+
+var maintenanceWindows = flag.String(
+	"maintenanceWindows",
+	"",
+	"comma-separated daily HH:MM-HH:MM windows, in the server's time zone, to which heavy maintenance is confined, at idle IO priority; with -reapInBackground, destroyed containers' files are only removed in them",
+)
+
+var maintenanceCheckInterval = flag.Duration(
+	"maintenanceCheckInterval",
+	time.Minute,
+	"interval at which to check whether a maintenance window has opened",
+)
+
+var hardenProcSys = flag.Bool(
+	"hardenProcSys",
+	false,
+	"mount containers' /proc with hidepid=2, mask /proc/kcore, /proc/sys and /sys/firmware, and keep any /sys read-only, unless a container opts out with the security.harden_proc_sys property",
+)
+
+var appArmorProfile = flag.String(
+	"appArmorProfile",
+	"",
+	"AppArmor profile to confine containers' processes with, on hosts with AppArmor, unless they select another with the security.apparmor_profile property; the profiles shipped in the bin path, e.g. garden-default, are loaded at startup (empty to disable AppArmor on the host instead)",
+)
+
+var selinuxLabels = flag.Bool(
+	"selinuxLabels",
+	false,
+	"label each container's rootfs and processes with SELinux MCS categories of its own, so that containers cannot access each other's files; the host must have SELinux enabled; containers with docker:// rootfses, which cannot be labelled, are refused",
+)
+
+var selinuxProcessContext = flag.String(
+	"selinuxProcessContext",
+	selinux_labeler.DefaultProcessContext,
+	"SELinux context, without categories, that containers' processes run in with -selinuxLabels",
+)
+
+var selinuxFileContext = flag.String(
+	"selinuxFileContext",
+	selinux_labeler.DefaultFileContext,
+	"SELinux context, without categories, that containers' rootfses are labelled with, with -selinuxLabels",
+)
+
+var containerIDScheme = flag.String(
+	"containerIDScheme",
+	"timestamp",
+	"what new containers' IDs look like: timestamp (short, but only unique while the server runs) or random (20 random digits)",
+)
+
+var containerIDPrefix = flag.String(
+	"containerIDPrefix",
+	"",
+	"prefix for new containers' IDs, such as the cell's name, so that they can be told apart across hosts",
+)
+
+var adminAddr = flag.String(
+	"adminAddr",
+	"",
+	"host:port for serving operator calls such as growing pools (unauthenticated; listen locally)",
+)
+
+var poolReportInterval = flag.Duration(
+	"poolReportInterval",
+	30*time.Second,
+	"interval at which to report the utilization of the uid, network and port pools (0 to disable)",
+)
+
+var poolLowWatermark = flag.Float64(
+	"poolLowWatermark",
+	0.1,
+	"fraction of a pool that must be free before warnings are logged",
+)
+
+var pressureCheckInterval = flag.Duration(
+	"pressureCheckInterval",
+	10*time.Second,
+	"interval at which to check the host's free memory and disk against the pressure thresholds (0 to disable)",
+)
+
+var minFreeMemoryMB = flag.Uint64(
+	"minFreeMemoryMB",
+	0,
+	"free host memory below which new containers are rejected (0 to disable)",
+)
+
+var minFreeDiskMB = flag.Uint64(
+	"minFreeDiskMB",
+	0,
+	"free disk in the depot below which new containers are rejected (0 to disable)",
+)
+
+var memoryOvercommitFactor = flag.Float64(
+	"memoryOvercommitFactor",
+	0,
+	"multiple of the host's memory that containers' memory limits may commit in total (0 to disable)",
+)
+
+var diskOvercommitFactor = flag.Float64(
+	"diskOvercommitFactor",
+	0,
+	"multiple of the depot's disk that containers' disk limits may commit in total (0 to disable)",
+)
+
+var usageSampleInterval = flag.Duration(
+	"usageSampleInterval",
+	10*time.Second,
+	"interval at which to record each container's CPU and memory usage (0 to disable)",
+)
+
+var usageHistorySize = flag.Int(
+	"usageHistorySize",
+	60,
+	"number of usage samples to keep for each container",
+)
+
+var usageExportInterval = flag.Duration(
+	"usageExportInterval",
+	0,
+	"interval at which to export what each container used, for billing, to -usageExportFile or -usageExportURL (0 to disable)",
+)
+
+var usageExportFile = flag.String(
+	"usageExportFile",
+	"",
+	"file to append exported usage records to",
+)
+
+var usageExportURL = flag.String(
+	"usageExportURL",
+	"",
+	"URL to POST exported usage records to",
+)
+
+var usageExportFormat = flag.String(
+	"usageExportFormat",
+	"json",
+	"format of exported usage records: csv or json (one object per line)",
+)
+
+var usageExportState = flag.String(
+	"usageExportState",
+	"",
+	"file in which usage records not yet exported are kept across restarts (required with -usageExportInterval)",
+)
+
+var usageExportMaxPending = flag.Int(
+	"usageExportMaxPending",
+	100000,
+	"most usage records kept while they cannot be exported; the oldest are dropped beyond it",
+)
+
+var snapshotBackupInterval = flag.Duration(
+	"snapshotBackupInterval",
+	0,
+	"interval at which changed container snapshots, reserved ports and the boot ID are uploaded to -snapshotBackupURL, and on stopping (0 to disable)",
+)
+
+var snapshotBackupTarget = flag.String(
+	"snapshotBackupTarget",
+	"webdav",
+	"kind of store snapshots are backed up to: webdav or s3",
+)
+
+var snapshotBackupURL = flag.String(
+	"snapshotBackupURL",
+	"",
+	"URL of the WebDAV collection, or path-style S3 bucket URL with an optional prefix, to back up snapshots to",
+)
+
+var snapshotBackupRegion = flag.String(
+	"snapshotBackupRegion",
+	"us-east-1",
+	"region S3 requests are signed for",
+)
+
+var snapshotBackupCredentials = flag.String(
+	"snapshotBackupCredentials",
+	"",
+	"file holding the WebDAV username and password, or S3 access key ID and secret, as id:secret",
+)
+
+var coreDumpMaxBytes = flag.Uint64(
+	"coreDumpMaxBytes",
+	0,
+	"keep core dumps of container processes, truncated to this size, streamable from "+linux_backend.CoreDumpsPath+" in the container (0 leaves the host's core pattern alone)",
+)
+
+// where the host's core pattern is set, when core dumps are enabled
+const corePatternPath = "/proc/sys/kernel/core_pattern"
+
+var coreDumpMaxCount = flag.Uint(
+	"coreDumpMaxCount",
+	10,
+	"most core dumps kept per container; any more are discarded",
+)
+
+var coreDumpHostPath = flag.String(
+	"coreDumpHostPath",
+	"/var/crash/garden-linux",
+	"directory in which to keep core dumps of host processes, with the same caps, while container core dumps are enabled",
+)
+
+var coreDumpCheckInterval = flag.Duration(
+	"coreDumpCheckInterval",
+	10*time.Second,
+	"interval at which new core dumps are reported as container events",
+)
+
+var defaultRLimitNofile = flag.Int64(
+	"defaultRLimitNofile",
+	-1,
+	"RLIMIT_NOFILE for container processes that do not set their own (-1 to leave unset)",
+)
+
+var defaultRLimitNproc = flag.Int64(
+	"defaultRLimitNproc",
+	-1,
+	"RLIMIT_NPROC for container processes that do not set their own (-1 to leave unset)",
+)
+
+var defaultRLimitCore = flag.Int64(
+	"defaultRLimitCore",
+	-1,
+	"RLIMIT_CORE for container processes that do not set their own (-1 to leave unset)",
+)
+
+var networkReconcileInterval = flag.Duration(
+	"networkReconcileInterval",
+	time.Minute,
+	"interval at which to verify and re-install containers' iptables rules (0 to disable)",
+)
+
+var commandTimeout = flag.Duration(
+	"commandTimeout",
+	0,
+	"how long scripts and tools run to completion may take before they are killed (0 to wait forever)",
+)
+
+var commandTimeouts = flag.String(
+	"commandTimeouts",
+	"",
+	"comma-separated NAME=DURATION timeouts for particular commands by base name, overriding -commandTimeout, e.g. 'df=30s,stop.sh=2m'",
+)
+
+var commandOutputLimit = flag.Int(
+	"commandOutputLimit",
+	1024*1024,
+	"bytes of each of a command's stdout and stderr kept in memory; the rest is discarded, without failing the command (0 for no limit)",
+)
+
+var watchdogInterval = flag.Duration(
+	"watchdogInterval",
+	30*time.Second,
+	"interval at which to check that the server and its global locks are responsive (0 to disable)",
+)
+
+var watchdogTimeout = flag.Duration(
+	"watchdogTimeout",
+	time.Minute,
+	"how long the server or one of its global locks may be unresponsive before it is reported stuck",
+)
+
+var watchdogExit = flag.Bool(
+	"watchdogExit",
+	false,
+	"exit with status 70 when the server is stuck, for a supervisor to restart it and restore its containers",
+)
+
+var reloadableConfig = flag.String(
+	"reloadableConfig",
+	"",
+	"JSON file of LogLevel, DenyNetworks, AllowNetworks, RegistryCredentialHelper and DefaultRLimits, overriding their flags, reloaded on SIGHUP rather than SIGHUP stopping the server",
 )
 
 var mtu = flag.Uint64(
@@ -157,6 +682,10 @@ var mtu = flag.Uint64(
 	"MTU size for container network interfaces",
 )
 
+// Version is annotated on the containers this server creates. Builds set it
+// with -ldflags "-X github.com/cloudfoundry-incubator/garden-linux/old.Version <version>".
+var Version = "dev"
+
 func Main() {
 	flag.Parse()
 
@@ -164,7 +693,46 @@ func Main() {
 
 	runtime.GOMAXPROCS(runtime.NumCPU())
 
-	logger := cf_lager.New("garden-linux")
+	logLevel, err := logging.ParseLogLevel(flag.Lookup("logLevel").Value.String())
+	if err != nil {
+		panic(err)
+	}
+
+	logSink := logging.NewLevelSink(os.Stdout, logLevel)
+
+	logger := lager.NewLogger("garden-linux")
+	logger.RegisterSink(logging.NewRedactingSink(logSink))
+
+	settingsFromFlags := reloadable.Config{
+		LogLevel:                 flag.Lookup("logLevel").Value.String(),
+		DenyNetworks:             strings.Split(*denyNetworks, ","),
+		AllowNetworks:            strings.Split(*allowNetworks, ","),
+		RegistryCredentialHelper: *registryCredentialHelper,
+		DefaultRLimits: reloadable.RLimits{
+			Nofile: defaultRLimit(*defaultRLimitNofile),
+			Nproc:  defaultRLimit(*defaultRLimitNproc),
+			Core:   defaultRLimit(*defaultRLimitCore),
+		},
+	}
+
+	settings := settingsFromFlags
+	if *reloadableConfig != "" {
+		settings, err = reloadable.Load(*reloadableConfig, settingsFromFlags)
+		if err != nil {
+			logger.Fatal("failed-to-load-reloadable-config", err)
+		}
+
+		logLevel, _ = logging.ParseLogLevel(settings.LogLevel)
+		logSink.SetMinLevel(logLevel)
+	}
+
+	logging.DefaultRedactor = logging.Redactor{
+		SensitiveKeys: strings.Split(*logRedactKeys, ","),
+	}
+
+	if *logEnvAllowlist != "" {
+		logging.DefaultRedactor.Allowlist = strings.Split(*logEnvAllowlist, ",")
+	}
 
 	if *binPath == "" {
 		missing("-bin")
@@ -180,24 +748,240 @@ func Main() {
 
 	uidPool := uid_pool.New(uint32(*uidPoolStart), uint32(*uidPoolSize))
 
+	hostUIDs, err := uid_pool.HostUIDs("/etc/passwd", "/proc")
+	if err != nil {
+		logger.Error("failed-to-check-host-uids", err)
+	} else if conflicts := uidPool.Exclude(hostUIDs); len(conflicts) > 0 {
+		logger.Info("skipping-uids-used-by-host", lager.Data{
+			"uids": conflicts,
+		})
+	}
+
 	_, ipNet, err := net.ParseCIDR(*networkPool)
 	if err != nil {
 		logger.Fatal("malformed-network-pool", err)
 	}
 
-	networkPool := network_pool.New(ipNet)
+	strategy, err := network_pool.ParseAllocationStrategy(*networkPoolStrategy)
+	if err != nil {
+		logger.Fatal("malformed-network-pool-strategy", err)
+	}
+
+	reserved := []*net.IPNet{}
+	if *reservedNetworks != "" {
+		for _, network := range strings.Split(*reservedNetworks, ",") {
+			if !strings.Contains(network, "/") {
+				network += "/32"
+			}
+
+			_, ipNet, err := net.ParseCIDR(network)
+			if err != nil {
+				logger.Fatal("malformed-reserved-network", err)
+			}
+
+			reserved = append(reserved, ipNet)
+		}
+	}
+
+	metricSender := metric_sender.NewMetricSender(autowire.AutowiredEmitter())
+
+	realNetworkPool := network_pool.NewWithStrategy(ipNet, strategy)
+	for _, ipNet := range reserved {
+		realNetworkPool.Reserve(ipNet)
+	}
+
+	realNetworkPool.ReportAllocations(metricSender, "network")
+
+	var networkPool network_pool.NetworkPool = realNetworkPool
+
+	var waitingNetworkPool *network_pool.WaitingNetworkPool
+	if *networkPoolWaitTimeout > 0 {
+		waitingNetworkPool = network_pool.NewWaiting(logger, networkPool, *networkPoolWaitTimeout)
+		networkPool = waitingNetworkPool
+	}
+
+	extraNetworkPools := []network_pool.NetworkPool{}
+	if *additionalNetworkPools != "" {
+		for _, cidr := range strings.Split(*additionalNetworkPools, ",") {
+			_, ipNet, err := net.ParseCIDR(cidr)
+			if err != nil {
+				logger.Fatal("malformed-additional-network-pool", err)
+			}
+
+			extraNetworkPool := network_pool.NewWithStrategy(ipNet, strategy)
+			for _, ipNet := range reserved {
+				extraNetworkPool.Reserve(ipNet)
+			}
+
+			extraNetworkPool.ReportAllocations(metricSender, "network:"+ipNet.String())
+
+			extraNetworkPools = append(extraNetworkPools, extraNetworkPool)
+		}
+	}
+
+	if len(extraNetworkPools) > 4 {
+		logger.Fatal("too-many-additional-network-pools", fmt.Errorf("at most 4 additional network pools may be given, got %d", len(extraNetworkPools)))
+	}
+
+	externalIPList := []net.IP{}
+	if *externalIPs != "" {
+		for _, ip := range strings.Split(*externalIPs, ",") {
+			externalIP := net.ParseIP(ip)
+			if externalIP == nil {
+				logger.Fatal("malformed-external-ip", fmt.Errorf("invalid IP: %s", ip))
+			}
+
+			externalIPList = append(externalIPList, externalIP)
+		}
+	}
+
+	externalIPPool := external_ip_pool.New(externalIPList)
 
 	// TODO: use /proc/sys/net/ipv4/ip_local_port_range by default (end + 1)
 	portPool := port_pool.New(uint32(*portPoolStart), uint32(*portPoolSize))
 
 	config := sysconfig.NewConfig(*tag)
 
-	runner := sysconfig.NewRunner(config, linux_command_runner.New())
+	if err := config.Validate(); err != nil {
+		logger.Fatal("invalid-tag", err)
+	}
+
+	runnerBounds := bounded_runner.Config{
+		Timeout:   *commandTimeout,
+		Timeouts:  map[string]time.Duration{},
+		MaxOutput: *commandOutputLimit,
+	}
+
+	if *commandTimeouts != "" {
+		for _, timeout := range strings.Split(*commandTimeouts, ",") {
+			segs := strings.SplitN(timeout, "=", 2)
+			if len(segs) != 2 {
+				logger.Fatal("malformed-command-timeout", fmt.Errorf("expected NAME=DURATION: %s", timeout))
+			}
+
+			duration, err := time.ParseDuration(segs[1])
+			if err != nil {
+				logger.Fatal("malformed-command-timeout", err)
+			}
 
-	quotaManager := quota_manager.New(runner, getMountPoint(logger, *depotPath), *binPath)
+			runnerBounds.Timeouts[segs[0]] = duration
+		}
+	}
+
+	depotMountPoint, err := quota_manager.MountPointOf(*depotPath)
+	if err != nil {
+		logger.Fatal("failed-to-get-mount-info", err)
+	}
+
+	privilegedLayout := privileged_runner.Layout{
+		BinPath:      *binPath,
+		DepotPath:    *depotPath,
+		OverlaysPath: *overlaysPath,
+
+		GraphRoot:   *graphRoot,
+		RootFSPaths: []string{*rootFSPath},
+
+		UIDPoolStart: uint32(*uidPoolStart),
+		UIDPoolSize:  uint32(*uidPoolSize),
+
+		QuotaMountPoint: depotMountPoint,
+
+		IPTables: config.IPTables,
+	}
+
+	// garden-linux [flags] privileged-helper carries out, as root, the
+	// backend's scripts, iptables and quotas for a server given the same
+	// flags and -privilegedHelperSocket
+	if flag.Arg(0) == "privileged-helper" {
+		if *privilegedHelperSocket == "" {
+			missing("-privilegedHelperSocket")
+		}
+
+		os.Remove(*privilegedHelperSocket)
+
+		listener, err := net.Listen("unix", *privilegedHelperSocket)
+		if err != nil {
+			logger.Fatal("failed-to-listen-for-server", err)
+		}
+
+		// who may connect is left to the group and permissions of the
+		// socket's directory
+		err = os.Chmod(*privilegedHelperSocket, 0660)
+		if err != nil {
+			logger.Fatal("failed-to-restrict-socket", err)
+		}
+
+		helper := privileged_runner.NewHelper(
+			bounded_runner.New(
+				logger.Session("privileged-helper-runner"),
+				sysconfig.NewRunner(config, linux_command_runner.New()),
+				runnerBounds,
+			),
+			privilegedLayout,
+			logger.Session("privileged-helper"),
+		)
+
+		logger.Info("privileged-helper-listening", lager.Data{
+			"socket": *privilegedHelperSocket,
+		})
+
+		err = privileged_runner.Serve(listener, helper)
+		if err != nil {
+			logger.Fatal("failed-to-serve-privileged-helper", err)
+		}
+
+		return
+	}
+
+	// held until the server exits
+	tagLock, err := config.Claim()
+	if err != nil {
+		logger.Fatal("failed-to-claim-tag", err)
+	}
+
+	defer tagLock.Close()
+
+	var commandRunner command_runner.CommandRunner = bounded_runner.New(
+		logger.Session("command-runner"),
+		sysconfig.NewRunner(config, linux_command_runner.New()),
+		runnerBounds,
+	)
+
+	// the helper bounds the commands it runs itself
+	if *privilegedHelperSocket != "" {
+		// the helper checks what the server asks of it, but the server
+		// still starts processes, mounts and writes cgroups and containers'
+		// directories itself
+		if os.Geteuid() != 0 {
+			logger.Fatal("server-requires-root", fmt.Errorf("the server must run as root, even with -privilegedHelperSocket"))
+		}
+
+		helperClient, err := rpc.Dial("unix", *privilegedHelperSocket)
+		if err != nil {
+			logger.Fatal("failed-to-connect-to-privileged-helper", err)
+		}
+
+		commandRunner = privileged_runner.New(commandRunner, helperClient, privilegedLayout)
+	}
+
+	// commands that change iptables are run one at a time, rather than
+	// contending for the xtables lock; a wedged one is killed before it
+	// holds up the rest
+	runner := iptables_writer.New(commandRunner)
+
+	if err := config.CheckForwardRules(runner); err != nil {
+		logger.Fatal("colliding-server", err)
+	}
+
+	linuxQuotaManager := quota_manager.New(runner, depotMountPoint, *binPath)
 
 	if *disableQuotas {
-		quotaManager.Disable()
+		linuxQuotaManager.Disable()
+	}
+
+	var quotaManager quota_manager.QuotaManager = linuxQuotaManager
+	if *diskUsageCacheTTL > 0 {
+		quotaManager = quota_manager.NewCaching(quotaManager, *diskUsageCacheTTL)
 	}
 
 	if err := os.MkdirAll(*graphRoot, 0755); err != nil {
@@ -214,21 +998,129 @@ func Main() {
 		logger.Fatal("failed-to-construct-graph", err)
 	}
 
+	if *registryCACert != "" || *registryClientCert != "" || *registryClientKey != "" {
+		registryHost, err := repository_fetcher.RegistryHost(*dockerRegistry)
+		if err != nil {
+			logger.Fatal("malformed-registry", err)
+		}
+
+		err = repository_fetcher.InstallRegistryTLS(repository_fetcher.DockerCertsDir, registryHost, repository_fetcher.RegistryTLS{
+			CACert:     *registryCACert,
+			ClientCert: *registryClientCert,
+			ClientKey:  *registryClientKey,
+		})
+		if err != nil {
+			logger.Fatal("failed-to-install-registry-tls", err)
+		}
+	}
+
+	if *registryTLSOverrides != "" {
+		err := repository_fetcher.InstallRegistryTLSOverrides(repository_fetcher.DockerCertsDir, *registryTLSOverrides)
+		if err != nil {
+			logger.Fatal("failed-to-install-registry-tls-overrides", err)
+		}
+	}
+
 	endpoint, err := registry.NewEndpoint(*dockerRegistry)
 	if err != nil {
 		logger.Fatal("failed-to-construct-registry-endpoint", err)
 	}
 
-	reg, err := registry.NewSession(nil, nil, endpoint, true)
+	// with reloadable configuration, the helper is always asked, for it to
+	// be set or unset without restarting
+	var credentialHelper *repository_fetcher.CredentialHelper
+
+	var dockerFetcher repository_fetcher.RepositoryFetcher
+	if settings.RegistryCredentialHelper != "" || *reloadableConfig != "" {
+		credentialHelper = repository_fetcher.NewCredentialHelper(settings.RegistryCredentialHelper, runner)
+
+		dockerFetcher = repository_fetcher.NewWithProvider(
+			repository_fetcher.NewCredentialHelperRegistryProvider(endpoint, credentialHelper),
+			graph,
+		)
+	} else {
+		reg, err := repository_fetcher.NewSession(nil, nil, endpoint)
+		if err != nil {
+			logger.Fatal("failed-to-construct-registry", err)
+		}
+
+		dockerFetcher = repository_fetcher.New(reg, graph)
+	}
+
+	retryableFetcher := repository_fetcher.Retryable{
+		RepositoryFetcher: dockerFetcher,
+		Attempts:          *registryFetchAttempts,
+		MetricSender:      metricSender,
+	}
+
+	if *registryFetchBackoff != "" {
+		for _, backoff := range strings.Split(*registryFetchBackoff, ",") {
+			duration, err := time.ParseDuration(backoff)
+			if err != nil {
+				logger.Fatal("malformed-registry-fetch-backoff", err)
+			}
+
+			retryableFetcher.Backoff = append(retryableFetcher.Backoff, duration)
+		}
+	}
+
+	if *registryRetryServerErrorsOnly {
+		retryableFetcher.ShouldRetry = repository_fetcher.RetryServerErrors
+	}
+
+	repoFetcher, err := repository_fetcher.NewCaching(
+		logger,
+		retryableFetcher,
+		graph,
+		filepath.Join(*graphRoot, "garden-tags.json"),
+		*dockerCacheFirst,
+		*failOnStalePull,
+	)
 	if err != nil {
-		logger.Fatal("failed-to-construct-registry", err)
+		logger.Fatal("failed-to-construct-repository-fetcher", err)
 	}
 
-	repoFetcher := repository_fetcher.Retryable{repository_fetcher.New(reg, graph)}
+	var volumeManager volume_manager.VolumeManager
+	if *lvmVolumeGroup != "" {
+		volumeManager = volume_manager.NewLVM(runner, *lvmVolumeGroup, *lvmThinPool, *lvmVolumeSize)
+	}
 
 	rootFSProviders := map[string]rootfs_provider.RootFSProvider{
-		"":       rootfs_provider.NewOverlay(*binPath, *overlaysPath, *rootFSPath, runner),
-		"docker": rootfs_provider.NewDocker(repoFetcher, graphDriver),
+		"":       rootfs_provider.NewOverlay(*binPath, *overlaysPath, *rootFSPath, volumeManager, runner),
+		"docker": rootfs_provider.NewDocker(repoFetcher, graph, graphDriver),
+	}
+
+	var networkPlugin network_plugin.NetworkPlugin
+	if *networkPluginPath != "" {
+		networkPlugin = network_plugin.New(*networkPluginPath, runner)
+	}
+
+	if *networkPluginBuildsLinks && networkPlugin == nil {
+		logger.Fatal("missing-network-plugin", fmt.Errorf("-networkPluginBuildsLinks requires -networkPlugin"))
+	}
+
+	deviceRules, err := cgroups_manager.ParseDeviceRules(*deviceWhitelist)
+	if err != nil {
+		logger.Fatal("malformed-device-rule", err)
+	}
+
+	var numaPlacer numa_placer.Placer
+	if *numaPlacement != "" {
+		policy, err := numa_placer.ParsePolicy(*numaPlacement)
+		if err != nil {
+			logger.Fatal("malformed-numa-placement", err)
+		}
+
+		nodes, err := numa_placer.DiscoverNodes(*numaNodesPath)
+		if err != nil {
+			logger.Fatal("failed-to-discover-numa-nodes", err)
+		}
+
+		if len(nodes) == 0 {
+			logger.Fatal("failed-to-discover-numa-nodes", fmt.Errorf("no NUMA nodes with CPUs in %s", *numaNodesPath))
+		}
+
+		numaPlacer = numa_placer.New(nodes, policy)
 	}
 
 	pool := container_pool.New(
@@ -239,26 +1131,275 @@ func Main() {
 		rootFSProviders,
 		uidPool,
 		networkPool,
+		extraNetworkPools,
+		externalIPPool,
 		portPool,
-		strings.Split(*denyNetworks, ","),
-		strings.Split(*allowNetworks, ","),
+		settings.DenyNetworks,
+		settings.AllowNetworks,
 		runner,
 		quotaManager,
+		volumeManager,
+		networkPlugin,
+		deviceRules,
+		numaPlacer,
+		settings.DefaultRLimits.ResourceLimits(),
+		*validateRestoredNetworks,
+		Version,
 	)
 
+	idScheme, err := container_pool.ParseIDScheme(*containerIDScheme)
+	if err != nil {
+		logger.Fatal("malformed-container-id-scheme", err)
+	}
+
+	err = pool.GenerateIDs(idScheme, *containerIDPrefix)
+	if err != nil {
+		logger.Fatal("malformed-container-id-prefix", err)
+	}
+
+	windows, err := maintenance.ParseWindows(*maintenanceWindows)
+	if err != nil {
+		logger.Fatal("malformed-maintenance-windows", err)
+	}
+
+	var scheduler *maintenance.Scheduler
+	if len(windows) > 0 {
+		scheduler = &maintenance.Scheduler{
+			Windows: windows,
+			Logger:  logger,
+		}
+	}
+
+	if *reapInBackground {
+		if scheduler != nil {
+			pool.ReapDuringMaintenance()
+			scheduler.Register("reap-destroyed-containers", pool.ReapBuried)
+		} else {
+			pool.ReapInBackground(*reapInterval)
+		}
+	}
+
+	if *networkPluginBuildsLinks {
+		pool.DelegateLinksToNetworkPlugin()
+	}
+
+	if *hardenProcSys {
+		pool.HardenProcSys()
+	}
+
+	if *appArmorProfile != "" {
+		pool.ConfineWithAppArmor(*appArmorProfile)
+	}
+
+	if *selinuxLabels {
+		if !selinux_labeler.Enabled() {
+			logger.Fatal("selinux-not-enabled", fmt.Errorf("-selinuxLabels requires a host with SELinux enabled"))
+		}
+
+		if *uidPoolSize > selinux_labeler.MaxContainers {
+			logger.Fatal("uid-pool-too-large-for-selinux-labels", fmt.Errorf("with -selinuxLabels, the uid pool may have at most %d uids", selinux_labeler.MaxContainers))
+		}
+
+		labeler, err := selinux_labeler.New(*selinuxProcessContext, *selinuxFileContext)
+		if err != nil {
+			logger.Fatal("malformed-selinux-context", err)
+		}
+
+		pool.LabelWithSELinux(labeler)
+	}
+
+	err = pool.ConfigureDNS(strings.Split(*dnsServers, ","), strings.Split(*dnsSearchDomains, ","))
+	if err != nil {
+		logger.Fatal("malformed-dns-configuration", err)
+	}
+
 	systemInfo := system_info.NewProvider(*depotPath)
 
 	if *mtu > math.MaxUint32 {
 		logger.Error("validation", fmt.Errorf("invalid value %d for flag -mtu: value out of range (maximum value %d)", *mtu, math.MaxUint32))
 		os.Exit(2)
 	}
-	backend := linux_backend.New(logger, pool, systemInfo, *snapshotsPath, uint32(*mtu))
+
+	var snapshotStore linux_backend.SnapshotStore
+	if *snapshotsPath != "" {
+		switch *snapshotStoreKind {
+		case "file":
+			fileStore := snapshot_store.NewFileStore(*snapshotsPath)
+			fileStore.Validate = linux_backend.ValidateSnapshot
+
+			snapshotStore = fileStore
+
+		case "bolt":
+			boltStore, err := snapshot_store.OpenBoltStore(logger.Session("snapshot-store"), *snapshotsPath)
+			if err != nil {
+				logger.Fatal("failed-to-open-snapshot-store", err)
+			}
+
+			boltStore.Validate = linux_backend.ValidateSnapshot
+
+			snapshotStore = boltStore
+
+		default:
+			logger.Fatal("unknown-snapshot-store", fmt.Errorf("-snapshotStore must be file or bolt, got %q", *snapshotStoreKind))
+		}
+	}
+
+	backend := linux_backend.New(logger, pool, systemInfo, snapshotStore, uint32(*mtu), linux_backend.StartVerification{
+		Attempts: *startVerificationAttempts,
+		Interval: *startVerificationInterval,
+	})
+
+	backend.ReportFinalUsage(metricSender)
+
+	if *usageExportInterval > 0 {
+		backend.ExportUsageWith(newUsageExporter(logger))
+	}
+
+	if *snapshotBackupInterval > 0 {
+		backend.BackUpSnapshotsTo(newSnapshotUploader(logger))
+	}
+
+	backend.EnforceOvercommit(linux_backend.OvercommitFactors{
+		Memory: *memoryOvercommitFactor,
+		Disk:   *diskOvercommitFactor,
+	})
+
+	// garden-linux [flags] setup makes the host-wide changes that the server
+	// needs, and exits
+	if flag.Arg(0) == "setup" {
+		err := pool.SetUpHost()
+		if err != nil {
+			logger.Fatal("failed-to-set-up-host", err)
+		}
+
+		logger.Info("host-set-up")
+		return
+	}
+
+	if *skipHostSetup {
+		pool.SkipHostSetup()
+	}
 
 	err = backend.Setup()
 	if err != nil {
 		logger.Fatal("failed-to-set-up-backend", err)
 	}
 
+	if !backend.Capabilities().SwapAccounting {
+		logger.Info("swap-accounting-disabled", lager.Data{
+			"consequence": "memory limits do not include swap; boot the kernel with swapaccount=1 to enforce them",
+		})
+	}
+
+	if *networkReconcileInterval > 0 {
+		go func() {
+			for _ = range time.Tick(*networkReconcileInterval) {
+				backend.ReconcileNetworks()
+			}
+		}()
+	}
+
+	if *daemonCheckInterval > 0 {
+		go func() {
+			for _ = range time.Tick(*daemonCheckInterval) {
+				backend.MonitorDaemons(*destroyDeadContainers)
+			}
+		}()
+	}
+
+	// restored on shutdown, if core dumps are enabled
+	var previousCorePattern *string
+
+	restoreCorePattern := func() {
+		if previousCorePattern != nil {
+			err := linux_backend.RestoreCorePattern(corePatternPath, *coreDumpHostPath, *previousCorePattern)
+			if err != nil {
+				logger.Error("failed-to-restore-core-pattern", err)
+			}
+		}
+	}
+
+	if *coreDumpMaxBytes > 0 {
+		previous, err := linux_backend.EnableCoreDumps(corePatternPath, *binPath, *depotPath, *coreDumpHostPath, *coreDumpMaxBytes, *coreDumpMaxCount)
+		if err != nil {
+			logger.Fatal("failed-to-enable-core-dumps", err)
+		}
+
+		previousCorePattern = &previous
+
+		// for failures to start, which panic; stopping on a signal exits
+		// without running deferred functions, so restores it itself
+		defer restoreCorePattern()
+
+		go func() {
+			for _ = range time.Tick(*coreDumpCheckInterval) {
+				backend.CheckCoreDumps()
+			}
+		}()
+	}
+
+	if *usageSampleInterval > 0 {
+		go func() {
+			for _ = range time.Tick(*usageSampleInterval) {
+				backend.SampleUsage(*usageHistorySize)
+			}
+		}()
+	}
+
+	if scheduler != nil {
+		go scheduler.Run(time.Tick(*maintenanceCheckInterval))
+	}
+
+	if *usageExportInterval > 0 {
+		go func() {
+			for _ = range time.Tick(*usageExportInterval) {
+				backend.ExportUsage()
+			}
+		}()
+	}
+
+	if *snapshotBackupInterval > 0 {
+		go func() {
+			for _ = range time.Tick(*snapshotBackupInterval) {
+				backend.BackUpSnapshots()
+			}
+		}()
+	}
+
+	if *pressureCheckInterval > 0 {
+		thresholds := linux_backend.PressureThresholds{
+			MinFreeMemory: *minFreeMemoryMB * 1024 * 1024,
+			MinFreeDisk:   *minFreeDiskMB * 1024 * 1024,
+		}
+
+		go func() {
+			for _ = range time.Tick(*pressureCheckInterval) {
+				backend.MonitorPressure(metricSender, thresholds)
+			}
+		}()
+	}
+
+	if *poolReportInterval > 0 {
+		go func() {
+			for _ = range time.Tick(*poolReportInterval) {
+				backend.ReportPoolUtilization(metricSender, *poolLowWatermark)
+
+				if waitingNetworkPool != nil {
+					waitingNetworkPool.ReportWaits(metricSender, "network")
+				}
+			}
+		}()
+	}
+
+	if *adminAddr != "" {
+		adminListener, err := net.Listen("tcp", *adminAddr)
+		if err != nil {
+			logger.Fatal("failed-to-listen-for-admin", err)
+		}
+
+		go http.Serve(adminListener, admin.NewHandler(backend, logger))
+	}
+
 	graceTime := *containerGraceTime
 
 	gardenServer := server.New(*listenNetwork, *listenAddr, graceTime, backend, logger)
@@ -273,34 +1414,60 @@ func Main() {
 		"addr":    *listenAddr,
 	})
 
+	if *watchdogInterval > 0 {
+		gardenClient := client.New(connection.New(*listenNetwork, *listenAddr))
+
+		dog := &watchdog.Watchdog{
+			Probes: map[string]watchdog.Probe{
+				"server": gardenClient.Ping,
+			},
+			Timeout:       *watchdogTimeout,
+			Logger:        logger,
+			MetricSender:  metricSender,
+			ExitWhenStuck: *watchdogExit,
+		}
+
+		for name, probe := range backend.WatchdogProbes() {
+			dog.Probes[name] = probe
+		}
+
+		go func() {
+			for _ = range time.Tick(*watchdogInterval) {
+				dog.Check()
+			}
+		}()
+	}
+
 	signals := make(chan os.Signal, 1)
 
 	go func() {
 		<-signals
 		gardenServer.Stop()
+
+		restoreCorePattern()
+
 		os.Exit(0)
 	}()
 
-	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
+	stopSignals := []os.Signal{syscall.SIGINT, syscall.SIGTERM}
 
-	select {}
-}
+	if *reloadableConfig == "" {
+		stopSignals = append(stopSignals, syscall.SIGHUP)
+	} else {
+		reloads := make(chan os.Signal, 1)
 
-func getMountPoint(logger lager.Logger, depotPath string) string {
-	dfOut := new(bytes.Buffer)
+		go func() {
+			for _ = range reloads {
+				reload(logger, settingsFromFlags, logSink, pool, credentialHelper)
+			}
+		}()
 
-	df := exec.Command("df", depotPath)
-	df.Stdout = dfOut
-	df.Stderr = os.Stderr
-
-	err := df.Run()
-	if err != nil {
-		logger.Fatal("failed-to-get-mount-info", err)
+		signal.Notify(reloads, syscall.SIGHUP)
 	}
 
-	dfOutputWords := strings.Split(string(dfOut.Bytes()), " ")
+	signal.Notify(signals, stopSignals...)
 
-	return strings.Trim(dfOutputWords[len(dfOutputWords)-1], "\n")
+	select {}
 }
 
 func missing(flagName string) {
@@ -308,3 +1475,113 @@ func missing(flagName string) {
 	println()
 	flag.Usage()
 }
+
+// reload applies the reloadable configuration, logging rather than
+// stopping for anything that cannot be applied; a file that does not load
+// changes nothing.
+func reload(
+	logger lager.Logger,
+	settingsFromFlags reloadable.Config,
+	logSink *logging.LevelSink,
+	pool *container_pool.LinuxContainerPool,
+	credentialHelper *repository_fetcher.CredentialHelper,
+) {
+	rLog := logger.Session("reload", lager.Data{"config": *reloadableConfig})
+
+	rLog.Info("started")
+
+	settings, err := reloadable.Load(*reloadableConfig, settingsFromFlags)
+	if err != nil {
+		rLog.Error("failed-to-load", err)
+		return
+	}
+
+	logLevel, _ := logging.ParseLogLevel(settings.LogLevel)
+	logSink.SetMinLevel(logLevel)
+
+	err = pool.SetNetworkFilters(settings.DenyNetworks, settings.AllowNetworks)
+	if err != nil {
+		rLog.Error("failed-to-set-network-filters", err)
+	}
+
+	credentialHelper.SetPath(settings.RegistryCredentialHelper)
+
+	pool.SetDefaultRLimits(settings.DefaultRLimits.ResourceLimits())
+
+	rLog.Info("finished", lager.Data{"log-level": settings.LogLevel})
+}
+
+func defaultRLimit(limit int64) *uint64 {
+	if limit < 0 {
+		return nil
+	}
+
+	value := uint64(limit)
+	return &value
+}
+
+func newUsageExporter(logger lager.Logger) *usage_exporter.Exporter {
+	format, err := usage_exporter.ParseFormat(*usageExportFormat)
+	if err != nil {
+		logger.Fatal("malformed-usage-export-format", err)
+	}
+
+	var sink usage_exporter.Sink
+	switch {
+	case *usageExportFile != "" && *usageExportURL == "":
+		sink = usage_exporter.NewFileSink(*usageExportFile, format)
+	case *usageExportURL != "" && *usageExportFile == "":
+		sink = usage_exporter.NewHTTPSink(*usageExportURL, format, &http.Client{Timeout: time.Minute})
+	default:
+		logger.Fatal("invalid-usage-export-sink", fmt.Errorf("exactly one of -usageExportFile and -usageExportURL is required"))
+	}
+
+	if *usageExportState == "" {
+		missing("-usageExportState")
+	}
+
+	exporter, err := usage_exporter.New(sink, *usageExportState, *usageExportMaxPending, logger)
+	if err != nil {
+		logger.Fatal("failed-to-load-usage-export-state", err)
+	}
+
+	return exporter
+}
+
+func newSnapshotUploader(logger lager.Logger) linux_backend.SnapshotUploader {
+	if *snapshotBackupURL == "" {
+		missing("-snapshotBackupURL")
+	}
+
+	var id, secret string
+	if *snapshotBackupCredentials != "" {
+		credentials, err := ioutil.ReadFile(*snapshotBackupCredentials)
+		if err != nil {
+			logger.Fatal("failed-to-read-snapshot-backup-credentials", err)
+		}
+
+		segments := strings.SplitN(strings.TrimSpace(string(credentials)), ":", 2)
+		if len(segments) != 2 {
+			logger.Fatal("malformed-snapshot-backup-credentials", fmt.Errorf("expected id:secret in %s", *snapshotBackupCredentials))
+		}
+
+		id, secret = segments[0], segments[1]
+	}
+
+	client := &http.Client{Timeout: time.Minute}
+
+	switch *snapshotBackupTarget {
+	case "webdav":
+		return snapshot_uploader.NewWebDAV(*snapshotBackupURL, id, secret, client)
+	case "s3":
+		if id == "" {
+			missing("-snapshotBackupCredentials")
+		}
+
+		return snapshot_uploader.NewS3(*snapshotBackupURL, *snapshotBackupRegion, id, secret, client)
+	default:
+		logger.Fatal("unknown-snapshot-backup-target", fmt.Errorf("unknown snapshot backup target: %s", *snapshotBackupTarget))
+	}
+
+	return nil
+}
@@ -0,0 +1,209 @@
+// Package maintenance runs heavy housekeeping, such as removing destroyed
+// containers' files, during configured low-traffic windows and at idle IO
+// priority, rather than interleaving it with creates and destroys.
+package maintenance
+
+import (
+	"fmt"
+	"runtime"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/pivotal-golang/lager"
+)
+
+// Window is a daily period, from Start to End after midnight in the
+// server's time zone. A window whose End is before its Start runs past
+// midnight.
+type Window struct {
+	Start time.Duration
+	End   time.Duration
+}
+
+type MalformedWindowError struct {
+	Window string
+}
+
+func (e MalformedWindowError) Error() string {
+	return fmt.Sprintf("malformed maintenance window (expected HH:MM-HH:MM): %s", e.Window)
+}
+
+// ParseWindows parses comma-separated windows as HH:MM-HH:MM, e.g.
+// "02:00-05:00,22:30-23:30".
+func ParseWindows(windows string) ([]Window, error) {
+	parsed := []Window{}
+
+	for _, window := range strings.Split(windows, ",") {
+		window = strings.TrimSpace(window)
+		if window == "" {
+			continue
+		}
+
+		bounds := strings.Split(window, "-")
+		if len(bounds) != 2 {
+			return nil, MalformedWindowError{window}
+		}
+
+		start, err := parseTimeOfDay(bounds[0])
+		if err != nil {
+			return nil, MalformedWindowError{window}
+		}
+
+		end, err := parseTimeOfDay(bounds[1])
+		if err != nil || end == start {
+			return nil, MalformedWindowError{window}
+		}
+
+		parsed = append(parsed, Window{Start: start, End: end})
+	}
+
+	return parsed, nil
+}
+
+func parseTimeOfDay(timeOfDay string) (time.Duration, error) {
+	parsed, err := time.Parse("15:04", strings.TrimSpace(timeOfDay))
+	if err != nil {
+		return 0, err
+	}
+
+	return time.Duration(parsed.Hour())*time.Hour + time.Duration(parsed.Minute())*time.Minute, nil
+}
+
+// Around returns when the window last opened and when it next closes, if
+// it is open at t.
+func (w Window) Around(t time.Time) (time.Time, time.Time, bool) {
+	midnight := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+	sinceMidnight := t.Sub(midnight)
+
+	switch {
+	case w.Start < w.End:
+		if sinceMidnight >= w.Start && sinceMidnight < w.End {
+			return midnight.Add(w.Start), midnight.Add(w.End), true
+		}
+
+	case sinceMidnight >= w.Start:
+		// opened today, closes tomorrow
+		return midnight.Add(w.Start), midnight.AddDate(0, 0, 1).Add(w.End), true
+
+	case sinceMidnight < w.End:
+		// opened yesterday, closes today
+		return midnight.AddDate(0, 0, -1).Add(w.Start), midnight.Add(w.End), true
+	}
+
+	return time.Time{}, time.Time{}, false
+}
+
+// Task does some housekeeping, stopping by until, when its window closes.
+type Task func(logger lager.Logger, until time.Time) error
+
+type Scheduler struct {
+	Windows []Window
+
+	Logger lager.Logger
+
+	// defaults to time.Now
+	Now func() time.Time
+
+	tasks []namedTask
+
+	// when the window the tasks last ran in opened
+	lastOpened time.Time
+}
+
+type namedTask struct {
+	name string
+	task Task
+}
+
+// Register adds a task, to be run after those already registered.
+func (s *Scheduler) Register(name string, task Task) {
+	s.tasks = append(s.tasks, namedTask{name: name, task: task})
+}
+
+// Check runs the tasks, one after another, if a window is open and they
+// have not yet run in it, and returns whether it did. Tasks not started
+// before the window closes wait for the next.
+func (s *Scheduler) Check() bool {
+	now := s.now()
+
+	for _, window := range s.Windows {
+		opened, closes, open := window.Around(now)
+		if !open || opened.Equal(s.lastOpened) {
+			continue
+		}
+
+		s.lastOpened = opened
+
+		mLog := s.Logger.Session("maintenance", lager.Data{
+			"until": closes.String(),
+		})
+
+		mLog.Info("started")
+
+		for _, task := range s.tasks {
+			if !s.now().Before(closes) {
+				mLog.Info("window-closed", lager.Data{"skipped": task.name})
+				break
+			}
+
+			err := task.task(mLog.Session(task.name), closes)
+			if err != nil {
+				mLog.Error("task-failed", err, lager.Data{"task": task.name})
+			}
+		}
+
+		mLog.Info("finished")
+
+		return true
+	}
+
+	return false
+}
+
+// Run checks on every tick, from a thread of its own at idle IO priority,
+// which the commands the tasks run inherit.
+func (s *Scheduler) Run(ticks <-chan time.Time) {
+	runtime.LockOSThread()
+
+	err := LowerIOPriority()
+	if err != nil {
+		s.Logger.Error("failed-to-lower-io-priority", err)
+	}
+
+	for _ = range ticks {
+		s.Check()
+	}
+}
+
+func (s *Scheduler) now() time.Time {
+	if s.Now == nil {
+		return time.Now()
+	}
+
+	return s.Now()
+}
+
+// ioprio_set(2) constants, which package syscall does not have
+const (
+	ioprioWhoProcess = 1
+	ioprioClassIdle  = 3
+	ioprioClassShift = 13
+)
+
+// LowerIOPriority puts the calling thread, and the processes it starts, in
+// the idle IO class, so that they only use the disk when nothing else does.
+// The calling goroutine must be locked to its thread.
+func LowerIOPriority() error {
+	_, _, errno := syscall.RawSyscall(
+		syscall.SYS_IOPRIO_SET,
+		ioprioWhoProcess,
+		0,
+		ioprioClassIdle<<ioprioClassShift,
+	)
+	if errno != 0 {
+		return errno
+	}
+
+	return nil
+}
@@ -0,0 +1,211 @@
+package maintenance_test
+
+import (
+	"errors"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/pivotal-golang/lager"
+	"github.com/pivotal-golang/lager/lagertest"
+
+	"github.com/cloudfoundry-incubator/garden-linux/old/maintenance"
+)
+
+var _ = Describe("Maintenance windows", func() {
+	at := func(hour, minute int) time.Time {
+		return time.Date(2015, 3, 10, hour, minute, 0, 0, time.UTC)
+	}
+
+	Describe("parsing", func() {
+		It("parses comma-separated times of day", func() {
+			windows, err := maintenance.ParseWindows("02:00-05:30, 22:15-01:00")
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(windows).Should(Equal([]maintenance.Window{
+				{Start: 2 * time.Hour, End: 5*time.Hour + 30*time.Minute},
+				{Start: 22*time.Hour + 15*time.Minute, End: time.Hour},
+			}))
+		})
+
+		It("parses nothing as no windows", func() {
+			windows, err := maintenance.ParseWindows("")
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(windows).Should(BeEmpty())
+		})
+
+		It("rejects malformed windows", func() {
+			for _, malformed := range []string{"02:00", "02:00-25:00", "2am-5am", "02:00-03:00-04:00", "02:00-02:00"} {
+				_, err := maintenance.ParseWindows(malformed)
+				Ω(err).Should(Equal(maintenance.MalformedWindowError{Window: malformed}), malformed)
+			}
+		})
+	})
+
+	Describe("Around", func() {
+		window := maintenance.Window{Start: 2 * time.Hour, End: 5 * time.Hour}
+
+		It("returns when the window opened and closes, when it is open", func() {
+			opened, closes, open := window.Around(at(3, 0))
+			Ω(open).Should(BeTrue())
+			Ω(opened).Should(Equal(at(2, 0)))
+			Ω(closes).Should(Equal(at(5, 0)))
+		})
+
+		It("is closed outside of the window, including at its end", func() {
+			_, _, open := window.Around(at(1, 59))
+			Ω(open).Should(BeFalse())
+
+			_, _, open = window.Around(at(5, 0))
+			Ω(open).Should(BeFalse())
+		})
+
+		Context("when the window runs past midnight", func() {
+			window := maintenance.Window{Start: 23 * time.Hour, End: time.Hour}
+
+			It("is open either side of midnight", func() {
+				opened, closes, open := window.Around(at(23, 30))
+				Ω(open).Should(BeTrue())
+				Ω(opened).Should(Equal(at(23, 0)))
+				Ω(closes).Should(Equal(at(1, 0).AddDate(0, 0, 1)))
+
+				opened, closes, open = window.Around(at(0, 30))
+				Ω(open).Should(BeTrue())
+				Ω(opened).Should(Equal(at(23, 0).AddDate(0, 0, -1)))
+				Ω(closes).Should(Equal(at(1, 0)))
+
+				_, _, open = window.Around(at(12, 0))
+				Ω(open).Should(BeFalse())
+			})
+		})
+	})
+})
+
+var _ = Describe("Maintenance scheduler", func() {
+	var now time.Time
+	var scheduler *maintenance.Scheduler
+
+	var ran []string
+	var untils []time.Time
+
+	at := func(hour, minute int) time.Time {
+		return time.Date(2015, 3, 10, hour, minute, 0, 0, time.UTC)
+	}
+
+	task := func(name string) maintenance.Task {
+		return func(logger lager.Logger, until time.Time) error {
+			ran = append(ran, name)
+			untils = append(untils, until)
+			return nil
+		}
+	}
+
+	BeforeEach(func() {
+		ran = []string{}
+		untils = []time.Time{}
+
+		scheduler = &maintenance.Scheduler{
+			Windows: []maintenance.Window{{Start: 2 * time.Hour, End: 5 * time.Hour}},
+			Logger:  lagertest.NewTestLogger("test"),
+			Now: func() time.Time {
+				return now
+			},
+		}
+
+		scheduler.Register("first", task("first"))
+		scheduler.Register("second", task("second"))
+	})
+
+	It("runs the tasks in order, until the window closes, when it opens", func() {
+		now = at(1, 0)
+		Ω(scheduler.Check()).Should(BeFalse())
+		Ω(ran).Should(BeEmpty())
+
+		now = at(2, 1)
+		Ω(scheduler.Check()).Should(BeTrue())
+		Ω(ran).Should(Equal([]string{"first", "second"}))
+		Ω(untils).Should(Equal([]time.Time{at(5, 0), at(5, 0)}))
+	})
+
+	It("runs the tasks once per window", func() {
+		now = at(2, 1)
+		scheduler.Check()
+
+		now = at(3, 0)
+		Ω(scheduler.Check()).Should(BeFalse())
+		Ω(ran).Should(HaveLen(2))
+
+		now = at(2, 1).AddDate(0, 0, 1)
+		Ω(scheduler.Check()).Should(BeTrue())
+		Ω(ran).Should(HaveLen(4))
+	})
+
+	It("runs the tasks however late in the window it is first checked", func() {
+		now = at(4, 59)
+		Ω(scheduler.Check()).Should(BeTrue())
+		Ω(ran).Should(Equal([]string{"first", "second"}))
+	})
+
+	Context("when the window closes while a task runs", func() {
+		BeforeEach(func() {
+			scheduler = &maintenance.Scheduler{
+				Windows: []maintenance.Window{{Start: 2 * time.Hour, End: 5 * time.Hour}},
+				Logger:  lagertest.NewTestLogger("test"),
+				Now: func() time.Time {
+					return now
+				},
+			}
+
+			scheduler.Register("slow", func(lager.Logger, time.Time) error {
+				ran = append(ran, "slow")
+				now = at(5, 0)
+				return nil
+			})
+
+			scheduler.Register("second", task("second"))
+		})
+
+		It("leaves the rest for the next window", func() {
+			now = at(2, 1)
+			scheduler.Check()
+
+			Ω(ran).Should(Equal([]string{"slow"}))
+		})
+	})
+
+	Context("when a task fails", func() {
+		var logger *lagertest.TestLogger
+
+		BeforeEach(func() {
+			logger = lagertest.NewTestLogger("test")
+
+			scheduler = &maintenance.Scheduler{
+				Windows: []maintenance.Window{{Start: 2 * time.Hour, End: 5 * time.Hour}},
+				Logger:  logger,
+				Now: func() time.Time {
+					return now
+				},
+			}
+
+			scheduler.Register("failing", func(lager.Logger, time.Time) error {
+				return errors.New("oh no!")
+			})
+
+			scheduler.Register("second", task("second"))
+		})
+
+		It("logs the failure, and runs the rest", func() {
+			now = at(2, 1)
+			scheduler.Check()
+
+			Ω(ran).Should(Equal([]string{"second"}))
+
+			messages := []string{}
+			for _, log := range logger.Logs() {
+				messages = append(messages, log.Message)
+			}
+
+			Ω(messages).Should(ContainElement("test.maintenance.task-failed"))
+		})
+	})
+})
@@ -0,0 +1,131 @@
+// Package reloadable reads the configuration that the server can change
+// without restarting, when sent SIGHUP.
+package reloadable
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+
+	"github.com/cloudfoundry-incubator/garden/api"
+
+	"github.com/cloudfoundry-incubator/garden-linux/old/logging"
+)
+
+// Config is read from a JSON file, e.g.:
+//
+//	{
+//	  "LogLevel": "debug",
+//	  "DenyNetworks": ["10.0.0.0/8"],
+//	  "AllowNetworks": ["10.1.0.0/16"],
+//	  "RegistryCredentialHelper": "/usr/local/bin/docker-credential-ecr",
+//	  "DefaultRLimits": {"Nofile": 4096, "Core": null}
+//	}
+//
+// Fields left out of the file keep the values given by flags; a limit of
+// null leaves it unset.
+type Config struct {
+	LogLevel string
+
+	DenyNetworks  []string
+	AllowNetworks []string
+
+	// empty for no credentials
+	RegistryCredentialHelper string
+
+	DefaultRLimits RLimits
+}
+
+type RLimits struct {
+	Nofile *uint64
+	Nproc  *uint64
+	Core   *uint64
+}
+
+func (limits RLimits) ResourceLimits() api.ResourceLimits {
+	return api.ResourceLimits{
+		Nofile: limits.Nofile,
+		Nproc:  limits.Nproc,
+		Core:   limits.Core,
+	}
+}
+
+type MalformedNetworkError struct {
+	Network string
+}
+
+func (e MalformedNetworkError) Error() string {
+	return fmt.Sprintf("malformed network: %s (expected CIDR or IP)", e.Network)
+}
+
+// Load reads the configuration at path over the defaults, and validates it,
+// so that a bad file is rejected as a whole rather than half applied.
+func Load(path string, defaults Config) (Config, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return Config{}, err
+	}
+
+	defer file.Close()
+
+	config := defaults.copy()
+
+	err = json.NewDecoder(file).Decode(&config)
+	if err != nil {
+		return Config{}, err
+	}
+
+	err = config.validate()
+	if err != nil {
+		return Config{}, err
+	}
+
+	return config, nil
+}
+
+// copy returns the config with its own limits, so that decoding over it
+// leaves the defaults alone.
+func (config Config) copy() Config {
+	config.DenyNetworks = append([]string{}, config.DenyNetworks...)
+	config.AllowNetworks = append([]string{}, config.AllowNetworks...)
+
+	config.DefaultRLimits = RLimits{
+		Nofile: copyLimit(config.DefaultRLimits.Nofile),
+		Nproc:  copyLimit(config.DefaultRLimits.Nproc),
+		Core:   copyLimit(config.DefaultRLimits.Core),
+	}
+
+	return config
+}
+
+func copyLimit(limit *uint64) *uint64 {
+	if limit == nil {
+		return nil
+	}
+
+	value := *limit
+	return &value
+}
+
+func (config Config) validate() error {
+	_, err := logging.ParseLogLevel(config.LogLevel)
+	if err != nil {
+		return err
+	}
+
+	for _, networks := range [][]string{config.DenyNetworks, config.AllowNetworks} {
+		for _, network := range networks {
+			if network == "" {
+				continue
+			}
+
+			_, _, err := net.ParseCIDR(network)
+			if err != nil && net.ParseIP(network) == nil {
+				return MalformedNetworkError{network}
+			}
+		}
+	}
+
+	return nil
+}
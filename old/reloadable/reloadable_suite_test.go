@@ -0,0 +1,13 @@
+package reloadable_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"testing"
+)
+
+func TestReloadable(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Reloadable Suite")
+}
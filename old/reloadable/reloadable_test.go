@@ -0,0 +1,126 @@
+package reloadable_test
+
+import (
+	"io/ioutil"
+	"os"
+
+	"github.com/cloudfoundry-incubator/garden-linux/old/logging"
+	. "github.com/cloudfoundry-incubator/garden-linux/old/reloadable"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Load", func() {
+	var path string
+	var defaults Config
+
+	uint64ptr := func(n uint64) *uint64 {
+		return &n
+	}
+
+	BeforeEach(func() {
+		file, err := ioutil.TempFile("", "reloadable-config")
+		Ω(err).ShouldNot(HaveOccurred())
+
+		file.Close()
+		path = file.Name()
+
+		defaults = Config{
+			LogLevel:                 "info",
+			DenyNetworks:             []string{"10.0.0.0/8"},
+			AllowNetworks:            []string{""},
+			RegistryCredentialHelper: "/some/helper",
+			DefaultRLimits: RLimits{
+				Nofile: uint64ptr(1024),
+				Core:   uint64ptr(0),
+			},
+		}
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(path)
+	})
+
+	write := func(contents string) {
+		err := ioutil.WriteFile(path, []byte(contents), 0644)
+		Ω(err).ShouldNot(HaveOccurred())
+	}
+
+	It("reads the configuration over the defaults", func() {
+		write(`{
+			"LogLevel": "debug",
+			"AllowNetworks": ["10.1.0.0/16", "10.2.3.4"],
+			"RegistryCredentialHelper": "",
+			"DefaultRLimits": {"Nproc": 512, "Core": null}
+		}`)
+
+		config, err := Load(path, defaults)
+		Ω(err).ShouldNot(HaveOccurred())
+
+		Ω(config).Should(Equal(Config{
+			LogLevel:                 "debug",
+			DenyNetworks:             []string{"10.0.0.0/8"},
+			AllowNetworks:            []string{"10.1.0.0/16", "10.2.3.4"},
+			RegistryCredentialHelper: "",
+			DefaultRLimits: RLimits{
+				Nofile: uint64ptr(1024),
+				Nproc:  uint64ptr(512),
+			},
+		}))
+	})
+
+	It("leaves the defaults alone", func() {
+		write(`{"DenyNetworks": ["1.2.3.0/24"], "DefaultRLimits": {"Nofile": 4096}}`)
+
+		_, err := Load(path, defaults)
+		Ω(err).ShouldNot(HaveOccurred())
+
+		Ω(defaults.DenyNetworks).Should(Equal([]string{"10.0.0.0/8"}))
+		Ω(*defaults.DefaultRLimits.Nofile).Should(Equal(uint64(1024)))
+	})
+
+	Describe("converting the limits", func() {
+		It("sets the limits given", func() {
+			limits := defaults.DefaultRLimits.ResourceLimits()
+
+			Ω(limits.Nofile).Should(Equal(uint64ptr(1024)))
+			Ω(limits.Nproc).Should(BeNil())
+			Ω(limits.Core).Should(Equal(uint64ptr(0)))
+		})
+	})
+
+	Context("when the file does not exist", func() {
+		It("returns an error", func() {
+			_, err := Load("/does/not/exist", defaults)
+			Ω(err).Should(HaveOccurred())
+		})
+	})
+
+	Context("when the file is not JSON", func() {
+		It("returns an error", func() {
+			write("LogLevel: debug")
+
+			_, err := Load(path, defaults)
+			Ω(err).Should(HaveOccurred())
+		})
+	})
+
+	Context("when the log level is unknown", func() {
+		It("returns an UnknownLogLevelError", func() {
+			write(`{"LogLevel": "loud"}`)
+
+			_, err := Load(path, defaults)
+			Ω(err).Should(Equal(logging.UnknownLogLevelError{Level: "loud"}))
+		})
+	})
+
+	Context("when a network is malformed", func() {
+		It("returns a MalformedNetworkError", func() {
+			write(`{"DenyNetworks": ["10.0.0.0/8", "bogus"]}`)
+
+			_, err := Load(path, defaults)
+			Ω(err).Should(Equal(MalformedNetworkError{Network: "bogus"}))
+		})
+	})
+})
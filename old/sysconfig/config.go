@@ -3,6 +3,11 @@ package sysconfig
 import "fmt"
 
 type Config struct {
+	Tag string
+
+	// held for as long as a server runs with the tag
+	LockPath string
+
 	CgroupPath             string
 	NetworkInterfacePrefix string
 	IPTables               IPTablesConfig
@@ -27,6 +32,10 @@ type IPTablesNATConfig struct {
 
 func NewConfig(tag string) Config {
 	return Config{
+		Tag: tag,
+
+		LockPath: fmt.Sprintf("/tmp/garden-%s.lock", tag),
+
 		NetworkInterfacePrefix: fmt.Sprintf("w%s", tag),
 
 		CgroupPath: fmt.Sprintf("/tmp/garden-%s/cgroup", tag),
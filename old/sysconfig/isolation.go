@@ -0,0 +1,124 @@
+package sysconfig
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"syscall"
+
+	"github.com/cloudfoundry/gunk/command_runner"
+)
+
+// MaxTagLength leaves at least 8 characters of each container's ID in its
+// interface names, which are limited to 15, and in its iptables chain
+// names, which are limited to 28.
+const MaxTagLength = 4
+
+type InvalidTagError struct {
+	Tag    string
+	Reason string
+}
+
+func (e InvalidTagError) Error() string {
+	return fmt.Sprintf("invalid tag %q: %s", e.Tag, e.Reason)
+}
+
+type InstanceCollisionError struct {
+	Tag    string
+	Reason string
+}
+
+func (e InstanceCollisionError) Error() string {
+	return fmt.Sprintf("another server may be running alongside tag %q: %s", e.Tag, e.Reason)
+}
+
+// Validate checks that the tag namespaces the host-wide things the server
+// sets up. Being only letters and digits, no other tag's iptables chains
+// begin with this one's, as with "a" and "a-instance", so tearing down one
+// server's chains cannot remove another's.
+func (config Config) Validate() error {
+	if len(config.Tag) > MaxTagLength {
+		return InvalidTagError{config.Tag, fmt.Sprintf("must be at most %d characters", MaxTagLength)}
+	}
+
+	for _, c := range config.Tag {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9') {
+			return InvalidTagError{config.Tag, "must be only letters and digits"}
+		}
+	}
+
+	return nil
+}
+
+// Claim takes the tag's lock, failing if another server holds it. The lock
+// is held until the returned file is closed, or the server exits.
+func (config Config) Claim() (*os.File, error) {
+	lock, err := os.OpenFile(config.LockPath, os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	err = syscall.Flock(int(lock.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+	if err != nil {
+		lock.Close()
+
+		if err == syscall.EWOULDBLOCK {
+			return nil, InstanceCollisionError{config.Tag, config.LockPath + " is locked"}
+		}
+
+		return nil, err
+	}
+
+	return lock, nil
+}
+
+// CheckForwardRules fails if a server with another tag forwards traffic from
+// interfaces whose names overlap with this server's. Interface prefixes are
+// not unique as chains are; an untagged server's w+ matches every tagged
+// server's interfaces, sending their traffic through its chains too.
+func (config Config) CheckForwardRules(runner command_runner.CommandRunner) error {
+	rules := new(bytes.Buffer)
+
+	list := exec.Command("iptables", "-w", "-S", "FORWARD")
+	list.Stdout = rules
+
+	err := runner.Run(list)
+	if err != nil {
+		return err
+	}
+
+	for _, rule := range strings.Split(rules.String(), "\n") {
+		fields := strings.Fields(rule)
+
+		var iface, chain string
+		for i := 0; i+1 < len(fields); i++ {
+			switch fields[i] {
+			case "-i", "--in-interface":
+				iface = fields[i+1]
+			case "-j", "--jump", "-g", "--goto":
+				chain = fields[i+1]
+			}
+		}
+
+		if !strings.HasSuffix(iface, "+") || !strings.HasPrefix(chain, "w-") || !strings.HasSuffix(chain, "-forward") {
+			continue
+		}
+
+		if chain == config.IPTables.Filter.ForwardChain {
+			continue
+		}
+
+		prefix := strings.TrimSuffix(iface, "+")
+
+		if strings.HasPrefix(prefix, config.NetworkInterfacePrefix) || strings.HasPrefix(config.NetworkInterfacePrefix, prefix) {
+			return InstanceCollisionError{
+				Tag:    config.Tag,
+				Reason: fmt.Sprintf("%s forwards traffic from %s, which overlaps with %s+", chain, iface, config.NetworkInterfacePrefix),
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,163 @@
+package sysconfig_test
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path"
+
+	"github.com/cloudfoundry/gunk/command_runner/fake_command_runner"
+	. "github.com/cloudfoundry/gunk/command_runner/fake_command_runner/matchers"
+
+	"github.com/cloudfoundry-incubator/garden-linux/old/sysconfig"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Isolating servers by tag", func() {
+	Describe("Validate", func() {
+		It("accepts no tag, and short tags of letters and digits", func() {
+			for _, tag := range []string{"", "0", "ab12"} {
+				Ω(sysconfig.NewConfig(tag).Validate()).Should(BeNil())
+			}
+		})
+
+		It("namespaces every host-wide name by the tag", func() {
+			config := sysconfig.NewConfig("ab12")
+
+			for _, name := range []string{
+				config.LockPath,
+				config.CgroupPath,
+				config.NetworkInterfacePrefix,
+				config.IPTables.Filter.ForwardChain,
+				config.IPTables.Filter.DefaultChain,
+				config.IPTables.Filter.InstancePrefix,
+				config.IPTables.NAT.PreroutingChain,
+				config.IPTables.NAT.PostroutingChain,
+				config.IPTables.NAT.InstancePrefix,
+			} {
+				Ω(name).Should(ContainSubstring("ab12"))
+			}
+		})
+
+		It("rejects tags that are too long", func() {
+			err := sysconfig.NewConfig("abcde").Validate()
+			Ω(err).Should(Equal(sysconfig.InvalidTagError{
+				Tag:    "abcde",
+				Reason: "must be at most 4 characters",
+			}))
+		})
+
+		It("rejects tags that would let one server's chains prefix another's", func() {
+			err := sysconfig.NewConfig("a-b").Validate()
+			Ω(err).Should(Equal(sysconfig.InvalidTagError{
+				Tag:    "a-b",
+				Reason: "must be only letters and digits",
+			}))
+		})
+	})
+
+	Describe("Claim", func() {
+		var config sysconfig.Config
+		var lockDir string
+
+		BeforeEach(func() {
+			var err error
+
+			lockDir, err = ioutil.TempDir("", "sysconfig")
+			Ω(err).ShouldNot(HaveOccurred())
+
+			config = sysconfig.NewConfig("0")
+			config.LockPath = path.Join(lockDir, "garden-0.lock")
+		})
+
+		AfterEach(func() {
+			os.RemoveAll(lockDir)
+		})
+
+		It("fails while another server holds the tag", func() {
+			lock, err := config.Claim()
+			Ω(err).ShouldNot(HaveOccurred())
+
+			_, err = config.Claim()
+			Ω(err).Should(Equal(sysconfig.InstanceCollisionError{
+				Tag:    "0",
+				Reason: config.LockPath + " is locked",
+			}))
+
+			lock.Close()
+
+			lock, err = config.Claim()
+			Ω(err).ShouldNot(HaveOccurred())
+
+			lock.Close()
+		})
+	})
+
+	Describe("CheckForwardRules", func() {
+		var fakeRunner *fake_command_runner.FakeCommandRunner
+		var forwardRules string
+
+		BeforeEach(func() {
+			fakeRunner = fake_command_runner.New()
+			forwardRules = "-P FORWARD ACCEPT\n"
+
+			fakeRunner.WhenRunning(fake_command_runner.CommandSpec{
+				Path: "iptables",
+			}, func(cmd *exec.Cmd) error {
+				cmd.Stdout.Write([]byte(forwardRules))
+				return nil
+			})
+		})
+
+		It("lists the host's forward rules", func() {
+			err := sysconfig.NewConfig("1").CheckForwardRules(fakeRunner)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(fakeRunner).Should(HaveExecutedSerially(fake_command_runner.CommandSpec{
+				Path: "iptables",
+				Args: []string{"-w", "-S", "FORWARD"},
+			}))
+		})
+
+		It("ignores its own rule, left from its last run", func() {
+			forwardRules += "-A FORWARD -i w1+ -j w-1-forward\n"
+
+			err := sysconfig.NewConfig("1").CheckForwardRules(fakeRunner)
+			Ω(err).ShouldNot(HaveOccurred())
+		})
+
+		It("ignores servers whose interfaces do not overlap", func() {
+			forwardRules += "-A FORWARD -i w2+ -j w-2-forward\n"
+
+			err := sysconfig.NewConfig("1").CheckForwardRules(fakeRunner)
+			Ω(err).ShouldNot(HaveOccurred())
+		})
+
+		Context("when an untagged server forwards every server's interfaces", func() {
+			BeforeEach(func() {
+				forwardRules += "-A FORWARD -i w+ -j w--forward\n"
+			})
+
+			It("returns an InstanceCollisionError", func() {
+				err := sysconfig.NewConfig("1").CheckForwardRules(fakeRunner)
+				Ω(err).Should(Equal(sysconfig.InstanceCollisionError{
+					Tag:    "1",
+					Reason: "w--forward forwards traffic from w+, which overlaps with w1+",
+				}))
+			})
+		})
+
+		Context("when another server's interfaces begin with this one's", func() {
+			BeforeEach(func() {
+				forwardRules += "-A FORWARD -i w12+ -j w-12-forward\n"
+			})
+
+			It("returns an InstanceCollisionError", func() {
+				err := sysconfig.NewConfig("1").CheckForwardRules(fakeRunner)
+				Ω(err).Should(BeAssignableToTypeOf(sysconfig.InstanceCollisionError{}))
+			})
+		})
+	})
+})
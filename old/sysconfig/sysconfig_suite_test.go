@@ -0,0 +1,13 @@
+package sysconfig_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"testing"
+)
+
+func TestSysconfig(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Sysconfig Suite")
+}
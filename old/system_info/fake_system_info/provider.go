@@ -6,6 +6,18 @@ type FakeProvider struct {
 
 	TotalDiskResult uint64
 	TotalDiskError  error
+
+	FreeMemoryResult uint64
+	FreeMemoryError  error
+
+	FreeDiskResult uint64
+	FreeDiskError  error
+
+	BootIDResult string
+	BootIDError  error
+
+	HostMTUResult uint32
+	HostMTUError  error
 }
 
 func NewFakeProvider() *FakeProvider {
@@ -27,3 +39,35 @@ func (provider *FakeProvider) TotalDisk() (uint64, error) {
 
 	return provider.TotalDiskResult, nil
 }
+
+func (provider *FakeProvider) FreeMemory() (uint64, error) {
+	if provider.FreeMemoryError != nil {
+		return 0, provider.FreeMemoryError
+	}
+
+	return provider.FreeMemoryResult, nil
+}
+
+func (provider *FakeProvider) FreeDisk() (uint64, error) {
+	if provider.FreeDiskError != nil {
+		return 0, provider.FreeDiskError
+	}
+
+	return provider.FreeDiskResult, nil
+}
+
+func (provider *FakeProvider) BootID() (string, error) {
+	if provider.BootIDError != nil {
+		return "", provider.BootIDError
+	}
+
+	return provider.BootIDResult, nil
+}
+
+func (provider *FakeProvider) HostMTU() (uint32, error) {
+	if provider.HostMTUError != nil {
+		return 0, provider.HostMTUError
+	}
+
+	return provider.HostMTUResult, nil
+}
@@ -1,12 +1,38 @@
 package system_info
 
 import (
+	"bufio"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+
 	"github.com/cloudfoundry/gosigar"
 )
 
+const (
+	bootIDPath     = "/proc/sys/kernel/random/boot_id"
+	routesPath     = "/proc/net/route"
+	interfacesPath = "/sys/class/net"
+)
+
+var ErrNoDefaultRoute = errors.New("host has no default route")
+
 type Provider interface {
 	TotalMemory() (uint64, error)
 	TotalDisk() (uint64, error)
+
+	FreeMemory() (uint64, error)
+	FreeDisk() (uint64, error)
+
+	// BootID changes every time the host boots.
+	BootID() (string, error)
+
+	// HostMTU is the MTU of the interface the host's default route goes
+	// through, which containers' traffic leaves by.
+	HostMTU() (uint32, error)
 }
 
 type provider struct {
@@ -41,6 +67,75 @@ func (provider *provider) TotalDisk() (uint64, error) {
 	return fromKBytesToBytes(disk.Total), nil
 }
 
+// FreeMemory counts memory used for buffers and cache as free, as the
+// kernel gives it up when needed.
+func (provider *provider) FreeMemory() (uint64, error) {
+	mem := sigar.Mem{}
+
+	err := mem.Get()
+	if err != nil {
+		return 0, err
+	}
+
+	return mem.ActualFree, nil
+}
+
+func (provider *provider) FreeDisk() (uint64, error) {
+	disk := sigar.FileSystemUsage{}
+
+	err := disk.Get(provider.depotPath)
+	if err != nil {
+		return 0, err
+	}
+
+	return fromKBytesToBytes(disk.Avail), nil
+}
+
+func (provider *provider) BootID() (string, error) {
+	contents, err := ioutil.ReadFile(bootIDPath)
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimSpace(string(contents)), nil
+}
+
+func (provider *provider) HostMTU() (uint32, error) {
+	routes, err := os.Open(routesPath)
+	if err != nil {
+		return 0, err
+	}
+
+	defer routes.Close()
+
+	iface := ""
+
+	scanner := bufio.NewScanner(routes)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) > 1 && fields[1] == "00000000" {
+			iface = fields[0]
+			break
+		}
+	}
+
+	if iface == "" {
+		return 0, ErrNoDefaultRoute
+	}
+
+	contents, err := ioutil.ReadFile(path.Join(interfacesPath, iface, "mtu"))
+	if err != nil {
+		return 0, err
+	}
+
+	mtu, err := strconv.ParseUint(strings.TrimSpace(string(contents)), 10, 32)
+	if err != nil {
+		return 0, err
+	}
+
+	return uint32(mtu), nil
+}
+
 func fromKBytesToBytes(kbytes uint64) uint64 {
 	return kbytes * 1024
 }
@@ -24,4 +24,40 @@ var _ = Describe("SystemInfo", func() {
 		Ω(totalMemory).Should(BeNumerically(">", 0))
 		Ω(totalDisk).Should(BeNumerically(">", 0))
 	})
+
+	It("provides free memory and disk no greater than the totals", func() {
+		totalMemory, err := provider.TotalMemory()
+		Ω(err).ShouldNot(HaveOccurred())
+
+		freeMemory, err := provider.FreeMemory()
+		Ω(err).ShouldNot(HaveOccurred())
+
+		totalDisk, err := provider.TotalDisk()
+		Ω(err).ShouldNot(HaveOccurred())
+
+		freeDisk, err := provider.FreeDisk()
+		Ω(err).ShouldNot(HaveOccurred())
+
+		Ω(freeMemory).Should(BeNumerically(">", 0))
+		Ω(freeMemory).Should(BeNumerically("<=", totalMemory))
+		Ω(freeDisk).Should(BeNumerically("<=", totalDisk))
+	})
+
+	It("provides the host's boot ID, the same every time", func() {
+		bootID, err := provider.BootID()
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(bootID).ShouldNot(BeEmpty())
+
+		Ω(provider.BootID()).Should(Equal(bootID))
+	})
+
+	It("provides the MTU of the host's default route's interface, if it has one", func() {
+		mtu, err := provider.HostMTU()
+		if err == ErrNoDefaultRoute {
+			return
+		}
+
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(mtu).Should(BeNumerically(">=", 68))
+	})
 })
@@ -0,0 +1,38 @@
+package fake_sink
+
+import (
+	"sync"
+
+	"github.com/cloudfoundry-incubator/garden-linux/old/usage_exporter"
+)
+
+// FakeSink records the records it is given, in order, unless given a
+// WriteError. WhenWriting, if set, is called first with each write.
+type FakeSink struct {
+	WriteError  error
+	WhenWriting func()
+
+	Written []usage_exporter.Record
+	Writes  int
+
+	mutex sync.Mutex
+}
+
+func (sink *FakeSink) Write(records []usage_exporter.Record) error {
+	if sink.WhenWriting != nil {
+		sink.WhenWriting()
+	}
+
+	sink.mutex.Lock()
+	defer sink.mutex.Unlock()
+
+	sink.Writes++
+
+	if sink.WriteError != nil {
+		return sink.WriteError
+	}
+
+	sink.Written = append(sink.Written, records...)
+
+	return nil
+}
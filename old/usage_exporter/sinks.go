@@ -0,0 +1,210 @@
+package usage_exporter
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"time"
+)
+
+// Format is how records are written: CSV, with a header and tags encoded as
+// a query string, or JSON, one object per line.
+type Format string
+
+const (
+	CSV  Format = "csv"
+	JSON Format = "json"
+)
+
+type UnknownFormatError struct {
+	Format string
+}
+
+func (e UnknownFormatError) Error() string {
+	return fmt.Sprintf("unknown usage export format: %s", e.Format)
+}
+
+func ParseFormat(format string) (Format, error) {
+	switch Format(format) {
+	case CSV, JSON:
+		return Format(format), nil
+	default:
+		return "", UnknownFormatError{format}
+	}
+}
+
+var csvHeader = []string{
+	"sequence",
+	"handle",
+	"start",
+	"end",
+	"tags",
+	"cpu_seconds",
+	"memory_byte_hours",
+	"disk_byte_hours",
+	"disk_bytes_written",
+	"network_bytes_received",
+	"network_bytes_sent",
+	"final",
+}
+
+// encode writes the records, with CSV's header if asked for.
+func (format Format) encode(records []Record, header bool) ([]byte, error) {
+	buffer := new(bytes.Buffer)
+
+	switch format {
+	case CSV:
+		writer := csv.NewWriter(buffer)
+
+		if header {
+			writer.Write(csvHeader)
+		}
+
+		for _, record := range records {
+			writer.Write([]string{
+				strconv.FormatUint(record.Sequence, 10),
+				record.Handle,
+				record.Start.UTC().Format(time.RFC3339Nano),
+				record.End.UTC().Format(time.RFC3339Nano),
+				encodeTags(record.Tags),
+				strconv.FormatFloat(record.CPUSeconds, 'f', -1, 64),
+				strconv.FormatFloat(record.MemoryByteHours, 'f', -1, 64),
+				strconv.FormatFloat(record.DiskByteHours, 'f', -1, 64),
+				strconv.FormatUint(record.DiskBytesWritten, 10),
+				strconv.FormatUint(record.NetworkBytesReceived, 10),
+				strconv.FormatUint(record.NetworkBytesSent, 10),
+				strconv.FormatBool(record.Final),
+			})
+		}
+
+		writer.Flush()
+
+		err := writer.Error()
+		if err != nil {
+			return nil, err
+		}
+
+	case JSON:
+		encoder := json.NewEncoder(buffer)
+
+		for _, record := range records {
+			err := encoder.Encode(record)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+	default:
+		return nil, UnknownFormatError{string(format)}
+	}
+
+	return buffer.Bytes(), nil
+}
+
+// encodeTags encodes tags as a query string, e.g. app_id=x&space_id=y, in
+// a single CSV column however many there are.
+func encodeTags(tags map[string]string) string {
+	values := url.Values{}
+	for key, value := range tags {
+		values.Set(key, value)
+	}
+
+	return values.Encode()
+}
+
+func (format Format) contentType() string {
+	if format == CSV {
+		return "text/csv"
+	}
+
+	return "application/x-ndjson"
+}
+
+type fileSink struct {
+	path   string
+	format Format
+}
+
+// NewFileSink appends records to the file, creating it if need be. A CSV
+// file's header is written when it is created.
+func NewFileSink(path string, format Format) Sink {
+	return &fileSink{
+		path:   path,
+		format: format,
+	}
+}
+
+func (sink *fileSink) Write(records []Record) error {
+	file, err := os.OpenFile(sink.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+
+	encoded, err := sink.format.encode(records, info.Size() == 0)
+	if err != nil {
+		return err
+	}
+
+	_, err = file.Write(encoded)
+	if err != nil {
+		return err
+	}
+
+	return file.Sync()
+}
+
+type UnexpectedStatusError struct {
+	StatusCode int
+}
+
+func (e UnexpectedStatusError) Error() string {
+	return fmt.Sprintf("usage export sink responded with status %d", e.StatusCode)
+}
+
+type httpSink struct {
+	url    string
+	format Format
+	client *http.Client
+}
+
+// NewHTTPSink POSTs records to the URL, each time with CSV's header. Records
+// are delivered once it responds with a 2xx status.
+func NewHTTPSink(url string, format Format, client *http.Client) Sink {
+	return &httpSink{
+		url:    url,
+		format: format,
+		client: client,
+	}
+}
+
+func (sink *httpSink) Write(records []Record) error {
+	encoded, err := sink.format.encode(records, true)
+	if err != nil {
+		return err
+	}
+
+	response, err := sink.client.Post(sink.url, sink.format.contentType(), bytes.NewReader(encoded))
+	if err != nil {
+		return err
+	}
+
+	response.Body.Close()
+
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		return UnexpectedStatusError{response.StatusCode}
+	}
+
+	return nil
+}
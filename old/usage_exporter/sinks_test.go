@@ -0,0 +1,165 @@
+package usage_exporter_test
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/cloudfoundry-incubator/garden-linux/old/usage_exporter"
+)
+
+var _ = Describe("Sinks", func() {
+	start := time.Date(2015, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	records := []usage_exporter.Record{
+		{
+			Sequence:             7,
+			Handle:               "some-handle",
+			Start:                start,
+			End:                  start.Add(time.Minute),
+			Tags:                 map[string]string{"app_id": "some-app", "space_id": "some space"},
+			CPUSeconds:           1.5,
+			MemoryByteHours:      1024,
+			DiskByteHours:        2048,
+			DiskBytesWritten:     1,
+			NetworkBytesReceived: 2,
+			NetworkBytesSent:     3,
+			Final:                true,
+		},
+	}
+
+	Describe("ParseFormat", func() {
+		It("parses csv and json", func() {
+			Ω(usage_exporter.ParseFormat("csv")).Should(Equal(usage_exporter.CSV))
+			Ω(usage_exporter.ParseFormat("json")).Should(Equal(usage_exporter.JSON))
+		})
+
+		It("returns an error for anything else", func() {
+			_, err := usage_exporter.ParseFormat("xml")
+			Ω(err).Should(Equal(usage_exporter.UnknownFormatError{"xml"}))
+		})
+	})
+
+	Describe("a file sink", func() {
+		var tmpdir string
+		var sinkPath string
+
+		BeforeEach(func() {
+			var err error
+
+			tmpdir, err = ioutil.TempDir("", "usage-sink")
+			Ω(err).ShouldNot(HaveOccurred())
+
+			sinkPath = path.Join(tmpdir, "usage")
+		})
+
+		AfterEach(func() {
+			os.RemoveAll(tmpdir)
+		})
+
+		Context("with CSV", func() {
+			It("writes the header once, then appends records", func() {
+				sink := usage_exporter.NewFileSink(sinkPath, usage_exporter.CSV)
+
+				err := sink.Write(records)
+				Ω(err).ShouldNot(HaveOccurred())
+
+				err = sink.Write(records)
+				Ω(err).ShouldNot(HaveOccurred())
+
+				contents, err := ioutil.ReadFile(sinkPath)
+				Ω(err).ShouldNot(HaveOccurred())
+
+				row := "7,some-handle,2015-03-01T12:00:00Z,2015-03-01T12:01:00Z,app_id=some-app&space_id=some+space,1.5,1024,2048,1,2,3,true\n"
+
+				Ω(string(contents)).Should(Equal(
+					"sequence,handle,start,end,tags,cpu_seconds,memory_byte_hours,disk_byte_hours,disk_bytes_written,network_bytes_received,network_bytes_sent,final\n" +
+						row + row,
+				))
+			})
+		})
+
+		Context("with JSON", func() {
+			It("appends a line per record", func() {
+				sink := usage_exporter.NewFileSink(sinkPath, usage_exporter.JSON)
+
+				err := sink.Write(records)
+				Ω(err).ShouldNot(HaveOccurred())
+
+				err = sink.Write(records)
+				Ω(err).ShouldNot(HaveOccurred())
+
+				contents, err := ioutil.ReadFile(sinkPath)
+				Ω(err).ShouldNot(HaveOccurred())
+
+				line := `{"Sequence":7,"Handle":"some-handle","Start":"2015-03-01T12:00:00Z","End":"2015-03-01T12:01:00Z","Tags":{"app_id":"some-app","space_id":"some space"},"CPUSeconds":1.5,"MemoryByteHours":1024,"DiskByteHours":2048,"DiskBytesWritten":1,"NetworkBytesReceived":2,"NetworkBytesSent":3,"Final":true}` + "\n"
+
+				Ω(string(contents)).Should(Equal(line + line))
+			})
+		})
+
+		Context("when the file cannot be opened", func() {
+			It("returns an error", func() {
+				sink := usage_exporter.NewFileSink(path.Join(tmpdir, "missing", "usage"), usage_exporter.JSON)
+
+				err := sink.Write(records)
+				Ω(err).Should(HaveOccurred())
+			})
+		})
+	})
+
+	Describe("an HTTP sink", func() {
+		var server *httptest.Server
+
+		var status int
+		var contentType string
+		var body string
+
+		BeforeEach(func() {
+			status = http.StatusOK
+
+			server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				contentType = r.Header.Get("Content-Type")
+
+				contents, _ := ioutil.ReadAll(r.Body)
+				body = string(contents)
+
+				w.WriteHeader(status)
+			}))
+		})
+
+		AfterEach(func() {
+			server.Close()
+		})
+
+		It("POSTs the records", func() {
+			sink := usage_exporter.NewHTTPSink(server.URL, usage_exporter.CSV, http.DefaultClient)
+
+			err := sink.Write(records)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(contentType).Should(Equal("text/csv"))
+			Ω(body).Should(HavePrefix("sequence,handle,"))
+			Ω(body).Should(ContainSubstring("7,some-handle,"))
+		})
+
+		Context("when the server responds with a non-2xx status", func() {
+			BeforeEach(func() {
+				status = http.StatusServiceUnavailable
+			})
+
+			It("returns an error", func() {
+				sink := usage_exporter.NewHTTPSink(server.URL, usage_exporter.JSON, http.DefaultClient)
+
+				err := sink.Write(records)
+				Ω(err).Should(Equal(usage_exporter.UnexpectedStatusError{http.StatusServiceUnavailable}))
+			})
+		})
+	})
+})
@@ -0,0 +1,283 @@
+// Package usage_exporter turns containers' usage, observed periodically,
+// into records of what each used over each interval (CPU seconds, byte-hours
+// of memory and disk, and disk and network bytes) for chargeback pipelines
+// that cannot scrape metrics. Records are delivered to a sink at least
+// once: those not yet delivered, and what each container had used when last
+// observed, are kept in a state file, so that neither a failing sink nor a
+// restart loses them.
+package usage_exporter
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path"
+	"sync"
+	"time"
+
+	"github.com/pivotal-golang/lager"
+
+	"github.com/cloudfoundry-incubator/garden-linux/old/linux_backend"
+)
+
+// Record is what a container used from Start to End.
+type Record struct {
+	// increases by one with each record, so that consumers can discard
+	// records delivered more than once
+	Sequence uint64
+
+	Handle string
+	Start  time.Time
+	End    time.Time
+
+	// the container's metric tags, e.g. the tenant it belongs to
+	Tags map[string]string
+
+	CPUSeconds      float64
+	MemoryByteHours float64
+	DiskByteHours   float64
+
+	DiskBytesWritten     uint64
+	NetworkBytesReceived uint64
+	NetworkBytesSent     uint64
+
+	// the container was destroyed at End, and has no further records
+	Final bool
+}
+
+// Sink delivers records, or fails to deliver any of them.
+type Sink interface {
+	Write(records []Record) error
+}
+
+type Exporter struct {
+	sink      Sink
+	statePath string
+
+	// the most records kept for delivery; the oldest are dropped beyond it
+	maxPending int
+
+	logger lager.Logger
+
+	state      exporterState
+	stateMutex sync.Mutex
+
+	flushMutex sync.Mutex
+}
+
+type exporterState struct {
+	NextSequence uint64
+
+	// by handle
+	Observed map[string]observation
+
+	Pending []Record
+}
+
+type observation struct {
+	Time  time.Time
+	Usage linux_backend.UsageSummary
+}
+
+// New returns an exporter that continues from the state at statePath, if
+// any.
+func New(sink Sink, statePath string, maxPending int, logger lager.Logger) (*Exporter, error) {
+	exporter := &Exporter{
+		sink:       sink,
+		statePath:  statePath,
+		maxPending: maxPending,
+
+		logger: logger.Session("usage-exporter"),
+
+		state: exporterState{
+			Observed: map[string]observation{},
+		},
+	}
+
+	contents, err := ioutil.ReadFile(statePath)
+	if os.IsNotExist(err) {
+		return exporter, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	err = json.Unmarshal(contents, &exporter.state)
+	if err != nil {
+		return nil, err
+	}
+
+	if exporter.state.Observed == nil {
+		exporter.state.Observed = map[string]observation{}
+	}
+
+	return exporter, nil
+}
+
+// Observe records what the container has used since it was last observed.
+// A container's first record covers what it used since it was created,
+// though without its byte-hours, which cannot be known.
+func (e *Exporter) Observe(handle string, tags map[string]string, at time.Time, usage linux_backend.UsageSummary) {
+	e.stateMutex.Lock()
+	defer e.stateMutex.Unlock()
+
+	e.observe(handle, tags, observation{Time: at, Usage: usage}, false)
+}
+
+// ObserveFinal records what the container has used since it was last
+// observed, as its last record, and saves it so that it is not lost with
+// the container.
+func (e *Exporter) ObserveFinal(handle string, tags map[string]string, at time.Time, usage linux_backend.UsageSummary) {
+	e.stateMutex.Lock()
+	defer e.stateMutex.Unlock()
+
+	e.observe(handle, tags, observation{Time: at, Usage: usage}, true)
+
+	delete(e.state.Observed, handle)
+
+	err := e.saveState()
+	if err != nil {
+		e.logger.Error("failed-to-save-state", err)
+	}
+}
+
+func (e *Exporter) observe(handle string, tags map[string]string, current observation, final bool) {
+	last, found := e.state.Observed[handle]
+	if !found {
+		last = observation{Time: current.Time}
+	}
+
+	record := usageBetween(last, current)
+	record.Sequence = e.state.NextSequence
+	record.Handle = handle
+	record.Tags = tags
+	record.Final = final
+
+	e.state.NextSequence++
+	e.state.Pending = append(e.state.Pending, record)
+	e.state.Observed[handle] = current
+}
+
+// Flush delivers the records not yet delivered. Records are kept until they
+// are, up to the exporter's maximum. The state is saved either way.
+//
+// Containers may be observed while the sink is being written to; only one
+// flush runs at a time.
+func (e *Exporter) Flush() error {
+	e.flushMutex.Lock()
+	defer e.flushMutex.Unlock()
+
+	e.stateMutex.Lock()
+	batch := make([]Record, len(e.state.Pending))
+	copy(batch, e.state.Pending)
+	e.stateMutex.Unlock()
+
+	var writeErr error
+
+	if len(batch) > 0 {
+		writeErr = e.sink.Write(batch)
+	}
+
+	e.stateMutex.Lock()
+	defer e.stateMutex.Unlock()
+
+	if len(batch) > 0 {
+		if writeErr == nil {
+			e.state.Pending = recordsAfter(e.state.Pending, batch[len(batch)-1].Sequence)
+		} else if len(e.state.Pending) > e.maxPending {
+			dropped := len(e.state.Pending) - e.maxPending
+
+			e.logger.Error("dropped-records", writeErr, lager.Data{
+				"dropped": dropped,
+				"through": e.state.Pending[dropped-1].Sequence,
+			})
+
+			e.state.Pending = e.state.Pending[dropped:]
+		}
+	}
+
+	err := e.saveState()
+	if err != nil {
+		return err
+	}
+
+	return writeErr
+}
+
+// recordsAfter is the records recorded after the one with the given
+// sequence, i.e. those observed during a flush that delivered it.
+func recordsAfter(records []Record, sequence uint64) []Record {
+	for i, record := range records {
+		if record.Sequence > sequence {
+			return records[i:]
+		}
+	}
+
+	return nil
+}
+
+// Pending is how many records have not yet been delivered.
+func (e *Exporter) Pending() int {
+	e.stateMutex.Lock()
+	defer e.stateMutex.Unlock()
+
+	return len(e.state.Pending)
+}
+
+// saveState replaces the state file, all at once, so that a crash leaves
+// either the old state or the new.
+func (e *Exporter) saveState() error {
+	contents, err := json.Marshal(e.state)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := ioutil.TempFile(path.Dir(e.statePath), path.Base(e.statePath))
+	if err != nil {
+		return err
+	}
+
+	_, err = tmp.Write(contents)
+	if err == nil {
+		err = tmp.Sync()
+	}
+
+	tmp.Close()
+
+	if err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	return os.Rename(tmp.Name(), e.statePath)
+}
+
+// usageBetween is what was used between the observations. Byte-hours assume
+// that usage changed steadily from one to the other.
+func usageBetween(last, current observation) Record {
+	hours := current.Time.Sub(last.Time).Hours()
+
+	return Record{
+		Start: last.Time,
+		End:   current.Time,
+
+		CPUSeconds:      float64(counterDelta(last.Usage.CPUTime, current.Usage.CPUTime)) / float64(time.Second),
+		MemoryByteHours: float64(last.Usage.MemoryBytes+current.Usage.MemoryBytes) / 2 * hours,
+		DiskByteHours:   float64(last.Usage.DiskBytes+current.Usage.DiskBytes) / 2 * hours,
+
+		DiskBytesWritten:     counterDelta(last.Usage.DiskBytesWritten, current.Usage.DiskBytesWritten),
+		NetworkBytesReceived: counterDelta(last.Usage.NetworkBytesReceived, current.Usage.NetworkBytesReceived),
+		NetworkBytesSent:     counterDelta(last.Usage.NetworkBytesSent, current.Usage.NetworkBytesSent),
+	}
+}
+
+// counterDelta is how much a counter increased. A counter that went down
+// was reset, e.g. by its interface being recreated, so counts from zero.
+func counterDelta(last, current uint64) uint64 {
+	if current < last {
+		return current
+	}
+
+	return current - last
+}
@@ -0,0 +1,13 @@
+package usage_exporter_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"testing"
+)
+
+func TestUsageExporter(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Usage Exporter Suite")
+}
@@ -0,0 +1,291 @@
+package usage_exporter_test
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/pivotal-golang/lager/lagertest"
+
+	"github.com/cloudfoundry-incubator/garden-linux/old/linux_backend"
+	"github.com/cloudfoundry-incubator/garden-linux/old/usage_exporter"
+	"github.com/cloudfoundry-incubator/garden-linux/old/usage_exporter/fake_sink"
+)
+
+var _ = Describe("Exporting usage", func() {
+	var stateDir string
+	var statePath string
+
+	var sink *fake_sink.FakeSink
+	var exporter *usage_exporter.Exporter
+
+	start := time.Date(2015, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	newExporter := func() *usage_exporter.Exporter {
+		exporter, err := usage_exporter.New(sink, statePath, 3, lagertest.NewTestLogger("test"))
+		Ω(err).ShouldNot(HaveOccurred())
+
+		return exporter
+	}
+
+	BeforeEach(func() {
+		var err error
+
+		stateDir, err = ioutil.TempDir("", "usage-exporter")
+		Ω(err).ShouldNot(HaveOccurred())
+
+		statePath = path.Join(stateDir, "state.json")
+
+		sink = new(fake_sink.FakeSink)
+		exporter = newExporter()
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(stateDir)
+	})
+
+	It("records what each container used between observations", func() {
+		exporter.Observe("some-handle", nil, start, linux_backend.UsageSummary{
+			CPUTime:              5 * uint64(time.Second),
+			MemoryBytes:          1000,
+			DiskBytes:            4000,
+			DiskBytesWritten:     100,
+			NetworkBytesReceived: 200,
+			NetworkBytesSent:     300,
+		})
+
+		exporter.Observe("some-handle", nil, start.Add(30*time.Minute), linux_backend.UsageSummary{
+			CPUTime:              7 * uint64(time.Second),
+			MemoryBytes:          3000,
+			DiskBytes:            4000,
+			DiskBytesWritten:     150,
+			NetworkBytesReceived: 400,
+			NetworkBytesSent:     600,
+		})
+
+		err := exporter.Flush()
+		Ω(err).ShouldNot(HaveOccurred())
+
+		Ω(sink.Written).Should(HaveLen(2))
+		Ω(sink.Written[1]).Should(Equal(usage_exporter.Record{
+			Sequence: 1,
+			Handle:   "some-handle",
+			Start:    start,
+			End:      start.Add(30 * time.Minute),
+
+			CPUSeconds:      2,
+			MemoryByteHours: 1000,
+			DiskByteHours:   2000,
+
+			DiskBytesWritten:     50,
+			NetworkBytesReceived: 200,
+			NetworkBytesSent:     300,
+		}))
+	})
+
+	It("records what a container used before it was first observed, without byte-hours", func() {
+		exporter.Observe("some-handle", nil, start, linux_backend.UsageSummary{
+			CPUTime:          3 * uint64(time.Second),
+			MemoryBytes:      1000,
+			DiskBytesWritten: 100,
+		})
+
+		err := exporter.Flush()
+		Ω(err).ShouldNot(HaveOccurred())
+
+		Ω(sink.Written).Should(Equal([]usage_exporter.Record{
+			{
+				Handle:           "some-handle",
+				Start:            start,
+				End:              start,
+				CPUSeconds:       3,
+				DiskBytesWritten: 100,
+			},
+		}))
+	})
+
+	It("counts a counter that went down from zero", func() {
+		exporter.Observe("some-handle", nil, start, linux_backend.UsageSummary{NetworkBytesSent: 1000})
+		exporter.Observe("some-handle", nil, start.Add(time.Minute), linux_backend.UsageSummary{NetworkBytesSent: 10})
+
+		err := exporter.Flush()
+		Ω(err).ShouldNot(HaveOccurred())
+
+		Ω(sink.Written[1].NetworkBytesSent).Should(Equal(uint64(10)))
+	})
+
+	It("tags each record with the container's tags", func() {
+		exporter.Observe("some-handle", map[string]string{"app_id": "some-app"}, start, linux_backend.UsageSummary{})
+
+		err := exporter.Flush()
+		Ω(err).ShouldNot(HaveOccurred())
+
+		Ω(sink.Written[0].Tags).Should(Equal(map[string]string{"app_id": "some-app"}))
+	})
+
+	It("marks a container's final record", func() {
+		exporter.Observe("some-handle", nil, start, linux_backend.UsageSummary{})
+		exporter.ObserveFinal("some-handle", nil, start.Add(time.Minute), linux_backend.UsageSummary{CPUTime: uint64(time.Second)})
+
+		err := exporter.Flush()
+		Ω(err).ShouldNot(HaveOccurred())
+
+		Ω(sink.Written[1].Final).Should(BeTrue())
+		Ω(sink.Written[1].CPUSeconds).Should(Equal(1.0))
+	})
+
+	It("keeps a container's final record across a restart", func() {
+		exporter.ObserveFinal("some-handle", nil, start, linux_backend.UsageSummary{})
+
+		restarted := newExporter()
+
+		err := restarted.Flush()
+		Ω(err).ShouldNot(HaveOccurred())
+
+		Ω(sink.Written).Should(HaveLen(1))
+		Ω(sink.Written[0].Final).Should(BeTrue())
+	})
+
+	It("delivers each record once the sink takes it", func() {
+		exporter.Observe("some-handle", nil, start, linux_backend.UsageSummary{})
+
+		err := exporter.Flush()
+		Ω(err).ShouldNot(HaveOccurred())
+
+		err = exporter.Flush()
+		Ω(err).ShouldNot(HaveOccurred())
+
+		Ω(sink.Written).Should(HaveLen(1))
+		Ω(exporter.Pending()).Should(Equal(0))
+	})
+
+	It("keeps what is observed while the sink is being written to for the next flush", func() {
+		exporter.Observe("some-handle", nil, start, linux_backend.UsageSummary{})
+
+		sink.WhenWriting = func() {
+			sink.WhenWriting = nil
+			exporter.Observe("other-handle", nil, start, linux_backend.UsageSummary{})
+		}
+
+		err := exporter.Flush()
+		Ω(err).ShouldNot(HaveOccurred())
+
+		Ω(sink.Written).Should(HaveLen(1))
+		Ω(exporter.Pending()).Should(Equal(1))
+
+		err = exporter.Flush()
+		Ω(err).ShouldNot(HaveOccurred())
+
+		Ω(sink.Written).Should(HaveLen(2))
+		Ω(sink.Written[1].Handle).Should(Equal("other-handle"))
+		Ω(exporter.Pending()).Should(Equal(0))
+	})
+
+	Context("when the sink fails", func() {
+		disaster := errors.New("oh no!")
+
+		BeforeEach(func() {
+			sink.WriteError = disaster
+		})
+
+		It("returns the error, and delivers the records once it recovers", func() {
+			exporter.Observe("some-handle", nil, start, linux_backend.UsageSummary{})
+
+			err := exporter.Flush()
+			Ω(err).Should(Equal(disaster))
+			Ω(exporter.Pending()).Should(Equal(1))
+
+			sink.WriteError = nil
+
+			exporter.Observe("some-handle", nil, start.Add(time.Minute), linux_backend.UsageSummary{})
+
+			err = exporter.Flush()
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(sink.Written).Should(HaveLen(2))
+			Ω(sink.Written[0].Sequence).Should(Equal(uint64(0)))
+			Ω(sink.Written[1].Sequence).Should(Equal(uint64(1)))
+		})
+
+		It("keeps the records across a restart", func() {
+			exporter.Observe("some-handle", nil, start, linux_backend.UsageSummary{})
+
+			err := exporter.Flush()
+			Ω(err).Should(Equal(disaster))
+
+			sink.WriteError = nil
+
+			restarted := newExporter()
+
+			err = restarted.Flush()
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(sink.Written).Should(HaveLen(1))
+		})
+
+		It("drops the oldest records beyond its maximum", func() {
+			for i := 0; i < 5; i++ {
+				exporter.Observe("some-handle", nil, start.Add(time.Duration(i)*time.Minute), linux_backend.UsageSummary{})
+			}
+
+			err := exporter.Flush()
+			Ω(err).Should(Equal(disaster))
+
+			Ω(exporter.Pending()).Should(Equal(3))
+
+			sink.WriteError = nil
+
+			err = exporter.Flush()
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(sink.Written[0].Sequence).Should(Equal(uint64(2)))
+		})
+	})
+
+	Context("after a restart", func() {
+		It("continues from what each container had used", func() {
+			exporter.Observe("some-handle", nil, start, linux_backend.UsageSummary{CPUTime: uint64(time.Second)})
+
+			err := exporter.Flush()
+			Ω(err).ShouldNot(HaveOccurred())
+
+			restarted := newExporter()
+			restarted.Observe("some-handle", nil, start.Add(time.Minute), linux_backend.UsageSummary{CPUTime: 3 * uint64(time.Second)})
+
+			err = restarted.Flush()
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(sink.Written).Should(HaveLen(2))
+			Ω(sink.Written[1].Sequence).Should(Equal(uint64(1)))
+			Ω(sink.Written[1].Start).Should(Equal(start))
+			Ω(sink.Written[1].CPUSeconds).Should(Equal(2.0))
+		})
+
+		It("re-records what was observed but not flushed", func() {
+			exporter.Observe("some-handle", nil, start, linux_backend.UsageSummary{CPUTime: uint64(time.Second)})
+
+			restarted := newExporter()
+			restarted.Observe("some-handle", nil, start.Add(time.Minute), linux_backend.UsageSummary{CPUTime: 3 * uint64(time.Second)})
+
+			err := restarted.Flush()
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(sink.Written).Should(HaveLen(1))
+			Ω(sink.Written[0].CPUSeconds).Should(Equal(3.0))
+		})
+	})
+
+	Context("when the state file is corrupt", func() {
+		It("returns an error", func() {
+			err := ioutil.WriteFile(statePath, []byte("{"), 0644)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			_, err = usage_exporter.New(sink, statePath, 3, lagertest.NewTestLogger("test"))
+			Ω(err).Should(HaveOccurred())
+		})
+	})
+})
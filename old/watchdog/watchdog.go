@@ -0,0 +1,160 @@
+// Package watchdog notices the server wedging, as when a global lock is
+// never released, so that it can be restarted rather than left hanging
+// every request that needs the lock.
+package watchdog
+
+import (
+	"os"
+	"runtime"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/cloudfoundry/dropsonde/metric_sender"
+	"github.com/pivotal-golang/lager"
+)
+
+// StuckExitCode is what the server exits with when something is stuck and
+// it is told to exit, so that supervisors can tell a wedged server, to be
+// restarted and have its containers restored from their snapshots, from
+// one that crashed.
+const StuckExitCode = 70
+
+// Probe returns once whatever it checks, e.g. a lock, is responsive. A
+// probe that does not return within the timeout is stuck; an error only
+// means that it could not check.
+type Probe func() error
+
+type Watchdog struct {
+	// by name
+	Probes map[string]Probe
+
+	// how long a probe may take before it is stuck
+	Timeout time.Duration
+
+	Logger lager.Logger
+
+	// if set, how many probes are stuck is sent as watchdog.stuck on every
+	// check
+	MetricSender metric_sender.MetricSender
+
+	// if set, the process exits with StuckExitCode once anything is stuck
+	ExitWhenStuck bool
+
+	// defaults to os.Exit
+	Exit func(code int)
+
+	// probes still running from earlier checks, which are not run again
+	// until they return
+	pending      map[string]chan struct{}
+	pendingMutex sync.Mutex
+}
+
+// Check runs every probe, and returns the names of those that are stuck,
+// in order. Stuck probes are reported along with every goroutine's stack.
+func (w *Watchdog) Check() []string {
+	wLog := w.Logger.Session("watchdog")
+
+	running := map[string]chan struct{}{}
+	for name, probe := range w.Probes {
+		running[name] = w.start(wLog, name, probe)
+	}
+
+	deadline := time.After(w.Timeout)
+
+	stuck := []string{}
+	for name, done := range running {
+		select {
+		case <-done:
+		case <-deadline:
+			// already passed, for every probe still running
+			deadline = closedChannel()
+			stuck = append(stuck, name)
+		}
+	}
+
+	sort.Strings(stuck)
+
+	if w.MetricSender != nil {
+		w.MetricSender.SendValue("watchdog.stuck", float64(len(stuck)), "count")
+	}
+
+	if len(stuck) == 0 {
+		return stuck
+	}
+
+	wLog.Error("stuck", nil, lager.Data{
+		"probes":  stuck,
+		"timeout": w.Timeout.String(),
+		"stacks":  stacks(),
+	})
+
+	if w.ExitWhenStuck {
+		wLog.Info("exiting", lager.Data{"code": StuckExitCode})
+
+		exit := w.Exit
+		if exit == nil {
+			exit = os.Exit
+		}
+
+		exit(StuckExitCode)
+	}
+
+	return stuck
+}
+
+// start runs the probe in the background, unless it is still running from
+// an earlier check, and returns a channel closed once it returns.
+func (w *Watchdog) start(logger lager.Logger, name string, probe Probe) chan struct{} {
+	w.pendingMutex.Lock()
+	defer w.pendingMutex.Unlock()
+
+	if w.pending == nil {
+		w.pending = map[string]chan struct{}{}
+	}
+
+	if done, found := w.pending[name]; found {
+		return done
+	}
+
+	done := make(chan struct{})
+	w.pending[name] = done
+
+	go func() {
+		err := probe()
+		if err != nil {
+			logger.Error("probe-failed", err, lager.Data{"probe": name})
+		}
+
+		w.pendingMutex.Lock()
+		delete(w.pending, name)
+		w.pendingMutex.Unlock()
+
+		close(done)
+	}()
+
+	return done
+}
+
+func closedChannel() <-chan time.Time {
+	closed := make(chan time.Time)
+	close(closed)
+	return closed
+}
+
+// most of the goroutines' stacks that are logged
+const maxStacksSize = 64 * 1024 * 1024
+
+// stacks returns every goroutine's stack, as a panic would print them.
+func stacks() string {
+	buf := make([]byte, 1024*1024)
+
+	for {
+		n := runtime.Stack(buf, true)
+		if n < len(buf) || len(buf) >= maxStacksSize {
+			return string(buf[:n])
+		}
+
+		buf = make([]byte, 2*len(buf))
+	}
+}
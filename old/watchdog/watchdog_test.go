@@ -0,0 +1,132 @@
+package watchdog_test
+
+import (
+	"errors"
+	"time"
+
+	"github.com/cloudfoundry/dropsonde/metric_sender/fake"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gbytes"
+	"github.com/pivotal-golang/lager/lagertest"
+
+	"github.com/cloudfoundry-incubator/garden-linux/old/watchdog"
+)
+
+var _ = Describe("Watchdog", func() {
+	var logger *lagertest.TestLogger
+	var sender *fake.FakeMetricSender
+	var wedged chan struct{}
+	var probeRuns chan string
+
+	var dog *watchdog.Watchdog
+
+	BeforeEach(func() {
+		logger = lagertest.NewTestLogger("test")
+		sender = fake.NewFakeMetricSender()
+		wedged = make(chan struct{})
+		probeRuns = make(chan string, 10)
+
+		dog = &watchdog.Watchdog{
+			Probes: map[string]watchdog.Probe{
+				"responsive": func() error {
+					probeRuns <- "responsive"
+					return nil
+				},
+			},
+			Timeout:      50 * time.Millisecond,
+			Logger:       logger,
+			MetricSender: sender,
+		}
+	})
+
+	AfterEach(func() {
+		close(wedged)
+	})
+
+	Context("when every probe returns in time", func() {
+		It("reports nothing stuck", func() {
+			Ω(dog.Check()).Should(BeEmpty())
+			Ω(sender.GetValue("watchdog.stuck").Value).Should(BeZero())
+		})
+
+		Context("even if one fails", func() {
+			BeforeEach(func() {
+				dog.Probes["failing"] = func() error {
+					return errors.New("connection refused")
+				}
+			})
+
+			It("reports nothing stuck, logging the failure", func() {
+				Ω(dog.Check()).Should(BeEmpty())
+				Eventually(logger.TestSink.Buffer).Should(gbytes.Say("probe-failed"))
+			})
+		})
+	})
+
+	Context("when a probe does not return in time", func() {
+		var exitCodes []int
+
+		BeforeEach(func() {
+			dog.Probes["wedged"] = func() error {
+				probeRuns <- "wedged"
+				<-wedged
+				return nil
+			}
+
+			dog.Probes["also-wedged"] = func() error {
+				<-wedged
+				return nil
+			}
+
+			exitCodes = nil
+			dog.Exit = func(code int) {
+				exitCodes = append(exitCodes, code)
+			}
+		})
+
+		It("reports it stuck", func() {
+			Ω(dog.Check()).Should(Equal([]string{"also-wedged", "wedged"}))
+			Ω(sender.GetValue("watchdog.stuck")).Should(Equal(fake.Metric{Value: 2, Unit: "count"}))
+		})
+
+		It("logs every goroutine's stack", func() {
+			dog.Check()
+
+			Ω(logger.TestSink.Buffer).Should(gbytes.Say("test.watchdog.stuck"))
+			Ω(logger.TestSink.Buffer).Should(gbytes.Say("goroutine"))
+		})
+
+		It("does not run it again until it returns", func() {
+			dog.Check()
+			dog.Check()
+
+			Ω(dog.Check()).Should(ContainElement("wedged"))
+
+			runs := 0
+			for len(probeRuns) > 0 {
+				if <-probeRuns == "wedged" {
+					runs++
+				}
+			}
+
+			Ω(runs).Should(Equal(1))
+		})
+
+		It("does not exit", func() {
+			dog.Check()
+			Ω(exitCodes).Should(BeEmpty())
+		})
+
+		Context("when told to exit when stuck", func() {
+			BeforeEach(func() {
+				dog.ExitWhenStuck = true
+			})
+
+			It("exits with StuckExitCode", func() {
+				dog.Check()
+				Ω(exitCodes).Should(Equal([]int{watchdog.StuckExitCode}))
+			})
+		})
+	})
+})